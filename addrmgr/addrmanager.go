@@ -17,6 +17,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,7 +47,13 @@ type AddrManager struct {
 	nNew           int
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
+	seenAddresses  map[string]*seenAddress
 	version        int
+
+	// reachableNets restricts the networks of the addresses returned by
+	// GetAddress.  A nil map means addresses from any network are
+	// returned.
+	reachableNets map[Network]struct{}
 }
 
 type serializedKnownAddress struct {
@@ -58,20 +65,46 @@ type serializedKnownAddress struct {
 	LastSuccess int64
 	Services    wire.ServiceFlag
 	SrcServices wire.ServiceFlag
-	// no refcount or tried, that is available from context.
+
+	// The tables the address is in are stored along with it since the
+	// third version.  Older versions only list the addresses in each
+	// bucket, so they are migrated to these fields when loaded.
+	Tried       bool
+	TriedBucket int
+	NewBuckets  []int
 }
 
 type serializedAddrManager struct {
-	Version      int
-	Key          [32]byte
-	Addresses    []*serializedKnownAddress
-	NewBuckets   [newBucketCount][]string // string is NetAddressKey
-	TriedBuckets [triedBucketCount][]string
+	Version   int
+	Key       [32]byte
+	Addresses []*serializedKnownAddress
+
+	// The addresses in each bucket are only stored by the versions before
+	// the third one.  The string is the NetAddressKey of an address.
+	NewBuckets   [][]string `json:",omitempty"`
+	TriedBuckets [][]string `json:",omitempty"`
 }
 
 type localAddress struct {
 	na    *wire.NetAddress
 	score AddressPriority
+
+	// discovered is set when the address was learned from the addresses
+	// peers reported to see the local node at rather than added
+	// explicitly, in which case it may be evicted by newer ones.
+	discovered bool
+
+	// groups houses the network groups of the peers which raised the
+	// score of the address by reporting it.
+	groups map[string]struct{}
+}
+
+// seenAddress houses an address which is not a known local address that peers
+// reported to see the local node at along with the network groups of those
+// peers.
+type seenAddress struct {
+	na     *wire.NetAddress
+	groups map[string]struct{}
 }
 
 // AddressPriority type is used to describe the hierarchy of local address
@@ -85,6 +118,10 @@ const (
 	// BoundPrio signifies the address has been explicitly bounded to.
 	BoundPrio
 
+	// InboundPrio signifies the address was reported by an inbound peer
+	// as the one it connected to.
+	InboundPrio
+
 	// UpnpPrio signifies the address was obtained from UPnP.
 	UpnpPrio
 
@@ -96,6 +133,25 @@ const (
 )
 
 const (
+	// seenLocalAddressConfirmations is the number of peers from distinct
+	// network groups which must report an unknown address before it is
+	// added to the known local addresses.
+	seenLocalAddressConfirmations = 3
+
+	// maxSeenAddresses is the maximum number of unknown addresses reported
+	// by peers that are tracked until enough peers confirmed them.
+	maxSeenAddresses = 64
+
+	// maxDiscoveredLocalAddresses is the maximum number of local addresses
+	// learned from the addresses peers report.  The lowest scoring one is
+	// evicted to make room for a newly confirmed address.
+	maxDiscoveredLocalAddresses = 8
+
+	// maxSeenLocalAddressScore is the highest score peers reporting an
+	// address are able to raise it to.  It is below ManualPrio so peers
+	// are unable to make an address outscore one configured by the user.
+	maxSeenLocalAddressScore = ManualPrio - 1
+
 	// needAddressThreshold is the number of addresses under which the
 	// address manager will claim to need more addresses.
 	needAddressThreshold = 1000
@@ -158,7 +214,7 @@ const (
 	getAddrPercent = 23
 
 	// serialisationVersion is the current version of the on-disk format.
-	serialisationVersion = 2
+	serialisationVersion = 3
 )
 
 // updateAddress is a helper function to either update an address already known
@@ -382,11 +438,72 @@ func (a *AddrManager) savePeers() {
 			ska.Services = v.na.Services
 			ska.SrcServices = v.srcAddr.Services
 		}
-		// Tried and refs are implicit in the rest of the structure
-		// and will be worked out from context on unserialisation.
+		// Refs are implicit in the buckets and will be worked out from
+		// context on unserialisation.
 		sam.Addresses[i] = ska
 		i++
 	}
+	if a.version > 2 {
+		a.serializeBuckets(sam.Addresses)
+	} else {
+		a.serializeBucketLists(sam)
+	}
+
+	w, err := os.Create(a.peersFile)
+	if err != nil {
+		log.Errorf("Error opening file %s: %v", a.peersFile, err)
+		return
+	}
+	enc := json.NewEncoder(w)
+	defer w.Close()
+	if err := enc.Encode(&sam); err != nil {
+		log.Errorf("Failed to encode file %s: %v", a.peersFile, err)
+		return
+	}
+}
+
+// serializeBuckets stores the tables each of the passed serialized addresses is
+// in along with it.  The caller must hold the address manager lock.
+func (a *AddrManager) serializeBuckets(addrs []*serializedKnownAddress) {
+	for _, ska := range addrs {
+		ka := a.addrIndex[ska.Addr]
+		if ka.tried {
+			ska.Tried = true
+			ska.TriedBucket = a.findTriedBucket(ka)
+			continue
+		}
+		for i := range a.addrNew {
+			if _, ok := a.addrNew[i][ska.Addr]; ok {
+				ska.NewBuckets = append(ska.NewBuckets, i)
+			}
+		}
+	}
+}
+
+// findTriedBucket returns the tried bucket of the passed tried address.  The
+// caller must hold the address manager lock.
+func (a *AddrManager) findTriedBucket(ka *KnownAddress) int {
+	bucket := a.getTriedBucket(ka.na)
+	for e := a.addrTried[bucket].Front(); e != nil; e = e.Next() {
+		if e.Value.(*KnownAddress) == ka {
+			return bucket
+		}
+	}
+	for i := range a.addrTried {
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			if e.Value.(*KnownAddress) == ka {
+				return i
+			}
+		}
+	}
+	return bucket
+}
+
+// serializeBucketLists stores the addresses in each bucket in the passed
+// serialized address manager as done by the versions before the third one.
+// The caller must hold the address manager lock.
+func (a *AddrManager) serializeBucketLists(sam *serializedAddrManager) {
+	sam.NewBuckets = make([][]string, len(a.addrNew))
 	for i := range a.addrNew {
 		sam.NewBuckets[i] = make([]string, len(a.addrNew[i]))
 		j := 0
@@ -395,6 +512,7 @@ func (a *AddrManager) savePeers() {
 			j++
 		}
 	}
+	sam.TriedBuckets = make([][]string, len(a.addrTried))
 	for i := range a.addrTried {
 		sam.TriedBuckets[i] = make([]string, a.addrTried[i].Len())
 		j := 0
@@ -404,18 +522,50 @@ func (a *AddrManager) savePeers() {
 			j++
 		}
 	}
+}
 
-	w, err := os.Create(a.peersFile)
-	if err != nil {
-		log.Errorf("Error opening file %s: %v", a.peersFile, err)
-		return
+// migrateBucketLists migrates the addresses in each bucket of a serialized
+// address manager of a version before the third one to the tables stored
+// along with each address.
+func migrateBucketLists(sam *serializedAddrManager) error {
+	addrs := make(map[string]*serializedKnownAddress, len(sam.Addresses))
+	for _, ska := range sam.Addresses {
+		addrs[ska.Addr] = ska
 	}
-	enc := json.NewEncoder(w)
-	defer w.Close()
-	if err := enc.Encode(&sam); err != nil {
-		log.Errorf("Failed to encode file %s: %v", a.peersFile, err)
-		return
+	for i := range sam.NewBuckets {
+		for _, val := range sam.NewBuckets[i] {
+			ska, ok := addrs[val]
+			if !ok {
+				return fmt.Errorf("newbucket contains %s but "+
+					"none in address list", val)
+			}
+			ska.NewBuckets = append(ska.NewBuckets, i)
+		}
+	}
+	for i := range sam.TriedBuckets {
+		for _, val := range sam.TriedBuckets[i] {
+			ska, ok := addrs[val]
+			if !ok {
+				return fmt.Errorf("triedbucket contains %s but "+
+					"none in address list", val)
+			}
+			if len(ska.NewBuckets) > 0 || ska.Tried {
+				return fmt.Errorf("address %s after serialisation "+
+					"which is both new and tried!", val)
+			}
+			ska.Tried = true
+			ska.TriedBucket = i
+		}
+	}
+	for _, ska := range sam.Addresses {
+		if !ska.Tried && len(ska.NewBuckets) == 0 {
+			return fmt.Errorf("address %s after serialisation "+
+				"with no references", ska.Addr)
+		}
 	}
+	sam.NewBuckets = nil
+	sam.TriedBuckets = nil
+	return nil
 }
 
 // loadPeers loads the known address from the saved file.  If empty, missing, or
@@ -466,6 +616,15 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 			"addrmanager", sam.Version)
 	}
 
+	// Versions before the third one only list the addresses in each
+	// bucket, so migrate them to the tables stored along with each address
+	// which the rest of the loading relies on.
+	if sam.Version < 3 {
+		if err := migrateBucketLists(&sam); err != nil {
+			return err
+		}
+	}
+
 	copy(a.key[:], sam.Key[:])
 
 	for _, v := range sam.Addresses {
@@ -482,6 +641,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 			return fmt.Errorf("failed to deserialize netaddress "+
 				"%s: %v", v.Addr, err)
 		}
+		ka.na.Timestamp = time.Unix(v.TimeStamp, 0)
 
 		// The first version of the serialized address manager was not
 		// aware of the service bits associated with the source address,
@@ -498,49 +658,37 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		ka.attempts = v.Attempts
 		ka.lastattempt = time.Unix(v.LastAttempt, 0)
 		ka.lastsuccess = time.Unix(v.LastSuccess, 0)
-		a.addrIndex[NetAddressKey(ka.na)] = ka
-	}
-
-	for i := range sam.NewBuckets {
-		for _, val := range sam.NewBuckets[i] {
-			ka, ok := a.addrIndex[val]
-			if !ok {
-				return fmt.Errorf("newbucket contains %s but "+
-					"none in address list", val)
-			}
-
-			if ka.refs == 0 {
-				a.nNew++
-			}
-			ka.refs++
-			a.addrNew[i][val] = ka
-		}
-	}
-	for i := range sam.TriedBuckets {
-		for _, val := range sam.TriedBuckets[i] {
-			ka, ok := a.addrIndex[val]
-			if !ok {
-				return fmt.Errorf("Newbucket contains %s but "+
-					"none in address list", val)
+		key := NetAddressKey(ka.na)
+		a.addrIndex[key] = ka
+
+		// Add the address to its tables.  Buckets which do not exist,
+		// such as when the number of buckets changed, are replaced by
+		// the bucket the address belongs to now.
+		if v.Tried {
+			bucket := v.TriedBucket
+			if bucket < 0 || bucket >= len(a.addrTried) {
+				bucket = a.getTriedBucket(ka.na)
 			}
-
 			ka.tried = true
 			a.nTried++
-			a.addrTried[i].PushBack(ka)
+			a.addrTried[bucket].PushBack(ka)
+			continue
 		}
-	}
-
-	// Sanity checking.
-	for k, v := range a.addrIndex {
-		if v.refs == 0 && !v.tried {
-			return fmt.Errorf("address %s after serialisation "+
-				"with no references", k)
+		for _, bucket := range v.NewBuckets {
+			if bucket < 0 || bucket >= len(a.addrNew) {
+				bucket = a.getNewBucket(ka.na, ka.srcAddr)
+			}
+			if _, ok := a.addrNew[bucket][key]; ok {
+				continue
+			}
+			ka.refs++
+			a.addrNew[bucket][key] = ka
 		}
-
-		if v.refs > 0 && v.tried {
+		if ka.refs == 0 {
 			return fmt.Errorf("address %s after serialisation "+
-				"which is both new and tried!", k)
+				"with no references", key)
 		}
+		a.nNew++
 	}
 
 	return nil
@@ -781,6 +929,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	if a.numAddresses() == 0 {
 		return nil
 	}
+	if a.reachableNets != nil {
+		return a.getReachableAddress()
+	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
 	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
@@ -840,6 +991,128 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// getReachableAddress returns a single address from one of the reachable
+// networks using the same selection rules as GetAddress, or nil when no
+// address from a reachable network is known.  The caller must hold the address
+// manager lock.
+func (a *AddrManager) getReachableAddress() *KnownAddress {
+	var tried, fresh []*KnownAddress
+	for _, ka := range a.addrIndex {
+		if !a.isReachable(ka.na) {
+			continue
+		}
+		if ka.tried {
+			tried = append(tried, ka)
+		} else {
+			fresh = append(fresh, ka)
+		}
+	}
+
+	// Use a 50% chance for choosing between tried and new table entries.
+	candidates := fresh
+	if len(tried) > 0 && (len(fresh) == 0 || a.rand.Intn(2) == 0) {
+		candidates = tried
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ka := a.chooseAddress(candidates)
+	log.Tracef("Selected reachable address %v", NetAddressKey(ka.na))
+	return ka
+}
+
+// GetFeelerAddress returns a single address from one of the reachable networks
+// which is only in the new table, or nil when there is none.  It is intended to
+// be tested with a feeler connection, which moves it to the tried table when it
+// succeeds.  Addresses which have not been attempted recently are preferred.
+func (a *AddrManager) GetFeelerAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	var candidates []*KnownAddress
+	for _, ka := range a.addrIndex {
+		if !ka.tried && a.isReachable(ka.na) {
+			candidates = append(candidates, ka)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ka := a.chooseAddress(candidates)
+	log.Tracef("Selected feeler address %v", NetAddressKey(ka.na))
+	return ka
+}
+
+// chooseAddress returns a random address from the passed non-empty candidates
+// weighted by their selection probability.  The caller must hold the address
+// manager lock.
+func (a *AddrManager) chooseAddress(candidates []*KnownAddress) *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		ka := candidates[a.rand.Intn(len(candidates))]
+		randval := a.rand.Intn(large)
+		if float64(randval) < (factor * ka.chance() * float64(large)) {
+			return ka
+		}
+		factor *= 1.2
+	}
+}
+
+// SetReachableNetworks restricts the addresses returned by GetAddress to the
+// passed networks.  Calling it without any networks removes the restriction.
+func (a *AddrManager) SetReachableNetworks(nets ...Network) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if len(nets) == 0 {
+		a.reachableNets = nil
+		return
+	}
+	a.reachableNets = make(map[Network]struct{}, len(nets))
+	for _, n := range nets {
+		a.reachableNets[n] = struct{}{}
+	}
+}
+
+// IsReachable returns whether or not the passed address belongs to one of the
+// networks set with SetReachableNetworks.  All addresses are reachable when no
+// networks have been set.
+func (a *AddrManager) IsReachable(na *wire.NetAddress) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.isReachable(na)
+}
+
+// IsNetworkReachable returns whether or not the passed network is one of the
+// networks set with SetReachableNetworks.  All networks are reachable when no
+// networks have been set.
+func (a *AddrManager) IsNetworkReachable(n Network) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.isNetworkReachable(n)
+}
+
+// isReachable returns whether or not the passed address belongs to one of the
+// reachable networks.  The caller must hold the address manager lock.
+func (a *AddrManager) isReachable(na *wire.NetAddress) bool {
+	return a.isNetworkReachable(GetNetwork(na))
+}
+
+// isNetworkReachable returns whether or not the passed network is one of the
+// reachable networks.  The caller must hold the address manager lock.
+func (a *AddrManager) isNetworkReachable(n Network) bool {
+	if a.reachableNets == nil {
+		return true
+	}
+	_, ok := a.reachableNets[n]
+	return ok
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -1002,8 +1275,14 @@ func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPrior
 	a.lamtx.Lock()
 	defer a.lamtx.Unlock()
 
+	// Explicitly added addresses are never evicted in favor of addresses
+	// reported by peers.
 	key := NetAddressKey(na)
+	delete(a.seenAddresses, key)
 	la, ok := a.localAddresses[key]
+	if ok {
+		la.discovered = false
+	}
 	if !ok || la.score < priority {
 		if ok {
 			la.score = priority + 1
@@ -1017,6 +1296,192 @@ func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPrior
 	return nil
 }
 
+// SeenLocalAddress accounts for the peer with the address srcAddr reporting na
+// as the address it sees the local node at.  Only the first report from each
+// network group counts, so a single peer or network is unable to influence the
+// local addresses on its own.
+//
+// A known local address gains score up to a limit below ManualPrio for each
+// report, while an unknown address is added with InboundPrio once peers from
+// seenLocalAddressConfirmations distinct network groups reported it.  At most
+// maxDiscoveredLocalAddresses addresses are added this way, with the lowest
+// scoring one evicted in favor of a newly confirmed address.  It returns
+// whether or not na was added to the local addresses.
+func (a *AddrManager) SeenLocalAddress(na, srcAddr *wire.NetAddress) bool {
+	if !IsRoutable(na) {
+		return false
+	}
+	key, group := NetAddressKey(na), GroupKey(srcAddr)
+
+	a.lamtx.Lock()
+	defer a.lamtx.Unlock()
+
+	if la, ok := a.localAddresses[key]; ok {
+		_, seen := la.groups[group]
+		if !seen && la.score < maxSeenLocalAddressScore {
+			if la.groups == nil {
+				la.groups = make(map[string]struct{})
+			}
+			la.groups[group] = struct{}{}
+			la.score++
+		}
+		return false
+	}
+
+	sa, ok := a.seenAddresses[key]
+	if !ok {
+		if len(a.seenAddresses) >= maxSeenAddresses {
+			a.evictSeenAddress()
+		}
+		sa = &seenAddress{na: na, groups: make(map[string]struct{})}
+		a.seenAddresses[key] = sa
+	}
+	sa.groups[group] = struct{}{}
+	if len(sa.groups) < seenLocalAddressConfirmations {
+		return false
+	}
+
+	delete(a.seenAddresses, key)
+	a.evictDiscoveredLocalAddress()
+	a.localAddresses[key] = &localAddress{
+		na:         na,
+		score:      InboundPrio,
+		discovered: true,
+		groups:     sa.groups,
+	}
+	return true
+}
+
+// evictSeenAddress removes the reported unknown address confirmed by the fewest
+// network groups to make room for a newly reported one.
+//
+// This function MUST be called with the local address lock held (for writes).
+func (a *AddrManager) evictSeenAddress() {
+	var evictKey string
+	var evict *seenAddress
+	for key, sa := range a.seenAddresses {
+		if evict == nil || len(sa.groups) < len(evict.groups) ||
+			(len(sa.groups) == len(evict.groups) && key < evictKey) {
+
+			evictKey, evict = key, sa
+		}
+	}
+	delete(a.seenAddresses, evictKey)
+}
+
+// evictDiscoveredLocalAddress removes the lowest scoring local address learned
+// from the addresses peers report when the maximum number of them is reached.
+//
+// This function MUST be called with the local address lock held (for writes).
+func (a *AddrManager) evictDiscoveredLocalAddress() {
+	var numDiscovered int
+	var evictKey string
+	var evict *localAddress
+	for key, la := range a.localAddresses {
+		if !la.discovered {
+			continue
+		}
+		numDiscovered++
+		if evict == nil || la.score < evict.score ||
+			(la.score == evict.score && key < evictKey) {
+
+			evictKey, evict = key, la
+		}
+	}
+	if numDiscovered >= maxDiscoveredLocalAddresses {
+		delete(a.localAddresses, evictKey)
+	}
+}
+
+// LocalAddressInfo describes a known local address along with the score it
+// has accumulated as a candidate to advertise to peers.
+type LocalAddressInfo struct {
+	NetAddress *wire.NetAddress
+	Score      AddressPriority
+}
+
+// LocalAddresses returns the known local addresses ordered by descending score.
+// Addresses with the same score are ordered by their address key so the
+// result is deterministic.
+func (a *AddrManager) LocalAddresses() []LocalAddressInfo {
+	a.lamtx.Lock()
+	defer a.lamtx.Unlock()
+
+	addrs := make([]LocalAddressInfo, 0, len(a.localAddresses))
+	for _, la := range a.localAddresses {
+		addrs = append(addrs, LocalAddressInfo{
+			NetAddress: la.na,
+			Score:      la.score,
+		})
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Score != addrs[j].Score {
+			return addrs[i].Score > addrs[j].Score
+		}
+		return NetAddressKey(addrs[i].NetAddress) <
+			NetAddressKey(addrs[j].NetAddress)
+	})
+	return addrs
+}
+
+// TableAddress describes a known address along with the bucket of the new or
+// tried table it is in and its position within the bucket.
+type TableAddress struct {
+	Tried       bool
+	Bucket      int
+	Position    int
+	NetAddress  *wire.NetAddress
+	Source      *wire.NetAddress
+	Attempts    int
+	LastAttempt time.Time
+	LastSuccess time.Time
+}
+
+// TableAddresses returns copies of the known addresses for each bucket of the
+// new and tried tables they are in, ordered by table, bucket, and position.  An
+// address in the new table is returned once for each bucket referencing it.
+// The addresses of a new bucket are unordered, so their positions follow the
+// order of their address keys.
+func (a *AddrManager) TableAddresses() []TableAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	tableAddress := func(ka *KnownAddress, bucket, position int) TableAddress {
+		na, srcAddr := *ka.na, *ka.srcAddr
+		return TableAddress{
+			Tried:       ka.tried,
+			Bucket:      bucket,
+			Position:    position,
+			NetAddress:  &na,
+			Source:      &srcAddr,
+			Attempts:    ka.attempts,
+			LastAttempt: ka.lastattempt,
+			LastSuccess: ka.lastsuccess,
+		}
+	}
+
+	addrs := make([]TableAddress, 0, a.nNew+a.nTried)
+	for i := range a.addrNew {
+		keys := make([]string, 0, len(a.addrNew[i]))
+		for k := range a.addrNew[i] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for j, k := range keys {
+			addrs = append(addrs, tableAddress(a.addrNew[i][k], i, j))
+		}
+	}
+	for i := range a.addrTried {
+		j := 0
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			ka := e.Value.(*KnownAddress)
+			addrs = append(addrs, tableAddress(ka, i, j))
+			j++
+		}
+	}
+	return addrs
+}
+
 // getReachabilityFrom returns the relative reachability of the provided local
 // address to the provided remote address.
 func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
@@ -1047,7 +1512,7 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 	}
 
 	if IsRFC4380(remoteAddr) {
-		if !IsRoutable(localAddr) {
+		if !IsRoutable(localAddr) || IsOnionCatTor(localAddr) {
 			return Default
 		}
 
@@ -1076,7 +1541,9 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		tunnelled = true
 	}
 
-	if !IsRoutable(localAddr) {
+	// An IPv6 peer can only reach a tor address when it uses tor as well,
+	// so any other address is preferred.
+	if !IsRoutable(localAddr) || IsOnionCatTor(localAddr) {
 		return Default
 	}
 
@@ -1106,9 +1573,11 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 	var bestscore AddressPriority
 	var bestAddress *wire.NetAddress
 	for _, la := range a.localAddresses {
+		// Addresses the remote peer can't reach are never suggested
+		// regardless of their score.
 		reach := getReachabilityFrom(la.na, remoteAddr)
 		if reach > bestreach ||
-			(reach == bestreach && la.score > bestscore) {
+			(reach == bestreach && reach > 0 && la.score > bestscore) {
 			bestreach = reach
 			bestscore = la.score
 			bestAddress = la.na
@@ -1144,6 +1613,7 @@ func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager
 		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		quit:           make(chan struct{}),
 		localAddresses: make(map[string]*localAddress),
+		seenAddresses:  make(map[string]*seenAddress),
 		version:        serialisationVersion,
 	}
 	am.reset()
@@ -1,11 +1,14 @@
 package addrmgr
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/wire"
 )
@@ -192,3 +195,288 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	addrMgr.loadPeers()
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
+
+// TestAddrManagerMigration ensures that the peers files written by the older
+// versions of the address manager are upgraded when loaded, keeping the tables
+// of the addresses along with their timestamps and services, and that they are
+// saved with the current version afterwards.
+func TestAddrManagerMigration(t *testing.T) {
+	t.Parallel()
+
+	newAddr := &wire.NetAddress{
+		Timestamp: time.Unix(1600000000, 0),
+		Services:  wire.SFNodeNetwork | wire.SFNodeWitness,
+		IP:        net.ParseIP("173.194.115.66"),
+		Port:      8333,
+	}
+	triedAddr := &wire.NetAddress{
+		Timestamp: time.Unix(1600000100, 0),
+		Services:  wire.SFNodeWitness,
+		IP:        net.ParseIP("2001:470::1"),
+		Port:      8333,
+	}
+	srcAddr := &wire.NetAddress{
+		Services: wire.SFNodeNetwork,
+		IP:       net.ParseIP("173.194.115.67"),
+		Port:     8333,
+	}
+
+	for _, version := range []int{1, 2} {
+		tempDir, err := ioutil.TempDir("", "addrmgr")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		// Write a peers file with one new and one tried address using
+		// the older version.
+		addrMgr := New(tempDir, nil)
+		addrMgr.version = version
+		addrMgr.AddAddress(newAddr, srcAddr)
+		addrMgr.AddAddress(triedAddr, srcAddr)
+		addrMgr.Good(triedAddr)
+		addrMgr.savePeers()
+
+		// Services were only stored since the second version, so the
+		// addresses of the first version default to SFNodeNetwork.
+		wantServices := func(na *wire.NetAddress) wire.ServiceFlag {
+			if version == 1 {
+				return wire.SFNodeNetwork
+			}
+			return na.Services
+		}
+
+		// The addresses must survive loading the file with the current
+		// version along with their tables, timestamps, and services.
+		// Saving it again writes the current version, which must load
+		// the same way.
+		for i := 0; i < 2; i++ {
+			addrMgr = New(tempDir, nil)
+			addrMgr.loadPeers()
+			if got := addrMgr.numAddresses(); got != 2 {
+				t.Fatalf("v%d: expected to find 2 addresses, "+
+					"found %d", version, got)
+			}
+			for _, na := range []*wire.NetAddress{newAddr, triedAddr} {
+				ka := addrMgr.addrIndex[NetAddressKey(na)]
+				if ka == nil {
+					t.Fatalf("v%d: expected to find address %v",
+						version, NetAddressKey(na))
+				}
+				if !ka.na.Timestamp.Equal(na.Timestamp) {
+					t.Fatalf("v%d: expected address timestamp "+
+						"%v, got %v", version, na.Timestamp,
+						ka.na.Timestamp)
+				}
+				if ka.na.Services != wantServices(na) {
+					t.Fatalf("v%d: expected address services "+
+						"%v, got %v", version, wantServices(na),
+						ka.na.Services)
+				}
+				if ka.srcAddr.Services != wantServices(srcAddr) {
+					t.Fatalf("v%d: expected source services "+
+						"%v, got %v", version,
+						wantServices(srcAddr),
+						ka.srcAddr.Services)
+				}
+				if ka.tried != (na == triedAddr) {
+					t.Fatalf("v%d: unexpected tried state %v "+
+						"for address %v", version, ka.tried,
+						NetAddressKey(na))
+				}
+			}
+			if addrMgr.nNew != 1 || addrMgr.nTried != 1 {
+				t.Fatalf("v%d: expected 1 new and 1 tried "+
+					"address, got %d and %d", version,
+					addrMgr.nNew, addrMgr.nTried)
+			}
+			addrMgr.savePeers()
+
+			f, err := os.Open(addrMgr.peersFile)
+			if err != nil {
+				t.Fatalf("unable to open peers file: %v", err)
+			}
+			var sam serializedAddrManager
+			err = json.NewDecoder(f).Decode(&sam)
+			f.Close()
+			if err != nil {
+				t.Fatalf("unable to decode peers file: %v", err)
+			}
+			if sam.Version != serialisationVersion {
+				t.Fatalf("v%d: expected peers file version %d, "+
+					"got %d", version, serialisationVersion,
+					sam.Version)
+			}
+		}
+	}
+}
+
+// TestTableAddresses ensures the addresses of the new and tried tables are
+// returned along with the buckets they belong to and their sources and
+// timestamps.
+func TestTableAddresses(t *testing.T) {
+	t.Parallel()
+
+	addrMgr := New("testtableaddresses", nil)
+	srcAddr := &wire.NetAddress{
+		Services: wire.SFNodeNetwork,
+		IP:       net.ParseIP("173.194.115.67"),
+		Port:     8333,
+	}
+	var addrs []*wire.NetAddress
+	for i := 0; i < 4; i++ {
+		na := &wire.NetAddress{
+			Timestamp: time.Unix(1600000000+int64(i), 0),
+			Services:  wire.SFNodeNetwork,
+			IP:        net.IPv4(12, byte(i), 1, 1),
+			Port:      8333,
+		}
+		addrMgr.AddAddress(na, srcAddr)
+		addrs = append(addrs, na)
+	}
+	addrMgr.Good(addrs[0])
+
+	tableAddrs := addrMgr.TableAddresses()
+	if len(tableAddrs) != len(addrs) {
+		t.Fatalf("expected %d table addresses, got %d", len(addrs),
+			len(tableAddrs))
+	}
+	positions := make(map[TableAddress]struct{})
+	for i, ta := range tableAddrs {
+		var na *wire.NetAddress
+		for _, addr := range addrs {
+			if addr.IP.Equal(ta.NetAddress.IP) {
+				na = addr
+			}
+		}
+		if na == nil {
+			t.Fatalf("unexpected table address %v",
+				NetAddressKey(ta.NetAddress))
+		}
+		if ta.Tried != (na == addrs[0]) {
+			t.Fatalf("unexpected tried state %v for address %v",
+				ta.Tried, NetAddressKey(na))
+		}
+		wantBucket := addrMgr.getNewBucket(na, srcAddr)
+		if ta.Tried {
+			wantBucket = addrMgr.getTriedBucket(na)
+		}
+		if ta.Bucket != wantBucket {
+			t.Fatalf("unexpected bucket %d for address %v, want %d",
+				ta.Bucket, NetAddressKey(na), wantBucket)
+		}
+		position := TableAddress{
+			Tried:    ta.Tried,
+			Bucket:   ta.Bucket,
+			Position: ta.Position,
+		}
+		if _, ok := positions[position]; ok {
+			t.Fatalf("duplicate position %d/%d for address %v",
+				ta.Bucket, ta.Position, NetAddressKey(na))
+		}
+		positions[position] = struct{}{}
+		if !ta.NetAddress.Timestamp.Equal(na.Timestamp) {
+			t.Fatalf("expected address timestamp %v, got %v",
+				na.Timestamp, ta.NetAddress.Timestamp)
+		}
+		assertAddr(t, ta.Source, srcAddr)
+
+		// The tried table follows the new table.
+		if i > 0 && !ta.Tried && tableAddrs[i-1].Tried {
+			t.Fatalf("new table address %v after the tried table",
+				NetAddressKey(na))
+		}
+	}
+}
+
+// TestSeenLocalAddressAdversarial ensures peers reporting the addresses they
+// see the local node at are unable to add local addresses from a single network
+// group, raise the score of a local address past a configured one, or grow the
+// local addresses and reported addresses without bound.
+func TestSeenLocalAddressAdversarial(t *testing.T) {
+	amgr := New(t.Name(), nil)
+	newAddr := func(ip string) *wire.NetAddress {
+		return wire.NewNetAddressIPPort(net.ParseIP(ip), 8333, 0)
+	}
+	manual, bound := newAddr("204.124.1.1"), newAddr("204.124.1.2")
+	if err := amgr.AddLocalAddress(manual, ManualPrio); err != nil {
+		t.Fatalf("AddLocalAddress: unexpected error: %v", err)
+	}
+	if err := amgr.AddLocalAddress(bound, BoundPrio); err != nil {
+		t.Fatalf("AddLocalAddress: unexpected error: %v", err)
+	}
+	checkLocalAddresses := func(want int) {
+		t.Helper()
+		if got := len(amgr.LocalAddresses()); got != want {
+			t.Fatalf("unexpected number of local addresses - got %d, "+
+				"want %d", got, want)
+		}
+	}
+
+	// Many peers of the same network group reporting an unknown address
+	// don't add it and only raise the score of a known one once.
+	attacker := newAddr("204.124.8.1")
+	for i := 0; i < 100; i++ {
+		srcAddr := newAddr(fmt.Sprintf("12.1.%d.%d", i, i+1))
+		if amgr.SeenLocalAddress(attacker, srcAddr) {
+			t.Fatalf("SeenLocalAddress: address %s was added by peers "+
+				"of a single network group", attacker.IP)
+		}
+		amgr.SeenLocalAddress(bound, srcAddr)
+	}
+	checkLocalAddresses(2)
+	if score := amgr.localAddresses[NetAddressKey(bound)].score; score != BoundPrio+1 {
+		t.Fatalf("unexpected score of %s - got %d, want %d", bound.IP,
+			score, BoundPrio+1)
+	}
+
+	// Peers from many network groups are unable to raise the score of an
+	// address past the configured one.
+	for i := 0; i < 100; i++ {
+		srcAddr := newAddr(fmt.Sprintf("%d.1.0.1", i+1))
+		amgr.SeenLocalAddress(bound, srcAddr)
+	}
+	if score := amgr.localAddresses[NetAddressKey(bound)].score; score != maxSeenLocalAddressScore {
+		t.Fatalf("unexpected score of %s - got %d, want %d", bound.IP,
+			score, maxSeenLocalAddressScore)
+	}
+	best := amgr.GetBestLocalAddress(newAddr("173.194.115.66"))
+	if !best.IP.Equal(manual.IP) {
+		t.Fatalf("unexpected best local address - got %s, want %s",
+			best.IP, manual.IP)
+	}
+
+	// Addresses confirmed by peers from enough network groups are added,
+	// but only up to a limit with the newest ones evicting older ones
+	// while the explicitly added addresses remain.
+	var discovered *wire.NetAddress
+	for i := 0; i < maxDiscoveredLocalAddresses*2; i++ {
+		discovered = newAddr(fmt.Sprintf("204.124.9.%d", i+1))
+		for j := 0; j < seenLocalAddressConfirmations; j++ {
+			srcAddr := newAddr(fmt.Sprintf("%d.2.0.1", j+1))
+			added := amgr.SeenLocalAddress(discovered, srcAddr)
+			if wantAdded := j == seenLocalAddressConfirmations-1; added != wantAdded {
+				t.Fatalf("SeenLocalAddress: unexpected result "+
+					"for report %d of %s - got %v, want %v",
+					j, discovered.IP, added, wantAdded)
+			}
+		}
+	}
+	checkLocalAddresses(maxDiscoveredLocalAddresses + 2)
+	for _, na := range []*wire.NetAddress{manual, bound, discovered} {
+		if _, ok := amgr.localAddresses[NetAddressKey(na)]; !ok {
+			t.Fatalf("local address %s was evicted", na.IP)
+		}
+	}
+
+	// Reports of many unknown addresses only track a limited number of
+	// them.
+	for i := 0; i < maxSeenAddresses*2; i++ {
+		na := newAddr(fmt.Sprintf("204.125.%d.1", i))
+		amgr.SeenLocalAddress(na, newAddr("12.1.0.1"))
+	}
+	if len(amgr.seenAddresses) > maxSeenAddresses {
+		t.Fatalf("unexpected number of reported addresses - got %d, "+
+			"want at most %d", len(amgr.seenAddresses), maxSeenAddresses)
+	}
+}
@@ -208,6 +208,54 @@ func TestAddLocalAddress(t *testing.T) {
 	}
 }
 
+func TestLocalAddresses(t *testing.T) {
+	amgr := addrmgr.New("testlocaladdresses", nil)
+	if addrs := amgr.LocalAddresses(); len(addrs) != 0 {
+		t.Fatalf("LocalAddresses: got %d addresses, want 0", len(addrs))
+	}
+
+	addrs := []struct {
+		ip       string
+		priority addrmgr.AddressPriority
+	}{
+		{"204.124.1.1", addrmgr.InterfacePrio},
+		{"2620:100::1", addrmgr.BoundPrio},
+		{"192.168.0.100", addrmgr.ManualPrio},
+		{"173.194.115.66", addrmgr.InterfacePrio},
+		{"204.124.1.1", addrmgr.BoundPrio},
+	}
+	for _, addr := range addrs {
+		na := wire.NewNetAddressIPPort(net.ParseIP(addr.ip), 8333, 0)
+		amgr.AddLocalAddress(na, addr.priority)
+	}
+
+	// The unroutable address is never added, and re-adding an address
+	// with a higher priority bumps its score above that priority.
+	want := []struct {
+		ip    string
+		score addrmgr.AddressPriority
+	}{
+		{"204.124.1.1", addrmgr.BoundPrio + 1},
+		{"2620:100::1", addrmgr.BoundPrio},
+		{"173.194.115.66", addrmgr.InterfacePrio},
+	}
+	got := amgr.LocalAddresses()
+	if len(got) != len(want) {
+		t.Fatalf("LocalAddresses: got %d addresses, want %d", len(got),
+			len(want))
+	}
+	for i, w := range want {
+		if !got[i].NetAddress.IP.Equal(net.ParseIP(w.ip)) {
+			t.Errorf("LocalAddresses #%d: got address %s, want %s", i,
+				got[i].NetAddress.IP, w.ip)
+		}
+		if got[i].Score != w.score {
+			t.Errorf("LocalAddresses #%d: got score %d, want %d", i,
+				got[i].Score, w.score)
+		}
+	}
+}
+
 func TestAttempt(t *testing.T) {
 	n := addrmgr.New("testattempt", lookupFunc)
 
@@ -351,6 +399,124 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+// TestGetAddressReachableNetworks ensures GetAddress only returns addresses
+// from the networks set with SetReachableNetworks.
+func TestGetAddressReachableNetworks(t *testing.T) {
+	n := addrmgr.New("testgetaddressreachablenetworks", lookupFunc)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"),
+		8333, 0)
+	onion := wire.NewNetAddressIPPort(net.ParseIP("fd87:d87e:eb43:25::1"),
+		8333, 0)
+	n.AddAddresses([]*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("12.2.2.3"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("2602:100::1"), 8333, 0),
+		onion,
+	}, srcAddr)
+	if n.NumAddresses() != 4 {
+		t.Fatalf("Wrong number of addresses: got %d, want %d",
+			n.NumAddresses(), 4)
+	}
+
+	// Only onion addresses may be returned once the address manager is
+	// restricted to the onion network, including after the onion address
+	// has been moved to the tried table.
+	n.SetReachableNetworks(addrmgr.NetOnion)
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			n.Good(onion)
+		}
+		ka := n.GetAddress()
+		if ka == nil {
+			t.Fatalf("GetAddress #%d: did not get an onion address", i)
+		}
+		if addrmgr.GetNetwork(ka.NetAddress()) != addrmgr.NetOnion {
+			t.Fatalf("GetAddress #%d: got clearnet address %v", i,
+				ka.NetAddress().IP)
+		}
+	}
+	if !n.IsReachable(onion) {
+		t.Errorf("IsReachable: onion address %v is not reachable",
+			onion.IP)
+	}
+	if n.IsReachable(srcAddr) {
+		t.Errorf("IsReachable: ipv4 address %v is reachable", srcAddr.IP)
+	}
+	if n.IsNetworkReachable(addrmgr.NetIPv6) {
+		t.Error("IsNetworkReachable: ipv6 network is reachable")
+	}
+
+	// Restricting the address manager to the clearnet networks must never
+	// return the onion address.
+	n.SetReachableNetworks(addrmgr.NetIPv6, addrmgr.NetIPv4)
+	for i := 0; i < 100; i++ {
+		ka := n.GetAddress()
+		if ka == nil {
+			t.Fatalf("GetAddress #%d: did not get a clearnet address", i)
+		}
+		if addrmgr.GetNetwork(ka.NetAddress()) == addrmgr.NetOnion {
+			t.Fatalf("GetAddress #%d: got onion address %v", i,
+				ka.NetAddress().IP)
+		}
+	}
+
+	// No address may be returned when none of the known addresses are from
+	// a reachable network.
+	empty := addrmgr.New("testgetaddressreachablenetworksempty", lookupFunc)
+	empty.AddAddresses([]*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0),
+	}, srcAddr)
+	empty.SetReachableNetworks(addrmgr.NetOnion)
+	if ka := empty.GetAddress(); ka != nil {
+		t.Errorf("GetAddress: got %v, want nil", ka.NetAddress().IP)
+	}
+}
+
+// TestGetFeelerAddress ensures GetFeelerAddress only returns addresses which
+// have not been moved to the tried table.
+func TestGetFeelerAddress(t *testing.T) {
+	n := addrmgr.New("testgetfeeleraddress", lookupFunc)
+	if ka := n.GetFeelerAddress(); ka != nil {
+		t.Fatalf("GetFeelerAddress: got %v, want nil", ka.NetAddress().IP)
+	}
+
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"),
+		8333, 0)
+	tried := wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0)
+	fresh := wire.NewNetAddressIPPort(net.ParseIP("12.2.2.3"), 8333, 0)
+	n.AddAddresses([]*wire.NetAddress{tried, fresh}, srcAddr)
+	n.Good(tried)
+	for i := 0; i < 100; i++ {
+		ka := n.GetFeelerAddress()
+		if ka == nil {
+			t.Fatalf("GetFeelerAddress #%d: did not get an address", i)
+		}
+		if !ka.NetAddress().IP.Equal(fresh.IP) {
+			t.Fatalf("GetFeelerAddress #%d: got %v, want %v", i,
+				ka.NetAddress().IP, fresh.IP)
+		}
+	}
+
+	// A feeler which fails counts as an attempt while one which succeeds
+	// moves the address to the tried table.
+	ka := n.GetFeelerAddress()
+	n.Attempt(fresh)
+	if ka.Attempts() != 1 || !ka.LastSuccess().IsZero() {
+		t.Fatalf("unexpected address state after a failed attempt - got "+
+			"%d attempts, last success %v", ka.Attempts(),
+			ka.LastSuccess())
+	}
+	n.Good(fresh)
+	if ka.Attempts() != 0 || ka.LastSuccess().IsZero() {
+		t.Fatalf("unexpected address state after a successful attempt - "+
+			"got %d attempts, last success %v", ka.Attempts(),
+			ka.LastSuccess())
+	}
+	if ka := n.GetFeelerAddress(); ka != nil {
+		t.Fatalf("GetFeelerAddress: got %v, want nil", ka.NetAddress().IP)
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []wire.NetAddress{
 		{IP: net.ParseIP("192.168.0.100")},
@@ -372,7 +538,7 @@ func TestGetBestLocalAddress(t *testing.T) {
 			wire.NetAddress{IP: net.IPv4zero},
 			wire.NetAddress{IP: net.IPv4zero},
 			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
+			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
 		},
 		{
 			// Remote connection from private IPv4
@@ -390,15 +556,14 @@ func TestGetBestLocalAddress(t *testing.T) {
 			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
 			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
 		},
-		/* XXX
 		{
 			// Remote connection from Tor
 			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43::100")},
 			wire.NetAddress{IP: net.IPv4zero},
+			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
 			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
 			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
 		},
-		*/
 	}
 
 	amgr := addrmgr.New("testgetbestlocaladdress", nil)
@@ -440,21 +605,84 @@ func TestGetBestLocalAddress(t *testing.T) {
 			continue
 		}
 	}
-	/*
-		// Add a Tor generated IP address
-		localAddr = wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")}
-		amgr.AddLocalAddress(&localAddr, addrmgr.ManualPrio)
-
-		// Test against want3
-		for x, test := range tests {
-			got := amgr.GetBestLocalAddress(&test.remoteAddr)
-			if !test.want3.IP.Equal(got.IP) {
-				t.Errorf("TestGetBestLocalAddress test3 #%d failed for remote address %s: want %s got %s",
-					x, test.remoteAddr.IP, test.want3.IP, got.IP)
-				continue
-			}
+
+	// Add a Tor generated IP address
+	torAddr := wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")}
+	amgr.AddLocalAddress(&torAddr, addrmgr.ManualPrio)
+
+	// Test against want3
+	for x, test := range tests {
+		got := amgr.GetBestLocalAddress(&test.remoteAddr)
+		if !test.want3.IP.Equal(got.IP) {
+			t.Errorf("TestGetBestLocalAddress test3 #%d failed for remote address %s: want %s got %s",
+				x, test.remoteAddr.IP, test.want3.IP, got.IP)
+			continue
 		}
-	*/
+	}
+}
+
+// TestGetBestLocalAddressScore ensures the local address with the highest score
+// among those with the best reachability is suggested, where the score depends
+// on how the address was discovered and how often peers reported it.
+func TestGetBestLocalAddressScore(t *testing.T) {
+	amgr := addrmgr.New("testgetbestlocaladdressscore", nil)
+	addrs := []struct {
+		ip       string
+		priority addrmgr.AddressPriority
+	}{
+		{"204.124.1.1", addrmgr.InterfacePrio},
+		{"204.124.1.2", addrmgr.BoundPrio},
+		{"204.124.1.3", addrmgr.InboundPrio},
+		{"204.124.1.4", addrmgr.UpnpPrio},
+		{"2620:100::1", addrmgr.ManualPrio},
+		{"fd87:d87e:eb43:25::1", addrmgr.ManualPrio},
+	}
+	for _, addr := range addrs {
+		na := wire.NewNetAddressIPPort(net.ParseIP(addr.ip), 8333, 0)
+		if err := amgr.AddLocalAddress(na, addr.priority); err != nil {
+			t.Fatalf("AddLocalAddress: unexpected error: %v", err)
+		}
+	}
+
+	ipv4Remote := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"),
+		8333, 0)
+	ipv6Remote := wire.NewNetAddressIPPort(net.ParseIP("2602:100:abcd::102"),
+		8333, 0)
+	torRemote := wire.NewNetAddressIPPort(net.ParseIP("fd87:d87e:eb43::100"),
+		8333, 0)
+	checkBest := func(remote *wire.NetAddress, want string) {
+		t.Helper()
+		got := amgr.GetBestLocalAddress(remote)
+		if !got.IP.Equal(net.ParseIP(want)) {
+			t.Fatalf("unexpected best local address for %s - got %s, "+
+				"want %s", remote.IP, got.IP, want)
+		}
+	}
+
+	// The UPnP address scores highest among the IPv4 addresses, while the
+	// configured addresses are the best for IPv6 and tor peers.
+	checkBest(ipv4Remote, "204.124.1.4")
+	checkBest(ipv6Remote, "2620:100::1")
+	checkBest(torRemote, "fd87:d87e:eb43:25::1")
+
+	// Peers from distinct network groups reporting a known address raise
+	// its score past the others, while a single report of an unknown
+	// address doesn't add it.
+	na := wire.NewNetAddressIPPort(net.ParseIP("204.124.1.3"), 8333, 0)
+	for _, src := range []string{"1.1.0.1", "2.2.0.1"} {
+		srcAddr := wire.NewNetAddressIPPort(net.ParseIP(src), 8333, 0)
+		if amgr.SeenLocalAddress(na, srcAddr) {
+			t.Fatalf("SeenLocalAddress: known address %s was added",
+				na.IP)
+		}
+	}
+	checkBest(ipv4Remote, "204.124.1.3")
+	unknown := wire.NewNetAddressIPPort(net.ParseIP("204.124.1.5"), 8333, 0)
+	if amgr.SeenLocalAddress(unknown, ipv4Remote) {
+		t.Fatalf("SeenLocalAddress: address %s was added after a single "+
+			"report", unknown.IP)
+	}
+	checkBest(ipv4Remote, "204.124.1.3")
 }
 
 func TestNetAddressKey(t *testing.T) {
@@ -33,6 +33,18 @@ func (ka *KnownAddress) LastAttempt() time.Time {
 	return ka.lastattempt
 }
 
+// LastSuccess returns the last time a connection to the known address
+// succeeded.
+func (ka *KnownAddress) LastSuccess() time.Time {
+	return ka.lastsuccess
+}
+
+// Attempts returns the number of attempts to connect to the known address since
+// the last successful connection.
+func (ka *KnownAddress) Attempts() int {
+	return ka.attempts
+}
+
 // Services returns the services supported by the peer with the known address.
 func (ka *KnownAddress) Services() wire.ServiceFlag {
 	return ka.na.Services
@@ -279,3 +279,56 @@ func GroupKey(na *wire.NetAddress) string {
 
 	return na.IP.Mask(net.CIDRMask(bits, 128)).String()
 }
+
+// Network identifies the network an address is reached over.
+type Network uint8
+
+const (
+	// NetIPv4 identifies addresses reached over IPv4.
+	NetIPv4 Network = iota
+
+	// NetIPv6 identifies addresses reached over IPv6.
+	NetIPv6
+
+	// NetOnion identifies Tor hidden service addresses.
+	NetOnion
+)
+
+// networkStrings is a map of networks back to their constant names for pretty
+// printing.
+var networkStrings = map[Network]string{
+	NetIPv4:  "ipv4",
+	NetIPv6:  "ipv6",
+	NetOnion: "onion",
+}
+
+// String returns the Network in human-readable form.
+func (n Network) String() string {
+	if s, ok := networkStrings[n]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown Network (%d)", uint8(n))
+}
+
+// ParseNetwork returns the network identified by the passed name, which must be
+// one of ipv4, ipv6, or onion.
+func ParseNetwork(name string) (Network, error) {
+	for n, s := range networkStrings {
+		if s == name {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown network %q", name)
+}
+
+// GetNetwork returns the network the passed address is reached over.
+func GetNetwork(na *wire.NetAddress) Network {
+	switch {
+	case IsOnionCatTor(na):
+		return NetOnion
+	case IsIPv4(na):
+		return NetIPv4
+	default:
+		return NetIPv6
+	}
+}
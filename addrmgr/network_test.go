@@ -200,3 +200,43 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestGetNetwork ensures addresses are classified into the correct network and
+// that network names round trip through ParseNetwork.
+func TestGetNetwork(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected addrmgr.Network
+	}{
+		{ip: "12.1.2.3", expected: addrmgr.NetIPv4},
+		{ip: "::ffff:12.1.2.3", expected: addrmgr.NetIPv4},
+		{ip: "2602:100::1", expected: addrmgr.NetIPv6},
+		{ip: "2002:0c01:0203::", expected: addrmgr.NetIPv6},
+		{ip: "fd87:d87e:eb43:1234::5678", expected: addrmgr.NetOnion},
+	}
+
+	for i, test := range tests {
+		nip := net.ParseIP(test.ip)
+		na := wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
+		if n := addrmgr.GetNetwork(na); n != test.expected {
+			t.Errorf("TestGetNetwork #%d (%s): unexpected network "+
+				"- got %v, want %v", i, test.ip, n, test.expected)
+		}
+	}
+
+	for _, n := range []addrmgr.Network{addrmgr.NetIPv4, addrmgr.NetIPv6,
+		addrmgr.NetOnion} {
+
+		parsed, err := addrmgr.ParseNetwork(n.String())
+		if err != nil {
+			t.Errorf("ParseNetwork(%q): unexpected error: %v", n, err)
+			continue
+		}
+		if parsed != n {
+			t.Errorf("ParseNetwork(%q): got %v, want %v", n, parsed, n)
+		}
+	}
+	if _, err := addrmgr.ParseNetwork("i2p"); err == nil {
+		t.Error("ParseNetwork(\"i2p\"): expected error for unknown network")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bip39
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// MinEntropyBits is the minimum number of bits of entropy a mnemonic
+	// may encode.
+	MinEntropyBits = 128
+
+	// MaxEntropyBits is the maximum number of bits of entropy a mnemonic
+	// may encode.
+	MaxEntropyBits = 256
+
+	// SeedLen is the length in bytes of the seeds derived from mnemonics.
+	SeedLen = 64
+
+	// bitsPerWord is the number of bits each word of a mnemonic encodes.
+	bitsPerWord = 11
+
+	// seedIterations is the number of PBKDF2 iterations used to derive a
+	// seed from a mnemonic.
+	seedIterations = 2048
+
+	// seedSaltPrefix is prepended to the passphrase to form the salt used
+	// to derive a seed from a mnemonic.
+	seedSaltPrefix = "mnemonic"
+)
+
+var (
+	// ErrInvalidEntropyLength describes an error in which the entropy
+	// passed to NewMnemonic, or the bit size passed to NewEntropy, is not
+	// a multiple of 32 bits between MinEntropyBits and MaxEntropyBits.
+	ErrInvalidEntropyLength = fmt.Errorf("entropy length must be a "+
+		"multiple of 32 bits between %d and %d bits", MinEntropyBits,
+		MaxEntropyBits)
+
+	// ErrInvalidWordCount describes an error in which a mnemonic does not
+	// have 12, 15, 18, 21, or 24 words.
+	ErrInvalidWordCount = errors.New("mnemonic must have 12, 15, 18, 21, " +
+		"or 24 words")
+
+	// ErrChecksumMismatch describes an error in which the checksum encoded
+	// by the last word of a mnemonic does not match its entropy.
+	ErrChecksumMismatch = errors.New("mnemonic checksum mismatch")
+)
+
+var (
+	// wordList is the English word list indexed by the value each word
+	// encodes.
+	wordList = strings.Split(englishWordList, "\n")
+
+	// wordIndexes maps each word of the English word list to its index.
+	wordIndexes = make(map[string]int, len(wordList))
+)
+
+func init() {
+	for i, word := range wordList {
+		wordIndexes[word] = i
+	}
+}
+
+// NewEntropy returns the passed number of bits of entropy read from a
+// cryptographically secure random source.  The bit size must be a multiple of
+// 32 between MinEntropyBits and MaxEntropyBits.
+func NewEntropy(bitSize int) ([]byte, error) {
+	if bitSize < MinEntropyBits || bitSize > MaxEntropyBits ||
+		bitSize%32 != 0 {
+
+		return nil, ErrInvalidEntropyLength
+	}
+
+	entropy := make([]byte, bitSize/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+// NewMnemonic returns the mnemonic which encodes the passed entropy, which must
+// be a multiple of 32 bits between MinEntropyBits and MaxEntropyBits, as space
+// separated words of the English word list.
+//
+// The mnemonic encodes the entropy followed by the first bit of its SHA256 hash
+// for every 32 bits of entropy as a checksum, 11 bits per word.
+func NewMnemonic(entropy []byte) (string, error) {
+	entropyBits := len(entropy) * 8
+	if entropyBits < MinEntropyBits || entropyBits > MaxEntropyBits ||
+		entropyBits%32 != 0 {
+
+		return "", ErrInvalidEntropyLength
+	}
+
+	// The checksum is at most 8 bits, so it is the leading bits of the
+	// byte appended to the entropy.
+	hash := sha256.Sum256(entropy)
+	data := make([]byte, 0, len(entropy)+1)
+	data = append(data, entropy...)
+	data = append(data, hash[0])
+
+	numWords := (entropyBits + entropyBits/32) / bitsPerWord
+	words := make([]string, 0, numWords)
+	for i := 0; i < numWords; i++ {
+		var index int
+		for j := 0; j < bitsPerWord; j++ {
+			bit := i*bitsPerWord + j
+			index = index<<1 | int(data[bit/8]>>(7-uint(bit%8))&1)
+		}
+		words = append(words, wordList[index])
+	}
+	return strings.Join(words, " "), nil
+}
+
+// EntropyFromMnemonic returns the entropy encoded by the passed mnemonic of
+// words of the English word list separated by whitespace.  An error is returned
+// when the mnemonic has an invalid number of words, contains a word which is not
+// in the word list, or its checksum does not match.
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, ErrInvalidWordCount
+	}
+
+	totalBits := len(words) * bitsPerWord
+	checksumBits := totalBits / 33
+	entropyBits := totalBits - checksumBits
+	data := make([]byte, (totalBits+7)/8)
+	for i, word := range words {
+		index, ok := wordIndexes[word]
+		if !ok {
+			return nil, fmt.Errorf("word %q is not in the word list",
+				word)
+		}
+		for j := 0; j < bitsPerWord; j++ {
+			if index&(1<<uint(bitsPerWord-1-j)) == 0 {
+				continue
+			}
+			bit := i*bitsPerWord + j
+			data[bit/8] |= 1 << (7 - uint(bit%8))
+		}
+	}
+
+	// The checksum bits are the leading bits of the byte following the
+	// entropy.
+	entropy := data[:entropyBits/8]
+	hash := sha256.Sum256(entropy)
+	shift := uint(8 - checksumBits)
+	if data[entropyBits/8]>>shift != hash[0]>>shift {
+		return nil, ErrChecksumMismatch
+	}
+	return entropy, nil
+}
+
+// NewSeed returns the seed derived from the passed mnemonic and passphrase,
+// which is suitable to create the master extended key of a hierarchical
+// deterministic wallet with hdkeychain.NewMaster.  The mnemonic is validated
+// with EntropyFromMnemonic first and its words are joined by single spaces when
+// deriving the seed.
+//
+// The seed is derived with PBKDF2 using HMAC-SHA512 and 2048 iterations, with
+// the mnemonic as the password and "mnemonic" followed by the passphrase as the
+// salt.  BIP0039 requires both to be in Unicode normalization form NFKD, which
+// the passphrase is assumed to be in already, as is the case for ASCII.
+func NewSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := EntropyFromMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	password := []byte(strings.Join(strings.Fields(mnemonic), " "))
+	salt := []byte(seedSaltPrefix + passphrase)
+	return pbkdf2.Key(password, salt, seedIterations, SeedLen,
+		sha512.New), nil
+}
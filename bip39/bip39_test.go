@@ -0,0 +1,419 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bip39
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// testPassphrase is the passphrase of the official BIP0039 test vectors.
+const testPassphrase = "TREZOR"
+
+// testVectors are the official BIP0039 test vectors along with the master
+// extended private keys derived from their seeds.
+var testVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+	xprv     string
+}{
+	{
+		entropy: "00000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon abandon abandon about",
+		seed: "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e5349553" +
+			"1f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		xprv: "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF",
+	},
+	{
+		entropy: "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		mnemonic: "legal winner thank year wave sausage worth useful legal " +
+			"winner thank yellow",
+		seed: "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6f" +
+			"a457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		xprv: "xprv9s21ZrQH143K2gA81bYFHqU68xz1cX2APaSq5tt6MFSLeXnCKV1RVUJt9FWNTbrrryem4ZckN8k4Ls1H6nwdvDTvnV7zEXs2HgPezuVccsq",
+	},
+	{
+		entropy: "80808080808080808080808080808080",
+		mnemonic: "letter advice cage absurd amount doctor acoustic avoid " +
+			"letter advice cage above",
+		seed: "d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30" +
+			"fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+		xprv: "xprv9s21ZrQH143K2shfP28KM3nr5Ap1SXjz8gc2rAqqMEynmjt6o1qboCDpxckqXavCwdnYds6yBHZGKHv7ef2eTXy461PXUjBFQg6PrwY4Gzq",
+	},
+	{
+		entropy:  "ffffffffffffffffffffffffffffffff",
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		seed: "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13" +
+			"332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		xprv: "xprv9s21ZrQH143K2V4oox4M8Zmhi2Fjx5XK4Lf7GKRvPSgydU3mjZuKGCTg7UPiBUD7ydVPvSLtg9hjp7MQTYsW67rZHAXeccqYqrsx8LcXnyd",
+	},
+	{
+		entropy: "000000000000000000000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon abandon agent",
+		seed: "035895f2f481b1b0f01fcf8c289c794660b289981a78f8106447707fdd9666ca" +
+			"06da5a9a565181599b79f53b844d8a71dd9f439c52a3d7b3e8a79c906ac845fa",
+		xprv: "xprv9s21ZrQH143K3mEDrypcZ2usWqFgzKB6jBBx9B6GfC7fu26X6hPRzVjzkqkPvDqp6g5eypdk6cyhGnBngbjeHTe4LsuLG1cCmKJka5SMkmU",
+	},
+	{
+		entropy: "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		mnemonic: "legal winner thank year wave sausage worth useful legal " +
+			"winner thank year wave sausage worth useful legal will",
+		seed: "f2b94508732bcbacbcc020faefecfc89feafa6649a5491b8c952cede496c214a" +
+			"0c7b3c392d168748f2d4a612bada0753b52a1c7ac53c1e93abd5c6320b9e95dd",
+		xprv: "xprv9s21ZrQH143K3Lv9MZLj16np5GzLe7tDKQfVusBni7toqJGcnKRtHSxUwbKUyUWiwpK55g1DUSsw76TF1T93VT4gz4wt5RM23pkaQLnvBh7",
+	},
+	{
+		entropy: "808080808080808080808080808080808080808080808080",
+		mnemonic: "letter advice cage absurd amount doctor acoustic avoid " +
+			"letter advice cage absurd amount doctor acoustic avoid " +
+			"letter always",
+		seed: "107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc2" +
+			"7fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+		xprv: "xprv9s21ZrQH143K3VPCbxbUtpkh9pRG371UCLDz3BjceqP1jz7XZsQ5EnNkYAEkfeZp62cDNj13ZTEVG1TEro9sZ9grfRmcYWLBhCocViKEJae",
+	},
+	{
+		entropy: "ffffffffffffffffffffffffffffffffffffffffffffffff",
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo " +
+			"zoo zoo when",
+		seed: "0cd6e5d827bb62eb8fc1e262254223817fd068a74b5b449cc2f667c3f1f985a7" +
+			"6379b43348d952e2265b4cd129090758b3e3c2c49103b5051aac2eaeb890a528",
+		xprv: "xprv9s21ZrQH143K36Ao5jHRVhFGDbLP6FCx8BEEmpru77ef3bmA928BxsqvVM27WnvvyfWywiFN8K6yToqMaGYfzS6Db1EHAXT5TuyCLBXUfdm",
+	},
+	{
+		entropy: "0000000000000000000000000000000000000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon abandon abandon abandon abandon abandon " +
+			"abandon abandon art",
+		seed: "bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd30971" +
+			"70af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+		xprv: "xprv9s21ZrQH143K32qBagUJAMU2LsHg3ka7jqMcV98Y7gVeVyNStwYS3U7yVVoDZ4btbRNf4h6ibWpY22iRmXq35qgLs79f312g2kj5539ebPM",
+	},
+	{
+		entropy: "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		mnemonic: "legal winner thank year wave sausage worth useful legal " +
+			"winner thank year wave sausage worth useful legal winner " +
+			"thank year wave sausage worth title",
+		seed: "bc09fca1804f7e69da93c2f2028eb238c227f2e9dda30cd63699232578480a40" +
+			"21b146ad717fbb7e451ce9eb835f43620bf5c514db0f8add49f5d121449d3e87",
+		xprv: "xprv9s21ZrQH143K3Y1sd2XVu9wtqxJRvybCfAetjUrMMco6r3v9qZTBeXiBZkS8JxWbcGJZyio8TrZtm6pkbzG8SYt1sxwNLh3Wx7to5pgiVFU",
+	},
+	{
+		entropy: "8080808080808080808080808080808080808080808080808080808080808080",
+		mnemonic: "letter advice cage absurd amount doctor acoustic avoid " +
+			"letter advice cage absurd amount doctor acoustic avoid " +
+			"letter advice cage absurd amount doctor acoustic bless",
+		seed: "c0c519bd0e91a2ed54357d9d1ebef6f5af218a153624cf4f2da911a0ed8f7a09" +
+			"e2ef61af0aca007096df430022f7a2b6fb91661a9589097069720d015e4e982f",
+		xprv: "xprv9s21ZrQH143K3CSnQNYC3MqAAqHwxeTLhDbhF43A4ss4ciWNmCY9zQGvAKUSqVUf2vPHBTSE1rB2pg4avopqSiLVzXEU8KziNnVPauTqLRo",
+	},
+	{
+		entropy: "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo " +
+			"zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		seed: "dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e16" +
+			"13912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		xprv: "xprv9s21ZrQH143K2WFF16X85T2QCpndrGwx6GueB72Zf3AHwHJaknRXNF37ZmDrtHrrLSHvbuRejXcnYxoZKvRquTPyp2JiNG3XcjQyzSEgqCB",
+	},
+	{
+		entropy: "9e885d952ad362caeb4efe34a8e91bd2",
+		mnemonic: "ozone drill grab fiber curtain grace pudding thank cruise " +
+			"elder eight picnic",
+		seed: "274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e547" +
+			"6c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+		xprv: "xprv9s21ZrQH143K2oZ9stBYpoaZ2ktHj7jLz7iMqpgg1En8kKFTXJHsjxry1JbKH19YrDTicVwKPehFKTbmaxgVEc5TpHdS1aYhB2s9aFJBeJH",
+	},
+	{
+		entropy: "6610b25967cdcca9d59875f5cb50b0ea75433311869e930b",
+		mnemonic: "gravity machine north sort system female filter attitude " +
+			"volume fold club stay feature office ecology stable narrow " +
+			"fog",
+		seed: "628c3827a8823298ee685db84f55caa34b5cc195a778e52d45f59bcf75aba68e" +
+			"4d7590e101dc414bc1bbd5737666fbbef35d1f1903953b66624f910feef245ac",
+		xprv: "xprv9s21ZrQH143K3uT8eQowUjsxrmsA9YUuQQK1RLqFufzybxD6DH6gPY7NjJ5G3EPHjsWDrs9iivSbmvjc9DQJbJGatfa9pv4MZ3wjr8qWPAK",
+	},
+	{
+		entropy: "68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+		mnemonic: "hamster diagram private dutch cause delay private meat slide " +
+			"toddler razor book happy fancy gospel tennis maple dilemma " +
+			"loan word shrug inflict delay length",
+		seed: "64c87cde7e12ecf6704ab95bb1408bef047c22db4cc7491c4271d170a1b213d2" +
+			"0b385bc1588d9c7b38f1b39d415665b8a9030c9ec653d75e65f847d8fc1fc440",
+		xprv: "xprv9s21ZrQH143K2XTAhys3pMNcGn261Fi5Ta2Pw8PwaVPhg3D8DWkzWQwjTJfskj8ofb81i9NP2cUNKxwjueJHHMQAnxtivTA75uUFqPFeWzk",
+	},
+	{
+		entropy: "c0ba5a8e914111210f2bd131f3d5e08d",
+		mnemonic: "scheme spot photo card baby mountain device kick cradle pact " +
+			"join borrow",
+		seed: "ea725895aaae8d4c1cf682c1bfd2d358d52ed9f0f0591131b559e2724bb234fc" +
+			"a05aa9c02c57407e04ee9dc3b454aa63fbff483a8b11de949624b9f1831a9612",
+		xprv: "xprv9s21ZrQH143K3FperxDp8vFsFycKCRcJGAFmcV7umQmcnMZaLtZRt13QJDsoS5F6oYT6BB4sS6zmTmyQAEkJKxJ7yByDNtRe5asP2jFGhT6",
+	},
+	{
+		entropy: "6d9be1ee6ebd27a258115aad99b7317b9c8d28b6d76431c3",
+		mnemonic: "horn tenant knee talent sponsor spell gate clip pulse soap " +
+			"slush warm silver nephew swap uncle crack brave",
+		seed: "fd579828af3da1d32544ce4db5c73d53fc8acc4ddb1e3b251a31179cdb71e853" +
+			"c56d2fcb11aed39898ce6c34b10b5382772db8796e52837b54468aeb312cfc3d",
+		xprv: "xprv9s21ZrQH143K3R1SfVZZLtVbXEB9ryVxmVtVMsMwmEyEvgXN6Q84LKkLRmf4ST6QrLeBm3jQsb9gx1uo23TS7vo3vAkZGZz71uuLCcywUkt",
+	},
+	{
+		entropy: "9f6a2878b2520799a44ef18bc7df394e7061a224d2c33cd015b157d746869863",
+		mnemonic: "panda eyebrow bullet gorilla call smoke muffin taste mesh " +
+			"discover soft ostrich alcohol speed nation flash devote " +
+			"level hobby quick inner drive ghost inside",
+		seed: "72be8e052fc4919d2adf28d5306b5474b0069df35b02303de8c1729c9538dbb6" +
+			"fc2d731d5f832193cd9fb6aeecbc469594a70e3dd50811b5067f3b88b28c3e8d",
+		xprv: "xprv9s21ZrQH143K2WNnKmssvZYM96VAr47iHUQUTUyUXH3sAGNjhJANddnhw3i3y3pBbRAVk5M5qUGFr4rHbEWwXgX4qrvrceifCYQJbbFDems",
+	},
+	{
+		entropy: "23db8160a31d3e0dca3688ed941adbf3",
+		mnemonic: "cat swing flag economy stadium alone churn speed unique " +
+			"patch report train",
+		seed: "deb5f45449e615feff5640f2e49f933ff51895de3b4381832b3139941c57b592" +
+			"05a42480c52175b6efcffaa58a2503887c1e8b363a707256bdd2b587b46541f5",
+		xprv: "xprv9s21ZrQH143K4G28omGMogEoYgDQuigBo8AFHAGDaJdqQ99QKMQ5J6fYTMfANTJy6xBmhvsNZ1CJzRZ64PWbnTFUn6CDV2FxoMDLXdk95DQ",
+	},
+	{
+		entropy: "8197a4a47f0425faeaa69deebc05ca29c0a5b5cc76ceacc0",
+		mnemonic: "light rule cinnamon wrap drastic word pride squirrel upgrade " +
+			"then income fatal apart sustain crack supply proud access",
+		seed: "4cbdff1ca2db800fd61cae72a57475fdc6bab03e441fd63f96dabd1f183ef5b7" +
+			"82925f00105f318309a7e9c3ea6967c7801e46c8a58082674c860a37b93eda02",
+		xprv: "xprv9s21ZrQH143K3wtsvY8L2aZyxkiWULZH4vyQE5XkHTXkmx8gHo6RUEfH3Jyr6NwkJhvano7Xb2o6UqFKWHVo5scE31SGDCAUsgVhiUuUDyh",
+	},
+	{
+		entropy: "066dca1a2bb7e8a1db2832148ce9933eea0f3ac9548d793112d9a95c9407efad",
+		mnemonic: "all hour make first leader extend hole alien behind guard " +
+			"gospel lava path output census museum junior mass reopen " +
+			"famous sing advance salt reform",
+		seed: "26e975ec644423f4a4c4f4215ef09b4bd7ef924e85d1d17c4cf3f136c2863cf6" +
+			"df0a475045652c57eb5fb41513ca2a2d67722b77e954b4b3fc11f7590449191d",
+		xprv: "xprv9s21ZrQH143K3rEfqSM4QZRVmiMuSWY9wugscmaCjYja3SbUD3KPEB1a7QXJoajyR2T1SiXU7rFVRXMV9XdYVSZe7JoUXdP4SRHTxsT1nzm",
+	},
+	{
+		entropy: "f30f8c1da665478f49b001d94c5fc452",
+		mnemonic: "vessel ladder alter error federal sibling chat ability sun " +
+			"glass valve picture",
+		seed: "2aaa9242daafcee6aa9d7269f17d4efe271e1b9a529178d7dc139cd18747090b" +
+			"f9d60295d0ce74309a78852a9caadf0af48aae1c6253839624076224374bc63f",
+		xprv: "xprv9s21ZrQH143K2QWV9Wn8Vvs6jbqfF1YbTCdURQW9dLFKDovpKaKrqS3SEWsXCu6ZNky9PSAENg6c9AQYHcg4PjopRGGKmdD313ZHszymnps",
+	},
+	{
+		entropy: "c10ec20dc3cd9f652c7fac2f1230f7a3c828389a14392f05",
+		mnemonic: "scissors invite lock maple supreme raw rapid void congress " +
+			"muscle digital elegant little brisk hair mango congress " +
+			"clump",
+		seed: "7b4a10be9d98e6cba265566db7f136718e1398c71cb581e1b2f464cac1ceedf4" +
+			"f3e274dc270003c670ad8d02c4558b2f8e39edea2775c9e232c7cb798b069e88",
+		xprv: "xprv9s21ZrQH143K4aERa2bq7559eMCCEs2QmmqVjUuzfy5eAeDX4mqZffkYwpzGQRE2YEEeLVRoH4CSHxianrFaVnMN2RYaPUZJhJx8S5j6puX",
+	},
+	{
+		entropy: "f585c11aec520db57dd353c69554b21a89b20fb0650966fa0a9d6f74fd989d8f",
+		mnemonic: "void come effort suffer camp survey warrior heavy shoot " +
+			"primary clutch crush open amazing screen patrol group space " +
+			"point ten exist slush involve unfold",
+		seed: "01f5bced59dec48e362f2c45b5de68b9fd6c92c6634f44d6d40aab69056506f0" +
+			"e35524a518034ddc1192e1dacd32c1ed3eaa3c3b131c88ed8e7e54c49a5d0998",
+		xprv: "xprv9s21ZrQH143K39rnQJknpH1WEPFJrzmAqqasiDcVrNuk926oizzJDDQkdiTvNPr2FYDYzWgiMiC63YmfPAa2oPyNB23r2g7d1yiK6WpqaQS",
+	},
+}
+
+// TestWordList ensures the word list matches the one defined by BIP0039.
+func TestWordList(t *testing.T) {
+	t.Parallel()
+
+	if len(wordList) != 1<<bitsPerWord {
+		t.Fatalf("unexpected word list length %d", len(wordList))
+	}
+	const wantHash = "2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2" +
+		"ed3b24dbda"
+	hash := sha256.Sum256([]byte(englishWordList + "\n"))
+	if got := hex.EncodeToString(hash[:]); got != wantHash {
+		t.Fatalf("unexpected word list hash - got %s, want %s", got,
+			wantHash)
+	}
+}
+
+// TestVectors ensures the mnemonics and seeds of the official BIP0039 test
+// vectors are produced from their entropy, that the entropy is recovered from
+// the mnemonics, and that the seeds create the expected master keys.
+func TestVectors(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range testVectors {
+		entropy, err := hex.DecodeString(test.entropy)
+		if err != nil {
+			t.Fatalf("#%d: unable to decode entropy: %v", i, err)
+		}
+
+		mnemonic, err := NewMnemonic(entropy)
+		if err != nil {
+			t.Errorf("#%d: NewMnemonic: unexpected error: %v", i, err)
+			continue
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("#%d: unexpected mnemonic - got %q, want %q", i,
+				mnemonic, test.mnemonic)
+			continue
+		}
+
+		gotEntropy, err := EntropyFromMnemonic(test.mnemonic)
+		if err != nil {
+			t.Errorf("#%d: EntropyFromMnemonic: unexpected error: %v",
+				i, err)
+			continue
+		}
+		if !bytes.Equal(gotEntropy, entropy) {
+			t.Errorf("#%d: unexpected entropy - got %x, want %x", i,
+				gotEntropy, entropy)
+			continue
+		}
+
+		seed, err := NewSeed(test.mnemonic, testPassphrase)
+		if err != nil {
+			t.Errorf("#%d: NewSeed: unexpected error: %v", i, err)
+			continue
+		}
+		if got := hex.EncodeToString(seed); got != test.seed {
+			t.Errorf("#%d: unexpected seed - got %s, want %s", i, got,
+				test.seed)
+			continue
+		}
+
+		masterKey, err := hdkeychain.NewMaster(seed,
+			&chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("#%d: NewMaster: unexpected error: %v", i, err)
+			continue
+		}
+		if got := masterKey.String(); got != test.xprv {
+			t.Errorf("#%d: unexpected master key - got %s, want %s",
+				i, got, test.xprv)
+		}
+	}
+}
+
+// TestInvalidMnemonics ensures mnemonics with an invalid number of words,
+// unknown words, or a mismatched checksum are rejected.
+func TestInvalidMnemonics(t *testing.T) {
+	t.Parallel()
+
+	abandon11 := strings.Repeat("abandon ", 11)
+	tests := []struct {
+		name     string
+		mnemonic string
+		err      error
+	}{{
+		name:     "empty",
+		mnemonic: "",
+		err:      ErrInvalidWordCount,
+	}, {
+		name:     "11 words",
+		mnemonic: strings.TrimSpace(abandon11),
+		err:      ErrInvalidWordCount,
+	}, {
+		name:     "13 words",
+		mnemonic: abandon11 + "abandon about",
+		err:      ErrInvalidWordCount,
+	}, {
+		name:     "unknown word",
+		mnemonic: abandon11 + "bitcoin",
+	}, {
+		name:     "upper case word",
+		mnemonic: abandon11 + "ABOUT",
+	}, {
+		name:     "bad checksum",
+		mnemonic: abandon11 + "abandon",
+		err:      ErrChecksumMismatch,
+	}, {
+		name:     "bad checksum 24 words",
+		mnemonic: strings.Repeat("zoo ", 23) + "zoo",
+		err:      ErrChecksumMismatch,
+	}}
+	for _, test := range tests {
+		_, err := EntropyFromMnemonic(test.mnemonic)
+		if err == nil || (test.err != nil && err != test.err) {
+			t.Errorf("%s: EntropyFromMnemonic: unexpected error - "+
+				"got %v, want %v", test.name, err, test.err)
+		}
+		if _, err := NewSeed(test.mnemonic, ""); err == nil {
+			t.Errorf("%s: NewSeed: did not receive expected error",
+				test.name)
+		}
+	}
+
+	// Extra whitespace between words is accepted and does not change the
+	// seed.
+	want, err := NewSeed(testVectors[0].mnemonic, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewSeed: unexpected error: %v", err)
+	}
+	spaced := " " + strings.Replace(testVectors[0].mnemonic, " ", " \t ", -1) +
+		"\n"
+	got, err := NewSeed(spaced, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewSeed: unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("unexpected seed for mnemonic with extra whitespace")
+	}
+}
+
+// TestNewEntropy ensures entropy is only generated for the supported sizes and
+// that it encodes to mnemonics of the expected length which decode back to it.
+func TestNewEntropy(t *testing.T) {
+	t.Parallel()
+
+	for _, bitSize := range []int{0, 96, 127, 160 + 8, 288} {
+		if _, err := NewEntropy(bitSize); err != ErrInvalidEntropyLength {
+			t.Errorf("NewEntropy(%d): unexpected error - got %v, "+
+				"want %v", bitSize, err, ErrInvalidEntropyLength)
+		}
+		_, err := NewMnemonic(make([]byte, bitSize/8))
+		if err != ErrInvalidEntropyLength {
+			t.Errorf("NewMnemonic(%d bits): unexpected error - got "+
+				"%v, want %v", bitSize, err, ErrInvalidEntropyLength)
+		}
+	}
+
+	for bitSize := MinEntropyBits; bitSize <= MaxEntropyBits; bitSize += 32 {
+		entropy, err := NewEntropy(bitSize)
+		if err != nil {
+			t.Fatalf("NewEntropy(%d): unexpected error: %v", bitSize,
+				err)
+		}
+		if len(entropy) != bitSize/8 {
+			t.Fatalf("NewEntropy(%d): unexpected length %d", bitSize,
+				len(entropy))
+		}
+		mnemonic, err := NewMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("NewMnemonic: unexpected error: %v", err)
+		}
+		wantWords := (bitSize + bitSize/32) / bitsPerWord
+		if n := len(strings.Fields(mnemonic)); n != wantWords {
+			t.Fatalf("%d bits: unexpected number of words %d", bitSize,
+				n)
+		}
+		gotEntropy, err := EntropyFromMnemonic(mnemonic)
+		if err != nil {
+			t.Fatalf("EntropyFromMnemonic: unexpected error: %v", err)
+		}
+		if !bytes.Equal(gotEntropy, entropy) {
+			t.Fatalf("%d bits: entropy did not round trip", bitSize)
+		}
+	}
+}
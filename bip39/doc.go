@@ -0,0 +1,26 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package bip39 implements the mnemonic codes for generating deterministic keys
+defined by BIP0039.
+
+A mnemonic is a sentence of 12 to 24 words of a word list which encodes 128 to
+256 bits of entropy along with a checksum, so it can be written down and typed
+back in by users in order to back up and restore wallets.  Only the English word
+list is supported.
+
+NewEntropy and NewMnemonic create a mnemonic for a new wallet while
+EntropyFromMnemonic validates a mnemonic entered by a user and recovers the
+entropy it encodes.  NewSeed derives the seed from a mnemonic and an optional
+passphrase, which is then used to create the master key of a hierarchical
+deterministic wallet:
+
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	...
+	seed, err := bip39.NewSeed(mnemonic, passphrase)
+	...
+	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+*/
+package bip39
@@ -62,12 +62,17 @@ func (b *BlockChain) maybeAcceptBlock(block *btcutil.Block, flags BehaviorFlags)
 
 	// Create a new block node for the block and add it to the node index. Even
 	// if the block ultimately gets connected to the main chain, it starts out
-	// on a side chain.
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, prevNode)
-	newNode.status = statusDataStored
-
-	b.index.AddNode(newNode)
+	// on a side chain.  When the header for the block was already processed,
+	// the existing node is reused and marked as having its data stored.
+	newNode := b.index.LookupNode(block.Hash())
+	if newNode != nil {
+		b.index.SetStatusFlags(newNode, statusDataStored)
+	} else {
+		blockHeader := &block.MsgBlock().Header
+		newNode = newBlockNode(blockHeader, prevNode)
+		newNode.status = statusDataStored
+		b.index.AddNode(newNode)
+	}
 	err = b.index.flushToDB()
 	if err != nil {
 		return false, err
@@ -5,8 +5,11 @@
 package blockchain
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -29,3 +32,62 @@ func BenchmarkIsCoinBaseTx(b *testing.B) {
 		IsCoinBaseTx(tx)
 	}
 }
+
+// BenchmarkUtxoCache benchmarks connecting blocks that create and spend many
+// outputs with different utxo cache sizes.
+func BenchmarkUtxoCache(b *testing.B) {
+	// Construct a chain where the first block fans out a coinbase output
+	// into many outputs and every later block spends all of the outputs
+	// created by the previous block into new ones.
+	const numBlocks = 50
+	const numOutputs = 200
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(b, genesis, 1)
+	fanOut := newTestSpend(b1.Transactions[0], 0, numOutputs)
+	blocks := []*wire.MsgBlock{b1, newTestBlock(b, b1, 2, fanOut)}
+	prevTxns := []*wire.MsgTx{fanOut}
+	for height := int32(3); height < numBlocks+3; height++ {
+		var txns []*wire.MsgTx
+		for _, tx := range prevTxns {
+			for i := range tx.TxOut {
+				txns = append(txns, newTestSpend(tx, uint32(i), 1))
+			}
+		}
+		parent := blocks[len(blocks)-1]
+		blocks = append(blocks, newTestBlock(b, parent, height, txns...))
+		prevTxns = txns
+	}
+
+	for _, maxSize := range []uint64{0, 64 * 1024, 64 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("maxsize %d", maxSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				chain, teardownFunc, err := chainSetup("benchutxocache",
+					&chaincfg.RegressionNetParams)
+				if err != nil {
+					b.Fatalf("Failed to setup chain instance: %v", err)
+				}
+				chain.TstSetCoinbaseMaturity(1)
+				chain.utxoCache.maxSize = maxSize
+				b.StartTimer()
+
+				for _, block := range blocks {
+					_, _, err := chain.ProcessBlock(
+						btcutil.NewBlock(block), BFNone)
+					if err != nil {
+						b.Fatalf("ProcessBlock: unexpected "+
+							"error: %v", err)
+					}
+				}
+				if err := chain.FlushUtxoCache(); err != nil {
+					b.Fatalf("FlushUtxoCache: unexpected error: %v",
+						err)
+				}
+
+				b.StopTimer()
+				teardownFunc()
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -246,12 +246,15 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 	}
 }
 
-// HaveBlock returns whether or not the block index contains the provided hash.
+// HaveBlock returns whether or not the block index contains the provided hash
+// and the data for the block it identifies is stored.  Nodes which were only
+// added for their header are not considered.
 //
 // This function is safe for concurrent access.
 func (bi *blockIndex) HaveBlock(hash *chainhash.Hash) bool {
 	bi.RLock()
-	_, hasBlock := bi.index[*hash]
+	node, hasBlock := bi.index[*hash]
+	hasBlock = hasBlock && node.status.HaveData()
 	bi.RUnlock()
 	return hasBlock
 }
@@ -278,6 +281,18 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 	bi.Unlock()
 }
 
+// AddHeaderNode adds the provided node, which only represents a validated block
+// header, to the block index.  The node is not marked as dirty since there is
+// no block data for it yet, so it is not written to the database until the
+// block itself is accepted.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) AddHeaderNode(node *blockNode) {
+	bi.Lock()
+	bi.addNode(node)
+	bi.Unlock()
+}
+
 // addNode adds the provided node to the block index, but does not mark it as
 // dirty. This can be used while initializing the block index.
 //
@@ -8,6 +8,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -20,9 +21,17 @@ import (
 )
 
 const (
-	// maxOrphanBlocks is the maximum number of orphan blocks that can be
-	// queued.
-	maxOrphanBlocks = 100
+	// DefaultMaxOrphanBlocks is the default maximum number of orphan blocks
+	// that can be queued.
+	DefaultMaxOrphanBlocks = 100
+
+	// DefaultMaxOrphanBlocksSize is the default maximum total serialized
+	// size in bytes of the orphan blocks that can be queued.
+	DefaultMaxOrphanBlocksSize = 128 * 1024 * 1024
+
+	// DefaultOrphanBlockExpiry is the default amount of time an orphan
+	// block is kept before it expires.
+	DefaultOrphanBlockExpiry = time.Hour
 )
 
 // BlockLocator is used to help locate a specific block.  The algorithm for
@@ -43,10 +52,11 @@ type BlockLocator []*chainhash.Hash
 
 // orphanBlock represents a block that we don't yet have the parent for.  It
 // is a normal block plus an expiration time to prevent caching the orphan
-// forever.
+// forever and its serialized size to limit the memory used by orphans.
 type orphanBlock struct {
 	block      *btcutil.Block
 	expiration time.Time
+	size       uint64
 }
 
 // BestState houses information about the current best block and other info
@@ -93,14 +103,17 @@ type BlockChain struct {
 	// The following fields are set when the instance is created and can't
 	// be changed afterwards, so there is no need to protect them with a
 	// separate mutex.
-	checkpoints         []chaincfg.Checkpoint
-	checkpointsByHeight map[int32]*chaincfg.Checkpoint
-	db                  database.DB
-	chainParams         *chaincfg.Params
-	timeSource          MedianTimeSource
-	sigCache            *txscript.SigCache
-	indexManager        IndexManager
-	hashCache           *txscript.HashCache
+	checkpoints           []chaincfg.Checkpoint
+	checkpointsByHeight   map[int32]*chaincfg.Checkpoint
+	assumeValid           *chainhash.Hash
+	minChainWork          *big.Int
+	scriptFlagActivations []ScriptFlagActivation
+	db                    database.DB
+	chainParams           *chaincfg.Params
+	timeSource            MedianTimeSource
+	sigCache              *txscript.SigCache
+	indexManager          IndexManager
+	hashCache             *txscript.HashCache
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -126,12 +139,24 @@ type BlockChain struct {
 	index     *blockIndex
 	bestChain *chainView
 
+	// utxoCache houses the unspent transaction outputs created and spent by
+	// the blocks in the main chain that have not yet been written to the
+	// database.
+	utxoCache *utxoCache
+
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
-	orphanLock   sync.RWMutex
-	orphans      map[chainhash.Hash]*orphanBlock
-	prevOrphans  map[chainhash.Hash][]*orphanBlock
-	oldestOrphan *orphanBlock
+	//
+	// orphansSize is the total serialized size of the orphan blocks which
+	// is limited to maxOrphansSize along with the number of them that is
+	// limited to maxOrphans.
+	orphanLock     sync.RWMutex
+	orphans        map[chainhash.Hash]*orphanBlock
+	prevOrphans    map[chainhash.Hash][]*orphanBlock
+	orphansSize    uint64
+	maxOrphans     int
+	maxOrphansSize uint64
+	orphanExpiry   time.Duration
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
@@ -152,6 +177,13 @@ type BlockChain struct {
 	stateLock     sync.RWMutex
 	stateSnapshot *BestState
 
+	// snapshotState is the state of the chainstate built from a utxo
+	// snapshot, if any.  It is protected by the chain lock while the
+	// snapshot load lock ensures only a single snapshot is loaded at a
+	// time.
+	snapshotState    *SnapshotChainState
+	snapshotLoadLock sync.Mutex
+
 	// The following caches are used to efficiently keep track of the
 	// current deployment threshold state of each rule change deployment.
 	//
@@ -180,6 +212,12 @@ type BlockChain struct {
 	// certain blockchain events.
 	notificationsLock sync.RWMutex
 	notifications     []NotificationCallback
+
+	// The connectHooks and disconnectHooks fields store the hooks to be
+	// invoked when blocks are connected to and disconnected from the main
+	// chain.  They are protected by the notifications lock.
+	connectHooks    []BlockHook
+	disconnectHooks []BlockHook
 }
 
 // HaveBlock returns whether or not the chain instance has the block represented
@@ -250,7 +288,11 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 
 	// Remove the orphan block from the orphan pool.
 	orphanHash := orphan.block.Hash()
+	if _, exists := b.orphans[*orphanHash]; !exists {
+		return
+	}
 	delete(b.orphans, *orphanHash)
+	b.orphansSize -= orphan.size
 
 	// Remove the reference from the previous orphan index too.  An indexing
 	// for loop is intentionally used over a range here as range does not
@@ -276,32 +318,51 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 	}
 }
 
+// oldestOrphanBlock returns the orphan block which was received first, which
+// is the one that expires first, or nil when there are no orphan blocks.
+func (b *BlockChain) oldestOrphanBlock() *orphanBlock {
+	var oldest *orphanBlock
+	for _, oBlock := range b.orphans {
+		if oldest == nil || oBlock.expiration.Before(oldest.expiration) {
+			oldest = oBlock
+		}
+	}
+	return oldest
+}
+
 // addOrphanBlock adds the passed block (which is already determined to be
 // an orphan prior calling this function) to the orphan pool.  It lazily cleans
 // up any expired blocks so a separate cleanup poller doesn't need to be run.
-// It also imposes a maximum limit on the number of outstanding orphan
-// blocks and will remove the oldest received orphan block if the limit is
-// exceeded.
+// It also imposes a maximum limit on the number and the total size of the
+// outstanding orphan blocks and will remove the oldest received orphan blocks
+// until the new one fits within them.  Blocks which are larger than the size
+// limit on their own are not added.
 func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	// Remove expired orphan blocks.
+	now := time.Now()
 	for _, oBlock := range b.orphans {
-		if time.Now().After(oBlock.expiration) {
+		if now.After(oBlock.expiration) {
 			b.removeOrphanBlock(oBlock)
-			continue
 		}
+	}
 
-		// Update the oldest orphan block pointer so it can be discarded
-		// in case the orphan pool fills up.
-		if b.oldestOrphan == nil || oBlock.expiration.Before(b.oldestOrphan.expiration) {
-			b.oldestOrphan = oBlock
-		}
+	size := uint64(block.MsgBlock().SerializeSize())
+	if size > b.maxOrphansSize {
+		log.Debugf("Not adding orphan block %v of %d bytes which "+
+			"exceeds the orphan pool size limit of %d bytes",
+			block.Hash(), size, b.maxOrphansSize)
+		return
 	}
 
-	// Limit orphan blocks to prevent memory exhaustion.
-	if len(b.orphans)+1 > maxOrphanBlocks {
-		// Remove the oldest orphan to make room for the new one.
-		b.removeOrphanBlock(b.oldestOrphan)
-		b.oldestOrphan = nil
+	// Limit orphan blocks to prevent memory exhaustion by removing the
+	// oldest orphans to make room for the new one.
+	for len(b.orphans) > 0 && (len(b.orphans)+1 > b.maxOrphans ||
+		b.orphansSize+size > b.maxOrphansSize) {
+
+		oldest := b.oldestOrphanBlock()
+		log.Debugf("Evicting orphan block %v to make room for orphan "+
+			"block %v", oldest.block.Hash(), block.Hash())
+		b.removeOrphanBlock(oldest)
 	}
 
 	// Protect concurrent access.  This is intentionally done here instead
@@ -310,14 +371,15 @@ func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	b.orphanLock.Lock()
 	defer b.orphanLock.Unlock()
 
-	// Insert the block into the orphan map with an expiration time
-	// 1 hour from now.
-	expiration := time.Now().Add(time.Hour)
+	// Insert the block into the orphan map with an expiration time based
+	// on the configured orphan expiry.
 	oBlock := &orphanBlock{
 		block:      block,
-		expiration: expiration,
+		expiration: now.Add(b.orphanExpiry),
+		size:       size,
 	}
 	b.orphans[*block.Hash()] = oBlock
+	b.orphansSize += size
 
 	// Add to previous hash lookup index for faster dependency lookups.
 	prevHash := &block.MsgBlock().Header.PrevBlock
@@ -596,6 +658,18 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 	state := newBestState(node, blockSize, blockWeight, numTxns,
 		curTotalTxns+numTxns, node.CalcPastMedianTime())
 
+	// Copy the changes to the utxo set for the block hooks since the view
+	// is pruned once they are committed.
+	var hookView *UtxoViewpoint
+	if b.hasBlockHooks(true) {
+		hookView = view.modifiedClone()
+	}
+
+	// The modifications to the utxo set are only written to the database
+	// along with the block when the utxo cache needs to be flushed.
+	// Otherwise, they are kept in the cache.
+	flushUtxos := b.utxoCache.needsFlush(view)
+
 	// Atomically insert info into the database.
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
@@ -611,12 +685,14 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
-		if err != nil {
-			return err
+		// Update the utxo set using the state of the utxo view when the
+		// utxo cache is flushed.  This entails removing all of the utxos
+		// spent and adding the new ones created by the block.
+		if flushUtxos {
+			err = b.utxoCache.dbFlush(dbTx, view, &node.hash)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Update the transaction spend journal by adding a record for
@@ -642,6 +718,14 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 		return err
 	}
 
+	// Either clear the utxo cache now that its entries have been written to
+	// the database or add the modifications of the view to it.
+	if flushUtxos {
+		b.utxoCache.reset()
+	} else {
+		b.utxoCache.commit(view)
+	}
+
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.commit()
@@ -663,6 +747,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 	// updating wallets.
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockConnected, block)
+	if hookView != nil {
+		b.runBlockHooks(true, block, hookView)
+	}
 	b.chainLock.Lock()
 
 	return nil
@@ -697,6 +784,13 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 		return err
 	}
 
+	// The utxo set in the database must always be consistent with a block
+	// in the main chain, so write out the utxo cache before the block is
+	// removed from it.
+	if err := b.flushUtxoCache(); err != nil {
+		return err
+	}
+
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
 	b.stateLock.RLock()
@@ -709,6 +803,13 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	state := newBestState(prevNode, blockSize, blockWeight, numTxns,
 		newTotalTxns, prevNode.CalcPastMedianTime())
 
+	// Copy the changes to the utxo set for the block hooks since the view
+	// is pruned once they are committed.
+	var hookView *UtxoViewpoint
+	if b.hasBlockHooks(false) {
+		hookView = view.modifiedClone()
+	}
+
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -725,8 +826,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 
 		// Update the utxo set using the state of the utxo view.  This
 		// entails restoring all of the utxos spent and removing the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		// ones created by the block.  The utxo cache was flushed above,
+		// so this also makes the utxo set consistent with the previous
+		// block.
+		err = b.utxoCache.dbFlush(dbTx, view, &prevNode.hash)
 		if err != nil {
 			return err
 		}
@@ -782,6 +885,9 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	// updating wallets.
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockDisconnected, block)
+	if hookView != nil {
+		b.runBlockHooks(false, block, hookView)
+	}
 	b.chainLock.Lock()
 
 	return nil
@@ -837,6 +943,13 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 	}
 
+	// The blocks being disconnected are checked against the utxo set in the
+	// database, so write out the utxo cache first.  This also allows the
+	// utxo cache to remain empty while blocks are disconnected.
+	if err := b.flushUtxoCache(); err != nil {
+		return err
+	}
+
 	// Track the old and new best chains heads.
 	oldBest := tip
 	newBest := tip
@@ -875,7 +988,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -942,7 +1055,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return err
 			}
@@ -994,7 +1107,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1021,7 +1134,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1120,7 +1233,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1208,6 +1321,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Best chain has at least the minimum chain work (if configured)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function MUST be called with the chain state lock held (for reads).
@@ -1219,6 +1333,14 @@ func (b *BlockChain) isCurrent() bool {
 		return false
 	}
 
+	// Not current if the best chain has less cumulative work than the
+	// configured minimum.
+	if b.minChainWork != nil &&
+		b.bestChain.Tip().workSum.Cmp(b.minChainWork) < 0 {
+
+		return false
+	}
+
 	// Not current if the latest best block has a timestamp before 24 hours
 	// ago.
 	//
@@ -1232,6 +1354,7 @@ func (b *BlockChain) isCurrent() bool {
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Best chain has at least the minimum chain work (if configured)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function is safe for concurrent access.
@@ -1267,6 +1390,30 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 	return node.Header(), nil
 }
 
+// BlockChainWork returns the total cumulative work in the chain up to and
+// including the block with the given hash.  The block does not have to be in
+// the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockChainWork(hash *chainhash.Hash) (*big.Int, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		err := fmt.Errorf("block %s is not known", hash)
+		return nil, err
+	}
+
+	return new(big.Int).Set(node.workSum), nil
+}
+
+// MinimumChainWork returns the minimum amount of cumulative work the best chain
+// must have before the chain believes it is current.  It returns nil when no
+// minimum is required.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MinimumChainWork() *big.Int {
+	return b.minChainWork
+}
+
 // MainChainHasBlock returns whether or not the block with the given hash is in
 // the main chain.
 //
@@ -1332,6 +1479,25 @@ func (b *BlockChain) BlockHashByHeight(blockHeight int32) (*chainhash.Hash, erro
 	return &node.hash, nil
 }
 
+// HeightForTime returns the height of the first block in the main chain whose
+// median time past is at or after the given time.  The median time is used
+// rather than the timestamp of the block since block timestamps are not
+// required to be in order while the median time never decreases.  An error
+// is returned when the median time of the current best block is before the
+// given time.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeightForTime(t time.Time) (int32, error) {
+	node := b.bestChain.FindEarliestMedianTime(t)
+	if node == nil {
+		str := fmt.Sprintf("no block with a median time at or after "+
+			"%v exists", t)
+		return 0, errNotInMainChain(str)
+	}
+
+	return node.height, nil
+}
+
 // HeightRange returns a range of block hashes for the given start and end
 // heights.  It is inclusive of the start height and exclusive of the end
 // height.  The end height will be limited to the current main chain height.
@@ -1638,6 +1804,13 @@ type IndexManager interface {
 	DisconnectBlock(database.Tx, *btcutil.Block, []SpentTxOut) error
 }
 
+// ScriptFlagActivation specifies script verification flags which are enforced
+// for all blocks starting at a given height.
+type ScriptFlagActivation struct {
+	Height int32
+	Flags  txscript.ScriptFlags
+}
+
 // Config is a descriptor which specifies the blockchain instance configuration.
 type Config struct {
 	// DB defines the database which houses the blocks and will be used to
@@ -1667,6 +1840,57 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// AssumeValid is the hash of a block that is assumed to have valid
+	// scripts along with all of its ancestors.  The scripts of blocks that
+	// are ancestors of it are not executed provided it is known to the
+	// block index and part of a chain with at least as much work as the
+	// current best chain.  All other consensus checks are still performed.
+	//
+	// This field can be nil if the caller does not wish to skip the script
+	// checks of any blocks other than those before the latest checkpoint.
+	AssumeValid *chainhash.Hash
+
+	// MinimumChainWork is the minimum amount of cumulative work the best
+	// chain must have before the chain believes it is current.  This
+	// prevents the node from considering itself synced while it is being
+	// fed a low difficulty chain.
+	//
+	// This field can be nil if the caller does not wish to require any
+	// minimum amount of work.
+	MinimumChainWork *big.Int
+
+	// ScriptFlagActivations specifies additional script verification flags
+	// to enforce from given block heights regardless of when the soft forks
+	// which introduce them activate.  It is intended for testing soft-fork
+	// activation and may only be used on the regression test and
+	// simulation networks.
+	//
+	// This field can be nil if the caller does not wish to enforce any
+	// script verification flags beyond the ones of the active soft forks.
+	ScriptFlagActivations []ScriptFlagActivation
+
+	// MaxOrphanBlocks and MaxOrphanBlocksSize are the maximum number and
+	// total serialized size in bytes of the blocks whose parent is not yet
+	// known that are kept in memory.  The oldest orphan blocks are evicted
+	// once either limit is reached.  OrphanBlockExpiry is the amount of
+	// time after which an orphan block is removed.
+	//
+	// Zero values cause DefaultMaxOrphanBlocks, DefaultMaxOrphanBlocksSize,
+	// and DefaultOrphanBlockExpiry to be used respectively.
+	MaxOrphanBlocks     int
+	MaxOrphanBlocksSize uint64
+	OrphanBlockExpiry   time.Duration
+
+	// UtxoCacheMaxSize is the approximate maximum number of bytes of memory
+	// used to keep the unspent transaction outputs created and spent by
+	// connected blocks before they are written to the database.  Larger
+	// sizes greatly reduce the number of database writes during the
+	// initial chain download at the cost of more memory.
+	//
+	// A value of zero causes the modifications of every block to be
+	// written to the database immediately.
+	UtxoCacheMaxSize uint64
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -1727,34 +1951,70 @@ func New(config *Config) (*BlockChain, error) {
 				return nil, AssertError("blockchain.New " +
 					"checkpoints are not sorted by height")
 			}
+			if checkpoint.Hash == nil {
+				return nil, AssertError(fmt.Sprintf("blockchain.New "+
+					"checkpoint at height %d has no hash",
+					checkpoint.Height))
+			}
 
 			checkpointsByHeight[checkpoint.Height] = checkpoint
 			prevCheckpointHeight = checkpoint.Height
 		}
 	}
 
+	// Only allow additional script verification flags on the test
+	// networks where the consensus rules may be changed at will.
+	if len(config.ScriptFlagActivations) > 0 {
+		net := config.ChainParams.Net
+		if net != wire.TestNet && net != wire.SimNet {
+			return nil, AssertError("blockchain.New script flag " +
+				"activations are only allowed on the regression " +
+				"test and simulation networks")
+		}
+	}
+
+	maxOrphans := config.MaxOrphanBlocks
+	if maxOrphans == 0 {
+		maxOrphans = DefaultMaxOrphanBlocks
+	}
+	maxOrphansSize := config.MaxOrphanBlocksSize
+	if maxOrphansSize == 0 {
+		maxOrphansSize = DefaultMaxOrphanBlocksSize
+	}
+	orphanExpiry := config.OrphanBlockExpiry
+	if orphanExpiry == 0 {
+		orphanExpiry = DefaultOrphanBlockExpiry
+	}
+
 	params := config.ChainParams
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
 	adjustmentFactor := params.RetargetAdjustmentFactor
 	b := BlockChain{
-		checkpoints:         config.Checkpoints,
-		checkpointsByHeight: checkpointsByHeight,
-		db:                  config.DB,
-		chainParams:         params,
-		timeSource:          config.TimeSource,
-		sigCache:            config.SigCache,
-		indexManager:        config.IndexManager,
-		minRetargetTimespan: targetTimespan / adjustmentFactor,
-		maxRetargetTimespan: targetTimespan * adjustmentFactor,
-		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
-		index:               newBlockIndex(config.DB, params),
-		hashCache:           config.HashCache,
-		bestChain:           newChainView(nil),
-		orphans:             make(map[chainhash.Hash]*orphanBlock),
-		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
-		warningCaches:       newThresholdCaches(vbNumBits),
-		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
+		checkpoints:           config.Checkpoints,
+		checkpointsByHeight:   checkpointsByHeight,
+		assumeValid:           config.AssumeValid,
+		minChainWork:          config.MinimumChainWork,
+		scriptFlagActivations: config.ScriptFlagActivations,
+		db:                    config.DB,
+		chainParams:           params,
+		timeSource:            config.TimeSource,
+		sigCache:              config.SigCache,
+		indexManager:          config.IndexManager,
+		minRetargetTimespan:   targetTimespan / adjustmentFactor,
+		maxRetargetTimespan:   targetTimespan * adjustmentFactor,
+		blocksPerRetarget:     int32(targetTimespan / targetTimePerBlock),
+		index:                 newBlockIndex(config.DB, params),
+		hashCache:             config.HashCache,
+		bestChain:             newChainView(nil),
+		utxoCache:             newUtxoCache(config.DB, config.UtxoCacheMaxSize),
+		orphans:               make(map[chainhash.Hash]*orphanBlock),
+		prevOrphans:           make(map[chainhash.Hash][]*orphanBlock),
+		maxOrphans:            maxOrphans,
+		maxOrphansSize:        maxOrphansSize,
+		orphanExpiry:          orphanExpiry,
+		warningCaches:         newThresholdCaches(vbNumBits),
+		deploymentCaches:      newThresholdCaches(chaincfg.DefinedDeployments),
 	}
 
 	// Initialize the chain state from the passed database.  When the db
@@ -1764,11 +2024,23 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Ensure the checkpoints, which may include custom ones, agree with
+	// the blocks which are already part of the main chain.
+	if err := b.checkMainChainCheckpoints(); err != nil {
+		return nil, err
+	}
+
 	// Perform any upgrades to the various chain-specific buckets as needed.
 	if err := b.maybeUpgradeDbBuckets(config.Interrupt); err != nil {
 		return nil, err
 	}
 
+	// Reconstruct the utxo set in the database as needed when the utxo
+	// cache was not flushed during the last shutdown.
+	if err := b.initUtxoCache(config.Interrupt); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -5,12 +5,15 @@
 package blockchain
 
 import (
+	"fmt"
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
@@ -964,3 +967,416 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestHeightForTime ensures looking up the first block with a median time at
+// or after a given time works as expected, including when the timestamps of
+// the blocks are out of order.
+func TestHeightForTime(t *testing.T) {
+	// Construct a synthetic block chain with blocks spaced ten minutes
+	// apart except for a few which have timestamps before their parents.
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	genesis := chain.bestChain.Genesis()
+	genesisTime := time.Unix(genesis.timestamp, 0)
+	offsets := []int{10, 20, 30, 25, 40, 50, 45, 35, 70, 80, 90, 85, 100,
+		110, 105, 120, 130, 140, 150, 160}
+	tip := genesis
+	nodes := []*blockNode{genesis}
+	for _, offset := range offsets {
+		timestamp := genesisTime.Add(time.Duration(offset) * time.Minute)
+		tip = newFakeNode(tip, 1, 0x207fffff, timestamp)
+		chain.index.AddNode(tip)
+		nodes = append(nodes, tip)
+	}
+	chain.bestChain.SetTip(tip)
+
+	// firstAtOrAfter returns the expected height for the passed time by
+	// linearly scanning the median times of the chain.
+	firstAtOrAfter := func(target time.Time) int32 {
+		for _, node := range nodes {
+			if !node.CalcPastMedianTime().Before(target) {
+				return node.height
+			}
+		}
+		return -1
+	}
+
+	tests := []struct {
+		name   string
+		target time.Time
+	}{
+		{name: "before genesis", target: genesisTime.Add(-time.Hour)},
+		{name: "genesis", target: genesisTime},
+		{name: "out of order timestamp", target: genesisTime.Add(25 * time.Minute)},
+		{name: "timestamp of earlier block", target: genesisTime.Add(35 * time.Minute)},
+		{name: "between blocks", target: genesisTime.Add(87 * time.Minute)},
+		{name: "tip median time", target: tip.CalcPastMedianTime()},
+		{name: "after tip median time", target: tip.CalcPastMedianTime().Add(time.Second)},
+	}
+	for _, test := range tests {
+		want := firstAtOrAfter(test.target)
+		height, err := chain.HeightForTime(test.target)
+		if want == -1 {
+			if err == nil {
+				t.Errorf("%s: expected error, got height %d",
+					test.name, height)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if height != want {
+			t.Errorf("%s: unexpected height -- got %d, want %d",
+				test.name, height, want)
+		}
+	}
+
+	// Ensure the result matches a linear scan for every minute across the
+	// entire chain.
+	end := genesisTime.Add(180 * time.Minute)
+	for target := genesisTime; target.Before(end); target = target.Add(time.Minute) {
+		want := firstAtOrAfter(target)
+		height, err := chain.HeightForTime(target)
+		if want == -1 {
+			if err == nil {
+				t.Fatalf("HeightForTime(%v): expected error, got "+
+					"height %d", target, height)
+			}
+			continue
+		}
+		if err != nil || height != want {
+			t.Fatalf("HeightForTime(%v): got height %d (err %v), "+
+				"want %d", target, height, err, want)
+		}
+	}
+}
+
+// TestIsCurrentMinChainWork ensures the chain does not believe it is current
+// until the best chain has at least the configured minimum chain work.
+func TestIsCurrentMinChainWork(t *testing.T) {
+	// Construct a synthetic block chain with recent timestamps so the
+	// only reason for the chain to not be current is its work.
+	chain := newFakeChain(&chaincfg.RegressionNetParams)
+	tip := chain.bestChain.Tip()
+	now := time.Now()
+	var nodes []*blockNode
+	for i := 0; i < 10; i++ {
+		timestamp := now.Add(time.Duration(i-10) * time.Minute)
+		tip = newFakeNode(tip, 1, 0x207fffff, timestamp)
+		chain.index.AddNode(tip)
+		nodes = append(nodes, tip)
+	}
+
+	// Require the work of the full chain and feed the chain a shorter
+	// chain with less work.
+	chain.minChainWork = new(big.Int).Set(tip.workSum)
+	chain.bestChain.SetTip(nodes[len(nodes)-2])
+	if chain.IsCurrent() {
+		t.Fatal("IsCurrent: chain with less than the minimum chain " +
+			"work is current")
+	}
+
+	// Ensure the chain is current once the best chain has enough work.
+	chain.bestChain.SetTip(tip)
+	if !chain.IsCurrent() {
+		t.Fatal("IsCurrent: chain with the minimum chain work is not " +
+			"current")
+	}
+
+	// Ensure the chain is current regardless of its work when no minimum
+	// is configured.
+	chain.minChainWork = nil
+	chain.bestChain.SetTip(nodes[0])
+	if !chain.IsCurrent() {
+		t.Fatal("IsCurrent: chain without a minimum chain work is not " +
+			"current")
+	}
+}
+
+// TestOrphanBlockLimits ensures the orphan pool evicts the oldest orphan blocks
+// once the limits on the number and the total size of the orphan blocks are
+// exceeded, that orphan blocks which exceed the size limit on their own are
+// not added, and that expired orphan blocks are removed.
+func TestOrphanBlockLimits(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("orphanblocklimits",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// newOrphan returns a new block whose parent is unknown to the chain.
+	var numOrphans uint32
+	newOrphan := func() *btcutil.Block {
+		numOrphans++
+		parent := &wire.MsgBlock{Header: wire.BlockHeader{
+			Nonce:     numOrphans,
+			Timestamp: time.Unix(1600000000, 0),
+		}}
+		return btcutil.NewBlock(newTestBlock(t, parent, 1))
+	}
+	processOrphan := func(block *btcutil.Block) {
+		t.Helper()
+		_, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		if !isOrphan {
+			t.Fatalf("ProcessBlock: block %v is not an orphan",
+				block.Hash())
+		}
+	}
+	assertOrphans := func(blocks []*btcutil.Block, want []bool) {
+		t.Helper()
+		var wantSize uint64
+		for i, block := range blocks {
+			if chain.IsKnownOrphan(block.Hash()) != want[i] {
+				t.Fatalf("orphan #%d: unexpected known orphan "+
+					"state - got %v, want %v", i, !want[i],
+					want[i])
+			}
+			if want[i] {
+				wantSize += uint64(block.MsgBlock().SerializeSize())
+			}
+		}
+		if chain.orphansSize != wantSize {
+			t.Fatalf("unexpected orphans size - got %d, want %d",
+				chain.orphansSize, wantSize)
+		}
+	}
+
+	// Ensure the oldest orphans are evicted once the number of orphans
+	// exceeds the limit.
+	chain.maxOrphans = 3
+	var orphans []*btcutil.Block
+	for i := 0; i < 5; i++ {
+		orphans = append(orphans, newOrphan())
+		processOrphan(orphans[i])
+	}
+	assertOrphans(orphans, []bool{false, false, true, true, true})
+
+	// Ensure the oldest orphans are evicted until the new orphan fits once
+	// the total size of the orphans would exceed the limit.
+	chain.maxOrphans = 100
+	orphans = append(orphans, newOrphan())
+	chain.maxOrphansSize = uint64(orphans[4].MsgBlock().SerializeSize() +
+		orphans[5].MsgBlock().SerializeSize())
+	processOrphan(orphans[5])
+	assertOrphans(orphans, []bool{false, false, false, false, true, true})
+
+	// Ensure an orphan which exceeds the size limit on its own is not
+	// added and does not evict any other orphan.
+	orphans = append(orphans, newOrphan())
+	chain.maxOrphansSize = uint64(orphans[6].MsgBlock().SerializeSize() - 1)
+	processOrphan(orphans[6])
+	assertOrphans(orphans, []bool{false, false, false, false, true, true,
+		false})
+
+	// Ensure expired orphans are removed when a new orphan is added.
+	chain.maxOrphansSize = DefaultMaxOrphanBlocksSize
+	chain.orphans[*orphans[4].Hash()].expiration = time.Now().Add(-time.Second)
+	orphans = append(orphans, newOrphan())
+	processOrphan(orphans[7])
+	assertOrphans(orphans, []bool{false, false, false, false, false, true,
+		false, true})
+}
+
+// TestProcessOrphans ensures orphan blocks are connected to the main chain in
+// order once their missing parent is received regardless of the order they
+// were received in.
+func TestProcessOrphans(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("processorphans",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a chain of blocks extending the genesis block.
+	parent := chaincfg.RegressionNetParams.GenesisBlock
+	var blocks []*btcutil.Block
+	for i := int32(1); i <= 4; i++ {
+		block := newTestBlock(t, parent, i)
+		blocks = append(blocks, btcutil.NewBlock(block))
+		parent = block
+	}
+
+	var connected []chainhash.Hash
+	chain.Subscribe(func(n *Notification) {
+		if n.Type == NTBlockConnected {
+			block := n.Data.(*btcutil.Block)
+			connected = append(connected, *block.Hash())
+		}
+	})
+
+	// Process all but the first block out of order so they are orphans.
+	for _, block := range []*btcutil.Block{blocks[3], blocks[1], blocks[2]} {
+		_, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		if !isOrphan {
+			t.Fatalf("ProcessBlock: block %v is not an orphan",
+				block.Hash())
+		}
+	}
+	if len(connected) != 0 {
+		t.Fatalf("orphan blocks were connected: %v", connected)
+	}
+
+	// Process the missing parent and ensure all of the blocks are connected
+	// in order and that none of them remains an orphan.
+	isMainChain, isOrphan, err := chain.ProcessBlock(blocks[0], BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+	if !isMainChain || isOrphan {
+		t.Fatalf("ProcessBlock: unexpected result - main chain %v, "+
+			"orphan %v", isMainChain, isOrphan)
+	}
+	var want []chainhash.Hash
+	for _, block := range blocks {
+		want = append(want, *block.Hash())
+		if chain.IsKnownOrphan(block.Hash()) {
+			t.Fatalf("block %v is still an orphan", block.Hash())
+		}
+	}
+	if !reflect.DeepEqual(connected, want) {
+		t.Fatalf("unexpected connected blocks - got %v, want %v",
+			connected, want)
+	}
+	if best := chain.BestSnapshot(); best.Hash != want[len(want)-1] {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			want[len(want)-1])
+	}
+	if chain.orphansSize != 0 {
+		t.Fatalf("unexpected orphans size - got %d, want 0",
+			chain.orphansSize)
+	}
+}
+
+// TestReorganizeUtxoSet ensures disconnecting multiple blocks during a
+// reorganize restores exactly the utxos they spent from the spend journal, in
+// both directions, and that the spend journal only has entries for the blocks
+// in the main chain.
+func TestReorganizeUtxoSet(t *testing.T) {
+	// Construct a main chain and a side chain which fork after the first
+	// block and spend some of the same outputs differently.
+	//
+	//   genesis -> b1 -> b2 -> b3 -> b4 -> b5 -> b6
+	//                \-> b2a -> b3a -> b4a -> b5a
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	t2 := newTestSpend(b1.Transactions[0], 0, 3)
+	b2 := newTestBlock(t, b1, 2, t2)
+	t3 := newTestSpend(t2, 0, 2)
+	b3 := newTestBlock(t, b2, 3, t3, newTestSpend(b2.Transactions[0], 0, 1))
+	b4 := newTestBlock(t, b3, 4, newTestSpend(t2, 1, 1),
+		newTestSpend(t3, 1, 2))
+	b5 := newTestBlock(t, b4, 5, newTestSpend(b3.Transactions[0], 0, 1))
+	b6 := newTestBlock(t, b5, 6)
+	t2a := newTestSpend(b1.Transactions[0], 0, 2)
+	b2a := newTestBlock(t, b1, 2, t2a)
+	b3a := newTestBlock(t, b2a, 3, newTestSpend(t2a, 0, 1))
+	b4a := newTestBlock(t, b3a, 4,
+		newTestSpend(b2a.Transactions[0], 0, 1))
+	b5a := newTestBlock(t, b4a, 5, newTestSpend(t2a, 1, 2))
+	allBlocks := []*wire.MsgBlock{b1, b2, b3, b4, b5, b6, b2a, b3a, b4a, b5a}
+
+	// processBlocks processes the passed blocks in order and ensures the
+	// final one becomes the tip of the main chain.
+	processBlocks := func(chain *BlockChain, blocks []*wire.MsgBlock) {
+		t.Helper()
+		for _, block := range blocks {
+			_, _, err := chain.ProcessBlock(btcutil.NewBlock(block),
+				BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %v: unexpected error: %v",
+					block.BlockHash(), err)
+			}
+		}
+		tip := blocks[len(blocks)-1].BlockHash()
+		if best := chain.BestSnapshot(); best.Hash != tip {
+			t.Fatalf("unexpected best block - got %v, want %v",
+				best.Hash, tip)
+		}
+	}
+
+	// fetchUtxoSet returns the entries for all outputs of the test blocks
+	// and the utxo set stats of the passed chain, and ensures the spend
+	// journal only has entries for the passed main chain blocks.
+	type utxoSet struct {
+		entries map[wire.OutPoint]*UtxoEntry
+		stats   *UtxoStats
+	}
+	fetchUtxoSet := func(chain *BlockChain, mainChain []*wire.MsgBlock) utxoSet {
+		t.Helper()
+		stats, err := chain.FetchUtxoStats(true, nil)
+		if err != nil {
+			t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+		}
+
+		inMainChain := make(map[chainhash.Hash]bool)
+		for _, block := range mainChain {
+			inMainChain[block.BlockHash()] = true
+		}
+		err = chain.db.View(func(dbTx database.Tx) error {
+			spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+			for _, block := range allBlocks {
+				hash := block.BlockHash()
+				hasEntry := spendBucket.Get(hash[:]) != nil
+				if hasEntry != inMainChain[hash] {
+					return fmt.Errorf("unexpected spend "+
+						"journal entry for %v - got %v, "+
+						"want %v", hash, hasEntry,
+						inMainChain[hash])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return utxoSet{fetchTestUtxos(t, chain, allBlocks), stats}
+	}
+
+	// The expected utxo sets are those of chains which only ever
+	// processed the blocks of either main chain.  They are created one at
+	// a time since tearing down a test chain removes all test databases.
+	sideChain := []*wire.MsgBlock{b1, b2a, b3a, b4a, b5a}
+	mainChain := []*wire.MsgBlock{b1, b2, b3, b4, b5, b6}
+	var wantSets []utxoSet
+	for _, blocks := range [][]*wire.MsgBlock{sideChain, mainChain} {
+		chain, teardownFunc, err := chainSetup("reorganizeutxoset",
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		chain.TstSetCoinbaseMaturity(1)
+		processBlocks(chain, blocks)
+		wantSets = append(wantSets, fetchUtxoSet(chain, blocks))
+		teardownFunc()
+	}
+
+	chain, teardownFunc, err := chainSetup("reorganizeutxoset",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Reorganize to the side chain, which disconnects three blocks, and
+	// then back to the extended main chain, which disconnects four.
+	processBlocks(chain, []*wire.MsgBlock{b1, b2, b3, b4})
+	processBlocks(chain, []*wire.MsgBlock{b2a, b3a, b4a, b5a})
+	if got := fetchUtxoSet(chain, sideChain); !reflect.DeepEqual(got, wantSets[0]) {
+		t.Fatalf("unexpected utxo set after reorganize to side chain")
+	}
+	processBlocks(chain, []*wire.MsgBlock{b5, b6})
+	if got := fetchUtxoSet(chain, mainChain); !reflect.DeepEqual(got, wantSets[1]) {
+		t.Fatalf("unexpected utxo set after reorganize to main chain")
+	}
+}
@@ -67,6 +67,11 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxosetv2")
 
+	// utxoStateConsistencyKeyName is the name of the db key used to store
+	// the hash of the block the unspent transaction output set in the
+	// database is consistent with.
+	utxoStateConsistencyKeyName = []byte("utxostateconsistency")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -766,42 +771,44 @@ func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, err
 	return entry, nil
 }
 
+// dbPutUtxoEntry uses an existing database transaction to update the utxo set
+// in the database with the provided entry for the passed outpoint.  Spent
+// entries are removed from the utxo set.
+func dbPutUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint, entry *UtxoEntry) error {
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+
+	// Remove the utxo entry if it is spent.
+	if entry.IsSpent() {
+		key := outpointKey(outpoint)
+		err := utxoBucket.Delete(*key)
+		recycleOutpointKey(key)
+		return err
+	}
+
+	// Serialize and store the utxo entry.
+	serialized, err := serializeUtxoEntry(entry)
+	if err != nil {
+		return err
+	}
+	key := outpointKey(outpoint)
+	// NOTE: The key is intentionally not recycled here since the database
+	// interface contract prohibits modifications.  It will be garbage
+	// collected normally when the database is done with it.
+	return utxoBucket.Put(*key, serialized)
+}
+
 // dbPutUtxoView uses an existing database transaction to update the utxo set
 // in the database based on the provided utxo view contents and state.  In
 // particular, only the entries that have been marked as modified are written
 // to the database.
 func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
 	for outpoint, entry := range view.entries {
 		// No need to update the database if the entry was not modified.
 		if entry == nil || !entry.isModified() {
 			continue
 		}
 
-		// Remove the utxo entry if it is spent.
-		if entry.IsSpent() {
-			key := outpointKey(outpoint)
-			err := utxoBucket.Delete(*key)
-			recycleOutpointKey(key)
-			if err != nil {
-				return err
-			}
-
-			continue
-		}
-
-		// Serialize and store the utxo entry.
-		serialized, err := serializeUtxoEntry(entry)
-		if err != nil {
-			return err
-		}
-		key := outpointKey(outpoint)
-		err = utxoBucket.Put(*key, serialized)
-		// NOTE: The key is intentionally not recycled here since the
-		// database interface contract prohibits modifications.  It will
-		// be garbage collected normally when the database is done with
-		// it.
-		if err != nil {
+		if err := dbPutUtxoEntry(dbTx, outpoint, entry); err != nil {
 			return err
 		}
 	}
@@ -809,6 +816,28 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
 	return nil
 }
 
+// dbFetchUtxoStateConsistency uses an existing database transaction to fetch
+// the hash of the block the utxo set in the database is consistent with.  Nil
+// is returned when the database does not contain it.
+func dbFetchUtxoStateConsistency(dbTx database.Tx) *chainhash.Hash {
+	serialized := dbTx.Metadata().Get(utxoStateConsistencyKeyName)
+	if len(serialized) != chainhash.HashSize {
+		return nil
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash
+}
+
+// dbPutUtxoStateConsistency uses an existing database transaction to store the
+// hash of the block the utxo set in the database is consistent with.
+func dbPutUtxoStateConsistency(dbTx database.Tx, hash *chainhash.Hash) error {
+	serialized := make([]byte, chainhash.HashSize)
+	copy(serialized, hash[:])
+	return dbTx.Metadata().Put(utxoStateConsistencyKeyName, serialized)
+}
+
 // -----------------------------------------------------------------------------
 // The block index consists of two buckets with an entry for every block in the
 // main chain.  One bucket is for the hash to height mapping and the other is
@@ -1238,7 +1267,10 @@ func (b *BlockChain) initChainState() error {
 		b.stateSnapshot = newBestState(tip, blockSize, blockWeight,
 			numTxns, state.totalTxns, tip.CalcPastMedianTime())
 
-		return nil
+		// Load the state of the chainstate built from a utxo snapshot,
+		// if any.
+		b.snapshotState, err = dbFetchSnapshotChainState(dbTx)
+		return err
 	})
 	if err != nil {
 		return err
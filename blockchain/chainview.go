@@ -5,7 +5,9 @@
 package blockchain
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
 // approxNodesPerWeek is an approximation of the number of new blocks there are
@@ -204,6 +206,27 @@ func (c *chainView) NodeByHeight(height int32) *blockNode {
 	return node
 }
 
+// FindEarliestMedianTime returns the first node in the view whose median time
+// past is at or after the passed time.  Nil will be returned if there is no
+// such node.
+//
+// The timestamps of the individual blocks are not required to increase
+// monotonically, so they can't be searched directly.  However, the consensus
+// rules require the timestamp of every block to be after the median time of
+// the blocks before it, which means the median time past never decreases and
+// hence can be binary searched.
+//
+// This function is safe for concurrent access.
+func (c *chainView) FindEarliestMedianTime(t time.Time) *blockNode {
+	c.mtx.Lock()
+	i := sort.Search(len(c.nodes), func(i int) bool {
+		return !c.nodes[i].CalcPastMedianTime().Before(t)
+	})
+	node := c.nodeByHeight(int32(i))
+	c.mtx.Unlock()
+	return node
+}
+
 // Equals returns whether or not two chain views are the same.  Uninitialized
 // views (tip set to nil) are considered equal.
 //
@@ -78,6 +78,30 @@ func (b *BlockChain) verifyCheckpoint(height int32, hash *chainhash.Hash) bool {
 	return true
 }
 
+// checkMainChainCheckpoints returns an error when a block of the main chain is
+// at the height of a checkpoint without matching it.  This can happen when a
+// custom checkpoint is added after the chain already contains a different
+// block at its height.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (b *BlockChain) checkMainChainCheckpoints() error {
+	for i := range b.checkpoints {
+		checkpoint := &b.checkpoints[i]
+		node := b.bestChain.NodeByHeight(checkpoint.Height)
+		if node == nil {
+			// The checkpoints are sorted by height, so none of the
+			// remaining ones are part of the main chain either.
+			return nil
+		}
+		if node.hash != *checkpoint.Hash {
+			return fmt.Errorf("block %v at height %d of the main "+
+				"chain does not match checkpoint %v", node.hash,
+				node.height, checkpoint.Hash)
+		}
+	}
+	return nil
+}
+
 // findPreviousCheckpoint finds the most recent checkpoint that is already
 // available in the downloaded portion of the block chain and returns the
 // associated block node.  It returns nil if a checkpoint can't be found (this
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestForkBlock returns a test block the same way as newTestBlock except its
+// timestamp is an hour later, so it differs from the block newTestBlock
+// creates for the same parent and height.
+func newTestForkBlock(t *testing.T, parent *wire.MsgBlock, height int32) *wire.MsgBlock {
+	block := newTestBlock(t, parent, height)
+	block.Header.Timestamp = block.Header.Timestamp.Add(time.Hour)
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	for checkProofOfWork(&block.Header, powLimit, BFNone) != nil {
+		block.Header.Nonce++
+	}
+	return block
+}
+
+// newTestCheckpointChain returns a chain instance using the database of the
+// passed chain along with the passed checkpoints.
+func newTestCheckpointChain(chain *BlockChain, checkpoints []chaincfg.Checkpoint) (*BlockChain, error) {
+	if err := chain.FlushUtxoCache(); err != nil {
+		return nil, err
+	}
+	return New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		Checkpoints: checkpoints,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+}
+
+// TestCheckpoints ensures reorganizations below the last checkpoint are only
+// possible when checkpoints are disabled, that custom checkpoints reject blocks
+// with a mismatched hash at their height, and that checkpoints which contradict
+// the main chain are rejected when the chain is created.
+func TestCheckpoints(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("checkpoints",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a main chain of three blocks and a competing chain of four
+	// blocks which forks from the genesis block.
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	mainChain := []*wire.MsgBlock{newTestBlock(t, genesis, 1)}
+	sideChain := []*wire.MsgBlock{newTestForkBlock(t, genesis, 1)}
+	for height := int32(2); height <= 4; height++ {
+		sideChain = append(sideChain, newTestBlock(t,
+			sideChain[height-2], height))
+		if height <= 3 {
+			mainChain = append(mainChain, newTestBlock(t,
+				mainChain[height-2], height))
+		}
+	}
+	for _, block := range mainChain {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+
+	// A checkpoint which contradicts the main chain is rejected.
+	wrongHash := chainhash.Hash{0x01}
+	_, err = newTestCheckpointChain(chain, []chaincfg.Checkpoint{
+		{Height: 2, Hash: &wrongHash},
+	})
+	if err == nil {
+		t.Fatalf("New: did not receive expected error for a " +
+			"checkpoint which contradicts the main chain")
+	}
+
+	// With a checkpoint at the second block of the main chain, the first
+	// block of the competing chain forks from before the checkpoint.
+	mainHash := mainChain[1].BlockHash()
+	checkpointed, err := newTestCheckpointChain(chain,
+		[]chaincfg.Checkpoint{{Height: 2, Hash: &mainHash}})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	_, _, err = checkpointed.ProcessBlock(btcutil.NewBlock(sideChain[0]),
+		BFNone)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrForkTooOld {
+		t.Fatalf("ProcessBlock: unexpected error for a fork before "+
+			"the checkpoint - got %v, want %v", err, ErrForkTooOld)
+	}
+
+	// A custom checkpoint rejects a block with a mismatched hash at its
+	// height.
+	sideHash := sideChain[3].BlockHash()
+	custom, err := newTestCheckpointChain(chain,
+		[]chaincfg.Checkpoint{{Height: 4, Hash: &sideHash}})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	mismatched := newTestBlock(t, mainChain[2], 4)
+	_, _, err = custom.ProcessBlock(btcutil.NewBlock(mismatched), BFNone)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadCheckpoint {
+		t.Fatalf("ProcessBlock: unexpected error for a block which "+
+			"does not match the checkpoint - got %v, want %v", err,
+			ErrBadCheckpoint)
+	}
+
+	// Without checkpoints, the competing chain reorganizes the main chain
+	// all the way back to the genesis block.
+	disabled, err := newTestCheckpointChain(chain, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	for _, block := range sideChain {
+		_, _, err := disabled.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	best := disabled.BestSnapshot()
+	if best.Height != 4 || best.Hash != sideHash {
+		t.Fatalf("unexpected best block - got %v (%d), want %v (4)",
+			best.Hash, best.Height, sideHash)
+	}
+}
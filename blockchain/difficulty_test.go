@@ -7,6 +7,9 @@ package blockchain
 import (
 	"math/big"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +76,60 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestCalcNextRequiredDifficultyBIP94 ensures the difficulty at a retarget is
+// calculated from the first block of the period on networks that enforce
+// BIP0094 and from the last block of the period otherwise.
+func TestCalcNextRequiredDifficultyBIP94(t *testing.T) {
+	const periodBits = 0x1c7fffff
+
+	tests := []struct {
+		name         string
+		enforceBIP94 bool
+		wantOldBits  uint32
+	}{
+		{name: "testnet3 rules", enforceBIP94: false, wantOldBits: 0x1d00ffff},
+		{name: "testnet4 rules", enforceBIP94: true, wantOldBits: periodBits},
+	}
+	for _, test := range tests {
+		params := chaincfg.TestNet4Params
+		params.EnforceBIP94 = test.enforceBIP94
+		chain := newFakeChain(&params)
+
+		// Construct two full difficulty periods with blocks ten minutes
+		// apart.  Every block of the second period has the same
+		// difficulty except for the last one which was mined with the
+		// minimum difficulty.
+		tip := chain.bestChain.Tip()
+		blocksPerRetarget := chain.blocksPerRetarget
+		for i := int32(1); i < blocksPerRetarget*2; i++ {
+			bits := uint32(periodBits)
+			if i < blocksPerRetarget || i == blocksPerRetarget*2-1 {
+				bits = params.PowLimitBits
+			}
+			timestamp := time.Unix(tip.timestamp, 0).Add(10 * time.Minute)
+			tip = newFakeNode(tip, 4, bits, timestamp)
+		}
+
+		firstNode := tip.RelativeAncestor(blocksPerRetarget - 1)
+		actualTimespan := tip.timestamp - firstNode.timestamp
+		targetTimespan := int64(params.TargetTimespan / time.Second)
+		want := new(big.Int).Mul(CompactToBig(test.wantOldBits),
+			big.NewInt(actualTimespan))
+		want.Div(want, big.NewInt(targetTimespan))
+		if want.Cmp(params.PowLimit) > 0 {
+			want.Set(params.PowLimit)
+		}
+		wantBits := BigToCompact(want)
+
+		nextTime := time.Unix(tip.timestamp, 0).Add(10 * time.Minute)
+		gotBits, err := chain.calcNextRequiredDifficulty(tip, nextTime)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if gotBits != wantBits {
+			t.Fatalf("%s: unexpected difficulty - got %08x, want "+
+				"%08x", test.name, gotBits, wantBits)
+		}
+	}
+}
@@ -220,6 +220,12 @@ const (
 	// current chain tip. This is not a block validation rule, but is required
 	// for block proposals submitted via getblocktemplate RPC.
 	ErrPrevBlockNotBest
+
+	// ErrTimewarpAttack indicates the timestamp of the first block of a
+	// difficulty adjustment period is too far before the timestamp of the
+	// block that precedes it.  This is only enforced on networks that
+	// enforce BIP0094.
+	ErrTimewarpAttack
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -267,6 +273,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrTimewarpAttack:            "ErrTimewarpAttack",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -0,0 +1,237 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// BlockMunger modifies a block built by a SimHarness before it is solved.  The
+// merkle root of the block is recalculated after the mungers are applied unless
+// one of them changed it, and the block is only solved when none of them
+// changed the nonce.
+type BlockMunger func(*wire.MsgBlock)
+
+// SimHarness builds blocks on top of the best chain of a chain instance and
+// checks how the chain processes them.  It allows tests to generate blocks with
+// deliberately invalid properties and then verify the exact rule violation the
+// chain reports for them.
+//
+// The blocks pay the subsidy to anyone-can-spend outputs and are solved by
+// iterating the nonce, so it is only intended for networks where the proof of
+// work is trivial such as the simulation test network.
+type SimHarness struct {
+	chain  *BlockChain
+	tip    *wire.MsgBlock
+	height int32
+}
+
+// NewSimHarness returns a harness which builds blocks on top of the current best
+// chain of the passed chain instance.
+func NewSimHarness(chain *BlockChain) (*SimHarness, error) {
+	best := chain.BestSnapshot()
+	tip, err := chain.BlockByHash(&best.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return &SimHarness{
+		chain:  chain,
+		tip:    tip.MsgBlock(),
+		height: best.Height,
+	}, nil
+}
+
+// Tip returns the block the harness builds the next block on top of along with
+// its height.
+func (h *SimHarness) Tip() (*wire.MsgBlock, int32) {
+	return h.tip, h.height
+}
+
+// NextBlock returns a new solved block which extends the tip of the harness and
+// only contains a coinbase transaction, after applying the passed mungers to
+// it.  The block is not processed by the chain and the tip of the harness is
+// only advanced when the block is accepted via AcceptBlock.
+func (h *SimHarness) NextBlock(mungers ...BlockMunger) (*wire.MsgBlock, error) {
+	params := h.chain.chainParams
+	height := h.height + 1
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(0).Script()
+	if err != nil {
+		return nil, err
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&zeroHash, wire.MaxPrevOutIndex),
+		SignatureScript:  coinbaseScript,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(CalcBlockSubsidy(height, params),
+		[]byte{txscript.OP_TRUE}))
+
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   4,
+			PrevBlock: h.tip.BlockHash(),
+			Timestamp: h.tip.Header.Timestamp.Add(time.Second),
+			Bits:      params.PowLimitBits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	block.Header.MerkleRoot = calcTxMerkleRoot(block.Transactions)
+
+	// Perform any block munging just before solving.  Only recalculate the
+	// merkle root if it wasn't manually changed by a munge function.
+	curMerkleRoot := block.Header.MerkleRoot
+	curNonce := block.Header.Nonce
+	for _, munge := range mungers {
+		munge(block)
+	}
+	if block.Header.MerkleRoot == curMerkleRoot {
+		block.Header.MerkleRoot = calcTxMerkleRoot(block.Transactions)
+	}
+
+	// Only solve the block if the nonce wasn't manually changed by a munge
+	// function.
+	if block.Header.Nonce == curNonce {
+		for checkProofOfWork(&block.Header, params.PowLimit, BFNone) != nil {
+			block.Header.Nonce++
+			if block.Header.Nonce == curNonce {
+				return nil, fmt.Errorf("unable to solve block at "+
+					"height %d", height)
+			}
+		}
+	}
+	return block, nil
+}
+
+// AcceptBlock processes the passed block and ensures it is accepted as the new
+// tip of the best chain, in which case it becomes the tip of the harness.
+func (h *SimHarness) AcceptBlock(block *wire.MsgBlock) error {
+	blockHash := block.BlockHash()
+	isMainChain, isOrphan, err := h.chain.ProcessBlock(btcutil.NewBlock(block),
+		BFNone)
+	if err != nil {
+		return fmt.Errorf("block %v rejected: %v", blockHash, err)
+	}
+	if isOrphan || !isMainChain {
+		return fmt.Errorf("block %v was not connected to the main chain",
+			blockHash)
+	}
+
+	h.tip = block
+	h.height++
+	return nil
+}
+
+// RejectBlock processes the passed block and ensures it is rejected due to a
+// violation of the consensus rule identified by the passed error code without
+// changing the best chain.
+func (h *SimHarness) RejectBlock(block *wire.MsgBlock, code ErrorCode) error {
+	blockHash := block.BlockHash()
+	best := h.chain.BestSnapshot()
+	_, _, err := h.chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+	if err == nil {
+		return fmt.Errorf("block %v was accepted when it should have "+
+			"been rejected with %v", blockHash, code)
+	}
+	rerr, ok := err.(RuleError)
+	if !ok {
+		return fmt.Errorf("block %v was rejected with a non-rule error "+
+			"when it should have been rejected with %v: %v", blockHash,
+			code, err)
+	}
+	if rerr.ErrorCode != code {
+		return fmt.Errorf("block %v was rejected with %v when it should "+
+			"have been rejected with %v: %v", blockHash, rerr.ErrorCode,
+			code, err)
+	}
+	if newBest := h.chain.BestSnapshot(); newBest.Hash != best.Hash {
+		return fmt.Errorf("rejected block %v changed the best chain to %v",
+			blockHash, newBest.Hash)
+	}
+	return nil
+}
+
+// calcTxMerkleRoot returns the merkle root of the passed transactions without
+// their witness data committed to.
+func calcTxMerkleRoot(txns []*wire.MsgTx) chainhash.Hash {
+	utilTxns := make([]*btcutil.Tx, 0, len(txns))
+	for _, tx := range txns {
+		utilTxns = append(utilTxns, btcutil.NewTx(tx))
+	}
+	merkles := BuildMerkleTreeStore(utilTxns, false)
+	return *merkles[len(merkles)-1]
+}
+
+// BadMerkleRoot returns a munger which commits the header of a block to a
+// merkle root which does not match its transactions.
+func BadMerkleRoot() BlockMunger {
+	return func(block *wire.MsgBlock) {
+		block.Header.MerkleRoot[0] ^= 0xff
+	}
+}
+
+// Oversized returns a munger which adds a transaction to a block so that its
+// serialized size without witness data exceeds the maximum allowed size by one
+// byte.  The transaction spends an output which doesn't exist, so the block is
+// invalid for that reason as well once it passes the size checks.
+func Oversized() BlockMunger {
+	return func(block *wire.MsgBlock) {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(0, nil))
+		block.AddTransaction(tx)
+
+		// The size of the length prefix of the script depends on the
+		// length of the script, so converge on the exact size.
+		for {
+			size := block.SerializeSizeStripped()
+			if size == MaxBlockBaseSize+1 {
+				return
+			}
+			scriptLen := len(tx.TxOut[0].PkScript) +
+				MaxBlockBaseSize + 1 - size
+			tx.TxOut[0].PkScript = make([]byte, scriptLen)
+		}
+	}
+}
+
+// BadProofOfWork returns a munger which chooses a nonce for a block so that its
+// hash is higher than the target difficulty claimed by its header.  It must be
+// the last munger applied since any further change to the block changes its
+// hash.
+func BadProofOfWork() BlockMunger {
+	return func(block *wire.MsgBlock) {
+		block.Header.MerkleRoot = calcTxMerkleRoot(block.Transactions)
+		target := CompactToBig(block.Header.Bits)
+		for {
+			block.Header.Nonce++
+			hash := block.Header.BlockHash()
+			if HashToBig(&hash).Cmp(target) > 0 {
+				return
+			}
+		}
+	}
+}
+
+// CoinbaseHeight returns a munger which replaces the block height serialized in
+// the coinbase signature script of a block with the passed height.
+func CoinbaseHeight(height int32) BlockMunger {
+	return func(block *wire.MsgBlock) {
+		script, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(0).Script()
+		if err != nil {
+			panic(fmt.Sprintf("unable to create coinbase script: %v",
+				err))
+		}
+		block.Transactions[0].TxIn[0].SignatureScript = script
+	}
+}
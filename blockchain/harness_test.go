@@ -0,0 +1,111 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestSimHarness ensures blocks built by the harness with each category of
+// invalid property are rejected with the rule error for it while valid blocks
+// extend the chain.
+func TestSimHarness(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("simharness",
+		&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	h, err := NewSimHarness(chain)
+	if err != nil {
+		t.Fatalf("NewSimHarness: unexpected error: %v", err)
+	}
+
+	// Extend the chain with a valid block so the invalid blocks are not
+	// built on top of the genesis block.
+	block, err := h.NextBlock()
+	if err != nil {
+		t.Fatalf("NextBlock: unexpected error: %v", err)
+	}
+	if err := h.AcceptBlock(block); err != nil {
+		t.Fatalf("AcceptBlock: %v", err)
+	}
+	if tip, height := h.Tip(); tip != block || height != 1 {
+		t.Fatalf("unexpected harness tip %v (%d)", tip.BlockHash(),
+			height)
+	}
+
+	tests := []struct {
+		name    string
+		mungers []BlockMunger
+		code    ErrorCode
+	}{{
+		name:    "bad merkle root",
+		mungers: []BlockMunger{BadMerkleRoot()},
+		code:    ErrBadMerkleRoot,
+	}, {
+		name:    "oversized",
+		mungers: []BlockMunger{Oversized()},
+		code:    ErrBlockTooBig,
+	}, {
+		name:    "bad proof of work",
+		mungers: []BlockMunger{BadProofOfWork()},
+		code:    ErrHighHash,
+	}, {
+		name:    "coinbase height too high",
+		mungers: []BlockMunger{CoinbaseHeight(3)},
+		code:    ErrBadCoinbaseHeight,
+	}, {
+		name:    "coinbase height of parent",
+		mungers: []BlockMunger{CoinbaseHeight(1)},
+		code:    ErrBadCoinbaseHeight,
+	}, {
+		name: "unexpected difficulty",
+		mungers: []BlockMunger{func(block *wire.MsgBlock) {
+			block.Header.Bits--
+		}},
+		code: ErrUnexpectedDifficulty,
+	}}
+	for _, test := range tests {
+		block, err := h.NextBlock(test.mungers...)
+		if err != nil {
+			t.Fatalf("%s: NextBlock: unexpected error: %v", test.name,
+				err)
+		}
+		if err := h.RejectBlock(block, test.code); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+
+	// The harness reports blocks which aren't rejected for the expected
+	// reason.
+	block, err = h.NextBlock(BadMerkleRoot())
+	if err != nil {
+		t.Fatalf("NextBlock: unexpected error: %v", err)
+	}
+	if err := h.RejectBlock(block, ErrHighHash); err == nil {
+		t.Fatal("RejectBlock: did not receive expected error for a " +
+			"block rejected for another reason")
+	}
+	if err := h.AcceptBlock(block); err == nil {
+		t.Fatal("AcceptBlock: did not receive expected error for an " +
+			"invalid block")
+	}
+	block, err = h.NextBlock()
+	if err != nil {
+		t.Fatalf("NextBlock: unexpected error: %v", err)
+	}
+	if err := h.RejectBlock(block, ErrBadMerkleRoot); err == nil {
+		t.Fatal("RejectBlock: did not receive expected error for a " +
+			"valid block")
+	}
+	if best := chain.BestSnapshot(); best.Hash != block.BlockHash() {
+		t.Fatalf("valid block %v did not extend the chain", block.BlockHash())
+	}
+}
@@ -6,6 +6,7 @@ package indexers
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -75,9 +76,19 @@ func dbDeleteFilterIdxEntry(dbTx database.Tx, key []byte, h *chainhash.Hash) err
 }
 
 // CfIndex implements a committed filter (cf) by hash index.
+//
+// The index is safe for concurrent access without any additional locking.
+// Blocks are connected to and disconnected from the index within the database
+// transaction of the index manager, and every read is performed within a
+// single database transaction as well, so readers always observe the index as
+// of either before or after a block was connected or disconnected, but never
+// in between.  Separate reads may however observe different states when the
+// chain is reorganized between them, so entries that must be consistent with
+// each other have to be fetched using the batch methods.
 type CfIndex struct {
-	db          database.DB
-	chainParams *chaincfg.Params
+	db            database.DB
+	chainParams   *chaincfg.Params
+	filterBuilder FilterBuilder
 }
 
 // Ensure the CfIndex type implements the Indexer interface.
@@ -86,6 +97,9 @@ var _ Indexer = (*CfIndex)(nil)
 // Ensure the CfIndex type implements the NeedsInputser interface.
 var _ NeedsInputser = (*CfIndex)(nil)
 
+// Ensure the CfIndex type implements the BulkConnecter interface.
+var _ BulkConnecter = (*CfIndex)(nil)
+
 // NeedsInputs signals that the index requires the referenced inputs in order
 // to properly create the index.
 //
@@ -114,31 +128,33 @@ func (idx *CfIndex) Name() string {
 
 // Create is invoked when the indexer manager determines the index needs to
 // be created for the first time. It creates buckets for the two hash-based cf
-// indexes (regular only currently).
+// indexes (regular only currently).  Buckets which already exist, such as the
+// ones created to store the filters fetched from peers, are left as is.
 func (idx *CfIndex) Create(dbTx database.Tx) error {
 	meta := dbTx.Metadata()
 
-	cfIndexParentBucket, err := meta.CreateBucket(cfIndexParentBucketKey)
+	cfIndexParentBucket, err := meta.CreateBucketIfNotExists(
+		cfIndexParentBucketKey)
 	if err != nil {
 		return err
 	}
 
 	for _, bucketName := range cfIndexKeys {
-		_, err = cfIndexParentBucket.CreateBucket(bucketName)
+		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
 		}
 	}
 
 	for _, bucketName := range cfHeaderKeys {
-		_, err = cfIndexParentBucket.CreateBucket(bucketName)
+		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
 		}
 	}
 
 	for _, bucketName := range cfHashKeys {
-		_, err = cfIndexParentBucket.CreateBucket(bucketName)
+		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
 		}
@@ -147,63 +163,163 @@ func (idx *CfIndex) Create(dbTx database.Tx) error {
 	return nil
 }
 
-// storeFilter stores a given filter, and performs the steps needed to
-// generate the filter's header.
-func storeFilter(dbTx database.Tx, block *btcutil.Block, f *gcs.Filter,
+// CreateStore creates the buckets which house the index when they do not exist
+// yet.  It allows the index to store the filters verified by the caller, such
+// as the ones fetched from peers, without the index manager building them from
+// the blocks connected to the chain.
+func (idx *CfIndex) CreateStore() error {
+	return idx.db.Update(idx.Create)
+}
+
+// dbFetchPrevFilterHeader retrieves the filter header of the previous block
+// for the passed block from the filter index database.  The zero hash is
+// returned for the genesis block.
+func dbFetchPrevFilterHeader(dbTx database.Tx, block *btcutil.Block,
+	filterType wire.FilterType) (*chainhash.Hash, error) {
+
+	ph := &block.MsgBlock().Header.PrevBlock
+	if ph.IsEqual(&zeroHash) {
+		return &zeroHash, nil
+	}
+
+	pfh, err := dbFetchFilterIdxEntry(dbTx, cfHeaderKeys[filterType], ph)
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.NewHash(pfh)
+}
+
+// FilterBuilder builds the regular committed filters stored by the cf index.
+// This allows the items committed to by the filters to be chosen independently
+// of how the filters are stored and served.
+//
+// The filters served to peers are expected to be the basic filters defined by
+// BIP0158, so other builders should only be used when the filters are not
+// served to peers.  The filters must be gcs filters built with the default
+// parameters of the builder package and keyed by the block hash for them to be
+// matched by the index.
+type FilterBuilder interface {
+	// Build returns the serialized filter for the passed block which
+	// spends the provided outputs.  The spent outputs are in the order
+	// the transactions in the block spend them.
+	Build(block *btcutil.Block, stxos []blockchain.SpentTxOut) ([]byte, error)
+}
+
+// BasicFilterBuilder builds the basic filters defined by BIP0158, which commit
+// to the public key scripts of the outputs created and spent by a block.  It is
+// the filter builder used by the cf index by default.
+type BasicFilterBuilder struct{}
+
+// Ensure the BasicFilterBuilder type implements the FilterBuilder interface.
+var _ FilterBuilder = BasicFilterBuilder{}
+
+// Build returns the serialized basic filter for the passed block which spends
+// the provided outputs.
+//
+// This is part of the FilterBuilder interface.
+func (BasicFilterBuilder) Build(block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) ([]byte, error) {
+
+	prevScripts := make([][]byte, len(stxos))
+	for i, stxo := range stxos {
+		prevScripts[i] = stxo.PkScript
+	}
+
+	f, err := builder.BuildBasicFilter(block.MsgBlock(), prevScripts)
+	if err != nil {
+		return nil, err
+	}
+	return f.NBytes()
+}
+
+// makeFilterHeader returns the filter header which commits to the passed
+// serialized filter and the provided filter header of the previous block as
+// defined by BIP0157 along with the hash of the filter.
+func makeFilterHeader(filterBytes []byte,
+	prevHeader *chainhash.Hash) (chainhash.Hash, chainhash.Hash) {
+
+	filterHash := chainhash.DoubleHashH(filterBytes)
+	var filterTip [2 * chainhash.HashSize]byte
+	copy(filterTip[:], filterHash[:])
+	copy(filterTip[chainhash.HashSize:], prevHeader[:])
+	return chainhash.DoubleHashH(filterTip[:]), filterHash
+}
+
+// storeFilter stores a given serialized filter, and performs the steps needed
+// to generate the filter's header.
+func storeFilter(dbTx database.Tx, block *btcutil.Block, filterBytes []byte,
 	filterType wire.FilterType) error {
 	if uint8(filterType) > maxFilterType {
 		return errors.New("unsupported filter type")
 	}
 
+	// Fetch the previous block's filter header.
+	prevHeader, err := dbFetchPrevFilterHeader(dbTx, block, filterType)
+	if err != nil {
+		return err
+	}
+
+	_, err = storeFilterWithPrevHeader(dbTx, block.Hash(), filterBytes,
+		filterType, prevHeader)
+	return err
+}
+
+// storeFilterWithPrevHeader stores a given serialized filter of the block with
+// the passed hash along with its hash and the filter header constructed from
+// the provided header of the previous block.  The new filter header is returned
+// so it can be used for the next block.
+func storeFilterWithPrevHeader(dbTx database.Tx, h *chainhash.Hash,
+	filterBytes []byte, filterType wire.FilterType,
+	prevHeader *chainhash.Hash) (*chainhash.Hash, error) {
+
 	// Figure out which buckets to use.
 	fkey := cfIndexKeys[filterType]
 	hkey := cfHeaderKeys[filterType]
 	hashkey := cfHashKeys[filterType]
 
 	// Start by storing the filter.
-	h := block.Hash()
-	filterBytes, err := f.NBytes()
+	err := dbStoreFilterIdxEntry(dbTx, fkey, h, filterBytes)
 	if err != nil {
-		return err
-	}
-	err = dbStoreFilterIdxEntry(dbTx, fkey, h, filterBytes)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Next store the filter hash.
-	filterHash, err := builder.GetFilterHash(f)
-	if err != nil {
-		return err
-	}
+	fh, filterHash := makeFilterHeader(filterBytes, prevHeader)
 	err = dbStoreFilterIdxEntry(dbTx, hashkey, h, filterHash[:])
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Then fetch the previous block's filter header.
-	var prevHeader *chainhash.Hash
-	ph := &block.MsgBlock().Header.PrevBlock
-	if ph.IsEqual(&zeroHash) {
-		prevHeader = &zeroHash
-	} else {
-		pfh, err := dbFetchFilterIdxEntry(dbTx, hkey, ph)
-		if err != nil {
-			return err
-		}
-
-		// Construct the new block's filter header, and store it.
-		prevHeader, err = chainhash.NewHash(pfh)
-		if err != nil {
-			return err
-		}
+	// Finally, store the new block's filter header.
+	err = dbStoreFilterIdxEntry(dbTx, hkey, h, fh[:])
+	if err != nil {
+		return nil, err
 	}
+	return &fh, nil
+}
 
-	fh, err := builder.MakeHeaderForFilter(f, *prevHeader)
+// BuildBlockFilterForTest returns the serialized basic filter the index stores
+// for the passed block, which spends outputs with the provided public key
+// scripts, along with the filter header committing to it and the provided
+// filter header of the previous block.
+//
+// It is only intended to be used by tests which ensure the filters built by
+// the index do not change.
+func BuildBlockFilterForTest(block *wire.MsgBlock, prevScripts [][]byte,
+	prevHeader *chainhash.Hash) ([]byte, *chainhash.Hash, error) {
+
+	stxos := make([]blockchain.SpentTxOut, len(prevScripts))
+	for i, prevScript := range prevScripts {
+		stxos[i].PkScript = prevScript
+	}
+	filterBytes, err := BasicFilterBuilder{}.Build(btcutil.NewBlock(block),
+		stxos)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	return dbStoreFilterIdxEntry(dbTx, hkey, h, fh[:])
+
+	header, _ := makeFilterHeader(filterBytes, prevHeader)
+	return filterBytes, &header, nil
 }
 
 // ConnectBlock is invoked by the index manager when a new block has been
@@ -212,17 +328,47 @@ func storeFilter(dbTx database.Tx, block *btcutil.Block, f *gcs.Filter,
 func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 	stxos []blockchain.SpentTxOut) error {
 
-	prevScripts := make([][]byte, len(stxos))
-	for i, stxo := range stxos {
-		prevScripts[i] = stxo.PkScript
-	}
-
-	f, err := builder.BuildBasicFilter(block.MsgBlock(), prevScripts)
+	filterBytes, err := idx.filterBuilder.Build(block, stxos)
 	if err != nil {
 		return err
 	}
 
-	return storeFilter(dbTx, block, f, wire.GCSFilterRegular)
+	return storeFilter(dbTx, block, filterBytes, wire.GCSFilterRegular)
+}
+
+// BulkConnect is invoked by the index manager to connect several consecutive
+// blocks to the main chain at once.  This indexer adds a hash-to-cf mapping
+// for every passed block.  The filter header of each block is carried over to
+// the next one rather than being looked up in the database again.
+//
+// This is part of the BulkConnecter interface.
+func (idx *CfIndex) BulkConnect(dbTx database.Tx, blocks []*btcutil.Block,
+	stxos [][]blockchain.SpentTxOut) error {
+
+	var prevHeader *chainhash.Hash
+	for i, block := range blocks {
+		filterBytes, err := idx.filterBuilder.Build(block, stxos[i])
+		if err != nil {
+			return err
+		}
+
+		// The previous filter header of the first block has to be
+		// looked up in the database.
+		if prevHeader == nil {
+			prevHeader, err = dbFetchPrevFilterHeader(dbTx, block,
+				wire.GCSFilterRegular)
+			if err != nil {
+				return err
+			}
+		}
+
+		prevHeader, err = storeFilterWithPrevHeader(dbTx, block.Hash(),
+			filterBytes, wire.GCSFilterRegular, prevHeader)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // DisconnectBlock is invoked by the index manager when a block has been
@@ -255,6 +401,54 @@ func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 	return nil
 }
 
+// StoreFilters stores the passed serialized filters of consecutive blocks with
+// the provided hashes along with the filter headers committing to them, where
+// the first filter header commits to the provided filter header of the block
+// before them.  It is used to store filters which were not built by the index
+// itself, such as the ones fetched from peers, so the caller is responsible
+// for verifying them beforehand.
+//
+// The index must have been created by the index manager or CreateStore before
+// filters are stored.
+func (idx *CfIndex) StoreFilters(blockHashes []*chainhash.Hash,
+	filters [][]byte, filterType wire.FilterType,
+	prevHeader *chainhash.Hash) error {
+
+	if uint8(filterType) > maxFilterType {
+		return errors.New("unsupported filter type")
+	}
+	if len(blockHashes) != len(filters) {
+		return fmt.Errorf("%d filters provided for %d blocks",
+			len(filters), len(blockHashes))
+	}
+
+	return idx.db.Update(func(dbTx database.Tx) error {
+		for i, h := range blockHashes {
+			var err error
+			prevHeader, err = storeFilterWithPrevHeader(dbTx, h,
+				filters[i], filterType, prevHeader)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// copyEntry returns a copy of the passed filter index entry.  Entries fetched
+// from the database are only valid during the database transaction they were
+// fetched in, so they must be copied before being returned to callers.  A nil
+// entry, which indicates its absence, is returned as is.
+func copyEntry(entry []byte) []byte {
+	if entry == nil {
+		return nil
+	}
+
+	entryCopy := make([]byte, len(entry))
+	copy(entryCopy, entry)
+	return entryCopy
+}
+
 // entryByBlockHash fetches a filter index entry of a particular type
 // (eg. filter, filter header, etc) for a filter type and block hash.
 func (idx *CfIndex) entryByBlockHash(filterTypeKeys [][]byte,
@@ -267,8 +461,8 @@ func (idx *CfIndex) entryByBlockHash(filterTypeKeys [][]byte,
 
 	var entry []byte
 	err := idx.db.View(func(dbTx database.Tx) error {
-		var err error
-		entry, err = dbFetchFilterIdxEntry(dbTx, key, h)
+		fetched, err := dbFetchFilterIdxEntry(dbTx, key, h)
+		entry = copyEntry(fetched)
 		return err
 	})
 	return entry, err
@@ -276,6 +470,8 @@ func (idx *CfIndex) entryByBlockHash(filterTypeKeys [][]byte,
 
 // entriesByBlockHashes batch fetches a filter index entry of a particular type
 // (eg. filter, filter header, etc) for a filter type and slice of block hashes.
+// All of the entries are fetched within the same database transaction, so they
+// are consistent with each other.
 func (idx *CfIndex) entriesByBlockHashes(filterTypeKeys [][]byte,
 	filterType wire.FilterType, blockHashes []*chainhash.Hash) ([][]byte, error) {
 
@@ -291,7 +487,7 @@ func (idx *CfIndex) entriesByBlockHashes(filterTypeKeys [][]byte,
 			if err != nil {
 				return err
 			}
-			entries = append(entries, entry)
+			entries = append(entries, copyEntry(entry))
 		}
 		return nil
 	})
@@ -340,15 +536,112 @@ func (idx *CfIndex) FilterHashesByBlockHashes(blockHashes []*chainhash.Hash,
 	return idx.entriesByBlockHashes(cfHashKeys, filterType, blockHashes)
 }
 
+// Stats returns the number of regular filters stored in the index along with
+// their total serialized size in bytes.  This requires iterating all of the
+// filters, so it is expensive for large indexes.  The filter headers and
+// hashes are not included in the total.
+func (idx *CfIndex) Stats() (count int, totalBytes uint64, err error) {
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).
+			Bucket(cfIndexKeys[wire.GCSFilterRegular])
+		return bucket.ForEach(func(_, filterBytes []byte) error {
+			count++
+			totalBytes += uint64(len(filterBytes))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, totalBytes, nil
+}
+
+// decodeFilter decodes the passed serialized committed filter of the block
+// with the provided hash.
+func decodeFilter(h *chainhash.Hash, filterBytes []byte) (*gcs.Filter, error) {
+	if len(filterBytes) == 0 {
+		return nil, fmt.Errorf("no committed filter for block %v", h)
+	}
+
+	return gcs.FromNBytes(builder.DefaultP, builder.DefaultM, filterBytes)
+}
+
+// MatchFilter returns whether or not each of the passed items matches the
+// committed filter of the given type for the block with the provided hash.
+// Since the filters are probabilistic, an item that matches is not guaranteed
+// to be included in the block, but an item that does not match is guaranteed
+// not to be.
+func (idx *CfIndex) MatchFilter(h *chainhash.Hash, filterType wire.FilterType,
+	items [][]byte) ([]bool, error) {
+
+	filterBytes, err := idx.FilterByBlockHash(h, filterType)
+	if err != nil {
+		return nil, err
+	}
+	f, err := decodeFilter(h, filterBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := builder.DeriveKey(h)
+	matches := make([]bool, len(items))
+	for i, item := range items {
+		matches[i], err = f.Match(key, item)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// MatchAnyFilters returns whether or not any of the passed items matches the
+// committed filter of the given type for each of the blocks with the provided
+// hashes.  This allows a range of blocks to be checked for relevant
+// transactions without having to fetch the blocks themselves.  The same
+// caveats about false positives as for MatchFilter apply.
+//
+// An error is returned when any of the blocks has not been indexed.
+func (idx *CfIndex) MatchAnyFilters(blockHashes []*chainhash.Hash,
+	filterType wire.FilterType, items [][]byte) ([]bool, error) {
+
+	filters, err := idx.FiltersByBlockHashes(blockHashes, filterType)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]bool, len(blockHashes))
+	for i, h := range blockHashes {
+		f, err := decodeFilter(h, filters[i])
+		if err != nil {
+			return nil, err
+		}
+		matches[i], err = f.MatchAny(builder.DeriveKey(h), items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
 // NewCfIndex returns a new instance of an indexer that is used to create a
 // mapping of the hashes of all blocks in the blockchain to their respective
-// committed filters.
+// committed filters.  The filters are built by the provided filter builder, or
+// are the basic filters defined by BIP0158 when it is nil.
 //
 // It implements the Indexer interface which plugs into the IndexManager that
 // in turn is used by the blockchain package. This allows the index to be
 // seamlessly maintained along with the chain.
-func NewCfIndex(db database.DB, chainParams *chaincfg.Params) *CfIndex {
-	return &CfIndex{db: db, chainParams: chainParams}
+func NewCfIndex(db database.DB, chainParams *chaincfg.Params,
+	filterBuilder FilterBuilder) *CfIndex {
+
+	if filterBuilder == nil {
+		filterBuilder = BasicFilterBuilder{}
+	}
+	return &CfIndex{
+		db:            db,
+		chainParams:   chainParams,
+		filterBuilder: filterBuilder,
+	}
 }
 
 // DropCfIndex drops the CF index from the provided database if exists.
@@ -0,0 +1,510 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/gcs/builder"
+)
+
+// TestCfIndexMatchFilter ensures items are matched against the committed
+// filter of a block as expected.
+func TestCfIndexMatchFilter(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	idx := NewCfIndex(db, &chaincfg.SimNetParams, nil)
+	createTestManager(t, db, []Indexer{idx})
+
+	// Create a block with a transaction paying to a known script.
+	blocks := makeTestChain(2)
+	knownScript := []byte{0x76, 0xa9, 0x14, 0x01, 0x02, 0x03, 0x88, 0xac}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(
+		blocks[1].Transactions()[0].Hash(), 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, knownScript))
+	blocks = append(blocks, makeTestBlock(blocks[1], tx))
+	for _, block := range blocks {
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbIndexConnectBlock(dbTx, idx, block, nil)
+		})
+		if err != nil {
+			t.Fatalf("dbIndexConnectBlock: unexpected error: %v", err)
+		}
+	}
+
+	absentScript := []byte{0x76, 0xa9, 0x14, 0x04, 0x05, 0x06, 0x88, 0xac}
+	items := [][]byte{absentScript, knownScript}
+	matches, err := idx.MatchFilter(blocks[2].Hash(), wire.GCSFilterRegular,
+		items)
+	if err != nil {
+		t.Fatalf("MatchFilter: unexpected error: %v", err)
+	}
+	if want := []bool{false, true}; !reflect.DeepEqual(matches, want) {
+		t.Fatalf("MatchFilter: unexpected matches -- got %v, want %v",
+			matches, want)
+	}
+
+	// The known script must not match the filter of a block that does not
+	// include it.
+	matches, err = idx.MatchFilter(blocks[1].Hash(), wire.GCSFilterRegular,
+		items)
+	if err != nil {
+		t.Fatalf("MatchFilter: unexpected error: %v", err)
+	}
+	if want := []bool{false, false}; !reflect.DeepEqual(matches, want) {
+		t.Fatalf("MatchFilter: unexpected matches -- got %v, want %v",
+			matches, want)
+	}
+
+	// Blocks that have not been indexed must return an error.
+	_, err = idx.MatchFilter(&chainhash.Hash{}, wire.GCSFilterRegular, items)
+	if err == nil {
+		t.Fatal("MatchFilter: expected error for unknown block")
+	}
+
+	// Only the block including the known script must match any of the
+	// items when matching a range of blocks.
+	blockHashes := make([]*chainhash.Hash, 0, len(blocks))
+	for _, block := range blocks {
+		blockHashes = append(blockHashes, block.Hash())
+	}
+	anyMatches, err := idx.MatchAnyFilters(blockHashes,
+		wire.GCSFilterRegular, items)
+	if err != nil {
+		t.Fatalf("MatchAnyFilters: unexpected error: %v", err)
+	}
+	if want := []bool{false, false, true}; !reflect.DeepEqual(anyMatches, want) {
+		t.Fatalf("MatchAnyFilters: unexpected matches -- got %v, want %v",
+			anyMatches, want)
+	}
+	_, err = idx.MatchAnyFilters([]*chainhash.Hash{blocks[1].Hash(),
+		{}}, wire.GCSFilterRegular, items)
+	if err == nil {
+		t.Fatal("MatchAnyFilters: expected error for unknown block")
+	}
+}
+
+// TestCfIndexStats ensures the number of filters in the cf index and their
+// total size are reported as expected as blocks are connected and
+// disconnected.
+func TestCfIndexStats(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	idx := NewCfIndex(db, &chaincfg.SimNetParams, nil)
+	createTestManager(t, db, []Indexer{idx})
+
+	checkStats := func(desc string, wantCount int, wantBytes uint64) {
+		t.Helper()
+		count, totalBytes, err := idx.Stats()
+		if err != nil {
+			t.Fatalf("%s: Stats: unexpected error: %v", desc, err)
+		}
+		if count != wantCount || totalBytes != wantBytes {
+			t.Fatalf("%s: unexpected stats -- got %d filters of %d "+
+				"bytes, want %d filters of %d bytes", desc, count,
+				totalBytes, wantCount, wantBytes)
+		}
+	}
+	checkStats("empty index", 0, 0)
+
+	blocks := makeTestChain(4)
+	var wantBytes []uint64
+	var totalBytes uint64
+	for _, block := range blocks {
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbIndexConnectBlock(dbTx, idx, block, nil)
+		})
+		if err != nil {
+			t.Fatalf("dbIndexConnectBlock: unexpected error: %v", err)
+		}
+
+		filterBytes, err := idx.FilterByBlockHash(block.Hash(),
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("FilterByBlockHash: unexpected error: %v", err)
+		}
+		totalBytes += uint64(len(filterBytes))
+		wantBytes = append(wantBytes, totalBytes)
+	}
+	checkStats("connected", len(blocks), totalBytes)
+
+	// The filter of a disconnected block must no longer be counted.
+	tip := blocks[len(blocks)-1]
+	err := db.Update(func(dbTx database.Tx) error {
+		return dbIndexDisconnectBlock(dbTx, idx, tip, nil)
+	})
+	if err != nil {
+		t.Fatalf("dbIndexDisconnectBlock: unexpected error: %v", err)
+	}
+	checkStats("disconnected", len(blocks)-1, wantBytes[len(blocks)-2])
+}
+
+// TestCfIndexConcurrentAccess ensures readers of the cf index observe a
+// consistent state of it while blocks are concurrently connected and
+// disconnected.
+func TestCfIndexConcurrentAccess(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	idx := NewCfIndex(db, &chaincfg.SimNetParams, nil)
+	createTestManager(t, db, []Indexer{idx})
+
+	// Determine the filters of the blocks connected and disconnected by
+	// the writer below, which are the blocks after the genesis block.
+	blocks := makeTestChain(5)
+	blockHashes := make([]*chainhash.Hash, 0, len(blocks)-1)
+	wantFilters := make([][]byte, 0, len(blocks)-1)
+	for _, block := range blocks[1:] {
+		f, err := builder.BuildBasicFilter(block.MsgBlock(), nil)
+		if err != nil {
+			t.Fatalf("BuildBasicFilter: unexpected error: %v", err)
+		}
+		filterBytes, err := f.NBytes()
+		if err != nil {
+			t.Fatalf("NBytes: unexpected error: %v", err)
+		}
+		blockHashes = append(blockHashes, block.Hash())
+		wantFilters = append(wantFilters, filterBytes)
+	}
+	err := db.Update(func(dbTx database.Tx) error {
+		return dbIndexConnectBlock(dbTx, idx, blocks[0], nil)
+	})
+	if err != nil {
+		t.Fatalf("dbIndexConnectBlock: unexpected error: %v", err)
+	}
+
+	// checkEntries ensures the passed entries of the blocks are consistent
+	// with a chain of some length and returns that length.  Blocks are
+	// connected and disconnected in order, so an entry must only be
+	// present when the entries of all previous blocks are.
+	checkEntries := func(desc string, entries [][]byte) int {
+		numPresent := 0
+		for numPresent < len(entries) && entries[numPresent] != nil {
+			numPresent++
+		}
+		for i := numPresent; i < len(entries); i++ {
+			if entries[i] != nil {
+				t.Errorf("%s: entry of block %d present without "+
+					"the one of block %d", desc, i+1,
+					numPresent+1)
+			}
+		}
+		return numPresent
+	}
+
+	// Start readers which continuously fetch the filters and the filter
+	// headers of the blocks until the writer is done.
+	const numReaders = 4
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				filters, err := idx.FiltersByBlockHashes(blockHashes,
+					wire.GCSFilterRegular)
+				if err != nil {
+					t.Errorf("FiltersByBlockHashes: unexpected "+
+						"error: %v", err)
+					return
+				}
+				numFilters := checkEntries("filters", filters)
+				for j := 0; j < numFilters; j++ {
+					if !bytes.Equal(filters[j], wantFilters[j]) {
+						t.Errorf("unexpected filter for "+
+							"block %d", j+1)
+					}
+				}
+
+				headers, err := idx.FilterHeadersByBlockHashes(
+					blockHashes, wire.GCSFilterRegular)
+				if err != nil {
+					t.Errorf("FilterHeadersByBlockHashes: "+
+						"unexpected error: %v", err)
+					return
+				}
+				checkEntries("filter headers", headers)
+
+				// The filter of the tip must be present as long
+				// as it is connected.
+				tip := blockHashes[len(blockHashes)-1]
+				filter, err := idx.FilterByBlockHash(tip,
+					wire.GCSFilterRegular)
+				if err != nil {
+					t.Errorf("FilterByBlockHash: unexpected "+
+						"error: %v", err)
+					return
+				}
+				if filter != nil && !bytes.Equal(filter,
+					wantFilters[len(wantFilters)-1]) {
+
+					t.Error("unexpected filter for the tip")
+				}
+			}
+		}()
+	}
+
+	// Repeatedly connect all of the blocks and disconnect them again while
+	// the readers are running.
+	for i := 0; i < 25; i++ {
+		for _, block := range blocks[1:] {
+			err := db.Update(func(dbTx database.Tx) error {
+				return dbIndexConnectBlock(dbTx, idx, block, nil)
+			})
+			if err != nil {
+				close(done)
+				wg.Wait()
+				t.Fatalf("dbIndexConnectBlock: unexpected error: %v",
+					err)
+			}
+		}
+		for j := len(blocks) - 1; j > 0; j-- {
+			err := db.Update(func(dbTx database.Tx) error {
+				return dbIndexDisconnectBlock(dbTx, idx, blocks[j],
+					nil)
+			})
+			if err != nil {
+				close(done)
+				wg.Wait()
+				t.Fatalf("dbIndexDisconnectBlock: unexpected error: "+
+					"%v", err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// blockFilterFixture describes a block along with the public key scripts of
+// the outputs it spends and the filter and filter header the cf index must
+// build for it.
+type blockFilterFixture struct {
+	Name        string   `json:"name"`
+	Block       string   `json:"block"`
+	PrevScripts []string `json:"prevScripts"`
+	PrevHeader  string   `json:"prevHeader"`
+	Filter      string   `json:"filter"`
+	Header      string   `json:"header"`
+}
+
+// TestBlockFilterFixtures ensures the filters and filter headers built for the
+// blocks in the fixtures do not change.  The filter of the test network
+// genesis block is the one given by the BIP0158 test vectors.  A failure here
+// means the serialization of filters changed, which breaks every client that
+// relies on the filters served by the index.
+func TestBlockFilterFixtures(t *testing.T) {
+	fixturesJSON, err := ioutil.ReadFile(filepath.Join("testdata",
+		"blockfilters.json"))
+	if err != nil {
+		t.Fatalf("unable to read fixtures: %v", err)
+	}
+	var fixtures []blockFilterFixture
+	if err := json.Unmarshal(fixturesJSON, &fixtures); err != nil {
+		t.Fatalf("unable to parse fixtures: %v", err)
+	}
+
+	for _, fixture := range fixtures {
+		blockBytes, err := hex.DecodeString(fixture.Block)
+		if err != nil {
+			t.Fatalf("%s: unable to decode block: %v", fixture.Name, err)
+		}
+		var block wire.MsgBlock
+		err = block.Deserialize(bytes.NewReader(blockBytes))
+		if err != nil {
+			t.Fatalf("%s: unable to deserialize block: %v",
+				fixture.Name, err)
+		}
+		prevScripts := make([][]byte, 0, len(fixture.PrevScripts))
+		for _, prevScript := range fixture.PrevScripts {
+			script, err := hex.DecodeString(prevScript)
+			if err != nil {
+				t.Fatalf("%s: unable to decode script: %v",
+					fixture.Name, err)
+			}
+			prevScripts = append(prevScripts, script)
+		}
+		prevHeader, err := chainhash.NewHashFromStr(fixture.PrevHeader)
+		if err != nil {
+			t.Fatalf("%s: unable to decode header: %v", fixture.Name,
+				err)
+		}
+
+		filterBytes, header, err := BuildBlockFilterForTest(&block,
+			prevScripts, prevHeader)
+		if err != nil {
+			t.Fatalf("%s: BuildBlockFilterForTest: unexpected error: %v",
+				fixture.Name, err)
+		}
+		if got := hex.EncodeToString(filterBytes); got != fixture.Filter {
+			t.Errorf("%s: filter changed -- got %s, want %s",
+				fixture.Name, got, fixture.Filter)
+		}
+		if got := header.String(); got != fixture.Header {
+			t.Errorf("%s: filter header changed -- got %s, want %s",
+				fixture.Name, got, fixture.Header)
+		}
+	}
+}
+
+// serializeTestOutPoint returns the serialization of the passed outpoint used
+// as a filter item by outPointFilterBuilder.
+func serializeTestOutPoint(outpoint *wire.OutPoint) []byte {
+	serialized := make([]byte, chainhash.HashSize+4)
+	copy(serialized, outpoint.Hash[:])
+	binary.LittleEndian.PutUint32(serialized[chainhash.HashSize:],
+		outpoint.Index)
+	return serialized
+}
+
+// outPointFilterBuilder provides a filter builder which commits to the
+// outpoints spent by a block in addition to the public key scripts of the
+// outputs it creates.
+type outPointFilterBuilder struct{}
+
+// Ensure the outPointFilterBuilder type implements the FilterBuilder
+// interface.
+var _ FilterBuilder = outPointFilterBuilder{}
+
+func (outPointFilterBuilder) Build(block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) ([]byte, error) {
+
+	b := builder.WithKeyHash(block.Hash())
+	for i, tx := range block.MsgBlock().Transactions {
+		if i != 0 {
+			for _, txIn := range tx.TxIn {
+				b.AddEntry(serializeTestOutPoint(
+					&txIn.PreviousOutPoint))
+			}
+		}
+		for _, txOut := range tx.TxOut {
+			b.AddEntry(txOut.PkScript)
+		}
+	}
+	f, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return f.NBytes()
+}
+
+// TestCfIndexFilterBuilder ensures the cf index stores and matches the filters
+// built by the filter builder it is created with.
+func TestCfIndexFilterBuilder(t *testing.T) {
+	// Create a block with a transaction spending a known outpoint.
+	blocks := makeTestChain(2)
+	spentOutPoint := wire.NewOutPoint(blocks[1].Transactions()[0].Hash(), 0)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(spentOutPoint, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	blocks = append(blocks, makeTestBlock(blocks[1], tx))
+	items := [][]byte{serializeTestOutPoint(spentOutPoint)}
+
+	for _, test := range []struct {
+		name          string
+		filterBuilder FilterBuilder
+		wantMatch     bool
+	}{
+		{name: "basic", filterBuilder: nil, wantMatch: false},
+		{
+			name:          "outpoints",
+			filterBuilder: outPointFilterBuilder{},
+			wantMatch:     true,
+		},
+	} {
+		db, teardown := createTestDB(t)
+		idx := NewCfIndex(db, &chaincfg.SimNetParams,
+			test.filterBuilder)
+		createTestManager(t, db, []Indexer{idx})
+		for _, block := range blocks {
+			err := db.Update(func(dbTx database.Tx) error {
+				return dbIndexConnectBlock(dbTx, idx, block, nil)
+			})
+			if err != nil {
+				teardown()
+				t.Fatalf("%s: dbIndexConnectBlock: unexpected "+
+					"error: %v", test.name, err)
+			}
+		}
+
+		// The stored filter must be the one built by the filter
+		// builder along with a header committing to it.
+		tip := blocks[2].Hash()
+		filterBytes, err := idx.FilterByBlockHash(tip,
+			wire.GCSFilterRegular)
+		if err != nil {
+			teardown()
+			t.Fatalf("%s: FilterByBlockHash: unexpected error: %v",
+				test.name, err)
+		}
+		headers, err := idx.FilterHeadersByBlockHashes(
+			[]*chainhash.Hash{blocks[1].Hash(), tip},
+			wire.GCSFilterRegular)
+		if err != nil {
+			teardown()
+			t.Fatalf("%s: FilterHeadersByBlockHashes: unexpected "+
+				"error: %v", test.name, err)
+		}
+		matches, err := idx.MatchFilter(tip, wire.GCSFilterRegular, items)
+		teardown()
+		if err != nil {
+			t.Fatalf("%s: MatchFilter: unexpected error: %v",
+				test.name, err)
+		}
+
+		wantBuilder := test.filterBuilder
+		if wantBuilder == nil {
+			wantBuilder = BasicFilterBuilder{}
+		}
+		wantFilter, err := wantBuilder.Build(blocks[2], nil)
+		if err != nil {
+			t.Fatalf("%s: Build: unexpected error: %v", test.name, err)
+		}
+		if !bytes.Equal(filterBytes, wantFilter) {
+			t.Fatalf("%s: unexpected filter -- got %x, want %x",
+				test.name, filterBytes, wantFilter)
+		}
+		prevHeader, err := chainhash.NewHash(headers[0])
+		if err != nil {
+			t.Fatalf("%s: unable to decode header: %v", test.name, err)
+		}
+		wantHeader, _ := makeFilterHeader(wantFilter, prevHeader)
+		if !bytes.Equal(headers[1], wantHeader[:]) {
+			t.Fatalf("%s: unexpected filter header -- got %x, want %v",
+				test.name, headers[1], wantHeader)
+		}
+
+		// Only the filters committing to the spent outpoint must
+		// match it.
+		if matches[0] != test.wantMatch {
+			t.Fatalf("%s: unexpected match of spent outpoint -- got "+
+				"%v, want %v", test.name, matches[0],
+				test.wantMatch)
+		}
+	}
+}
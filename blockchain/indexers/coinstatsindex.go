@@ -0,0 +1,478 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// coinStatsIndexName is the human-readable name for the index.
+	coinStatsIndexName = "coin stats index"
+
+	// coinStatsEntrySize is the size of a serialized coin stats index
+	// entry.
+	coinStatsEntrySize = 4 + 8 + 8 + 8 + 64
+
+	// coinStatsBogoSizeOverhead is the number of bytes added to the size of
+	// the public key script of every output to calculate the bogo size of
+	// the utxo set.  It matches the overhead used by the blockchain package
+	// when it scans the utxo set.
+	coinStatsBogoSizeOverhead = chainhash.HashSize + 4 + 4 + 8 + 2
+)
+
+var (
+	// coinStatsIndexKey is the key of the coin stats index and the db
+	// bucket used to house it.
+	coinStatsIndexKey = []byte("coinstatsidx")
+
+	// bip30RepeatBlocks maps the hashes of the two main network blocks with
+	// coinbase transactions that duplicate the coinbases of earlier blocks
+	// to the heights of those earlier blocks.  Their outputs overwrote the
+	// outputs of the earlier ones in the utxo set rather than adding to it,
+	// so the earlier outputs are replaced by them.
+	bip30RepeatBlocks = map[chainhash.Hash]int32{
+		*newHashFromStr("00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec"): 91812,
+		*newHashFromStr("00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721"): 91722,
+	}
+)
+
+// newHashFromStr converts the passed big-endian hex string into a
+// chainhash.Hash.  It only differs from the one available in chainhash in that
+// it panics on an error since it will only be called with hard-coded values.
+func newHashFromStr(hexStr string) *chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// -----------------------------------------------------------------------------
+// The utxo set commitment maintained by the coin stats index is an elliptic
+// curve multiset hash (ECMH) over secp256k1.  Every unspent output is mapped to
+// a point on the curve and the commitment is the sum of the points of all
+// unspent outputs, so outputs can be added and removed in any order while
+// arriving at the same commitment for the same utxo set.
+//
+// An output is mapped to a point by hashing its serialization with sha256 and
+// then repeatedly hashing that hash along with an incrementing 32-bit counter
+// until the result is the x coordinate of a point on the curve, in which case
+// the point with the even y coordinate is used.
+//
+// The serialization of an output is:
+//
+//   <tx hash><output index><header code><amount><script len><script>
+//
+//   Field          Type             Size
+//   tx hash        chainhash.Hash   chainhash.HashSize
+//   output index   uint32           4 bytes
+//   header code    uint32           4 bytes
+//   amount         int64            8 bytes
+//   script len     VarInt           variable
+//   script         []byte           variable
+//
+// The header code is the height of the block containing the output shifted
+// left one bit with the lowest bit set when the output is from a coinbase.
+// All integers are encoded little endian.
+// -----------------------------------------------------------------------------
+
+// multiset houses an elliptic curve multiset hash of a set of unspent outputs.
+// The empty set is represented by the point at infinity, which has both
+// coordinates set to zero.
+type multiset struct {
+	x, y *big.Int
+}
+
+// newMultiset returns a multiset for the empty set.
+func newMultiset() *multiset {
+	return &multiset{x: new(big.Int), y: new(big.Int)}
+}
+
+// outputPoint returns the point on the curve the passed unspent output maps
+// to.
+func outputPoint(outpoint *wire.OutPoint, amount int64, pkScript []byte,
+	height int32, isCoinBase bool) (*big.Int, *big.Int) {
+
+	var buf bytes.Buffer
+	var scratch [16]byte
+	headerCode := uint32(height) << 1
+	if isCoinBase {
+		headerCode |= 0x01
+	}
+	byteOrder.PutUint32(scratch[0:4], outpoint.Index)
+	byteOrder.PutUint32(scratch[4:8], headerCode)
+	byteOrder.PutUint64(scratch[8:16], uint64(amount))
+	buf.Write(outpoint.Hash[:])
+	buf.Write(scratch[:])
+	_ = wire.WriteVarBytes(&buf, 0, pkScript)
+	outputHash := sha256.Sum256(buf.Bytes())
+
+	curve := btcec.S256()
+	var preimage [sha256.Size + 4]byte
+	copy(preimage[:], outputHash[:])
+	compressed := make([]byte, btcec.PubKeyBytesLenCompressed)
+	compressed[0] = 0x02
+	for counter := uint32(0); ; counter++ {
+		byteOrder.PutUint32(preimage[sha256.Size:], counter)
+		x := sha256.Sum256(preimage[:])
+		if new(big.Int).SetBytes(x[:]).Cmp(curve.P) >= 0 {
+			continue
+		}
+		copy(compressed[1:], x[:])
+		pubKey, err := btcec.ParsePubKey(compressed, curve)
+		if err == nil {
+			return pubKey.X, pubKey.Y
+		}
+	}
+}
+
+// add adds the passed unspent output to the multiset.
+func (m *multiset) add(outpoint *wire.OutPoint, amount int64, pkScript []byte,
+	height int32, isCoinBase bool) {
+
+	x, y := outputPoint(outpoint, amount, pkScript, height, isCoinBase)
+	m.x, m.y = btcec.S256().Add(m.x, m.y, x, y)
+}
+
+// remove removes the passed unspent output from the multiset.
+func (m *multiset) remove(outpoint *wire.OutPoint, amount int64, pkScript []byte,
+	height int32, isCoinBase bool) {
+
+	curve := btcec.S256()
+	x, y := outputPoint(outpoint, amount, pkScript, height, isCoinBase)
+	y.Sub(curve.P, y)
+	m.x, m.y = curve.Add(m.x, m.y, x, y)
+}
+
+// serialize returns the 64-byte serialization of the coordinates of the point
+// of the multiset.
+func (m *multiset) serialize() []byte {
+	serialized := make([]byte, 64)
+	xBytes, yBytes := m.x.Bytes(), m.y.Bytes()
+	copy(serialized[32-len(xBytes):32], xBytes)
+	copy(serialized[64-len(yBytes):], yBytes)
+	return serialized
+}
+
+// hash returns the sha256 hash of the serialization of the multiset, which is
+// the commitment to the utxo set it represents.
+func (m *multiset) hash() chainhash.Hash {
+	return chainhash.Hash(sha256.Sum256(m.serialize()))
+}
+
+// -----------------------------------------------------------------------------
+// The coin stats index consists of an entry for every block in the main chain
+// with the statistics of the utxo set as of that block.  Keeping an entry per
+// block allows a block to be disconnected by simply removing its entry.
+//
+// The serialized format for keys and values in the coin stats index is:
+//   <block hash> = <height><txouts><bogo size><total amount><multiset>
+//
+//   Field              Type              Size
+//   block hash         chainhash.Hash    32 bytes
+//   height             uint32            4 bytes
+//   txouts             uint64            8 bytes
+//   bogo size          uint64            8 bytes
+//   total amount       uint64            8 bytes
+//   multiset           [64]byte          64 bytes (x and y big endian)
+//   -----
+//   Total: 32 bytes key, 92 bytes value
+// -----------------------------------------------------------------------------
+
+// CoinStats houses statistics about the unspent transaction output set as of
+// a block in the main chain which are maintained by the coin stats index.
+type CoinStats struct {
+	// Height and Hash identify the block the statistics are for.
+	Height int32
+	Hash   chainhash.Hash
+
+	// Outputs is the total number of unspent outputs.
+	Outputs int64
+
+	// TotalAmount is the total value of all unspent outputs in satoshi.
+	TotalAmount int64
+
+	// BogoSize is a database independent metric for the size of the utxo
+	// set.
+	BogoSize int64
+
+	// ECMH is the elliptic curve multiset hash of the utxo set.
+	ECMH chainhash.Hash
+}
+
+// coinStatsEntry houses the statistics stored in the coin stats index for a
+// block along with the multiset needed to update the commitment.
+type coinStatsEntry struct {
+	height      int32
+	outputs     int64
+	bogoSize    int64
+	totalAmount int64
+	set         *multiset
+}
+
+// serializeCoinStatsEntry returns the serialization of the passed entry for
+// storage in the coin stats index.
+func serializeCoinStatsEntry(entry *coinStatsEntry) []byte {
+	serialized := make([]byte, coinStatsEntrySize)
+	byteOrder.PutUint32(serialized[0:4], uint32(entry.height))
+	byteOrder.PutUint64(serialized[4:12], uint64(entry.outputs))
+	byteOrder.PutUint64(serialized[12:20], uint64(entry.bogoSize))
+	byteOrder.PutUint64(serialized[20:28], uint64(entry.totalAmount))
+	copy(serialized[28:], entry.set.serialize())
+	return serialized
+}
+
+// dbFetchCoinStatsEntry uses an existing database transaction to fetch the
+// coin stats index entry for the passed block hash.  When there is no entry
+// for the block, nil will be returned for both the entry and the error.
+func dbFetchCoinStatsEntry(dbTx database.Tx, hash *chainhash.Hash) (*coinStatsEntry, error) {
+	coinStatsIndex := dbTx.Metadata().Bucket(coinStatsIndexKey)
+	serialized := coinStatsIndex.Get(hash[:])
+	if len(serialized) == 0 {
+		return nil, nil
+	}
+
+	// Ensure the serialized data has enough bytes to properly deserialize.
+	if len(serialized) < coinStatsEntrySize {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt coin stats index "+
+				"entry for %v", hash),
+		}
+	}
+
+	return &coinStatsEntry{
+		height:      int32(byteOrder.Uint32(serialized[0:4])),
+		outputs:     int64(byteOrder.Uint64(serialized[4:12])),
+		bogoSize:    int64(byteOrder.Uint64(serialized[12:20])),
+		totalAmount: int64(byteOrder.Uint64(serialized[20:28])),
+		set: &multiset{
+			x: new(big.Int).SetBytes(serialized[28:60]),
+			y: new(big.Int).SetBytes(serialized[60:92]),
+		},
+	}, nil
+}
+
+// CoinStatsIndex implements an index of the statistics of the unspent
+// transaction output set as of every block in the main chain.  That is to say,
+// it makes the statistics for the current best block available without having
+// to scan the entire utxo set.
+type CoinStatsIndex struct {
+	db database.DB
+}
+
+// Ensure the CoinStatsIndex type implements the Indexer interface.
+var _ Indexer = (*CoinStatsIndex)(nil)
+
+// Ensure the CoinStatsIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CoinStatsIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to remove the outputs spent by a block from the statistics.
+//
+// This implements the NeedsInputser interface.
+func (idx *CoinStatsIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) Key() []byte {
+	return coinStatsIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) Name() string {
+	return coinStatsIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the coin stats
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(coinStatsIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for the block with
+// the statistics of the previous block updated by the outputs the block
+// creates and spends.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	// The outputs of the genesis block are not spendable, so the utxo set
+	// is empty as of it.
+	entry := &coinStatsEntry{set: newMultiset()}
+	if block.Height() != 0 {
+		prevHash := &block.MsgBlock().Header.PrevBlock
+		prevEntry, err := dbFetchCoinStatsEntry(dbTx, prevHash)
+		if err != nil {
+			return err
+		}
+		if prevEntry == nil {
+			return AssertError(fmt.Sprintf("coin stats index has no "+
+				"entry for block %v the connected block %v "+
+				"builds on", prevHash, block.Hash()))
+		}
+		entry = prevEntry
+	}
+	entry.height = block.Height()
+
+	stxoIdx := 0
+	repeatHeight, isBIP30Repeat := bip30RepeatBlocks[*block.Hash()]
+	for txIdx, tx := range block.Transactions() {
+		isCoinBase := txIdx == 0
+		if !isCoinBase {
+			for _, txIn := range tx.MsgTx().TxIn {
+				if stxoIdx >= len(stxos) {
+					return AssertError(fmt.Sprintf("missing "+
+						"spent outputs for block %v",
+						block.Hash()))
+				}
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+
+				entry.set.remove(&txIn.PreviousOutPoint,
+					stxo.Amount, stxo.PkScript, stxo.Height,
+					stxo.IsCoinBase)
+				entry.outputs--
+				entry.totalAmount -= stxo.Amount
+				entry.bogoSize -= int64(coinStatsBogoSizeOverhead +
+					len(stxo.PkScript))
+			}
+		}
+
+		if isCoinBase && block.Height() == 0 {
+			continue
+		}
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			// Provably unspendable outputs are never added to the
+			// utxo set.
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+
+			prevOut.Index = uint32(txOutIdx)
+
+			// The outputs of a coinbase which duplicates an earlier
+			// one replace the unspent outputs of the earlier one,
+			// so only their heights change.
+			if isCoinBase && isBIP30Repeat {
+				entry.set.remove(&prevOut, txOut.Value,
+					txOut.PkScript, repeatHeight, true)
+				entry.set.add(&prevOut, txOut.Value,
+					txOut.PkScript, block.Height(), true)
+				continue
+			}
+
+			entry.set.add(&prevOut, txOut.Value, txOut.PkScript,
+				block.Height(), isCoinBase)
+			entry.outputs++
+			entry.totalAmount += txOut.Value
+			entry.bogoSize += int64(coinStatsBogoSizeOverhead +
+				len(txOut.PkScript))
+		}
+	}
+
+	coinStatsIndex := dbTx.Metadata().Bucket(coinStatsIndexKey)
+	return coinStatsIndex.Put(block.Hash()[:], serializeCoinStatsEntry(entry))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entry for the
+// block, which leaves the entry of the previous block as the latest one.
+//
+// This is part of the Indexer interface.
+func (idx *CoinStatsIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	coinStatsIndex := dbTx.Metadata().Bucket(coinStatsIndexKey)
+	if coinStatsIndex.Get(block.Hash()[:]) == nil {
+		return fmt.Errorf("can't remove non-existent block %v from the "+
+			"coin stats index", block.Hash())
+	}
+	return coinStatsIndex.Delete(block.Hash()[:])
+}
+
+// CoinStats returns the statistics of the unspent transaction output set as of
+// the current tip of the index, which is the best block of the main chain once
+// the index is caught up.
+//
+// This function is safe for concurrent access.
+func (idx *CoinStatsIndex) CoinStats() (*CoinStats, error) {
+	var stats *CoinStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		hash, height, err := dbFetchIndexerTip(dbTx, coinStatsIndexKey)
+		if err != nil {
+			return err
+		}
+		entry, err := dbFetchCoinStatsEntry(dbTx, hash)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("coin stats index has no entry for "+
+				"its tip %v", hash)
+		}
+
+		stats = &CoinStats{
+			Height:      height,
+			Hash:        *hash,
+			Outputs:     entry.outputs,
+			TotalAmount: entry.totalAmount,
+			BogoSize:    entry.bogoSize,
+			ECMH:        entry.set.hash(),
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// NewCoinStatsIndex returns a new instance of an indexer that is used to
+// maintain the statistics of the unspent transaction output set as of every
+// block in the main chain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCoinStatsIndex(db database.DB) *CoinStatsIndex {
+	return &CoinStatsIndex{db: db}
+}
+
+// DropCoinStatsIndex drops the coin stats index from the provided database if
+// it exists.
+func DropCoinStatsIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, coinStatsIndexKey, coinStatsIndexName, interrupt)
+}
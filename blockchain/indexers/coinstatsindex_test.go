@@ -0,0 +1,289 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// checkCoinStats ensures the statistics maintained by the passed coin stats
+// index match those calculated by the chain with a full scan of its utxo set,
+// including a multiset hash of all outputs in a utxo snapshot of it.
+func checkCoinStats(t *testing.T, idx *CoinStatsIndex, chain *blockchain.BlockChain) {
+	t.Helper()
+
+	utxoStats, err := chain.FetchUtxoStats(false, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	want := CoinStats{
+		Height:      utxoStats.Height,
+		Hash:        utxoStats.Hash,
+		Outputs:     utxoStats.Outputs,
+		TotalAmount: utxoStats.TotalAmount,
+		BogoSize:    utxoStats.BogoSize,
+	}
+
+	// The entries of a snapshot use the same serialization the outputs
+	// are mapped to points of the multiset with.
+	var snapshot bytes.Buffer
+	if _, err := chain.DumpUtxoSnapshot(&snapshot, nil); err != nil {
+		t.Fatalf("DumpUtxoSnapshot: unexpected error: %v", err)
+	}
+	snapshot.Next(chainhash.HashSize + 8)
+	scanned := newMultiset()
+	for snapshot.Len() > 0 {
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], snapshot.Next(chainhash.HashSize))
+		outpoint.Index = byteOrder.Uint32(snapshot.Next(4))
+		headerCode := byteOrder.Uint32(snapshot.Next(4))
+		amount := int64(byteOrder.Uint64(snapshot.Next(8)))
+		pkScript, err := wire.ReadVarBytes(&snapshot, 0,
+			wire.MaxMessagePayload, "pkScript")
+		if err != nil {
+			t.Fatalf("unable to read snapshot entry: %v", err)
+		}
+		scanned.add(&outpoint, amount, pkScript, int32(headerCode>>1),
+			headerCode&0x01 == 0x01)
+	}
+	want.ECMH = scanned.hash()
+
+	stats, err := idx.CoinStats()
+	if err != nil {
+		t.Fatalf("CoinStats: unexpected error: %v", err)
+	}
+	if *stats != want {
+		t.Fatalf("block %d: unexpected coin stats -- got %+v, want %+v",
+			want.Height, *stats, want)
+	}
+}
+
+// spendTx returns a transaction which spends the anyone-can-spend outputs
+// identified by the passed outpoints to outputs with the passed amounts and a
+// provably unspendable output.
+func spendTx(outpoints []wire.OutPoint, amounts ...int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range outpoints {
+		tx.AddTxIn(wire.NewTxIn(&outpoints[i], nil, nil))
+	}
+	for i, amount := range amounts {
+		script := bytes.Repeat([]byte{txscript.OP_TRUE}, i+1)
+		tx.AddTxOut(wire.NewTxOut(amount, script))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// addTxns returns a munger which adds the passed transactions to a block.
+func addTxns(txns ...*wire.MsgTx) blockchain.BlockMunger {
+	return func(block *wire.MsgBlock) {
+		for _, tx := range txns {
+			block.AddTransaction(tx)
+		}
+	}
+}
+
+// TestMultiset ensures the multiset hash is independent of the order outputs
+// are added in and that removing all outputs results in the empty set.
+func TestMultiset(t *testing.T) {
+	outpoints := []wire.OutPoint{{Index: 0}, {Index: 1}, {Index: 2}}
+	script := []byte{txscript.OP_TRUE}
+
+	forwards, backwards := newMultiset(), newMultiset()
+	for i := range outpoints {
+		forwards.add(&outpoints[i], 1000, script, 1, false)
+		backwards.add(&outpoints[len(outpoints)-1-i], 1000, script, 1,
+			false)
+	}
+	if forwards.hash() != backwards.hash() {
+		t.Fatalf("multiset hash depends on the order outputs are added")
+	}
+
+	// The same output with different details must change the hash.
+	coinbase := newMultiset()
+	coinbase.add(&outpoints[0], 1000, script, 1, true)
+	other := newMultiset()
+	other.add(&outpoints[0], 1000, script, 1, false)
+	if coinbase.hash() == other.hash() {
+		t.Fatalf("multiset hash does not commit to the coinbase flag")
+	}
+
+	empty := newMultiset().hash()
+	for i := range outpoints {
+		forwards.remove(&outpoints[i], 1000, script, 1, false)
+	}
+	if forwards.hash() != empty {
+		t.Fatalf("multiset is not empty after removing all outputs")
+	}
+}
+
+// TestCoinStatsIndex ensures the statistics maintained by the coin stats index
+// match a full scan of the utxo set of the chain as blocks are connected and
+// disconnected by a reorganization.
+func TestCoinStatsIndex(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	// Allow coinbase outputs to be spent by the next block to keep the
+	// chain short.
+	params := chaincfg.SimNetParams
+	params.CoinbaseMaturity = 1
+	idx := NewCoinStatsIndex(db)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:           db,
+		ChainParams:  &params,
+		TimeSource:   blockchain.NewMedianTime(),
+		IndexManager: NewManager(db, []Indexer{idx}),
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	checkCoinStats(t, idx, chain)
+
+	harness, err := blockchain.NewSimHarness(chain)
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	acceptBlock := func(mungers ...blockchain.BlockMunger) *wire.MsgBlock {
+		t.Helper()
+		block, err := harness.NextBlock(mungers...)
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		if err := harness.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		checkCoinStats(t, idx, chain)
+		return block
+	}
+	coinbaseOut := func(block *wire.MsgBlock) wire.OutPoint {
+		return wire.OutPoint{Hash: block.Transactions[0].TxHash()}
+	}
+
+	// Create a chain where later blocks spend outputs of earlier ones,
+	// create provably unspendable outputs, and spend outputs created in
+	// the same block.
+	var blocks []*wire.MsgBlock
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, acceptBlock())
+	}
+	splitTx := spendTx([]wire.OutPoint{coinbaseOut(blocks[0])}, 1000, 2000)
+	blocks = append(blocks, acceptBlock(addTxns(splitTx)))
+
+	parentTx := spendTx([]wire.OutPoint{{Hash: splitTx.TxHash(), Index: 1}},
+		1500)
+	childTx := spendTx([]wire.OutPoint{
+		{Hash: parentTx.TxHash()}, coinbaseOut(blocks[1]),
+	}, 1200)
+	acceptBlock(addTxns(parentTx, childTx))
+
+	// Reorganize to a longer chain which forks after the third block and
+	// spends the outputs differently, which disconnects the last two
+	// blocks.
+	forkParent := blocks[2].BlockHash()
+	forkTxns := [][]*wire.MsgTx{
+		{spendTx([]wire.OutPoint{coinbaseOut(blocks[0])}, 3000)},
+		{spendTx([]wire.OutPoint{coinbaseOut(blocks[2])}, 4000, 5000)},
+		nil,
+	}
+	for i, txns := range forkTxns {
+		height := int32(len(blocks) + i)
+		block, err := harness.NextBlock(addTxns(txns...),
+			func(block *wire.MsgBlock) {
+				block.Header.PrevBlock = forkParent
+				script, err := txscript.NewScriptBuilder().
+					AddInt64(int64(height)).AddInt64(1).
+					Script()
+				if err != nil {
+					t.Fatalf("unable to create coinbase "+
+						"script: %v", err)
+				}
+				block.Transactions[0].TxIn[0].SignatureScript = script
+			})
+		if err != nil {
+			t.Fatalf("unable to create fork block: %v", err)
+		}
+		_, _, err = chain.ProcessBlock(btcutil.NewBlock(block),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("fork block %d rejected: %v", height, err)
+		}
+		forkParent = block.BlockHash()
+	}
+	if best := chain.BestSnapshot(); best.Hash != forkParent {
+		t.Fatalf("chain did not reorganize to the fork -- best block "+
+			"is %v, want %v", best.Hash, forkParent)
+	}
+	checkCoinStats(t, idx, chain)
+}
+
+// TestCoinStatsIndexBIP30Repeat ensures the outputs of a coinbase which
+// duplicates an earlier one replace the outputs of the earlier one.
+func TestCoinStatsIndexBIP30Repeat(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	idx := NewCoinStatsIndex(db)
+	createTestManager(t, db, []Indexer{idx})
+
+	// Create a block which repeats the coinbase of the second block and
+	// treat it like the main network blocks which did.
+	blocks := makeTestChain(3)
+	repeat := makeTestBlock(blocks[2])
+	repeatMsg := repeat.MsgBlock()
+	repeatMsg.Transactions[0] = blocks[1].MsgBlock().Transactions[0]
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(repeatMsg).Transactions(), false)
+	repeatMsg.Header.MerkleRoot = *merkles[len(merkles)-1]
+	repeat = btcutil.NewBlock(repeatMsg)
+	repeat.SetHeight(3)
+	blocks = append(blocks, repeat)
+
+	bip30RepeatBlocks[*repeat.Hash()] = 1
+	defer delete(bip30RepeatBlocks, *repeat.Hash())
+
+	for _, block := range blocks {
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbIndexConnectBlock(dbTx, idx, block, nil)
+		})
+		if err != nil {
+			t.Fatalf("dbIndexConnectBlock: unexpected error: %v", err)
+		}
+	}
+
+	// Only the coinbase of the third block and the repeated coinbase as of
+	// the height of the repeating block remain.
+	want := CoinStats{Height: 3, Hash: *repeat.Hash()}
+	set := newMultiset()
+	for _, block := range blocks[2:] {
+		coinbase := block.Transactions()[0]
+		txOut := coinbase.MsgTx().TxOut[0]
+		set.add(wire.NewOutPoint(coinbase.Hash(), 0), txOut.Value,
+			txOut.PkScript, block.Height(), true)
+		want.Outputs++
+		want.TotalAmount += txOut.Value
+		want.BogoSize += int64(coinStatsBogoSizeOverhead +
+			len(txOut.PkScript))
+	}
+	want.ECMH = set.hash()
+
+	stats, err := idx.CoinStats()
+	if err != nil {
+		t.Fatalf("CoinStats: unexpected error: %v", err)
+	}
+	if *stats != want {
+		t.Fatalf("unexpected coin stats -- got %+v, want %+v", *stats,
+			want)
+	}
+}
@@ -32,6 +32,19 @@ type NeedsInputser interface {
 	NeedsInputs() bool
 }
 
+// BulkConnecter provides an optional interface for an indexer to connect
+// several consecutive blocks at once.  The index manager makes use of it while
+// catching up the indexes in order to index many blocks in a single database
+// transaction.  Indexers that do not implement it have each of the blocks
+// connected individually via ConnectBlock instead.
+type BulkConnecter interface {
+	// BulkConnect is invoked with consecutive blocks which extend the main
+	// chain in order along with the set of outputs spent by each of them.
+	// The spent outputs are only provided to indexers which require them
+	// as indicated by the NeedsInputser interface.
+	BulkConnect(database.Tx, []*btcutil.Block, [][]blockchain.SpentTxOut) error
+}
+
 // Indexer provides a generic interface for an indexer that is managed by an
 // index manager such as the Manager type provided by this package.
 type Indexer interface {
@@ -7,6 +7,7 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -94,6 +95,59 @@ func dbIndexConnectBlock(dbTx database.Tx, indexer Indexer, block *btcutil.Block
 	return dbPutIndexerTip(dbTx, idxKey, block.Hash(), block.Height())
 }
 
+// dbIndexBulkConnectBlocks adds all of the index entries associated with the
+// given consecutive blocks using the provided indexer and updates the tip of
+// the indexer to the final block accordingly.  An error will be returned if
+// the current tip for the indexer is not the previous block for the first of
+// the passed blocks or if the blocks do not extend one another.
+func dbIndexBulkConnectBlocks(dbTx database.Tx, indexer Indexer,
+	blocks []*btcutil.Block, stxos [][]blockchain.SpentTxOut) error {
+
+	// Assert that the blocks being connected properly connect to the
+	// current tip of the index and to each other.
+	idxKey := indexer.Key()
+	curTipHash, _, err := dbFetchIndexerTip(dbTx, idxKey)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if !curTipHash.IsEqual(&block.MsgBlock().Header.PrevBlock) {
+			return AssertError(fmt.Sprintf("dbIndexBulkConnectBlocks "+
+				"must be called with blocks that extend the "+
+				"current index tip (%s, tip %s, block %s)",
+				indexer.Name(), curTipHash, block.Hash()))
+		}
+		curTipHash = block.Hash()
+	}
+
+	// Notify the indexer with the connected blocks so it can index them.
+	if err := bulkConnect(dbTx, indexer, blocks, stxos); err != nil {
+		return err
+	}
+
+	// Update the current index tip.
+	tip := blocks[len(blocks)-1]
+	return dbPutIndexerTip(dbTx, idxKey, tip.Hash(), tip.Height())
+}
+
+// bulkConnect connects the passed consecutive blocks to the passed indexer.
+// Indexers which implement the BulkConnecter interface are passed all of the
+// blocks at once while the blocks are connected one at a time for the others.
+func bulkConnect(dbTx database.Tx, indexer Indexer, blocks []*btcutil.Block,
+	stxos [][]blockchain.SpentTxOut) error {
+
+	if idx, ok := indexer.(BulkConnecter); ok {
+		return idx.BulkConnect(dbTx, blocks, stxos)
+	}
+
+	for i, block := range blocks {
+		if err := indexer.ConnectBlock(dbTx, block, stxos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // dbIndexDisconnectBlock removes all of the index entries associated with the
 // given block using the provided indexer and updates the tip of the indexer
 // accordingly.  An error will be returned if the current tip for the indexer is
@@ -126,12 +180,93 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer Indexer, block *btcutil.Bl
 	return dbPutIndexerTip(dbTx, idxKey, prevHash, block.Height()-1)
 }
 
+// IndexStatus describes the sync state of an index managed by the index
+// manager.
+type IndexStatus struct {
+	// Hash and Height identify the most recent block that has been indexed.
+	// A height of -1 indicates the index does not have any entries yet.
+	Hash   chainhash.Hash
+	Height int32
+
+	// CatchingUp indicates whether or not the index is behind the best
+	// chain and currently in the process of being caught up to it.
+	CatchingUp bool
+}
+
+const (
+	// defaultCatchUpBatchSize is the maximum number of blocks that are
+	// connected to the indexes in a single database transaction while the
+	// indexes are being caught up to the best chain.
+	defaultCatchUpBatchSize = 500
+
+	// maxCatchUpBatchBytes is the maximum total serialized size of the
+	// blocks in a single catch up batch.  It keeps the memory used while
+	// catching up bounded regardless of the size of the blocks.
+	maxCatchUpBatchBytes = 64 * 1024 * 1024
+)
+
+// defaultCatchUpInterval is the number of blocks between each progress report
+// while the indexes are being caught up to the best chain.
+const defaultCatchUpInterval = 5000
+
+// CatchUpProgress describes the progress of an index while it is being caught
+// up to the best chain.
+type CatchUpProgress struct {
+	// Index is the human-readable name of the index.
+	Index string
+
+	// Height is the height of the most recent block connected to the
+	// index and TargetHeight is the height it is being caught up to.
+	Height       int32
+	TargetHeight int32
+
+	// Percent is the percentage of the chain up to TargetHeight that has
+	// been indexed.
+	Percent float64
+}
+
+// CatchUpCallback is used for a caller to receive the progress of the indexes
+// while they are being caught up to the best chain.
+type CatchUpCallback func(*CatchUpProgress)
+
+// catchUpChain describes the block chain functionality required to catch up
+// the indexes.  It is satisfied by blockchain.BlockChain and primarily exists
+// to make the catch up code easier to test.
+type catchUpChain interface {
+	BlockByHeight(height int32) (*btcutil.Block, error)
+	FetchSpendJournal(block *btcutil.Block) ([]blockchain.SpentTxOut, error)
+}
+
+// initChain describes the block chain functionality required to reconcile the
+// indexes with the main chain during initialization.  It is satisfied by
+// blockchain.BlockChain and primarily exists to make the initialization code
+// easier to test.
+type initChain interface {
+	catchUpChain
+	MainChainHasBlock(hash *chainhash.Hash) bool
+	BestSnapshot() *blockchain.BestState
+}
+
 // Manager defines an index manager that manages multiple optional indexes and
 // implements the blockchain.IndexManager interface so it can be seamlessly
 // plugged into normal chain processing.
 type Manager struct {
 	db             database.DB
 	enabledIndexes []Indexer
+
+	// catchUpHeight is the height the indexes are being caught up to while
+	// the catch-up process in Init is running.  It is -1 otherwise.
+	catchUpMtx    sync.RWMutex
+	catchUpHeight int32
+
+	// catchUpInterval is the number of blocks between each progress
+	// report sent to catchUpCallbacks during the catch-up process.
+	catchUpInterval  int32
+	catchUpCallbacks []CatchUpCallback
+
+	// catchUpBatchSize is the maximum number of blocks connected to the
+	// indexes per database transaction during the catch-up process.
+	catchUpBatchSize int
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -232,8 +367,20 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 // time new blocks are being downloaded would lead to an overall longer time to
 // catch up due to the I/O contention.
 //
+// The tip of an index does not necessarily match the best chain tip when the
+// process was not shut down cleanly or the index was disabled for a while.
+// Indexes that are ahead of the main chain, which means their tip is not part
+// of it, are rolled back to the main chain first and all indexes that are
+// behind the best chain tip are then caught up to it.
+//
 // This is part of the blockchain.IndexManager interface.
 func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{}) error {
+	return m.init(chain, interrupt)
+}
+
+// init initializes the enabled indexes and reconciles them with the passed
+// chain.  See Init for details.
+func (m *Manager) init(chain initChain, interrupt <-chan struct{}) error {
 	// Nothing to do when no indexes are enabled.
 	if len(m.enabledIndexes) == 0 {
 		return nil
@@ -270,10 +417,11 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		}
 	}
 
-	// Rollback indexes to the main chain if their tip is an orphaned fork.
-	// This is fairly unlikely, but it can happen if the chain is
-	// reorganized while the index is disabled.  This has to be done in
-	// reverse order because later indexes can depend on earlier ones.
+	// Rollback indexes to the main chain if their tip is an orphaned fork
+	// or ahead of the best chain tip.  This is fairly unlikely, but it can
+	// happen if the chain is reorganized while the index is disabled.  This
+	// has to be done in reverse order because later indexes can depend on
+	// earlier ones.
 	for i := len(m.enabledIndexes); i > 0; i-- {
 		indexer := m.enabledIndexes[i-1]
 
@@ -321,10 +469,14 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			}
 
 			// We'll also grab the set of outputs spent by this
-			// block so we can remove them from the index.
-			spentTxos, err := chain.FetchSpendJournal(block)
-			if err != nil {
-				return err
+			// block so we can remove them from the index when the
+			// index requires them.
+			var spentTxos []blockchain.SpentTxOut
+			if indexNeedsInputs(indexer) {
+				spentTxos, err = chain.FetchSpendJournal(block)
+				if err != nil {
+					return err
+				}
 			}
 
 			// With the block and stxo set for that block retrieved,
@@ -394,68 +546,212 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		return nil
 	}
 
+	err = m.catchUp(chain, indexerHeights, lowestHeight, bestHeight,
+		interrupt)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Indexes caught up to height %d", bestHeight)
+	return nil
+}
+
+// catchUp connects the blocks after lowestHeight through bestHeight to each of
+// the enabled indexes whose tip, as given by indexerHeights, is behind the
+// block.  The blocks are connected in batches so that many of them are indexed
+// in a single database transaction.  Progress is logged and reported to the
+// subscribed catch up callbacks periodically along the way.
+func (m *Manager) catchUp(chain catchUpChain, indexerHeights []int32,
+	lowestHeight, bestHeight int32, interrupt <-chan struct{}) error {
+
+	// Determine the lowest tip height of the indexes that require the
+	// spent outputs of the blocks so they are only loaded when needed.
+	inputsHeight := bestHeight
+	for i, indexer := range m.enabledIndexes {
+		if indexNeedsInputs(indexer) && indexerHeights[i] < inputsHeight {
+			inputsHeight = indexerHeights[i]
+		}
+	}
+
 	// Create a progress logger for the indexing process below.
 	progressLogger := newBlockProgressLogger("Indexed", log)
 
 	// At this point, one or more indexes are behind the current best chain
 	// tip and need to be caught up, so log the details and loop through
-	// each block that needs to be indexed.
+	// each batch of blocks that needs to be indexed.
 	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
 		bestHeight)
-	for height := lowestHeight + 1; height <= bestHeight; height++ {
-		// Load the block for the height since it is required to index
-		// it.
-		block, err := chain.BlockByHeight(height)
-		if err != nil {
-			return err
-		}
-
-		if interruptRequested(interrupt) {
-			return errInterruptRequested
-		}
-
-		// Connect the block for all indexes that need it.
-		var spentTxos []blockchain.SpentTxOut
-		for i, indexer := range m.enabledIndexes {
-			// Skip indexes that don't need to be updated with this
-			// block.
-			if indexerHeights[i] >= height {
-				continue
+	m.setCatchUpHeight(bestHeight)
+	defer m.setCatchUpHeight(-1)
+	for height := lowestHeight + 1; height <= bestHeight; {
+		// Load the next batch of blocks along with the outputs they
+		// spend when any of the indexes that need them require it.
+		var blocks []*btcutil.Block
+		var stxos [][]blockchain.SpentTxOut
+		var batchBytes int
+		for ; height <= bestHeight && len(blocks) < m.catchUpBatchSize &&
+			batchBytes < maxCatchUpBatchBytes; height++ {
+
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				return err
 			}
 
-			// When the index requires all of the referenced txouts
-			// and they haven't been loaded yet, they need to be
-			// retrieved from the spend journal.
-			if spentTxos == nil && indexNeedsInputs(indexer) {
+			var spentTxos []blockchain.SpentTxOut
+			if height > inputsHeight {
 				spentTxos, err = chain.FetchSpendJournal(block)
 				if err != nil {
 					return err
 				}
 			}
 
+			blocks = append(blocks, block)
+			stxos = append(stxos, spentTxos)
+			batchBytes += block.MsgBlock().SerializeSize()
+
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+		}
+
+		// Connect the blocks in the batch for all indexes that need
+		// them.
+		batchStart := blocks[0].Height()
+		for i, indexer := range m.enabledIndexes {
+			// Skip the blocks the index already contains.
+			skip := int(indexerHeights[i] - batchStart + 1)
+			if skip < 0 {
+				skip = 0
+			}
+			if skip >= len(blocks) {
+				continue
+			}
+			idxBlocks, idxStxos := blocks[skip:], stxos[skip:]
+			if !indexNeedsInputs(indexer) {
+				idxStxos = make([][]blockchain.SpentTxOut,
+					len(idxBlocks))
+			}
+
 			err := m.db.Update(func(dbTx database.Tx) error {
-				return dbIndexConnectBlock(
-					dbTx, indexer, block, spentTxos,
+				return dbIndexBulkConnectBlocks(
+					dbTx, indexer, idxBlocks, idxStxos,
 				)
 			})
 			if err != nil {
 				return err
 			}
-			indexerHeights[i] = height
+
+			// Periodically report the progress of the index.
+			for _, block := range idxBlocks {
+				blockHeight := block.Height()
+				if blockHeight%m.catchUpInterval == 0 ||
+					blockHeight == bestHeight {
+
+					m.notifyCatchUp(indexer, blockHeight,
+						bestHeight)
+				}
+			}
+			indexerHeights[i] = idxBlocks[len(idxBlocks)-1].Height()
 		}
 
 		// Log indexing progress.
-		progressLogger.LogBlockHeight(block)
+		for _, block := range blocks {
+			progressLogger.LogBlockHeight(block)
+		}
 
 		if interruptRequested(interrupt) {
 			return errInterruptRequested
 		}
 	}
 
-	log.Infof("Indexes caught up to height %d", bestHeight)
 	return nil
 }
 
+// SubscribeCatchUp registers the passed callback to be invoked with the
+// progress of each index while the indexes are being caught up to the best
+// chain during Init.  The callback is invoked from the goroutine running the
+// catch up, so it must not block, although it may query the status of the
+// indexes with IndexStatus.
+//
+// This function is safe for concurrent access.
+func (m *Manager) SubscribeCatchUp(callback CatchUpCallback) {
+	m.catchUpMtx.Lock()
+	m.catchUpCallbacks = append(m.catchUpCallbacks, callback)
+	m.catchUpMtx.Unlock()
+}
+
+// notifyCatchUp logs the catch up progress of the passed index and sends it to
+// all of the subscribed catch up callbacks.
+func (m *Manager) notifyCatchUp(indexer Indexer, height, targetHeight int32) {
+	progress := &CatchUpProgress{
+		Index:        indexer.Name(),
+		Height:       height,
+		TargetHeight: targetHeight,
+	}
+	if targetHeight > 0 {
+		progress.Percent = float64(height) / float64(targetHeight) * 100
+	}
+	log.Infof("Catching up %s: height %d of %d (%.2f%%)", progress.Index,
+		height, targetHeight, progress.Percent)
+
+	// The callbacks are invoked without holding the lock so they are able
+	// to query the status of the indexes.
+	m.catchUpMtx.RLock()
+	callbacks := m.catchUpCallbacks
+	m.catchUpMtx.RUnlock()
+	for _, callback := range callbacks {
+		callback(progress)
+	}
+}
+
+// setCatchUpHeight sets the height the indexes are being caught up to.  A
+// height of -1 indicates no catch up is in progress.
+//
+// This function is safe for concurrent access.
+func (m *Manager) setCatchUpHeight(height int32) {
+	m.catchUpMtx.Lock()
+	m.catchUpHeight = height
+	m.catchUpMtx.Unlock()
+}
+
+// IndexStatus returns the current sync state of the passed index.  An error is
+// returned if the index is not enabled in the manager.
+//
+// This function is safe for concurrent access.
+func (m *Manager) IndexStatus(indexer Indexer) (*IndexStatus, error) {
+	idxKey := indexer.Key()
+	var enabled bool
+	for _, enabledIndexer := range m.enabledIndexes {
+		if bytes.Equal(enabledIndexer.Key(), idxKey) {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return nil, fmt.Errorf("%s is not enabled", indexer.Name())
+	}
+
+	var status IndexStatus
+	err := m.db.View(func(dbTx database.Tx) error {
+		hash, height, err := dbFetchIndexerTip(dbTx, idxKey)
+		if err != nil {
+			return err
+		}
+		status.Hash = *hash
+		status.Height = height
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.catchUpMtx.RLock()
+	status.CatchingUp = status.Height < m.catchUpHeight
+	m.catchUpMtx.RUnlock()
+
+	return &status, nil
+}
+
 // indexNeedsInputs returns whether or not the index needs access to the txouts
 // referenced by the transaction inputs being indexed.
 func indexNeedsInputs(index Indexer) bool {
@@ -533,14 +829,51 @@ func (m *Manager) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 	return nil
 }
 
+// DropIndexes drops all of the enabled indexes from the database so they are
+// rebuilt from the chain data by the catch up process the next time the
+// manager is initialized.  The indexes are dropped in the reverse order they
+// were enabled in so that indexes which depend on others are dropped first.
+// Since the address index relies on the block IDs assigned by the transaction
+// index, it is dropped along with the transaction index even when it is not
+// enabled.
+//
+// Each drop is resumable, so an interrupted drop is finished when the manager
+// is initialized.  This must be called before the manager is initialized.
+func (m *Manager) DropIndexes(interrupt <-chan struct{}) error {
+	for i := len(m.enabledIndexes) - 1; i >= 0; i-- {
+		indexer := m.enabledIndexes[i]
+		if bytes.Equal(indexer.Key(), txIndexKey) {
+			err := dropIndex(m.db, addrIndexKey, addrIndexName,
+				interrupt)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := dropIndex(m.db, indexer.Key(), indexer.Name(), interrupt)
+		if err != nil {
+			return err
+		}
+
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+
+	return nil
+}
+
 // NewManager returns a new index manager with the provided indexes enabled.
 //
 // The manager returned satisfies the blockchain.IndexManager interface and thus
 // cleanly plugs into the normal blockchain processing path.
 func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 	return &Manager{
-		db:             db,
-		enabledIndexes: enabledIndexes,
+		db:               db,
+		enabledIndexes:   enabledIndexes,
+		catchUpHeight:    -1,
+		catchUpInterval:  defaultCatchUpInterval,
+		catchUpBatchSize: defaultCatchUpBatchSize,
 	}
 }
 
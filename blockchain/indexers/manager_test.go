@@ -0,0 +1,618 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// mockIndexer provides a minimal indexer which keeps track of the blocks that
+// have been connected and disconnected by the index manager.
+type mockIndexer struct {
+	key          []byte
+	connected    []chainhash.Hash
+	disconnected []chainhash.Hash
+}
+
+// Ensure the mockIndexer type implements the Indexer interface.
+var _ Indexer = (*mockIndexer)(nil)
+
+func (idx *mockIndexer) Key() []byte                   { return idx.key }
+func (idx *mockIndexer) Name() string                  { return string(idx.key) }
+func (idx *mockIndexer) Create(dbTx database.Tx) error { return nil }
+func (idx *mockIndexer) Init() error                   { return nil }
+
+func (idx *mockIndexer) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	idx.connected = append(idx.connected, *block.Hash())
+	return nil
+}
+
+func (idx *mockIndexer) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	idx.disconnected = append(idx.disconnected, *block.Hash())
+	return nil
+}
+
+// testCatchUpChain provides a mock chain which serves a fixed set of blocks,
+// which make up its main chain, to the index manager catch up and
+// initialization code.
+type testCatchUpChain struct {
+	blocks []*btcutil.Block
+}
+
+// Ensure the testCatchUpChain type implements the initChain interface.
+var _ initChain = (*testCatchUpChain)(nil)
+
+func (c *testCatchUpChain) BlockByHeight(height int32) (*btcutil.Block, error) {
+	if height < 0 || int(height) >= len(c.blocks) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	return c.blocks[height], nil
+}
+
+func (c *testCatchUpChain) FetchSpendJournal(block *btcutil.Block) ([]blockchain.SpentTxOut, error) {
+	return nil, nil
+}
+
+func (c *testCatchUpChain) MainChainHasBlock(hash *chainhash.Hash) bool {
+	for _, block := range c.blocks {
+		if *block.Hash() == *hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *testCatchUpChain) BestSnapshot() *blockchain.BestState {
+	tip := c.blocks[len(c.blocks)-1]
+	return &blockchain.BestState{Hash: *tip.Hash(), Height: tip.Height()}
+}
+
+// createTestDB creates a new database in a temporary directory for use in the
+// tests.  The returned function closes the database and removes the directory.
+func createTestDB(t testing.TB) (database.DB, func()) {
+	t.Helper()
+
+	dbPath, err := ioutil.TempDir("", "indexerstest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+}
+
+// makeTestBlock returns a block which extends the passed block.  The block
+// contains a coinbase transaction paying to a script unique to the height of
+// the block, so every block hash is distinct, followed by the passed
+// transactions.
+func makeTestBlock(prev *btcutil.Block, txns ...*wire.MsgTx) *btcutil.Block {
+	height := prev.Height() + 1
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: []byte{0x51, byte(height), byte(height >> 8)},
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin,
+		[]byte{0x51, 0x01, byte(height)}))
+
+	msgBlock := wire.NewMsgBlock(wire.NewBlockHeader(1, prev.Hash(),
+		&chainhash.Hash{}, 0x207fffff, 0))
+	msgBlock.Header.Timestamp = prev.MsgBlock().Header.Timestamp.Add(
+		time.Minute)
+	msgBlock.AddTransaction(coinbase)
+	for _, tx := range txns {
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(msgBlock).Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(height)
+	return block
+}
+
+// makeTestChain returns a chain of numBlocks blocks starting with the simnet
+// genesis block.  Each block after the genesis block only contains a coinbase
+// transaction.
+func makeTestChain(numBlocks int) []*btcutil.Block {
+	genesis := btcutil.NewBlock(chaincfg.SimNetParams.GenesisBlock)
+	genesis.SetHeight(0)
+	blocks := []*btcutil.Block{genesis}
+	for len(blocks) < numBlocks {
+		blocks = append(blocks, makeTestBlock(blocks[len(blocks)-1]))
+	}
+	return blocks
+}
+
+// createTestManager returns an index manager for the passed indexes backed by
+// the provided database with the initial state for the indexes created.
+func createTestManager(t testing.TB, db database.DB, indexes []Indexer) *Manager {
+	t.Helper()
+
+	m := NewManager(db, indexes)
+	err := db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		_, err := meta.CreateBucketIfNotExists(indexTipsBucketName)
+		if err != nil {
+			return err
+		}
+		return m.maybeCreateIndexes(dbTx)
+	})
+	if err != nil {
+		t.Fatalf("unable to create indexes: %v", err)
+	}
+	for _, indexer := range indexes {
+		if err := indexer.Init(); err != nil {
+			t.Fatalf("unable to initialize %s: %v", indexer.Name(),
+				err)
+		}
+	}
+	return m
+}
+
+// TestManagerIndexStatus ensures the index manager reports the expected sync
+// state for an enabled index as blocks are connected and disconnected.
+func TestManagerIndexStatus(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	indexer := &mockIndexer{key: []byte("mockidx")}
+	m := createTestManager(t, db, []Indexer{indexer})
+
+	// A newly created index has no entries.
+	status, err := m.IndexStatus(indexer)
+	if err != nil {
+		t.Fatalf("IndexStatus: unexpected error: %v", err)
+	}
+	if status.Height != -1 {
+		t.Fatalf("IndexStatus: unexpected height -- got %d, want -1",
+			status.Height)
+	}
+
+	// Partially sync the index and ensure the reported tip matches.
+	blocks := makeTestChain(5)
+	for _, block := range blocks[:3] {
+		err := db.Update(func(dbTx database.Tx) error {
+			return m.ConnectBlock(dbTx, block, nil)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: unexpected error: %v", err)
+		}
+	}
+	m.setCatchUpHeight(blocks[len(blocks)-1].Height())
+	status, err = m.IndexStatus(indexer)
+	if err != nil {
+		t.Fatalf("IndexStatus: unexpected error: %v", err)
+	}
+	if status.Height != 2 || status.Hash != *blocks[2].Hash() {
+		t.Fatalf("IndexStatus: unexpected tip -- got %v (%d), want "+
+			"%v (%d)", status.Hash, status.Height, blocks[2].Hash(), 2)
+	}
+	if !status.CatchingUp {
+		t.Fatal("IndexStatus: index not reported as catching up")
+	}
+
+	// Disconnecting the tip must roll the reported tip back and no longer
+	// report the index as catching up once the catch up is done.
+	err = db.Update(func(dbTx database.Tx) error {
+		return m.DisconnectBlock(dbTx, blocks[2], nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+	}
+	m.setCatchUpHeight(-1)
+	status, err = m.IndexStatus(indexer)
+	if err != nil {
+		t.Fatalf("IndexStatus: unexpected error: %v", err)
+	}
+	if status.Height != 1 || status.CatchingUp {
+		t.Fatalf("IndexStatus: unexpected status -- got height %d, "+
+			"catching up %v", status.Height, status.CatchingUp)
+	}
+
+	// Indexes that are not enabled must return an error.
+	if _, err := m.IndexStatus(&mockIndexer{key: []byte("other")}); err == nil {
+		t.Fatal("IndexStatus: expected error for disabled index")
+	}
+}
+
+// TestManagerCatchUpProgress ensures the index manager periodically reports
+// the progress of the indexes while catching up a backlog of blocks.
+func TestManagerCatchUpProgress(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	indexer := &mockIndexer{key: []byte("mockidx")}
+	m := createTestManager(t, db, []Indexer{indexer})
+	m.catchUpInterval = 3
+
+	var progress []CatchUpProgress
+	m.SubscribeCatchUp(func(p *CatchUpProgress) {
+		progress = append(progress, *p)
+	})
+
+	// Catch up the index from an empty state through a backlog of blocks.
+	chain := &testCatchUpChain{blocks: makeTestChain(8)}
+	err := m.catchUp(chain, []int32{-1}, -1, 7, nil)
+	if err != nil {
+		t.Fatalf("catchUp: unexpected error: %v", err)
+	}
+	if len(indexer.connected) != len(chain.blocks) {
+		t.Fatalf("catchUp: unexpected number of connected blocks -- "+
+			"got %d, want %d", len(indexer.connected), len(chain.blocks))
+	}
+
+	// The progress is expected to be reported at every multiple of the
+	// interval as well as once the target height is reached.
+	want := []CatchUpProgress{
+		{Index: "mockidx", Height: 0, TargetHeight: 7, Percent: 0},
+		{Index: "mockidx", Height: 3, TargetHeight: 7, Percent: 300.0 / 7},
+		{Index: "mockidx", Height: 6, TargetHeight: 7, Percent: 600.0 / 7},
+		{Index: "mockidx", Height: 7, TargetHeight: 7, Percent: 100},
+	}
+	if !reflect.DeepEqual(progress, want) {
+		t.Fatalf("catchUp: unexpected progress -- got %+v, want %+v",
+			progress, want)
+	}
+
+	// The index must no longer be reported as catching up once done.
+	status, err := m.IndexStatus(indexer)
+	if err != nil {
+		t.Fatalf("IndexStatus: unexpected error: %v", err)
+	}
+	if status.Height != 7 || status.CatchingUp {
+		t.Fatalf("IndexStatus: unexpected status -- got height %d, "+
+			"catching up %v", status.Height, status.CatchingUp)
+	}
+}
+
+// dumpBucket returns all of the key/value pairs in the passed bucket and all
+// of its nested buckets keyed by their full path.
+func dumpBucket(bucket database.Bucket, prefix string, entries map[string]string) error {
+	err := bucket.ForEach(func(k, v []byte) error {
+		if v != nil {
+			entries[prefix+string(k)] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bucket.ForEachBucket(func(k []byte) error {
+		return dumpBucket(bucket.Bucket(k), prefix+string(k)+"/",
+			entries)
+	})
+}
+
+// catchUpTestIndexes returns the indexes used to test the catch up process.
+func catchUpTestIndexes(db database.DB) []Indexer {
+	return []Indexer{
+		NewTxIndex(db),
+		NewCfIndex(db, &chaincfg.SimNetParams, nil),
+		&mockIndexer{key: []byte("mockidx")},
+	}
+}
+
+// TestManagerBulkConnect ensures the indexes end up with identical state when
+// blocks are connected to them in bulk during catch up as when each block is
+// connected individually.
+func TestManagerBulkConnect(t *testing.T) {
+	blocks := makeTestChain(20)
+	chain := &testCatchUpChain{blocks: blocks}
+	bestHeight := blocks[len(blocks)-1].Height()
+
+	var states []map[string]string
+	for _, batchSize := range []int{1, 7, defaultCatchUpBatchSize} {
+		db, teardown := createTestDB(t)
+
+		indexes := catchUpTestIndexes(db)
+		m := createTestManager(t, db, indexes)
+		m.catchUpBatchSize = batchSize
+
+		// Start with the indexes at different heights to ensure each
+		// of them only has the missing blocks connected.
+		indexerHeights := []int32{-1, 4, 11}
+		for i, indexer := range indexes {
+			for _, block := range blocks[:indexerHeights[i]+1] {
+				err := db.Update(func(dbTx database.Tx) error {
+					return dbIndexConnectBlock(dbTx, indexer,
+						block, nil)
+				})
+				if err != nil {
+					t.Fatalf("dbIndexConnectBlock: unexpected "+
+						"error: %v", err)
+				}
+			}
+		}
+
+		err := m.catchUp(chain, indexerHeights, -1, bestHeight, nil)
+		if err != nil {
+			t.Fatalf("catchUp (batch size %d): unexpected error: %v",
+				batchSize, err)
+		}
+
+		state := make(map[string]string)
+		err = db.View(func(dbTx database.Tx) error {
+			return dumpBucket(dbTx.Metadata(), "", state)
+		})
+		if err != nil {
+			t.Fatalf("unable to dump database: %v", err)
+		}
+		states = append(states, state)
+
+		mock := indexes[2].(*mockIndexer)
+		if len(mock.connected) != len(blocks) {
+			t.Fatalf("catchUp (batch size %d): unexpected number of "+
+				"connected blocks -- got %d, want %d", batchSize,
+				len(mock.connected), len(blocks))
+		}
+		teardown()
+	}
+
+	for i := 1; i < len(states); i++ {
+		if !reflect.DeepEqual(states[0], states[i]) {
+			t.Fatalf("catchUp: index state with bulk connect #%d "+
+				"does not match the per-block state", i)
+		}
+	}
+}
+
+// TestManagerInitReconcile ensures indexes whose tip is behind or ahead of the
+// best chain tip are reconciled with the main chain when the index manager is
+// initialized.
+func TestManagerInitReconcile(t *testing.T) {
+	blocks := makeTestChain(6)
+	chain := &testCatchUpChain{blocks: blocks[:5]}
+	bestHeight := chain.BestSnapshot().Height
+
+	// indexState returns the tip and the entries of the cf index in the
+	// passed database.
+	indexState := func(db database.DB) (int32, map[string]string) {
+		var height int32
+		state := make(map[string]string)
+		err := db.View(func(dbTx database.Tx) error {
+			var err error
+			_, height, err = dbFetchIndexerTip(dbTx,
+				cfIndexParentBucketKey)
+			if err != nil {
+				return err
+			}
+			bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey)
+			return dumpBucket(bucket, "", state)
+		})
+		if err != nil {
+			t.Fatalf("unable to dump database: %v", err)
+		}
+		return height, state
+	}
+
+	var wantState map[string]string
+	for _, indexedHeight := range []int32{bestHeight, bestHeight - 1,
+		bestHeight + 1} {
+
+		db, teardown := createTestDB(t)
+		idx := NewCfIndex(db, &chaincfg.SimNetParams, nil)
+		m := createTestManager(t, db, []Indexer{idx})
+
+		// Index the blocks up to the desired height.  Blocks that are
+		// ahead of the best chain tip have to be in the database for
+		// them to be rolled back.
+		for _, block := range blocks[:indexedHeight+1] {
+			err := db.Update(func(dbTx database.Tx) error {
+				if block.Height() > bestHeight {
+					err := dbTx.StoreBlock(block)
+					if err != nil {
+						return err
+					}
+				}
+				return dbIndexConnectBlock(dbTx, idx, block, nil)
+			})
+			if err != nil {
+				teardown()
+				t.Fatalf("dbIndexConnectBlock: unexpected error: %v",
+					err)
+			}
+		}
+
+		if err := m.init(chain, nil); err != nil {
+			teardown()
+			t.Fatalf("init (indexed height %d): unexpected error: %v",
+				indexedHeight, err)
+		}
+		height, state := indexState(db)
+		teardown()
+
+		// The index which was in sync with the chain serves as the
+		// reference for the others.
+		if height != bestHeight {
+			t.Fatalf("init (indexed height %d): unexpected tip height "+
+				"-- got %d, want %d", indexedHeight, height,
+				bestHeight)
+		}
+		if wantState == nil {
+			wantState = state
+		}
+		if !reflect.DeepEqual(state, wantState) {
+			t.Fatalf("init (indexed height %d): index state does not "+
+				"match the one of an index in sync with the chain",
+				indexedHeight)
+		}
+	}
+}
+
+// TestManagerDropIndexes ensures all enabled indexes are rebuilt so they are
+// consistent with the chain when they are dropped prior to initializing the
+// index manager, even when one of them is corrupt.
+func TestManagerDropIndexes(t *testing.T) {
+	// Create a chain whose coinbases pay to a distinct public key hash in
+	// every block so the address index has entries for all of them.
+	genesis := btcutil.NewBlock(chaincfg.SimNetParams.GenesisBlock)
+	genesis.SetHeight(0)
+	blocks := []*btcutil.Block{genesis}
+	for len(blocks) < 10 {
+		msgBlock := makeTestBlock(blocks[len(blocks)-1]).MsgBlock()
+		pkScript := make([]byte, 25)
+		copy(pkScript, []byte{0x76, 0xa9, 0x14})
+		pkScript[3] = byte(len(blocks))
+		copy(pkScript[23:], []byte{0x88, 0xac})
+		msgBlock.Transactions[0].TxOut[0].PkScript = pkScript
+		merkles := blockchain.BuildMerkleTreeStore(
+			btcutil.NewBlock(msgBlock).Transactions(), false)
+		msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(int32(len(blocks)))
+		blocks = append(blocks, block)
+	}
+	chain := &testCatchUpChain{blocks: blocks}
+
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	reindexTestIndexes := func() []Indexer {
+		return []Indexer{
+			NewTxIndex(db),
+			NewAddrIndex(db, &chaincfg.SimNetParams),
+			NewCfIndex(db, &chaincfg.SimNetParams, nil),
+		}
+	}
+	dumpState := func() map[string]string {
+		state := make(map[string]string)
+		err := db.View(func(dbTx database.Tx) error {
+			return dumpBucket(dbTx.Metadata(), "", state)
+		})
+		if err != nil {
+			t.Fatalf("unable to dump database: %v", err)
+		}
+		return state
+	}
+
+	// Build the indexes from scratch to serve as the reference.
+	m := NewManager(db, reindexTestIndexes())
+	if err := m.init(chain, nil); err != nil {
+		t.Fatalf("init: unexpected error: %v", err)
+	}
+	wantState := dumpState()
+
+	// Corrupt the transaction index by replacing all of its entries.
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(txIndexKey)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := bucket.Put(key, []byte{0xff}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt the transaction index: %v", err)
+	}
+	if reflect.DeepEqual(dumpState(), wantState) {
+		t.Fatal("corrupting the transaction index did not change it")
+	}
+
+	// Drop and rebuild the indexes as if the node was restarted with them
+	// to be rebuilt and ensure they match the reference again.
+	m = NewManager(db, reindexTestIndexes())
+	if err := m.DropIndexes(nil); err != nil {
+		t.Fatalf("DropIndexes: unexpected error: %v", err)
+	}
+	if err := m.init(chain, nil); err != nil {
+		t.Fatalf("init: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dumpState(), wantState) {
+		t.Fatal("rebuilt indexes do not match the indexes built from " +
+			"scratch")
+	}
+	for _, indexer := range m.enabledIndexes {
+		status, err := m.IndexStatus(indexer)
+		if err != nil {
+			t.Fatalf("IndexStatus: unexpected error: %v", err)
+		}
+		if status.Height != chain.BestSnapshot().Height {
+			t.Fatalf("unexpected %s tip height -- got %d, want %d",
+				indexer.Name(), status.Height,
+				chain.BestSnapshot().Height)
+		}
+	}
+}
+
+// BenchmarkManagerCatchUp benchmarks catching up the indexes with each block
+// connected in its own database transaction versus in bulk.
+func BenchmarkManagerCatchUp(b *testing.B) {
+	blocks := makeTestChain(1000)
+	chain := &testCatchUpChain{blocks: blocks}
+	bestHeight := blocks[len(blocks)-1].Height()
+
+	benchmarks := []struct {
+		name      string
+		batchSize int
+	}{
+		{name: "PerBlock", batchSize: 1},
+		{name: "Bulk", batchSize: defaultCatchUpBatchSize},
+	}
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db, teardown := createTestDB(b)
+				indexes := catchUpTestIndexes(db)
+				m := createTestManager(b, db, indexes)
+				m.catchUpBatchSize = bench.batchSize
+				indexerHeights := make([]int32, len(indexes))
+				for j := range indexerHeights {
+					indexerHeights[j] = -1
+				}
+				b.StartTimer()
+
+				err := m.catchUp(chain, indexerHeights, -1,
+					bestHeight, nil)
+				if err != nil {
+					b.Fatalf("catchUp: unexpected error: %v", err)
+				}
+
+				b.StopTimer()
+				teardown()
+				b.StartTimer()
+			}
+		})
+	}
+}
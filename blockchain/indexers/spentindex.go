@@ -0,0 +1,258 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// spentIndexName is the human-readable name for the index.
+	spentIndexName = "spent output index"
+
+	// outpointKeySize is the size of a serialized outpoint used as the key
+	// in the spent output index.
+	outpointKeySize = chainhash.HashSize + 4
+
+	// spentEntrySize is the size of a serialized spent output index entry.
+	spentEntrySize = chainhash.HashSize + 4 + 4
+)
+
+var (
+	// spentIndexKey is the key of the spent output index and the db bucket
+	// used to house it.
+	spentIndexKey = []byte("spendbyoutpointidx")
+)
+
+// -----------------------------------------------------------------------------
+// The spent output index consists of an entry for every transaction output
+// spent in the main chain which identifies the transaction input that spent
+// it.
+//
+// The serialized format for keys and values in the spent output index is:
+//   <outpoint> = <spending tx hash><input index><block height>
+//
+//   Field              Type              Size
+//   outpoint hash      chainhash.Hash    32 bytes
+//   outpoint index     uint32            4 bytes
+//   spending tx hash   chainhash.Hash    32 bytes
+//   input index        uint32            4 bytes
+//   block height       uint32            4 bytes
+//   -----
+//   Total: 36 bytes key, 40 bytes value
+// -----------------------------------------------------------------------------
+
+// SpentInfo identifies the transaction input that spent a transaction output
+// along with the height of the block that contains it.
+type SpentInfo struct {
+	TxHash     chainhash.Hash
+	InputIndex uint32
+	Height     int32
+}
+
+// outpointKey returns the key used to store the passed outpoint in the spent
+// output index.
+func outpointKey(outpoint *wire.OutPoint) []byte {
+	key := make([]byte, outpointKeySize)
+	copy(key, outpoint.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], outpoint.Index)
+	return key
+}
+
+// putSpentEntry serializes the provided spending details into the passed
+// target byte slice.  The target byte slice must be at least large enough to
+// handle the number of bytes defined by the spentEntrySize constant or it
+// will panic.
+func putSpentEntry(target []byte, txHash *chainhash.Hash, inputIndex uint32,
+	height int32) {
+
+	copy(target, txHash[:])
+	offset := chainhash.HashSize
+	byteOrder.PutUint32(target[offset:], inputIndex)
+	offset += 4
+	byteOrder.PutUint32(target[offset:], uint32(height))
+}
+
+// dbAddSpentIndexEntries uses an existing database transaction to add a spent
+// output index entry for every input of the transactions in the passed block.
+func dbAddSpentIndexEntries(dbTx database.Tx, block *btcutil.Block) error {
+	spentIndex := dbTx.Metadata().Bucket(spentIndexKey)
+	height := block.Height()
+	for _, tx := range block.Transactions() {
+		// Coinbase transactions do not spend any outputs.
+		if blockchain.IsCoinBase(tx) {
+			continue
+		}
+
+		for i, txIn := range tx.MsgTx().TxIn {
+			entry := make([]byte, spentEntrySize)
+			putSpentEntry(entry, tx.Hash(), uint32(i), height)
+			key := outpointKey(&txIn.PreviousOutPoint)
+			if err := spentIndex.Put(key, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// dbRemoveSpentIndexEntries uses an existing database transaction to remove
+// the spent output index entry for every input of the transactions in the
+// passed block.
+func dbRemoveSpentIndexEntries(dbTx database.Tx, block *btcutil.Block) error {
+	spentIndex := dbTx.Metadata().Bucket(spentIndexKey)
+	for _, tx := range block.Transactions() {
+		if blockchain.IsCoinBase(tx) {
+			continue
+		}
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			key := outpointKey(&txIn.PreviousOutPoint)
+			if spentIndex.Get(key) == nil {
+				return fmt.Errorf("can't remove non-existent "+
+					"spent output %v from the spent output "+
+					"index", txIn.PreviousOutPoint)
+			}
+			if err := spentIndex.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// dbFetchSpentIndexEntry uses an existing database transaction to fetch the
+// spending details for the provided outpoint from the spent output index.
+// When there is no entry for the provided outpoint, nil will be returned for
+// both the entry and the error.
+func dbFetchSpentIndexEntry(dbTx database.Tx, outpoint *wire.OutPoint) (*SpentInfo, error) {
+	spentIndex := dbTx.Metadata().Bucket(spentIndexKey)
+	serialized := spentIndex.Get(outpointKey(outpoint))
+	if len(serialized) == 0 {
+		return nil, nil
+	}
+
+	// Ensure the serialized data has enough bytes to properly deserialize.
+	if len(serialized) < spentEntrySize {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt spent output index "+
+				"entry for %v", outpoint),
+		}
+	}
+
+	var info SpentInfo
+	copy(info.TxHash[:], serialized[:chainhash.HashSize])
+	offset := chainhash.HashSize
+	info.InputIndex = byteOrder.Uint32(serialized[offset:])
+	offset += 4
+	info.Height = int32(byteOrder.Uint32(serialized[offset:]))
+	return &info, nil
+}
+
+// SpentIndex implements a spent transaction output index.  That is to say, it
+// supports querying the transaction input that spent any output in the main
+// chain.
+type SpentIndex struct {
+	db database.DB
+}
+
+// Ensure the SpentIndex type implements the Indexer interface.
+var _ Indexer = (*SpentIndex)(nil)
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Key() []byte {
+	return spentIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Name() string {
+	return spentIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the spent
+// output index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spentIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for every output
+// spent by the transactions in the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	return dbAddSpentIndexEntries(dbTx, block)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entry for every
+// output spent by the transactions in the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	return dbRemoveSpentIndexEntries(dbTx, block)
+}
+
+// SpentInfo returns the details of the transaction input in the main chain
+// that spent the provided outpoint.  When the outpoint has not been spent in
+// the main chain, nil will be returned for both the entry and the error.
+//
+// This function is safe for concurrent access.
+func (idx *SpentIndex) SpentInfo(outpoint *wire.OutPoint) (*SpentInfo, error) {
+	var info *SpentInfo
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		info, err = dbFetchSpentIndexEntry(dbTx, outpoint)
+		return err
+	})
+	return info, err
+}
+
+// NewSpentIndex returns a new instance of an indexer that is used to create a
+// mapping of every spent transaction output in the blockchain to the
+// transaction input that spent it.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSpentIndex(db database.DB) *SpentIndex {
+	return &SpentIndex{db: db}
+}
+
+// DropSpentIndex drops the spent output index from the provided database if it
+// exists.
+func DropSpentIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, spentIndexKey, spentIndexName, interrupt)
+}
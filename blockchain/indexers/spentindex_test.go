@@ -0,0 +1,101 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestSpentIndex ensures the spent output index tracks the inputs spending
+// outputs as blocks are connected and disconnected.
+func TestSpentIndex(t *testing.T) {
+	db, teardown := createTestDB(t)
+	defer teardown()
+
+	idx := NewSpentIndex(db)
+	createTestManager(t, db, []Indexer{idx})
+
+	// Create a chain where the final block contains a transaction which
+	// spends the second output of a transaction in an earlier block.
+	blocks := makeTestChain(2)
+	fundingTx := wire.NewMsgTx(wire.TxVersion)
+	fundingTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(
+		blocks[1].Transactions()[0].Hash(), 0), nil, nil))
+	fundingTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	fundingTx.AddTxOut(wire.NewTxOut(2000, []byte{0x51}))
+	blocks = append(blocks, makeTestBlock(blocks[1], fundingTx))
+
+	fundingHash := fundingTx.TxHash()
+	spendingTx := wire.NewMsgTx(wire.TxVersion)
+	spendingTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(
+		blocks[2].Transactions()[0].Hash(), 0), nil, nil))
+	spendingTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 1),
+		nil, nil))
+	spendingTx.AddTxOut(wire.NewTxOut(500, []byte{0x51}))
+	blocks = append(blocks, makeTestBlock(blocks[2], spendingTx))
+
+	for _, block := range blocks {
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbIndexConnectBlock(dbTx, idx, block, nil)
+		})
+		if err != nil {
+			t.Fatalf("dbIndexConnectBlock: unexpected error: %v", err)
+		}
+	}
+
+	// The spent output must refer to the spending input.
+	spentOutPoint := wire.NewOutPoint(&fundingHash, 1)
+	info, err := idx.SpentInfo(spentOutPoint)
+	if err != nil {
+		t.Fatalf("SpentInfo: unexpected error: %v", err)
+	}
+	if info == nil {
+		t.Fatalf("SpentInfo: no entry for spent output %v", spentOutPoint)
+	}
+	want := SpentInfo{TxHash: spendingTx.TxHash(), InputIndex: 1, Height: 3}
+	if *info != want {
+		t.Fatalf("SpentInfo: unexpected entry -- got %+v, want %+v",
+			*info, want)
+	}
+
+	// Unspent outputs must not have an entry.
+	unspentOutPoint := wire.NewOutPoint(&fundingHash, 0)
+	info, err = idx.SpentInfo(unspentOutPoint)
+	if err != nil {
+		t.Fatalf("SpentInfo: unexpected error: %v", err)
+	}
+	if info != nil {
+		t.Fatalf("SpentInfo: unexpected entry for unspent output %v: "+
+			"%+v", unspentOutPoint, *info)
+	}
+
+	// Disconnecting the spending block must remove the entries for the
+	// outputs it spent while leaving earlier entries intact.
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbIndexDisconnectBlock(dbTx, idx, blocks[3], nil)
+	})
+	if err != nil {
+		t.Fatalf("dbIndexDisconnectBlock: unexpected error: %v", err)
+	}
+	info, err = idx.SpentInfo(spentOutPoint)
+	if err != nil {
+		t.Fatalf("SpentInfo: unexpected error: %v", err)
+	}
+	if info != nil {
+		t.Fatalf("SpentInfo: entry for %v not removed on disconnect",
+			spentOutPoint)
+	}
+	info, err = idx.SpentInfo(&fundingTx.TxIn[0].PreviousOutPoint)
+	if err != nil {
+		t.Fatalf("SpentInfo: unexpected error: %v", err)
+	}
+	if info == nil || info.TxHash != fundingHash || info.Height != 2 {
+		t.Fatalf("SpentInfo: unexpected entry for funding input: %+v",
+			info)
+	}
+}
@@ -289,6 +289,9 @@ type TxIndex struct {
 // Ensure the TxIndex type implements the Indexer interface.
 var _ Indexer = (*TxIndex)(nil)
 
+// Ensure the TxIndex type implements the BulkConnecter interface.
+var _ BulkConnecter = (*TxIndex)(nil)
+
 // Init initializes the hash-based transaction index.  In particular, it finds
 // the highest used block ID and stores it for later use when connecting or
 // disconnecting blocks.
@@ -408,6 +411,31 @@ func (idx *TxIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 	return nil
 }
 
+// BulkConnect is invoked by the index manager to connect several consecutive
+// blocks to the main chain at once.  This indexer adds a hash-to-transaction
+// mapping for every transaction in each of the passed blocks.  The internal
+// block ID is only updated once all of the blocks have been indexed.
+//
+// This is part of the BulkConnecter interface.
+func (idx *TxIndex) BulkConnect(dbTx database.Tx, blocks []*btcutil.Block,
+	stxos [][]blockchain.SpentTxOut) error {
+
+	newBlockID := idx.curBlockID
+	for _, block := range blocks {
+		newBlockID++
+		err := dbAddTxIndexEntries(dbTx, block, newBlockID)
+		if err != nil {
+			return err
+		}
+		err = dbPutBlockIDIndexEntry(dbTx, block.Hash(), newBlockID)
+		if err != nil {
+			return err
+		}
+	}
+	idx.curBlockID = newBlockID
+	return nil
+}
+
 // DisconnectBlock is invoked by the index manager when a block has been
 // disconnected from the main chain.  This indexer removes the
 // hash-to-transaction mapping for every transaction in the block.
@@ -6,6 +6,9 @@ package blockchain
 
 import (
 	"fmt"
+	"runtime/debug"
+
+	"github.com/btcsuite/btcutil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -79,3 +82,76 @@ func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
 	}
 	b.notificationsLock.RUnlock()
 }
+
+// BlockHook is used for a caller to provide a callback which is invoked
+// synchronously each time a block is connected to or disconnected from the main
+// chain, after the changes have been committed to the database.
+//
+// The view only contains the utxo entries the block changed.  When the block is
+// connected, those are the outputs it created along with the outputs it spent,
+// which are marked spent.  When the block is disconnected, the outputs it
+// created are marked spent and the outputs it spent are restored.  The view is
+// shared by all hooks, so it must not be modified.
+//
+// The chain lock is not held while hooks run, so they may safely call back
+// into the chain, however the chain can not process any further blocks until
+// they return.
+type BlockHook func(block *btcutil.Block, view *UtxoViewpoint)
+
+// RegisterBlockConnectedHook registers a hook to be invoked each time a block
+// is connected to the main chain.  See the documentation on BlockHook for
+// details.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RegisterBlockConnectedHook(hook BlockHook) {
+	b.notificationsLock.Lock()
+	b.connectHooks = append(b.connectHooks, hook)
+	b.notificationsLock.Unlock()
+}
+
+// RegisterBlockDisconnectedHook registers a hook to be invoked each time a
+// block is disconnected from the main chain.  See the documentation on
+// BlockHook for details.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RegisterBlockDisconnectedHook(hook BlockHook) {
+	b.notificationsLock.Lock()
+	b.disconnectHooks = append(b.disconnectHooks, hook)
+	b.notificationsLock.Unlock()
+}
+
+// hasBlockHooks returns whether or not any hooks are registered for blocks
+// being connected or disconnected depending on the passed flag.
+func (b *BlockChain) hasBlockHooks(connect bool) bool {
+	b.notificationsLock.RLock()
+	defer b.notificationsLock.RUnlock()
+	if connect {
+		return len(b.connectHooks) > 0
+	}
+	return len(b.disconnectHooks) > 0
+}
+
+// runBlockHooks invokes the hooks registered for blocks being connected or
+// disconnected depending on the passed flag.  A panic in a hook is recovered
+// and logged so it can't take down the chain.
+func (b *BlockChain) runBlockHooks(connect bool, block *btcutil.Block, view *UtxoViewpoint) {
+	b.notificationsLock.RLock()
+	event, hooks := "disconnect", b.disconnectHooks
+	if connect {
+		event, hooks = "connect", b.connectHooks
+	}
+	b.notificationsLock.RUnlock()
+
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("Recovered from panic in block "+
+						"%s hook for block %v: %v\n%s", event,
+						block.Hash(), r, debug.Stack())
+				}
+			}()
+			hook(block, view)
+		}()
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
 )
 
 // TestNotifications ensures that notification callbacks are fired on events.
@@ -49,3 +52,112 @@ func TestNotifications(t *testing.T) {
 			"times, found %d", numSubscribers, notificationCount)
 	}
 }
+
+// TestBlockHooks ensures the block hooks are invoked with the changes to the
+// utxo set as blocks are connected and disconnected, including during a
+// reorganize, and that a panicking hook does not prevent the others from
+// running.
+func TestBlockHooks(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("blockhooks",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	type hookCall struct {
+		connect bool
+		hash    chainhash.Hash
+		view    *UtxoViewpoint
+	}
+	var calls []hookCall
+	recordHook := func(connect bool) BlockHook {
+		return func(block *btcutil.Block, view *UtxoViewpoint) {
+			calls = append(calls, hookCall{connect, *block.Hash(), view})
+		}
+	}
+	panicHook := func(block *btcutil.Block, view *UtxoViewpoint) {
+		panic("hook failure")
+	}
+	chain.RegisterBlockConnectedHook(panicHook)
+	chain.RegisterBlockConnectedHook(recordHook(true))
+	chain.RegisterBlockDisconnectedHook(panicHook)
+	chain.RegisterBlockDisconnectedHook(recordHook(false))
+
+	//   genesis -> b1 -> b2
+	//                \-> b2a -> b3a
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	t2 := newTestSpend(b1.Transactions[0], 0, 2)
+	b2 := newTestBlock(t, b1, 2, t2)
+	b2a := newTestBlock(t, b1, 2)
+	b3a := newTestBlock(t, b2a, 3)
+	for _, block := range []*wire.MsgBlock{b1, b2, b2a, b3a} {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.BlockHash(), err)
+		}
+	}
+
+	want := []struct {
+		connect bool
+		block   *wire.MsgBlock
+	}{
+		{true, b1},
+		{true, b2},
+		{false, b2},
+		{true, b2a},
+		{true, b3a},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("unexpected number of hook calls - got %d, want %d",
+			len(calls), len(want))
+	}
+	for i, call := range calls {
+		if call.connect != want[i].connect ||
+			call.hash != want[i].block.BlockHash() {
+
+			t.Fatalf("hook call %d: got connect %v for %v, want "+
+				"connect %v for %v", i, call.connect, call.hash,
+				want[i].connect, want[i].block.BlockHash())
+		}
+	}
+
+	// checkEntry ensures the passed view has an entry for the passed output
+	// with the expected spent state.
+	checkEntry := func(desc string, view *UtxoViewpoint, tx *wire.MsgTx, index uint32, wantSpent bool) {
+		t.Helper()
+		entry := view.LookupEntry(wire.OutPoint{Hash: tx.TxHash(),
+			Index: index})
+		if entry == nil {
+			t.Fatalf("%s: no entry for output %v:%d", desc,
+				tx.TxHash(), index)
+		}
+		if entry.IsSpent() != wantSpent {
+			t.Fatalf("%s: output %v:%d spent %v, want %v", desc,
+				tx.TxHash(), index, entry.IsSpent(), wantSpent)
+		}
+	}
+
+	// Connecting b2 spends the first coinbase output of b1 and creates the
+	// outputs of its transactions.
+	connectView := calls[1].view
+	checkEntry("connect b2", connectView, b1.Transactions[0], 0, true)
+	checkEntry("connect b2", connectView, b2.Transactions[0], 0, false)
+	checkEntry("connect b2", connectView, t2, 0, false)
+	checkEntry("connect b2", connectView, t2, 1, false)
+	if len(connectView.Entries()) != 5 {
+		t.Fatalf("connect b2: unexpected number of changed utxos - got "+
+			"%d, want 5", len(connectView.Entries()))
+	}
+
+	// Disconnecting b2 restores the output it spent and removes the ones
+	// it created.
+	disconnectView := calls[2].view
+	checkEntry("disconnect b2", disconnectView, b1.Transactions[0], 0, false)
+	checkEntry("disconnect b2", disconnectView, b2.Transactions[0], 0, true)
+	checkEntry("disconnect b2", disconnectView, t2, 0, true)
+	checkEntry("disconnect b2", disconnectView, t2, 1, true)
+}
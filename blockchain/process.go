@@ -10,6 +10,7 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -242,3 +243,49 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 
 	return isMainChain, false, nil
 }
+
+// ProcessBlockHeader is the main workhorse for handling insertion of new block
+// headers into the block index ahead of their blocks.  It performs the context
+// free and contextual header checks, and then adds a node for the header which
+// does not yet have any block data associated with it.  This allows decisions
+// which depend on the header chain, such as whether a block is an ancestor of
+// the assume valid block, to be made before the blocks are downloaded.
+//
+// The header must connect to a header or block already known to the block
+// index.  Headers which are already known are ignored.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	blockHash := header.BlockHash()
+	if b.index.LookupNode(&blockHash) != nil {
+		return nil
+	}
+
+	prevHash := &header.PrevBlock
+	prevNode := b.index.LookupNode(prevHash)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is unknown", prevHash)
+		return ruleError(ErrPreviousBlockUnknown, str)
+	} else if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid", prevHash)
+		return ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, flags)
+	if err != nil {
+		return err
+	}
+	err = b.checkBlockHeaderContext(header, prevNode, flags)
+	if err != nil {
+		return err
+	}
+
+	b.index.AddHeaderNode(newBlockNode(header, prevNode))
+	log.Tracef("Processed block header %v", blockHash)
+
+	return nil
+}
@@ -0,0 +1,400 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// snapshotBatchSize is the number of utxo snapshot entries which are written
+// to the database per transaction while a snapshot is loaded.
+const snapshotBatchSize = 50000
+
+var (
+	// snapshotUtxoSetBucketName is the name of the db bucket used to house
+	// the unspent transaction output set loaded from a utxo snapshot.
+	snapshotUtxoSetBucketName = []byte("snapshotutxoset")
+
+	// snapshotChainStateKeyName is the name of the db key used to store the
+	// state of the chainstate loaded from a utxo snapshot.
+	snapshotChainStateKeyName = []byte("snapshotchainstate")
+)
+
+// SnapshotChainState describes the chainstate built from a utxo snapshot.
+type SnapshotChainState struct {
+	// Height and Hash identify the block the snapshot was taken at.
+	Height int32
+	Hash   chainhash.Hash
+
+	// Coins is the number of unspent transaction outputs in the snapshot.
+	Coins int64
+}
+
+// serializeSnapshotChainState returns the serialization of the passed snapshot
+// chainstate.  This is data to be stored in the snapshot chainstate key of the
+// database.
+//
+// The serialized format is:
+//
+//	<block hash><block height><coins>
+//
+//	Field          Type             Size
+//	block hash     chainhash.Hash   chainhash.HashSize
+//	block height   uint32           4 bytes
+//	coins          uint64           8 bytes
+func serializeSnapshotChainState(state *SnapshotChainState) []byte {
+	serialized := make([]byte, chainhash.HashSize+12)
+	copy(serialized, state.Hash[:])
+	offset := chainhash.HashSize
+	byteOrder.PutUint32(serialized[offset:], uint32(state.Height))
+	byteOrder.PutUint64(serialized[offset+4:], uint64(state.Coins))
+	return serialized
+}
+
+// deserializeSnapshotChainState deserializes the passed serialized snapshot
+// chainstate.  This is data stored in the snapshot chainstate key of the
+// database.
+func deserializeSnapshotChainState(serialized []byte) (*SnapshotChainState, error) {
+	if len(serialized) != chainhash.HashSize+12 {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt snapshot chainstate",
+		}
+	}
+
+	state := &SnapshotChainState{}
+	copy(state.Hash[:], serialized)
+	offset := chainhash.HashSize
+	state.Height = int32(byteOrder.Uint32(serialized[offset:]))
+	state.Coins = int64(byteOrder.Uint64(serialized[offset+4:]))
+	return state, nil
+}
+
+// dbFetchSnapshotChainState uses an existing database transaction to fetch the
+// snapshot chainstate.  nil is returned when no snapshot has been loaded.
+func dbFetchSnapshotChainState(dbTx database.Tx) (*SnapshotChainState, error) {
+	serialized := dbTx.Metadata().Get(snapshotChainStateKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeSnapshotChainState(serialized)
+}
+
+// readUtxoSnapshotEntry reads a single entry of a utxo snapshot into the passed
+// outpoint and returns the unspent output.  The entries use the serialization
+// described by writeUtxoSetHashEntry.
+func readUtxoSnapshotEntry(r io.Reader, outpoint *wire.OutPoint) (*UtxoEntry, error) {
+	var buf [chainhash.HashSize + 16]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	pkScript, err := wire.ReadVarBytes(r, 0, txscript.MaxScriptSize,
+		"pkscript")
+	if err != nil {
+		return nil, err
+	}
+
+	copy(outpoint.Hash[:], buf[:chainhash.HashSize])
+	fields := buf[chainhash.HashSize:]
+	outpoint.Index = binary.LittleEndian.Uint32(fields[0:4])
+	headerCode := binary.LittleEndian.Uint32(fields[4:8])
+	amount := int64(binary.LittleEndian.Uint64(fields[8:16]))
+	if amount < 0 || amount > btcutil.MaxSatoshi {
+		return nil, fmt.Errorf("output %v has invalid amount %d",
+			outpoint, amount)
+	}
+
+	entry := &UtxoEntry{
+		amount:      amount,
+		pkScript:    pkScript,
+		blockHeight: int32(headerCode >> 1),
+	}
+	if headerCode&0x01 != 0 {
+		entry.packedFlags |= tfCoinBase
+	}
+	return entry, nil
+}
+
+// assumeUtxoSnapshot returns the known utxo snapshot taken at the block with
+// the passed hash or nil when there is none.
+func (b *BlockChain) assumeUtxoSnapshot(hash *chainhash.Hash) *chaincfg.AssumeUtxoSnapshot {
+	for i := range b.chainParams.AssumeUtxoSnapshots {
+		snapshot := &b.chainParams.AssumeUtxoSnapshots[i]
+		if snapshot.BlockHash.IsEqual(hash) {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// DumpUtxoSnapshot writes a utxo snapshot of the unspent transaction output set
+// as of the current best block to the passed writer using the format described
+// by LoadUtxoSnapshot and returns the statistics of the utxo set, including its
+// serialized hash, which is the commitment to the snapshot.  The utxo set is
+// streamed from a single database transaction, so it is not affected by blocks
+// which are connected in the mean time.  The dump is aborted with an error once
+// the interrupt channel is closed, which may be nil when the caller does not
+// want to abort it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer, interrupt <-chan struct{}) (*UtxoStats, error) {
+	// Write out the utxo cache so the utxo set in the database is for the
+	// current best block.
+	if err := b.FlushUtxoCache(); err != nil {
+		return nil, err
+	}
+
+	var stats *UtxoStats
+	err := b.db.View(func(dbTx database.Tx) error {
+		hash := dbFetchUtxoStateConsistency(dbTx)
+		if hash == nil {
+			return AssertError("utxo state consistency is not set")
+		}
+		node := b.index.LookupNode(hash)
+		if node == nil {
+			return AssertError(fmt.Sprintf("utxo set is consistent "+
+				"with unknown block %v", hash))
+		}
+
+		// The number of coins is part of the header of the snapshot,
+		// so the utxo set is scanned once before it is written.
+		var err error
+		stats, err = dbFetchUtxoStats(dbTx, true, interrupt)
+		if err != nil {
+			return err
+		}
+		stats.Height = node.height
+		stats.Hash = node.hash
+
+		var header [chainhash.HashSize + 8]byte
+		copy(header[:], node.hash[:])
+		binary.LittleEndian.PutUint64(header[chainhash.HashSize:],
+			uint64(stats.Outputs))
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		return dbForEachUtxoEntry(dbTx, interrupt, func(outpoint *wire.OutPoint,
+			entry *UtxoEntry, _ int) error {
+
+			return writeUtxoSetHashEntry(w, outpoint, entry)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// LoadUtxoSnapshot loads the utxo snapshot taken at the block with the passed
+// hash, such as one written by DumpUtxoSnapshot, from the passed reader and
+// installs it as a second chainstate next to the fully validated one.  The
+// snapshot must be one of the snapshots known by the chain parameters and its
+// contents must match their commitment, or it is rejected.
+//
+// The snapshot format is:
+//
+//	<block hash><coins><entry 1>...<entry n>
+//
+//	Field          Type             Size
+//	block hash     chainhash.Hash   chainhash.HashSize
+//	coins          uint64           8 bytes
+//	entry          see below        variable
+//
+// The entries use the serialization described by writeUtxoSetHashEntry and
+// must be sorted in the order of the keys of the utxo set in the database, so
+// the double sha256 of their concatenation is the serialized hash of the utxo
+// set.  All integers are encoded little endian.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.Reader, atHash *chainhash.Hash) error {
+	known := b.assumeUtxoSnapshot(atHash)
+	if known == nil {
+		return fmt.Errorf("no utxo snapshot is known for block %v", atHash)
+	}
+
+	// Only a single snapshot may be loaded at a time.
+	b.snapshotLoadLock.Lock()
+	defer b.snapshotLoadLock.Unlock()
+
+	b.chainLock.RLock()
+	loaded := b.snapshotState != nil
+	bestHeight := b.bestChain.Tip().height
+	node := b.index.LookupNode(atHash)
+	b.chainLock.RUnlock()
+	if loaded {
+		return fmt.Errorf("a utxo snapshot is already loaded")
+	}
+	if bestHeight >= known.Height {
+		return fmt.Errorf("the chain at height %d is not behind the utxo "+
+			"snapshot at height %d", bestHeight, known.Height)
+	}
+	if node != nil && node.height != known.Height {
+		return fmt.Errorf("block %v of the utxo snapshot has height %d "+
+			"instead of %d", atHash, node.height, known.Height)
+	}
+
+	// Read the header of the snapshot.
+	var header [chainhash.HashSize + 8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("unable to read utxo snapshot header: %v", err)
+	}
+	if !bytes.Equal(header[:chainhash.HashSize], atHash[:]) {
+		return fmt.Errorf("utxo snapshot is not for block %v", atHash)
+	}
+	numCoins := binary.LittleEndian.Uint64(header[chainhash.HashSize:])
+
+	// Remove any coins left behind by an interrupted load before writing
+	// the coins of the snapshot.  The coins are only used once the hash
+	// of the snapshot is known to match, so they are removed again on any
+	// failure.
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(snapshotUtxoSetBucketName)
+		if err != nil && !isDbBucketNotFoundErr(err) {
+			return err
+		}
+		_, err = meta.CreateBucket(snapshotUtxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	serializedHash, err := b.writeUtxoSnapshotCoins(r, known.Height, numCoins)
+	if err == nil && !serializedHash.IsEqual(known.SerializedHash) {
+		err = fmt.Errorf("utxo snapshot hash %v does not match the "+
+			"expected hash %v", serializedHash, known.SerializedHash)
+	}
+	if err != nil {
+		dbErr := b.db.Update(func(dbTx database.Tx) error {
+			return dbTx.Metadata().DeleteBucket(snapshotUtxoSetBucketName)
+		})
+		if dbErr != nil {
+			log.Errorf("Unable to remove utxo snapshot coins: %v", dbErr)
+		}
+		return err
+	}
+
+	// Install the snapshot as the second chainstate.
+	state := &SnapshotChainState{
+		Height: known.Height,
+		Hash:   *atHash,
+		Coins:  int64(numCoins),
+	}
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(snapshotChainStateKeyName,
+			serializeSnapshotChainState(state))
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshotState = state
+
+	log.Infof("Loaded utxo snapshot with %d coins at block %v (height %d)",
+		state.Coins, state.Hash, state.Height)
+	return nil
+}
+
+// writeUtxoSnapshotCoins reads the passed number of coins of a utxo snapshot
+// taken at the passed height from the passed reader and writes them to the
+// snapshot utxo set bucket in batches.  The serialized hash of the coins is
+// returned.
+func (b *BlockChain) writeUtxoSnapshotCoins(r io.Reader, height int32, numCoins uint64) (*chainhash.Hash, error) {
+	type snapshotCoin struct {
+		key        []byte
+		serialized []byte
+	}
+	batch := make([]snapshotCoin, 0, snapshotBatchSize)
+	writeBatch := func() error {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(snapshotUtxoSetBucketName)
+			for _, coin := range batch {
+				err := bucket.Put(coin.key, coin.serialized)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+
+	hasher := sha256.New()
+	var prevKey []byte
+	var outpoint wire.OutPoint
+	for i := uint64(0); i < numCoins; i++ {
+		entry, err := readUtxoSnapshotEntry(r, &outpoint)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read utxo snapshot "+
+				"entry %d: %v", i, err)
+		}
+		if entry.BlockHeight() > height {
+			return nil, fmt.Errorf("output %v of the utxo snapshot "+
+				"is from height %d after the snapshot", outpoint,
+				entry.BlockHeight())
+		}
+
+		// Requiring the coins to be sorted by their keys also ensures
+		// there are no duplicates.
+		key := *outpointKey(outpoint)
+		if prevKey != nil && bytes.Compare(prevKey, key) >= 0 {
+			return nil, fmt.Errorf("output %v of the utxo snapshot "+
+				"is out of order", outpoint)
+		}
+		prevKey = key
+
+		serialized, err := serializeUtxoEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		writeUtxoSetHashEntry(hasher, &outpoint, entry)
+		batch = append(batch, snapshotCoin{key, serialized})
+		if len(batch) == snapshotBatchSize {
+			if err := writeBatch(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writeBatch(); err != nil {
+		return nil, err
+	}
+	var extra [1]byte
+	if _, err := io.ReadFull(r, extra[:]); err != io.EOF {
+		return nil, fmt.Errorf("utxo snapshot has data after %d coins",
+			numCoins)
+	}
+
+	// The serialized entries are hashed with double sha256.
+	serializedHash := chainhash.HashH(hasher.Sum(nil))
+	return &serializedHash, nil
+}
+
+// SnapshotChainState returns the state of the chainstate built from a utxo
+// snapshot or nil when no snapshot has been loaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotChainState() *SnapshotChainState {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if b.snapshotState == nil {
+		return nil
+	}
+	state := *b.snapshotState
+	return &state
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// fetchSnapshotCoins returns the coins of the snapshot utxo set in the database
+// of the passed chain keyed by their serialized outpoints.
+func fetchSnapshotCoins(t *testing.T, chain *BlockChain) map[string][]byte {
+	t.Helper()
+
+	coins := make(map[string][]byte)
+	err := chain.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(snapshotUtxoSetBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			coins[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch snapshot coins: %v", err)
+	}
+	return coins
+}
+
+// TestLoadUtxoSnapshot ensures a utxo snapshot dumped from the utxo set of one
+// chain commits to the serialized hash of that utxo set and round-trips to an
+// identical utxo set installed as a second chainstate when it is loaded by
+// another chain.
+func TestLoadUtxoSnapshot(t *testing.T) {
+	// Build a chain with a few outputs, including a spent one, and take a
+	// snapshot of its utxo set.
+	chain, teardownFunc, err := chainSetup("loadutxosnapshotsrc",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	chain.TstSetCoinbaseMaturity(1)
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	b2 := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 0))
+	for _, block := range []*wire.MsgBlock{b1, b2} {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			teardownFunc()
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	var snapshot bytes.Buffer
+	stats, err := chain.DumpUtxoSnapshot(&snapshot, nil)
+	if err != nil {
+		teardownFunc()
+		t.Fatalf("DumpUtxoSnapshot: unexpected error: %v", err)
+	}
+	wantStats, err := chain.FetchUtxoStats(true, nil)
+	if err != nil {
+		teardownFunc()
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stats, wantStats) {
+		teardownFunc()
+		t.Fatalf("unexpected utxo snapshot stats - got %+v, want %+v",
+			stats, wantStats)
+	}
+	wantCoins := make(map[string][]byte)
+	err = chain.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		return bucket.ForEach(func(k, v []byte) error {
+			wantCoins[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	teardownFunc()
+	if err != nil {
+		t.Fatalf("unable to fetch utxo set: %v", err)
+	}
+
+	// Load the snapshot into a chain which only has the genesis block.
+	chain, teardownFunc, err = chainSetup("loadutxosnapshot",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.chainParams.AssumeUtxoSnapshots = []chaincfg.AssumeUtxoSnapshot{{
+		Height:         stats.Height,
+		BlockHash:      &stats.Hash,
+		SerializedHash: stats.SerializedHash,
+	}}
+	if chain.SnapshotChainState() != nil {
+		t.Fatalf("unexpected snapshot chainstate before loading")
+	}
+	err = chain.LoadUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+		&stats.Hash)
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+
+	want := &SnapshotChainState{
+		Height: 2,
+		Hash:   b2.BlockHash(),
+		Coins:  4,
+	}
+	if got := chain.SnapshotChainState(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected snapshot chainstate - got %+v, want %+v",
+			got, want)
+	}
+	if coins := fetchSnapshotCoins(t, chain); !reflect.DeepEqual(coins, wantCoins) {
+		t.Fatalf("unexpected snapshot coins - got %x, want %x", coins,
+			wantCoins)
+	}
+
+	// The fully validated chainstate is unaffected.
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("unexpected best height %d", best.Height)
+	}
+
+	// Only a single snapshot may be loaded.
+	err = chain.LoadUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+		&stats.Hash)
+	if err == nil {
+		t.Fatalf("LoadUtxoSnapshot: did not receive expected error " +
+			"when a snapshot is already loaded")
+	}
+
+	// The snapshot chainstate is loaded along with the chain.
+	reloaded, err := New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if got := reloaded.SnapshotChainState(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected reloaded snapshot chainstate - got %+v, "+
+			"want %+v", got, want)
+	}
+}
+
+// TestLoadUtxoSnapshotInvalid ensures utxo snapshots which are unknown or do not
+// match their commitment are rejected without leaving any coins behind.
+func TestLoadUtxoSnapshotInvalid(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("loadutxosnapshotinvalid",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a synthetic snapshot at height 10 whose coins are sorted by
+	// their keys.
+	blockHash := chainhash.Hash{0x01}
+	outpoints := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x01}, Index: 0},
+		{Hash: chainhash.Hash{0x01}, Index: 1},
+		{Hash: chainhash.Hash{0x02}, Index: 0},
+	}
+	entries := []*UtxoEntry{
+		{amount: 5000, pkScript: []byte{txscript.OP_TRUE}, blockHeight: 1,
+			packedFlags: tfCoinBase},
+		{amount: 6000, pkScript: []byte{txscript.OP_TRUE}, blockHeight: 1,
+			packedFlags: tfCoinBase},
+		{amount: 7000, pkScript: []byte{txscript.OP_TRUE}, blockHeight: 10},
+	}
+	createSnapshot := func(hash chainhash.Hash, outpoints []wire.OutPoint,
+		entries []*UtxoEntry) []byte {
+
+		var snapshot bytes.Buffer
+		snapshot.Write(hash[:])
+		binary.Write(&snapshot, binary.LittleEndian, uint64(len(entries)))
+		for i := range entries {
+			writeUtxoSetHashEntry(&snapshot, &outpoints[i], entries[i])
+		}
+		return snapshot.Bytes()
+	}
+	snapshot := createSnapshot(blockHash, outpoints, entries)
+	serializedHash := chainhash.DoubleHashH(snapshot[chainhash.HashSize+8:])
+	chain.chainParams.AssumeUtxoSnapshots = []chaincfg.AssumeUtxoSnapshot{{
+		Height:         10,
+		BlockHash:      &blockHash,
+		SerializedHash: &serializedHash,
+	}}
+
+	badAmount := *entries[2]
+	badAmount.amount++
+	futureCoin := *entries[2]
+	futureCoin.blockHeight = 11
+	tests := []struct {
+		name     string
+		atHash   chainhash.Hash
+		snapshot []byte
+	}{{
+		name:     "unknown snapshot",
+		atHash:   chainhash.Hash{0x02},
+		snapshot: createSnapshot(chainhash.Hash{0x02}, outpoints, entries),
+	}, {
+		name:     "snapshot for another block",
+		atHash:   blockHash,
+		snapshot: createSnapshot(chainhash.Hash{0x02}, outpoints, entries),
+	}, {
+		name:     "truncated snapshot",
+		atHash:   blockHash,
+		snapshot: snapshot[:len(snapshot)-1],
+	}, {
+		name:     "trailing data",
+		atHash:   blockHash,
+		snapshot: append(append([]byte(nil), snapshot...), 0x00),
+	}, {
+		name:   "commitment mismatch",
+		atHash: blockHash,
+		snapshot: createSnapshot(blockHash, outpoints,
+			[]*UtxoEntry{entries[0], entries[1], &badAmount}),
+	}, {
+		name:   "coin after snapshot",
+		atHash: blockHash,
+		snapshot: createSnapshot(blockHash, outpoints,
+			[]*UtxoEntry{entries[0], entries[1], &futureCoin}),
+	}, {
+		name:   "out of order coins",
+		atHash: blockHash,
+		snapshot: createSnapshot(blockHash,
+			[]wire.OutPoint{outpoints[1], outpoints[0], outpoints[2]},
+			entries),
+	}, {
+		name:   "duplicate coins",
+		atHash: blockHash,
+		snapshot: createSnapshot(blockHash,
+			[]wire.OutPoint{outpoints[0], outpoints[0], outpoints[2]},
+			entries),
+	}}
+	for _, test := range tests {
+		err := chain.LoadUtxoSnapshot(bytes.NewReader(test.snapshot),
+			&test.atHash)
+		if err == nil {
+			t.Errorf("%s: did not receive expected error", test.name)
+			continue
+		}
+		if chain.SnapshotChainState() != nil {
+			t.Errorf("%s: unexpected snapshot chainstate", test.name)
+		}
+		if coins := fetchSnapshotCoins(t, chain); len(coins) != 0 {
+			t.Errorf("%s: unexpected snapshot coins %x", test.name,
+				coins)
+		}
+	}
+
+	// The valid snapshot is still loaded afterwards.
+	err = chain.LoadUtxoSnapshot(bytes.NewReader(snapshot), &blockHash)
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+	if coins := fetchSnapshotCoins(t, chain); len(coins) != len(entries) {
+		t.Fatalf("unexpected number of snapshot coins - got %d, want %d",
+			len(coins), len(entries))
+	}
+}
+
+// TestRegressionNetAssumeUtxoSnapshot ensures the utxo snapshot known by the
+// regression test network parameters is the one of the chain of empty test
+// blocks and that it is loaded without any changes to the parameters.
+func TestRegressionNetAssumeUtxoSnapshot(t *testing.T) {
+	known := chaincfg.RegressionNetParams.AssumeUtxoSnapshots
+	if len(known) == 0 {
+		t.Fatalf("no known regression test network snapshots")
+	}
+	want := known[len(known)-1]
+
+	chain, teardownFunc, err := chainSetup("regtestsnapshotsrc",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	parent := chaincfg.RegressionNetParams.GenesisBlock
+	for height := int32(1); height <= want.Height; height++ {
+		block := newTestBlock(t, parent, height)
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			teardownFunc()
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		parent = block
+	}
+	var snapshot bytes.Buffer
+	stats, err := chain.DumpUtxoSnapshot(&snapshot, nil)
+	teardownFunc()
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: unexpected error: %v", err)
+	}
+	if stats.Hash != *want.BlockHash ||
+		*stats.SerializedHash != *want.SerializedHash {
+
+		t.Fatalf("unexpected snapshot - got block %v with serialized "+
+			"hash %v, want block %v with serialized hash %v",
+			stats.Hash, stats.SerializedHash, want.BlockHash,
+			want.SerializedHash)
+	}
+
+	chain, teardownFunc, err = chainSetup("regtestsnapshot",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	err = chain.LoadUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+		want.BlockHash)
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+	if state := chain.SnapshotChainState(); state == nil ||
+		state.Height != want.Height {
+
+		t.Fatalf("unexpected snapshot chainstate %+v", state)
+	}
+}
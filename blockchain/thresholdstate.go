@@ -301,7 +301,13 @@ func (b *BlockChain) deploymentState(prevNode *blockNode, deploymentID uint32) (
 		return ThresholdFailed, DeploymentError(deploymentID)
 	}
 
+	// Deployments that are always active do not depend on the signalling
+	// of any blocks.
 	deployment := &b.chainParams.Deployments[deploymentID]
+	if deployment.AlwaysActive {
+		return ThresholdActive, nil
+	}
+
 	checker := deploymentChecker{deployment: deployment, chain: b}
 	cache := &b.deploymentCaches[deploymentID]
 
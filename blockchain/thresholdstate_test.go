@@ -7,6 +7,7 @@ package blockchain
 import (
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
@@ -132,3 +133,19 @@ nextTest:
 		}
 	}
 }
+
+// TestDeploymentStateAlwaysActive ensures deployments that are defined as
+// always active are reported as active without any signalling.
+func TestDeploymentStateAlwaysActive(t *testing.T) {
+	chain := newFakeChain(&chaincfg.TestNet4Params)
+	for _, id := range []uint32{chaincfg.DeploymentCSV, chaincfg.DeploymentSegwit} {
+		state, err := chain.deploymentState(chain.bestChain.Tip(), id)
+		if err != nil {
+			t.Fatalf("deploymentState #%d: unexpected error: %v", id, err)
+		}
+		if state != ThresholdActive {
+			t.Fatalf("deploymentState #%d: unexpected state - got %v, "+
+				"want %v", id, state, ThresholdActive)
+		}
+	}
+}
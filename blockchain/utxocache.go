@@ -0,0 +1,349 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utxoCacheEntryOverhead is the approximate number of bytes of memory
+	// used by an entry in the utxo cache aside from its public key script.
+	// It accounts for the outpoint used as the map key, the pointer to the
+	// entry, the entry itself, and the bookkeeping of the map.
+	utxoCacheEntryOverhead = chainhash.HashSize + 4 + 8 + 40 + 16
+
+	// utxoCacheFlushInterval is the maximum amount of time the modified
+	// utxos are kept in the utxo cache before it is flushed to the
+	// database.  This limits the number of blocks that have to be replayed
+	// to reconstruct the utxo set after an unclean shutdown.
+	utxoCacheFlushInterval = 5 * time.Minute
+)
+
+// utxoCacheEntrySize returns the approximate number of bytes of memory used by
+// the passed entry in the utxo cache.
+func utxoCacheEntrySize(entry *UtxoEntry) uint64 {
+	return uint64(utxoCacheEntryOverhead + len(entry.pkScript))
+}
+
+// utxoCache houses the unspent transaction outputs that were created or spent
+// by blocks connected to the main chain but have not yet been written to the
+// database.  Writing the modifications of many blocks at once, rather than
+// after every block, greatly reduces the number of database writes needed
+// during the initial chain download, and outputs that are created and spent
+// before the cache is flushed never need to be written at all.
+//
+// The utxo set in the database is always consistent with a block in the main
+// chain, which is tracked by the utxo state consistency key written along with
+// every flush.  The cache houses the modifications needed to bring it to the
+// current best block.
+//
+// The cache is protected by the chain lock.  It is only modified while the
+// lock is held for writes, so lookups only require it for reads.
+type utxoCache struct {
+	db database.DB
+
+	// maxSize is the approximate maximum number of bytes of memory the
+	// cache may use before it is flushed.  A maximum size of zero causes
+	// the modifications of every block to be written to the database
+	// immediately.
+	maxSize uint64
+
+	// entries houses the modified utxos keyed by their outpoint.  Spent
+	// entries are kept so lookups don't fall back to the database and so
+	// they are removed from it when the cache is flushed.
+	entries map[wire.OutPoint]*UtxoEntry
+
+	// totalSize is the approximate number of bytes of memory used by the
+	// entries and lastFlush is the time the cache was last flushed.
+	totalSize uint64
+	lastFlush time.Time
+}
+
+// newUtxoCache returns a new empty utxo cache for the provided database which
+// is flushed once it uses more than the provided number of bytes of memory.
+func newUtxoCache(db database.DB, maxSize uint64) *utxoCache {
+	return &utxoCache{
+		db:        db,
+		maxSize:   maxSize,
+		entries:   make(map[wire.OutPoint]*UtxoEntry),
+		lastFlush: time.Now(),
+	}
+}
+
+// fetchEntry uses an existing database transaction to fetch the specified
+// transaction output from the point of view of the end of the main chain.  The
+// cache is checked first and then the database.  The returned entry is a copy
+// which may be modified by the caller.
+//
+// When there is no unspent output for the provided outpoint, nil will be
+// returned for both the entry and the error.
+func (c *utxoCache) fetchEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, error) {
+	if entry, ok := c.entries[outpoint]; ok {
+		if entry.IsSpent() {
+			return nil, nil
+		}
+
+		clone := entry.Clone()
+		clone.packedFlags &^= tfModified | tfFresh
+		return clone, nil
+	}
+
+	return dbFetchUtxoEntry(dbTx, outpoint)
+}
+
+// viewSize returns the approximate number of bytes of memory the modified
+// entries of the passed view would add to the cache.
+func viewSize(view *UtxoViewpoint) uint64 {
+	var size uint64
+	for _, entry := range view.entries {
+		if entry != nil && entry.isModified() {
+			size += utxoCacheEntrySize(entry)
+		}
+	}
+	return size
+}
+
+// needsFlush returns whether or not the cache must be flushed to the database
+// along with the modifications of the passed view.  That is the case when the
+// cache would otherwise grow beyond its maximum size or when it has not been
+// flushed for longer than the flush interval.
+func (c *utxoCache) needsFlush(view *UtxoViewpoint) bool {
+	if c.maxSize == 0 {
+		return true
+	}
+	if c.totalSize+viewSize(view) > c.maxSize {
+		return true
+	}
+	return time.Since(c.lastFlush) > utxoCacheFlushInterval
+}
+
+// commit adds the modified entries of the passed view to the cache.  Spent
+// entries that are not in the database are removed from the cache entirely
+// since there is nothing to remove from the database for them.
+//
+// The view is not altered, so the caller still needs to commit it as well.
+func (c *utxoCache) commit(view *UtxoViewpoint) {
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		// Outputs that are not in the cache were either loaded from the
+		// database when they are spent or newly created otherwise.
+		// Newly created outputs never replace unspent ones, so they are
+		// not in the database either.
+		cached := c.entries[outpoint]
+		fresh := cached != nil && cached.isFresh()
+		if cached != nil {
+			c.totalSize -= utxoCacheEntrySize(cached)
+			delete(c.entries, outpoint)
+		}
+
+		if entry.IsSpent() {
+			// Outputs that were never written to the database can
+			// simply be forgotten.  Otherwise, keep a marker so the
+			// output is removed from the database on the next
+			// flush.  The script is no longer needed for that.
+			if fresh {
+				continue
+			}
+			entry = &UtxoEntry{packedFlags: tfSpent | tfModified}
+		} else {
+			entry = entry.Clone()
+			entry.packedFlags |= tfModified
+			if cached == nil || fresh {
+				entry.packedFlags |= tfFresh
+			}
+		}
+
+		c.entries[outpoint] = entry
+		c.totalSize += utxoCacheEntrySize(entry)
+	}
+}
+
+// dbFlush uses an existing database transaction to write all of the entries in
+// the cache followed by the modified entries of the passed view, which may be
+// nil, to the utxo set in the database.  It also updates the utxo state
+// consistency to the passed block hash the resulting utxo set is for.
+//
+// The cache is not altered, so the caller must reset it once the database
+// transaction has been committed successfully.
+func (c *utxoCache) dbFlush(dbTx database.Tx, view *UtxoViewpoint, hash *chainhash.Hash) error {
+	for outpoint, entry := range c.entries {
+		// Outputs that were either modified or spent by the view are
+		// written below.
+		if view != nil {
+			if viewEntry := view.entries[outpoint]; viewEntry != nil &&
+				viewEntry.isModified() {
+
+				continue
+			}
+		}
+
+		if err := dbPutUtxoEntry(dbTx, outpoint, entry); err != nil {
+			return err
+		}
+	}
+
+	if view != nil {
+		if err := dbPutUtxoView(dbTx, view); err != nil {
+			return err
+		}
+	}
+
+	return dbPutUtxoStateConsistency(dbTx, hash)
+}
+
+// reset removes all entries from the cache.  It must only be called once they
+// have been written to the database.
+func (c *utxoCache) reset() {
+	c.entries = make(map[wire.OutPoint]*UtxoEntry)
+	c.totalSize = 0
+	c.lastFlush = time.Now()
+}
+
+// flush writes all of the entries in the cache to the database and removes
+// them from the cache.  The passed hash is the hash of the block the resulting
+// utxo set is for.
+func (c *utxoCache) flush(hash *chainhash.Hash) error {
+	err := c.db.Update(func(dbTx database.Tx) error {
+		return c.dbFlush(dbTx, nil, hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.reset()
+	return nil
+}
+
+// flushUtxoCache writes all of the entries in the utxo cache to the database
+// so the utxo set in the database is consistent with the current best block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushUtxoCache() error {
+	if len(b.utxoCache.entries) == 0 {
+		return nil
+	}
+
+	tip := b.bestChain.Tip()
+	log.Debugf("Flushing %d utxo cache entries (%d bytes) at height %d",
+		len(b.utxoCache.entries), b.utxoCache.totalSize, tip.height)
+	return b.utxoCache.flush(&tip.hash)
+}
+
+// UtxoCacheSize returns the number of entries in the utxo cache along with the
+// approximate number of bytes of memory they use.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoCacheSize() (int, uint64) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	return len(b.utxoCache.entries), b.utxoCache.totalSize
+}
+
+// FlushUtxoCache writes all of the unspent transaction outputs that are only
+// in memory to the database.  This should be called prior to shutting down so
+// the utxo set does not have to be reconstructed on the next start.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.flushUtxoCache()
+}
+
+// initUtxoCache brings the utxo set in the database up to date with the best
+// block by reconnecting the blocks that were connected after it was last
+// flushed.  This is the case after an unclean shutdown while modifications
+// were only in the utxo cache.  When interrupted, the blocks reconnected so far
+// are flushed so the next call resumes after them.
+func (b *BlockChain) initUtxoCache(interrupt <-chan struct{}) error {
+	tip := b.bestChain.Tip()
+	var consistentHash *chainhash.Hash
+	err := b.db.Update(func(dbTx database.Tx) error {
+		consistentHash = dbFetchUtxoStateConsistency(dbTx)
+
+		// Databases created before the utxo cache existed always have
+		// a utxo set consistent with the best block.
+		if consistentHash == nil {
+			consistentHash = &tip.hash
+			return dbPutUtxoStateConsistency(dbTx, consistentHash)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *consistentHash == tip.hash {
+		return nil
+	}
+
+	// The utxo cache is flushed before blocks are disconnected, so the
+	// block the utxo set is consistent with must be in the main chain.
+	node := b.index.LookupNode(consistentHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("utxo set is consistent with "+
+			"block %v which is not in the main chain", consistentHash))
+	}
+
+	log.Infof("Reconstructing utxo set from height %d to %d", node.height,
+		tip.height)
+	for n := b.bestChain.Next(node); n != nil; n = b.bestChain.Next(n) {
+		if interruptRequested(interrupt) {
+			log.Infof("Interrupted reconstructing utxo set at height "+
+				"%d", node.height)
+			if err := b.utxoCache.flush(&node.hash); err != nil {
+				return err
+			}
+			return errInterruptRequested
+		}
+
+		var block *btcutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, n)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// The block was fully validated when it was connected, so only
+		// the utxo set needs to be updated.
+		view := NewUtxoViewpoint()
+		if err := view.fetchInputUtxos(b.utxoCache, block); err != nil {
+			return err
+		}
+		if err := view.connectTransactions(block, nil); err != nil {
+			return err
+		}
+
+		if b.utxoCache.needsFlush(view) {
+			err := b.db.Update(func(dbTx database.Tx) error {
+				return b.utxoCache.dbFlush(dbTx, view, &n.hash)
+			})
+			if err != nil {
+				return err
+			}
+			b.utxoCache.reset()
+			node = n
+			continue
+		}
+		b.utxoCache.commit(view)
+		node = n
+	}
+
+	return b.flushUtxoCache()
+}
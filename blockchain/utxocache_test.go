@@ -0,0 +1,289 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestSpend returns a transaction that spends the output of the passed
+// transaction at the provided index into the provided number of outputs that
+// can be spent by anyone.  The value of the spent output is split evenly among
+// them without paying a fee.
+func newTestSpend(tx *wire.MsgTx, index uint32, numOutputs int) *wire.MsgTx {
+	txHash := tx.TxHash()
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&txHash, index), nil, nil))
+	value := tx.TxOut[index].Value / int64(numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		spend.AddTxOut(wire.NewTxOut(value, []byte{txscript.OP_TRUE}))
+	}
+	return spend
+}
+
+// fetchTestUtxos returns the entries the passed chain has for every output of
+// every transaction in the passed blocks from the point of view of the end of
+// the main chain.  Outputs without an unspent entry map to nil.
+func fetchTestUtxos(t *testing.T, chain *BlockChain, blocks []*wire.MsgBlock) map[wire.OutPoint]*UtxoEntry {
+	entries := make(map[wire.OutPoint]*UtxoEntry)
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			prevOut := wire.OutPoint{Hash: tx.TxHash()}
+			for i := range tx.TxOut {
+				prevOut.Index = uint32(i)
+				entry, err := chain.FetchUtxoEntry(prevOut)
+				if err != nil {
+					t.Fatalf("FetchUtxoEntry %v: unexpected "+
+						"error: %v", prevOut, err)
+				}
+				entries[prevOut] = entry
+			}
+		}
+	}
+	return entries
+}
+
+// TestUtxoCacheFlush ensures the utxo set is the same regardless of the size
+// of the utxo cache both before and after the cache is flushed and after the
+// utxo set is reconstructed when the cache was not flushed before the chain
+// was shut down.
+func TestUtxoCacheFlush(t *testing.T) {
+	// Construct a main chain with outputs that are spent both before and
+	// after they would be written to the database by a cache that is
+	// large enough to hold a few blocks along with a side chain that
+	// causes a reorganize which undoes some of those spends.
+	//
+	//   genesis -> b1 -> b2 -> b3 -> b4
+	//                      \-> b3a -> b4a -> b5a -> b6a
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	t2 := newTestSpend(b1.Transactions[0], 0, 4)
+	b2 := newTestBlock(t, b1, 2, t2)
+	t3 := newTestSpend(t2, 0, 2)
+	b3 := newTestBlock(t, b2, 3, t3, newTestSpend(t3, 1, 1),
+		newTestSpend(t2, 1, 1))
+	b4 := newTestBlock(t, b3, 4, newTestSpend(t2, 2, 3))
+	b3a := newTestBlock(t, b2, 3, newTestSpend(t2, 1, 2))
+	b4a := newTestBlock(t, b3a, 4, newTestSpend(b2.Transactions[0], 0, 2))
+	b5a := newTestBlock(t, b4a, 5, newTestSpend(t2, 3, 1))
+	b6a := newTestBlock(t, b5a, 6, newTestSpend(t2, 0, 1),
+		newTestSpend(b3a.Transactions[1], 0, 1))
+	blocks := []*wire.MsgBlock{b1, b2, b3, b4, b3a, b4a, b5a, b6a}
+
+	var wantEntries map[wire.OutPoint]*UtxoEntry
+	var wantStats *UtxoStats
+	for _, maxSize := range []uint64{0, 2000, 1 << 30} {
+		name := fmt.Sprintf("utxocacheflush%d", maxSize)
+		chain, teardownFunc, err := chainSetup(name,
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		chain.TstSetCoinbaseMaturity(1)
+		chain.utxoCache.maxSize = maxSize
+
+		for _, block := range blocks {
+			_, _, err := chain.ProcessBlock(btcutil.NewBlock(block),
+				BFNone)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("%s: ProcessBlock %v: unexpected error: "+
+					"%v", name, block.BlockHash(), err)
+			}
+		}
+		if best := chain.BestSnapshot(); best.Hash != b6a.BlockHash() {
+			teardownFunc()
+			t.Fatalf("%s: unexpected best block - got %v, want %v",
+				name, best.Hash, b6a.BlockHash())
+		}
+
+		// The chain without a cache writes the utxo set after every
+		// block, so it serves as the reference for the others.
+		entries := fetchTestUtxos(t, chain, blocks)
+		if wantEntries == nil {
+			wantEntries = entries
+		}
+		if !reflect.DeepEqual(entries, wantEntries) {
+			teardownFunc()
+			t.Fatalf("%s: unexpected utxos before flush", name)
+		}
+
+		// Recreate the chain from the same database without flushing
+		// the cache first to simulate an unclean shutdown.  The utxo
+		// set must be reconstructed to be the same.
+		chain, err = New(&Config{
+			DB:          chain.db,
+			ChainParams: chain.chainParams,
+			TimeSource:  NewMedianTime(),
+		})
+		if err != nil {
+			teardownFunc()
+			t.Fatalf("%s: New: unexpected error: %v", name, err)
+		}
+		entries = fetchTestUtxos(t, chain, blocks)
+		if !reflect.DeepEqual(entries, wantEntries) {
+			teardownFunc()
+			t.Fatalf("%s: unexpected utxos after reconstruction",
+				name)
+		}
+
+		// Flushing the cache must not change the utxo set either.
+		if err := chain.FlushUtxoCache(); err != nil {
+			teardownFunc()
+			t.Fatalf("%s: FlushUtxoCache: unexpected error: %v",
+				name, err)
+		}
+		entries = fetchTestUtxos(t, chain, blocks)
+		if !reflect.DeepEqual(entries, wantEntries) {
+			teardownFunc()
+			t.Fatalf("%s: unexpected utxos after flush", name)
+		}
+		stats, err := chain.FetchUtxoStats(true, nil)
+		if err != nil {
+			teardownFunc()
+			t.Fatalf("%s: FetchUtxoStats: unexpected error: %v",
+				name, err)
+		}
+		if wantStats == nil {
+			wantStats = stats
+		}
+		if !reflect.DeepEqual(stats, wantStats) {
+			teardownFunc()
+			t.Fatalf("%s: unexpected utxo stats - got %+v, want %+v",
+				name, stats, wantStats)
+		}
+
+		teardownFunc()
+	}
+}
+
+// fetchRecordingDB is a database which records the hashes of the blocks it
+// fetches and closes an interrupt channel once a given block is fetched.
+type fetchRecordingDB struct {
+	database.DB
+	fetched       []chainhash.Hash
+	interruptHash chainhash.Hash
+	interrupt     chan struct{}
+}
+
+// View runs the passed function with a transaction which records the fetched
+// blocks.
+func (db *fetchRecordingDB) View(fn func(dbTx database.Tx) error) error {
+	return db.DB.View(func(dbTx database.Tx) error {
+		return fn(&fetchRecordingTx{Tx: dbTx, db: db})
+	})
+}
+
+// fetchRecordingTx is a database transaction of a fetchRecordingDB.
+type fetchRecordingTx struct {
+	database.Tx
+	db *fetchRecordingDB
+}
+
+// FetchBlock records the fetched block and fetches it.
+func (tx *fetchRecordingTx) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	tx.db.fetched = append(tx.db.fetched, *hash)
+	if *hash == tx.db.interruptHash && tx.db.interrupt != nil {
+		close(tx.db.interrupt)
+	}
+	return tx.Tx.FetchBlock(hash)
+}
+
+// TestInitUtxoCacheInterrupt ensures interrupting the reconstruction of the utxo
+// set after an unclean shutdown keeps the blocks reconnected so far, so the
+// next start only reconnects the remaining blocks.
+func TestInitUtxoCacheInterrupt(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("initutxocacheinterrupt",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	chain.utxoCache.maxSize = 1 << 30
+
+	// Connect blocks which spend the outputs of the previous blocks, so the
+	// utxo set is only correct when they are reconnected in order.
+	blocks := []*wire.MsgBlock{
+		newTestBlock(t, chaincfg.RegressionNetParams.GenesisBlock, 1),
+	}
+	for height := int32(2); height <= 6; height++ {
+		prev := blocks[len(blocks)-1]
+		blocks = append(blocks, newTestBlock(t, prev, height,
+			newTestSpend(prev.Transactions[0], 0, 2)))
+	}
+	for _, block := range blocks {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	wantEntries := fetchTestUtxos(t, chain, blocks)
+
+	// Recreate the chain without flushing the cache to simulate an unclean
+	// shutdown and interrupt the reconstruction once the third block has
+	// been reconnected.
+	db := &fetchRecordingDB{
+		DB:            chain.db,
+		interruptHash: blocks[2].BlockHash(),
+		interrupt:     make(chan struct{}),
+	}
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		Interrupt:   db.interrupt,
+	})
+	if err != errInterruptRequested {
+		t.Fatalf("New: unexpected error - got %v, want %v", err,
+			errInterruptRequested)
+	}
+	var consistentHash *chainhash.Hash
+	err = db.View(func(dbTx database.Tx) error {
+		consistentHash = dbFetchUtxoStateConsistency(dbTx)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+	if *consistentHash != blocks[2].BlockHash() {
+		t.Fatalf("unexpected utxo set consistency - got %v, want %v",
+			consistentHash, blocks[2].BlockHash())
+	}
+
+	// The next start only reconnects the blocks after the third one.  The
+	// tip block is also fetched when the chain state is loaded.
+	db.fetched = nil
+	db.interrupt = nil
+	chain, err = New(&Config{
+		DB:          db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	fetched := make(map[chainhash.Hash]bool)
+	for _, hash := range db.fetched {
+		fetched[hash] = true
+	}
+	for i, block := range blocks {
+		if fetched[block.BlockHash()] != (i >= 3) {
+			t.Fatalf("unexpected reconnected blocks %v", db.fetched)
+		}
+	}
+	if entries := fetchTestUtxos(t, chain, blocks); !reflect.DeepEqual(entries, wantEntries) {
+		t.Fatalf("unexpected utxos after reconstruction")
+	}
+}
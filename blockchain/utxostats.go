@@ -0,0 +1,221 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// utxoStatsInterruptInterval is the number of utxo set entries that
+	// are scanned between checks for an interrupt request.
+	utxoStatsInterruptInterval = 10000
+
+	// utxoBogoSizeOverhead is the number of bytes added to the size of the
+	// public key script of every output to calculate the bogo size of the
+	// utxo set.  It accounts for the transaction hash, the output index,
+	// the height and coinbase flag, the amount, and the script length.
+	utxoBogoSizeOverhead = chainhash.HashSize + 4 + 4 + 8 + 2
+)
+
+// UtxoStats houses statistics about the unspent transaction output set as of
+// the best block at the time they were calculated.
+type UtxoStats struct {
+	// Height and Hash identify the best block the statistics are for.
+	Height int32
+	Hash   chainhash.Hash
+
+	// Transactions is the number of transactions with unspent outputs
+	// and Outputs is the total number of unspent outputs.
+	Transactions int64
+	Outputs      int64
+
+	// TotalAmount is the total value of all unspent outputs in satoshi.
+	TotalAmount int64
+
+	// BogoSize is a database independent metric for the size of the utxo
+	// set and DiskSize is the size of its serialized database entries.
+	BogoSize int64
+	DiskSize int64
+
+	// SerializedHash is the hash of the serialized utxo set.  It is only
+	// set when it was requested.
+	SerializedHash *chainhash.Hash
+}
+
+// writeUtxoSetHashEntry writes the serialization of the passed unspent output
+// used to calculate the hash of the utxo set to the passed writer.  The same
+// serialization is used for the entries of utxo snapshots.
+//
+// The serialized format is:
+//
+//	<tx hash><output index><header code><amount><script len><script>
+//
+//	Field          Type             Size
+//	tx hash        chainhash.Hash   chainhash.HashSize
+//	output index   uint32           4 bytes
+//	header code    uint32           4 bytes
+//	amount         int64            8 bytes
+//	script len     VarInt           variable
+//	script         []byte           variable
+//
+// The header code is the height of the block containing the output shifted
+// left one bit with the lowest bit set when the output is from a coinbase.
+// All integers are encoded little endian.
+func writeUtxoSetHashEntry(w io.Writer, outpoint *wire.OutPoint, entry *UtxoEntry) error {
+	var buf [16]byte
+	headerCode := uint32(entry.BlockHeight()) << 1
+	if entry.IsCoinBase() {
+		headerCode |= 0x01
+	}
+	binary.LittleEndian.PutUint32(buf[0:4], outpoint.Index)
+	binary.LittleEndian.PutUint32(buf[4:8], headerCode)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(entry.Amount()))
+
+	if _, err := w.Write(outpoint.Hash[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, entry.PkScript())
+}
+
+// dbForEachUtxoEntry uses an existing database transaction to invoke the passed
+// function with every entry of the utxo set in the database along with the size
+// of its serialized key and value.  The entries are visited in the order of
+// their keys one at a time, so the memory used does not depend on the size of
+// the utxo set.  The iteration is aborted with an error once the interrupt
+// channel is closed.
+func dbForEachUtxoEntry(dbTx database.Tx, interrupt <-chan struct{}, fn func(outpoint *wire.OutPoint, entry *UtxoEntry, diskSize int) error) error {
+	var numEntries int
+	var outpoint wire.OutPoint
+	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if numEntries%utxoStatsInterruptInterval == 0 &&
+			interruptRequested(interrupt) {
+
+			return errInterruptRequested
+		}
+		numEntries++
+
+		key := cursor.Key()
+		if len(key) <= chainhash.HashSize {
+			return database.Error{
+				ErrorCode:   database.ErrCorruption,
+				Description: "corrupt utxo set key",
+			}
+		}
+		serialized := cursor.Value()
+		entry, err := deserializeUtxoEntry(serialized)
+		if err != nil {
+			return err
+		}
+		copy(outpoint.Hash[:], key[:chainhash.HashSize])
+		index, _ := deserializeVLQ(key[chainhash.HashSize:])
+		outpoint.Index = uint32(index)
+
+		if err := fn(&outpoint, entry, len(key)+len(serialized)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbFetchUtxoStats uses an existing database transaction to calculate
+// statistics about the utxo set in the database.  The utxo set is scanned one
+// entry at a time, so the memory used does not depend on its size.
+//
+// Only the totals are calculated, so the caller is responsible for setting the
+// block the utxo set is for.
+func dbFetchUtxoStats(dbTx database.Tx, computeHash bool, interrupt <-chan struct{}) (*UtxoStats, error) {
+	stats := &UtxoStats{}
+
+	var hasher hash.Hash
+	if computeHash {
+		hasher = sha256.New()
+	}
+
+	var prevTxHash chainhash.Hash
+	err := dbForEachUtxoEntry(dbTx, interrupt, func(outpoint *wire.OutPoint,
+		entry *UtxoEntry, diskSize int) error {
+
+		// The keys are sorted by transaction hash, so all outputs of a
+		// transaction are adjacent.
+		if stats.Outputs == 0 || outpoint.Hash != prevTxHash {
+			stats.Transactions++
+			prevTxHash = outpoint.Hash
+		}
+		stats.Outputs++
+		stats.TotalAmount += entry.Amount()
+		stats.BogoSize += int64(utxoBogoSizeOverhead + len(entry.PkScript()))
+		stats.DiskSize += int64(diskSize)
+
+		if hasher != nil {
+			writeUtxoSetHashEntry(hasher, outpoint, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hasher != nil {
+		// The serialized entries are hashed with double sha256.
+		serializedHash := chainhash.HashH(hasher.Sum(nil))
+		stats.SerializedHash = &serializedHash
+	}
+
+	return stats, nil
+}
+
+// FetchUtxoStats returns statistics about the unspent transaction output set
+// as of the current best block.  This requires scanning the entire utxo set,
+// so it is expensive.  The serialized hash of the set is only calculated when
+// computeHash is true.  The scan is aborted with an error once the interrupt
+// channel is closed, which may be nil when the caller does not want to abort
+// it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchUtxoStats(computeHash bool, interrupt <-chan struct{}) (*UtxoStats, error) {
+	// Write out the utxo cache so the utxo set in the database is for the
+	// current best block.  The chain lock is not held during the scan, so
+	// the block the utxo set is for is determined from the same database
+	// transaction since more blocks may be connected in the mean time.
+	if err := b.FlushUtxoCache(); err != nil {
+		return nil, err
+	}
+
+	var stats *UtxoStats
+	err := b.db.View(func(dbTx database.Tx) error {
+		hash := dbFetchUtxoStateConsistency(dbTx)
+		if hash == nil {
+			return AssertError("utxo state consistency is not set")
+		}
+		node := b.index.LookupNode(hash)
+		if node == nil {
+			return AssertError(fmt.Sprintf("utxo set is consistent "+
+				"with unknown block %v", hash))
+		}
+
+		var err error
+		stats, err = dbFetchUtxoStats(dbTx, computeHash, interrupt)
+		if err != nil {
+			return err
+		}
+		stats.Height = node.height
+		stats.Hash = node.hash
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestFetchUtxoStats ensures the utxo set statistics reflect the outputs that
+// are created and spent by the blocks in the main chain.
+func TestFetchUtxoStats(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("fetchutxostats",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// The outputs of the genesis coinbase are not spendable, so the utxo
+	// set starts out empty.
+	stats, err := chain.FetchUtxoStats(true, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash
+	if stats.Height != 0 || stats.Hash != *genesisHash {
+		t.Fatalf("unexpected best block - got %v (%d), want %v (0)",
+			stats.Hash, stats.Height, genesisHash)
+	}
+	if stats.Transactions != 0 || stats.Outputs != 0 ||
+		stats.TotalAmount != 0 {
+
+		t.Fatalf("unexpected stats for empty utxo set: %+v", stats)
+	}
+	emptyHash := stats.SerializedHash
+
+	// Every test block has a coinbase with two outputs of one coin each
+	// and the second block also spends the first output of the first
+	// coinbase into a single output of half a coin.
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	b2 := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 0))
+	tests := []struct {
+		name         string
+		transactions int64
+		outputs      int64
+		totalAmount  int64
+	}{
+		{
+			name:         "b1",
+			transactions: 1,
+			outputs:      2,
+			totalAmount:  2 * btcutil.SatoshiPerBitcoin,
+		},
+		{
+			name:         "b2",
+			transactions: 3,
+			outputs:      4,
+			totalAmount:  3*btcutil.SatoshiPerBitcoin + btcutil.SatoshiPerBitcoin/2,
+		},
+	}
+	prevHash := emptyHash
+	for i, block := range []*btcutil.Block{btcutil.NewBlock(b1), btcutil.NewBlock(b2)} {
+		test := tests[i]
+		_, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("%s: ProcessBlock: unexpected error: %v",
+				test.name, err)
+		}
+
+		stats, err := chain.FetchUtxoStats(true, nil)
+		if err != nil {
+			t.Fatalf("%s: FetchUtxoStats: unexpected error: %v",
+				test.name, err)
+		}
+		if stats.Height != int32(i+1) || stats.Hash != *block.Hash() {
+			t.Fatalf("%s: unexpected best block - got %v (%d), "+
+				"want %v (%d)", test.name, stats.Hash,
+				stats.Height, block.Hash(), i+1)
+		}
+		if stats.Transactions != test.transactions {
+			t.Fatalf("%s: unexpected transactions - got %d, want %d",
+				test.name, stats.Transactions, test.transactions)
+		}
+		if stats.Outputs != test.outputs {
+			t.Fatalf("%s: unexpected outputs - got %d, want %d",
+				test.name, stats.Outputs, test.outputs)
+		}
+		if stats.TotalAmount != test.totalAmount {
+			t.Fatalf("%s: unexpected total amount - got %d, want %d",
+				test.name, stats.TotalAmount, test.totalAmount)
+		}
+
+		// All outputs of the test blocks have a single byte script.
+		wantBogoSize := test.outputs * (utxoBogoSizeOverhead + 1)
+		if stats.BogoSize != wantBogoSize {
+			t.Fatalf("%s: unexpected bogo size - got %d, want %d",
+				test.name, stats.BogoSize, wantBogoSize)
+		}
+		if stats.DiskSize == 0 {
+			t.Fatalf("%s: unexpected zero disk size", test.name)
+		}
+		if stats.SerializedHash == nil ||
+			stats.SerializedHash.IsEqual(prevHash) {
+
+			t.Fatalf("%s: serialized hash %v did not change",
+				test.name, stats.SerializedHash)
+		}
+		prevHash = stats.SerializedHash
+	}
+
+	// The serialized hash must only be calculated when requested and must
+	// be the same for the same utxo set.
+	stats, err = chain.FetchUtxoStats(false, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	if stats.SerializedHash != nil {
+		t.Fatalf("unexpected serialized hash %v", stats.SerializedHash)
+	}
+	stats, err = chain.FetchUtxoStats(true, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	if !stats.SerializedHash.IsEqual(prevHash) {
+		t.Fatalf("unexpected serialized hash - got %v, want %v",
+			stats.SerializedHash, prevHash)
+	}
+
+	// Reorganizing to a side chain that forks after the first block must
+	// undo the spend in the second block.
+	b2a := newTestBlock(t, b1, 2)
+	b3a := newTestBlock(t, b2a, 3)
+	for _, block := range []*btcutil.Block{btcutil.NewBlock(b2a), btcutil.NewBlock(b3a)} {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	stats, err = chain.FetchUtxoStats(true, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	if stats.Hash != b3a.BlockHash() || stats.Outputs != 6 ||
+		stats.TotalAmount != 6*btcutil.SatoshiPerBitcoin {
+
+		t.Fatalf("unexpected stats after reorganize: %+v", stats)
+	}
+
+	// A closed interrupt channel must abort the scan.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, err := chain.FetchUtxoStats(true, interrupt); err != errInterruptRequested {
+		t.Fatalf("unexpected error - got %v, want %v", err,
+			errInterruptRequested)
+	}
+}
@@ -28,6 +28,10 @@ const (
 	// tfModified indicates that a txout has been modified since it was
 	// loaded.
 	tfModified
+
+	// tfFresh indicates that a txout in the utxo cache has not been written
+	// to the database.
+	tfFresh
 )
 
 // UtxoEntry houses details about an individual transaction output in a utxo
@@ -58,6 +62,12 @@ func (entry *UtxoEntry) isModified() bool {
 	return entry.packedFlags&tfModified == tfModified
 }
 
+// isFresh returns whether or not the output has not been written to the
+// database since it was added to the utxo cache.
+func (entry *UtxoEntry) isFresh() bool {
+	return entry.packedFlags&tfFresh == tfFresh
+}
+
 // IsCoinBase returns whether or not the output was contained in a coinbase
 // transaction.
 func (entry *UtxoEntry) IsCoinBase() bool {
@@ -466,6 +476,19 @@ func (view *UtxoViewpoint) Entries() map[wire.OutPoint]*UtxoEntry {
 	return view.entries
 }
 
+// modifiedClone returns a new view with copies of all entries marked modified,
+// which are the changes to the utxo set that have not been committed yet.
+func (view *UtxoViewpoint) modifiedClone() *UtxoViewpoint {
+	clone := NewUtxoViewpoint()
+	clone.bestHash = view.bestHash
+	for outpoint, entry := range view.entries {
+		if entry != nil && entry.isModified() {
+			clone.entries[outpoint] = entry.Clone()
+		}
+	}
+	return clone
+}
+
 // commit prunes all entries marked modified that are now fully spent and marks
 // all entries as unmodified.
 func (view *UtxoViewpoint) commit() {
@@ -475,7 +498,7 @@ func (view *UtxoViewpoint) commit() {
 			continue
 		}
 
-		entry.packedFlags ^= tfModified
+		entry.packedFlags &^= tfModified
 	}
 }
 
@@ -486,7 +509,7 @@ func (view *UtxoViewpoint) commit() {
 // Upon completion of this function, the view will contain an entry for each
 // requested outpoint.  Spent outputs, or those which otherwise don't exist,
 // will result in a nil entry in the view.
-func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.OutPoint]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxosMain(cache *utxoCache, outpoints map[wire.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
 		return nil
@@ -499,9 +522,9 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.Out
 	// will result in nil entries in the view.  This is intentionally done
 	// so other code can use the presence of an entry in the store as a way
 	// to unnecessarily avoid attempting to reload it from the database.
-	return db.View(func(dbTx database.Tx) error {
+	return cache.db.View(func(dbTx database.Tx) error {
 		for outpoint := range outpoints {
-			entry, err := dbFetchUtxoEntry(dbTx, outpoint)
+			entry, err := cache.fetchEntry(dbTx, outpoint)
 			if err != nil {
 				return err
 			}
@@ -514,9 +537,9 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.Out
 }
 
 // fetchUtxos loads the unspent transaction outputs for the provided set of
-// outputs into the view from the database as needed unless they already exist
-// in the view in which case they are ignored.
-func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoint]struct{}) error {
+// outputs into the view from the utxo cache or database as needed unless they
+// already exist in the view in which case they are ignored.
+func (view *UtxoViewpoint) fetchUtxos(cache *utxoCache, outpoints map[wire.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
 		return nil
@@ -533,16 +556,16 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoin
 		neededSet[outpoint] = struct{}{}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, neededSet)
+	// Request the input utxos from the utxo cache or database.
+	return view.fetchUtxosMain(cache, neededSet)
 }
 
 // fetchInputUtxos loads the unspent transaction outputs for the inputs
 // referenced by the transactions in the given block into the view from the
-// database as needed.  In particular, referenced entries that are earlier in
-// the block are added to the view and entries that are already in the view are
-// not modified.
-func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block) error {
+// utxo cache or database as needed.  In particular, referenced entries that are
+// earlier in the block are added to the view and entries that are already in
+// the view are not modified.
+func (view *UtxoViewpoint) fetchInputUtxos(cache *utxoCache, block *btcutil.Block) error {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -588,8 +611,8 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block)
 		}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, neededSet)
+	// Request the input utxos from the utxo cache or database.
+	return view.fetchUtxosMain(cache, neededSet)
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
@@ -625,7 +648,7 @@ func (b *BlockChain) FetchUtxoView(tx *btcutil.Tx) (*UtxoViewpoint, error) {
 	// chain.
 	view := NewUtxoViewpoint()
 	b.chainLock.RLock()
-	err := view.fetchUtxosMain(b.db, neededSet)
+	err := view.fetchUtxosMain(b.utxoCache, neededSet)
 	b.chainLock.RUnlock()
 	return view, err
 }
@@ -647,7 +670,7 @@ func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error)
 	var entry *UtxoEntry
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
-		entry, err = dbFetchUtxoEntry(dbTx, outpoint)
+		entry, err = b.utxoCache.fetchEntry(dbTx, outpoint)
 		return err
 	})
 	if err != nil {
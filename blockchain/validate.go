@@ -34,6 +34,11 @@ const (
 	// used to calculate the median time used to validate block timestamps.
 	medianTimeBlocks = 11
 
+	// maxTimewarp is the maximum number of seconds the timestamp of the
+	// first block of a difficulty adjustment period may be before the
+	// timestamp of the previous block on networks that enforce BIP0094.
+	maxTimewarp = 600
+
 	// serializedHeightVersion is the block version which changed block
 	// coinbases to start with the serialized block height.
 	serializedHeightVersion = 2
@@ -41,6 +46,13 @@ const (
 	// baseSubsidy is the starting subsidy amount for mined blocks.  This
 	// value is halved every SubsidyHalvingInterval blocks.
 	baseSubsidy = 50 * btcutil.SatoshiPerBitcoin
+
+	// bip0034ImpliesBIP0030Limit is the first block height at which the
+	// serialized heights required by BIP0034 no longer prevent duplicate
+	// coinbases.  Some coinbases from before BIP0034 start with what is
+	// also a valid serialized height, the lowest of which is this height,
+	// so they could be duplicated by a block at that height.
+	bip0034ImpliesBIP0030Limit = 1983702
 )
 
 var (
@@ -181,6 +193,33 @@ func isBIP0030Node(node *blockNode) bool {
 	return false
 }
 
+// isBIP0030Enforced returns whether or not the passed node, which must not be
+// the genesis block, is subject to the BIP0030 rule which prevents transactions
+// from overwriting old ones that are not fully spent.
+//
+// The rule applies to all blocks except for the two blocks which violate it
+// and the blocks which descend from the block BIP0034 activated at.  Requiring
+// the block height in coinbases makes duplicate transactions impossible in the
+// latter, until the height at which coinbases from before BIP0034 could be
+// duplicated.  Note that the exception only applies to chains which contain the
+// known BIP0034 activation block as BIP0034 only guarantees unique coinbases in
+// combination with the blocks before it.
+func (b *BlockChain) isBIP0030Enforced(node *blockNode) bool {
+	if isBIP0030Node(node) {
+		return false
+	}
+	if node.height >= bip0034ImpliesBIP0030Limit {
+		return true
+	}
+
+	params := b.chainParams
+	if params.BIP0034Hash == nil {
+		return true
+	}
+	bip0034Node := node.parent.Ancestor(params.BIP0034Height)
+	return bip0034Node == nil || bip0034Node.hash != *params.BIP0034Hash
+}
+
 // CalcBlockSubsidy returns the subsidy amount a block at the provided height
 // should have. This is mainly used for determining how much the coinbase for
 // newly generated blocks awards as well as validating the coinbase for blocks
@@ -667,6 +706,24 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 			str = fmt.Sprintf(str, header.Timestamp, medianTime)
 			return ruleError(ErrTimeTooOld, str)
 		}
+
+		// Ensure the first block of a difficulty adjustment period
+		// isn't timestamped too far before the block that precedes it
+		// on networks that enforce the timewarp fix of BIP0094.
+		if b.chainParams.EnforceBIP94 &&
+			(prevNode.height+1)%b.blocksPerRetarget == 0 {
+
+			prevTime := time.Unix(prevNode.timestamp, 0)
+			minTime := prevTime.Add(-maxTimewarp * time.Second)
+			if header.Timestamp.Before(minTime) {
+				str := "block timestamp of %v at a difficulty " +
+					"adjustment is more than %d seconds " +
+					"before the previous block time of %v"
+				str = fmt.Sprintf(str, header.Timestamp,
+					maxTimewarp, prevTime)
+				return ruleError(ErrTimewarpAttack, str)
+			}
+		}
 	}
 
 	// The height of this block is one more than the referenced previous
@@ -840,7 +897,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *btcutil.Block, view *U
 			fetchSet[prevOut] = struct{}{}
 		}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(b.utxoCache, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -964,6 +1021,33 @@ func CheckTransactionInputs(tx *btcutil.Tx, txHeight int32, utxoView *UtxoViewpo
 	return txFeeInSatoshi, nil
 }
 
+// isAssumedValid returns whether or not the passed block node is the configured
+// assume valid block or one of its ancestors.  The assume valid block must be
+// known to the block index, not known to be invalid, and the header chain it
+// commits to must have at least as much work as the current best chain.  Since
+// headers are added to the index via ProcessBlockHeader before their blocks are
+// downloaded, this is typically decided from the header chain while the blocks
+// leading up to the assume valid block are still being connected.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+
+	assumeValidNode := b.index.LookupNode(b.assumeValid)
+	if assumeValidNode == nil ||
+		b.index.NodeStatus(assumeValidNode).KnownInvalid() {
+
+		return false
+	}
+	if assumeValidNode.workSum.Cmp(b.bestChain.Tip().workSum) < 0 {
+		return false
+	}
+
+	return assumeValidNode.Ancestor(node.height) == node
+}
+
 // checkConnectBlock performs several checks to confirm connecting the passed
 // block to the chain represented by the passed view does not violate any rules.
 // In addition, the passed view is updated to spend all of the referenced
@@ -1011,19 +1095,14 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	// transactions that 'overwrite' older transactions which are not fully
 	// spent.  See the documentation for checkBIP0030 for more details.
 	//
-	// There are two blocks in the chain which violate this rule, so the
-	// check must be skipped for those blocks.  The isBIP0030Node function
-	// is used to determine if this block is one of the two blocks that must
-	// be skipped.
-	//
-	// In addition, as of BIP0034, duplicate coinbases are no longer
-	// possible due to its requirement for including the block height in the
-	// coinbase and thus it is no longer possible to create transactions
-	// that 'overwrite' older ones.  Therefore, only enforce the rule if
-	// BIP0034 is not yet active.  This is a useful optimization because the
-	// BIP0030 check is expensive since it involves a ton of cache misses in
-	// the utxoset.
-	if !isBIP0030Node(node) && (node.height < b.chainParams.BIP0034Height) {
+	// There are two blocks in the chain which violate this rule, and as of
+	// BIP0034, duplicate coinbases are no longer possible due to its
+	// requirement for including the block height in the coinbase, so the
+	// check is skipped for those blocks.  See the documentation for
+	// isBIP0030Enforced for the precise conditions.  Skipping the check is
+	// also a useful optimization because it is expensive since it involves
+	// a ton of cache misses in the utxoset.
+	if b.isBIP0030Enforced(node) {
 		err := b.checkBIP0030(node, block, view)
 		if err != nil {
 			return err
@@ -1035,7 +1114,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := view.fetchInputUtxos(b.db, block)
+	err := view.fetchInputUtxos(b.utxoCache, block)
 	if err != nil {
 		return err
 	}
@@ -1152,6 +1231,12 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 		runScripts = false
 	}
 
+	// Likewise, don't run scripts for blocks that are ancestors of the
+	// block the caller assumes to be valid.
+	if runScripts && b.isAssumedValid(node) {
+		runScripts = false
+	}
+
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
 	var scriptFlags txscript.ScriptFlags
@@ -1218,6 +1303,14 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 		scriptFlags |= txscript.ScriptStrictMultiSig
 	}
 
+	// Enforce any additional script verification flags the chain was
+	// configured with once their activation height has been reached.
+	for _, activation := range b.scriptFlagActivations {
+		if node.height >= activation.Height {
+			scriptFlags |= activation.Flags
+		}
+	}
+
 	// Now that the inexpensive checks are done and have passed, verify the
 	// transactions are actually allowed to spend the coins by running the
 	// expensive ECDSA signature check scripts.  Doing this last helps
@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"fmt"
 	"math"
 	"reflect"
 	"testing"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
@@ -485,3 +487,583 @@ var Block100000 = wire.MsgBlock{
 		},
 	},
 }
+
+// TestCheckBlockHeaderContextTimewarp ensures the first block of a difficulty
+// period may not be timestamped more than the allowed amount before the block
+// that precedes it on networks that enforce BIP0094.
+func TestCheckBlockHeaderContextTimewarp(t *testing.T) {
+	tests := []struct {
+		name         string
+		enforceBIP94 bool
+		offset       time.Duration
+		wantErr      bool
+	}{
+		{
+			name:         "exactly at the limit",
+			enforceBIP94: true,
+			offset:       -maxTimewarp * time.Second,
+		},
+		{
+			name:         "past the limit",
+			enforceBIP94: true,
+			offset:       -(maxTimewarp + 1) * time.Second,
+			wantErr:      true,
+		},
+		{
+			name:         "past the limit without BIP0094",
+			enforceBIP94: false,
+			offset:       -(maxTimewarp + 1) * time.Second,
+		},
+	}
+	for _, test := range tests {
+		params := chaincfg.TestNet4Params
+		params.EnforceBIP94 = test.enforceBIP94
+		chain := newFakeChain(&params)
+
+		// Construct a chain up to the block before a difficulty
+		// adjustment with blocks ten minutes apart.
+		tip := chain.bestChain.Tip()
+		for i := int32(1); i < chain.blocksPerRetarget; i++ {
+			timestamp := time.Unix(tip.timestamp, 0).Add(10 * time.Minute)
+			tip = newFakeNode(tip, 4, params.PowLimitBits, timestamp)
+			chain.index.AddNode(tip)
+		}
+		chain.bestChain.SetTip(tip)
+
+		timestamp := time.Unix(tip.timestamp, 0).Add(test.offset)
+		bits, err := chain.calcNextRequiredDifficulty(tip, timestamp)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		header := wire.BlockHeader{
+			Version:   4,
+			PrevBlock: tip.hash,
+			Bits:      bits,
+			Timestamp: timestamp,
+		}
+		err = chain.checkBlockHeaderContext(&header, tip, BFNone)
+		if !test.wantErr {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrTimewarpAttack {
+			t.Fatalf("%s: unexpected error - got %v, want %v",
+				test.name, err, ErrTimewarpAttack)
+		}
+	}
+}
+
+// newTestBlock returns a block that builds on the passed parent with a coinbase
+// paying to an output that can be spent by anyone and another that can't be
+// spent by anyone, along with the passed transactions.  The block is solved for
+// the regression test network.
+func newTestBlock(t testing.TB, parent *wire.MsgBlock, height int32,
+	txns ...*wire.MsgTx) *wire.MsgBlock {
+
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(int64(len(txns))).Script()
+	if err != nil {
+		t.Fatalf("unable to create coinbase script: %v", err)
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(btcutil.SatoshiPerBitcoin,
+		[]byte{txscript.OP_TRUE}))
+	coinbase.AddTxOut(wire.NewTxOut(btcutil.SatoshiPerBitcoin,
+		[]byte{txscript.OP_FALSE}))
+
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   1,
+			PrevBlock: parent.BlockHash(),
+			Timestamp: parent.Header.Timestamp.Add(time.Minute),
+			Bits:      chaincfg.RegressionNetParams.PowLimitBits,
+		},
+	}
+	block.AddTransaction(coinbase)
+	for _, tx := range txns {
+		block.AddTransaction(tx)
+	}
+	utilTxns := btcutil.NewBlock(block).Transactions()
+	merkles := BuildMerkleTreeStore(utilTxns, false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	for {
+		err := checkProofOfWork(&block.Header, powLimit, BFNone)
+		if err == nil {
+			return block
+		}
+		block.Header.Nonce++
+	}
+}
+
+// newTestCoinbaseSpend returns a transaction that spends the output of the
+// coinbase of the passed block at the given index.
+func newTestCoinbaseSpend(block *wire.MsgBlock, index uint32) *wire.MsgTx {
+	coinbaseHash := block.Transactions[0].TxHash()
+	prevOut := wire.NewOutPoint(&coinbaseHash, index)
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(btcutil.SatoshiPerBitcoin/2,
+		[]byte{txscript.OP_TRUE}))
+	return tx
+}
+
+// TestAssumeValid ensures the scripts of blocks that are ancestors of the
+// assume valid block are not executed while the scripts of blocks after it
+// still are.
+func TestAssumeValid(t *testing.T) {
+	// Construct a main chain of three blocks along with a side chain that
+	// forks from the first block and contains a block that spends an
+	// output which can't be spent by anyone.  The side chain has more
+	// work, so processing its final block causes a reorganize which
+	// connects the invalid block.
+	//
+	//   genesis -> b1 -> a2 -> a3
+	//                \-> b2 (invalid script) -> b3 -> b4
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	a2 := newTestBlock(t, b1, 2)
+	a3 := newTestBlock(t, a2, 3)
+	b2 := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 1))
+	b3 := newTestBlock(t, b2, 3, newTestCoinbaseSpend(b1, 0))
+	b4 := newTestBlock(t, b3, 4)
+
+	b1Hash := b1.BlockHash()
+	b3Hash := b3.BlockHash()
+	tests := []struct {
+		name        string
+		assumeValid *chainhash.Hash
+		wantErr     bool
+	}{
+		{name: "no assume valid block", wantErr: true},
+		{name: "invalid block after assume valid", assumeValid: &b1Hash, wantErr: true},
+		{name: "invalid block before assume valid", assumeValid: &b3Hash},
+	}
+	for i, test := range tests {
+		chain, teardownFunc, err := chainSetup(
+			fmt.Sprintf("assumevalid%d", i),
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		chain.TstSetCoinbaseMaturity(1)
+		chain.assumeValid = test.assumeValid
+
+		for _, block := range []*wire.MsgBlock{b1, a2, a3, b2, b3} {
+			_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error processing block "+
+					"%v: %v", test.name, block.BlockHash(), err)
+			}
+		}
+
+		_, _, err = chain.ProcessBlock(btcutil.NewBlock(b4), BFNone)
+		teardownFunc()
+		if !test.wantErr {
+			if err != nil {
+				t.Fatalf("%s: unexpected error processing "+
+					"block: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrScriptValidation {
+			t.Fatalf("%s: unexpected error - got %v, want %v",
+				test.name, err, ErrScriptValidation)
+		}
+	}
+}
+
+// TestAssumeValidHeaders ensures the scripts of blocks that are connected in
+// height order up to the assume valid block are not executed when the headers
+// leading up to it were processed first, as is the case during a headers-first
+// initial block download, while the scripts of blocks after it still are.
+func TestAssumeValidHeaders(t *testing.T) {
+	// Construct a chain where both the block before the assume valid block
+	// and the block after it spend an output which can't be spent by
+	// anyone.
+	//
+	//   genesis -> b1 -> b2 (invalid script) -> b3 (assume valid) ->
+	//   b4 (invalid script)
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	b2 := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 1))
+	b3 := newTestBlock(t, b2, 3)
+	b4 := newTestBlock(t, b3, 4, newTestCoinbaseSpend(b3, 1))
+	blocks := []*wire.MsgBlock{b1, b2, b3, b4}
+
+	b3Hash := b3.BlockHash()
+	tests := []struct {
+		name           string
+		processHeaders bool
+		invalidBlock   *wire.MsgBlock
+	}{
+		{name: "headers unknown", invalidBlock: b2},
+		{name: "headers known", processHeaders: true, invalidBlock: b4},
+	}
+	for i, test := range tests {
+		chain, teardownFunc, err := chainSetup(
+			fmt.Sprintf("assumevalidheaders%d", i),
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		chain.TstSetCoinbaseMaturity(1)
+		chain.assumeValid = &b3Hash
+
+		if test.processHeaders {
+			for _, block := range blocks {
+				err := chain.ProcessBlockHeader(&block.Header,
+					BFNone)
+				if err != nil {
+					teardownFunc()
+					t.Fatalf("%s: unexpected error processing "+
+						"header %v: %v", test.name,
+						block.BlockHash(), err)
+				}
+			}
+		}
+
+		for _, block := range blocks {
+			_, _, err := chain.ProcessBlock(btcutil.NewBlock(block),
+				BFNone)
+			if block != test.invalidBlock {
+				if err != nil {
+					teardownFunc()
+					t.Fatalf("%s: unexpected error processing "+
+						"block %v: %v", test.name,
+						block.BlockHash(), err)
+				}
+				continue
+			}
+
+			rerr, ok := err.(RuleError)
+			if !ok || rerr.ErrorCode != ErrScriptValidation {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error processing "+
+					"block %v - got %v, want %v", test.name,
+					block.BlockHash(), err, ErrScriptValidation)
+			}
+			break
+		}
+
+		// The chain must end at the block before the one with the
+		// script that was executed.
+		wantTip := test.invalidBlock.Header.PrevBlock
+		best := chain.BestSnapshot()
+		teardownFunc()
+		if best.Hash != wantTip {
+			t.Fatalf("%s: unexpected best block - got %v, want %v",
+				test.name, best.Hash, wantTip)
+		}
+	}
+}
+
+// TestImmatureCoinbaseSpend ensures blocks which spend a coinbase output before
+// it reaches the coinbase maturity of the chain parameters are rejected while
+// blocks which spend it once it is mature are accepted.
+func TestImmatureCoinbaseSpend(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("immaturecoinbase",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(2)
+
+	// Construct a block with a coinbase to spend followed by a block that
+	// spends it before it is mature.
+	//
+	//   genesis -> b1 -> b2 (immature spend)
+	//                \-> b2a -> b3 (mature spend)
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	b2 := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 0))
+	b2a := newTestBlock(t, b1, 2)
+	b3 := newTestBlock(t, b2a, 3, newTestCoinbaseSpend(b1, 0))
+
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b1), BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock b1: unexpected error: %v", err)
+	}
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b2), BFNone)
+	rerr, ok := err.(RuleError)
+	if !ok || rerr.ErrorCode != ErrImmatureSpend {
+		t.Fatalf("ProcessBlock b2: unexpected error - got %v, want %v",
+			err, ErrImmatureSpend)
+	}
+
+	for _, block := range []*wire.MsgBlock{b2a, b3} {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.BlockHash(), err)
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != b3.BlockHash() {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			b3.BlockHash())
+	}
+}
+
+// TestIsBIP0030Enforced ensures the BIP0030 rule is enforced on the main
+// network for all blocks except the two historical blocks which violate it and
+// the blocks on the chain with the BIP0034 activation block below the height
+// at which duplicate coinbases become possible again.
+func TestIsBIP0030Enforced(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	chain := newFakeChain(params)
+
+	// newNode returns a fake node with the passed parent, height, and hash.
+	// The nodes between the node and its parent are left out since only
+	// the ancestors at specific heights are of interest.
+	newNode := func(parent *blockNode, height int32, hash *chainhash.Hash) *blockNode {
+		node := newFakeNode(parent, 1, params.PowLimitBits, time.Unix(0, 0))
+		node.height = height
+		node.hash = *hash
+		return node
+	}
+	otherHash := &chainhash.Hash{0x01}
+	genesis := chain.bestChain.Genesis()
+	bip0034Parent := newNode(genesis, params.BIP0034Height-1, otherHash)
+	bip0034Node := newNode(bip0034Parent, params.BIP0034Height,
+		params.BIP0034Hash)
+	otherBIP0034Node := newNode(bip0034Parent, params.BIP0034Height,
+		otherHash)
+
+	tests := []struct {
+		name string
+		node *blockNode
+		want bool
+	}{{
+		name: "first block",
+		node: newNode(genesis, 1, otherHash),
+		want: true,
+	}, {
+		name: "block 91842",
+		node: newNode(genesis, 91842, block91842Hash),
+		want: false,
+	}, {
+		name: "block 91880",
+		node: newNode(genesis, 91880, block91880Hash),
+		want: false,
+	}, {
+		name: "other block at height 91842",
+		node: newNode(genesis, 91842, otherHash),
+		want: true,
+	}, {
+		name: "block before BIP0034 activation",
+		node: bip0034Parent,
+		want: true,
+	}, {
+		name: "BIP0034 activation block",
+		node: bip0034Node,
+		want: true,
+	}, {
+		name: "other block at BIP0034 activation height",
+		node: otherBIP0034Node,
+		want: true,
+	}, {
+		name: "block after BIP0034 activation block",
+		node: newNode(bip0034Node, 300000, otherHash),
+		want: false,
+	}, {
+		name: "block after other block at BIP0034 activation height",
+		node: newNode(otherBIP0034Node, 300000, otherHash),
+		want: true,
+	}, {
+		name: "last block which can't duplicate older coinbases",
+		node: newNode(bip0034Node, bip0034ImpliesBIP0030Limit-1,
+			otherHash),
+		want: false,
+	}, {
+		name: "first block which can duplicate older coinbases",
+		node: newNode(bip0034Node, bip0034ImpliesBIP0030Limit,
+			otherHash),
+		want: true,
+	}}
+	for _, test := range tests {
+		if got := chain.isBIP0030Enforced(test.node); got != test.want {
+			t.Errorf("%s: unexpected result - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestDuplicateCoinbase reproduces the duplicate coinbases of the main network
+// and ensures a block with a coinbase that duplicates an older one is rejected
+// while the older coinbase is not fully spent and accepted once it is.
+func TestDuplicateCoinbase(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("duplicatecoinbase",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// withCoinbase replaces the coinbase of the passed block and solves it
+	// again.
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	withCoinbase := func(block *wire.MsgBlock, coinbase *wire.MsgTx) *wire.MsgBlock {
+		block.Transactions[0] = coinbase
+		utilTxns := btcutil.NewBlock(block).Transactions()
+		merkles := BuildMerkleTreeStore(utilTxns, false)
+		block.Header.MerkleRoot = *merkles[len(merkles)-1]
+		for checkProofOfWork(&block.Header, powLimit, BFNone) != nil {
+			block.Header.Nonce++
+		}
+		return block
+	}
+
+	// Construct a block with a coinbase whose outputs can both be spent
+	// followed by a block which duplicates it while it is unspent and a
+	// block which duplicates it after it is fully spent.
+	//
+	//   genesis -> b1 -> b2 (duplicate coinbase)
+	//                \-> b2a (spends coinbase) -> b3 (duplicate coinbase)
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	coinbase := b1.Transactions[0].Copy()
+	coinbase.TxOut[1].PkScript = []byte{txscript.OP_TRUE}
+	b1 = withCoinbase(b1, coinbase)
+	b2 := withCoinbase(newTestBlock(t, b1, 2), coinbase)
+	b2a := newTestBlock(t, b1, 2, newTestCoinbaseSpend(b1, 0),
+		newTestCoinbaseSpend(b1, 1))
+	b3 := withCoinbase(newTestBlock(t, b2a, 3), coinbase)
+
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b1), BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock b1: unexpected error: %v", err)
+	}
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b2), BFNone)
+	rerr, ok := err.(RuleError)
+	if !ok || rerr.ErrorCode != ErrOverwriteTx {
+		t.Fatalf("ProcessBlock b2: unexpected error - got %v, want %v",
+			err, ErrOverwriteTx)
+	}
+
+	for _, block := range []*wire.MsgBlock{b2a, b3} {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.BlockHash(), err)
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != b3.BlockHash() {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			b3.BlockHash())
+	}
+
+	// The outputs of the duplicate coinbase are unspent again.
+	entry, err := chain.FetchUtxoEntry(wire.OutPoint{
+		Hash:  coinbase.TxHash(),
+		Index: 1,
+	})
+	if err != nil {
+		t.Fatalf("FetchUtxoEntry: unexpected error: %v", err)
+	}
+	if entry == nil || entry.IsSpent() || entry.BlockHeight() != 3 {
+		t.Fatalf("unexpected utxo entry for duplicate coinbase %+v",
+			entry)
+	}
+}
+
+// TestScriptFlagActivations ensures additional script verification flags are
+// only enforced from their configured activation height and that they are only
+// allowed on the test networks.
+func TestScriptFlagActivations(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("scriptflagactivations",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Enforce NULLDUMMY, which is normally only enforced along with segwit,
+	// from the third block.
+	chain.scriptFlagActivations = []ScriptFlagActivation{{
+		Height: 3,
+		Flags:  txscript.ScriptStrictMultiSig,
+	}}
+
+	// Create a transaction with two zero-of-zero multisig outputs which
+	// can be spent with any dummy element unless NULLDUMMY is enforced.
+	multisigScript := []byte{txscript.OP_0, txscript.OP_0,
+		txscript.OP_CHECKMULTISIG}
+	spendMultisig := func(prevTx *wire.MsgTx, index uint32, dummy byte) *wire.MsgTx {
+		prevHash := prevTx.TxHash()
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, index),
+			[]byte{dummy}, nil))
+		tx.AddTxOut(wire.NewTxOut(btcutil.SatoshiPerBitcoin/8,
+			[]byte{txscript.OP_TRUE}))
+		return tx
+	}
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	b1 := newTestBlock(t, genesis, 1)
+	multisigTx := newTestCoinbaseSpend(b1, 0)
+	multisigTx.TxOut = []*wire.TxOut{
+		wire.NewTxOut(btcutil.SatoshiPerBitcoin/4, multisigScript),
+		wire.NewTxOut(btcutil.SatoshiPerBitcoin/4, multisigScript),
+	}
+
+	// Construct blocks which spend the multisig outputs with a non-null
+	// dummy before and after NULLDUMMY is enforced and with a null dummy
+	// after it is enforced.
+	//
+	//   genesis -> b1 -> b2 (non-null dummy) -> b3 (non-null dummy)
+	//                                       \-> b3a (null dummy)
+	b2 := newTestBlock(t, b1, 2, multisigTx,
+		spendMultisig(multisigTx, 0, txscript.OP_1))
+	b3 := newTestBlock(t, b2, 3, spendMultisig(multisigTx, 1, txscript.OP_1))
+	b3a := newTestBlock(t, b2, 3, spendMultisig(multisigTx, 1, txscript.OP_0))
+
+	for _, block := range []*wire.MsgBlock{b1, b2} {
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block), BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.BlockHash(), err)
+		}
+	}
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b3), BFNone)
+	rerr, ok := err.(RuleError)
+	if !ok || rerr.ErrorCode != ErrScriptValidation {
+		t.Fatalf("ProcessBlock b3: unexpected error - got %v, want %v",
+			err, ErrScriptValidation)
+	}
+	_, _, err = chain.ProcessBlock(btcutil.NewBlock(b3a), BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock b3a: unexpected error: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != b3a.BlockHash() {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			b3a.BlockHash())
+	}
+
+	// Additional script verification flags are rejected on the main
+	// network.
+	_, err = New(&Config{
+		DB:                    chain.db,
+		ChainParams:           &chaincfg.MainNetParams,
+		TimeSource:            NewMedianTime(),
+		ScriptFlagActivations: chain.scriptFlagActivations,
+	})
+	if _, ok := err.(AssertError); !ok {
+		t.Fatalf("New: unexpected error - got %v, want AssertError", err)
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/limits"
 )
 
@@ -135,6 +136,22 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropSpentIndex {
+		if err := indexers.DropSpentIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropCoinStatsIndex {
+		if err := indexers.DropCoinStatsIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropCfIndex {
 		if err := indexers.DropCfIndex(db, interrupt); err != nil {
 			btcdLog.Errorf("%v", err)
@@ -148,6 +165,12 @@ func btcdMain(serverChan chan<- *server) error {
 	server, err := newServer(cfg.Listeners, cfg.AgentBlacklist,
 		cfg.AgentWhitelist, db, activeNetParams.Params, interrupt)
 	if err != nil {
+		// Loading the chain stops early when interrupted, such as while
+		// reconstructing the utxo set, and resumes on the next start.
+		if interruptRequested(interrupt) {
+			return nil
+		}
+
 		// TODO: this logging could do with some beautifying.
 		btcdLog.Errorf("Unable to start server on %v: %v",
 			cfg.Listeners, err)
@@ -271,7 +294,18 @@ func loadBlockDB() (database.DB, error) {
 	removeRegressionDB(dbPath)
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	args := []interface{}{dbPath, activeNetParams.Net}
+	if cfg.DbType == "ffldb" {
+		syncMode := ffldb.SyncBatched
+		if cfg.DbSyncMode == "everyblock" {
+			syncMode = ffldb.SyncEveryBlock
+		}
+		args = append(args, &ffldb.Options{
+			FlushInterval: cfg.DbFlushInterval,
+			SyncMode:      syncMode,
+		})
+	}
+	db, err := database.Open(cfg.DbType, args...)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -286,7 +320,7 @@ func loadBlockDB() (database.DB, error) {
 		if err != nil {
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		db, err = database.Create(cfg.DbType, args...)
 		if err != nil {
 			return nil, err
 		}
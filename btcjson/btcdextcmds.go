@@ -8,6 +8,10 @@
 
 package btcjson
 
+import (
+	"github.com/btcsuite/btcd/wire"
+)
+
 // NodeSubCmd defines the type used in the addnode JSON-RPC command for the
 // sub command field.
 type NodeSubCmd string
@@ -128,6 +132,59 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// MatchFilterCmd defines the matchfilter JSON-RPC command.
+type MatchFilterCmd struct {
+	BlockHash  string
+	Items      []string
+	FilterType *wire.FilterType `jsonrpcdefault:"0"`
+}
+
+// NewMatchFilterCmd returns a new instance which can be used to issue a
+// matchfilter JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewMatchFilterCmd(blockHash string, items []string,
+	filterType *wire.FilterType) *MatchFilterCmd {
+
+	return &MatchFilterCmd{
+		BlockHash:  blockHash,
+		Items:      items,
+		FilterType: filterType,
+	}
+}
+
+// LoadMempoolCmd defines the loadmempool JSON-RPC command.
+type LoadMempoolCmd struct{}
+
+// NewLoadMempoolCmd returns a new instance which can be used to issue a
+// loadmempool JSON-RPC command.
+func NewLoadMempoolCmd() *LoadMempoolCmd {
+	return &LoadMempoolCmd{}
+}
+
+// ScanBlockFiltersCmd defines the scanblockfilters JSON-RPC command.
+type ScanBlockFiltersCmd struct {
+	BlockHash  string
+	Addresses  []string
+	FilterType *wire.FilterType `jsonrpcdefault:"0"`
+}
+
+// NewScanBlockFiltersCmd returns a new instance which can be used to issue a
+// scanblockfilters JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewScanBlockFiltersCmd(blockHash string, addresses []string,
+	filterType *wire.FilterType) *ScanBlockFiltersCmd {
+
+	return &ScanBlockFiltersCmd{
+		BlockHash:  blockHash,
+		Addresses:  addresses,
+		FilterType: filterType,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -152,5 +209,8 @@ func init() {
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("loadmempool", (*LoadMempoolCmd)(nil), flags)
+	MustRegisterCmd("matchfilter", (*MatchFilterCmd)(nil), flags)
+	MustRegisterCmd("scanblockfilters", (*ScanBlockFiltersCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
 )
 
 // TestBtcdExtCmds tests all of the btcd extended commands marshal and unmarshal
@@ -194,6 +195,91 @@ func TestBtcdExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "loadmempool",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("loadmempool")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewLoadMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"loadmempool","params":[],"id":1}`,
+			unmarshalled: &btcjson.LoadMempoolCmd{},
+		},
+		{
+			name: "matchfilter",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("matchfilter", "123", []string{"0011", "2233"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewMatchFilterCmd("123", []string{"0011", "2233"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"matchfilter","params":["123",["0011","2233"]],"id":1}`,
+			unmarshalled: &btcjson.MatchFilterCmd{
+				BlockHash: "123",
+				Items:     []string{"0011", "2233"},
+				FilterType: func() *wire.FilterType {
+					filterType := wire.GCSFilterRegular
+					return &filterType
+				}(),
+			},
+		},
+		{
+			name: "matchfilter optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("matchfilter", "123", []string{"0011"}, wire.GCSFilterRegular)
+			},
+			staticCmd: func() interface{} {
+				filterType := wire.GCSFilterRegular
+				return btcjson.NewMatchFilterCmd("123", []string{"0011"}, &filterType)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"matchfilter","params":["123",["0011"],0],"id":1}`,
+			unmarshalled: &btcjson.MatchFilterCmd{
+				BlockHash: "123",
+				Items:     []string{"0011"},
+				FilterType: func() *wire.FilterType {
+					filterType := wire.GCSFilterRegular
+					return &filterType
+				}(),
+			},
+		},
+		{
+			name: "scanblockfilters",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scanblockfilters", "123", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanBlockFiltersCmd("123", []string{"1Address"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scanblockfilters","params":["123",["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.ScanBlockFiltersCmd{
+				BlockHash: "123",
+				Addresses: []string{"1Address"},
+				FilterType: func() *wire.FilterType {
+					filterType := wire.GCSFilterRegular
+					return &filterType
+				}(),
+			},
+		},
+		{
+			name: "scanblockfilters optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scanblockfilters", "123", []string{"1Address"}, wire.GCSFilterRegular)
+			},
+			staticCmd: func() interface{} {
+				filterType := wire.GCSFilterRegular
+				return btcjson.NewScanBlockFiltersCmd("123", []string{"1Address"}, &filterType)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scanblockfilters","params":["123",["1Address"],0],"id":1}`,
+			unmarshalled: &btcjson.ScanBlockFiltersCmd{
+				BlockHash: "123",
+				Addresses: []string{"1Address"},
+				FilterType: func() *wire.FilterType {
+					filterType := wire.GCSFilterRegular
+					return &filterType
+				}(),
+			},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
@@ -18,3 +18,17 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// LoadMempoolResult models the data returned from the loadmempool command.
+type LoadMempoolResult struct {
+	Filename string `json:"filename"`
+	Restored int    `json:"restored"`
+}
+
+// ScanBlockFiltersResult models the data returned from the scanblockfilters
+// command.
+type ScanBlockFiltersResult struct {
+	FromHeight int32    `json:"fromheight"`
+	ToHeight   int32    `json:"toheight"`
+	Blocks     []string `json:"blocks"`
+}
@@ -47,6 +47,19 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// CombineRawTransactionCmd defines the combinerawtransaction JSON-RPC command.
+type CombineRawTransactionCmd struct {
+	Txs []string
+}
+
+// NewCombineRawTransactionCmd returns a new instance which can be used to issue
+// a combinerawtransaction JSON-RPC command.
+func NewCombineRawTransactionCmd(txs []string) *CombineRawTransactionCmd {
+	return &CombineRawTransactionCmd{
+		Txs: txs,
+	}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -121,6 +134,19 @@ func NewDeriveAddressesCmd(descriptor string, descriptorRange *DescriptorRange)
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path string
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+func NewDumpTxOutSetCmd(path string) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path: path,
+	}
+}
+
 // ChangeType defines the different output types to use for the change address
 // of a transaction built by the node.
 type ChangeType string
@@ -255,6 +281,21 @@ func NewGetBlockFilterCmd(blockHash string, filterType *FilterTypeName) *GetBloc
 	}
 }
 
+// GetBlockFromPeerCmd defines the getblockfrompeer JSON-RPC command.
+type GetBlockFromPeerCmd struct {
+	BlockHash string
+	PeerID    int32
+}
+
+// NewGetBlockFromPeerCmd returns a new instance which can be used to issue a
+// getblockfrompeer JSON-RPC command.
+func NewGetBlockFromPeerCmd(blockHash string, peerID int32) *GetBlockFromPeerCmd {
+	return &GetBlockFromPeerCmd{
+		BlockHash: blockHash,
+		PeerID:    peerID,
+	}
+}
+
 // GetBlockHashCmd defines the getblockhash JSON-RPC command.
 type GetBlockHashCmd struct {
 	Index int64
@@ -268,6 +309,34 @@ func NewGetBlockHashCmd(index int64) *GetBlockHashCmd {
 	}
 }
 
+// GetBlockHashByTimeCmd defines the getblockhashbytime JSON-RPC command.
+type GetBlockHashByTimeCmd struct {
+	Timestamp int64
+}
+
+// NewGetBlockHashByTimeCmd returns a new instance which can be used to issue a
+// getblockhashbytime JSON-RPC command.
+func NewGetBlockHashByTimeCmd(timestamp int64) *GetBlockHashByTimeCmd {
+	return &GetBlockHashByTimeCmd{
+		Timestamp: timestamp,
+	}
+}
+
+// GetBlockHashesCmd defines the getblockhashes JSON-RPC command.
+type GetBlockHashesCmd struct {
+	StartHeight int64
+	Count       int64
+}
+
+// NewGetBlockHashesCmd returns a new instance which can be used to issue a
+// getblockhashes JSON-RPC command.
+func NewGetBlockHashesCmd(startHeight, count int64) *GetBlockHashesCmd {
+	return &GetBlockHashesCmd{
+		StartHeight: startHeight,
+		Count:       count,
+	}
+}
+
 // GetBlockHeaderCmd defines the getblockheader JSON-RPC command.
 type GetBlockHeaderCmd struct {
 	Hash    string
@@ -450,6 +519,33 @@ func NewGetCFilterHeaderCmd(hash string,
 	}
 }
 
+// GetCFiltersCmd defines the getcfilters JSON-RPC command.
+type GetCFiltersCmd struct {
+	StartHeight uint32
+	StopHash    string
+	FilterType  wire.FilterType
+}
+
+// NewGetCFiltersCmd returns a new instance which can be used to issue a
+// getcfilters JSON-RPC command.
+func NewGetCFiltersCmd(startHeight uint32, stopHash string,
+	filterType wire.FilterType) *GetCFiltersCmd {
+	return &GetCFiltersCmd{
+		StartHeight: startHeight,
+		StopHash:    stopHash,
+		FilterType:  filterType,
+	}
+}
+
+// GetChainStatesCmd defines the getchainstates JSON-RPC command.
+type GetChainStatesCmd struct{}
+
+// NewGetChainStatesCmd returns a new instance which can be used to issue a
+// getchainstates JSON-RPC command.
+func NewGetChainStatesCmd() *GetChainStatesCmd {
+	return &GetChainStatesCmd{}
+}
+
 // GetChainTipsCmd defines the getchaintips JSON-RPC command.
 type GetChainTipsCmd struct{}
 
@@ -526,6 +622,22 @@ func NewGetHashesPerSecCmd() *GetHashesPerSecCmd {
 	return &GetHashesPerSecCmd{}
 }
 
+// GetIndexInfoCmd defines the getindexinfo JSON-RPC command.
+type GetIndexInfoCmd struct {
+	IndexName *string
+}
+
+// NewGetIndexInfoCmd returns a new instance which can be used to issue a
+// getindexinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetIndexInfoCmd(indexName *string) *GetIndexInfoCmd {
+	return &GetIndexInfoCmd{
+		IndexName: indexName,
+	}
+}
+
 // GetInfoCmd defines the getinfo JSON-RPC command.
 type GetInfoCmd struct{}
 
@@ -535,6 +647,22 @@ func NewGetInfoCmd() *GetInfoCmd {
 	return &GetInfoCmd{}
 }
 
+// GetMemoryInfoCmd defines the getmemoryinfo JSON-RPC command.
+type GetMemoryInfoCmd struct {
+	Mode *string `jsonrpcdefault:"\"stats\""`
+}
+
+// NewGetMemoryInfoCmd returns a new instance which can be used to issue a
+// getmemoryinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMemoryInfoCmd(mode *string) *GetMemoryInfoCmd {
+	return &GetMemoryInfoCmd{
+		Mode: mode,
+	}
+}
+
 // GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
 type GetMempoolEntryCmd struct {
 	TxID string
@@ -627,6 +755,15 @@ func NewGetPeerInfoCmd() *GetPeerInfoCmd {
 	return &GetPeerInfoCmd{}
 }
 
+// GetRawAddrManCmd defines the getrawaddrman JSON-RPC command.
+type GetRawAddrManCmd struct{}
+
+// NewGetRawAddrManCmd returns a new instance which can be used to issue a
+// getrawaddrman JSON-RPC command.
+func NewGetRawAddrManCmd() *GetRawAddrManCmd {
+	return &GetRawAddrManCmd{}
+}
+
 // GetRawMempoolCmd defines the getmempool JSON-RPC command.
 type GetRawMempoolCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -648,8 +785,9 @@ func NewGetRawMempoolCmd(verbose *bool) *GetRawMempoolCmd {
 // NOTE: This field is an int versus a bool to remain compatible with Bitcoin
 // Core even though it really should be a bool.
 type GetRawTransactionCmd struct {
-	Txid    string
-	Verbose *int `jsonrpcdefault:"0"`
+	Txid      string
+	Verbose   *int `jsonrpcdefault:"0"`
+	BlockHash *string
 }
 
 // NewGetRawTransactionCmd returns a new instance which can be used to issue a
@@ -664,6 +802,35 @@ func NewGetRawTransactionCmd(txHash string, verbose *int) *GetRawTransactionCmd
 	}
 }
 
+// NewGetRawTransactionInBlockCmd returns a new instance which can be used to
+// issue a getrawtransaction JSON-RPC command for a transaction in the block
+// with the passed hash.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetRawTransactionInBlockCmd(txHash string, verbose *int, blockHash string) *GetRawTransactionCmd {
+	return &GetRawTransactionCmd{
+		Txid:      txHash,
+		Verbose:   verbose,
+		BlockHash: &blockHash,
+	}
+}
+
+// GetSpentInfoCmd defines the getspentinfo JSON-RPC command.
+type GetSpentInfoCmd struct {
+	Txid string
+	Vout uint32
+}
+
+// NewGetSpentInfoCmd returns a new instance which can be used to issue a
+// getspentinfo JSON-RPC command.
+func NewGetSpentInfoCmd(txHash string, vout uint32) *GetSpentInfoCmd {
+	return &GetSpentInfoCmd{
+		Txid: txHash,
+		Vout: vout,
+	}
+}
+
 // GetTxOutCmd defines the gettxout JSON-RPC command.
 type GetTxOutCmd struct {
 	Txid           string
@@ -703,7 +870,9 @@ func NewGetTxOutProofCmd(txIDs []string, blockHash *string) *GetTxOutProofCmd {
 }
 
 // GetTxOutSetInfoCmd defines the gettxoutsetinfo JSON-RPC command.
-type GetTxOutSetInfoCmd struct{}
+type GetTxOutSetInfoCmd struct {
+	HashType *string `jsonrpcdefault:"\"hash_serialized_2\""`
+}
 
 // NewGetTxOutSetInfoCmd returns a new instance which can be used to issue a
 // gettxoutsetinfo JSON-RPC command.
@@ -711,6 +880,15 @@ func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
 	return &GetTxOutSetInfoCmd{}
 }
 
+// NewGetTxOutSetInfoHashTypeCmd returns a new instance which can be used to
+// issue a gettxoutsetinfo JSON-RPC command which reports the hash of the
+// passed type.
+func NewGetTxOutSetInfoHashTypeCmd(hashType string) *GetTxOutSetInfoCmd {
+	return &GetTxOutSetInfoCmd{
+		HashType: &hashType,
+	}
+}
+
 // GetWorkCmd defines the getwork JSON-RPC command.
 type GetWorkCmd struct {
 	Data *string
@@ -778,6 +956,23 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+type PrioritiseTransactionCmd struct {
+	Txid          string
+	PriorityDelta float64
+	FeeDelta      int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to
+// issue a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txHash string, priorityDelta float64, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		Txid:          txHash,
+		PriorityDelta: priorityDelta,
+		FeeDelta:      feeDelta,
+	}
+}
+
 // ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
 type ReconsiderBlockCmd struct {
 	BlockHash string
@@ -791,6 +986,15 @@ func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
 	}
 }
 
+// SaveMempoolCmd defines the savemempool JSON-RPC command.
+type SaveMempoolCmd struct{}
+
+// NewSaveMempoolCmd returns a new instance which can be used to issue a
+// savemempool JSON-RPC command.
+func NewSaveMempoolCmd() *SaveMempoolCmd {
+	return &SaveMempoolCmd{}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -885,6 +1089,31 @@ func NewSignMessageWithPrivKey(privKey, message string) *SignMessageWithPrivKeyC
 	}
 }
 
+// SignRawTransactionWithKeyCmd defines the signrawtransactionwithkey JSON-RPC
+// command.
+type SignRawTransactionWithKeyCmd struct {
+	RawTx       string
+	PrivKeys    []string // base 58 Wallet Import format private keys
+	Inputs      *[]RawTxWitnessInput
+	SigHashType *string `jsonrpcdefault:"\"ALL\""`
+}
+
+// NewSignRawTransactionWithKeyCmd returns a new instance which can be used to
+// issue a signrawtransactionwithkey JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSignRawTransactionWithKeyCmd(hexEncodedTx string, privKeys []string,
+	inputs *[]RawTxWitnessInput, sigHashType *string) *SignRawTransactionWithKeyCmd {
+
+	return &SignRawTransactionWithKeyCmd{
+		RawTx:       hexEncodedTx,
+		PrivKeys:    privKeys,
+		Inputs:      inputs,
+		SigHashType: sigHashType,
+	}
+}
+
 // StopCmd defines the stop JSON-RPC command.
 type StopCmd struct{}
 
@@ -919,6 +1148,19 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
+type TestMempoolAcceptCmd struct {
+	RawTxns []string
+}
+
+// NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
+// testmempoolaccept JSON-RPC command.
+func NewTestMempoolAcceptCmd(rawTxns []string) *TestMempoolAcceptCmd {
+	return &TestMempoolAcceptCmd{
+		RawTxns: rawTxns,
+	}
+}
+
 // UptimeCmd defines the uptime JSON-RPC command.
 type UptimeCmd struct{}
 
@@ -988,15 +1230,69 @@ func NewVerifyTxOutProofCmd(proof string) *VerifyTxOutProofCmd {
 	}
 }
 
+// WaitForBlockCmd defines the waitforblock JSON-RPC command.
+type WaitForBlockCmd struct {
+	BlockHash string
+	Timeout   *int `jsonrpcdefault:"0"`
+}
+
+// NewWaitForBlockCmd returns a new instance which can be used to issue a
+// waitforblock JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewWaitForBlockCmd(blockHash string, timeout *int) *WaitForBlockCmd {
+	return &WaitForBlockCmd{
+		BlockHash: blockHash,
+		Timeout:   timeout,
+	}
+}
+
+// WaitForBlockHeightCmd defines the waitforblockheight JSON-RPC command.
+type WaitForBlockHeightCmd struct {
+	Height  int32
+	Timeout *int `jsonrpcdefault:"0"`
+}
+
+// NewWaitForBlockHeightCmd returns a new instance which can be used to issue a
+// waitforblockheight JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewWaitForBlockHeightCmd(height int32, timeout *int) *WaitForBlockHeightCmd {
+	return &WaitForBlockHeightCmd{
+		Height:  height,
+		Timeout: timeout,
+	}
+}
+
+// WaitForNewBlockCmd defines the waitfornewblock JSON-RPC command.
+type WaitForNewBlockCmd struct {
+	Timeout *int `jsonrpcdefault:"0"`
+}
+
+// NewWaitForNewBlockCmd returns a new instance which can be used to issue a
+// waitfornewblock JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewWaitForNewBlockCmd(timeout *int) *WaitForNewBlockCmd {
+	return &WaitForNewBlockCmd{
+		Timeout: timeout,
+	}
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("combinerawtransaction", (*CombineRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("deriveaddresses", (*DeriveAddressesCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
@@ -1004,12 +1300,17 @@ func init() {
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockfilter", (*GetBlockFilterCmd)(nil), flags)
+	MustRegisterCmd("getblockfrompeer", (*GetBlockFromPeerCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
+	MustRegisterCmd("getblockhashbytime", (*GetBlockHashByTimeCmd)(nil), flags)
+	MustRegisterCmd("getblockhashes", (*GetBlockHashesCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
 	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
+	MustRegisterCmd("getcfilters", (*GetCFiltersCmd)(nil), flags)
+	MustRegisterCmd("getchainstates", (*GetChainStatesCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getchaintxstats", (*GetChainTxStatsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
@@ -1017,7 +1318,9 @@ func init() {
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
+	MustRegisterCmd("getindexinfo", (*GetIndexInfoCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getmemoryinfo", (*GetMemoryInfoCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
@@ -1026,8 +1329,10 @@ func init() {
 	MustRegisterCmd("getnetworkhashps", (*GetNetworkHashPSCmd)(nil), flags)
 	MustRegisterCmd("getnodeaddresses", (*GetNodeAddressesCmd)(nil), flags)
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
+	MustRegisterCmd("getrawaddrman", (*GetRawAddrManCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("getspentinfo", (*GetSpentInfoCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
@@ -1036,16 +1341,23 @@ func init() {
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("savemempool", (*SaveMempoolCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("signmessagewithprivkey", (*SignMessageWithPrivKeyCmd)(nil), flags)
+	MustRegisterCmd("signrawtransactionwithkey", (*SignRawTransactionWithKeyCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
 	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
 	MustRegisterCmd("verifytxoutproof", (*VerifyTxOutProofCmd)(nil), flags)
+	MustRegisterCmd("waitforblock", (*WaitForBlockCmd)(nil), flags)
+	MustRegisterCmd("waitforblockheight", (*WaitForBlockHeightCmd)(nil), flags)
+	MustRegisterCmd("waitfornewblock", (*WaitForNewBlockCmd)(nil), flags)
 }
@@ -42,6 +42,19 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "combinerawtransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("combinerawtransaction", []string{"0011", "0022"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCombineRawTransactionCmd([]string{"0011", "0022"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"combinerawtransaction","params":[["0011","0022"]],"id":1}`,
+			unmarshalled: &btcjson.CombineRawTransactionCmd{
+				Txs: []string{"0011", "0022"},
+			},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -265,6 +278,17 @@ func TestChainSvrCmds(t *testing.T) {
 				Range:      &btcjson.DescriptorRange{Value: []int{0, 2}},
 			},
 		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &btcjson.DumpTxOutSetCmd{Path: "utxo.dat"},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -401,6 +425,20 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getblockfilter","params":["0000afaf","basic"],"id":1}`,
 			unmarshalled: &btcjson.GetBlockFilterCmd{"0000afaf", btcjson.NewFilterTypeName(btcjson.FilterTypeBasic)},
 		},
+		{
+			name: "getblockfrompeer",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockfrompeer", "0000afaf", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockFromPeerCmd("0000afaf", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockfrompeer","params":["0000afaf",1],"id":1}`,
+			unmarshalled: &btcjson.GetBlockFromPeerCmd{
+				BlockHash: "0000afaf",
+				PeerID:    1,
+			},
+		},
 		{
 			name: "getblockhash",
 			newCmd: func() (interface{}, error) {
@@ -412,6 +450,31 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getblockhash","params":[123],"id":1}`,
 			unmarshalled: &btcjson.GetBlockHashCmd{Index: 123},
 		},
+		{
+			name: "getblockhashbytime",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockhashbytime", 1231006505)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockHashByTimeCmd(1231006505)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getblockhashbytime","params":[1231006505],"id":1}`,
+			unmarshalled: &btcjson.GetBlockHashByTimeCmd{Timestamp: 1231006505},
+		},
+		{
+			name: "getblockhashes",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockhashes", 100, 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockHashesCmd(100, 10)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockhashes","params":[100,10],"id":1}`,
+			unmarshalled: &btcjson.GetBlockHashesCmd{
+				StartHeight: 100,
+				Count:       10,
+			},
+		},
 		{
 			name: "getblockheader",
 			newCmd: func() (interface{}, error) {
@@ -595,6 +658,34 @@ func TestChainSvrCmds(t *testing.T) {
 				FilterType: wire.GCSFilterRegular,
 			},
 		},
+		{
+			name: "getcfilters",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfilters", 1, "123",
+					wire.GCSFilterRegular)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFiltersCmd(1, "123",
+					wire.GCSFilterRegular)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcfilters","params":[1,"123",0],"id":1}`,
+			unmarshalled: &btcjson.GetCFiltersCmd{
+				StartHeight: 1,
+				StopHash:    "123",
+				FilterType:  wire.GCSFilterRegular,
+			},
+		},
+		{
+			name: "getchainstates",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getchainstates")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetChainStatesCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getchainstates","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetChainStatesCmd{},
+		},
 		{
 			name: "getchaintips",
 			newCmd: func() (interface{}, error) {
@@ -688,6 +779,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"gethashespersec","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetHashesPerSecCmd{},
 		},
+		{
+			name: "getindexinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getindexinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetIndexInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getindexinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetIndexInfoCmd{},
+		},
+		{
+			name: "getindexinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getindexinfo", "txindex")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetIndexInfoCmd(btcjson.String("txindex"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getindexinfo","params":["txindex"],"id":1}`,
+			unmarshalled: &btcjson.GetIndexInfoCmd{
+				IndexName: btcjson.String("txindex"),
+			},
+		},
 		{
 			name: "getinfo",
 			newCmd: func() (interface{}, error) {
@@ -699,6 +814,32 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetInfoCmd{},
 		},
+		{
+			name: "getmemoryinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmemoryinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMemoryInfoCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmemoryinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMemoryInfoCmd{
+				Mode: btcjson.String("stats"),
+			},
+		},
+		{
+			name: "getmemoryinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmemoryinfo", "stats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMemoryInfoCmd(btcjson.String("stats"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmemoryinfo","params":["stats"],"id":1}`,
+			unmarshalled: &btcjson.GetMemoryInfoCmd{
+				Mode: btcjson.String("stats"),
+			},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -835,6 +976,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getpeerinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetPeerInfoCmd{},
 		},
+		{
+			name: "getrawaddrman",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrawaddrman")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRawAddrManCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrawaddrman","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetRawAddrManCmd{},
+		},
 		{
 			name: "getrawmempool",
 			newCmd: func() (interface{}, error) {
@@ -889,6 +1041,36 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Int(1),
 			},
 		},
+		{
+			name: "getrawtransaction optional blockhash",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrawtransaction", "123", 1, "456")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRawTransactionInBlockCmd("123",
+					btcjson.Int(1), "456")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getrawtransaction","params":["123",1,"456"],"id":1}`,
+			unmarshalled: &btcjson.GetRawTransactionCmd{
+				Txid:      "123",
+				Verbose:   btcjson.Int(1),
+				BlockHash: btcjson.String("456"),
+			},
+		},
+		{
+			name: "getspentinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getspentinfo", "123", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetSpentInfoCmd("123", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getspentinfo","params":["123",1],"id":1}`,
+			unmarshalled: &btcjson.GetSpentInfoCmd{
+				Txid: "123",
+				Vout: 1,
+			},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -957,8 +1139,23 @@ func TestChainSvrCmds(t *testing.T) {
 			staticCmd: func() interface{} {
 				return btcjson.NewGetTxOutSetInfoCmd()
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
-			unmarshalled: &btcjson.GetTxOutSetInfoCmd{},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType: btcjson.String("hash_serialized_2"),
+			},
+		},
+		{
+			name: "gettxoutsetinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxoutsetinfo", "none")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTxOutSetInfoHashTypeCmd("none")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":["none"],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType: btcjson.String("none"),
+			},
 		},
 		{
 			name: "getwork",
@@ -1049,6 +1246,21 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "123", 0.0, 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("123", 0, 1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0,1000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				Txid:          "123",
+				PriorityDelta: 0,
+				FeeDelta:      1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -1062,6 +1274,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "savemempool",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("savemempool")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSaveMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"savemempool","params":[],"id":1}`,
+			unmarshalled: &btcjson.SaveMempoolCmd{},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -1291,6 +1514,55 @@ func TestChainSvrCmds(t *testing.T) {
 				Message: "Hey",
 			},
 		},
+		{
+			name: "signrawtransactionwithkey",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("signrawtransactionwithkey", "001122", []string{"5Hue"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSignRawTransactionWithKeyCmd("001122", []string{"5Hue"}, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"signrawtransactionwithkey","params":["001122",["5Hue"]],"id":1}`,
+			unmarshalled: &btcjson.SignRawTransactionWithKeyCmd{
+				RawTx:       "001122",
+				PrivKeys:    []string{"5Hue"},
+				Inputs:      nil,
+				SigHashType: btcjson.String("ALL"),
+			},
+		},
+		{
+			name: "signrawtransactionwithkey optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("signrawtransactionwithkey", "001122", []string{"5Hue"},
+					`[{"txid":"123","vout":1,"scriptPubKey":"00","amount":0.5}]`, "NONE")
+			},
+			staticCmd: func() interface{} {
+				txInputs := []btcjson.RawTxWitnessInput{
+					{
+						Txid:         "123",
+						Vout:         1,
+						ScriptPubKey: "00",
+						Amount:       btcjson.Float64(0.5),
+					},
+				}
+				return btcjson.NewSignRawTransactionWithKeyCmd("001122", []string{"5Hue"},
+					&txInputs, btcjson.String("NONE"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"signrawtransactionwithkey","params":["001122",["5Hue"],[{"txid":"123","vout":1,"scriptPubKey":"00","amount":0.5}],"NONE"],"id":1}`,
+			unmarshalled: &btcjson.SignRawTransactionWithKeyCmd{
+				RawTx:    "001122",
+				PrivKeys: []string{"5Hue"},
+				Inputs: &[]btcjson.RawTxWitnessInput{
+					{
+						Txid:         "123",
+						Vout:         1,
+						ScriptPubKey: "00",
+						Amount:       btcjson.Float64(0.5),
+					},
+				},
+				SigHashType: btcjson.String("NONE"),
+			},
+		},
 		{
 			name: "stop",
 			newCmd: func() (interface{}, error) {
@@ -1335,6 +1607,19 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("testmempoolaccept", `["1122","3344"]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTestMempoolAcceptCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.TestMempoolAcceptCmd{
+				RawTxns: []string{"1122", "3344"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -1429,6 +1714,88 @@ func TestChainSvrCmds(t *testing.T) {
 				Proof: "test",
 			},
 		},
+		{
+			name: "waitforblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblock", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblock","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockCmd{
+				BlockHash: "123",
+				Timeout:   btcjson.Int(0),
+			},
+		},
+		{
+			name: "waitforblock optional timeout",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblock", "123", 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockCmd("123", btcjson.Int(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblock","params":["123",1000],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockCmd{
+				BlockHash: "123",
+				Timeout:   btcjson.Int(1000),
+			},
+		},
+		{
+			name: "waitforblockheight",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblockheight", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockHeightCmd(100, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblockheight","params":[100],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockHeightCmd{
+				Height:  100,
+				Timeout: btcjson.Int(0),
+			},
+		},
+		{
+			name: "waitforblockheight optional timeout",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblockheight", 100, 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockHeightCmd(100, btcjson.Int(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblockheight","params":[100,1000],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockHeightCmd{
+				Height:  100,
+				Timeout: btcjson.Int(1000),
+			},
+		},
+		{
+			name: "waitfornewblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitfornewblock")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForNewBlockCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitfornewblock","params":[],"id":1}`,
+			unmarshalled: &btcjson.WaitForNewBlockCmd{
+				Timeout: btcjson.Int(0),
+			},
+		},
+		{
+			name: "waitfornewblock optional timeout",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitfornewblock", 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForNewBlockCmd(btcjson.Int(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitfornewblock","params":[1000],"id":1}`,
+			unmarshalled: &btcjson.WaitForNewBlockCmd{
+				Timeout: btcjson.Int(1000),
+			},
+		},
 		{
 			name: "getdescriptorinfo",
 			newCmd: func() (interface{}, error) {
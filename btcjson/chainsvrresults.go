@@ -29,6 +29,7 @@ type GetBlockHeaderVerboseResult struct {
 	Nonce         uint64  `json:"nonce"`
 	Bits          string  `json:"bits"`
 	Difficulty    float64 `json:"difficulty"`
+	ChainWork     string  `json:"chainwork"`
 	PreviousHash  string  `json:"previousblockhash,omitempty"`
 	NextHash      string  `json:"nextblockhash,omitempty"`
 }
@@ -82,7 +83,7 @@ type GetBlockVerboseResult struct {
 	VersionHex    string        `json:"versionHex"`
 	MerkleRoot    string        `json:"merkleroot"`
 	Tx            []string      `json:"tx,omitempty"`
-	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose != 2.
+	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Deprecated: getblock returns GetBlockVerboseTxResult when verbose=2.
 	Time          int64         `json:"time"`
 	Nonce         uint32        `json:"nonce"`
 	Bits          string        `json:"bits"`
@@ -142,6 +143,16 @@ type DecodeScriptResult struct {
 	Type      string   `json:"type"`
 	Addresses []string `json:"addresses,omitempty"`
 	P2sh      string   `json:"p2sh,omitempty"`
+	P2wsh     string   `json:"p2wsh,omitempty"`
+}
+
+// DumpTxOutSetResult models the data returned from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten int64  `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
 }
 
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
@@ -221,6 +232,7 @@ type GetBlockChainInfoResult struct {
 	Difficulty           float64 `json:"difficulty"`
 	MedianTime           int64   `json:"mediantime"`
 	VerificationProgress float64 `json:"verificationprogress,omitempty"`
+	SizeOnDisk           int64   `json:"size_on_disk"`
 	Pruned               bool    `json:"pruned"`
 	PruneHeight          int32   `json:"pruneheight,omitempty"`
 	ChainWork            string  `json:"chainwork,omitempty"`
@@ -228,6 +240,26 @@ type GetBlockChainInfoResult struct {
 	*UnifiedSoftForks
 }
 
+// ChainStateResult models the data of a single chainstate returned from the
+// getchainstates command.
+type ChainStateResult struct {
+	Blocks               int32   `json:"blocks"`
+	BestBlockHash        string  `json:"bestblockhash"`
+	Difficulty           float64 `json:"difficulty"`
+	VerificationProgress float64 `json:"verificationprogress"`
+	Coins                int64   `json:"coins"`
+	SnapshotBlockHash    string  `json:"snapshot_blockhash,omitempty"`
+	Validated            bool    `json:"validated"`
+}
+
+// GetChainStatesResult models the data returned from the getchainstates
+// command.  The fully validated chainstate is always reported first, followed
+// by the chainstate built from a utxo snapshot, if any.
+type GetChainStatesResult struct {
+	Headers     int32              `json:"headers"`
+	ChainStates []ChainStateResult `json:"chainstates"`
+}
+
 // GetBlockFilterResult models the data returned from the getblockfilter
 // command.
 type GetBlockFilterResult struct {
@@ -235,6 +267,13 @@ type GetBlockFilterResult struct {
 	Header string `json:"header"` // the hex-encoded filter header
 }
 
+// GetCFiltersResult models the data of each of the filters returned from the
+// getcfilters command.
+type GetCFiltersResult struct {
+	BlockHash string `json:"blockhash"`
+	Filter    string `json:"filter"` // the hex-encoded filter data
+}
+
 // GetBlockTemplateResultTx models the transactions field of the
 // getblocktemplate command.
 type GetBlockTemplateResultTx struct {
@@ -293,6 +332,19 @@ type GetBlockTemplateResult struct {
 	// Block proposal from BIP 0023.
 	Capabilities  []string `json:"capabilities,omitempty"`
 	RejectReasion string   `json:"reject-reason,omitempty"`
+
+	// Rules and version bits deployments from BIP 0009.
+	Rules       []string          `json:"rules,omitempty"`
+	VbAvailable map[string]uint32 `json:"vbavailable,omitempty"`
+}
+
+// GetIndexInfoResult models the data returned for each index by the
+// getindexinfo command.
+type GetIndexInfoResult struct {
+	Enabled         bool  `json:"enabled"`
+	Synced          bool  `json:"synced"`
+	BestBlockHeight int32 `json:"best_block_height"`
+	CatchingUp      bool  `json:"catching_up"`
 }
 
 // GetMempoolEntryResult models the data returned from the getmempoolentry's
@@ -326,6 +378,27 @@ type GetMempoolEntryResult struct {
 	Depends         []string    `json:"depends"`
 }
 
+// GetMemoryInfoResult models the data returned from the getmemoryinfo command.
+// The runtime statistics are in bytes unless stated otherwise.
+type GetMemoryInfoResult struct {
+	HeapAlloc        uint64 `json:"heapalloc"`
+	HeapInuse        uint64 `json:"heapinuse"`
+	HeapSys          uint64 `json:"heapsys"`
+	HeapObjects      uint64 `json:"heapobjects"`
+	TotalAlloc       uint64 `json:"totalalloc"`
+	Sys              uint64 `json:"sys"`
+	NumGC            uint32 `json:"numgc"`
+	PauseTotalNs     uint64 `json:"pausetotalns"`
+	Goroutines       int    `json:"goroutines"`
+	UtxoCacheEntries int    `json:"utxocacheentries"`
+	UtxoCacheSize    uint64 `json:"utxocachesize"`
+	SigCacheEntries  int    `json:"sigcacheentries"`
+	HashCacheEntries int    `json:"hashcacheentries"`
+	MempoolSize      int    `json:"mempoolsize"`
+	MempoolBytes     int64  `json:"mempoolbytes"`
+	OrphanPoolSize   int    `json:"orphanpoolsize"`
+}
+
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
@@ -360,6 +433,8 @@ type GetNetworkInfoResult struct {
 	LocalRelay      bool                   `json:"localrelay"`
 	TimeOffset      int64                  `json:"timeoffset"`
 	Connections     int32                  `json:"connections"`
+	ConnectionsIn   int32                  `json:"connections_in"`
+	ConnectionsOut  int32                  `json:"connections_out"`
 	NetworkActive   bool                   `json:"networkactive"`
 	Networks        []NetworksResult       `json:"networks"`
 	RelayFee        float64                `json:"relayfee"`
@@ -378,6 +453,29 @@ type GetNodeAddressesResult struct {
 	Port     uint16 `json:"port"`     // The port of the node
 }
 
+// RawAddrManEntry models an address of the address manager returned by the
+// getrawaddrman command.
+type RawAddrManEntry struct {
+	Address       string `json:"address"`
+	Port          uint16 `json:"port"`
+	Services      uint64 `json:"services"`
+	Time          int64  `json:"time"`
+	Network       string `json:"network"`
+	Source        string `json:"source"`
+	SourceNetwork string `json:"source_network"`
+	Attempts      int    `json:"attempts"`
+	LastTry       int64  `json:"lasttry"`
+	LastSuccess   int64  `json:"lastsuccess"`
+}
+
+// GetRawAddrManResult models the data returned from the getrawaddrman command.
+// The addresses of the new and tried tables are keyed by their bucket and
+// position within the bucket in the form bucket/position.
+type GetRawAddrManResult struct {
+	New   map[string]RawAddrManEntry `json:"new"`
+	Tried map[string]RawAddrManEntry `json:"tried"`
+}
+
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
 	ID             int32   `json:"id"`
@@ -396,6 +494,8 @@ type GetPeerInfoResult struct {
 	Version        uint32  `json:"version"`
 	SubVer         string  `json:"subver"`
 	Inbound        bool    `json:"inbound"`
+	AddNode        bool    `json:"addnode"`
+	ConnectionType string  `json:"connection_type"`
 	StartingHeight int32   `json:"startingheight"`
 	CurrentHeight  int32   `json:"currentheight,omitempty"`
 	BanScore       int32   `json:"banscore"`
@@ -428,6 +528,13 @@ type ScriptPubKeyResult struct {
 	Addresses []string `json:"addresses,omitempty"`
 }
 
+// GetSpentInfoResult models the data from the getspentinfo command.
+type GetSpentInfoResult struct {
+	TxID   string `json:"txid"`
+	Index  uint32 `json:"index"`
+	Height int32  `json:"height"`
+}
+
 // GetTxOutResult models the data from the gettxout command.
 type GetTxOutResult struct {
 	BestBlock     string             `json:"bestblock"`
@@ -445,6 +552,7 @@ type GetTxOutSetInfoResult struct {
 	TxOuts         int64          `json:"txouts"`
 	BogoSize       int64          `json:"bogosize"`
 	HashSerialized chainhash.Hash `json:"hash_serialized_2"`
+	ECMH           chainhash.Hash `json:"ecmh"`
 	DiskSize       int64          `json:"disk_size"`
 	TotalAmount    btcutil.Amount `json:"total_amount"`
 }
@@ -459,6 +567,7 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	aux := &struct {
 		BestBlock      string  `json:"bestblock"`
 		HashSerialized string  `json:"hash_serialized_2"`
+		ECMH           string  `json:"ecmh"`
 		TotalAmount    float64 `json:"total_amount"`
 		*Alias
 	}{
@@ -485,6 +594,13 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 
 	g.HashSerialized = *serializedHash
 
+	ecmh, err := chainhash.NewHashFromStr(aux.ECMH)
+	if err != nil {
+		return err
+	}
+
+	g.ECMH = *ecmh
+
 	amount, err := btcutil.NewAmount(aux.TotalAmount)
 	if err != nil {
 		return err
@@ -495,6 +611,42 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON marshals the result of the gettxoutsetinfo JSON-RPC call.  The
+// hashes are encoded as strings and the total amount in BTC, which mirrors
+// UnmarshalJSON.  The hashes are omitted when they are not set, and so are the
+// number of transactions and the disk size since they are unknown when the
+// statistics come from the coin stats index.
+func (g GetTxOutSetInfoResult) MarshalJSON() ([]byte, error) {
+	var hashSerialized, ecmh string
+	if g.HashSerialized != (chainhash.Hash{}) {
+		hashSerialized = g.HashSerialized.String()
+	}
+	if g.ECMH != (chainhash.Hash{}) {
+		ecmh = g.ECMH.String()
+	}
+	return json.Marshal(&struct {
+		Height         int64   `json:"height"`
+		BestBlock      string  `json:"bestblock"`
+		Transactions   int64   `json:"transactions,omitempty"`
+		TxOuts         int64   `json:"txouts"`
+		BogoSize       int64   `json:"bogosize"`
+		HashSerialized string  `json:"hash_serialized_2,omitempty"`
+		ECMH           string  `json:"ecmh,omitempty"`
+		DiskSize       int64   `json:"disk_size,omitempty"`
+		TotalAmount    float64 `json:"total_amount"`
+	}{
+		Height:         g.Height,
+		BestBlock:      g.BestBlock.String(),
+		Transactions:   g.Transactions,
+		TxOuts:         g.TxOuts,
+		BogoSize:       g.BogoSize,
+		HashSerialized: hashSerialized,
+		ECMH:           ecmh,
+		DiskSize:       g.DiskSize,
+		TotalAmount:    g.TotalAmount.ToBTC(),
+	})
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
 	TotalBytesRecv uint64 `json:"totalbytesrecv"`
@@ -513,6 +665,9 @@ type ScriptSig struct {
 // Vin models parts of the tx data.  It is defined separately since
 // getrawtransaction, decoderawtransaction, and searchrawtransaction use the
 // same structure.
+//
+// PrevOut is only set when the details of the spent output are known, such as
+// for the transactions returned by getblock when verbose=2.
 type Vin struct {
 	Coinbase  string     `json:"coinbase"`
 	Txid      string     `json:"txid"`
@@ -520,6 +675,7 @@ type Vin struct {
 	ScriptSig *ScriptSig `json:"scriptSig"`
 	Sequence  uint32     `json:"sequence"`
 	Witness   []string   `json:"txinwitness"`
+	PrevOut   *PrevOut   `json:"prevout,omitempty"`
 }
 
 // IsCoinBase returns a bool to show if a Vin is a Coinbase one or not.
@@ -554,12 +710,14 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 			Vout      uint32     `json:"vout"`
 			ScriptSig *ScriptSig `json:"scriptSig"`
 			Witness   []string   `json:"txinwitness"`
+			PrevOut   *PrevOut   `json:"prevout,omitempty"`
 			Sequence  uint32     `json:"sequence"`
 		}{
 			Txid:      v.Txid,
 			Vout:      v.Vout,
 			ScriptSig: v.ScriptSig,
 			Witness:   v.Witness,
+			PrevOut:   v.PrevOut,
 			Sequence:  v.Sequence,
 		}
 		return json.Marshal(txStruct)
@@ -569,11 +727,13 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 		Txid      string     `json:"txid"`
 		Vout      uint32     `json:"vout"`
 		ScriptSig *ScriptSig `json:"scriptSig"`
+		PrevOut   *PrevOut   `json:"prevout,omitempty"`
 		Sequence  uint32     `json:"sequence"`
 	}{
 		Txid:      v.Txid,
 		Vout:      v.Vout,
 		ScriptSig: v.ScriptSig,
+		PrevOut:   v.PrevOut,
 		Sequence:  v.Sequence,
 	}
 	return json.Marshal(txStruct)
@@ -666,9 +826,9 @@ type Vout struct {
 // GetMiningInfoResult models the data from the getmininginfo command.
 type GetMiningInfoResult struct {
 	Blocks             int64   `json:"blocks"`
-	CurrentBlockSize   uint64  `json:"currentblocksize"`
-	CurrentBlockWeight uint64  `json:"currentblockweight"`
-	CurrentBlockTx     uint64  `json:"currentblocktx"`
+	CurrentBlockSize   uint64  `json:"currentblocksize,omitempty"`
+	CurrentBlockWeight uint64  `json:"currentblockweight,omitempty"`
+	CurrentBlockTx     uint64  `json:"currentblocktx,omitempty"`
 	Difficulty         float64 `json:"difficulty"`
 	Errors             string  `json:"errors"`
 	Generate           bool    `json:"generate"`
@@ -676,6 +836,7 @@ type GetMiningInfoResult struct {
 	HashesPerSec       int64   `json:"hashespersec"`
 	NetworkHashPS      int64   `json:"networkhashps"`
 	PooledTx           uint64  `json:"pooledtx"`
+	Chain              string  `json:"chain"`
 	TestNet            bool    `json:"testnet"`
 }
 
@@ -702,21 +863,32 @@ type InfoChainResult struct {
 }
 
 // TxRawResult models the data from the getrawtransaction command.
+//
+// Fee is only set when the values of all of the outputs spent by the
+// transaction are known.  InActiveChain is only set when the transaction is
+// looked up in a specific block.
 type TxRawResult struct {
-	Hex           string `json:"hex"`
-	Txid          string `json:"txid"`
-	Hash          string `json:"hash,omitempty"`
-	Size          int32  `json:"size,omitempty"`
-	Vsize         int32  `json:"vsize,omitempty"`
-	Weight        int32  `json:"weight,omitempty"`
-	Version       int32  `json:"version"`
-	LockTime      uint32 `json:"locktime"`
-	Vin           []Vin  `json:"vin"`
-	Vout          []Vout `json:"vout"`
-	BlockHash     string `json:"blockhash,omitempty"`
-	Confirmations uint64 `json:"confirmations,omitempty"`
-	Time          int64  `json:"time,omitempty"`
-	Blocktime     int64  `json:"blocktime,omitempty"`
+	Hex           string   `json:"hex"`
+	Txid          string   `json:"txid"`
+	Hash          string   `json:"hash,omitempty"`
+	Size          int32    `json:"size,omitempty"`
+	Vsize         int32    `json:"vsize,omitempty"`
+	Weight        int32    `json:"weight,omitempty"`
+	Version       int32    `json:"version"`
+	LockTime      uint32   `json:"locktime"`
+	Vin           []Vin    `json:"vin"`
+	Vout          []Vout   `json:"vout"`
+	Fee           *float64 `json:"fee,omitempty"`
+	BlockHash     string   `json:"blockhash,omitempty"`
+	Confirmations uint64   `json:"confirmations,omitempty"`
+	Time          int64    `json:"time,omitempty"`
+	Blocktime     int64    `json:"blocktime,omitempty"`
+	InActiveChain *bool    `json:"in_active_chain,omitempty"`
+}
+
+// SaveMempoolResult models the data from the savemempool command.
+type SaveMempoolResult struct {
+	Filename string `json:"filename"`
 }
 
 // SearchRawTransactionsResult models the data from the searchrawtransaction
@@ -738,10 +910,41 @@ type SearchRawTransactionsResult struct {
 	Blocktime     int64        `json:"blocktime,omitempty"`
 }
 
+// SignRawTransactionWithKeyResult models the data from the
+// signrawtransactionwithkey command.  Errors contains an entry for every input
+// that is not fully signed.
+type SignRawTransactionWithKeyResult struct {
+	Hex      string                    `json:"hex"`
+	Complete bool                      `json:"complete"`
+	Errors   []SignRawTransactionError `json:"errors,omitempty"`
+}
+
+// TestMempoolAcceptFees models the fees of a transaction returned by the
+// testmempoolaccept command.
+type TestMempoolAcceptFees struct {
+	Base float64 `json:"base"`
+}
+
+// TestMempoolAcceptResult models the data from the testmempoolaccept command
+// for a single transaction.  The size, fees and fee rate are only set when the
+// transaction is allowed, and the reject reason only when it is not.
+type TestMempoolAcceptResult struct {
+	Txid         string                 `json:"txid"`
+	Wtxid        string                 `json:"wtxid"`
+	Allowed      bool                   `json:"allowed"`
+	Vsize        int32                  `json:"vsize,omitempty"`
+	Fees         *TestMempoolAcceptFees `json:"fees,omitempty"`
+	FeeRate      float64                `json:"feerate,omitempty"`
+	RejectReason string                 `json:"reject-reason,omitempty"`
+}
+
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
 	Txid     string `json:"txid"`
 	Version  int32  `json:"version"`
+	Size     int32  `json:"size"`
+	Vsize    int32  `json:"vsize"`
+	Weight   int32  `json:"weight"`
 	Locktime uint32 `json:"locktime"`
 	Vin      []Vin  `json:"vin"`
 	Vout     []Vout `json:"vout"`
@@ -762,6 +965,13 @@ type ValidateAddressChainResult struct {
 	WitnessProgram *string `json:"witness_program,omitempty"`
 }
 
+// WaitForBlockResult models the data returned by the chain server waitforblock,
+// waitforblockheight, and waitfornewblock commands.
+type WaitForBlockResult struct {
+	Hash   string `json:"hash"`
+	Height int32  `json:"height"`
+}
+
 // EstimateSmartFeeResult models the data returned buy the chain server
 // estimatesmartfee command
 type EstimateSmartFeeResult struct {
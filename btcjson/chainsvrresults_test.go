@@ -48,6 +48,23 @@ func TestChainSvrCustomResults(t *testing.T) {
 			},
 			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"sequence":4294967295}`,
 		},
+		{
+			name: "custom vin marshal with prevout",
+			result: &btcjson.Vin{
+				Txid: "123",
+				Vout: 1,
+				ScriptSig: &btcjson.ScriptSig{
+					Asm: "0",
+					Hex: "00",
+				},
+				PrevOut: &btcjson.PrevOut{
+					Addresses: []string{"addr1"},
+					Value:     0.5,
+				},
+				Sequence: 4294967295,
+			},
+			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"prevout":{"addresses":["addr1"],"value":0.5},"sequence":4294967295}`,
+		},
 		{
 			name: "custom vinprevout marshal with coinbase",
 			result: &btcjson.VinPrevOut{
@@ -92,8 +109,8 @@ func TestChainSvrCustomResults(t *testing.T) {
 	}
 }
 
-// TestGetTxOutSetInfoResult ensures that custom unmarshalling of
-// GetTxOutSetInfoResult works as intended.
+// TestGetTxOutSetInfoResult ensures that custom marshalling and unmarshalling
+// of GetTxOutSetInfoResult works as intended.
 func TestGetTxOutSetInfoResult(t *testing.T) {
 	t.Parallel()
 
@@ -137,6 +154,52 @@ func TestGetTxOutSetInfoResult(t *testing.T) {
 				}(),
 			},
 		},
+		{
+			name:   "GetTxOutSetInfoResult - no serialized hash",
+			result: `{"height":123,"bestblock":"000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab","transactions":1,"txouts":1,"bogosize":1,"disk_size":1,"total_amount":0.2}`,
+			want: btcjson.GetTxOutSetInfoResult{
+				Height: 123,
+				BestBlock: func() chainhash.Hash {
+					h, err := chainhash.NewHashFromStr("000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab")
+					if err != nil {
+						panic(err)
+					}
+
+					return *h
+				}(),
+				Transactions: 1,
+				TxOuts:       1,
+				BogoSize:     1,
+				DiskSize:     1,
+				TotalAmount:  btcutil.Amount(20000000),
+			},
+		},
+		{
+			name:   "GetTxOutSetInfoResult - from coin stats index",
+			result: `{"height":123,"bestblock":"000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab","txouts":1,"bogosize":1,"ecmh":"9a0a561203ff052182993bc5d0cb2c620880bfafdbd80331f65fd9546c3e5c3e","total_amount":0.2}`,
+			want: btcjson.GetTxOutSetInfoResult{
+				Height: 123,
+				BestBlock: func() chainhash.Hash {
+					h, err := chainhash.NewHashFromStr("000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab")
+					if err != nil {
+						panic(err)
+					}
+
+					return *h
+				}(),
+				TxOuts:   1,
+				BogoSize: 1,
+				ECMH: func() chainhash.Hash {
+					h, err := chainhash.NewHashFromStr("9a0a561203ff052182993bc5d0cb2c620880bfafdbd80331f65fd9546c3e5c3e")
+					if err != nil {
+						panic(err)
+					}
+
+					return *h
+				}(),
+				TotalAmount: btcutil.Amount(20000000),
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -155,5 +218,18 @@ func TestGetTxOutSetInfoResult(t *testing.T) {
 				spew.Sdump(test.want))
 			continue
 		}
+
+		marshalled, err := json.Marshal(test.want)
+		if err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if string(marshalled) != test.result {
+			t.Errorf("Test #%d (%s) unexpected marshalled data - "+
+				"got %s, want %s", i, test.name, marshalled,
+				test.result)
+			continue
+		}
 	}
 }
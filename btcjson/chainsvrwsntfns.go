@@ -75,6 +75,16 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// TxRemovedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been removed from the mempool
+	// for a reason other than being included in a block.
+	TxRemovedNtfnMethod = "txremoved"
+
+	// IndexCatchUpNtfnMethod is the method used for notifications from the
+	// chain server that report the progress of an index that is being
+	// caught up to the best chain.
+	IndexCatchUpNtfnMethod = "indexcatchup"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +295,40 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// TxRemovedNtfn defines the txremoved JSON-RPC notification.
+type TxRemovedNtfn struct {
+	TxID   string
+	Reason string
+}
+
+// NewTxRemovedNtfn returns a new instance which can be used to issue a
+// txremoved JSON-RPC notification.
+func NewTxRemovedNtfn(txHash, reason string) *TxRemovedNtfn {
+	return &TxRemovedNtfn{
+		TxID:   txHash,
+		Reason: reason,
+	}
+}
+
+// IndexCatchUpNtfn defines the indexcatchup JSON-RPC notification.
+type IndexCatchUpNtfn struct {
+	Index        string
+	Height       int32
+	TargetHeight int32
+	Progress     float64
+}
+
+// NewIndexCatchUpNtfn returns a new instance which can be used to issue an
+// indexcatchup JSON-RPC notification.
+func NewIndexCatchUpNtfn(index string, height, targetHeight int32, progress float64) *IndexCatchUpNtfn {
+	return &IndexCatchUpNtfn{
+		Index:        index,
+		Height:       height,
+		TargetHeight: targetHeight,
+		Progress:     progress,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +345,6 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(TxRemovedNtfnMethod, (*TxRemovedNtfn)(nil), flags)
+	MustRegisterCmd(IndexCatchUpNtfnMethod, (*IndexCatchUpNtfn)(nil), flags)
 }
@@ -225,6 +225,36 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "txremoved",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txremoved", "123", "replaced")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxRemovedNtfn("123", "replaced")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txremoved","params":["123","replaced"],"id":null}`,
+			unmarshalled: &btcjson.TxRemovedNtfn{
+				TxID:   "123",
+				Reason: "replaced",
+			},
+		},
+		{
+			name: "indexcatchup",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("indexcatchup", "txindex", 5000, 10000, 50.0)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewIndexCatchUpNtfn("txindex", 5000, 10000, 50.0)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"indexcatchup","params":["txindex",5000,10000,50],"id":null}`,
+			unmarshalled: &btcjson.IndexCatchUpNtfn{
+				Index:        "txindex",
+				Height:       5000,
+				TargetHeight: 10000,
+				Progress:     50.0,
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -10,8 +10,14 @@ import (
 	"reflect"
 	"strings"
 	"text/tabwriter"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+// hashType is the reflect type of a hash, which is marshalled as a string by
+// the result types that use it.
+var hashType = reflect.TypeOf(chainhash.Hash{})
+
 // baseHelpDescs house the various help labels, types, and example values used
 // when generating help.  The per-command synopsis, field descriptions,
 // conditions, and result descriptions are to be provided by the caller.
@@ -47,6 +53,10 @@ type descLookupFunc func(string) string
 // reflectTypeToJSONType returns a string that represents the JSON type
 // associated with the provided Go type.
 func reflectTypeToJSONType(xT descLookupFunc, rt reflect.Type) string {
+	if rt == hashType {
+		return xT("json-type-string")
+	}
+
 	kind := rt.Kind()
 	if isNumeric(kind) {
 		return xT("json-type-numeric")
@@ -145,6 +155,9 @@ func reflectTypeToJSONExample(xT descLookupFunc, rt reflect.Type, indentLevel in
 	if rt.Kind() == reflect.Ptr {
 		rt = rt.Elem()
 	}
+	if rt == hashType {
+		return []string{`"` + xT("json-example-string") + `"`}, false
+	}
 	kind := rt.Kind()
 	if isNumeric(kind) {
 		if kind == reflect.Float32 || kind == reflect.Float64 {
@@ -84,6 +84,7 @@ const (
 
 // Errors that are specific to btcd.
 const (
-	ErrRPCNoWallet      RPCErrorCode = -1
-	ErrRPCUnimplemented RPCErrorCode = -1
+	ErrRPCNoWallet       RPCErrorCode = -1
+	ErrRPCUnimplemented  RPCErrorCode = -1
+	ErrRPCNotWhitelisted RPCErrorCode = -30
 )
@@ -0,0 +1,514 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cfclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// DefaultRequestTimeout is the time to wait for each response of a peer
+	// filters are fetched from when no other timeout is configured.
+	DefaultRequestTimeout = 30 * time.Second
+
+	// maxFetchRange is the maximum number of filters fetched at once by
+	// FetchMissingFilters.  The filter header checkpoints are requested
+	// again for every range, so it should be large enough for them to
+	// be negligible.
+	maxFetchRange = 10 * wire.MaxCFHeadersPerMsg
+)
+
+var (
+	// ErrStopped is returned when filters are no longer fetched because the
+	// client was stopped.
+	ErrStopped = errors.New("committed filter client stopped")
+
+	// zeroHash is the zero value hash (all zeros).  It is defined as a
+	// convenience.
+	zeroHash chainhash.Hash
+)
+
+// VerifyError identifies a response of a peer which does not pass the
+// verification of the committed filters it serves.  Peers which respond with
+// such messages are either faulty or misbehaving.
+type VerifyError struct {
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e VerifyError) Error() string {
+	return e.Description
+}
+
+// verifyError creates a VerifyError with the description formatted according
+// to the passed format specifier.
+func verifyError(format string, args ...interface{}) VerifyError {
+	return VerifyError{Description: fmt.Sprintf(format, args...)}
+}
+
+// Config is a configuration struct used to initialize a new Client.
+type Config struct {
+	// Chain is the chain the filters of the main chain blocks are fetched
+	// for.
+	Chain *blockchain.BlockChain
+
+	// CfIndex is the committed filter index the verified filters are
+	// stored in.  It must have been created before filters are fetched.
+	CfIndex *indexers.CfIndex
+
+	// RequestTimeout is the time to wait for each response of a peer
+	// filters are fetched from.  DefaultRequestTimeout is used when it is
+	// zero.
+	RequestTimeout time.Duration
+}
+
+// Client fetches the regular committed filters of the main chain blocks from
+// peers, verifies them, and stores them in the committed filter index.
+type Client struct {
+	cfg      Config
+	quit     chan struct{}
+	stopOnce sync.Once
+
+	// responses houses the channels the responses of the peers filters
+	// are currently fetched from are delivered to.
+	responsesMtx sync.Mutex
+	responses    map[*peer.Peer]chan wire.Message
+}
+
+// New returns a new committed filter client for the provided configuration.
+func New(cfg *Config) *Client {
+	c := &Client{
+		cfg:       *cfg,
+		quit:      make(chan struct{}),
+		responses: make(map[*peer.Peer]chan wire.Message),
+	}
+	if c.cfg.RequestTimeout == 0 {
+		c.cfg.RequestTimeout = DefaultRequestTimeout
+	}
+	return c
+}
+
+// Stop stops fetching filters.  The filters which are currently fetched are
+// abandoned with ErrStopped.
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+// deliver delivers the passed response of a peer to the fetch of filters from
+// it.  Responses from peers filters are not fetched from are ignored.
+func (c *Client) deliver(p *peer.Peer, msg wire.Message) {
+	c.responsesMtx.Lock()
+	responses, ok := c.responses[p]
+	c.responsesMtx.Unlock()
+	if !ok {
+		log.Debugf("Ignoring unrequested %s message from %v",
+			msg.Command(), p)
+		return
+	}
+
+	// The responses are buffered for the largest batch of filters which is
+	// requested, so this only drops messages which were not requested.
+	select {
+	case responses <- msg:
+	default:
+		log.Debugf("Ignoring unrequested %s message from %v",
+			msg.Command(), p)
+	}
+}
+
+// OnCFCheckpt delivers the passed cfcheckpt message of a peer to the client.
+// It is intended to be invoked by the message listeners of the peer.
+func (c *Client) OnCFCheckpt(p *peer.Peer, msg *wire.MsgCFCheckpt) {
+	c.deliver(p, msg)
+}
+
+// OnCFHeaders delivers the passed cfheaders message of a peer to the client.
+// It is intended to be invoked by the message listeners of the peer.
+func (c *Client) OnCFHeaders(p *peer.Peer, msg *wire.MsgCFHeaders) {
+	c.deliver(p, msg)
+}
+
+// OnCFilter delivers the passed cfilter message of a peer to the client.  It
+// is intended to be invoked by the message listeners of the peer.
+func (c *Client) OnCFilter(p *peer.Peer, msg *wire.MsgCFilter) {
+	c.deliver(p, msg)
+}
+
+// fetch houses the state of fetching filters from a peer.
+type fetch struct {
+	client    *Client
+	peer      *peer.Peer
+	responses chan wire.Message
+}
+
+// receive waits for the next response of the peer of the passed type of
+// message and returns it.  Responses of other types are skipped since they may
+// be the outstanding responses to earlier requests which were abandoned, which
+// the peer sends before responding to the current request.
+func (f *fetch) receive(command string) (wire.Message, error) {
+	timeout := time.After(f.client.cfg.RequestTimeout)
+	for {
+		select {
+		case msg := <-f.responses:
+			if msg.Command() != command {
+				log.Debugf("Skipping %s message from %v while "+
+					"expecting %s", msg.Command(), f.peer,
+					command)
+				continue
+			}
+			return msg, nil
+
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for %s message "+
+				"from peer %v", command, f.peer)
+
+		case <-f.client.quit:
+			return nil, ErrStopped
+		}
+	}
+}
+
+// fetchCheckpoints requests the filter header checkpoints up to the block with
+// the passed hash at the provided height from the peer.
+func (f *fetch) fetchCheckpoints(stopHash *chainhash.Hash,
+	stopHeight int32) ([]*chainhash.Hash, error) {
+
+	f.peer.QueueMessage(wire.NewMsgGetCFCheckpt(wire.GCSFilterRegular,
+		stopHash), nil)
+	msg, err := f.receive(wire.CmdCFCheckpt)
+	if err != nil {
+		return nil, err
+	}
+
+	checkptMsg := msg.(*wire.MsgCFCheckpt)
+	if checkptMsg.FilterType != wire.GCSFilterRegular ||
+		checkptMsg.StopHash != *stopHash {
+
+		return nil, verifyError("peer %v sent filter header checkpoints "+
+			"of type %v up to block %v, expected type %v up to "+
+			"block %v", f.peer, checkptMsg.FilterType,
+			checkptMsg.StopHash, wire.GCSFilterRegular, stopHash)
+	}
+	numCheckpts := int(stopHeight) / wire.CFCheckptInterval
+	if len(checkptMsg.FilterHeaders) != numCheckpts {
+		return nil, verifyError("peer %v sent %d filter header "+
+			"checkpoints, expected %d", f.peer,
+			len(checkptMsg.FilterHeaders), numCheckpts)
+	}
+	return checkptMsg.FilterHeaders, nil
+}
+
+// fetchFilterHashes requests the filter hashes of the blocks with the passed
+// hashes from the peer and verifies the filter headers committing to them form
+// a chain starting at the provided previous filter header which passes through
+// the provided checkpoints.  The blocks start at the passed height.
+func (f *fetch) fetchFilterHashes(blockHashes []chainhash.Hash,
+	startHeight int32, prevHeader *chainhash.Hash,
+	checkpts []*chainhash.Hash) ([]*chainhash.Hash, error) {
+
+	filterHashes := make([]*chainhash.Hash, 0, len(blockHashes))
+	for len(filterHashes) < len(blockHashes) {
+		batchSize := len(blockHashes) - len(filterHashes)
+		if batchSize > wire.MaxCFHeadersPerMsg {
+			batchSize = wire.MaxCFHeadersPerMsg
+		}
+		height := startHeight + int32(len(filterHashes))
+		stopHash := &blockHashes[len(filterHashes)+batchSize-1]
+		f.peer.QueueMessage(wire.NewMsgGetCFHeaders(
+			wire.GCSFilterRegular, uint32(height), stopHash), nil)
+		msg, err := f.receive(wire.CmdCFHeaders)
+		if err != nil {
+			return nil, err
+		}
+
+		headersMsg := msg.(*wire.MsgCFHeaders)
+		if headersMsg.FilterType != wire.GCSFilterRegular ||
+			headersMsg.StopHash != *stopHash ||
+			len(headersMsg.FilterHashes) != batchSize {
+
+			return nil, verifyError("peer %v sent %d filter hashes "+
+				"of type %v up to block %v, expected %d of "+
+				"type %v up to block %v", f.peer,
+				len(headersMsg.FilterHashes),
+				headersMsg.FilterType, headersMsg.StopHash,
+				batchSize, wire.GCSFilterRegular, stopHash)
+		}
+		if headersMsg.PrevFilterHeader != *prevHeader {
+			return nil, verifyError("peer %v sent filter headers "+
+				"at height %d which do not connect to the "+
+				"previous filter header %v", f.peer, height,
+				prevHeader)
+		}
+
+		// Verify the filter headers committing to the filter hashes
+		// match the checkpoints they pass through.
+		for _, filterHash := range headersMsg.FilterHashes {
+			header := filterHeader(filterHash, prevHeader)
+			if height > 0 && height%wire.CFCheckptInterval == 0 {
+				checkpt := checkpts[height/wire.CFCheckptInterval-1]
+				if header != *checkpt {
+					return nil, verifyError("peer %v sent "+
+						"filter header %v at height %d "+
+						"which does not match the "+
+						"checkpoint %v", f.peer, header,
+						height, checkpt)
+				}
+			}
+			filterHashes = append(filterHashes, filterHash)
+			prevHeader = &header
+			height++
+		}
+	}
+	return filterHashes, nil
+}
+
+// fetchFilters requests the filters of the blocks with the passed hashes from
+// the peer, verifies they match the provided filter hashes, and stores them in
+// the committed filter index along with the filter headers committing to them
+// and the passed filter header of the block before the first one.  The blocks
+// start at the passed height.
+func (f *fetch) fetchFilters(blockHashes []chainhash.Hash, startHeight int32,
+	prevHeader *chainhash.Hash, filterHashes []*chainhash.Hash) error {
+
+	for start := 0; start < len(blockHashes); {
+		batchSize := len(blockHashes) - start
+		if batchSize > wire.MaxGetCFiltersReqRange {
+			batchSize = wire.MaxGetCFiltersReqRange
+		}
+		height := startHeight + int32(start)
+		stopHash := &blockHashes[start+batchSize-1]
+		f.peer.QueueMessage(wire.NewMsgGetCFilters(
+			wire.GCSFilterRegular, uint32(height), stopHash), nil)
+
+		batchHashes := make([]*chainhash.Hash, batchSize)
+		filters := make([][]byte, batchSize)
+		for i := 0; i < batchSize; i++ {
+			msg, err := f.receive(wire.CmdCFilter)
+			if err != nil {
+				return err
+			}
+
+			filterMsg := msg.(*wire.MsgCFilter)
+			blockHash := &blockHashes[start+i]
+			if filterMsg.FilterType != wire.GCSFilterRegular ||
+				filterMsg.BlockHash != *blockHash {
+
+				return verifyError("peer %v sent a filter of "+
+					"type %v for block %v, expected type %v "+
+					"for block %v", f.peer,
+					filterMsg.FilterType,
+					filterMsg.BlockHash,
+					wire.GCSFilterRegular, blockHash)
+			}
+			filterHash := chainhash.DoubleHashH(filterMsg.Data)
+			if filterHash != *filterHashes[start+i] {
+				return verifyError("peer %v sent a filter for "+
+					"block %v which does not match its "+
+					"filter header", f.peer, blockHash)
+			}
+			batchHashes[i] = blockHash
+			filters[i] = filterMsg.Data
+		}
+
+		err := f.client.cfg.CfIndex.StoreFilters(batchHashes, filters,
+			wire.GCSFilterRegular, prevHeader)
+		if err != nil {
+			return err
+		}
+		for _, filterHash := range filterHashes[start : start+batchSize] {
+			header := filterHeader(filterHash, prevHeader)
+			prevHeader = &header
+		}
+		start += batchSize
+	}
+	return nil
+}
+
+// filterHeader returns the filter header which commits to the filter with the
+// passed hash and the provided filter header of the previous block as defined
+// by BIP0157.
+func filterHeader(filterHash *chainhash.Hash,
+	prevHeader *chainhash.Hash) chainhash.Hash {
+
+	var filterTip [2 * chainhash.HashSize]byte
+	copy(filterTip[:], filterHash[:])
+	copy(filterTip[chainhash.HashSize:], prevHeader[:])
+	return chainhash.DoubleHashH(filterTip[:])
+}
+
+// FetchFilters fetches the regular committed filters of the main chain blocks
+// at the passed range of heights from the provided peer and stores them in the
+// committed filter index once they are verified.
+//
+// The filter headers served by the peer are verified to connect to the filter
+// header of the block before the range when the index already has it, or to
+// the filter header checkpoint before the range served by the peer otherwise.
+// They are also verified to match all the checkpoints within the range.  The
+// filters served by the peer are then verified to commit to the filter
+// headers.  A VerifyError is returned when the peer serves filters or filter
+// headers which do not pass these checks, in which case it is either faulty or
+// misbehaving.
+//
+// The filters are stored in batches once they are verified, so the index may
+// have the filters of the blocks at the start of the range when an error is
+// returned.  Filters may only be fetched from a peer once at a time.
+func (c *Client) FetchFilters(p *peer.Peer, startHeight, stopHeight int32) error {
+	if startHeight < 0 || startHeight > stopHeight {
+		return fmt.Errorf("invalid range of heights %d-%d", startHeight,
+			stopHeight)
+	}
+	if p.Services()&wire.SFNodeCF != wire.SFNodeCF {
+		return fmt.Errorf("peer %v does not serve committed filters", p)
+	}
+
+	chain := c.cfg.Chain
+	stopHash, err := chain.BlockHashByHeight(stopHeight)
+	if err != nil {
+		return err
+	}
+
+	responses := make(chan wire.Message, wire.MaxGetCFiltersReqRange)
+	c.responsesMtx.Lock()
+	if _, ok := c.responses[p]; ok {
+		c.responsesMtx.Unlock()
+		return fmt.Errorf("filters are already fetched from peer %v", p)
+	}
+	c.responses[p] = responses
+	c.responsesMtx.Unlock()
+	defer func() {
+		c.responsesMtx.Lock()
+		delete(c.responses, p)
+		c.responsesMtx.Unlock()
+	}()
+
+	f := &fetch{client: c, peer: p, responses: responses}
+	checkpts, err := f.fetchCheckpoints(stopHash, stopHeight)
+	if err != nil {
+		return err
+	}
+
+	// Determine the filter header the filter headers served by the peer
+	// are verified to connect to.  The filter header of the block before
+	// the range is used when the index already has it.  Otherwise, the
+	// filter headers are fetched starting after the last checkpoint before
+	// the range.
+	headersStart := startHeight
+	prevHeader := &zeroHash
+	if startHeight > 0 {
+		prevHash, err := chain.BlockHashByHeight(startHeight - 1)
+		if err != nil {
+			return err
+		}
+		prevHeader, err = knownFilterHeader(c.cfg.CfIndex, prevHash)
+		if err != nil {
+			return err
+		}
+		if prevHeader == nil {
+			checkptIdx := int(startHeight-1) / wire.CFCheckptInterval
+			headersStart = int32(checkptIdx * wire.CFCheckptInterval)
+			prevHeader = &zeroHash
+			if checkptIdx > 0 {
+				headersStart++
+				prevHeader = checkpts[checkptIdx-1]
+			}
+		}
+	}
+
+	numHeaders := int(stopHeight-headersStart) + 1
+	blockHashes, err := chain.HeightToHashRange(headersStart, stopHash,
+		numHeaders)
+	if err != nil {
+		return err
+	}
+	filterHashes, err := f.fetchFilterHashes(blockHashes, headersStart,
+		prevHeader, checkpts)
+	if err != nil {
+		return err
+	}
+
+	// Determine the filter header of the block before the range from the
+	// verified filter headers before fetching the filters.
+	skip := int(startHeight - headersStart)
+	for _, filterHash := range filterHashes[:skip] {
+		header := filterHeader(filterHash, prevHeader)
+		prevHeader = &header
+	}
+	err = f.fetchFilters(blockHashes[skip:], startHeight, prevHeader,
+		filterHashes[skip:])
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Fetched the committed filters of blocks %d-%d from %v",
+		startHeight, stopHeight, p)
+	return nil
+}
+
+// knownFilterHeader returns the regular filter header of the block with the
+// passed hash stored in the provided index, or nil when it is not stored.
+func knownFilterHeader(cfIndex *indexers.CfIndex,
+	blockHash *chainhash.Hash) (*chainhash.Hash, error) {
+
+	header, err := cfIndex.FilterHeaderByBlockHash(blockHash,
+		wire.GCSFilterRegular)
+	if err != nil || header == nil {
+		return nil, err
+	}
+	return chainhash.NewHash(header)
+}
+
+// FetchMissingFilters fetches the regular committed filters of the main chain
+// blocks which are not stored in the committed filter index yet from the
+// provided peer as described by FetchFilters.  The filters are expected to be
+// stored for all blocks from the genesis block up to some height, which holds
+// when they are only stored by the client, so the filters after the first
+// block without one are fetched.
+func (c *Client) FetchMissingFilters(p *peer.Peer) error {
+	best := c.cfg.Chain.BestSnapshot()
+
+	// Find the first block without a filter.
+	start, end := int32(0), best.Height+1
+	for start < end {
+		mid := start + (end-start)/2
+		hash, err := c.cfg.Chain.BlockHashByHeight(mid)
+		if err != nil {
+			return err
+		}
+		header, err := knownFilterHeader(c.cfg.CfIndex, hash)
+		if err != nil {
+			return err
+		}
+		if header != nil {
+			start = mid + 1
+		} else {
+			end = mid
+		}
+	}
+
+	for start <= best.Height {
+		stop := start + maxFetchRange - 1
+		if stop > best.Height {
+			stop = best.Height
+		}
+		if err := c.FetchFilters(p, start, stop); err != nil {
+			return err
+		}
+		log.Infof("Fetched the committed filters up to block %d from %v",
+			stop, p)
+		start = stop + 1
+	}
+	return nil
+}
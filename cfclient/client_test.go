@@ -0,0 +1,492 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cfclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testNode houses the chain and committed filter index of a node used in the
+// tests.
+type testNode struct {
+	chain   *blockchain.BlockChain
+	cfIndex *indexers.CfIndex
+
+	// tamperMtx protects the fields which make the node serve invalid
+	// filters or filter hashes for the block at tamperHeight.
+	tamperMtx     sync.Mutex
+	tamperHeight  int32
+	tamperFilter  bool
+	tamperHeaders bool
+}
+
+// newTestNode returns a node for the regression test network along with a
+// function that tears it down.  The committed filters are built from the
+// blocks connected to its chain when buildFilters is set, while the index
+// only stores the filters fetched from peers otherwise.
+func newTestNode(t *testing.T, buildFilters bool) (*testNode, func()) {
+	t.Helper()
+
+	params := &chaincfg.RegressionNetParams
+	dbPath, err := ioutil.TempDir("", "cfclienttest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	cfIndex := indexers.NewCfIndex(db, params, nil)
+	var indexManager blockchain.IndexManager
+	if buildFilters {
+		indexManager = indexers.NewManager(db,
+			[]indexers.Indexer{cfIndex})
+	} else if err := cfIndex.CreateStore(); err != nil {
+		teardown()
+		t.Fatalf("unable to create cf index: %v", err)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:           db,
+		ChainParams:  params,
+		TimeSource:   blockchain.NewMedianTime(),
+		IndexManager: indexManager,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	return &testNode{chain: chain, cfIndex: cfIndex, tamperHeight: -1},
+		teardown
+}
+
+// makeTestBlocks returns the passed number of blocks extending the genesis
+// block of the regression test network.  The blocks do not have a valid proof
+// of work.
+func makeTestBlocks(t *testing.T, numBlocks int) []*btcutil.Block {
+	t.Helper()
+
+	params := &chaincfg.RegressionNetParams
+	prevHash := *params.GenesisHash
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	for height := int32(1); height <= int32(numBlocks); height++ {
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(0).Script()
+		if err != nil {
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(blockchain.CalcBlockSubsidy(
+			height, params), []byte{txscript.OP_TRUE}))
+
+		block := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:   4,
+				PrevBlock: prevHash,
+				Timestamp: params.GenesisBlock.Header.Timestamp.Add(
+					time.Duration(height) * 2 * params.TargetTimePerBlock),
+				Bits: params.PowLimitBits,
+			},
+			Transactions: []*wire.MsgTx{coinbase},
+		}
+		utilBlock := btcutil.NewBlock(block)
+		merkles := blockchain.BuildMerkleTreeStore(
+			utilBlock.Transactions(), false)
+		block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+		blocks = append(blocks, utilBlock)
+		prevHash = block.BlockHash()
+	}
+	return blocks
+}
+
+// processTestBlocks processes the passed blocks with the chain of the node.
+func (n *testNode) processTestBlocks(t *testing.T, blocks []*btcutil.Block) {
+	t.Helper()
+
+	for _, block := range blocks {
+		_, isOrphan, err := n.chain.ProcessBlock(btcutil.NewBlock(
+			block.MsgBlock()), blockchain.BFNoPoWCheck)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		if isOrphan {
+			t.Fatalf("block %v is an orphan", block.Hash())
+		}
+	}
+}
+
+// tamper makes the node serve an invalid filter, or an invalid filter hash
+// when headers is set, for the block at the passed height.  A negative height
+// makes the node serve valid filters again.
+func (n *testNode) tamper(height int32, headers bool) {
+	n.tamperMtx.Lock()
+	n.tamperHeight = height
+	n.tamperFilter = !headers
+	n.tamperHeaders = headers
+	n.tamperMtx.Unlock()
+}
+
+// isTampered returns whether the node serves an invalid filter or filter hash
+// for the block at the passed height.
+func (n *testNode) isTampered(height int32, headers bool) bool {
+	n.tamperMtx.Lock()
+	defer n.tamperMtx.Unlock()
+
+	if height != n.tamperHeight {
+		return false
+	}
+	if headers {
+		return n.tamperHeaders
+	}
+	return n.tamperFilter
+}
+
+// cfCheckptMsg returns the response to the passed getcfcheckpt message with
+// the filter header checkpoints of the node.
+func (n *testNode) cfCheckptMsg(msg *wire.MsgGetCFCheckpt) []wire.Message {
+	hashes, err := n.chain.IntervalBlockHashes(&msg.StopHash,
+		wire.CFCheckptInterval)
+	if err != nil {
+		return nil
+	}
+	checkptMsg := wire.NewMsgCFCheckpt(msg.FilterType, &msg.StopHash,
+		len(hashes))
+	for i := range hashes {
+		header, err := n.cfIndex.FilterHeaderByBlockHash(&hashes[i],
+			msg.FilterType)
+		if err != nil || header == nil {
+			return nil
+		}
+		headerHash, _ := chainhash.NewHash(header)
+		checkptMsg.AddCFHeader(headerHash)
+	}
+	return []wire.Message{checkptMsg}
+}
+
+// cfHeadersMsg returns the response to the passed getcfheaders message with
+// the filter hashes of the node.
+func (n *testNode) cfHeadersMsg(msg *wire.MsgGetCFHeaders) []wire.Message {
+	hashes, err := n.chain.HeightToHashRange(int32(msg.StartHeight),
+		&msg.StopHash, wire.MaxCFHeadersPerMsg)
+	if err != nil {
+		return nil
+	}
+	headersMsg := wire.NewMsgCFHeaders()
+	headersMsg.FilterType = msg.FilterType
+	headersMsg.StopHash = msg.StopHash
+	if msg.StartHeight > 0 {
+		prevHash, err := n.chain.BlockHashByHeight(
+			int32(msg.StartHeight) - 1)
+		if err != nil {
+			return nil
+		}
+		header, err := n.cfIndex.FilterHeaderByBlockHash(prevHash,
+			msg.FilterType)
+		if err != nil || header == nil {
+			return nil
+		}
+		copy(headersMsg.PrevFilterHeader[:], header)
+	}
+	for i := range hashes {
+		filterHash, err := n.cfIndex.FilterHashByBlockHash(&hashes[i],
+			msg.FilterType)
+		if err != nil || filterHash == nil {
+			return nil
+		}
+		hash, _ := chainhash.NewHash(filterHash)
+		if n.isTampered(int32(msg.StartHeight)+int32(i), true) {
+			hash[0] ^= 0xff
+		}
+		headersMsg.AddCFHash(hash)
+	}
+	return []wire.Message{headersMsg}
+}
+
+// cfilterMsgs returns the responses to the passed getcfilters message with the
+// filters of the node.
+func (n *testNode) cfilterMsgs(msg *wire.MsgGetCFilters) []wire.Message {
+	hashes, err := n.chain.HeightToHashRange(int32(msg.StartHeight),
+		&msg.StopHash, wire.MaxGetCFiltersReqRange)
+	if err != nil {
+		return nil
+	}
+	msgs := make([]wire.Message, 0, len(hashes))
+	for i := range hashes {
+		filter, err := n.cfIndex.FilterByBlockHash(&hashes[i],
+			msg.FilterType)
+		if err != nil || filter == nil {
+			return nil
+		}
+		if n.isTampered(int32(msg.StartHeight)+int32(i), false) {
+			filter[len(filter)-1] ^= 0xff
+		}
+		msgs = append(msgs, wire.NewMsgCFilter(msg.FilterType,
+			&hashes[i], filter))
+	}
+	return msgs
+}
+
+// serve performs the version handshake with the peer connected over the passed
+// connection and then responds to its requests for filters until the
+// connection is closed.  The filters are not served by a peer of the peer
+// package since it refuses connections to peers of the same process.
+func (n *testNode) serve(conn net.Conn) {
+	defer conn.Close()
+
+	params := &chaincfg.RegressionNetParams
+	pver := wire.ProtocolVersion
+	if _, _, err := wire.ReadMessage(conn, pver, params.Net); err != nil {
+		return
+	}
+	services := wire.SFNodeNetwork | wire.SFNodeCF
+	addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0, services)
+	versionMsg := wire.NewMsgVersion(addr, addr, 0, 0)
+	versionMsg.Services = services
+	if err := wire.WriteMessage(conn, versionMsg, pver, params.Net); err != nil {
+		return
+	}
+	err := wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, params.Net)
+	if err != nil {
+		return
+	}
+
+	for {
+		msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+		if err != nil {
+			return
+		}
+
+		var responses []wire.Message
+		switch msg := msg.(type) {
+		case *wire.MsgGetCFCheckpt:
+			responses = n.cfCheckptMsg(msg)
+		case *wire.MsgGetCFHeaders:
+			responses = n.cfHeadersMsg(msg)
+		case *wire.MsgGetCFilters:
+			responses = n.cfilterMsgs(msg)
+		}
+		for _, response := range responses {
+			err := wire.WriteMessage(conn, response, pver, params.Net)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// connectTestNodes connects a peer which fetches filters with the passed
+// client to the provided node which serves its filters over the loopback
+// interface.  The peer is returned once the handshake completed along with a
+// function that disconnects it.
+func connectTestNodes(t *testing.T, client *Client,
+	server *testNode) (*peer.Peer, func()) {
+
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.serve(conn)
+	}()
+
+	verAcks := make(chan struct{}, 1)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		UserAgentName:    "client",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.RegressionNetParams,
+		Listeners: peer.MessageListeners{
+			OnCFCheckpt: client.OnCFCheckpt,
+			OnCFHeaders: client.OnCFHeaders,
+			OnCFilter:   client.OnCFilter,
+			OnVerAck: func(*peer.Peer, *wire.MsgVerAck) {
+				verAcks <- struct{}{}
+			},
+		},
+	}, listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		t.Fatalf("unable to connect: %v", err)
+	}
+	p.AssociateConnection(conn)
+	disconnect := func() {
+		p.Disconnect()
+		listener.Close()
+	}
+
+	select {
+	case <-verAcks:
+	case <-time.After(5 * time.Second):
+		disconnect()
+		t.Fatal("timeout waiting for the handshake")
+	}
+	return p, disconnect
+}
+
+// testFiltersStored ensures the client node stores the same filters and filter
+// headers as the server node for the blocks at the passed range of heights
+// when stored is set and that it does not store them otherwise.
+func testFiltersStored(t *testing.T, client, server *testNode, startHeight,
+	stopHeight int32, stored bool) {
+
+	t.Helper()
+
+	for height := startHeight; height <= stopHeight; height++ {
+		hash, err := server.chain.BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("unable to fetch block hash: %v", err)
+		}
+		filter, err := client.cfIndex.FilterByBlockHash(hash,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("unable to fetch filter: %v", err)
+		}
+		header, err := client.cfIndex.FilterHeaderByBlockHash(hash,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("unable to fetch filter header: %v", err)
+		}
+		if !stored {
+			if filter != nil || header != nil {
+				t.Fatalf("unexpected filter stored for block "+
+					"at height %d", height)
+			}
+			continue
+		}
+
+		wantFilter, err := server.cfIndex.FilterByBlockHash(hash,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("unable to fetch filter: %v", err)
+		}
+		wantHeader, err := server.cfIndex.FilterHeaderByBlockHash(hash,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("unable to fetch filter header: %v", err)
+		}
+		if !bytes.Equal(filter, wantFilter) {
+			t.Fatalf("unexpected filter stored for block at height "+
+				"%d - got %x, want %x", height, filter,
+				wantFilter)
+		}
+		if !bytes.Equal(header, wantHeader) {
+			t.Fatalf("unexpected filter header stored for block at "+
+				"height %d - got %x, want %x", height, header,
+				wantHeader)
+		}
+	}
+}
+
+// TestFetchFilters ensures the client fetches the filters served by a peer,
+// stores them once they are verified, and rejects invalid filters and filter
+// headers.
+func TestFetchFilters(t *testing.T) {
+	server, teardownServer := newTestNode(t, true)
+	defer teardownServer()
+	clientNode, teardownClient := newTestNode(t, false)
+	defer teardownClient()
+
+	// Extend the chains of both nodes past two filter header checkpoints
+	// and more filter hashes than fit in a single message.
+	const numBlocks = 2*wire.CFCheckptInterval + 100
+	blocks := makeTestBlocks(t, numBlocks)
+	server.processTestBlocks(t, blocks)
+	clientNode.processTestBlocks(t, blocks)
+
+	client := New(&Config{
+		Chain:          clientNode.chain,
+		CfIndex:        clientNode.cfIndex,
+		RequestTimeout: 5 * time.Second,
+	})
+	defer client.Stop()
+	p, disconnect := connectTestNodes(t, client, server)
+	defer disconnect()
+
+	// Fetch a range which starts after a checkpoint the filter headers are
+	// verified to connect to.
+	if err := client.FetchFilters(p, 1500, 2050); err != nil {
+		t.Fatalf("FetchFilters: unexpected error: %v", err)
+	}
+	testFiltersStored(t, clientNode, server, 1499, 1499, false)
+	testFiltersStored(t, clientNode, server, 1500, 2050, true)
+
+	// Fetch the following range which connects to the stored filter
+	// headers.
+	if err := client.FetchFilters(p, 2051, numBlocks); err != nil {
+		t.Fatalf("FetchFilters: unexpected error: %v", err)
+	}
+	testFiltersStored(t, clientNode, server, 2051, numBlocks, true)
+
+	// Ensure invalid filters and filter hashes which do not pass through
+	// the checkpoints are rejected without storing the filters.
+	tests := []struct {
+		name         string
+		tamperHeight int32
+		headers      bool
+	}{
+		{name: "invalid filter", tamperHeight: 100},
+		{name: "invalid filter hash", tamperHeight: 500, headers: true},
+	}
+	for _, test := range tests {
+		server.tamper(test.tamperHeight, test.headers)
+		err := client.FetchFilters(p, 0, 1200)
+		if _, ok := err.(VerifyError); !ok {
+			t.Fatalf("%s: unexpected error - got %v, want "+
+				"VerifyError", test.name, err)
+		}
+		testFiltersStored(t, clientNode, server, 0, 999, false)
+	}
+
+	// Fetch the remaining filters.
+	server.tamper(-1, false)
+	if err := client.FetchMissingFilters(p); err != nil {
+		t.Fatalf("FetchMissingFilters: unexpected error: %v", err)
+	}
+	testFiltersStored(t, clientNode, server, 0, numBlocks, true)
+
+	// Invalid ranges of heights must be rejected.
+	if err := client.FetchFilters(p, 10, 5); err == nil {
+		t.Fatal("FetchFilters: expected error for invalid range")
+	}
+}
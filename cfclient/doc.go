@@ -0,0 +1,20 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package cfclient implements fetching the committed filters defined by BIP0158
+from peers which serve them as described by BIP0157.
+
+The Client requests the filter header checkpoints of a peer, verifies the filter
+headers it serves connect to them and the filter headers already known, and
+verifies the filters it serves commit to the verified filter headers before
+storing them in the committed filter index.  This allows the filters of the main
+chain to be served and matched without building them locally from the full
+blocks.
+
+The message listeners of the peers filters are fetched from must deliver the
+cfcheckpt, cfheaders, and cfilter messages to the OnCFCheckpt, OnCFHeaders, and
+OnCFilter methods of the Client.
+*/
+package cfclient
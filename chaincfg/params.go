@@ -35,6 +35,11 @@ var (
 	// 2^224 - 1.
 	testNet3PowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 224), bigOne)
 
+	// testNet4PowLimit is the highest proof of work value a Bitcoin block
+	// can have for the test network (version 4).  It is the value
+	// 2^224 - 1.
+	testNet4PowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 224), bigOne)
+
 	// simNetPowLimit is the highest proof of work value a Bitcoin block
 	// can have for the simulation test network.  It is the value 2^255 - 1.
 	simNetPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
@@ -52,6 +57,19 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUtxoSnapshot identifies a known good utxo set snapshot.  Loading one of
+// these snapshots allows a node to build a chain from the block the snapshot was
+// taken at while the blocks before it are validated in the background.
+//
+// SerializedHash commits to the contents of the snapshot.  It is the serialized
+// hash of the utxo set as of the block, which is the same hash reported by the
+// gettxoutsetinfo RPC once the block is the best block.
+type AssumeUtxoSnapshot struct {
+	Height         int32
+	BlockHash      *chainhash.Hash
+	SerializedHash *chainhash.Hash
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -76,6 +94,11 @@ type ConsensusDeployment struct {
 	// ExpireTime is the median block time after which the attempted
 	// deployment expires.
 	ExpireTime uint64
+
+	// AlwaysActive specifies the deployment is active for every block
+	// regardless of the signalling of the blocks before it.  It is used by
+	// networks created after the deployment was buried.
+	AlwaysActive bool
 }
 
 // Constants that define the deployment offset in the deployments field of the
@@ -140,6 +163,13 @@ type Params struct {
 	BIP0065Height int32
 	BIP0066Height int32
 
+	// BIP0034Hash is the hash of the block at BIP0034Height.  Including the
+	// block height in coinbases only prevents duplicate transactions on
+	// chains which contain this block, so the checks of BIP0030 may only be
+	// skipped on them.  It is nil for networks where the checks are always
+	// performed.
+	BIP0034Hash *chainhash.Hash
+
 	// CoinbaseMaturity is the number of blocks required before newly mined
 	// coins (coinbase transactions) can be spent.
 	CoinbaseMaturity uint16
@@ -175,12 +205,25 @@ type Params struct {
 	// NOTE: This only applies if ReduceMinDifficulty is true.
 	MinDiffReductionTime time.Duration
 
+	// EnforceBIP94 specifies whether or not the timewarp fix and the
+	// difficulty adjustment rules defined by BIP0094 are enforced.  In
+	// particular, the difficulty of a retarget block is calculated from
+	// the first block of the previous period rather than the last one, so
+	// a minimum difficulty block can't reduce the difficulty of the next
+	// period, and the first block of a period may not have a timestamp
+	// more than 600 seconds before the block that precedes it.
+	EnforceBIP94 bool
+
 	// GenerateSupported specifies whether or not CPU mining is allowed.
 	GenerateSupported bool
 
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeUtxoSnapshots are the utxo set snapshots which may be loaded
+	// ordered from oldest to newest.
+	AssumeUtxoSnapshots []AssumeUtxoSnapshot
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -243,6 +286,7 @@ var MainNetParams = Params{
 	BIP0034Height:            227931, // 000000000000024b89b42a942fe0d9fea3bb44ab7bd1b19115dd6a759c0808b8
 	BIP0065Height:            388381, // 000000000000000004c2b624ed5d7756c508d90fd0da2c7c679febfa6c4735f0
 	BIP0066Height:            363725, // 00000000000000000379eaa19dce8c9b722d46ae6a57c2f1a988119488b50931
+	BIP0034Hash:              newHashFromStr("000000000000024b89b42a942fe0d9fea3bb44ab7bd1b19115dd6a759c0808b8"),
 	CoinbaseMaturity:         100,
 	SubsidyReductionInterval: 210000,
 	TargetTimespan:           time.Hour * 24 * 14, // 14 days
@@ -357,6 +401,17 @@ var RegressionNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// AssumeUtxoSnapshots ordered from oldest to newest.  The snapshot is
+	// of the deterministic chain of empty blocks the blockchain package
+	// tests build on the genesis block.
+	AssumeUtxoSnapshots: []AssumeUtxoSnapshot{
+		{
+			Height:         110,
+			BlockHash:      newHashFromStr("6c3d3e9cbf88e6a1c6444aadd39fd128109a78fe48f59f2ccd0e074177b517a5"),
+			SerializedHash: newHashFromStr("a830f536fff45792337936cb0feb2e93bf4112c20e3d33a01ef0d3e0b0d551f5"),
+		},
+	},
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -424,6 +479,7 @@ var TestNet3Params = Params{
 	BIP0034Height:            21111,  // 0000000023b3a96d3484e5abb3755c413e7d41500f8e2a5c3f0dd01299cd8ef8
 	BIP0065Height:            581885, // 00000000007f6655f22f98e72ed80d8b06dc761d5da09df0fa1dc4be4f861eb6
 	BIP0066Height:            330776, // 000000002104c8c45e99a8853285a3b592602a3ccde2b832481da85e9e4ba182
+	BIP0034Hash:              newHashFromStr("0000000023b3a96d3484e5abb3755c413e7d41500f8e2a5c3f0dd01299cd8ef8"),
 	CoinbaseMaturity:         100,
 	SubsidyReductionInterval: 210000,
 	TargetTimespan:           time.Hour * 24 * 14, // 14 days
@@ -498,6 +554,84 @@ var TestNet3Params = Params{
 	HDCoinType: 1,
 }
 
+// TestNet4Params defines the network parameters for the test Bitcoin network
+// (version 4).  Not to be confused with the regression test network, this
+// network is sometimes simply called "testnet".
+var TestNet4Params = Params{
+	Name:        "testnet4",
+	Net:         wire.TestNet4,
+	DefaultPort: "48333",
+	DNSSeeds: []DNSSeed{
+		{"seed.testnet4.bitcoin.sprovoost.nl", true},
+		{"seed.testnet4.wiz.biz", true},
+	},
+
+	// Chain parameters
+	GenesisBlock:             &testNet4GenesisBlock,
+	GenesisHash:              &testNet4GenesisHash,
+	PowLimit:                 testNet4PowLimit,
+	PowLimitBits:             0x1d00ffff,
+	BIP0034Height:            1,
+	BIP0065Height:            1,
+	BIP0066Height:            1,
+	CoinbaseMaturity:         100,
+	SubsidyReductionInterval: 210000,
+	TargetTimespan:           time.Hour * 24 * 14, // 14 days
+	TargetTimePerBlock:       time.Minute * 10,    // 10 minutes
+	RetargetAdjustmentFactor: 4,                   // 25% less, 400% more
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     time.Minute * 20, // TargetTimePerBlock * 2
+	EnforceBIP94:             true,
+	GenerateSupported:        false,
+
+	// Checkpoints ordered from oldest to newest.
+	Checkpoints: nil,
+
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 1512, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentTestDummy: {
+			BitNumber:  28,
+			StartTime:  1199145601, // January 1, 2008 UTC
+			ExpireTime: 1230767999, // December 31, 2008 UTC
+		},
+		DeploymentCSV: {
+			BitNumber:    0,
+			AlwaysActive: true, // Buried since the genesis block
+		},
+		DeploymentSegwit: {
+			BitNumber:    1,
+			AlwaysActive: true, // Buried since the genesis block
+		},
+	},
+
+	// Mempool parameters
+	RelayNonStdTxs: true,
+
+	// Human-readable part for Bech32 encoded segwit addresses, as defined in
+	// BIP 173.
+	Bech32HRPSegwit: "tb", // always tb for test net
+
+	// Address encoding magics
+	PubKeyHashAddrID:        0x6f, // starts with m or n
+	ScriptHashAddrID:        0xc4, // starts with 2
+	WitnessPubKeyHashAddrID: 0x03, // starts with QW
+	WitnessScriptHashAddrID: 0x28, // starts with T7n
+	PrivateKeyID:            0xef, // starts with 9 (uncompressed) or c (compressed)
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: 1,
+}
+
 // SimNetParams defines the network parameters for the simulation test Bitcoin
 // network.  This network is similar to the normal test network except it is
 // intended for private use within a group of individuals doing simulation
@@ -519,6 +653,7 @@ var SimNetParams = Params{
 	BIP0034Height:            0, // Always active on simnet
 	BIP0065Height:            0, // Always active on simnet
 	BIP0066Height:            0, // Always active on simnet
+	BIP0034Hash:              &simNetGenesisHash,
 	CoinbaseMaturity:         100,
 	SubsidyReductionInterval: 210000,
 	TargetTimespan:           time.Hour * 24 * 14, // 14 days
@@ -738,6 +873,7 @@ func init() {
 	// Register all default networks when the package is initialized.
 	mustRegister(&MainNetParams)
 	mustRegister(&TestNet3Params)
+	mustRegister(&TestNet4Params)
 	mustRegister(&RegressionNetParams)
 	mustRegister(&SimNetParams)
 }
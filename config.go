@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
@@ -20,14 +21,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
@@ -39,7 +45,10 @@ const (
 	defaultLogLevel              = "info"
 	defaultLogDirname            = "logs"
 	defaultLogFilename           = "btcd.log"
+	defaultLogFormat             = "text"
 	defaultMaxPeers              = 125
+	maxTargetOutbound            = 64
+	maxBlockRelayOnlyPeers       = 8
 	defaultBanDuration           = time.Hour * 24
 	defaultBanThreshold          = 100
 	defaultConnectTimeout        = time.Second * 30
@@ -47,8 +56,11 @@ const (
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
 	defaultDbType                = "ffldb"
+	defaultDbFlushInterval       = time.Minute * 5
+	defaultDbSyncMode            = "batched"
 	defaultFreeTxRelayLimit      = 15.0
 	defaultTrickleInterval       = peer.DefaultTrickleInterval
+	defaultSyncStallTimeout      = time.Minute * 3
 	defaultBlockMinSize          = 0
 	defaultBlockMaxSize          = 750000
 	defaultBlockMinWeight        = 0
@@ -58,9 +70,15 @@ const (
 	blockMaxWeightMin            = 4000
 	blockMaxWeightMax            = blockchain.MaxBlockWeight - 4000
 	defaultGenerate              = false
+	defaultMinerCPUFraction      = 1.0
+	defaultMaxOrphanBlocks       = blockchain.DefaultMaxOrphanBlocks
+	defaultMaxOrphanBlocksMiB    = blockchain.DefaultMaxOrphanBlocksSize / (1024 * 1024)
+	defaultOrphanBlockExpiry     = blockchain.DefaultOrphanBlockExpiry
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = 100000
 	defaultSigCacheMaxSize       = 100000
+	defaultMaxFilterAddRate      = 100
+	defaultUtxoCacheMaxSizeMiB   = 250
 	sampleConfigFilename         = "sample-btcd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
@@ -98,39 +116,65 @@ type config struct {
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause btcd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause btcd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	AllowGenerate        bool          `long:"allowgenerate" description:"Allow the generate and generatetoaddress RPCs on networks other than regtest and simnet -- NOTE: It is unlikely to be possible to mine a block with the CPU on them"`
+	AssumeValid          string        `long:"assumevalid" description:"Skip the script checks of the specified block and its ancestors provided it is part of a chain with at least as much work as the best chain"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxWeight       uint32        `long:"blockmaxweight" description:"Maximum block weight to be used when creating a block"`
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
+	BlockMinTxFee        float64       `long:"blockmintxfee" description:"The minimum transaction fee in BTC/kB for a transaction to be included when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	BlockRelayOnlyPeers  int           `long:"blockrelayonlypeers" description:"Number of automatic outbound connections in addition to targetoutbound which only relay blocks and never relay transactions or addresses"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	CFClient             bool          `long:"cfclient" description:"Fetch the committed filters (CF) from peers which serve them rather than building them from the blocks"`
+	CoinbaseFlags        string        `long:"coinbaseflags" description:"Data such as a message to include in the coinbase signature script of created blocks"`
+	CoinbaseNonceSize    int           `long:"coinbasenoncesize" description:"Number of bytes the extra nonce takes in the coinbase signature script of created blocks to keep the coinbase flags at a fixed offset -- 0 adds it as a minimally encoded number"`
+	CoinStatsIndex       bool          `long:"coinstatsindex" description:"Maintain an index of statistics about the unspent transaction output set as of each block which makes the gettxoutsetinfo RPC return immediately"`
 	ConfigFile           string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
+	DataCarrierOutputs   int           `long:"datacarrieroutputs" description:"Max number of null data (OP_RETURN) outputs a transaction may have to be relayed"`
+	DataCarrierSize      int           `long:"datacarriersize" description:"Max number of bytes of data a null data (OP_RETURN) output may carry to be relayed"`
 	DataDir              string        `short:"b" long:"datadir" description:"Directory to store data"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	DbFlushInterval      time.Duration `long:"dbflushinterval" description:"Maximum amount of time the database keeps updates in memory before writing them to disk"`
+	DbSyncMode           string        `long:"dbsyncmode" description:"When to sync the blocks and metadata written to the database to disk {batched, everyblock} -- everyblock loses no blocks on a crash or power failure but greatly reduces the throughput of syncing the chain"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
+	DropCoinStatsIndex   bool          `long:"dropcoinstatsindex" description:"Deletes the coin stats index from the database on start up and then exits."`
+	DropSpentIndex       bool          `long:"dropspentindex" description:"Deletes the spent transaction output index from the database on start up and then exits."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	DustRelayFee         float64       `long:"dustrelayfee" description:"The fee rate in BTC/kB used to determine whether transaction outputs are dust -- Outputs which cost more than a third of their value to spend at this fee rate are not relayed"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
+	ExternalOnion        string        `long:"externalonion" description:"Add the onion address of a tor hidden service forwarding to this node to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	LogDir               string        `long:"logdir" description:"Directory to log output."`
+	LogFormat            string        `long:"logformat" description:"Format of log output {text, json}"`
+	MaxFilterAddRate     int           `long:"maxfilteraddrate" description:"Max number of filteradd messages a peer may send per minute before it is disconnected and its ban score is increased"`
+	MaxFilterLoadSize    int           `long:"maxfilterloadsize" description:"Max size in bytes of the bloom filters peers may load"`
+	MaxOrphanBlocks      int           `long:"maxorphanblocks" description:"Max number of orphan blocks to keep in memory"`
+	MaxOrphanBlocksMiB   uint          `long:"maxorphanblocksize" description:"Max total size in MiB of the orphan blocks to keep in memory"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MinChainWork         string        `long:"minchainwork" description:"The minimum cumulative work in hex the best chain must have before the node considers itself synced"`
+	MinerCPUFraction     float64       `long:"minercpufraction" description:"Limit the built-in CPU miner to the given fraction of the processor cores (greater than 0 up to 1)"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
+	NATPMP               bool          `long:"natpmp" description:"Use NAT-PMP to map our listening port outside of NAT when UPnP is disabled or unavailable"`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	NoDefaultCheckpoints bool          `long:"nodefaultcheckpoints" description:"Disable built-in checkpoints while keeping the ones added with --addcheckpoint.  Don't do this unless you know what you're doing."`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
+	NoPersistMempool     bool          `long:"nopersistmempool" description:"Do not save the memory pool to disk and restore it on startup"`
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	NoWinService         bool          `long:"nowinservice" description:"Do not start as a background service on Windows -- NOTE: This flag only works on the command line, not in the config file"`
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
@@ -138,15 +182,19 @@ type config struct {
 	OnionProxy           string        `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
+	OnlyNets             []string      `long:"onlynet" description:"Only make outbound connections to the given network (ipv4, ipv6, or onion) -- may be specified multiple times"`
+	OrphanBlockExpiry    time.Duration `long:"orphanblockexpiry" description:"How long to keep orphan blocks in memory before they expire.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass            string        `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
 	ProxyUser            string        `long:"proxyuser" description:"Username for proxy server"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
+	Reindex              bool          `long:"reindex" description:"Drops all enabled optional indexes on start up and rebuilds them from the chain data"`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
+	RPCGzip              bool          `long:"rpcgzip" description:"Compress responses to HTTP POST RPC requests with gzip for clients which accept it"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
@@ -154,25 +202,45 @@ type config struct {
 	RPCMaxClients        int           `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
+	RPCUnixSocket        string        `long:"rpcunixsocket" description:"Path of a Unix domain socket to listen on for RPC connections in addition to the TCP listeners -- NOTE: TLS is not used on the socket, so access should be restricted via filesystem permissions"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
+	RPCWhitelists        []string      `long:"rpcwhitelist" description:"Restrict an RPC user to the listed methods.  Format: '<user>:<method>,<method>,...'"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
+	SpentIndex           bool          `long:"spentindex" description:"Maintain an index of the transaction input that spent each transaction output which makes the getspentinfo RPC available"`
+	SyncStallTimeout     time.Duration `long:"syncstalltimeout" description:"How long the sync peer may go without delivering blocks before another sync peer is selected.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	TargetOutbound       int           `long:"targetoutbound" description:"Number of automatic outbound connections which relay blocks, transactions, and addresses"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
+	TestNet4             bool          `long:"testnet4" description:"Use the test network (version 4)"`
+	TestScriptFlags      []string      `long:"testscriptflags" description:"Enforce additional script verification flags, such as NULLDUMMY, CLEANSTACK, or WITNESS, from a block height on regtest and simnet to test soft-fork activation.  Format: '<height>:<flag>,<flag>,...'"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	UtxoCacheMaxSizeMiB  uint          `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache which keeps recent changes to the UTXO set in memory before writing them to the database (0 to disable)"`
 	ShowVersion          bool          `short:"V" long:"version" description:"Display version information and exit"`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	ZMQPubHashBlock      string        `long:"zmqpubhashblock" description:"Publish the hashes of connected blocks on the ZeroMQ endpoint (eg. tcp://127.0.0.1:28332)"`
+	ZMQPubHashTx         string        `long:"zmqpubhashtx" description:"Publish the hashes of accepted and block transactions on the ZeroMQ endpoint"`
+	ZMQPubRawBlock       string        `long:"zmqpubrawblock" description:"Publish the serialized connected blocks on the ZeroMQ endpoint"`
+	ZMQPubRawTx          string        `long:"zmqpubrawtx" description:"Publish the serialized accepted and block transactions on the ZeroMQ endpoint"`
+	ZMQPubSequence       string        `long:"zmqpubsequence" description:"Publish the ordered log of connected and disconnected blocks and of transactions added to and removed from the mempool on the ZeroMQ endpoint"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
+	scriptFlags          []blockchain.ScriptFlagActivation
+	minChainWork         *big.Int
 	miningAddrs          []btcutil.Address
 	minRelayTxFee        btcutil.Amount
+	blockMinTxFee        btcutil.Amount
+	dustRelayFee         btcutil.Amount
+	rpcWhitelists        map[string]map[string]struct{}
+	onlyNets             []addrmgr.Network
 	whitelists           []*net.IPNet
 }
 
@@ -231,7 +299,7 @@ func supportedSubsystems() []string {
 
 // parseAndSetDebugLevels attempts to parse the specified debug level and set
 // the levels accordingly.  An appropriate error is returned if anything is
-// invalid.
+// invalid, in which case none of the levels are changed.
 func parseAndSetDebugLevels(debugLevel string) error {
 	// When the specified string doesn't have any delimters, treat it as
 	// the log level for all subsystems.
@@ -249,7 +317,9 @@ func parseAndSetDebugLevels(debugLevel string) error {
 	}
 
 	// Split the specified string into subsystem/level pairs while detecting
-	// issues and update the log levels accordingly.
+	// issues.  The log levels are only updated once all of the pairs are
+	// known to be valid.
+	logLevels := make(map[string]string)
 	for _, logLevelPair := range strings.Split(debugLevel, ",") {
 		if !strings.Contains(logLevelPair, "=") {
 			str := "The specified debug level contains an invalid " +
@@ -258,7 +328,7 @@ func parseAndSetDebugLevels(debugLevel string) error {
 		}
 
 		// Extract the specified subsystem and log level.
-		fields := strings.Split(logLevelPair, "=")
+		fields := strings.SplitN(logLevelPair, "=", 2)
 		subsysID, logLevel := fields[0], fields[1]
 
 		// Validate subsystem.
@@ -274,6 +344,9 @@ func parseAndSetDebugLevels(debugLevel string) error {
 			return fmt.Errorf(str, logLevel)
 		}
 
+		logLevels[subsysID] = logLevel
+	}
+	for subsysID, logLevel := range logLevels {
 		setLogLevel(subsysID, logLevel)
 	}
 
@@ -335,7 +408,7 @@ func newCheckpointFromStr(checkpoint string) (chaincfg.Checkpoint, error) {
 	}
 
 	height, err := strconv.ParseInt(parts[0], 10, 32)
-	if err != nil {
+	if err != nil || height <= 0 {
 		return chaincfg.Checkpoint{}, fmt.Errorf("unable to parse "+
 			"checkpoint %q due to malformed height", checkpoint)
 	}
@@ -373,6 +446,109 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// scriptFlagsByName maps the names of script verification flags, as used by
+// the script tests of Bitcoin Core, to the flags themselves.
+var scriptFlagsByName = map[string]txscript.ScriptFlags{
+	"P2SH":                                  txscript.ScriptBip16,
+	"STRICTENC":                             txscript.ScriptVerifyStrictEncoding,
+	"DERSIG":                                txscript.ScriptVerifyDERSignatures,
+	"LOW_S":                                 txscript.ScriptVerifyLowS,
+	"NULLDUMMY":                             txscript.ScriptStrictMultiSig,
+	"SIGPUSHONLY":                           txscript.ScriptVerifySigPushOnly,
+	"MINIMALDATA":                           txscript.ScriptVerifyMinimalData,
+	"CLEANSTACK":                            txscript.ScriptVerifyCleanStack,
+	"CHECKLOCKTIMEVERIFY":                   txscript.ScriptVerifyCheckLockTimeVerify,
+	"CHECKSEQUENCEVERIFY":                   txscript.ScriptVerifyCheckSequenceVerify,
+	"WITNESS":                               txscript.ScriptVerifyWitness,
+	"MINIMALIF":                             txscript.ScriptVerifyMinimalIf,
+	"NULLFAIL":                              txscript.ScriptVerifyNullFail,
+	"WITNESS_PUBKEYTYPE":                    txscript.ScriptVerifyWitnessPubKeyType,
+	"DISCOURAGE_UPGRADABLE_NOPS":            txscript.ScriptDiscourageUpgradableNops,
+	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": txscript.ScriptVerifyDiscourageUpgradeableWitnessProgram,
+}
+
+// parseScriptFlagActivations parses the passed script flag activations of the
+// form '<height>:<flag>,<flag>,...'.  The activations are returned in the order
+// they are specified.
+func parseScriptFlagActivations(entries []string) ([]blockchain.ScriptFlagActivation, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	activations := make([]blockchain.ScriptFlagActivation, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unable to parse script flags %q "+
+				"-- use the syntax <height>:<flag>,<flag>,...", entry)
+		}
+
+		height, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("unable to parse script flags %q "+
+				"due to malformed height", entry)
+		}
+
+		var flags txscript.ScriptFlags
+		for _, name := range strings.Split(parts[1], ",") {
+			flag, ok := scriptFlagsByName[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unable to parse script "+
+					"flags %q due to unknown flag %q", entry,
+					name)
+			}
+			flags |= flag
+		}
+
+		activations = append(activations, blockchain.ScriptFlagActivation{
+			Height: int32(height),
+			Flags:  flags,
+		})
+	}
+	return activations, nil
+}
+
+// parseRPCWhitelists parses the passed slice of RPC whitelist entries of the
+// form '<user>:<method>,<method>,...' into a map of usernames to the set of
+// methods the user is allowed to invoke.  Multiple entries for the same user
+// are merged.  An error is returned for malformed entries and methods that
+// are not registered with btcjson.
+func parseRPCWhitelists(entries []string) (map[string]map[string]struct{}, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	whitelists := make(map[string]map[string]struct{})
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("RPC whitelist entry '%s' is not "+
+				"of the form '<user>:<method>,<method>,...'", entry)
+		}
+
+		user := parts[0]
+		methods, ok := whitelists[user]
+		if !ok {
+			methods = make(map[string]struct{})
+			whitelists[user] = methods
+		}
+		for _, method := range strings.Split(parts[1], ",") {
+			method = strings.TrimSpace(method)
+			if method == "" {
+				continue
+			}
+			if _, err := btcjson.MethodUsageFlags(method); err != nil {
+				return nil, fmt.Errorf("RPC whitelist entry "+
+					"'%s' contains unknown method '%s'",
+					entry, method)
+			}
+			methods[method] = struct{}{}
+		}
+	}
+
+	return whitelists, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -392,6 +568,31 @@ func newConfigParser(cfg *config, so *serviceOptions, options flags.Options) *fl
 	return parser
 }
 
+// validateUserAgentComments returns an error when any of the passed user agent
+// comments contains characters which are not allowed by BIP 14 or when they
+// make the user agent advertised to peers exceed the maximum length allowed in
+// version messages.
+func validateUserAgentComments(comments []string) error {
+	for _, comment := range comments {
+		if wire.ValidateUserAgentComment(comment) != nil {
+			return fmt.Errorf("the following characters must not " +
+				"appear in user agent comments: '/', ':', '(', " +
+				"')' -- only printable ASCII characters are allowed")
+		}
+	}
+
+	versionMsg := wire.NewMsgVersion(&wire.NetAddress{}, &wire.NetAddress{},
+		0, 0)
+	err := versionMsg.AddUserAgent(userAgentName, userAgentVersion,
+		comments...)
+	if err != nil {
+		return fmt.Errorf("the user agent comments are too long -- the "+
+			"user agent must not exceed %d characters",
+			wire.MaxUserAgentLen)
+	}
+	return nil
+}
+
 // loadConfig initializes and parses the config using a config file and command
 // line options.
 //
@@ -410,6 +611,7 @@ func loadConfig() (*config, []string, error) {
 		ConfigFile:           defaultConfigFile,
 		DebugLevel:           defaultLogLevel,
 		MaxPeers:             defaultMaxPeers,
+		TargetOutbound:       defaultTargetOutbound,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
 		RPCMaxClients:        defaultMaxRPCClients,
@@ -417,20 +619,35 @@ func loadConfig() (*config, []string, error) {
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
+		LogFormat:            defaultLogFormat,
 		DbType:               defaultDbType,
+		DbFlushInterval:      defaultDbFlushInterval,
+		DbSyncMode:           defaultDbSyncMode,
 		RPCKey:               defaultRPCKeyFile,
 		RPCCert:              defaultRPCCertFile,
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToBTC(),
+		DustRelayFee:         mempool.DefaultDustRelayFee.ToBTC(),
+		DataCarrierSize:      mempool.DefaultMaxDataCarrierSize,
+		DataCarrierOutputs:   mempool.DefaultMaxDataCarrierOutputs,
 		FreeTxRelayLimit:     defaultFreeTxRelayLimit,
 		TrickleInterval:      defaultTrickleInterval,
+		SyncStallTimeout:     defaultSyncStallTimeout,
 		BlockMinSize:         defaultBlockMinSize,
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockMinWeight:       defaultBlockMinWeight,
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
+		CoinbaseFlags:        mining.CoinbaseFlags,
+		MaxOrphanBlocks:      defaultMaxOrphanBlocks,
+		MaxOrphanBlocksMiB:   defaultMaxOrphanBlocksMiB,
+		OrphanBlockExpiry:    defaultOrphanBlockExpiry,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxFilterAddRate:     defaultMaxFilterAddRate,
+		MaxFilterLoadSize:    wire.MaxFilterLoadFilterSize,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		UtxoCacheMaxSizeMiB:  defaultUtxoCacheMaxSizeMiB,
 		Generate:             defaultGenerate,
+		MinerCPUFraction:     defaultMinerCPUFraction,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
 	}
@@ -540,6 +757,10 @@ func loadConfig() (*config, []string, error) {
 		numNets++
 		activeNetParams = &testNet3Params
 	}
+	if cfg.TestNet4 {
+		numNets++
+		activeNetParams = &testNet4Params
+	}
 	if cfg.RegressionTest {
 		numNets++
 		activeNetParams = &regressionNetParams
@@ -551,8 +772,8 @@ func loadConfig() (*config, []string, error) {
 		cfg.DisableDNSSeed = true
 	}
 	if numNets > 1 {
-		str := "%s: The testnet, regtest, segnet, and simnet params " +
-			"can't be used together -- choose one of the four"
+		str := "%s: The testnet, testnet4, regtest, segnet, and simnet " +
+			"params can't be used together -- choose one of the five"
 		err := fmt.Errorf(str, funcName)
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintln(os.Stderr, usageMessage)
@@ -599,6 +820,21 @@ func loadConfig() (*config, []string, error) {
 		os.Exit(0)
 	}
 
+	// Validate the log format.  Logs are written as JSON objects instead of
+	// text when requested.
+	switch cfg.LogFormat {
+	case "text":
+	case "json":
+		logJSON = true
+	default:
+		str := "%s: The specified log format [%v] is invalid -- " +
+			"supported formats are text and json"
+		err := fmt.Errorf(str, funcName, cfg.LogFormat)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Initialize log rotation.  After log rotation has been initialized, the
 	// logger variables may be used.
 	initLogRotator(filepath.Join(cfg.LogDir, defaultLogFilename))
@@ -621,6 +857,24 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the database flush interval and sync mode.
+	if cfg.DbFlushInterval <= 0 {
+		str := "%s: The database flush interval must be positive -- " +
+			"parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbFlushInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.DbSyncMode != "batched" && cfg.DbSyncMode != "everyblock" {
+		str := "%s: The specified database sync mode [%v] is invalid " +
+			"-- supported modes are batched and everyblock"
+		err := fmt.Errorf(str, funcName, cfg.DbSyncMode)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate profile port number
 	if cfg.Profile != "" {
 		profilePort, err := strconv.Atoi(cfg.Profile)
@@ -642,6 +896,15 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Don't allow sync stall timeouts that are too short.
+	if cfg.SyncStallTimeout < time.Second {
+		str := "%s: The syncstalltimeout option may not be less than 1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.SyncStallTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate any given whitelisted IP addresses and networks.
 	if len(cfg.Whitelists) > 0 {
 		var ip net.IP
@@ -734,6 +997,26 @@ func loadConfig() (*config, []string, error) {
 		btcdLog.Infof("RPC service is disabled")
 	}
 
+	// Validate and parse the per-user RPC method whitelists.  Only the
+	// configured RPC users may be restricted.
+	cfg.rpcWhitelists, err = parseRPCWhitelists(cfg.RPCWhitelists)
+	if err != nil {
+		err := fmt.Errorf("%s: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for user := range cfg.rpcWhitelists {
+		if user != cfg.RPCUser && user != cfg.RPCLimitUser {
+			str := "%s: the --rpcwhitelist option specifies " +
+				"unknown RPC user '%s'"
+			err := fmt.Errorf(str, funcName, user)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Default RPC to listen on localhost only.
 	if !cfg.DisableRPC && len(cfg.RPCListeners) == 0 {
 		addrs, err := net.LookupHost("localhost")
@@ -747,6 +1030,11 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Expand the path of the RPC Unix domain socket when specified.
+	if cfg.RPCUnixSocket != "" {
+		cfg.RPCUnixSocket = cleanAndExpandPath(cfg.RPCUnixSocket)
+	}
+
 	if cfg.RPCMaxConcurrentReqs < 0 {
 		str := "%s: The rpcmaxwebsocketconcurrentrequests option may " +
 			"not be less than 0 -- parsed [%d]"
@@ -765,6 +1053,114 @@ func loadConfig() (*config, []string, error) {
 		fmt.Fprintln(os.Stderr, usageMessage)
 		return nil, nil, err
 	}
+	if cfg.minRelayTxFee < 0 {
+		str := "%s: The minrelaytxfee option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MinRelayTxFee)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the the blockmintxfee.
+	cfg.blockMinTxFee, err = btcutil.NewAmount(cfg.BlockMinTxFee)
+	if err != nil {
+		str := "%s: invalid blockmintxfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.blockMinTxFee < 0 {
+		str := "%s: The blockmintxfee option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.BlockMinTxFee)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the the dustrelayfee.
+	cfg.dustRelayFee, err = btcutil.NewAmount(cfg.DustRelayFee)
+	if err != nil {
+		str := "%s: invalid dustrelayfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.dustRelayFee < 0 {
+		str := "%s: The dustrelayfee option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DustRelayFee)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The bloom filter limits must be sane.
+	if cfg.MaxFilterLoadSize < 0 ||
+		cfg.MaxFilterLoadSize > wire.MaxFilterLoadFilterSize {
+
+		str := "%s: The maxfilterloadsize option must be in between " +
+			"0 and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, wire.MaxFilterLoadFilterSize,
+			cfg.MaxFilterLoadSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxFilterAddRate < 0 {
+		str := "%s: The maxfilteraddrate option may not be less than " +
+			"0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxFilterAddRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The data carrier limits may not be negative.
+	if cfg.DataCarrierSize < 0 {
+		str := "%s: The datacarriersize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DataCarrierSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.DataCarrierOutputs < 0 {
+		str := "%s: The datacarrieroutputs option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DataCarrierOutputs)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the target number of outbound connections to a sane value.
+	if cfg.TargetOutbound < 1 || cfg.TargetOutbound > maxTargetOutbound {
+		str := "%s: The targetoutbound option must be in the range " +
+			"[1, %d] -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, maxTargetOutbound,
+			cfg.TargetOutbound)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The block-relay-only peers are made in addition to the targeted
+	// outbound connections.
+	if cfg.BlockRelayOnlyPeers < 0 ||
+		cfg.BlockRelayOnlyPeers > maxBlockRelayOnlyPeers {
+
+		str := "%s: The blockrelayonlypeers option must be in the " +
+			"range [0, %d] -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, maxBlockRelayOnlyPeers,
+			cfg.BlockRelayOnlyPeers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
 
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
@@ -802,6 +1198,32 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Require sane limits for orphan blocks.
+	if cfg.MaxOrphanBlocks < 1 {
+		str := "%s: The maxorphanblocks option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxOrphanBlocksMiB < 1 {
+		str := "%s: The maxorphanblocksize option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanBlocksMiB)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.OrphanBlockExpiry < time.Second {
+		str := "%s: The orphanblockexpiry option may not be less " +
+			"than 1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.OrphanBlockExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -824,16 +1246,13 @@ func loadConfig() (*config, []string, error) {
 		cfg.BlockMaxWeight = cfg.BlockMaxSize * blockchain.WitnessScaleFactor
 	}
 
-	// Look for illegal characters in the user agent comments.
-	for _, uaComment := range cfg.UserAgentComments {
-		if strings.ContainsAny(uaComment, "/:()") {
-			err := fmt.Errorf("%s: The following characters must not "+
-				"appear in user agent comments: '/', ':', '(', ')'",
-				funcName)
-			fmt.Fprintln(os.Stderr, err)
-			fmt.Fprintln(os.Stderr, usageMessage)
-			return nil, nil, err
-		}
+	// Look for illegal characters in the user agent comments and ensure
+	// they fit in the user agent advertised to peers.
+	if err := validateUserAgentComments(cfg.UserAgentComments); err != nil {
+		err := fmt.Errorf("%s: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
 	}
 
 	// --txindex and --droptxindex do not mix.
@@ -868,6 +1287,59 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --spentindex and --dropspentindex do not mix.
+	if cfg.SpentIndex && cfg.DropSpentIndex {
+		err := fmt.Errorf("%s: the --spentindex and --dropspentindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --coinstatsindex and --dropcoinstatsindex do not mix.
+	if cfg.CoinStatsIndex && cfg.DropCoinStatsIndex {
+		err := fmt.Errorf("%s: the --coinstatsindex and "+
+			"--dropcoinstatsindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --reindex and the options to drop indexes do not mix.
+	if cfg.Reindex && (cfg.DropAddrIndex || cfg.DropCfIndex ||
+		cfg.DropCoinStatsIndex || cfg.DropSpentIndex ||
+		cfg.DropTxIndex) {
+
+		err := fmt.Errorf("%s: the --reindex option may not be "+
+			"activated at the same time as the options to drop "+
+			"indexes", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Committed filters can't be fetched from peers when they are disabled.
+	if cfg.CFClient && cfg.NoCFilters {
+		str := "%s: the --cfclient and --nocfilters options may not " +
+			"be activated at the same time"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The CPU miner must be allowed to use some of the processor cores.
+	if cfg.MinerCPUFraction <= 0 || cfg.MinerCPUFraction > 1 {
+		str := "%s: The minercpufraction option must be greater than 0 " +
+			"and at most 1 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MinerCPUFraction)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -889,6 +1361,17 @@ func loadConfig() (*config, []string, error) {
 		cfg.miningAddrs = append(cfg.miningAddrs, addr)
 	}
 
+	// Ensure the coinbase flags fit in the coinbase signature script along
+	// with an extra nonce of the configured size.
+	if err := mining.ValidateCoinbaseFlags(cfg.CoinbaseFlags,
+		cfg.CoinbaseNonceSize); err != nil {
+
+		err := fmt.Errorf("%s: invalid coinbaseflags: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -956,6 +1439,70 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The onion address of a hidden service may only be advertised when tor
+	// is enabled and must fit the address format relayed to peers, which
+	// only supports version 2 onion addresses.
+	if cfg.ExternalOnion != "" {
+		cfg.ExternalOnion = normalizeAddress(cfg.ExternalOnion,
+			activeNetParams.DefaultPort)
+		host, _, err := net.SplitHostPort(cfg.ExternalOnion)
+		if cfg.NoOnion || err != nil || len(host) != 22 ||
+			!strings.HasSuffix(host, ".onion") {
+
+			str := "%s: The externalonion option must be a version 2 " +
+				"onion address and may not be used with --noonion " +
+				"-- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.ExternalOnion)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Parse the networks outbound connections are restricted to.
+	for _, name := range cfg.OnlyNets {
+		n, err := addrmgr.ParseNetwork(strings.ToLower(name))
+		if err != nil {
+			str := "%s: The onlynet option must be one of ipv4, " +
+				"ipv6, or onion -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, name)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.onlyNets = append(cfg.onlyNets, n)
+	}
+	onlyNet := func(n addrmgr.Network) bool {
+		for _, allowed := range cfg.onlyNets {
+			if allowed == n {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Onion connections require tor to be enabled and reachable through
+	// a proxy.
+	if onlyNet(addrmgr.NetOnion) && (cfg.NoOnion ||
+		(cfg.OnionProxy == "" && cfg.Proxy == "")) {
+
+		str := "%s: The onion network may only be specified with " +
+			"--onlynet when tor is enabled via the --proxy or " +
+			"--onion options"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// DNS seeds only return clearnet addresses, so there is nothing to
+	// seed from when both clearnet networks are excluded.
+	if len(cfg.onlyNets) > 0 && !onlyNet(addrmgr.NetIPv4) &&
+		!onlyNet(addrmgr.NetIPv6) {
+
+		cfg.DisableDNSSeed = true
+	}
+
 	// Check the checkpoints for syntax errors.
 	cfg.addCheckpoints, err = parseCheckpoints(cfg.AddCheckpoints)
 	if err != nil {
@@ -966,6 +1513,55 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the additional script verification flags, which change the
+	// consensus rules and are therefore only allowed on the networks meant
+	// for testing.
+	cfg.scriptFlags, err = parseScriptFlagActivations(
+		cfg.TestScriptFlags)
+	if err != nil {
+		str := "%s: Error parsing testscriptflags: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if len(cfg.scriptFlags) > 0 && !(cfg.RegressionTest ||
+		cfg.SimNet) {
+
+		str := "%s: The testscriptflags option may only be used " +
+			"with --regtest or --simnet"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the assume valid block hash when one is specified.
+	if cfg.AssumeValid != "" {
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid block hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Parse the minimum chain work when one is specified.
+	if cfg.MinChainWork != "" {
+		work, ok := new(big.Int).SetString(cfg.MinChainWork, 16)
+		if !ok || work.Sign() < 0 {
+			str := "%s: The minchainwork option must be a " +
+				"non-negative hex number -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.MinChainWork)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.minChainWork = work
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -976,14 +1572,7 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// Setup dial and DNS resolution (lookup) functions depending on the
-	// specified options.  The default is to use the standard
-	// net.DialTimeout function as well as the system DNS resolver.  When a
-	// proxy is specified, the dial function is set to the proxy specific
-	// dial function and the lookup is set to use tor (unless --noonion is
-	// specified in which case the system DNS resolver is used).
-	cfg.dial = net.DialTimeout
-	cfg.lookup = net.LookupIP
+	// Validate the proxy addresses used to route outbound connections.
 	if cfg.Proxy != "" {
 		_, _, err := net.SplitHostPort(cfg.Proxy)
 		if err != nil {
@@ -993,43 +1582,7 @@ func loadConfig() (*config, []string, error) {
 			fmt.Fprintln(os.Stderr, usageMessage)
 			return nil, nil, err
 		}
-
-		// Tor isolation flag means proxy credentials will be overridden
-		// unless there is also an onion proxy configured in which case
-		// that one will be overridden.
-		torIsolation := false
-		if cfg.TorIsolation && cfg.OnionProxy == "" &&
-			(cfg.ProxyUser != "" || cfg.ProxyPass != "") {
-
-			torIsolation = true
-			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
-				"overriding specified proxy user credentials")
-		}
-
-		proxy := &socks.Proxy{
-			Addr:         cfg.Proxy,
-			Username:     cfg.ProxyUser,
-			Password:     cfg.ProxyPass,
-			TorIsolation: torIsolation,
-		}
-		cfg.dial = proxy.DialTimeout
-
-		// Treat the proxy as tor and perform DNS resolution through it
-		// unless the --noonion flag is set or there is an
-		// onion-specific proxy configured.
-		if !cfg.NoOnion && cfg.OnionProxy == "" {
-			cfg.lookup = func(host string) ([]net.IP, error) {
-				return connmgr.TorLookupIP(host, cfg.Proxy)
-			}
-		}
 	}
-
-	// Setup onion address dial function depending on the specified options.
-	// The default is to use the same dial function selected above.  However,
-	// when an onion-specific proxy is specified, the onion address dial
-	// function is set to use the onion-specific proxy while leaving the
-	// normal dial function as selected above.  This allows .onion address
-	// traffic to be routed through a different proxy than normal traffic.
 	if cfg.OnionProxy != "" {
 		_, _, err := net.SplitHostPort(cfg.OnionProxy)
 		if err != nil {
@@ -1039,46 +1592,11 @@ func loadConfig() (*config, []string, error) {
 			fmt.Fprintln(os.Stderr, usageMessage)
 			return nil, nil, err
 		}
-
-		// Tor isolation flag means onion proxy credentials will be
-		// overridden.
-		if cfg.TorIsolation &&
-			(cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
-			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
-				"overriding specified onionproxy user "+
-				"credentials ")
-		}
-
-		cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
-			proxy := &socks.Proxy{
-				Addr:         cfg.OnionProxy,
-				Username:     cfg.OnionProxyUser,
-				Password:     cfg.OnionProxyPass,
-				TorIsolation: cfg.TorIsolation,
-			}
-			return proxy.DialTimeout(network, addr, timeout)
-		}
-
-		// When configured in bridge mode (both --onion and --proxy are
-		// configured), it means that the proxy configured by --proxy is
-		// not a tor proxy, so override the DNS resolution to use the
-		// onion-specific proxy.
-		if cfg.Proxy != "" {
-			cfg.lookup = func(host string) ([]net.IP, error) {
-				return connmgr.TorLookupIP(host, cfg.OnionProxy)
-			}
-		}
-	} else {
-		cfg.oniondial = cfg.dial
 	}
 
-	// Specifying --noonion means the onion address dial function results in
-	// an error.
-	if cfg.NoOnion {
-		cfg.oniondial = func(a, b string, t time.Duration) (net.Conn, error) {
-			return nil, errors.New("tor has been disabled")
-		}
-	}
+	// Route outbound connections and DNS resolution through the configured
+	// proxies.
+	setupProxyDialers(&cfg)
 
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
@@ -1157,12 +1675,113 @@ func createDefaultConfigFile(destinationPath string) error {
 	return nil
 }
 
+// setupProxyDialers sets the dial functions used for clearnet and onion
+// addresses along with the DNS resolution function of the passed config
+// depending on its proxy options.  The proxy addresses must already have been
+// validated.
+func setupProxyDialers(cfg *config) {
+	// Setup dial and DNS resolution (lookup) functions depending on the
+	// specified options.  The default is to use the standard
+	// net.DialTimeout function as well as the system DNS resolver.  When a
+	// proxy is specified, the dial function is set to the proxy specific
+	// dial function and the lookup is set to use tor (unless --noonion is
+	// specified in which case the system DNS resolver is used).
+	cfg.dial = net.DialTimeout
+	cfg.lookup = net.LookupIP
+	if cfg.Proxy != "" {
+		// Tor isolation flag means proxy credentials will be overridden
+		// unless there is also an onion proxy configured in which case
+		// that one will be overridden.
+		torIsolation := false
+		if cfg.TorIsolation && cfg.OnionProxy == "" &&
+			(cfg.ProxyUser != "" || cfg.ProxyPass != "") {
+
+			torIsolation = true
+			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
+				"overriding specified proxy user credentials")
+		}
+
+		proxy := &socks.Proxy{
+			Addr:         cfg.Proxy,
+			Username:     cfg.ProxyUser,
+			Password:     cfg.ProxyPass,
+			TorIsolation: torIsolation,
+		}
+		cfg.dial = proxy.DialTimeout
+
+		// Treat the proxy as tor and perform DNS resolution through it
+		// unless the --noonion flag is set or there is an
+		// onion-specific proxy configured.
+		if !cfg.NoOnion && cfg.OnionProxy == "" {
+			cfg.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.Proxy)
+			}
+		}
+	}
+
+	// Setup onion address dial function depending on the specified options.
+	// The default is to use the same dial function selected above.  However,
+	// when an onion-specific proxy is specified, the onion address dial
+	// function is set to use the onion-specific proxy while leaving the
+	// normal dial function as selected above.  This allows .onion address
+	// traffic to be routed through a different proxy than normal traffic.
+	if cfg.OnionProxy != "" {
+		// Tor isolation flag means onion proxy credentials will be
+		// overridden.
+		if cfg.TorIsolation &&
+			(cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
+			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
+				"overriding specified onionproxy user "+
+				"credentials ")
+		}
+
+		cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+			proxy := &socks.Proxy{
+				Addr:         cfg.OnionProxy,
+				Username:     cfg.OnionProxyUser,
+				Password:     cfg.OnionProxyPass,
+				TorIsolation: cfg.TorIsolation,
+			}
+			return proxy.DialTimeout(network, addr, timeout)
+		}
+
+		// When configured in bridge mode (both --onion and --proxy are
+		// configured), it means that the proxy configured by --proxy is
+		// not a tor proxy, so override the DNS resolution to use the
+		// onion-specific proxy.
+		if cfg.Proxy != "" {
+			cfg.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.OnionProxy)
+			}
+		}
+	} else {
+		cfg.oniondial = cfg.dial
+	}
+
+	// Specifying --noonion means the onion address dial function results in
+	// an error.
+	if cfg.NoOnion {
+		cfg.oniondial = func(a, b string, t time.Duration) (net.Conn, error) {
+			return nil, errors.New("tor has been disabled")
+		}
+	}
+}
+
 // btcdDial connects to the address on the named network using the appropriate
 // dial function depending on the address and configuration options.  For
 // example, .onion addresses will be dialed using the onion specific proxy if
 // one was specified, but will otherwise use the normal dial function (which
 // could itself use a proxy or not).
 func btcdDial(addr net.Addr) (net.Conn, error) {
+	// Tor addresses encoded in the onioncat IPv6 range are dialed as the
+	// .onion address they represent so they are routed through tor.
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		na := wire.NewNetAddress(tcpAddr, 0)
+		if addrmgr.IsOnionCatTor(na) {
+			addr = &onionAddr{addr: addrmgr.NetAddressKey(na)}
+		}
+	}
+
 	if strings.Contains(addr.String(), ".onion:") {
 		return cfg.oniondial(addr.Network(), addr.String(),
 			defaultConnectTimeout)
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 )
 
 var (
@@ -70,3 +81,321 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestParseRPCWhitelists ensures RPC method whitelist entries are parsed and
+// validated as expected.
+func TestParseRPCWhitelists(t *testing.T) {
+	whitelists, err := parseRPCWhitelists([]string{
+		"monitor:getblockcount,getbestblockhash",
+		"monitor:uptime",
+	})
+	if err != nil {
+		t.Fatalf("parseRPCWhitelists: unexpected error: %v", err)
+	}
+	methods, ok := whitelists["monitor"]
+	if !ok {
+		t.Fatal("parseRPCWhitelists: missing whitelist for user")
+	}
+	for _, method := range []string{"getblockcount", "getbestblockhash",
+		"uptime"} {
+
+		if _, ok := methods[method]; !ok {
+			t.Errorf("parseRPCWhitelists: method %q not whitelisted",
+				method)
+		}
+	}
+	if len(methods) != 3 {
+		t.Errorf("parseRPCWhitelists: unexpected number of methods "+
+			"-- got %d, want 3", len(methods))
+	}
+
+	invalid := []string{
+		"monitor",
+		":getblockcount",
+		"monitor:getblockcount,notarealmethod",
+	}
+	for _, entry := range invalid {
+		if _, err := parseRPCWhitelists([]string{entry}); err == nil {
+			t.Errorf("parseRPCWhitelists: expected error for %q",
+				entry)
+		}
+	}
+}
+
+// TestParseScriptFlagActivations ensures additional script verification flags
+// are parsed and validated as expected.
+func TestParseScriptFlagActivations(t *testing.T) {
+	activations, err := parseScriptFlagActivations([]string{
+		"100:NULLDUMMY",
+		"0:CLEANSTACK,WITNESS",
+	})
+	if err != nil {
+		t.Fatalf("parseScriptFlagActivations: unexpected error: %v", err)
+	}
+	want := []blockchain.ScriptFlagActivation{{
+		Height: 100,
+		Flags:  txscript.ScriptStrictMultiSig,
+	}, {
+		Height: 0,
+		Flags:  txscript.ScriptVerifyCleanStack | txscript.ScriptVerifyWitness,
+	}}
+	if !reflect.DeepEqual(activations, want) {
+		t.Errorf("parseScriptFlagActivations: unexpected activations "+
+			"-- got %+v, want %+v", activations, want)
+	}
+
+	invalid := []string{
+		"NULLDUMMY",
+		"-1:NULLDUMMY",
+		"height:NULLDUMMY",
+		"100:",
+		"100:NULLDUMMY,NOTAREALFLAG",
+	}
+	for _, entry := range invalid {
+		_, err := parseScriptFlagActivations([]string{entry})
+		if err == nil {
+			t.Errorf("parseScriptFlagActivations: expected error "+
+				"for %q", entry)
+		}
+	}
+}
+
+// TestValidateUserAgentComments ensures user agent comments which contain
+// characters reserved by BIP 14 or which make the user agent too long are
+// rejected.
+func TestValidateUserAgentComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []string
+		valid    bool
+	}{
+		{name: "no comments", valid: true},
+		{
+			name:     "valid comments",
+			comments: []string{"modified build", "patch-1.2"},
+			valid:    true,
+		},
+		{name: "reserved slash", comments: []string{"a/b"}},
+		{name: "reserved colon", comments: []string{"a:b"}},
+		{name: "reserved parentheses", comments: []string{"(ab)"}},
+		{name: "control character", comments: []string{"a\tb"}},
+		{
+			name:     "too long",
+			comments: []string{strings.Repeat("a", wire.MaxUserAgentLen)},
+		},
+	}
+	for _, test := range tests {
+		err := validateUserAgentComments(test.comments)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+// socksRequest describes a connection request received by a test SOCKS5 proxy.
+type socksRequest struct {
+	user, pass string
+	target     string
+}
+
+// serveTestSOCKSProxy accepts connections on the passed listener and completes
+// the SOCKS5 handshake for each of them, recording the credentials and target
+// of every connection request.
+func serveTestSOCKSProxy(listener net.Listener, requests chan<- socksRequest) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			var req socksRequest
+			buf := make([]byte, 256)
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			methods := buf[1]
+			if _, err := io.ReadFull(conn, buf[:methods]); err != nil {
+				return
+			}
+			if bytes.IndexByte(buf[:methods], 2) != -1 {
+				// Username and password authentication.
+				conn.Write([]byte{5, 2})
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				user := make([]byte, buf[1])
+				if _, err := io.ReadFull(conn, user); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+					return
+				}
+				pass := make([]byte, buf[0])
+				if _, err := io.ReadFull(conn, pass); err != nil {
+					return
+				}
+				req.user, req.pass = string(user), string(pass)
+				conn.Write([]byte{1, 0})
+			} else {
+				conn.Write([]byte{5, 0})
+			}
+
+			// Connection request with a domain name target.
+			if _, err := io.ReadFull(conn, buf[:5]); err != nil {
+				return
+			}
+			host := make([]byte, buf[4])
+			if _, err := io.ReadFull(conn, host); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			port := int(buf[0])<<8 | int(buf[1])
+			req.target = net.JoinHostPort(string(host), strconv.Itoa(port))
+			requests <- req
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			io.Copy(ioutil.Discard, conn)
+		}(conn)
+	}
+}
+
+// TestProxyDialRouting ensures outbound connections are dialed through the
+// proxy configured for the network of the address using the credentials of
+// that proxy.
+func TestProxyDialRouting(t *testing.T) {
+	newProxy := func() (string, chan socksRequest) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unable to listen: %v", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		requests := make(chan socksRequest, 1)
+		go serveTestSOCKSProxy(listener, requests)
+		return listener.Addr().String(), requests
+	}
+	proxy, proxyRequests := newProxy()
+	onionProxy, onionProxyRequests := newProxy()
+
+	const onionHost = "3g2upl4pq6kufc4m.onion"
+	onionCatIP := net.ParseIP("fd87:d87e:eb43:d9b5:47af:8f87:9542:8b8c")
+	clearnet := &net.TCPAddr{IP: net.ParseIP("12.1.2.3"), Port: 8333}
+	onion := &onionAddr{addr: onionHost + ":8333"}
+	onionCat := &net.TCPAddr{IP: onionCatIP, Port: 8333}
+
+	origCfg := cfg
+	defer func() { cfg = origCfg }()
+
+	tests := []struct {
+		name       string
+		cfg        config
+		addr       net.Addr
+		requests   chan socksRequest
+		wantUser   string
+		wantPass   string
+		wantTarget string
+	}{
+		{
+			name: "clearnet through default proxy",
+			cfg: config{
+				Proxy:          proxy,
+				ProxyUser:      "user",
+				ProxyPass:      "pass",
+				OnionProxy:     onionProxy,
+				OnionProxyUser: "onionuser",
+				OnionProxyPass: "onionpass",
+			},
+			addr:       clearnet,
+			requests:   proxyRequests,
+			wantUser:   "user",
+			wantPass:   "pass",
+			wantTarget: clearnet.String(),
+		},
+		{
+			name: "onion through onion proxy",
+			cfg: config{
+				Proxy:          proxy,
+				ProxyUser:      "user",
+				ProxyPass:      "pass",
+				OnionProxy:     onionProxy,
+				OnionProxyUser: "onionuser",
+				OnionProxyPass: "onionpass",
+			},
+			addr:       onion,
+			requests:   onionProxyRequests,
+			wantUser:   "onionuser",
+			wantPass:   "onionpass",
+			wantTarget: onion.String(),
+		},
+		{
+			name: "onioncat through onion proxy",
+			cfg: config{
+				Proxy:      proxy,
+				OnionProxy: onionProxy,
+			},
+			addr:       onionCat,
+			requests:   onionProxyRequests,
+			wantTarget: onion.String(),
+		},
+		{
+			name:       "onion through default proxy",
+			cfg:        config{Proxy: proxy},
+			addr:       onion,
+			requests:   proxyRequests,
+			wantTarget: onion.String(),
+		},
+	}
+	for _, test := range tests {
+		testCfg := test.cfg
+		setupProxyDialers(&testCfg)
+		cfg = &testCfg
+
+		conn, err := btcdDial(test.addr)
+		if err != nil {
+			t.Errorf("%s: unexpected dial error: %v", test.name, err)
+			continue
+		}
+		conn.Close()
+
+		select {
+		case req := <-test.requests:
+			if req.user != test.wantUser || req.pass != test.wantPass {
+				t.Errorf("%s: unexpected credentials - got %s:%s, "+
+					"want %s:%s", test.name, req.user, req.pass,
+					test.wantUser, test.wantPass)
+			}
+			if req.target != test.wantTarget {
+				t.Errorf("%s: unexpected target - got %s, want %s",
+					test.name, req.target, test.wantTarget)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: address not dialed through the expected "+
+				"proxy", test.name)
+		}
+
+		// No request may reach the other proxy.
+		select {
+		case req := <-proxyRequests:
+			t.Errorf("%s: unexpected request through the default "+
+				"proxy: %+v", test.name, req)
+		case req := <-onionProxyRequests:
+			t.Errorf("%s: unexpected request through the onion "+
+				"proxy: %+v", test.name, req)
+		default:
+		}
+	}
+
+	// Onion addresses must never be dialed when tor is disabled.
+	testCfg := config{Proxy: proxy, NoOnion: true}
+	setupProxyDialers(&testCfg)
+	cfg = &testCfg
+	if conn, err := btcdDial(onion); err == nil {
+		conn.Close()
+		t.Fatal("onion address dialed with tor disabled")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,6 +23,10 @@ var (
 	//ErrDialNil is used to indicate that Dial cannot be nil in the configuration.
 	ErrDialNil = errors.New("Config: Dial cannot be nil")
 
+	// ErrUnreachable is used to indicate that a connection was refused
+	// because the address is not on a network allowed by the configuration.
+	ErrUnreachable = errors.New("address is not on a reachable network")
+
 	// maxRetryDuration is the max duration of time retrying of a persistent
 	// connection is allowed to grow to.  This is necessary since the retry
 	// logic uses a backoff mechanism which increases the interval base times
@@ -61,6 +66,11 @@ type ConnReq struct {
 	Addr      net.Addr
 	Permanent bool
 
+	// Manual indicates the connection was requested by the user, such as
+	// via the addnode RPC, rather than made automatically to an address
+	// obtained with GetNewAddress.
+	Manual bool
+
 	conn       net.Conn
 	state      ConnState
 	stateMtx   sync.RWMutex
@@ -142,6 +152,29 @@ type Config struct {
 
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(net.Addr) (net.Conn, error)
+
+	// IsReachable returns whether or not connections to the address are
+	// allowed.  Addresses it rejects are never dialed, and permanent
+	// connection requests for them are not retried.  If nil, all addresses
+	// are reachable.
+	IsReachable func(net.Addr) bool
+
+	// FeelerInterval is the duration between feeler connections, which
+	// are short-lived connections made to test whether an address is
+	// reachable.  Feeler connections do not count towards TargetOutbound
+	// and are never retried.  No feeler connections are made if it is
+	// zero.
+	FeelerInterval time.Duration
+
+	// GetFeelerAddress is a way to get an address to make a feeler
+	// connection to.  If nil, no feeler connections are made.
+	GetFeelerAddress func() (net.Addr, error)
+
+	// OnFeelerConnection is a callback that is fired when a feeler
+	// connection is established.  It is the caller's responsibility to
+	// close the connection once the address has been tested.  If nil, no
+	// feeler connections are made.
+	OnFeelerConnection func(net.Addr, net.Conn)
 }
 
 // registerPending is used to register a pending connection attempt. By
@@ -171,6 +204,11 @@ type handleFailed struct {
 	err error
 }
 
+// getPermanent is used to query the permanent connection requests.
+type getPermanent struct {
+	reply chan []*ConnReq
+}
+
 // ConnManager provides a manager to handle network connections.
 type ConnManager struct {
 	// The following variables must only be used atomically.
@@ -342,9 +380,31 @@ out:
 				}
 
 				connReq.updateState(ConnFailing)
+				if msg.err == ErrUnreachable && connReq.Permanent {
+					log.Warnf("Not connecting to %v: %v",
+						connReq, msg.err)
+					continue
+				}
 				log.Debugf("Failed to connect to %v: %v",
 					connReq, msg.err)
 				cm.handleFailedConn(connReq)
+
+			case getPermanent:
+				var reqs []*ConnReq
+				for _, connReq := range pending {
+					if connReq.Permanent {
+						reqs = append(reqs, connReq)
+					}
+				}
+				for _, connReq := range conns {
+					if connReq.Permanent {
+						reqs = append(reqs, connReq)
+					}
+				}
+				sort.Slice(reqs, func(i, j int) bool {
+					return reqs[i].id < reqs[j].id
+				})
+				msg.reply <- reqs
 			}
 
 		case <-cm.quit:
@@ -439,6 +499,15 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 		}
 	}
 
+	// Never dial addresses on networks that are not reachable.
+	if cm.cfg.IsReachable != nil && !cm.cfg.IsReachable(c.Addr) {
+		select {
+		case cm.requests <- handleFailed{c, ErrUnreachable}:
+		case <-cm.quit:
+		}
+		return
+	}
+
 	log.Debugf("Attempting to connect to %v", c)
 
 	conn, err := cm.cfg.Dial(c.Addr)
@@ -486,6 +555,30 @@ func (cm *ConnManager) Remove(id uint64) {
 	}
 }
 
+// PermanentConnReqs returns the permanent connection requests that have not
+// been removed ordered by their id.  This includes both the requests whose
+// connection is established and those that are still being retried, which can
+// be told apart by their state.
+func (cm *ConnManager) PermanentConnReqs() []*ConnReq {
+	if atomic.LoadInt32(&cm.stop) != 0 {
+		return nil
+	}
+
+	reply := make(chan []*ConnReq, 1)
+	select {
+	case cm.requests <- getPermanent{reply}:
+	case <-cm.quit:
+		return nil
+	}
+
+	select {
+	case reqs := <-reply:
+		return reqs
+	case <-cm.quit:
+		return nil
+	}
+}
+
 // listenHandler accepts incoming connections on a given listener.  It must be
 // run as a goroutine.
 func (cm *ConnManager) listenHandler(listener net.Listener) {
@@ -506,6 +599,50 @@ func (cm *ConnManager) listenHandler(listener net.Listener) {
 	log.Tracef("Listener handler done for %s", listener.Addr())
 }
 
+// feelerHandler periodically makes a feeler connection to an address obtained
+// with GetFeelerAddress.  It must be run as a goroutine.
+func (cm *ConnManager) feelerHandler() {
+	ticker := time.NewTicker(cm.cfg.FeelerInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			cm.feel()
+
+		case <-cm.quit:
+			break out
+		}
+	}
+
+	cm.wg.Done()
+	log.Trace("Feeler handler done")
+}
+
+// feel makes a single feeler connection and hands it to the OnFeelerConnection
+// callback once it is established.
+func (cm *ConnManager) feel() {
+	addr, err := cm.cfg.GetFeelerAddress()
+	if err != nil {
+		log.Debugf("Unable to get feeler address: %v", err)
+		return
+	}
+	if cm.cfg.IsReachable != nil && !cm.cfg.IsReachable(addr) {
+		log.Debugf("Skipping feeler connection to unreachable address %v",
+			addr)
+		return
+	}
+
+	log.Debugf("Attempting feeler connection to %v", addr)
+	conn, err := cm.cfg.Dial(addr)
+	if err != nil {
+		log.Debugf("Feeler connection to %v failed: %v", addr, err)
+		return
+	}
+	go cm.cfg.OnFeelerConnection(addr, conn)
+}
+
 // Start launches the connection manager and begins connecting to the network.
 func (cm *ConnManager) Start() {
 	// Already started?
@@ -529,6 +666,15 @@ func (cm *ConnManager) Start() {
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq()
 	}
+
+	// Start making feeler connections so long as the caller provided the
+	// means to obtain their addresses and to handle them.
+	if cm.cfg.FeelerInterval > 0 && cm.cfg.GetFeelerAddress != nil &&
+		cm.cfg.OnFeelerConnection != nil {
+
+		cm.wg.Add(1)
+		go cm.feelerHandler()
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -299,6 +300,97 @@ func TestRetryPermanent(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestPermanentConnReqs tests that the permanent connection requests are
+// reported both while their connection is pending and once it is established,
+// and that they are no longer reported once they are removed.
+func TestPermanentConnReqs(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	blockingDialer := func(addr net.Addr) (net.Conn, error) {
+		if addr.(*net.TCPAddr).Port == 18555 {
+			dialing <- struct{}{}
+			<-release
+		}
+		return mockDialer(addr)
+	}
+
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound: 1,
+		Dial:           blockingDialer,
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+
+	checkConnReqs := func(desc string, want []*ConnReq, wantState ConnState) {
+		t.Helper()
+		got := cmgr.PermanentConnReqs()
+		if len(got) != len(want) {
+			t.Fatalf("%s: want %d conn reqs, got %d", desc, len(want),
+				len(got))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: want conn req %v, got %v", desc,
+					want[i], got[i])
+			}
+			if state := got[i].State(); state != wantState {
+				t.Fatalf("%s: want state %v, got state %v", desc,
+					wantState, state)
+			}
+		}
+	}
+
+	// Ensure the permanent request is reported while it is pending.
+	cr := &ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 18555,
+		},
+		Permanent: true,
+	}
+	go cmgr.Connect(cr)
+	<-dialing
+	checkConnReqs("pending", []*ConnReq{cr}, ConnPending)
+
+	// Ensure requests that are not permanent are not reported.
+	go cmgr.Connect(&ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 18556,
+		},
+	})
+	<-connected
+	checkConnReqs("not permanent", []*ConnReq{cr}, ConnPending)
+
+	// Ensure the permanent request is reported once it is established.
+	close(release)
+	if gotConnReq := <-connected; gotConnReq != cr {
+		t.Fatalf("connected: want conn req %v, got %v", cr, gotConnReq)
+	}
+	checkConnReqs("established", []*ConnReq{cr}, ConnEstablished)
+
+	// Ensure the permanent request is no longer reported once removed.
+	cmgr.Remove(cr.ID())
+	<-disconnected
+	checkConnReqs("removed", nil, ConnDisconnected)
+
+	cmgr.Stop()
+	cmgr.Wait()
+	if reqs := cmgr.PermanentConnReqs(); reqs != nil {
+		t.Fatalf("stopped: want no conn reqs, got %v", reqs)
+	}
+}
+
 // TestMaxRetryDuration tests the maximum retry duration.
 //
 // We have a timed dialer which initially returns err but after RetryDuration
@@ -384,6 +476,138 @@ func TestNetworkFailure(t *testing.T) {
 	}
 }
 
+// TestUnreachable tests that the connection manager never dials addresses
+// rejected by the IsReachable callback, whether they are returned by
+// GetNewAddress or requested as permanent connections.
+func TestUnreachable(t *testing.T) {
+	onion := &mockAddr{"tcp", "3g2upl4pq6kufc4m.onion:8333"}
+	clearnet := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555}
+
+	var clearnetDials uint32
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound: 2,
+		RetryDuration:  time.Millisecond,
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			if addr.String() != onion.String() {
+				atomic.AddUint32(&clearnetDials, 1)
+			}
+			return mockDialer(addr)
+		},
+		GetNewAddress: func() (net.Addr, error) {
+			return clearnet, nil
+		},
+		IsReachable: func(addr net.Addr) bool {
+			return strings.HasSuffix(addr.String(), ".onion:8333")
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	defer func() {
+		cmgr.Stop()
+		cmgr.Wait()
+	}()
+
+	// A permanent request for a clearnet address must fail without being
+	// dialed or retried.
+	clearnetReq := &ConnReq{Addr: clearnet, Permanent: true}
+	cmgr.Connect(clearnetReq)
+
+	// A permanent request for an onion address is still connected.
+	onionReq := &ConnReq{Addr: onion, Permanent: true}
+	go cmgr.Connect(onionReq)
+	select {
+	case c := <-connected:
+		if c.Addr.String() != onion.String() {
+			t.Fatalf("unreachable: got unexpected connection - %v",
+				c.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unreachable: onion connection not established")
+	}
+
+	// Give the automatic connection attempts and any retries time to run.
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case c := <-connected:
+		t.Fatalf("unreachable: got unexpected connection - %v", c.Addr)
+	default:
+	}
+	if dials := atomic.LoadUint32(&clearnetDials); dials != 0 {
+		t.Fatalf("unreachable: clearnet address dialed %d times", dials)
+	}
+	if clearnetReq.State() != ConnFailing {
+		t.Fatalf("unreachable: unexpected permanent request state - "+
+			"got %v, want %v", clearnetReq.State(), ConnFailing)
+	}
+}
+
+// TestFeeler tests that the connection manager periodically makes feeler
+// connections which do not count towards the target outbound connections and
+// only hands the ones which are established to the feeler callback.
+func TestFeeler(t *testing.T) {
+	reachable := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555}
+	unreachable := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18556}
+
+	var feelers, unreachableDials uint32
+	feelerConns := make(chan net.Addr, 10)
+	cmgr, err := New(&Config{
+		TargetOutbound: 1,
+		FeelerInterval: time.Millisecond,
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			if addr.String() == unreachable.String() {
+				atomic.AddUint32(&unreachableDials, 1)
+				return nil, errors.New("connection refused")
+			}
+			return mockDialer(addr)
+		},
+		GetFeelerAddress: func() (net.Addr, error) {
+			if atomic.AddUint32(&feelers, 1)%2 == 0 {
+				return unreachable, nil
+			}
+			return reachable, nil
+		},
+		OnFeelerConnection: func(addr net.Addr, conn net.Conn) {
+			conn.Close()
+			select {
+			case feelerConns <- addr:
+			default:
+			}
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			t.Errorf("feeler: got unexpected connection - %v", c.Addr)
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	defer func() {
+		cmgr.Stop()
+		cmgr.Wait()
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case addr := <-feelerConns:
+			if addr.String() != reachable.String() {
+				t.Fatalf("feeler: got unexpected feeler connection "+
+					"- %v", addr)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("feeler: feeler connection not established")
+		}
+	}
+	if atomic.LoadUint32(&unreachableDials) == 0 {
+		t.Fatal("feeler: unreachable address never dialed")
+	}
+}
+
 // TestStopFailed tests that failed connections are ignored after connmgr is
 // stopped.
 //
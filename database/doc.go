@@ -43,6 +43,11 @@ The Begin function provides an unmanaged transaction while the View and Update
 functions provide a managed transaction.  These are described in more detail
 below.
 
+The Backup function writes a consistent snapshot of the entire database to a
+writer while the database remains in use.  The Restore function creates a new
+database from such a backup and takes the same driver-specific arguments as
+Create.
+
 Transactions
 
 The Tx interface provides facilities for rolling back or committing changes that
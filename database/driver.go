@@ -6,6 +6,7 @@ package database
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/btcsuite/btclog"
 )
@@ -27,6 +28,13 @@ type Driver struct {
 	// ErrDbDoesNotExist if the database has not already been created.
 	Open func(args ...interface{}) (DB, error)
 
+	// Restore is the function that will be invoked with a backup created
+	// by DB.Backup and all user-specified arguments to create and open a
+	// database from the backup.  This function must return ErrDbExists if
+	// the database already exists.  It may be nil when the driver does not
+	// support restoring backups.
+	Restore func(r io.Reader, args ...interface{}) (DB, error)
+
 	// UseLogger uses a specified Logger to output package logging info.
 	UseLogger func(logger btclog.Logger)
 }
@@ -87,3 +95,25 @@ func Open(dbType string, args ...interface{}) (DB, error) {
 
 	return drv.Open(args...)
 }
+
+// Restore creates and opens a database for the specified type from a backup
+// created by DB.Backup.  The arguments are specific to the database type driver
+// and are the same as those taken by Create.  See the documentation for the
+// database driver for further details.
+//
+// ErrDbUnknownType will be returned if the the database type is not registered
+// and ErrDriverSpecific if the driver does not support restoring backups.
+func Restore(dbType string, r io.Reader, args ...interface{}) (DB, error) {
+	drv, exists := drivers[dbType]
+	if !exists {
+		str := fmt.Sprintf("driver %q is not registered", dbType)
+		return nil, makeError(ErrDbUnknownType, str, nil)
+	}
+	if drv.Restore == nil {
+		str := fmt.Sprintf("driver %q does not support restoring "+
+			"backups", dbType)
+		return nil, makeError(ErrDriverSpecific, str, nil)
+	}
+
+	return drv.Restore(r, args...)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/filter"
+	"github.com/btcsuite/goleveldb/leveldb/opt"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+const (
+	// backupVersion is the version of the format database backups are
+	// written with.
+	backupVersion = 1
+
+	// backupChunkSize is the number of bytes of a block file which are
+	// copied into a backup at a time.  The block file is only locked while
+	// each chunk is read so writers are not held up for the duration of
+	// the backup.
+	backupChunkSize = 1024 * 1024 // 1 MiB
+
+	// maxBackupKeySize is the maximum size of a key or value which is read
+	// from a backup.  It only guards against allocating memory for a bogus
+	// length since no metadata entry comes anywhere close to it.
+	maxBackupKeySize = 32 * 1024 * 1024 // 32 MiB
+
+	// restoreDbSuffix is appended to the name of the metadata database to
+	// form the name of the temporary database the metadata of a backup is
+	// restored into until the checksum of the backup has been verified.
+	restoreDbSuffix = ".restore"
+)
+
+// restoreBatchSize is the approximate maximum number of bytes of metadata
+// entries read from a backup which are buffered in memory before they are
+// written to the temporary metadata database.  It is a variable so the tests
+// are able to exercise restores spanning many batches.
+var restoreBatchSize = 16 * 1024 * 1024 // 16 MiB
+
+// The serialized backup format is:
+//
+//   <version><network><metadata entries><block files><checksum>
+//
+//   Field             Type                Size
+//   version           uint32              4
+//   network           uint32              4
+//   metadata entries  []entry             variable
+//     key             []byte              variable (varint length prefixed)
+//     value           []byte              variable (varint length prefixed)
+//   terminator        varint              1 (empty key)
+//   num block files   varint              variable
+//   block files       []file              variable
+//     length          uint32              4
+//     data            []byte              length
+//   checksum          uint32              4 (Castagnoli CRC-32 of all prior)
+//
+// The metadata entries are the raw key/value pairs of the metadata database,
+// which includes the block index and the write cursor, so the block files are
+// copied verbatim up to the write cursor and the block locations remain valid.
+
+// backupWriter wraps a writer to keep a running checksum of everything written
+// through it.
+type backupWriter struct {
+	w      io.Writer
+	hasher hash.Hash32
+}
+
+// Write writes the passed data to the underlying writer and adds it to the
+// running checksum.
+func (bw *backupWriter) Write(p []byte) (int, error) {
+	n, err := bw.w.Write(p)
+	_, _ = bw.hasher.Write(p[:n])
+	return n, err
+}
+
+// writeUint32 writes the passed value to the writer.
+func writeUint32(w io.Writer, val uint32) error {
+	var scratch [4]byte
+	byteOrder.PutUint32(scratch[:], val)
+	_, err := w.Write(scratch[:])
+	return err
+}
+
+// readUint32 reads a value written by writeUint32 from the reader.
+func readUint32(r io.Reader) (uint32, error) {
+	var scratch [4]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil {
+		return 0, err
+	}
+	return byteOrder.Uint32(scratch[:]), nil
+}
+
+// backupBlockFile copies the first length bytes of the passed block file to
+// the writer.
+func (s *blockStore) backupBlockFile(w io.Writer, fileNum, length uint32) error {
+	buf := make([]byte, backupChunkSize)
+	for offset := uint32(0); offset < length; {
+		chunk := buf
+		if remaining := length - offset; remaining < uint32(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+
+		// Get the block file handle opening the file as needed.  It is
+		// only held while the chunk is read.
+		blockFile, err := s.blockFile(fileNum)
+		if err != nil {
+			return err
+		}
+		_, err = blockFile.file.ReadAt(chunk, int64(offset))
+		blockFile.RUnlock()
+		if err != nil {
+			str := fmt.Sprintf("failed to read block file %d, "+
+				"offset %d, len %d: %v", fileNum, offset,
+				len(chunk), err)
+			return makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		offset += uint32(len(chunk))
+	}
+
+	return nil
+}
+
+// Backup writes a consistent snapshot of the entire database, including all
+// metadata and blocks, to the passed writer.  The database remains usable while
+// the backup is written since the snapshot is taken under a read-only
+// transaction, so anything committed after the backup started is not included.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Backup(w io.Writer) error {
+	tx, err := db.begin(false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// The block files only have to be copied up to the write cursor
+	// matching the snapshot since blocks are only ever appended to them.
+	writeRow := tx.metaBucket.Get(writeLocKeyName)
+	if writeRow == nil {
+		str := "write cursor does not exist"
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+	curFileNum, curOffset, err := deserializeWriteRow(writeRow)
+	if err != nil {
+		return err
+	}
+
+	bw := &backupWriter{w: w, hasher: crc32.New(castagnoli)}
+	if err := writeUint32(bw, backupVersion); err != nil {
+		return err
+	}
+	if err := writeUint32(bw, uint32(db.store.network)); err != nil {
+		return err
+	}
+
+	// Write all of the metadata followed by an empty key to mark the end
+	// of it.
+	iter := tx.snapshot.NewIterator(&util.Range{})
+	defer iter.Release()
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if err := wire.WriteVarBytes(bw, 0, iter.Key()); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(bw, 0, iter.Value()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return convertErr(err.Error(), err)
+	}
+	if err := wire.WriteVarInt(bw, 0, 0); err != nil {
+		return err
+	}
+
+	// Write the block files.  All but the current one are complete, so
+	// their full size is copied.
+	if err := wire.WriteVarInt(bw, 0, uint64(curFileNum)+1); err != nil {
+		return err
+	}
+	for fileNum := uint32(0); fileNum <= curFileNum; fileNum++ {
+		length := curOffset
+		if fileNum < curFileNum {
+			fi, err := os.Stat(blockFilePath(db.store.basePath, fileNum))
+			if err != nil {
+				str := fmt.Sprintf("failed to stat block file "+
+					"%d: %v", fileNum, err)
+				return makeDbErr(database.ErrDriverSpecific, str,
+					err)
+			}
+			length = uint32(fi.Size())
+		}
+
+		if err := writeUint32(bw, length); err != nil {
+			return err
+		}
+		if err := db.store.backupBlockFile(bw, fileNum, length); err != nil {
+			return err
+		}
+	}
+
+	return writeUint32(w, bw.hasher.Sum32())
+}
+
+// restoreFiles writes the metadata and block files read from a backup created
+// by Backup to a new database at the provided path.  The metadata is streamed
+// into a temporary database in bounded batches which is only moved into place
+// once the checksum of the full backup has been verified.
+func restoreFiles(r io.Reader, dbPath string, network wire.BitcoinNet) error {
+	hasher := crc32.New(castagnoli)
+	tr := io.TeeReader(r, hasher)
+
+	version, err := readUint32(tr)
+	if err != nil {
+		return err
+	}
+	if version != backupVersion {
+		str := fmt.Sprintf("unsupported backup version %d (expected "+
+			"%d)", version, backupVersion)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	backupNet, err := readUint32(tr)
+	if err != nil {
+		return err
+	}
+	if wire.BitcoinNet(backupNet) != network {
+		str := fmt.Sprintf("backup is for network %v instead of %v",
+			wire.BitcoinNet(backupNet), network)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+
+	// Remove any temporary metadata database left behind by an earlier
+	// restore that was interrupted and create a new one.
+	metadataDbPath := filepath.Join(dbPath, metadataDbName)
+	restoreDbPath := metadataDbPath + restoreDbSuffix
+	if err := os.RemoveAll(restoreDbPath); err != nil {
+		str := fmt.Sprintf("failed to remove %q: %v", restoreDbPath, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	opts := opt.Options{
+		ErrorIfExist: true,
+		Strict:       opt.DefaultStrict,
+		Compression:  opt.NoCompression,
+		Filter:       filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.OpenFile(restoreDbPath, &opts)
+	if err != nil {
+		return convertErr(err.Error(), err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			_ = ldb.Close()
+			_ = os.RemoveAll(restoreDbPath)
+		}
+	}()
+
+	// Write the metadata in batches of a bounded size.  Only the final
+	// batch is synced since the temporary database is discarded when the
+	// restore fails anyway.
+	batch := new(leveldb.Batch)
+	for {
+		key, err := wire.ReadVarBytes(tr, 0, maxBackupKeySize, "key")
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			break
+		}
+		value, err := wire.ReadVarBytes(tr, 0, maxBackupKeySize, "value")
+		if err != nil {
+			return err
+		}
+		batch.Put(key, value)
+
+		if len(batch.Dump()) >= restoreBatchSize {
+			if err := ldb.Write(batch, nil); err != nil {
+				return convertErr(err.Error(), err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := ldb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return convertErr(err.Error(), err)
+	}
+
+	// Write the block files.
+	numFiles, err := wire.ReadVarInt(tr, 0)
+	if err != nil {
+		return err
+	}
+	for fileNum := uint64(0); fileNum < numFiles; fileNum++ {
+		length, err := readUint32(tr)
+		if err != nil {
+			return err
+		}
+
+		filePath := blockFilePath(dbPath, uint32(fileNum))
+		file, err := os.Create(filePath)
+		if err != nil {
+			str := fmt.Sprintf("failed to create block file %q: %v",
+				filePath, err)
+			return makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		_, err = io.CopyN(file, tr, int64(length))
+		if err == nil {
+			err = file.Sync()
+		}
+		_ = file.Close()
+		if err != nil {
+			str := fmt.Sprintf("failed to write block file %q: %v",
+				filePath, err)
+			return makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+	}
+
+	wantChecksum, err := readUint32(r)
+	if err != nil {
+		return err
+	}
+	if gotChecksum := hasher.Sum32(); gotChecksum != wantChecksum {
+		str := fmt.Sprintf("backup does not match the expected "+
+			"checksum - got %d, want %d", gotChecksum, wantChecksum)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	// Move the verified metadata into place.
+	closed = true
+	if err := ldb.Close(); err != nil {
+		_ = os.RemoveAll(restoreDbPath)
+		return convertErr(err.Error(), err)
+	}
+	if err := os.Rename(restoreDbPath, metadataDbPath); err != nil {
+		_ = os.RemoveAll(restoreDbPath)
+		str := fmt.Sprintf("failed to move the restored metadata to "+
+			"%q: %v", metadataDbPath, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	return nil
+}
+
+// restoreDB creates a new database at the provided path from a backup created
+// by Backup and opens it.  database.ErrDbExists is returned if the database
+// already exists.  Nothing is left behind at the path when the restore fails
+// and the path did not exist beforehand.
+func restoreDB(r io.Reader, dbPath string, network wire.BitcoinNet, maxFileSize uint32, opts *Options) (database.DB, error) {
+	metadataDbPath := filepath.Join(dbPath, metadataDbName)
+	if fileExists(metadataDbPath) {
+		str := fmt.Sprintf("database %q already exists", metadataDbPath)
+		return nil, makeDbErr(database.ErrDbExists, str, nil)
+	}
+
+	pathExists := fileExists(dbPath)
+	if err := os.MkdirAll(dbPath, 0700); err != nil {
+		str := fmt.Sprintf("failed to create database path %q: %v",
+			dbPath, err)
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	if err := restoreFiles(r, dbPath, network); err != nil {
+		if !pathExists {
+			_ = os.RemoveAll(dbPath)
+		}
+		return nil, err
+	}
+
+	return openDB(dbPath, network, maxFileSize, false, opts)
+}
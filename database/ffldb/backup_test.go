@@ -0,0 +1,272 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// dumpBucket returns all of the keys and values in the passed bucket and its
+// nested buckets keyed by their path.
+func dumpBucket(bucket database.Bucket, path string, dump map[string][]byte) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		keyPath := path + "/" + string(k)
+		if v != nil {
+			dump[keyPath] = v
+			return nil
+		}
+		dump[keyPath+"/"] = nil
+		return dumpBucket(bucket.Bucket(k), keyPath, dump)
+	})
+}
+
+// checkSameContents ensures the passed databases contain the same metadata and
+// the same blocks and that their block files are byte-identical.
+func checkSameContents(t *testing.T, db, restored database.DB, dbPath, restoredPath string, blocks []*btcutil.Block) {
+	t.Helper()
+
+	dumps := make([]map[string][]byte, 2)
+	for i, db := range []database.DB{db, restored} {
+		dumps[i] = make(map[string][]byte)
+		err := db.View(func(tx database.Tx) error {
+			if err := dumpBucket(tx.Metadata(), "", dumps[i]); err != nil {
+				return err
+			}
+			for _, block := range blocks {
+				blockBytes, _ := block.Bytes()
+				gotBytes, err := tx.FetchBlock(block.Hash())
+				if err != nil {
+					return fmt.Errorf("FetchBlock: %v", err)
+				}
+				if !bytes.Equal(gotBytes, blockBytes) {
+					return fmt.Errorf("FetchBlock: block %v "+
+						"mismatch", block.Hash())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("View: unexpected error: %v", err)
+		}
+	}
+	if len(dumps[0]) != len(dumps[1]) {
+		t.Fatalf("restored metadata has %d entries instead of %d",
+			len(dumps[1]), len(dumps[0]))
+	}
+	for k, v := range dumps[0] {
+		gotV, ok := dumps[1][k]
+		if !ok || !bytes.Equal(gotV, v) {
+			t.Fatalf("restored metadata entry %q mismatch - got %x, "+
+				"want %x", k, gotV, v)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if err != nil {
+		t.Fatalf("Glob: unexpected error: %v", err)
+	}
+	restoredFiles, err := filepath.Glob(filepath.Join(restoredPath, "*.fdb"))
+	if err != nil {
+		t.Fatalf("Glob: unexpected error: %v", err)
+	}
+	if len(files) < 2 || len(restoredFiles) != len(files) {
+		t.Fatalf("unexpected number of block files - got %d, want %d "+
+			"(at least 2)", len(restoredFiles), len(files))
+	}
+	for _, file := range files {
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile: unexpected error: %v", err)
+		}
+		restoredFile := filepath.Join(restoredPath, filepath.Base(file))
+		got, err := ioutil.ReadFile(restoredFile)
+		if err != nil {
+			t.Fatalf("ReadFile: unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("restored block file %s mismatch",
+				filepath.Base(file))
+		}
+	}
+}
+
+// TestBackupRestore ensures a database backed up while in use is restored into
+// a new database with identical metadata, blocks, and block files, and that
+// invalid backups and restore targets are rejected.
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-backuptest")
+	restoredPath := filepath.Join(os.TempDir(), "ffldb-backuptest-restored")
+	_ = os.RemoveAll(dbPath)
+	_ = os.RemoveAll(restoredPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Populate the database with blocks spread over multiple block files
+	// and nested buckets of metadata, using several transactions so some
+	// of the metadata is still only in the database cache.
+	storeBlocks := func(db database.DB, blocks []*btcutil.Block) {
+		t.Helper()
+		err := db.Update(func(tx database.Tx) error {
+			for _, block := range blocks {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+				bucket, err := tx.Metadata().CreateBucketIfNotExists(
+					[]byte("heights"))
+				if err != nil {
+					return err
+				}
+				nested, err := bucket.CreateBucketIfNotExists(
+					block.Hash()[:1])
+				if err != nil {
+					return err
+				}
+				err = nested.Put(block.Hash()[:], block.Hash()[1:])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Update: unexpected error: %v", err)
+		}
+	}
+	ffldb.TstRunWithMaxBlockFileSize(db, 16*1024, func() {
+		storeBlocks(db, blocks[:100])
+		storeBlocks(db, blocks[100:200])
+	})
+
+	var backup bytes.Buffer
+	if err := db.Backup(&backup); err != nil {
+		t.Fatalf("Backup: unexpected error: %v", err)
+	}
+	data := backup.Bytes()
+
+	// Ensure invalid backups are rejected without leaving anything behind.
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	tests := []struct {
+		name    string
+		data    []byte
+		network wire.BitcoinNet
+	}{{
+		name:    "truncated",
+		data:    data[:len(data)-1],
+		network: blockDataNet,
+	}, {
+		name:    "corrupt",
+		data:    corrupt,
+		network: blockDataNet,
+	}, {
+		name:    "unsupported version",
+		data:    append([]byte{0x02, 0x00, 0x00, 0x00}, data[4:]...),
+		network: blockDataNet,
+	}, {
+		name:    "wrong network",
+		data:    data,
+		network: wire.TestNet3,
+	}}
+	for _, test := range tests {
+		_, err := database.Restore(dbType, bytes.NewReader(test.data),
+			restoredPath, test.network)
+		if err == nil {
+			t.Fatalf("%s: Restore: did not receive expected error",
+				test.name)
+		}
+		if _, err := os.Stat(restoredPath); !os.IsNotExist(err) {
+			t.Fatalf("%s: Restore: left behind %s", test.name,
+				restoredPath)
+		}
+	}
+
+	// Ensure a corrupt backup restored into an existing directory doesn't
+	// leave behind any metadata, including the temporary database it is
+	// restored into before the checksum is verified.
+	if err := os.MkdirAll(restoredPath, 0700); err != nil {
+		t.Fatalf("MkdirAll: unexpected error: %v", err)
+	}
+	_, err = database.Restore(dbType, bytes.NewReader(corrupt),
+		restoredPath, blockDataNet)
+	if !checkDbError(t, "Restore", err, database.ErrCorruption) {
+		return
+	}
+	metadata, err := filepath.Glob(filepath.Join(restoredPath, "metadata*"))
+	if err != nil {
+		t.Fatalf("Glob: unexpected error: %v", err)
+	}
+	if len(metadata) != 0 {
+		t.Fatalf("Restore: left behind %v", metadata)
+	}
+	if err := os.RemoveAll(restoredPath); err != nil {
+		t.Fatalf("RemoveAll: unexpected error: %v", err)
+	}
+
+	// Store more blocks after the backup to ensure they are not included
+	// in the restored database.
+	storeBlocks(db, blocks[200:])
+
+	// Restore the metadata in many small batches.
+	var restored database.DB
+	ffldb.TstRunWithRestoreBatchSize(1024, func() {
+		restored, err = database.Restore(dbType,
+			bytes.NewReader(data), restoredPath, blockDataNet)
+	})
+	if err != nil {
+		t.Fatalf("Restore: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(restoredPath)
+	defer restored.Close()
+
+	err = restored.View(func(tx database.Tx) error {
+		for _, block := range blocks[200:] {
+			hasBlock, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if hasBlock {
+				return fmt.Errorf("block %v stored after the "+
+					"backup was restored", block.Hash())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Store the remaining blocks in the restored database and ensure both
+	// databases are then identical.
+	storeBlocks(restored, blocks[200:])
+	checkSameContents(t, db, restored, dbPath, restoredPath, blocks)
+
+	// Ensure restoring over an existing database is rejected.
+	_, err = database.Restore(dbType, bytes.NewReader(data), restoredPath,
+		blockDataNet)
+	if !checkDbError(t, "Restore", err, database.ErrDbExists) {
+		return
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -39,14 +40,25 @@ const (
 	// write file, so there will typically be one more than this value open.
 	maxOpenFiles = 25
 
-	// maxBlockFileSize is the maximum size for each file used to store
-	// blocks.
+	// maxBlockFileSize is the default maximum size for each file used to
+	// store blocks.
 	//
 	// NOTE: The current code uses uint32 for all offsets, so this value
 	// must be less than 2^32 (4 GiB).  This is also why it's a typed
 	// constant.
 	maxBlockFileSize uint32 = 512 * 1024 * 1024 // 512 MiB
 
+	// minMaxBlockFileSize is the smallest maximum block file size a
+	// database may be opened with.  It ensures the largest allowed block
+	// along with the network, length, and checksum data stored with it
+	// always fits in a single file.
+	minMaxBlockFileSize uint32 = wire.MaxBlockPayload + 12
+
+	// maxMaxBlockFileSize is the largest maximum block file size a database
+	// may be opened with.  It ensures the offset just past any block
+	// written to a file is still representable by the uint32 offsets.
+	maxMaxBlockFileSize uint32 = math.MaxUint32 - minMaxBlockFileSize
+
 	// blockLocSize is the number of bytes the serialized block location
 	// data that is stored in the block index.
 	//
@@ -457,6 +469,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	}
 
 	// Bitcoin network.
+	origFileNum := wc.curFileNum
 	origOffset := wc.curOffset
 	hasher := crc32.New(castagnoli)
 	var scratch [4]byte
@@ -485,7 +498,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	}
 
 	loc := blockLocation{
-		blockFileNum: wc.curFileNum,
+		blockFileNum: origFileNum,
 		fileOffset:   origOffset,
 		blockLen:     fullLen,
 	}
@@ -712,6 +725,34 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// size returns the total size of the flat block files in bytes.
+//
+// This function is safe for concurrent access.
+func (s *blockStore) size() (int64, error) {
+	wc := s.writeCursor
+	wc.RLock()
+	lastFileNum := wc.curFileNum
+	wc.RUnlock()
+
+	var size int64
+	for fileNum := uint32(0); fileNum <= lastFileNum; fileNum++ {
+		st, err := os.Stat(blockFilePath(s.basePath, fileNum))
+		if os.IsNotExist(err) {
+			// The current file is not created until the first block
+			// is written to it.
+			continue
+		}
+		if err != nil {
+			str := fmt.Sprintf("failed to stat file %d: %v", fileNum,
+				err)
+			return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		size += st.Size()
+	}
+
+	return size, nil
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
@@ -738,7 +779,7 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 
 // newBlockStore returns a new block store with the current block file number
 // and offset set and all fields initialized.
-func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
+func newBlockStore(basePath string, network wire.BitcoinNet, maxFileSize uint32) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
@@ -751,7 +792,7 @@ func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
 	store := &blockStore{
 		network:          network,
 		basePath:         basePath,
-		maxBlockFileSize: maxBlockFileSize,
+		maxBlockFileSize: maxFileSize,
 		openBlockFiles:   make(map[uint32]*lockableFile),
 		openBlocksLRU:    list.New(),
 		fileNumToLRUElem: make(map[uint32]*list.Element),
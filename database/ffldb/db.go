@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
@@ -1745,6 +1746,20 @@ func (db *db) Type() string {
 	return dbType
 }
 
+// BlocksSize returns the total size, in bytes, of the flat files the blocks
+// are stored in.
+//
+// This function is safe for concurrent access.
+func (db *db) BlocksSize() (int64, error) {
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		return 0, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+
+	return db.store.size()
+}
+
 // begin is the implementation function for the Begin database method.  See its
 // documentation for more details.
 //
@@ -1980,9 +1995,11 @@ func initDB(ldb *leveldb.DB) error {
 	return nil
 }
 
-// openDB opens the database at the provided path.  database.ErrDbDoesNotExist
-// is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// openDB opens the database at the provided path with blocks stored in files
+// of at most the provided size and the provided options.
+// database.ErrDbDoesNotExist is returned if the database doesn't exist and the
+// create flag is not set.
+func openDB(dbPath string, network wire.BitcoinNet, maxFileSize uint32, create bool, options *Options) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2016,8 +2033,13 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// according to the data that is actually on disk.  Also create the
 	// database cache which wraps the underlying leveldb database to provide
 	// write caching.
-	store := newBlockStore(dbPath, network)
-	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
+	store := newBlockStore(dbPath, network, maxFileSize)
+	flushInterval := options.FlushInterval
+	if flushInterval == 0 {
+		flushInterval = time.Second * defaultFlushSecs
+	}
+	cache := newDbCache(ldb, store, defaultCacheSize, flushInterval,
+		options.SyncMode)
 	pdb := &db{store: store, cache: cache}
 
 	// Perform any reconciliation needed between the block and metadata as
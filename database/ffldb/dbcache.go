@@ -374,11 +374,15 @@ type dbCache struct {
 	// lastFlush is the time the cache was last flushed.  It is used in
 	// conjunction with the current time and the flush interval.
 	//
+	// syncMode specifies whether the cache is also flushed whenever a
+	// transaction which stores blocks is committed.
+	//
 	// NOTE: These flush related fields are protected by the database write
 	// lock.
 	maxSize       uint64
 	flushInterval time.Duration
 	lastFlush     time.Time
+	syncMode      SyncMode
 
 	// The following fields hold the keys that need to be stored or deleted
 	// from the underlying database once the cache is full, enough time has
@@ -526,11 +530,18 @@ func (c *dbCache) flush() error {
 // needsFlush returns whether or not the database cache needs to be flushed to
 // persistent storage based on its current size, whether or not adding all of
 // the entries in the passed database transaction would cause it to exceed the
-// configured limit, and how much time has elapsed since the last time the cache
-// was flushed.
+// configured limit, how much time has elapsed since the last time the cache
+// was flushed, and whether the transaction stores blocks which must be synced
+// to disk right away.
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) needsFlush(tx *transaction) bool {
+	// A flush is needed for every transaction which stores blocks when
+	// they are to be synced to disk as soon as they are stored.
+	if c.syncMode == SyncEveryBlock && len(tx.pendingBlockData) > 0 {
+		return true
+	}
+
 	// A flush is needed when more time has elapsed than the configured
 	// flush interval.
 	if time.Since(c.lastFlush) > c.flushInterval {
@@ -646,14 +657,16 @@ func (c *dbCache) Close() error {
 // newDbCache returns a new database cache instance backed by the provided
 // leveldb instance.  The cache will be flushed to leveldb when the max size
 // exceeds the provided value or it has been longer than the provided interval
-// since the last flush.
-func newDbCache(ldb *leveldb.DB, store *blockStore, maxSize uint64, flushIntervalSecs uint32) *dbCache {
+// since the last flush, as well as whenever blocks are stored for the
+// SyncEveryBlock sync mode.
+func newDbCache(ldb *leveldb.DB, store *blockStore, maxSize uint64, flushInterval time.Duration, syncMode SyncMode) *dbCache {
 	return &dbCache{
 		ldb:           ldb,
 		store:         store,
 		maxSize:       maxSize,
-		flushInterval: time.Second * time.Duration(flushIntervalSecs),
+		flushInterval: flushInterval,
 		lastFlush:     time.Now(),
+		syncMode:      syncMode,
 		cachedKeys:    treap.NewImmutable(),
 		cachedRemove:  treap.NewImmutable(),
 	}
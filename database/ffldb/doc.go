@@ -25,5 +25,34 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+They also take an optional third parameter which sets the maximum size of each
+flat file used to store blocks as a uint32.  It defaults to 512 MiB and must be
+large enough for a file to hold the largest allowed block along with the 12
+bytes stored with it, and small enough that the end of any block written to a
+file still fits in a 32-bit offset.  Changing it for an existing database only
+affects where new blocks are stored:
+
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet,
+		uint32(64*1024*1024))
+	if err != nil {
+		// Handle error
+	}
+
+The last parameter may also be an *Options which sets how long updates are
+cached in memory before they are written to disk and when the blocks and
+metadata are synced to disk.  By default, updates are cached for up to 5
+minutes, or until the cache is full or the database is closed, and synced to
+disk when they are written.  A crash or power failure loses the updates which
+were not written yet, although the database is always left consistent.  The
+SyncEveryBlock sync mode instead writes and syncs the updates of every
+transaction which stores blocks, so no stored block is lost, at the expense of
+a much lower throughput:
+
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet,
+		&ffldb.Options{SyncMode: ffldb.SyncEveryBlock})
+	if err != nil {
+		// Handle error
+	}
 */
 package ffldb
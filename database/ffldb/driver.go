@@ -6,6 +6,8 @@ package ffldb
 
 import (
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
@@ -18,49 +20,127 @@ const (
 	dbType = "ffldb"
 )
 
-// parseArgs parses the arguments from the database Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, error) {
-	if len(args) != 2 {
-		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
-			"expected database path and block network", dbType,
-			funcName)
+// SyncMode specifies when the blocks and metadata written to a database are
+// synced to disk.
+type SyncMode uint8
+
+const (
+	// SyncBatched syncs the blocks and metadata to disk when the database
+	// cache is flushed, which happens once the flush interval has passed,
+	// the cache is full, or the database is closed.  The updates since the
+	// last flush are lost on a crash or power failure, although the
+	// database is left consistent, so they have to be redone after
+	// restarting.
+	SyncBatched SyncMode = iota
+
+	// SyncEveryBlock syncs the blocks and metadata to disk whenever a
+	// transaction which stores blocks is committed, so no stored block is
+	// lost on a crash or power failure.  This greatly reduces the
+	// throughput of storing blocks, especially on slow disks.
+	SyncEveryBlock
+)
+
+// Options houses the optional settings of a database which are passed as the
+// last argument to the database Open/Create/Restore methods.
+type Options struct {
+	// FlushInterval is the maximum amount of time the database cache keeps
+	// updates in memory before flushing them to disk.  The default of 5
+	// minutes is used when it is zero.
+	FlushInterval time.Duration
+
+	// SyncMode specifies when the blocks and metadata are synced to disk.
+	SyncMode SyncMode
+}
+
+// parseArgs parses the arguments from the database Open/Create methods.  The
+// maximum block file size is optional and defaults to maxBlockFileSize.  The
+// options are optional as well and are always the last argument.
+func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, uint32, *Options, error) {
+	opts := &Options{}
+	if len(args) > 2 {
+		if o, ok := args[len(args)-1].(*Options); ok {
+			// A nil options argument means the defaults.
+			if o != nil {
+				opts = o
+			}
+			args = args[:len(args)-1]
+		}
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return "", 0, 0, nil, fmt.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path, block network, and optional "+
+			"max block file size and options", dbType, funcName)
+	}
+	if opts.FlushInterval < 0 || opts.SyncMode > SyncEveryBlock {
+		return "", 0, 0, nil, fmt.Errorf("options argument to %s.%s "+
+			"is invalid -- expected a non-negative flush interval "+
+			"and a known sync mode", dbType, funcName)
 	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
+		return "", 0, 0, nil, fmt.Errorf("first argument to %s.%s is invalid -- "+
 			"expected database path string", dbType, funcName)
 	}
 
 	network, ok := args[1].(wire.BitcoinNet)
 	if !ok {
-		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
+		return "", 0, 0, nil, fmt.Errorf("second argument to %s.%s is invalid -- "+
 			"expected block network", dbType, funcName)
 	}
 
-	return dbPath, network, nil
+	maxFileSize := maxBlockFileSize
+	if len(args) == 3 {
+		maxFileSize, ok = args[2].(uint32)
+		if !ok {
+			return "", 0, 0, nil, fmt.Errorf("third argument to %s.%s is "+
+				"invalid -- expected max block file size uint32",
+				dbType, funcName)
+		}
+		if maxFileSize < minMaxBlockFileSize ||
+			maxFileSize > maxMaxBlockFileSize {
+
+			return "", 0, 0, nil, fmt.Errorf("third argument to %s.%s is "+
+				"invalid -- max block file size %d is not in the "+
+				"range [%d, %d]", dbType, funcName, maxFileSize,
+				minMaxBlockFileSize, maxMaxBlockFileSize)
+		}
+	}
+
+	return dbPath, network, maxFileSize, opts, nil
 }
 
 // openDBDriver is the callback provided during driver registration that opens
 // an existing database for use.
 func openDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Open", args...)
+	dbPath, network, maxFileSize, opts, err := parseArgs("Open", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDB(dbPath, network, maxFileSize, false, opts)
 }
 
 // createDBDriver is the callback provided during driver registration that
 // creates, initializes, and opens a database for use.
 func createDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Create", args...)
+	dbPath, network, maxFileSize, opts, err := parseArgs("Create", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDB(dbPath, network, maxFileSize, true, opts)
+}
+
+// restoreDBDriver is the callback provided during driver registration that
+// creates and opens a database from a backup.
+func restoreDBDriver(r io.Reader, args ...interface{}) (database.DB, error) {
+	dbPath, network, maxFileSize, opts, err := parseArgs("Restore", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return restoreDB(r, dbPath, network, maxFileSize, opts)
 }
 
 // useLogger is the callback provided during driver registration that sets the
@@ -75,6 +155,7 @@ func init() {
 		DbType:    dbType,
 		Create:    createDBDriver,
 		Open:      openDBDriver,
+		Restore:   restoreDBDriver,
 		UseLogger: useLogger,
 	}
 	if err := database.RegisterDriver(driver); err != nil {
@@ -5,15 +5,20 @@
 package ffldb_test
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -36,8 +41,9 @@ func TestCreateOpenFail(t *testing.T) {
 	// Ensure that attempting to open a database with the wrong number of
 	// parameters returns the expected error.
 	wantErr := fmt.Errorf("invalid arguments to %s.Open -- expected "+
-		"database path and block network", dbType)
-	_, err = database.Open(dbType, 1, 2, 3)
+		"database path, block network, and optional max block file "+
+		"size and options", dbType)
+	_, err = database.Open(dbType, 1, 2, 3, 4)
 	if err.Error() != wantErr.Error() {
 		t.Errorf("Open: did not receive expected error - got %v, "+
 			"want %v", err, wantErr)
@@ -66,11 +72,34 @@ func TestCreateOpenFail(t *testing.T) {
 		return
 	}
 
+	// Ensure that attempting to open a database with an invalid type for
+	// the third parameter returns the expected error.
+	wantErr = fmt.Errorf("third argument to %s.Open is invalid -- "+
+		"expected max block file size uint32", dbType)
+	_, err = database.Open(dbType, "noexist", blockDataNet, 1024)
+	if err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with a max block file size
+	// outside of the allowed range returns the expected error.
+	for _, size := range []uint32{0, wire.MaxBlockPayload + 11, math.MaxUint32} {
+		_, err = database.Open(dbType, "noexist", blockDataNet, size)
+		if err == nil || !strings.Contains(err.Error(), "is not in the range") {
+			t.Errorf("Open: did not receive expected error for max "+
+				"block file size %d - got %v", size, err)
+			return
+		}
+	}
+
 	// Ensure that attempting to create a database with the wrong number of
 	// parameters returns the expected error.
 	wantErr = fmt.Errorf("invalid arguments to %s.Create -- expected "+
-		"database path and block network", dbType)
-	_, err = database.Create(dbType, 1, 2, 3)
+		"database path, block network, and optional max block file "+
+		"size and options", dbType)
+	_, err = database.Create(dbType, 1, 2, 3, 4)
 	if err.Error() != wantErr.Error() {
 		t.Errorf("Create: did not receive expected error - got %v, "+
 			"want %v", err, wantErr)
@@ -99,11 +128,62 @@ func TestCreateOpenFail(t *testing.T) {
 		return
 	}
 
+	// Ensure that attempting to create a database with an invalid type for
+	// the third parameter returns the expected error.
+	wantErr = fmt.Errorf("third argument to %s.Create is invalid -- "+
+		"expected max block file size uint32", dbType)
+	_, err = database.Create(dbType, "noexist", blockDataNet, 1024)
+	if err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to create a database with a max block file size
+	// outside of the allowed range returns the expected error.
+	for _, size := range []uint32{0, wire.MaxBlockPayload + 11, math.MaxUint32} {
+		_, err = database.Create(dbType, "noexist", blockDataNet, size)
+		if err == nil || !strings.Contains(err.Error(), "is not in the range") {
+			t.Errorf("Create: did not receive expected error for max "+
+				"block file size %d - got %v", size, err)
+			return
+		}
+	}
+
+	// Ensure that attempting to create a database with invalid options
+	// returns the expected error.
+	wantErr = fmt.Errorf("options argument to %s.Create is invalid -- "+
+		"expected a non-negative flush interval and a known sync mode",
+		dbType)
+	for _, opts := range []*ffldb.Options{
+		{FlushInterval: -time.Second},
+		{SyncMode: ffldb.SyncEveryBlock + 1},
+	} {
+		_, err = database.Create(dbType, "noexist", blockDataNet, opts)
+		if err == nil || err.Error() != wantErr.Error() {
+			t.Errorf("Create: did not receive expected error for "+
+				"options %+v - got %v, want %v", opts, err, wantErr)
+			return
+		}
+	}
+
+	// Ensure that a nil options argument means the default options.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-createniloptions")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet,
+		(*ffldb.Options)(nil))
+	if err != nil {
+		t.Errorf("Create: unexpected error with nil options: %v", err)
+		return
+	}
+	db.Close()
+	_ = os.RemoveAll(dbPath)
+
 	// Ensure operations against a closed database return the expected
 	// error.
-	dbPath := filepath.Join(os.TempDir(), "ffldb-createfail")
+	dbPath = filepath.Join(os.TempDir(), "ffldb-createfail")
 	_ = os.RemoveAll(dbPath)
-	db, err := database.Create(dbType, dbPath, blockDataNet)
+	db, err = database.Create(dbType, dbPath, blockDataNet)
 	if err != nil {
 		t.Errorf("Create: unexpected error: %v", err)
 		return
@@ -253,6 +333,133 @@ func TestPersistence(t *testing.T) {
 	}
 }
 
+// TestMaxBlockFileSize ensures blocks stored in a database created with a small
+// max block file size are spread over multiple block files and remain
+// retrievable, including after reopening the database with the default size.
+func TestMaxBlockFileSize(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database with the smallest allowed max block file size.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-maxblockfilesizetest")
+	_ = os.RemoveAll(dbPath)
+	maxFileSize := uint32(wire.MaxBlockPayload + 12)
+	db, err := database.Create(dbType, dbPath, blockDataNet, maxFileSize)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// makeBlock returns a distinct block which is somewhat larger than a
+	// third of the max block file size so only two fit in each file.
+	makeBlock := func(nonce uint32) *btcutil.Block {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+		pkScript := bytes.Repeat([]byte{byte(nonce)}, 1500000)
+		tx.AddTxOut(wire.NewTxOut(0, pkScript))
+		block := wire.NewMsgBlock(&wire.BlockHeader{Nonce: nonce})
+		block.AddTransaction(tx)
+		return btcutil.NewBlock(block)
+	}
+
+	// storeBlocks stores the passed blocks in the database in a single
+	// transaction.
+	storeBlocks := func(blocks []*btcutil.Block) {
+		t.Helper()
+		err := db.Update(func(tx database.Tx) error {
+			for _, block := range blocks {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: unexpected error: %v", err)
+		}
+	}
+
+	// checkBlocks ensures all of the passed blocks can be fetched from the
+	// database in full and in part and that the block files which are
+	// expected to hold them exist.
+	checkBlocks := func(blocks []*btcutil.Block, numFiles int) {
+		t.Helper()
+		err := db.View(func(tx database.Tx) error {
+			for i, block := range blocks {
+				blockBytes, _ := block.Bytes()
+				gotBytes, err := tx.FetchBlock(block.Hash())
+				if err != nil {
+					return fmt.Errorf("FetchBlock #%d: %v", i,
+						err)
+				}
+				if !bytes.Equal(gotBytes, blockBytes) {
+					return fmt.Errorf("FetchBlock #%d: stored "+
+						"block mismatch", i)
+				}
+
+				offset := uint32(len(blockBytes) - 100)
+				region := database.BlockRegion{
+					Hash:   block.Hash(),
+					Offset: offset,
+					Len:    100,
+				}
+				gotBytes, err = tx.FetchBlockRegion(&region)
+				if err != nil {
+					return fmt.Errorf("FetchBlockRegion #%d: %v",
+						i, err)
+				}
+				if !bytes.Equal(gotBytes, blockBytes[offset:]) {
+					return fmt.Errorf("FetchBlockRegion #%d: "+
+						"stored region mismatch", i)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("View: unexpected error: %v", err)
+		}
+
+		for fileNum := 0; fileNum <= numFiles; fileNum++ {
+			name := filepath.Join(dbPath, fmt.Sprintf("%09d.fdb",
+				fileNum))
+			_, err := os.Stat(name)
+			if fileNum < numFiles && err != nil {
+				t.Fatalf("block file %d does not exist: %v",
+					fileNum, err)
+			}
+			if fileNum == numFiles && !os.IsNotExist(err) {
+				t.Fatalf("block file %d unexpectedly exists",
+					fileNum)
+			}
+		}
+	}
+
+	// Store enough blocks to roll over into a third block file, both in a
+	// single transaction and across transactions.
+	var blocks []*btcutil.Block
+	for nonce := uint32(0); nonce < 5; nonce++ {
+		blocks = append(blocks, makeBlock(nonce))
+	}
+	storeBlocks(blocks[:3])
+	storeBlocks(blocks[3:])
+	checkBlocks(blocks, 3)
+
+	// Close and reopen the database with the default max block file size
+	// to ensure the blocks are still retrievable and new blocks continue
+	// to be appended to the latest block file.
+	db.Close()
+	db, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to open test database (%s) %v", dbType, err)
+	}
+	defer db.Close()
+	checkBlocks(blocks, 3)
+
+	blocks = append(blocks, makeBlock(5), makeBlock(6))
+	storeBlocks(blocks[5:])
+	checkBlocks(blocks, 3)
+}
+
 // TestInterface performs all interfaces tests for this database driver.
 func TestInterface(t *testing.T) {
 	t.Parallel()
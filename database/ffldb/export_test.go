@@ -24,3 +24,14 @@ func TstRunWithMaxBlockFileSize(idb database.DB, size uint32, fn func()) {
 	fn()
 	ffldb.store.maxBlockFileSize = origSize
 }
+
+// TstRunWithRestoreBatchSize runs the passed function with the maximum size of
+// the batches of metadata written while restoring a backup set to the provided
+// value.  The value will be set back to the original value upon completion.
+func TstRunWithRestoreBatchSize(size int, fn func()) {
+	origSize := restoreBatchSize
+
+	restoreBatchSize = size
+	fn()
+	restoreBatchSize = origSize
+}
@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/database"
@@ -179,7 +180,7 @@ func TestCornerCases(t *testing.T) {
 	// directory is needed.
 	testName := "openDB: fail due to file at target location"
 	wantErrCode := database.ErrDriverSpecific
-	idb, err := openDB(dbPath, blockDataNet, true)
+	idb, err := openDB(dbPath, blockDataNet, maxBlockFileSize, true, &Options{})
 	if !checkDbError(t, testName, err, wantErrCode) {
 		if err == nil {
 			idb.Close()
@@ -191,7 +192,7 @@ func TestCornerCases(t *testing.T) {
 	// Remove the file and create the database to run tests against.  It
 	// should be successful this time.
 	_ = os.RemoveAll(dbPath)
-	idb, err = openDB(dbPath, blockDataNet, true)
+	idb, err = openDB(dbPath, blockDataNet, maxBlockFileSize, true, &Options{})
 	if err != nil {
 		t.Errorf("openDB: unexpected error: %v", err)
 		return
@@ -704,3 +705,103 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// syncCountingFile is a filer which counts the number of times the block file
+// it wraps is synced to disk.
+type syncCountingFile struct {
+	filer
+	syncs *int
+}
+
+// Sync counts the sync and syncs the wrapped file.
+func (f *syncCountingFile) Sync() error {
+	*f.syncs++
+	return f.filer.Sync()
+}
+
+// TestSyncMode ensures the block files are synced to disk for every
+// transaction which stores blocks with the SyncEveryBlock sync mode, only when
+// the cache is flushed with the SyncBatched sync mode, and that the blocks are
+// retrievable after closing the database either way.
+func TestSyncMode(t *testing.T) {
+	t.Parallel()
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+	blocks = blocks[:10]
+
+	tests := []struct {
+		name      string
+		syncMode  SyncMode
+		wantSyncs int
+	}{
+		{name: "batched", syncMode: SyncBatched, wantSyncs: 0},
+		{name: "every block", syncMode: SyncEveryBlock, wantSyncs: 10},
+	}
+	for _, test := range tests {
+		dbPath := filepath.Join(os.TempDir(), "ffldb-syncmodetest")
+		_ = os.RemoveAll(dbPath)
+		idb, err := openDB(dbPath, blockDataNet, maxBlockFileSize, true,
+			&Options{FlushInterval: time.Hour, SyncMode: test.syncMode})
+		if err != nil {
+			t.Fatalf("%s: openDB: unexpected error: %v", test.name, err)
+		}
+
+		// Count the syncs of the block files.
+		var syncs int
+		store := idb.(*db).store
+		openWriteFile := store.openWriteFileFunc
+		store.openWriteFileFunc = func(fileNum uint32) (filer, error) {
+			file, err := openWriteFile(fileNum)
+			if err != nil {
+				return nil, err
+			}
+			return &syncCountingFile{filer: file, syncs: &syncs}, nil
+		}
+
+		// Store the blocks in a transaction each.
+		for _, block := range blocks {
+			err := idb.Update(func(tx database.Tx) error {
+				return tx.StoreBlock(block)
+			})
+			if err != nil {
+				idb.Close()
+				os.RemoveAll(dbPath)
+				t.Fatalf("%s: StoreBlock: unexpected error: %v",
+					test.name, err)
+			}
+		}
+		if syncs != test.wantSyncs {
+			idb.Close()
+			os.RemoveAll(dbPath)
+			t.Fatalf("%s: unexpected number of syncs - got %d, want %d",
+				test.name, syncs, test.wantSyncs)
+		}
+
+		// The blocks are retrievable after closing and reopening the
+		// database.
+		idb.Close()
+		idb, err = openDB(dbPath, blockDataNet, maxBlockFileSize, false,
+			&Options{})
+		if err != nil {
+			os.RemoveAll(dbPath)
+			t.Fatalf("%s: openDB: unexpected error: %v", test.name, err)
+		}
+		err = idb.View(func(tx database.Tx) error {
+			for i, block := range blocks {
+				if _, err := tx.FetchBlock(block.Hash()); err != nil {
+					return fmt.Errorf("FetchBlock #%d: %v", i,
+						err)
+				}
+			}
+			return nil
+		})
+		idb.Close()
+		os.RemoveAll(dbPath)
+		if err != nil {
+			t.Fatalf("%s: View: unexpected error: %v", test.name, err)
+		}
+	}
+}
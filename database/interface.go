@@ -8,6 +8,8 @@
 package database
 
 import (
+	"io"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcutil"
 )
@@ -459,6 +461,14 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// Backup writes a consistent snapshot of all metadata and blocks in the
+	// database to the passed writer.  The snapshot is taken under a
+	// read-only transaction, so the database remains usable while the
+	// backup is written and nothing committed after it started is
+	// included.  The backup can be restored into a new database with
+	// Restore.
+	Backup(w io.Writer) error
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
@@ -27,6 +27,13 @@ Application Options:
       --addrindex             Maintain a full address-based transaction index
                               which makes the searchrawtransactions RPC
                               available
+      --allowgenerate         Allow the generate and generatetoaddress RPCs on
+                              networks other than regtest and simnet -- NOTE:
+                              It is unlikely to be possible to mine a block with
+                              the CPU on them
+      --assumevalid=          Skip the script checks of the specified block and
+                              its ancestors provided it is part of a chain with
+                              at least as much work as the best chain
       --banduration=          How long to ban misbehaving peers.  Valid time
                               units are {s, m, h}.  Minimum 1 second (default:
                               24h0m0s)
@@ -40,16 +47,47 @@ Application Options:
                               block (default: 3000000)
       --blockminweight=       Mininum block weight to be used when creating a
                               block
+      --blockmintxfee=        The minimum transaction fee in BTC/kB for a
+                              transaction to be included when creating a block
       --blockprioritysize=    Size in bytes for high-priority/low-fee
                               transactions when creating a block (default:
                               50000)
+      --blockrelayonlypeers=  Number of automatic outbound connections in
+                              addition to targetoutbound which only relay
+                              blocks and never relay transactions or addresses
       --blocksonly            Do not accept transactions from remote peers.
+      --cfclient              Fetch the committed filters (CF) from peers which
+                              serve them rather than building them from the
+                              blocks
+      --coinbaseflags=        Data such as a message to include in the coinbase
+                              signature script of created blocks (default:
+                              /P2SH/btcd/)
+      --coinbasenoncesize=    Number of bytes the extra nonce takes in the
+                              coinbase signature script of created blocks to
+                              keep the coinbase flags at a fixed offset -- 0
+                              adds it as a minimally encoded number
+      --coinstatsindex        Maintain an index of statistics about the unspent
+                              transaction output set as of each block which
+                              makes the gettxoutsetinfo RPC return immediately
   -C, --configfile=           Path to configuration file
       --connect=              Connect only to the specified peers at startup
       --cpuprofile=           Write CPU profile to the specified file
+      --datacarrieroutputs=   Max number of null data (OP_RETURN) outputs a
+                              transaction may have to be relayed (default: 1)
+      --datacarriersize=      Max number of bytes of data a null data
+                              (OP_RETURN) output may carry to be relayed
+                              (default: 80)
   -b, --datadir=              Directory to store data
       --dbtype=               Database backend to use for the Block Chain
                               (default: ffldb)
+      --dbflushinterval=      Maximum amount of time the database keeps updates
+                              in memory before writing them to disk (default:
+                              5m0s)
+      --dbsyncmode=           When to sync the blocks and metadata written to
+                              the database to disk {batched, everyblock} --
+                              everyblock loses no blocks on a crash or power
+                              failure but greatly reduces the throughput of
+                              syncing the chain (default: batched)
   -d, --debuglevel=           Logging level for all subsystems {trace, debug,
                               info, warn, error, critical} -- You may also
                               specify
@@ -62,10 +100,22 @@ Application Options:
       --dropcfindex           Deletes the index used for committed filtering
                               (CF) support from the database on start up and
                               then exits.
+      --dropcoinstatsindex    Deletes the coin stats index from the database on
+                              start up and then exits.
+      --dropspentindex        Deletes the spent transaction output index from
+                              the database on start up and then exits.
       --droptxindex           Deletes the hash-based transaction index from the
                               database on start up and then exits.
+      --dustrelayfee=         The fee rate in BTC/kB used to determine whether
+                              transaction outputs are dust -- Outputs which
+                              cost more than a third of their value to spend
+                              at this fee rate are not relayed (default:
+                              1e-05)
       --externalip=           Add an ip to the list of local addresses we claim
                               to listen on to peers
+      --externalonion=        Add the onion address of a tor hidden service
+                              forwarding to this node to the list of local
+                              addresses we claim to listen on to peers
       --generate              Generate (mine) bitcoins using the CPU
       --limitfreerelay=       Limit relay of transactions with no transaction
                               fee to the given amount in thousands of bytes per
@@ -74,20 +124,40 @@ Application Options:
                               (default all interfaces port: 8333, testnet:
                               18333)
       --logdir=               Directory to log output
+      --logformat=            Format of log output {text, json} (default: text)
+      --maxfilteraddrate=     Max number of filteradd messages a peer may send
+                              per minute before it is disconnected and its ban
+                              score is increased (default: 100)
+      --maxfilterloadsize=    Max size in bytes of the bloom filters peers may
+                              load (default: 36000)
+      --maxorphanblocks=      Max number of orphan blocks to keep in memory
+                              (default: 100)
+      --maxorphanblocksize=   Max total size in MiB of the orphan blocks to keep
+                              in memory (default: 128)
       --maxorphantx=          Max number of orphan transactions to keep in
                               memory (default: 100)
       --maxpeers=             Max number of inbound and outbound peers
                               (default: 125)
+      --minchainwork=         The minimum cumulative work in hex the best chain
+                              must have before the node considers itself synced
+      --minercpufraction=     Limit the built-in CPU miner to the given fraction
+                              of the processor cores (greater than 0 up to 1)
+                              (default: 1)
       --miningaddr=           Add the specified payment address to the list of
                               addresses to use for generated blocks -- At least
                               one address is required if the generate option is
                               set
       --minrelaytxfee=        The minimum transaction fee in BTC/kB to be
                               considered a non-zero fee. (default: 1e-05)
+      --natpmp                Use NAT-PMP to map our listening port outside of
+                              NAT when UPnP is disabled or unavailable
       --nobanning             Disable banning of misbehaving peers
       --nocfilters            Disable committed filtering (CF) support
       --nocheckpoints         Disable built-in checkpoints.  Don't do this
                               unless you know what you're doing.
+      --nodefaultcheckpoints  Disable built-in checkpoints while keeping the
+                              ones added with --addcheckpoint.  Don't do this
+                              unless you know what you're doing.
       --nodnsseed             Disable DNS seeding for peers
       --nolisten              Disable listening for incoming connections --
                               NOTE: Listening is automatically disabled if the
@@ -95,6 +165,8 @@ Application Options:
                               also specifying listen interfaces via --listen
       --noonion               Disable connecting to tor hidden services
       --nopeerbloomfilters    Disable bloom filtering support
+      --nopersistmempool      Do not save the memory pool to disk and restore it
+                              on startup
       --norelaypriority       Do not require free or low-fee transactions to
                               have high priority for relaying
       --norpc                 Disable built-in RPC server -- NOTE: The RPC
@@ -108,17 +180,27 @@ Application Options:
                               (eg. 127.0.0.1:9050)
       --onionpass=            Password for onion proxy server
       --onionuser=            Username for onion proxy server
+      --onlynet=              Only make outbound connections to the given
+                              network (ipv4, ipv6, or onion) -- may be
+                              specified multiple times
+      --orphanblockexpiry=    How long to keep orphan blocks in memory before
+                              they expire.  Valid time units are {s, m, h}.
+                              Minimum 1 second (default: 1h0m0s)
       --profile=              Enable HTTP profiling on given port -- NOTE port
                               must be between 1024 and 65536
       --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
       --proxypass=            Password for proxy server
       --proxyuser=            Username for proxy server
       --regtest               Use the regression test network
+      --reindex               Drops all enabled optional indexes on start up and
+                              rebuilds them from the chain data
       --rejectnonstd          Reject non-standard transactions regardless of
                               the default settings for the active network.
       --relaynonstd           Relay non-standard transactions regardless of the
                               default settings for the active network.
       --rpccert=              File containing the certificate file
+      --rpcgzip               Compress responses to HTTP POST RPC requests with
+                              gzip for clients which accept it
       --rpckey=               File containing the certificate key
       --rpclimitpass=         Password for limited RPC connections
       --rpclimituser=         Username for limited RPC connections
@@ -130,15 +212,37 @@ Application Options:
                               processed concurrently (default: 20)
       --rpcmaxwebsockets=     Max number of RPC websocket connections (default:
                               25)
+      --rpcunixsocket=        Path of a Unix domain socket to listen on for RPC
+                              connections in addition to the TCP listeners --
+                              NOTE: TLS is not used on the socket, so access
+                              should be restricted via filesystem permissions
       --rpcquirks             Mirror some JSON-RPC quirks of Bitcoin Core --
                               NOTE: Discouraged unless interoperability issues
                               need to be worked around
+      --rpcwhitelist=         Restrict an RPC user to the listed methods.
+                              Format: '<user>:<method>,<method>,...'
   -P, --rpcpass=              Password for RPC connections
   -u, --rpcuser=              Username for RPC connections
       --sigcachemaxsize=      The maximum number of entries in the signature
                               verification cache (default: 100000)
       --simnet                Use the simulation test network
+      --spentindex            Maintain an index of the transaction input that
+                              spent each transaction output which makes the
+                              getspentinfo RPC available
+      --syncstalltimeout=     How long the sync peer may go without delivering
+                              blocks before another sync peer is selected.
+                              Valid time units are {s, m, h}.  Minimum 1 second
+                              (default: 3m0s)
+      --targetoutbound=       Number of automatic outbound connections which
+                              relay blocks, transactions, and addresses
+                              (default: 8)
       --testnet               Use the test network
+      --testnet4              Use the test network (version 4)
+      --testscriptflags=      Enforce additional script verification flags,
+                              such as NULLDUMMY, CLEANSTACK, or WITNESS, from a
+                              block height on regtest and simnet to test
+                              soft-fork activation.  Format:
+                              '<height>:<flag>,<flag>,...'
       --torisolation          Enable Tor stream isolation by randomizing user
                               credentials for each connection.
       --trickleinterval=      Minimum time between attempts to send new
@@ -149,9 +253,25 @@ Application Options:
       --uacomment=            Comment to add to the user agent -- See BIP 14
                               for more information.
       --upnp                  Use UPnP to map our listening port outside of NAT
+      --utxocachemaxsize=     The maximum size in MiB of the UTXO cache which
+                              keeps recent changes to the UTXO set in memory
+                              before writing them to the database (0 to
+                              disable) (default: 250)
   -V, --version               Display version information and exit
       --whitelist=            Add an IP network or IP that will not be banned.
                               (eg. 192.168.1.0/24 or ::1)
+      --zmqpubhashblock=      Publish the hashes of connected blocks on the
+                              ZeroMQ endpoint (eg. tcp://127.0.0.1:28332)
+      --zmqpubhashtx=         Publish the hashes of accepted and block
+                              transactions on the ZeroMQ endpoint
+      --zmqpubrawblock=       Publish the serialized connected blocks on the
+                              ZeroMQ endpoint
+      --zmqpubrawtx=          Publish the serialized accepted and block
+                              transactions on the ZeroMQ endpoint
+      --zmqpubsequence=       Publish the ordered log of connected and
+                              disconnected blocks and of transactions added to
+                              and removed from the mempool on the ZeroMQ
+                              endpoint
 
 Help Options:
   -h, --help           Show this help message
@@ -6,13 +6,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/cfclient"
 	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/mempool"
@@ -21,19 +26,113 @@ import (
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/zmqpub"
 
 	"github.com/btcsuite/btclog"
 	"github.com/jrick/logrotate/rotator"
 )
 
 // logWriter implements an io.Writer that outputs to both standard output and
-// the write-end pipe of an initialized log rotator.
+// the write-end pipe of an initialized log rotator.  Only standard output is
+// written to when logging before the log rotator is initialized, such as in
+// tests.
 type logWriter struct{}
 
 func (logWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if logJSON {
+		p = jsonLogLine(p)
+	}
 	os.Stdout.Write(p)
-	logRotator.Write(p)
-	return len(p), nil
+	if logRotator != nil {
+		logRotator.Write(p)
+	}
+	return n, nil
+}
+
+// logJSON specifies whether log lines are written as JSON objects instead of
+// text.  It is set when the configuration is loaded before anything is logged.
+var logJSON bool
+
+// jsonLogEntry models a log line written as a JSON object.
+type jsonLogEntry struct {
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Subsystem string            `json:"subsystem"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// logFields returns the words of the passed message of the form key=value as
+// fields.  Keys consist of letters, digits, and underscores, and punctuation
+// separating the words is not part of the values.  The logging backend only
+// writes formatted messages, so these are the only structured fields of a log
+// line.
+func logFields(message string) map[string]string {
+	fields := make(map[string]string)
+	for _, word := range strings.Fields(message) {
+		sep := strings.IndexByte(word, '=')
+		if sep <= 0 {
+			continue
+		}
+		key := word[:sep]
+		valid := true
+		for _, r := range key {
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			fields[key] = strings.TrimRight(word[sep+1:], ",;")
+		}
+	}
+	return fields
+}
+
+// logLevelNames maps the levels in the header of log lines to the names the
+// levels are specified with in the configuration.
+var logLevelNames = map[string]string{
+	"TRC": "trace",
+	"DBG": "debug",
+	"INF": "info",
+	"WRN": "warn",
+	"ERR": "error",
+	"CRT": "critical",
+}
+
+// jsonLogLine converts the passed log line written by the logging backend to a
+// JSON object on a single line.  Log lines start with a header of the form
+// "2006-01-02 15:04:05.000 [LVL] SUBS: " followed by the message, which may
+// span multiple lines.  Lines without a header are converted to an entry with
+// the line as message.  The words of the message of the form key=value are
+// also written as fields.
+func jsonLogLine(p []byte) []byte {
+	const timeFormat = "2006-01-02 15:04:05.000"
+
+	var entry jsonLogEntry
+	line := strings.TrimSuffix(string(p), "\n")
+	entry.Message = line
+	if len(line) > len(timeFormat)+7 && line[len(timeFormat)] == ' ' {
+		t, err := time.ParseInLocation(timeFormat,
+			line[:len(timeFormat)], time.Local)
+		rest := line[len(timeFormat)+1:]
+		sep := strings.Index(rest, ": ")
+		level, ok := logLevelNames[rest[1:4]]
+		if err == nil && ok && rest[0] == '[' && rest[4:6] == "] " &&
+			sep > 6 {
+
+			entry.Timestamp = t.Format("2006-01-02T15:04:05.000Z07:00")
+			entry.Level = level
+			entry.Subsystem = rest[6:sep]
+			entry.Message = rest[sep+2:]
+		}
+	}
+	entry.Fields = logFields(entry.Message)
+
+	// Marshalling the entry can't fail since it only contains strings.
+	b, _ := json.Marshal(&entry)
+	return append(b, '\n')
 }
 
 // Loggers per subsystem.  A single backend logger is created and all subsytem
@@ -69,6 +168,7 @@ var (
 	srvrLog = backendLog.Logger("SRVR")
 	syncLog = backendLog.Logger("SYNC")
 	txmpLog = backendLog.Logger("TXMP")
+	zmqpLog = backendLog.Logger("ZMQP")
 )
 
 // Initialize package-global logger variables.
@@ -83,7 +183,9 @@ func init() {
 	peer.UseLogger(peerLog)
 	txscript.UseLogger(scrpLog)
 	netsync.UseLogger(syncLog)
+	cfclient.UseLogger(syncLog)
 	mempool.UseLogger(txmpLog)
+	zmqpub.UseLogger(zmqpLog)
 }
 
 // subsystemLoggers maps each subsystem identifier to its associated logger.
@@ -103,6 +205,7 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"SRVR": srvrLog,
 	"SYNC": syncLog,
 	"TXMP": txmpLog,
+	"ZMQP": zmqpLog,
 }
 
 // initLogRotator initializes the logging rotater to write logs to logFile and
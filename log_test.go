@@ -0,0 +1,109 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// testLogWriter records each write of a logging backend as a log line.
+type testLogWriter struct {
+	lines [][]byte
+}
+
+func (w *testLogWriter) Write(p []byte) (int, error) {
+	w.lines = append(w.lines, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// TestJSONLogLine ensures the log lines written by the logging backend are
+// converted to JSON objects with their timestamp, level, subsystem, message,
+// and the fields of the message.
+func TestJSONLogLine(t *testing.T) {
+	var w testLogWriter
+	logger := btclog.NewBackend(&w).Logger("TEST")
+	logger.SetLevel(btclog.LevelTrace)
+	start := time.Now().Truncate(time.Millisecond)
+	logger.Tracef("trace %d", 1)
+	logger.Infof("info: with a colon")
+	logger.Warn("multiple\nlines")
+	logger.Criticalf("critical")
+	logger.Debugf("peer=%s height=%d, x+y=1 =2 msg=", "1.2.3.4:8333", 100)
+	end := time.Now()
+
+	tests := []struct {
+		level   string
+		message string
+		fields  map[string]string
+	}{
+		{level: "trace", message: "trace 1"},
+		{level: "info", message: "info: with a colon"},
+		{level: "warn", message: "multiple\nlines"},
+		{level: "critical", message: "critical"},
+		{
+			level:   "debug",
+			message: "peer=1.2.3.4:8333 height=100, x+y=1 =2 msg=",
+			fields: map[string]string{
+				"peer":   "1.2.3.4:8333",
+				"height": "100",
+				"msg":    "",
+			},
+		},
+	}
+	if len(w.lines) != len(tests) {
+		t.Fatalf("unexpected number of log lines - got %d, want %d",
+			len(w.lines), len(tests))
+	}
+	for i, test := range tests {
+		line := jsonLogLine(w.lines[i])
+		if line[len(line)-1] != '\n' {
+			t.Fatalf("%s: log line %q does not end with a newline",
+				test.level, line)
+		}
+		var entry jsonLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("%s: unable to parse log line %q: %v", test.level,
+				line, err)
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			t.Fatalf("%s: unable to parse timestamp %q: %v", test.level,
+				entry.Timestamp, err)
+		}
+		if timestamp.Before(start) || timestamp.After(end) {
+			t.Fatalf("%s: unexpected timestamp %v", test.level, timestamp)
+		}
+		want := jsonLogEntry{
+			Timestamp: entry.Timestamp,
+			Level:     test.level,
+			Subsystem: "TEST",
+			Message:   test.message,
+			Fields:    test.fields,
+		}
+		if want.Fields == nil {
+			want.Fields = make(map[string]string)
+		}
+		if !reflect.DeepEqual(entry, want) {
+			t.Fatalf("%s: unexpected log entry - got %+v, want %+v",
+				test.level, entry, want)
+		}
+	}
+
+	// Lines which weren't written by the logging backend are kept as the
+	// message.
+	var entry jsonLogEntry
+	if err := json.Unmarshal(jsonLogLine([]byte("panic: test\n")), &entry); err != nil {
+		t.Fatalf("unable to parse log line: %v", err)
+	}
+	want := jsonLogEntry{Message: "panic: test", Fields: map[string]string{}}
+	if !reflect.DeepEqual(entry, want) {
+		t.Fatalf("unexpected log entry - got %+v, want %+v", entry, want)
+	}
+}
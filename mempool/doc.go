@@ -63,6 +63,8 @@ be an exhaustive list.
    - The starting priority for the transaction
  - Manual control of transaction removal
    - Recursive removal of all dependent transactions
+ - Saving and restoring the pool across restarts
+   - Restored transactions are validated against the current chain
 
 Errors
 
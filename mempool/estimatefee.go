@@ -11,7 +11,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"math/rand"
 	"sort"
 	"strings"
 	"sync"
@@ -21,20 +20,63 @@ import (
 	"github.com/btcsuite/btcutil"
 )
 
-// TODO incorporate Alex Morcos' modifications to Gavin's initial model
-// https://lists.linuxfoundation.org/pipermail/bitcoin-dev/2014-October/006824.html
+// The fee estimator follows the model used by Bitcoin Core.  Transactions are
+// tracked from the time they are observed in the memory pool until they are
+// mined, grouped into exponentially spaced buckets by their fee rate.  Each
+// bucket records how many of its transactions were confirmed within each number
+// of blocks along with how many were never confirmed at all, and all of these
+// statistics decay by a constant factor on every block so that old observations
+// gradually age out in favor of recent ones.  The fee rate estimated for a
+// number of blocks is then based on the lowest fee rate buckets in which a large
+// enough share of the transactions were confirmed in time.  Conservative
+// estimates are additionally based on statistics which decay more slowly and
+// thereby cover a longer history, and require an even greater share of the
+// transactions to have been confirmed in time.
 
 const (
 	// estimateFeeDepth is the maximum number of blocks before a transaction
 	// is confirmed that we want to track.
 	estimateFeeDepth = 25
 
-	// estimateFeeBinSize is the number of txs stored in each bin.
-	estimateFeeBinSize = 100
-
-	// estimateFeeMaxReplacements is the max number of replacements that
-	// can be made by the txs found in a given block.
-	estimateFeeMaxReplacements = 10
+	// estimateFeeMinBucketFeeRate is the fee rate, in satoshis per byte, of
+	// the lowest fee rate bucket.  Transactions paying less are tracked in
+	// that bucket as well.
+	estimateFeeMinBucketFeeRate = 1
+
+	// estimateFeeMaxBucketFeeRate is the fee rate, in satoshis per byte,
+	// above which all transactions are tracked in the highest fee rate
+	// bucket.
+	estimateFeeMaxBucketFeeRate = 1e4
+
+	// estimateFeeBucketSpacing is the ratio between the fee rates of
+	// adjacent fee rate buckets.
+	estimateFeeBucketSpacing = 1.1
+
+	// estimateFeeDecay is the factor the statistics of the fee estimator are
+	// multiplied by on every block.  It gives observations a half-life of
+	// about 346 blocks.
+	estimateFeeDecay = 0.998
+
+	// estimateFeeLongDecay is the factor the statistics which conservative
+	// estimates are based on are multiplied by on every block.  It gives
+	// observations a half-life of about 1386 blocks.
+	estimateFeeLongDecay = 0.9995
+
+	// estimateFeeSuccessPct is the minimum share of the transactions in a
+	// range of fee rate buckets which must have been confirmed within the
+	// requested number of blocks for an estimate to be based on the range.
+	estimateFeeSuccessPct = 0.85
+
+	// estimateFeeConservativeSuccessPct is the minimum share of the
+	// transactions in a range of fee rate buckets of the statistics covering
+	// a longer history which must have been confirmed within the requested
+	// number of blocks for a conservative estimate to be based on the range.
+	estimateFeeConservativeSuccessPct = 0.95
+
+	// estimateFeeSufficientTxs is the average number of transactions per
+	// block which must have been confirmed in a range of fee rate buckets
+	// for an estimate to be based on the range.
+	estimateFeeSufficientTxs = 1
 
 	// DefaultEstimateFeeMaxRollback is the default number of rollbacks
 	// allowed by the fee estimator for orphaned blocks.
@@ -54,8 +96,26 @@ var (
 	// EstimateFeeDatabaseKey is the key that we use to
 	// store the fee estimator in the database.
 	EstimateFeeDatabaseKey = []byte("estimatefee")
+
+	// feeRateBuckets houses the upper bound, in satoshis per byte, of the
+	// fee rate of the transactions tracked in each fee rate bucket.  The
+	// highest bucket has no upper bound.
+	feeRateBuckets = func() []float64 {
+		var buckets []float64
+		rate := float64(estimateFeeMinBucketFeeRate)
+		for ; rate < estimateFeeMaxBucketFeeRate; rate *= estimateFeeBucketSpacing {
+			buckets = append(buckets, rate)
+		}
+		return append(buckets, estimateFeeMaxBucketFeeRate, math.Inf(1))
+	}()
 )
 
+// feeRateBucket returns the index of the fee rate bucket transactions paying
+// the passed fee rate are tracked in.
+func feeRateBucket(feeRate SatoshiPerByte) int {
+	return sort.SearchFloat64s(feeRateBuckets, float64(feeRate))
+}
+
 // SatoshiPerByte is number with units of satoshis per byte.
 type SatoshiPerByte float64
 
@@ -117,46 +177,185 @@ func (o *observedTransaction) Serialize(w io.Writer) {
 func deserializeObservedTransaction(r io.Reader) (*observedTransaction, error) {
 	ot := observedTransaction{}
 
-	// The first 32 bytes should be a hash.
-	binary.Read(r, binary.BigEndian, &ot.hash)
+	// The first 32 bytes should be a hash, the next 8 are SatoshiPerByte
+	// and next there are two uint32's.
+	fields := []interface{}{&ot.hash, &ot.feeRate, &ot.observed, &ot.mined}
+	for _, field := range fields {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
 
-	// The next 8 are SatoshiPerByte
-	binary.Read(r, binary.BigEndian, &ot.feeRate)
+	return &ot, nil
+}
 
-	// And next there are two uint32's.
-	binary.Read(r, binary.BigEndian, &ot.observed)
-	binary.Read(r, binary.BigEndian, &ot.mined)
+// serializeObservedTransactions writes the number of passed transactions
+// followed by each of them.
+func serializeObservedTransactions(w io.Writer, txs []*observedTransaction) {
+	binary.Write(w, binary.BigEndian, uint32(len(txs)))
+	for _, o := range txs {
+		o.Serialize(w)
+	}
+}
 
-	return &ot, nil
+// deserializeObservedTransactions reads transactions written by
+// serializeObservedTransactions.
+func deserializeObservedTransactions(r io.Reader) ([]*observedTransaction, error) {
+	var numTransactions uint32
+	if err := binary.Read(r, binary.BigEndian, &numTransactions); err != nil {
+		return nil, err
+	}
+
+	var txs []*observedTransaction
+	for i := uint32(0); i < numTransactions; i++ {
+		ot, err := deserializeObservedTransaction(r)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, ot)
+	}
+
+	return txs, nil
 }
 
-// registeredBlock has the hash of a block and the list of transactions
-// it mined which had been previously observed by the FeeEstimator. It
-// is used if Rollback is called to reverse the effect of registering
-// a block.
+// feeRateStats houses the decayed statistics of each fee rate bucket.
+type feeRateStats struct {
+	// The number of transactions which were confirmed and the sum of their
+	// fee rates.
+	confirmed  []float64
+	feeRateSum []float64
+
+	// The number of transactions which were confirmed within each number
+	// of blocks.
+	confirmedWithin [estimateFeeDepth][]float64
+
+	// The number of transactions which were not confirmed within
+	// estimateFeeDepth blocks.
+	failed []float64
+}
+
+// newFeeRateStats returns statistics for each fee rate bucket with no data.
+func newFeeRateStats() *feeRateStats {
+	stats := &feeRateStats{
+		confirmed:  make([]float64, len(feeRateBuckets)),
+		feeRateSum: make([]float64, len(feeRateBuckets)),
+		failed:     make([]float64, len(feeRateBuckets)),
+	}
+	for i := range stats.confirmedWithin {
+		stats.confirmedWithin[i] = make([]float64, len(feeRateBuckets))
+	}
+	return stats
+}
+
+// all returns all of the statistics.
+func (s *feeRateStats) all() [][]float64 {
+	all := [][]float64{s.confirmed, s.feeRateSum, s.failed}
+	return append(all, s.confirmedWithin[:]...)
+}
+
+// clone returns a copy of the statistics.
+func (s *feeRateStats) clone() *feeRateStats {
+	clone := newFeeRateStats()
+	dst := clone.all()
+	for i, src := range s.all() {
+		copy(dst[i], src)
+	}
+	return clone
+}
+
+// scale multiplies all of the statistics by the passed factor.
+func (s *feeRateStats) scale(factor float64) {
+	for _, stats := range s.all() {
+		for i := range stats {
+			stats[i] *= factor
+		}
+	}
+}
+
+func (s *feeRateStats) serialize(w io.Writer) {
+	for _, stats := range s.all() {
+		binary.Write(w, binary.BigEndian, stats)
+	}
+}
+
+func deserializeFeeRateStats(r io.Reader) (*feeRateStats, error) {
+	s := newFeeRateStats()
+	for _, stats := range s.all() {
+		if err := binary.Read(r, binary.BigEndian, stats); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// registeredBlock has the hash of a block along with the observed transactions
+// it mined, those which were no longer tracked after it since they had not been
+// mined in time and the statistics from before it. It is used if Rollback is
+// called to reverse the effect of registering a block.
 type registeredBlock struct {
-	hash         chainhash.Hash
-	transactions []*observedTransaction
+	hash      chainhash.Hash
+	confirmed []*observedTransaction
+	expired   []*observedTransaction
+	stats     *feeRateStats
+	longStats *feeRateStats
 }
 
-func (rb *registeredBlock) serialize(w io.Writer, txs map[*observedTransaction]uint32) {
+func (rb *registeredBlock) serialize(w io.Writer) {
 	binary.Write(w, binary.BigEndian, rb.hash)
+	serializeObservedTransactions(w, rb.confirmed)
+	serializeObservedTransactions(w, rb.expired)
+	rb.stats.serialize(w)
+	rb.longStats.serialize(w)
+}
 
-	binary.Write(w, binary.BigEndian, uint32(len(rb.transactions)))
-	for _, o := range rb.transactions {
-		binary.Write(w, binary.BigEndian, txs[o])
+func deserializeRegisteredBlock(r io.Reader) (*registeredBlock, error) {
+	rb := &registeredBlock{}
+	err := binary.Read(r, binary.BigEndian, &rb.hash)
+	if err != nil {
+		return nil, err
+	}
+	rb.confirmed, err = deserializeObservedTransactions(r)
+	if err != nil {
+		return nil, err
 	}
+	rb.expired, err = deserializeObservedTransactions(r)
+	if err != nil {
+		return nil, err
+	}
+	rb.stats, err = deserializeFeeRateStats(r)
+	if err != nil {
+		return nil, err
+	}
+	rb.longStats, err = deserializeFeeRateStats(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return rb, nil
 }
 
 // FeeEstimator manages the data necessary to create
 // fee estimations. It is safe for concurrent access.
 type FeeEstimator struct {
 	maxRollback uint32
-	binSize     int32
 
-	// The maximum number of replacements that can be made in a single
-	// bin per block. Default is estimateFeeMaxReplacements
-	maxReplacements int32
+	// The factors the statistics are multiplied by on every block.
+	// Defaults are estimateFeeDecay and estimateFeeLongDecay.
+	decay     float64
+	longDecay float64
+
+	// The minimum share of transactions which must have been confirmed in
+	// time in a range of fee rate buckets. Defaults are
+	// estimateFeeSuccessPct and estimateFeeConservativeSuccessPct.
+	successPct             float64
+	conservativeSuccessPct float64
+
+	// The minimum decayed number of transactions which must have been
+	// confirmed in a range of fee rate buckets.  Default is
+	// estimateFeeSufficientTxs / (1 - estimateFeeDecay).  The statistics
+	// covering a longer history require the same average number of
+	// transactions per block.
+	sufficientTxs float64
 
 	// The minimum number of blocks that can be registered with the fee
 	// estimator before it will provide answers.
@@ -168,15 +367,23 @@ type FeeEstimator struct {
 	// The number of blocks that have been registered.
 	numBlocksRegistered uint32
 
-	mtx      sync.RWMutex
+	mtx sync.RWMutex
+
+	// The transactions which have been observed in the mempool and are
+	// still waiting to be mined.
 	observed map[chainhash.Hash]*observedTransaction
-	bin      [estimateFeeDepth][]*observedTransaction
+
+	// The decayed statistics of each fee rate bucket and those covering a
+	// longer history.
+	stats     *feeRateStats
+	longStats *feeRateStats
 
 	// The cached estimates.
-	cached []SatoshiPerByte
+	cached             []SatoshiPerByte
+	cachedConservative []SatoshiPerByte
 
-	// Transactions that have been removed from the bins. This allows us to
-	// revert in case of an orphaned block.
+	// The transactions that recently registered blocks have been recorded
+	// for. This allows us to revert in case of an orphaned block.
 	dropped []*registeredBlock
 }
 
@@ -185,13 +392,18 @@ type FeeEstimator struct {
 // have been registered with it.
 func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
 	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		minRegisteredBlocks: minRegisteredBlocks,
-		lastKnownHeight:     mining.UnminedHeight,
-		binSize:             estimateFeeBinSize,
-		maxReplacements:     estimateFeeMaxReplacements,
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
+		maxRollback:            maxRollback,
+		decay:                  estimateFeeDecay,
+		longDecay:              estimateFeeLongDecay,
+		successPct:             estimateFeeSuccessPct,
+		conservativeSuccessPct: estimateFeeConservativeSuccessPct,
+		sufficientTxs:          estimateFeeSufficientTxs / (1 - estimateFeeDecay),
+		minRegisteredBlocks:    minRegisteredBlocks,
+		lastKnownHeight:        mining.UnminedHeight,
+		observed:               make(map[chainhash.Hash]*observedTransaction),
+		stats:                  newFeeRateStats(),
+		longStats:              newFeeRateStats(),
+		dropped:                make([]*registeredBlock, 0, maxRollback),
 	}
 }
 
@@ -219,108 +431,113 @@ func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 	}
 }
 
+// record adds the passed transaction to the statistics of its fee rate bucket
+// as either confirmed in the block it was mined in or, when it has not been
+// mined, as failed.
+func (s *feeRateStats) record(o *observedTransaction) {
+	bucket := feeRateBucket(o.feeRate)
+	if o.mined == mining.UnminedHeight {
+		s.failed[bucket]++
+		return
+	}
+
+	s.confirmed[bucket]++
+	s.feeRateSum[bucket] += float64(o.feeRate)
+	for i := o.mined - o.observed - 1; i < estimateFeeDepth; i++ {
+		s.confirmedWithin[i][bucket]++
+	}
+}
+
 // RegisterBlock informs the fee estimator of a new block to take into account.
 func (ef *FeeEstimator) RegisterBlock(block *btcutil.Block) error {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// The previous sorted list is invalid, so delete it.
+	// The previous estimates are invalid, so delete them.
 	ef.cached = nil
+	ef.cachedConservative = nil
 
 	height := block.Height()
-	if height != ef.lastKnownHeight+1 && ef.lastKnownHeight != mining.UnminedHeight {
-		return fmt.Errorf("intermediate block not recorded; current height is %d; new height is %d",
+	if height <= ef.lastKnownHeight && ef.lastKnownHeight != mining.UnminedHeight {
+		return fmt.Errorf("block already recorded; current height is %d; new height is %d",
 			ef.lastKnownHeight, height)
 	}
 
+	// Blocks might have been missed, for instance when the fee estimator
+	// was saved before the last blocks were processed on shutdown.  The
+	// statistics age by the missed blocks as well, but the transactions
+	// which might have been mined in them are no longer tracked since it is
+	// unknown whether they were.  The blocks registered before can't be
+	// rolled back anymore and neither can this one.
+	blocks := 1
+	missed := ef.lastKnownHeight != mining.UnminedHeight &&
+		height != ef.lastKnownHeight+1
+	if missed {
+		blocks = int(height - ef.lastKnownHeight)
+		for hash, o := range ef.observed {
+			if o.observed < height-1 {
+				delete(ef.observed, hash)
+			}
+		}
+		ef.dropped = ef.dropped[:0]
+	}
+
+	// Keep track of the recorded txs in case of an orphan block.
+	registered := &registeredBlock{
+		hash:      *block.Hash(),
+		stats:     ef.stats.clone(),
+		longStats: ef.longStats.clone(),
+	}
+	ef.stats.scale(math.Pow(ef.decay, float64(blocks)))
+	ef.longStats.scale(math.Pow(ef.longDecay, float64(blocks)))
+
 	// Update the last known height.
 	ef.lastKnownHeight = height
 	ef.numBlocksRegistered++
 
-	// Randomly order txs in block.
-	transactions := make(map[*btcutil.Tx]struct{})
+	// Go through the txs in the block and record those which have been
+	// observed in the mempool as confirmed.
 	for _, t := range block.Transactions() {
-		transactions[t] = struct{}{}
-	}
-
-	// Count the number of replacements we make per bin so that we don't
-	// replace too many.
-	var replacementCounts [estimateFeeDepth]int
-
-	// Keep track of which txs were dropped in case of an orphan block.
-	dropped := &registeredBlock{
-		hash:         *block.Hash(),
-		transactions: make([]*observedTransaction, 0, 100),
-	}
-
-	// Go through the txs in the block.
-	for t := range transactions {
 		hash := *t.Hash()
-
-		// Have we observed this tx in the mempool?
 		o, ok := ef.observed[hash]
 		if !ok {
 			continue
 		}
-
-		// Put the observed tx in the oppropriate bin.
-		blocksToConfirm := height - o.observed - 1
-
-		// This shouldn't happen if the fee estimator works correctly,
-		// but return an error if it does.
-		if o.mined != mining.UnminedHeight {
-			log.Error("Estimate fee: transaction ", hash.String(), " has already been mined")
-			return errors.New("Transaction has already been mined")
-		}
+		delete(ef.observed, hash)
 
 		// This shouldn't happen but check just in case to avoid
 		// an out-of-bounds array index later.
-		if blocksToConfirm >= estimateFeeDepth {
-			continue
-		}
-
-		// Make sure we do not replace too many transactions per min.
-		if replacementCounts[blocksToConfirm] == int(ef.maxReplacements) {
+		blocksToConfirm := height - o.observed
+		if blocksToConfirm < 1 || blocksToConfirm > estimateFeeDepth {
 			continue
 		}
 
 		o.mined = height
-
-		replacementCounts[blocksToConfirm]++
-
-		bin := ef.bin[blocksToConfirm]
-
-		// Remove a random element and replace it with this new tx.
-		if len(bin) == int(ef.binSize) {
-			// Don't drop transactions we have just added from this same block.
-			l := int(ef.binSize) - replacementCounts[blocksToConfirm]
-			drop := rand.Intn(l)
-			dropped.transactions = append(dropped.transactions, bin[drop])
-
-			bin[drop] = bin[l-1]
-			bin[l-1] = o
-		} else {
-			bin = append(bin, o)
-		}
-		ef.bin[blocksToConfirm] = bin
+		ef.stats.record(o)
+		ef.longStats.record(o)
+		registered.confirmed = append(registered.confirmed, o)
 	}
 
-	// Go through the mempool for txs that have been in too long.
+	// Go through the mempool for txs that have been in too long and record
+	// them as failed.
 	for hash, o := range ef.observed {
-		if o.mined == mining.UnminedHeight && height-o.observed >= estimateFeeDepth {
+		if height-o.observed >= estimateFeeDepth {
 			delete(ef.observed, hash)
+			ef.stats.record(o)
+			ef.longStats.record(o)
+			registered.expired = append(registered.expired, o)
 		}
 	}
 
-	// Add dropped list to history.
-	if ef.maxRollback == 0 {
+	// Add the recorded txs to history.
+	if ef.maxRollback == 0 || missed {
 		return nil
 	}
 
 	if uint32(len(ef.dropped)) == ef.maxRollback {
-		ef.dropped = append(ef.dropped[1:], dropped)
+		ef.dropped = append(ef.dropped[1:], registered)
 	} else {
-		ef.dropped = append(ef.dropped, dropped)
+		ef.dropped = append(ef.dropped, registered)
 	}
 
 	return nil
@@ -339,10 +556,8 @@ func (ef *FeeEstimator) LastKnownHeight() int32 {
 // estimator. The maximum number of rollbacks allowed is given by
 // maxRollbacks.
 //
-// Note: not everything can be rolled back because some transactions are
-// deleted if they have been observed too long ago. That means the result
-// of Rollback won't always be exactly the same as if the last block had not
-// happened, but it should be close enough.
+// Note: blocks registered before or right after blocks were missed can't be
+// rolled back.
 func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
@@ -369,81 +584,31 @@ func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
 // rollback rolls back the effect of the last block in the stack
 // of registered blocks.
 func (ef *FeeEstimator) rollback() {
-	// The previous sorted list is invalid, so delete it.
+	// The previous estimates are invalid, so delete them.
 	ef.cached = nil
+	ef.cachedConservative = nil
 
-	// pop the last list of dropped txs from the stack.
+	// pop the last registered block from the stack.
 	last := len(ef.dropped) - 1
 	if last == -1 {
 		// Cannot really happen because the exported calling function
 		// only rolls back a block already known to be in the list
-		// of dropped transactions.
+		// of registered blocks.
 		return
 	}
 
-	dropped := ef.dropped[last]
-
-	// where we are in each bin as we replace txs?
-	var replacementCounters [estimateFeeDepth]int
-
-	// Go through the txs in the dropped block.
-	for _, o := range dropped.transactions {
-		// Which bin was this tx in?
-		blocksToConfirm := o.mined - o.observed - 1
-
-		bin := ef.bin[blocksToConfirm]
-
-		var counter = replacementCounters[blocksToConfirm]
-
-		// Continue to go through that bin where we left off.
-		for {
-			if counter >= len(bin) {
-				// Panic, as we have entered an unrecoverable invalid state.
-				panic(errors.New("illegal state: cannot rollback dropped transaction"))
-			}
-
-			prev := bin[counter]
-
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
-
-				bin[counter] = o
-
-				counter++
-				break
-			}
-
-			counter++
-		}
+	registered := ef.dropped[last]
 
-		replacementCounters[blocksToConfirm] = counter
+	// Restore the statistics from before the block and track the txs
+	// recorded for it as waiting in the mempool again.
+	ef.stats = registered.stats
+	ef.longStats = registered.longStats
+	for _, o := range registered.confirmed {
+		o.mined = mining.UnminedHeight
+		ef.observed[o.hash] = o
 	}
-
-	// Continue going through bins to find other txs to remove
-	// which did not replace any other when they were entered.
-	for i, j := range replacementCounters {
-		for {
-			l := len(ef.bin[i])
-			if j >= l {
-				break
-			}
-
-			prev := ef.bin[i][j]
-
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
-
-				newBin := append(ef.bin[i][0:j], ef.bin[i][j+1:l]...)
-				// TODO This line should prevent an unintentional memory
-				// leak but it causes a panic when it is uncommented.
-				// ef.bin[i][j] = nil
-				ef.bin[i] = newBin
-
-				continue
-			}
-
-			j++
-		}
+	for _, o := range registered.expired {
+		ef.observed[o.hash] = o
 	}
 
 	ef.dropped = ef.dropped[0:last]
@@ -453,99 +618,116 @@ func (ef *FeeEstimator) rollback() {
 	ef.lastKnownHeight--
 }
 
-// estimateFeeSet is a set of txs that can that is sorted
-// by the fee per kb rate.
-type estimateFeeSet struct {
-	feeRate []SatoshiPerByte
-	bin     [estimateFeeDepth]uint32
-}
-
-func (b *estimateFeeSet) Len() int { return len(b.feeRate) }
-
-func (b *estimateFeeSet) Less(i, j int) bool {
-	return b.feeRate[i] > b.feeRate[j]
-}
-
-func (b *estimateFeeSet) Swap(i, j int) {
-	b.feeRate[i], b.feeRate[j] = b.feeRate[j], b.feeRate[i]
-}
-
-// estimateFee returns the estimated fee for a transaction
-// to confirm in confirmations blocks from now, given
-// the data set we have collected.
-func (b *estimateFeeSet) estimateFee(confirmations int) SatoshiPerByte {
-	if confirmations <= 0 {
-		return SatoshiPerByte(math.Inf(1))
-	}
-
-	if confirmations > estimateFeeDepth {
-		return 0
-	}
-
-	// We don't have any transactions!
-	if len(b.feeRate) == 0 {
-		return 0
-	}
+// estimateFee returns the estimated fee rate for a transaction to be confirmed
+// within the passed number of blocks according to the passed statistics, or -1
+// when there is not enough data.  The passed waiting statistics hold the number
+// of transactions in each fee rate bucket which are still in the mempool after
+// having waited at least that number of blocks.
+//
+// The fee rate buckets are scanned from the highest fee rate down while adding
+// up their transactions until the range of scanned buckets holds enough
+// confirmed transactions to judge.  The range passes when a large enough share
+// of its transactions, including those which failed to be confirmed and those
+// still waiting, were confirmed within the number of blocks, and a new range
+// is started with the next bucket.  The estimate is the average fee rate of the
+// bucket holding the median confirmed transaction of the last passing range.
+func estimateFee(stats *feeRateStats, sufficientTxs, successPct float64,
+	confirmations int, waiting []float64) SatoshiPerByte {
+
+	confirmedWithin := stats.confirmedWithin[confirmations-1]
+
+	var inTime, confirmed, failed, unconfirmed float64
+	high, bestHigh, bestLow := len(feeRateBuckets)-1, -1, -1
+	for bucket := len(feeRateBuckets) - 1; bucket >= 0; bucket-- {
+		inTime += confirmedWithin[bucket]
+		confirmed += stats.confirmed[bucket]
+		failed += stats.failed[bucket]
+		unconfirmed += waiting[bucket]
+
+		if confirmed < sufficientTxs {
+			continue
+		}
+		if inTime/(confirmed+failed+unconfirmed) < successPct {
+			continue
+		}
 
-	var min, max int = 0, 0
-	for i := 0; i < confirmations-1; i++ {
-		min += int(b.bin[i])
+		bestHigh, bestLow = high, bucket
+		high = bucket - 1
+		inTime, confirmed, failed, unconfirmed = 0, 0, 0, 0
 	}
 
-	max = min + int(b.bin[confirmations-1]) - 1
-	if max < min {
-		max = min
-	}
-	feeIndex := (min + max) / 2
-	if feeIndex >= len(b.feeRate) {
-		feeIndex = len(b.feeRate) - 1
+	// No range of fee rate buckets passed.
+	if bestHigh == -1 {
+		return -1
 	}
 
-	return b.feeRate[feeIndex]
-}
-
-// newEstimateFeeSet creates a temporary data structure that
-// can be used to find all fee estimates.
-func (ef *FeeEstimator) newEstimateFeeSet() *estimateFeeSet {
-	set := &estimateFeeSet{}
-
-	capacity := 0
-	for i, b := range ef.bin {
-		l := len(b)
-		set.bin[i] = uint32(l)
-		capacity += l
+	var total float64
+	for bucket := bestLow; bucket <= bestHigh; bucket++ {
+		total += stats.confirmed[bucket]
 	}
 
-	set.feeRate = make([]SatoshiPerByte, capacity)
-
-	i := 0
-	for _, b := range ef.bin {
-		for _, o := range b {
-			set.feeRate[i] = o.feeRate
-			i++
+	var count float64
+	for bucket := bestLow; bucket <= bestHigh; bucket++ {
+		count += stats.confirmed[bucket]
+		if count >= total/2 && stats.confirmed[bucket] > 0 {
+			return SatoshiPerByte(stats.feeRateSum[bucket] / stats.confirmed[bucket])
 		}
 	}
 
-	sort.Sort(set)
-
-	return set
+	return -1
 }
 
 // estimates returns the set of all fee estimates from 1 to estimateFeeDepth
-// confirmations from now.
-func (ef *FeeEstimator) estimates() []SatoshiPerByte {
-	set := ef.newEstimateFeeSet()
+// confirmations from now.  Conservative estimates are the greater of the
+// regular estimate and the one based on the statistics covering a longer
+// history.
+func (ef *FeeEstimator) estimates(conservative bool) []SatoshiPerByte {
+	// Count the txs which are still in the mempool by the number of blocks
+	// they have waited and how much they pay.
+	var waiting [estimateFeeDepth][]float64
+	for i := range waiting {
+		waiting[i] = make([]float64, len(feeRateBuckets))
+	}
+	for _, o := range ef.observed {
+		blocksWaited := ef.lastKnownHeight - o.observed
+		if blocksWaited <= 0 {
+			continue
+		}
+		if blocksWaited > estimateFeeDepth {
+			blocksWaited = estimateFeeDepth
+		}
+		waiting[blocksWaited-1][feeRateBucket(o.feeRate)]++
+	}
 
+	// Each estimate takes the txs into account which have waited at least
+	// as many blocks.
+	longSufficientTxs := ef.sufficientTxs * (1 - ef.decay) / (1 - ef.longDecay)
 	estimates := make([]SatoshiPerByte, estimateFeeDepth)
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i] = set.estimateFee(i + 1)
+	for i := estimateFeeDepth - 1; i >= 0; i-- {
+		if i < estimateFeeDepth-1 {
+			for bucket, n := range waiting[i+1] {
+				waiting[i][bucket] += n
+			}
+		}
+		estimates[i] = estimateFee(ef.stats, ef.sufficientTxs,
+			ef.successPct, i+1, waiting[i])
+		if !conservative {
+			continue
+		}
+
+		long := estimateFee(ef.longStats, longSufficientTxs,
+			ef.conservativeSuccessPct, i+1, waiting[i])
+		if long > estimates[i] {
+			estimates[i] = long
+		}
 	}
 
 	return estimates
 }
 
 // EstimateFee estimates the fee per byte to have a tx confirmed a given
-// number of blocks from now.
+// number of blocks from now.  It returns -1 when there is not enough data to
+// provide an estimate.
 func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
@@ -563,41 +745,75 @@ func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 	if numBlocks > estimateFeeDepth {
 		return -1, fmt.Errorf(
 			"can only estimate fees for up to %d blocks from now",
-			estimateFeeBinSize)
+			estimateFeeDepth)
 	}
 
 	// If there are no cached results, generate them.
 	if ef.cached == nil {
-		ef.cached = ef.estimates()
+		ef.cached = ef.estimates(false)
 	}
 
 	return ef.cached[int(numBlocks)-1].ToBtcPerKb(), nil
 }
 
-// In case the format for the serialized version of the FeeEstimator changes,
-// we use a version number. If the version number changes, it does not make
-// sense to try to upgrade a previous version to a new version. Instead, just
-// start fee estimation over.
-const estimateFeeSaveVersion = 1
+// EstimateSmartFee estimates the fee per kilobyte to have a tx confirmed
+// within a given number of blocks from now.  Unlike EstimateFee, when there is
+// not enough data to provide an estimate for that number of blocks, the
+// estimate for the lowest greater number of blocks for which there is enough
+// is returned instead.  The number of blocks the estimate is for is returned
+// along with it, or -1 and 0 when no estimate can be provided at all.  Numbers
+// of blocks greater than estimateFeeDepth are treated as estimateFeeDepth.
+//
+// Conservative estimates additionally take a longer history into account and
+// require a greater share of the txs to have been confirmed in time, which
+// biases them toward higher fees than economical ones.
+func (ef *FeeEstimator) EstimateSmartFee(numBlocks uint32, conservative bool) (BtcPerKilobyte, uint32, error) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-func deserializeRegisteredBlock(r io.Reader, txs map[uint32]*observedTransaction) (*registeredBlock, error) {
-	var lenTransactions uint32
+	// If the number of registered blocks is below the minimum, return
+	// an error.
+	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
+		return -1, 0, errors.New("not enough blocks have been observed")
+	}
 
-	rb := &registeredBlock{}
-	binary.Read(r, binary.BigEndian, &rb.hash)
-	binary.Read(r, binary.BigEndian, &lenTransactions)
+	if numBlocks == 0 {
+		return -1, 0, errors.New("cannot confirm transaction in zero blocks")
+	}
+
+	if numBlocks > estimateFeeDepth {
+		numBlocks = estimateFeeDepth
+	}
 
-	rb.transactions = make([]*observedTransaction, lenTransactions)
+	// If there are no cached results, generate them.
+	estimates := ef.cached
+	if conservative {
+		estimates = ef.cachedConservative
+	}
+	if estimates == nil {
+		estimates = ef.estimates(conservative)
+		if conservative {
+			ef.cachedConservative = estimates
+		} else {
+			ef.cached = estimates
+		}
+	}
 
-	for i := uint32(0); i < lenTransactions; i++ {
-		var index uint32
-		binary.Read(r, binary.BigEndian, &index)
-		rb.transactions[i] = txs[index]
+	for i := numBlocks; i <= estimateFeeDepth; i++ {
+		if estimate := estimates[i-1]; estimate != -1 {
+			return estimate.ToBtcPerKb(), i, nil
+		}
 	}
 
-	return rb, nil
+	return -1, 0, nil
 }
 
+// In case the format for the serialized version of the FeeEstimator changes,
+// we use a version number. If the version number changes, it does not make
+// sense to try to upgrade a previous version to a new version. Instead, just
+// start fee estimation over.
+const estimateFeeSaveVersion = 3
+
 // FeeEstimatorState represents a saved FeeEstimator that can be
 // restored with data from an earlier session of the program.
 type FeeEstimatorState []byte
@@ -630,45 +846,32 @@ func (ef *FeeEstimator) Save() FeeEstimatorState {
 
 	// Insert basic parameters.
 	binary.Write(w, binary.BigEndian, &ef.maxRollback)
-	binary.Write(w, binary.BigEndian, &ef.binSize)
-	binary.Write(w, binary.BigEndian, &ef.maxReplacements)
+	binary.Write(w, binary.BigEndian, &ef.decay)
+	binary.Write(w, binary.BigEndian, &ef.longDecay)
+	binary.Write(w, binary.BigEndian, &ef.successPct)
+	binary.Write(w, binary.BigEndian, &ef.conservativeSuccessPct)
+	binary.Write(w, binary.BigEndian, &ef.sufficientTxs)
 	binary.Write(w, binary.BigEndian, &ef.minRegisteredBlocks)
 	binary.Write(w, binary.BigEndian, &ef.lastKnownHeight)
 	binary.Write(w, binary.BigEndian, &ef.numBlocksRegistered)
 
+	// Save the statistics of the fee rate buckets.
+	binary.Write(w, binary.BigEndian, uint32(len(feeRateBuckets)))
+	ef.stats.serialize(w)
+	ef.longStats.serialize(w)
+
 	// Put all the observed transactions in a sorted list.
-	var txCount uint32
-	ots := make([]*observedTransaction, len(ef.observed))
-	for hash := range ef.observed {
-		ots[txCount] = ef.observed[hash]
-		txCount++
+	ots := make([]*observedTransaction, 0, len(ef.observed))
+	for _, ot := range ef.observed {
+		ots = append(ots, ot)
 	}
-
 	sort.Sort(observedTxSet(ots))
+	serializeObservedTransactions(w, ots)
 
-	txCount = 0
-	observed := make(map[*observedTransaction]uint32)
-	binary.Write(w, binary.BigEndian, uint32(len(ef.observed)))
-	for _, ot := range ots {
-		ot.Serialize(w)
-		observed[ot] = txCount
-		txCount++
-	}
-
-	// Save all the right bins.
-	for _, list := range ef.bin {
-
-		binary.Write(w, binary.BigEndian, uint32(len(list)))
-
-		for _, o := range list {
-			binary.Write(w, binary.BigEndian, observed[o])
-		}
-	}
-
-	// Dropped transactions.
+	// Recently registered blocks.
 	binary.Write(w, binary.BigEndian, uint32(len(ef.dropped)))
 	for _, registered := range ef.dropped {
-		registered.serialize(w, observed)
+		registered.serialize(w)
 	}
 
 	// Commit the tx and return.
@@ -690,56 +893,60 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 		return nil, fmt.Errorf("Incorrect version: expected %d found %d", estimateFeeSaveVersion, version)
 	}
 
-	ef := &FeeEstimator{
-		observed: make(map[chainhash.Hash]*observedTransaction),
-	}
+	ef := NewFeeEstimator(0, 0)
 
 	// Read basic parameters.
-	binary.Read(r, binary.BigEndian, &ef.maxRollback)
-	binary.Read(r, binary.BigEndian, &ef.binSize)
-	binary.Read(r, binary.BigEndian, &ef.maxReplacements)
-	binary.Read(r, binary.BigEndian, &ef.minRegisteredBlocks)
-	binary.Read(r, binary.BigEndian, &ef.lastKnownHeight)
-	binary.Read(r, binary.BigEndian, &ef.numBlocksRegistered)
-
-	// Read transactions.
-	var numObserved uint32
-	observed := make(map[uint32]*observedTransaction)
-	binary.Read(r, binary.BigEndian, &numObserved)
-	for i := uint32(0); i < numObserved; i++ {
-		ot, err := deserializeObservedTransaction(r)
-		if err != nil {
+	var numBuckets uint32
+	fields := []interface{}{&ef.maxRollback, &ef.decay, &ef.longDecay,
+		&ef.successPct, &ef.conservativeSuccessPct, &ef.sufficientTxs,
+		&ef.minRegisteredBlocks, &ef.lastKnownHeight,
+		&ef.numBlocksRegistered, &numBuckets}
+	for _, field := range fields {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
 			return nil, err
 		}
-		observed[i] = ot
-		ef.observed[ot.hash] = ot
+	}
+	for _, decay := range []float64{ef.decay, ef.longDecay} {
+		if decay <= 0 || decay >= 1 {
+			return nil, fmt.Errorf("Invalid decay %v", decay)
+		}
+	}
+	if numBuckets != uint32(len(feeRateBuckets)) {
+		return nil, fmt.Errorf("Incorrect number of fee rate buckets: "+
+			"expected %d found %d", len(feeRateBuckets), numBuckets)
 	}
 
-	// Read bins.
-	for i := 0; i < estimateFeeDepth; i++ {
-		var numTransactions uint32
-		binary.Read(r, binary.BigEndian, &numTransactions)
-		bin := make([]*observedTransaction, numTransactions)
-		for j := uint32(0); j < numTransactions; j++ {
-			var index uint32
-			binary.Read(r, binary.BigEndian, &index)
+	// Read the statistics of the fee rate buckets.
+	ef.stats, err = deserializeFeeRateStats(r)
+	if err != nil {
+		return nil, err
+	}
+	ef.longStats, err = deserializeFeeRateStats(r)
+	if err != nil {
+		return nil, err
+	}
 
-			var exists bool
-			bin[j], exists = observed[index]
-			if !exists {
-				return nil, fmt.Errorf("Invalid transaction reference %d", index)
-			}
-		}
-		ef.bin[i] = bin
+	// Read transactions.
+	ots, err := deserializeObservedTransactions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, ot := range ots {
+		ef.observed[ot.hash] = ot
 	}
 
-	// Read dropped transactions.
+	// Read recently registered blocks.
 	var numDropped uint32
-	binary.Read(r, binary.BigEndian, &numDropped)
-	ef.dropped = make([]*registeredBlock, numDropped)
+	if err := binary.Read(r, binary.BigEndian, &numDropped); err != nil {
+		return nil, err
+	}
+	if numDropped > ef.maxRollback {
+		return nil, fmt.Errorf("Too many registered blocks: max %d found %d",
+			ef.maxRollback, numDropped)
+	}
+	ef.dropped = make([]*registeredBlock, numDropped, ef.maxRollback)
 	for i := uint32(0); i < numDropped; i++ {
-		var err error
-		ef.dropped[int(i)], err = deserializeRegisteredBlock(r, observed)
+		ef.dropped[int(i)], err = deserializeRegisteredBlock(r)
 		if err != nil {
 			return nil, err
 		}
@@ -6,6 +6,7 @@ package mempool
 
 import (
 	"bytes"
+	"math"
 	"math/rand"
 	"testing"
 
@@ -17,16 +18,11 @@ import (
 
 // newTestFeeEstimator creates a feeEstimator with some different parameters
 // for testing purposes.
-func newTestFeeEstimator(binSize, maxReplacements, maxRollback uint32) *FeeEstimator {
-	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		lastKnownHeight:     0,
-		binSize:             int32(binSize),
-		minRegisteredBlocks: 0,
-		maxReplacements:     int32(maxReplacements),
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
-	}
+func newTestFeeEstimator(sufficientTxs float64, maxRollback uint32) *FeeEstimator {
+	ef := NewFeeEstimator(maxRollback, 0)
+	ef.sufficientTxs = sufficientTxs
+	ef.lastKnownHeight = 0
+	return ef
 }
 
 // lastBlock is a linked list of the block hashes which have been
@@ -60,6 +56,27 @@ func (eft *estimateFeeTester) testTx(fee btcutil.Amount) *TxDesc {
 	}
 }
 
+// observe creates the passed number of txs paying the passed fee and has the
+// FeeEstimator observe them.
+func (eft *estimateFeeTester) observe(n int, fee btcutil.Amount) []*TxDesc {
+	txs := make([]*TxDesc, 0, n)
+	for i := 0; i < n; i++ {
+		tx := eft.testTx(fee)
+		eft.ef.ObserveTransaction(tx)
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// msgTxs returns the transactions of the passed descriptors.
+func msgTxs(txs []*TxDesc) []*wire.MsgTx {
+	msgTxs := make([]*wire.MsgTx, 0, len(txs))
+	for _, tx := range txs {
+		msgTxs = append(msgTxs, tx.Tx.MsgTx())
+	}
+	return msgTxs
+}
+
 func expectedFeePerKilobyte(t *TxDesc) BtcPerKilobyte {
 	size := float64(t.TxDesc.Tx.MsgTx().SerializeSize())
 	fee := float64(t.TxDesc.Fee)
@@ -77,7 +94,9 @@ func (eft *estimateFeeTester) newBlock(txs []*wire.MsgTx) {
 
 	eft.last = &lastBlock{block.Hash(), eft.last}
 
-	eft.ef.RegisterBlock(block)
+	if err := eft.ef.RegisterBlock(block); err != nil {
+		eft.t.Errorf("Could not register block: %v", err)
+	}
 }
 
 func (eft *estimateFeeTester) rollback() {
@@ -95,223 +114,355 @@ func (eft *estimateFeeTester) rollback() {
 	eft.last = eft.last.prev
 }
 
-// TestEstimateFee tests basic functionality in the FeeEstimator.
-func TestEstimateFee(t *testing.T) {
-	ef := newTestFeeEstimator(5, 3, 1)
-	eft := estimateFeeTester{ef: ef, t: t}
+func (eft *estimateFeeTester) estimates() [estimateFeeDepth]BtcPerKilobyte {
+	// Generate estimates
+	var estimates [estimateFeeDepth]BtcPerKilobyte
+	for i := 0; i < estimateFeeDepth; i++ {
+		estimates[i], _ = eft.ef.EstimateFee(uint32(i + 1))
+	}
 
-	// Try with no txs and get zero for all queries.
-	expected := BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	return estimates
+}
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator is empty; got %f", expected, estimated)
-		}
-	}
+// feeRatesEqual returns whether the passed fee rates are equal apart from
+// rounding errors.
+func feeRatesEqual(a, b BtcPerKilobyte) bool {
+	return math.Abs(float64(a-b)) <= 1e-9*math.Abs(float64(b))
+}
 
-	// Now insert a tx.
-	tx := eft.testTx(1000000)
-	ef.ObserveTransaction(tx)
+// checkEstimates ensures the estimated fee for each number of blocks matches
+// the one returned by the passed function.
+func (eft *estimateFeeTester) checkEstimates(desc string,
+	expected func(numBlocks uint32) BtcPerKilobyte) {
 
-	// Expected should still be zero because this is still in the mempool.
-	expected = BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	eft.t.Helper()
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator has one tx in mempool; got %f", expected, estimated)
+	for i := uint32(1); i <= estimateFeeDepth; i++ {
+		estimated, err := eft.ef.EstimateFee(i)
+		if err != nil {
+			eft.t.Errorf("Estimate fee error %s: %v", desc, err)
+			continue
+		}
+		if !feeRatesEqual(estimated, expected(i)) {
+			eft.t.Errorf("Estimate fee error: expected %f %s for %d "+
+				"blocks; got %f", expected(i), desc, i, estimated)
 		}
 	}
+}
+
+// TestEstimateFee tests basic functionality in the FeeEstimator.
+func TestEstimateFee(t *testing.T) {
+	ef := newTestFeeEstimator(2, 1)
+	eft := estimateFeeTester{ef: ef, t: t}
+
+	// Try with no txs and get the error value for all queries.
+	eft.checkEstimates("when estimator is empty",
+		func(uint32) BtcPerKilobyte { return -1 })
 
 	// Change minRegisteredBlocks to make sure that works. Error return
 	// value expected.
 	ef.minRegisteredBlocks = 1
-	expected = BtcPerKilobyte(-1.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f before any blocks have been registered; got %f", expected, estimated)
-		}
-	}
-
-	// Record a block with the new tx.
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
+		if _, err := ef.EstimateFee(i); err == nil {
+			t.Errorf("Estimate fee error: expected error before any " +
+				"blocks have been registered")
 		}
 	}
-
-	// Roll back the last block; this was an orphan block.
 	ef.minRegisteredBlocks = 0
-	eft.rollback()
-	expected = BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f after rolling back block; got %f", expected, estimated)
-		}
-	}
+	// Observe txs paying a high fee rate and txs paying a low fee rate.
+	high := eft.observe(3, 1000)
+	low := eft.observe(3, 100)
 
-	// Record an empty block and then a block with the new tx.
-	// This test was made because of a bug that only appeared when there
-	// were no transactions in the first bin.
-	eft.newBlock([]*wire.MsgTx{})
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	// Mine the high fee rate txs in the next block.  Only the high fee rate
+	// is known to get txs confirmed.
+	eft.newBlock(msgTxs(high))
+	highRate := expectedFeePerKilobyte(high[0])
+	eft.checkEstimates("when high fee rate txs are mined",
+		func(uint32) BtcPerKilobyte { return highRate })
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
-		}
+	// Mine the low fee rate txs five blocks after they were observed.
+	for i := 0; i < 3; i++ {
+		eft.newBlock(nil)
 	}
+	eft.newBlock(msgTxs(low))
+	lowRate := expectedFeePerKilobyte(low[0])
+	eft.checkEstimates("when low fee rate txs are mined",
+		func(numBlocks uint32) BtcPerKilobyte {
+			if numBlocks < 5 {
+				return highRate
+			}
+			return lowRate
+		})
 
-	// Create some more transactions.
-	txA := eft.testTx(500000)
-	txB := eft.testTx(2000000)
-	txC := eft.testTx(4000000)
-	ef.ObserveTransaction(txA)
-	ef.ObserveTransaction(txB)
-	ef.ObserveTransaction(txC)
+	// Txs which are still waiting in the mempool count against the fee rate
+	// they pay for the number of blocks they have waited.
+	waiting := eft.observe(6, 100)
+	for i := 0; i < 5; i++ {
+		eft.newBlock(nil)
+	}
+	eft.checkEstimates("when low fee rate txs are waiting",
+		func(numBlocks uint32) BtcPerKilobyte {
+			if numBlocks <= 5 {
+				return highRate
+			}
+			return lowRate
+		})
 
-	// Record 7 empty blocks.
-	for i := 0; i < 7; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	// Txs which are never mined count as failed to be confirmed once they
+	// are no longer tracked.
+	for i := 0; i < estimateFeeDepth-5; i++ {
+		eft.newBlock(nil)
+	}
+	if _, ok := ef.observed[*waiting[0].Tx.Hash()]; ok {
+		t.Fatalf("Unmined tx is still tracked after %d blocks",
+			estimateFeeDepth)
 	}
+	eft.checkEstimates("when low fee rate txs failed",
+		func(uint32) BtcPerKilobyte { return highRate })
 
-	// Mine the first tx.
-	eft.newBlock([]*wire.MsgTx{txA.Tx.MsgTx()})
+	// Rolling back the last block tracks the failed txs as waiting again.
+	eft.rollback()
+	eft.checkEstimates("after rolling back block",
+		func(numBlocks uint32) BtcPerKilobyte {
+			if numBlocks < estimateFeeDepth {
+				return highRate
+			}
+			return lowRate
+		})
+}
 
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i > 2 {
-			expected = expectedFeePerKilobyte(txA)
-		} else {
-			expected = expectedFeePerKilobyte(tx)
+// TestEstimateFeeDecay ensures old observations count less than recent ones
+// and eventually age out.
+func TestEstimateFeeDecay(t *testing.T) {
+	// Have many txs be confirmed in the next block at some fee rate, then
+	// have only a few txs at the same fee rate be confirmed within five
+	// blocks either right away or after many blocks.
+	setup := func(emptyBlocks int) *estimateFeeTester {
+		eft := &estimateFeeTester{ef: newTestFeeEstimator(2, 0), t: t}
+		eft.newBlock(msgTxs(eft.observe(30, 100)))
+		for i := 0; i < emptyBlocks; i++ {
+			eft.newBlock(nil)
 		}
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
+		recent := eft.observe(3, 100)
+		for i := 0; i < 4; i++ {
+			eft.newBlock(nil)
 		}
+		eft.newBlock(msgTxs(recent))
+		return eft
 	}
+	rate := NewSatoshiPerByte(100, 10).ToBtcPerKb()
+
+	// When the observations are close together the txs confirmed in the
+	// next block dominate.
+	eft := setup(0)
+	eft.checkEstimates("when observations are recent",
+		func(uint32) BtcPerKilobyte { return rate })
+
+	// When the txs confirmed in the next block were observed long ago the
+	// recent txs show the fee rate is no longer enough to get txs confirmed
+	// as quickly.
+	delayed := setup(400)
+	delayed.checkEstimates("when observations are old",
+		func(numBlocks uint32) BtcPerKilobyte {
+			if numBlocks < 5 {
+				return -1
+			}
+			return rate
+		})
 
-	// Record 5 more empty blocks.
-	for i := 0; i < 5; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	// Eventually there is not enough data left for any estimate.
+	for i := 0; i < 2000; i++ {
+		eft.newBlock(nil)
 	}
+	eft.checkEstimates("when observations have aged out",
+		func(uint32) BtcPerKilobyte { return -1 })
+}
 
-	// Mine the next tx.
-	eft.newBlock([]*wire.MsgTx{txB.Tx.MsgTx()})
-
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
-		}
+// TestEstimateSmartFee ensures conservative estimates take a longer history
+// into account than economical ones and that estimates for a greater number of
+// blocks are returned when there is not enough data for the requested one.
+func TestEstimateSmartFee(t *testing.T) {
+	eft := estimateFeeTester{ef: newTestFeeEstimator(2, 0), t: t}
+	ef := eft.ef
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
-		}
+	// No estimate is provided without any data.
+	estimate, blocks, err := ef.EstimateSmartFee(1, true)
+	if err != nil {
+		t.Fatalf("EstimateSmartFee: unexpected error: %v", err)
 	}
-
-	// Record 9 more empty blocks.
-	for i := 0; i < 10; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	if estimate != -1 || blocks != 0 {
+		t.Fatalf("EstimateSmartFee: expected no estimate; got %f for %d "+
+			"blocks", estimate, blocks)
 	}
 
-	// Mine txC.
-	eft.newBlock([]*wire.MsgTx{txC.Tx.MsgTx()})
-
-	// This should have no effect on the outcome because too
-	// many blocks have been mined for txC to be recorded.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txC)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8+6 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
+	// Long ago, txs paying a high fee rate were confirmed in the next block
+	// while those paying a low fee rate took five blocks.  Recently, txs
+	// paying the low fee rate have been confirmed in the next block.
+	high := eft.observe(40, 1000)
+	low := eft.observe(40, 100)
+	eft.newBlock(msgTxs(high))
+	for i := 0; i < 3; i++ {
+		eft.newBlock(nil)
+	}
+	eft.newBlock(msgTxs(low))
+	for i := 0; i < 2000; i++ {
+		eft.newBlock(nil)
+	}
+	eft.newBlock(msgTxs(eft.observe(10, 100)))
+	highRate := expectedFeePerKilobyte(high[0])
+	lowRate := expectedFeePerKilobyte(low[0])
+
+	tests := []struct {
+		numBlocks    uint32
+		conservative bool
+		estimate     BtcPerKilobyte
+		blocks       uint32
+	}{
+		// Economical estimates are based on the recent txs whereas
+		// conservative ones still take the older txs into account.
+		{numBlocks: 1, conservative: false, estimate: lowRate, blocks: 1},
+		{numBlocks: 1, conservative: true, estimate: highRate, blocks: 1},
+
+		// Txs paying the low fee rate have always been confirmed
+		// within five blocks.
+		{numBlocks: 5, conservative: false, estimate: lowRate, blocks: 5},
+		{numBlocks: 5, conservative: true, estimate: lowRate, blocks: 5},
+
+		// Too great numbers of blocks are limited.
+		{numBlocks: 100, conservative: true, estimate: lowRate,
+			blocks: estimateFeeDepth},
+	}
+	for _, test := range tests {
+		estimate, blocks, err := ef.EstimateSmartFee(test.numBlocks,
+			test.conservative)
+		if err != nil {
+			t.Errorf("EstimateSmartFee(%d, %v): unexpected error: %v",
+				test.numBlocks, test.conservative, err)
+			continue
 		}
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
+		if !feeRatesEqual(estimate, test.estimate) || blocks != test.blocks {
+			t.Errorf("EstimateSmartFee(%d, %v): expected %f for %d "+
+				"blocks; got %f for %d blocks", test.numBlocks,
+				test.conservative, test.estimate, test.blocks,
+				estimate, blocks)
 		}
 	}
-}
 
-func (eft *estimateFeeTester) estimates() [estimateFeeDepth]BtcPerKilobyte {
+	// The estimate for the lowest number of blocks for which there is
+	// enough data is returned.
+	eft = estimateFeeTester{ef: newTestFeeEstimator(2, 0), t: t}
+	slow := eft.observe(3, 100)
+	for i := 0; i < 2; i++ {
+		eft.newBlock(nil)
+	}
+	eft.newBlock(msgTxs(slow))
+	estimate, blocks, err = eft.ef.EstimateSmartFee(1, false)
+	if err != nil {
+		t.Fatalf("EstimateSmartFee: unexpected error: %v", err)
+	}
+	expected := expectedFeePerKilobyte(slow[0])
+	if !feeRatesEqual(estimate, expected) || blocks != 3 {
+		t.Fatalf("EstimateSmartFee: expected %f for 3 blocks; got %f "+
+			"for %d blocks", expected, estimate, blocks)
+	}
 
-	// Generate estimates
-	var estimates [estimateFeeDepth]BtcPerKilobyte
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i], _ = eft.ef.EstimateFee(uint32(i + 1))
+	// Zero blocks and too few registered blocks are errors.
+	if _, _, err := eft.ef.EstimateSmartFee(0, false); err == nil {
+		t.Fatal("EstimateSmartFee: expected error for zero blocks")
+	}
+	eft.ef.minRegisteredBlocks = 4
+	if _, _, err := eft.ef.EstimateSmartFee(1, false); err == nil {
+		t.Fatal("EstimateSmartFee: expected error before enough blocks " +
+			"have been registered")
 	}
+}
 
-	// Check that all estimated fee results go in descending order.
-	for i := 1; i < estimateFeeDepth; i++ {
-		if estimates[i] > estimates[i-1] {
-			eft.t.Error("Estimates not in descending order; got ",
-				estimates[i], " for estimate ", i, " and ", estimates[i-1], " for ", (i - 1))
-			panic("invalid state.")
-		}
+// TestEstimateFeeMissedBlocks ensures the FeeEstimator keeps its data when it
+// is informed of a block after missing some, as happens when it was saved
+// before the last blocks were processed.
+func TestEstimateFeeMissedBlocks(t *testing.T) {
+	eft := estimateFeeTester{ef: newTestFeeEstimator(2, 2), t: t}
+	high := eft.observe(3, 1000)
+	eft.newBlock(msgTxs(high))
+	waiting := eft.observe(3, 100)
+	eft.newBlock(nil)
+
+	// Skip two blocks, observe a tx which can only be mined in the next block
+	// and register it.
+	eft.height += 2
+	recent := eft.observe(1, 100)
+	eft.newBlock(nil)
+
+	// The statistics have decayed for each block, including the missed ones.
+	ef := eft.ef
+	if got := ef.LastKnownHeight(); got != eft.height {
+		t.Fatalf("Unexpected last known height: expected %d, got %d",
+			eft.height, got)
+	}
+	bucket := feeRateBucket(NewSatoshiPerByte(1000, 10))
+	expected := 3 * math.Pow(estimateFeeDecay, 4)
+	if got := ef.stats.confirmed[bucket]; math.Abs(got-expected) > 1e-9 {
+		t.Fatalf("Unexpected decayed confirmed txs: expected %f, got %f",
+			expected, got)
+	}
+	highRate := expectedFeePerKilobyte(high[0])
+	eft.checkEstimates("after missing blocks",
+		func(uint32) BtcPerKilobyte { return highRate })
+
+	// Txs which might have been mined in the missed blocks are no longer
+	// tracked.
+	if _, ok := ef.observed[*waiting[0].Tx.Hash()]; ok {
+		t.Fatal("Tx observed before missed blocks is still tracked")
+	}
+	if _, ok := ef.observed[*recent[0].Tx.Hash()]; !ok {
+		t.Fatal("Tx observed after missed blocks is not tracked")
 	}
 
-	return estimates
+	// The block can not be rolled back and a block which is not after it
+	// can not be registered.
+	if err := ef.Rollback(eft.last.hash); err == nil {
+		t.Fatal("Rollback: expected error for block after missed blocks")
+	}
+	block := btcutil.NewBlock(&wire.MsgBlock{})
+	block.SetHeight(eft.height)
+	if err := ef.RegisterBlock(block); err == nil {
+		t.Fatal("RegisterBlock: expected error for block at last height")
+	}
 }
 
-func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
+func (eft *estimateFeeTester) round(rng *rand.Rand, txHistory [][]*TxDesc,
 	estimateHistory [][estimateFeeDepth]BtcPerKilobyte,
 	txPerRound, txPerBlock uint32) ([][]*TxDesc, [][estimateFeeDepth]BtcPerKilobyte) {
 
 	// generate new txs.
 	var newTxs []*TxDesc
 	for i := uint32(0); i < txPerRound; i++ {
-		newTx := eft.testTx(btcutil.Amount(rand.Intn(1000000)))
+		newTx := eft.testTx(btcutil.Amount(rng.Intn(20000)))
 		eft.ef.ObserveTransaction(newTx)
 		newTxs = append(newTxs, newTx)
 	}
 
 	// Generate mempool.
-	mempool := make(map[*observedTransaction]*TxDesc)
+	var mempool []*TxDesc
 	for _, h := range txHistory {
 		for _, t := range h {
-			if o, exists := eft.ef.observed[*t.Tx.Hash()]; exists && o.mined == mining.UnminedHeight {
-				mempool[o] = t
+			if _, exists := eft.ef.observed[*t.Tx.Hash()]; exists {
+				mempool = append(mempool, t)
 			}
 		}
 	}
 
 	// generate new block, with no duplicates.
-	i := uint32(0)
-	newBlockList := make([]*wire.MsgTx, 0, txPerBlock)
-	for _, t := range mempool {
-		newBlockList = append(newBlockList, t.TxDesc.Tx.MsgTx())
-		i++
-
-		if i == txPerBlock {
-			break
-		}
+	rng.Shuffle(len(mempool), func(i, j int) {
+		mempool[i], mempool[j] = mempool[j], mempool[i]
+	})
+	if uint32(len(mempool)) > txPerBlock {
+		mempool = mempool[:txPerBlock]
 	}
 
 	// Register a new block.
-	eft.newBlock(newBlockList)
+	eft.newBlock(msgTxs(mempool))
 
 	// return results.
 	estimates := eft.estimates()
@@ -325,20 +476,19 @@ func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
 func TestEstimateFeeRollback(t *testing.T) {
 	txPerRound := uint32(7)
 	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
 	stepsBack := 2
 	rounds := 30
 
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(stepsBack)), t: t}
+	rng := rand.New(rand.NewSource(1))
+	eft := estimateFeeTester{ef: newTestFeeEstimator(2, uint32(stepsBack)), t: t}
 	var txHistory [][]*TxDesc
 	estimateHistory := [][estimateFeeDepth]BtcPerKilobyte{eft.estimates()}
 
 	for round := 0; round < rounds; round++ {
 		// Go forward a few rounds.
 		for step := 0; step <= stepsBack; step++ {
-			txHistory, estimateHistory =
-				eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
+			txHistory, estimateHistory = eft.round(rng, txHistory,
+				estimateHistory, txPerRound, txPerBlock)
 		}
 
 		// Now go back.
@@ -400,11 +550,10 @@ func TestDatabase(t *testing.T) {
 
 	txPerRound := uint32(7)
 	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
 	rounds := 8
 
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(rounds)+1), t: t}
+	rng := rand.New(rand.NewSource(1))
+	eft := estimateFeeTester{ef: newTestFeeEstimator(2, uint32(rounds)+1), t: t}
 	var txHistory [][]*TxDesc
 	estimateHistory := [][estimateFeeDepth]BtcPerKilobyte{eft.estimates()}
 
@@ -412,8 +561,8 @@ func TestDatabase(t *testing.T) {
 		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-1])
 
 		// Go forward one step.
-		txHistory, estimateHistory =
-			eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
+		txHistory, estimateHistory = eft.round(rng, txHistory,
+			estimateHistory, txPerRound, txPerBlock)
 	}
 
 	// Reverse the process and try again.
@@ -421,4 +570,15 @@ func TestDatabase(t *testing.T) {
 		eft.rollback()
 		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-round-1])
 	}
+
+	// Ensure data written with a different version or truncated data can't
+	// be restored.
+	save := eft.ef.Save()
+	oldVersion := append([]byte{0, 0, 0, 1}, save[4:]...)
+	if _, err := RestoreFeeEstimator(oldVersion); err == nil {
+		t.Fatal("RestoreFeeEstimator: expected error for old version")
+	}
+	if _, err := RestoreFeeEstimator(save[:len(save)-1]); err == nil {
+		t.Fatal("RestoreFeeEstimator: expected error for truncated data")
+	}
 }
@@ -55,6 +55,44 @@ const (
 // so that orphans can be identified by which peer first relayed them.
 type Tag uint64
 
+// RemovalReason describes why a transaction was removed from the memory pool.
+type RemovalReason int
+
+const (
+	// RemovalReasonExplicit indicates the transaction was removed via
+	// RemoveTransaction, such as when it was included in a block, or it
+	// spent an output of such a transaction.
+	RemovalReasonExplicit RemovalReason = iota
+
+	// RemovalReasonDoubleSpend indicates the transaction was removed via
+	// RemoveDoubleSpends because it spent an output that is also spent by
+	// a transaction in a block, or it spent an output of such a
+	// transaction.
+	RemovalReasonDoubleSpend
+
+	// RemovalReasonConflict indicates the transaction was removed because
+	// it conflicts with a replacement transaction accepted using the
+	// Replace-By-Fee (RBF) policy, or it is a descendant of such a
+	// transaction.
+	RemovalReasonConflict
+)
+
+// removalReasonStrings is a map of removal reasons back to their constant
+// names for pretty printing.
+var removalReasonStrings = map[RemovalReason]string{
+	RemovalReasonExplicit:    "RemovalReasonExplicit",
+	RemovalReasonDoubleSpend: "RemovalReasonDoubleSpend",
+	RemovalReasonConflict:    "RemovalReasonConflict",
+}
+
+// String returns the RemovalReason as a human-readable name.
+func (r RemovalReason) String() string {
+	if s := removalReasonStrings[r]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown RemovalReason (%d)", int(r))
+}
+
 // Config is a descriptor containing the memory pool configuration.
 type Config struct {
 	// Policy defines the various mempool configuration options related
@@ -103,6 +141,17 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// TxRemoved defines an optional function to invoke with every
+	// transaction that is removed from the memory pool along with the
+	// reason it was removed.  It is invoked with the mempool lock held, so
+	// it must not call back into the memory pool.
+	TxRemoved func(tx *btcutil.Tx, reason RemovalReason)
+
+	// TxAccepted defines an optional function to invoke with every
+	// transaction that is added to the memory pool.  It is invoked with the
+	// mempool lock held, so it must not call back into the memory pool.
+	TxAccepted func(tx *btcutil.Tx)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -144,12 +193,56 @@ type Policy struct {
 	// considered a non-zero fee.
 	MinRelayTxFee btcutil.Amount
 
+	// DustRelayFee defines the fee rate in BTC/kB used to determine
+	// whether transaction outputs are dust.  Outputs which cost more than
+	// a third of their value to spend at this fee rate are rejected as
+	// non-standard.  A value of zero means DefaultDustRelayFee is used.
+	DustRelayFee btcutil.Amount
+
+	// MaxDataCarrierSize is the maximum number of bytes of data a null
+	// data output script may push and MaxDataCarrierOutputs is the
+	// maximum number of null data outputs a transaction may have for it
+	// to be considered standard.  A value of zero means the respective
+	// DefaultMaxDataCarrierSize or DefaultMaxDataCarrierOutputs is used.
+	MaxDataCarrierSize    int
+	MaxDataCarrierOutputs int
+
 	// RejectReplacement, if true, rejects accepting replacement
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
 	RejectReplacement bool
 }
 
+// dustRelayFee returns the fee rate used to determine whether transaction
+// outputs are dust, which is DefaultDustRelayFee when the DustRelayFee policy
+// setting is zero.
+func (p *Policy) dustRelayFee() btcutil.Amount {
+	if p.DustRelayFee == 0 {
+		return DefaultDustRelayFee
+	}
+	return p.DustRelayFee
+}
+
+// maxDataCarrierSize returns the maximum number of bytes of data a standard
+// null data output script may push, which is DefaultMaxDataCarrierSize when
+// the MaxDataCarrierSize policy setting is zero.
+func (p *Policy) maxDataCarrierSize() int {
+	if p.MaxDataCarrierSize == 0 {
+		return DefaultMaxDataCarrierSize
+	}
+	return p.MaxDataCarrierSize
+}
+
+// maxDataCarrierOutputs returns the maximum number of null data outputs a
+// standard transaction may have, which is DefaultMaxDataCarrierOutputs when
+// the MaxDataCarrierOutputs policy setting is zero.
+func (p *Policy) maxDataCarrierOutputs() int {
+	if p.MaxDataCarrierOutputs == 0 {
+		return DefaultMaxDataCarrierOutputs
+	}
+	return p.MaxDataCarrierOutputs
+}
+
 // TxDesc is a descriptor containing a transaction in the mempool along with
 // additional metadata.
 type TxDesc struct {
@@ -158,6 +251,11 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// FeeDelta is the amount in satoshi added to the fee of the transaction
+	// when it is considered for inclusion in a block template.  It is set
+	// by PrioritiseTransaction and does not change the fee actually paid.
+	FeeDelta int64
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -466,14 +564,16 @@ func (mp *TxPool) HaveTransaction(hash *chainhash.Hash) bool {
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
+func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool,
+	reason RemovalReason) {
+
 	txHash := tx.Hash()
 	if removeRedeemers {
 		// Remove any transactions which rely on this one.
 		for i := uint32(0); i < uint32(len(tx.MsgTx().TxOut)); i++ {
 			prevOut := wire.OutPoint{Hash: *txHash, Index: i}
 			if txRedeemer, exists := mp.outpoints[prevOut]; exists {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true, reason)
 			}
 		}
 	}
@@ -492,6 +592,10 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 		}
 		delete(mp.pool, *txHash)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+
+		if mp.cfg.TxRemoved != nil {
+			mp.cfg.TxRemoved(txDesc.Tx, reason)
+		}
 	}
 }
 
@@ -504,7 +608,7 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	mp.removeTransaction(tx, removeRedeemers)
+	mp.removeTransaction(tx, removeRedeemers, RemovalReasonExplicit)
 	mp.mtx.Unlock()
 }
 
@@ -521,22 +625,18 @@ func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txRedeemer, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
 			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true,
+					RemovalReasonDoubleSpend)
 			}
 		}
 	}
 	mp.mtx.Unlock()
 }
 
-// addTransaction adds the passed transaction to the memory pool.  It should
-// not be called directly as it doesn't perform any validation.  This is a
-// helper for maybeAcceptTransaction.
-//
-// This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64) *TxDesc {
-	// Add the transaction to the pool and mark the referenced outpoints
-	// as spent by the pool.
-	txD := &TxDesc{
+// newTxDesc returns a descriptor for the passed transaction which pays the
+// provided fee and is added to the memory pool at the provided height.
+func newTxDesc(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64) *TxDesc {
+	return &TxDesc{
 		TxDesc: mining.TxDesc{
 			Tx:       tx,
 			Added:    time.Now(),
@@ -546,7 +646,17 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
 	}
+}
 
+// addTransaction adds the passed transaction to the memory pool.  It should
+// not be called directly as it doesn't perform any validation.  This is a
+// helper for maybeAcceptTransaction.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64) *TxDesc {
+	// Add the transaction to the pool and mark the referenced outpoints
+	// as spent by the pool.
+	txD := newTxDesc(utxoView, tx, height, fee)
 	mp.pool[*tx.Hash()] = txD
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
@@ -564,6 +674,10 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		mp.cfg.FeeEstimator.ObserveTransaction(txD)
 	}
 
+	if mp.cfg.TxAccepted != nil {
+		mp.cfg.TxAccepted(tx)
+	}
+
 	return txD
 }
 
@@ -776,6 +890,46 @@ func (mp *TxPool) CheckSpend(op wire.OutPoint) *btcutil.Tx {
 	return txR
 }
 
+// sequenceLocksActive returns whether or not the BIP0068 sequence locks of the
+// passed transaction are satisfied for a block at the passed height whose
+// previous block has the passed median time past using the passed utxo view to
+// look up the inputs.
+func (mp *TxPool) sequenceLocksActive(tx *btcutil.Tx,
+	utxoView *blockchain.UtxoViewpoint, nextBlockHeight int32,
+	medianTimePast time.Time) (bool, error) {
+
+	sequenceLock, err := mp.cfg.CalcSequenceLock(tx, utxoView)
+	if err != nil {
+		return false, err
+	}
+	return blockchain.SequenceLockActive(sequenceLock, nextBlockHeight,
+		medianTimePast), nil
+}
+
+// CheckSequenceLocks returns whether or not the BIP0068 sequence locks of the
+// passed transaction are satisfied such that it may be included in the next
+// block of the current best chain.  Inputs which spend outputs of transactions
+// in the pool are treated as though they are included in the next block.
+//
+// This is useful to determine whether transactions in the pool are still
+// allowed into the next block after the best chain changes, such as when
+// blocks are disconnected.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckSequenceLocks(tx *btcutil.Tx) (bool, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	utxoView, err := mp.fetchInputUtxos(tx)
+	if err != nil {
+		return false, err
+	}
+
+	nextBlockHeight := mp.cfg.BestHeight() + 1
+	return mp.sequenceLocksActive(tx, utxoView, nextBlockHeight,
+		mp.cfg.MedianTimePast())
+}
+
 // fetchInputUtxos loads utxo details about the input transactions referenced by
 // the passed transaction.  First, it loads the details form the viewpoint of
 // the main chain, then it adjusts them based upon the contents of the
@@ -920,11 +1074,15 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 }
 
 // maybeAcceptTransaction is the internal function which implements the public
-// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// MaybeAcceptTransaction and CheckAcceptTransaction.  See the comment for
+// MaybeAcceptTransaction for more details.
+//
+// When the dry run flag is set, the transaction is only checked and neither it
+// nor the state of the memory pool is modified.  The returned descriptor of an
+// acceptable transaction is then not part of the memory pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans, dryRun bool) ([]*chainhash.Hash, *TxDesc, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has witness data, and segwit isn't active yet, If
@@ -990,8 +1148,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// forbid their acceptance.
 	if !mp.cfg.Policy.AcceptNonStd {
 		err = checkTransactionStandard(tx, nextBlockHeight,
-			medianTimePast, mp.cfg.Policy.MinRelayTxFee,
-			mp.cfg.Policy.MaxTxVersion)
+			medianTimePast, &mp.cfg.Policy)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -1067,15 +1224,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// Don't allow the transaction into the mempool unless its sequence
 	// lock is active, meaning that it'll be allowed into the next block
 	// with respect to its defined relative lock times.
-	sequenceLock, err := mp.cfg.CalcSequenceLock(tx, utxoView)
+	locksActive, err := mp.sequenceLocksActive(tx, utxoView,
+		nextBlockHeight, medianTimePast)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
 		}
 		return nil, nil, err
 	}
-	if !blockchain.SequenceLockActive(sequenceLock, nextBlockHeight,
-		medianTimePast) {
+	if !locksActive {
 		return nil, nil, txRuleError(wire.RejectNonstandard,
 			"transaction's sequence locks on inputs not met")
 	}
@@ -1171,8 +1328,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	}
 
 	// Free-to-relay transactions are rate limited here to prevent
-	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	// penny-flooding with tiny transactions as a form of attack.  The
+	// limiter is not consulted for dry runs since that would update it.
+	if rateLimit && !dryRun && txFee < minFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -1216,6 +1374,12 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		return nil, nil, err
 	}
 
+	// The transaction is acceptable, so there is nothing left to do for a
+	// dry run.
+	if dryRun {
+		return nil, newTxDesc(utxoView, tx, bestHeight, txFee), nil
+	}
+
 	// Now that we've deemed the transaction as valid, we can add it to the
 	// mempool. If it ended up replacing any transactions, we'll remove them
 	// first.
@@ -1228,7 +1392,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		// The conflict set should already include the descendants for
 		// each one, so we don't need to remove the redeemers within
 		// this call as they'll be removed eventually.
-		mp.removeTransaction(conflict, false)
+		mp.removeTransaction(conflict, false, RemovalReasonConflict)
 	}
 	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
 
@@ -1252,7 +1416,29 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 func (mp *TxPool) MaybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit,
+		true, false)
+	mp.mtx.Unlock()
+
+	return hashes, txD, err
+}
+
+// CheckAcceptTransaction performs all of the checks MaybeAcceptTransaction
+// performs on the passed transaction without adding it to the memory pool.
+// The returned descriptor of an acceptable transaction, which contains its
+// fee, is not part of the memory pool.  Free transactions are not rate
+// limited.
+//
+// If the transaction is an orphan (missing parent transactions), each unknown
+// referenced parent is returned.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckAcceptTransaction(tx *btcutil.Tx) ([]*chainhash.Hash, *TxDesc, error) {
+	// Protect concurrent access.  A read lock is not enough since the
+	// checks share code paths which modify the pool.
+	mp.mtx.Lock()
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, true, false, true,
+		true)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
@@ -1295,7 +1481,7 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, false, false)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1379,7 +1565,7 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
-		true)
+		true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -1435,6 +1621,17 @@ func (mp *TxPool) Count() int {
 	return count
 }
 
+// OrphanCount returns the number of transactions in the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanCount() int {
+	mp.mtx.RLock()
+	count := len(mp.orphans)
+	mp.mtx.RUnlock()
+
+	return count
+}
+
 // TxHashes returns a slice of hashes for all of the transactions in the memory
 // pool.
 //
@@ -1481,6 +1678,16 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	i := 0
 	for _, desc := range mp.pool {
 		descs[i] = &desc.TxDesc
+
+		// Transactions with a fee delta are selected by the fee per
+		// kilobyte they would pay with the delta applied while the
+		// fee itself remains the one they actually pay.
+		if desc.FeeDelta != 0 {
+			miningDesc := desc.TxDesc
+			miningDesc.FeePerKB = (desc.Fee + desc.FeeDelta) * 1000 /
+				GetTxVirtualSize(desc.Tx)
+			descs[i] = &miningDesc
+		}
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1488,6 +1695,26 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	return descs
 }
 
+// PrioritiseTransaction adds the passed fee delta in satoshi to the fee the
+// transaction with the passed hash is considered to pay when it is selected for
+// inclusion in a block template.  Repeated calls accumulate the deltas, which
+// are discarded once the transaction leaves the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(hash *chainhash.Hash, feeDelta int64) error {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	txDesc, exists := mp.pool[*hash]
+	if !exists {
+		return fmt.Errorf("transaction %v is not in the pool", hash)
+	}
+	txDesc.FeeDelta += feeDelta
+	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+
+	return nil
+}
+
 // RawMempoolVerbose returns all of the entries in the mempool as a fully
 // populated btcjson result.
 //
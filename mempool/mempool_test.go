@@ -16,6 +16,7 @@ import (
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -29,6 +30,7 @@ type fakeChain struct {
 	utxos          *blockchain.UtxoViewpoint
 	currentHeight  int32
 	medianTimePast time.Time
+	sequenceLock   *blockchain.SequenceLock
 }
 
 // FetchUtxoView loads utxo details about the inputs referenced by the passed
@@ -96,16 +98,33 @@ func (s *fakeChain) SetMedianTimePast(mtp time.Time) {
 }
 
 // CalcSequenceLock returns the current sequence lock for the passed
-// transaction associated with the fake chain instance.
+// transaction associated with the fake chain instance.  The lock set via
+// SetSequenceLock is returned when there is one, otherwise the returned lock
+// is always satisfied.
 func (s *fakeChain) CalcSequenceLock(tx *btcutil.Tx,
 	view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
 
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.sequenceLock != nil {
+		lock := *s.sequenceLock
+		return &lock, nil
+	}
 	return &blockchain.SequenceLock{
 		Seconds:     -1,
 		BlockHeight: -1,
 	}, nil
 }
 
+// SetSequenceLock sets the sequence lock returned for all transactions by the
+// fake chain instance.
+func (s *fakeChain) SetSequenceLock(lock *blockchain.SequenceLock) {
+	s.Lock()
+	s.sequenceLock = lock
+	s.Unlock()
+}
+
 // spendableOutput is a convenience type that houses a particular utxo and the
 // amount associated with it.
 type spendableOutput struct {
@@ -317,13 +336,16 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 		chain: chain,
 		txPool: New(&Config{
 			Policy: Policy{
-				DisableRelayPriority: true,
-				FreeTxRelayLimit:     15.0,
-				MaxOrphanTxs:         5,
-				MaxOrphanTxSize:      1000,
-				MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
-				MinRelayTxFee:        1000, // 1 Satoshi per byte
-				MaxTxVersion:         1,
+				DisableRelayPriority:  true,
+				FreeTxRelayLimit:      15.0,
+				MaxOrphanTxs:          5,
+				MaxOrphanTxSize:       1000,
+				MaxSigOpCostPerTx:     blockchain.MaxBlockSigOpsCost / 4,
+				MinRelayTxFee:         1000, // 1 Satoshi per byte
+				DustRelayFee:          DefaultDustRelayFee,
+				MaxDataCarrierSize:    DefaultMaxDataCarrierSize,
+				MaxDataCarrierOutputs: DefaultMaxDataCarrierOutputs,
+				MaxTxVersion:          1,
 			},
 			ChainParams:      chainParams,
 			FetchUtxoView:    chain.FetchUtxoView,
@@ -560,7 +582,7 @@ func TestOrphanReject(t *testing.T) {
 
 		// Ensure no transactions were reported as accepted.
 		if len(acceptedTxns) != 0 {
-			t.Fatal("ProcessTransaction: reported %d accepted "+
+			t.Fatalf("ProcessTransaction: reported %d accepted "+
 				"transactions from failed orphan attempt",
 				len(acceptedTxns))
 		}
@@ -931,6 +953,340 @@ func TestCheckSpend(t *testing.T) {
 	}
 }
 
+// TestImmatureCoinbaseSpend ensures the mempool rejects transactions which spend
+// a coinbase output that will not have reached the coinbase maturity of the
+// chain parameters in the next block and accepts them once it will have.
+func TestImmatureCoinbaseSpend(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// Add a coinbase to the chain that was mined in the current best block.
+	coinbaseHeight := harness.chain.BestHeight() + 1
+	coinbase, err := harness.CreateCoinbaseTx(coinbaseHeight, 1)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, coinbaseHeight)
+	harness.chain.SetHeight(coinbaseHeight)
+
+	tx, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+
+	// Ensure the transaction is rejected while the coinbase is immature.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	rerr, ok := err.(RuleError)
+	if !ok {
+		t.Fatalf("ProcessTransaction: expected rule error, got %v", err)
+	}
+	cerr, ok := rerr.Err.(blockchain.RuleError)
+	if !ok || cerr.ErrorCode != blockchain.ErrImmatureSpend {
+		t.Fatalf("ProcessTransaction: unexpected error - got %v, want "+
+			"%v", err, blockchain.ErrImmatureSpend)
+	}
+	testPoolMembership(&testContext{t, harness}, tx, false, false)
+
+	// Advance the chain to the block before the coinbase becomes mature
+	// and ensure the transaction is accepted since it can be included in
+	// the next block.
+	maturity := int32(harness.chainParams.CoinbaseMaturity)
+	harness.chain.SetHeight(coinbaseHeight + maturity - 1)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx spending "+
+			"mature coinbase: %v", err)
+	}
+	testPoolMembership(&testContext{t, harness}, tx, false, true)
+}
+
+// TestCheckAcceptTransaction ensures checking whether a transaction would be
+// accepted reports the same result as accepting it without modifying the
+// memory pool.
+func TestCheckAcceptTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	tx, err := harness.CreateSignedTx(outputs[:1], 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+
+	// Ensure an acceptable transaction is reported along with its fee but
+	// is not added to the pool.
+	missing, txD, err := harness.txPool.CheckAcceptTransaction(tx)
+	if err != nil {
+		t.Fatalf("CheckAcceptTransaction: unexpected error: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("CheckAcceptTransaction: unexpected missing parents: "+
+			"%v", missing)
+	}
+	if txD == nil || txD.Tx != tx || txD.Fee != 1000 {
+		t.Fatalf("CheckAcceptTransaction: unexpected descriptor: %v",
+			txD)
+	}
+	testPoolMembership(tc, tx, false, false)
+
+	// Add the transaction and ensure a conflicting one which doesn't
+	// replace it is rejected without modifying the pool.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	doubleSpend, err := harness.CreateSignedTx(outputs[:1], 2, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+	_, _, err = harness.txPool.CheckAcceptTransaction(doubleSpend)
+	if _, ok := err.(RuleError); !ok {
+		t.Fatalf("CheckAcceptTransaction: expected rule error, got %v",
+			err)
+	}
+	testPoolMembership(tc, tx, false, true)
+	testPoolMembership(tc, doubleSpend, false, false)
+
+	// Ensure a transaction spending an unknown output is reported as an
+	// orphan without adding it to the orphan pool.
+	orphan, err := harness.CreateSignedTx(
+		[]spendableOutput{{
+			amount:   outputs[0].amount,
+			outPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		}}, 1, 1000, false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+	missing, _, err = harness.txPool.CheckAcceptTransaction(orphan)
+	if err != nil {
+		t.Fatalf("CheckAcceptTransaction: unexpected error: %v", err)
+	}
+	if len(missing) != 1 || *missing[0] != (chainhash.Hash{0x01}) {
+		t.Fatalf("CheckAcceptTransaction: unexpected missing parents: "+
+			"%v", missing)
+	}
+	testPoolMembership(tc, orphan, false, false)
+}
+
+// TestDustRelayFee ensures the mempool rejects transactions with outputs that
+// are dust according to the configured dust relay fee.
+func TestDustRelayFee(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Create transactions with a single pay-to-pubkey-hash output of 1000
+	// satoshi, which is above the dust threshold of 546 satoshi for the
+	// default dust relay fee, and pay the rest of the input as fee.
+	newTx := func(output spendableOutput) *btcutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{output}, 1,
+			output.amount-1000, false)
+		if err != nil {
+			t.Fatalf("unable to create signed tx: %v", err)
+		}
+		return tx
+	}
+	tx := newTx(outputs[0])
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+
+	// Triple the dust relay fee, which raises the dust threshold to 1638
+	// satoshi, and ensure an output of the same amount is now rejected as
+	// dust.
+	harness.txPool.cfg.Policy.DustRelayFee = 3 * DefaultDustRelayFee
+	dustTx := newTx(txOutToSpendableOut(tx, 0))
+	_, err = harness.txPool.ProcessTransaction(dustTx, false, false, 0)
+	rerr, ok := err.(RuleError)
+	if !ok {
+		t.Fatalf("ProcessTransaction: expected rule error, got %v", err)
+	}
+	terr, ok := rerr.Err.(TxRuleError)
+	if !ok || terr.RejectCode != wire.RejectDust {
+		t.Fatalf("ProcessTransaction: unexpected error - got %v, want "+
+			"reject code %v", err, wire.RejectDust)
+	}
+	testPoolMembership(tc, dustTx, false, false)
+}
+
+// TestDataCarrierPolicy ensures the mempool only accepts transactions with null
+// data outputs that carry no more data than the configured limit and don't
+// exceed the configured number of null data outputs.
+func TestDataCarrierPolicy(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// newTx returns a signed transaction that spends the harness output
+	// to a payment along with a null data output for each of the passed
+	// data sizes.
+	newTx := func(dataSizes ...int) *btcutil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&outputs[0].outPoint, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(outputs[0].amount)-1000000,
+			harness.payScript))
+		for _, size := range dataSizes {
+			pkScript, err := txscript.NewScriptBuilder().
+				AddOp(txscript.OP_RETURN).
+				AddData(make([]byte, size)).Script()
+			if err != nil {
+				t.Fatalf("unable to create null data script: %v",
+					err)
+			}
+			tx.AddTxOut(wire.NewTxOut(0, pkScript))
+		}
+		sigScript, err := txscript.SignatureScript(tx, 0,
+			harness.payScript, txscript.SigHashAll, harness.signKey,
+			true)
+		if err != nil {
+			t.Fatalf("unable to sign tx: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		return btcutil.NewTx(tx)
+	}
+	expectNonStandard := func(tx *btcutil.Tx) {
+		t.Helper()
+
+		_, _, err := harness.txPool.CheckAcceptTransaction(tx)
+		rerr, ok := err.(RuleError)
+		if !ok {
+			t.Fatalf("CheckAcceptTransaction: expected rule error, "+
+				"got %v", err)
+		}
+		terr, ok := rerr.Err.(TxRuleError)
+		if !ok || terr.RejectCode != wire.RejectNonstandard {
+			t.Fatalf("CheckAcceptTransaction: unexpected error - "+
+				"got %v, want reject code %v", err,
+				wire.RejectNonstandard)
+		}
+	}
+
+	// Ensure null data outputs which carry more data than the default
+	// limit and transactions with more of them than allowed by default
+	// are rejected.
+	bigTx := newTx(DefaultMaxDataCarrierSize + 20)
+	expectNonStandard(bigTx)
+	expectNonStandard(newTx(10, 10))
+
+	// Increase the limits and ensure the same transactions are accepted
+	// while exceeding the new limits is still rejected.
+	harness.txPool.cfg.Policy.MaxDataCarrierSize = 200
+	harness.txPool.cfg.Policy.MaxDataCarrierOutputs = 2
+	expectNonStandard(newTx(201))
+	expectNonStandard(newTx(10, 10, 10))
+	_, _, err = harness.txPool.CheckAcceptTransaction(newTx(10, 10))
+	if err != nil {
+		t.Fatalf("CheckAcceptTransaction: unexpected error: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(bigTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, bigTx, false, true)
+}
+
+// TestSequenceLocks ensures the mempool only accepts transactions whose
+// relative lock times are satisfied for the next block and that
+// CheckSequenceLocks reflects changes to the best chain.
+func TestSequenceLocks(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	tx, err := harness.CreateSignedTx(outputs, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+
+	// assertLocksActive ensures CheckSequenceLocks reports the expected
+	// status for the transaction.
+	assertLocksActive := func(desc string, want bool) {
+		t.Helper()
+
+		active, err := harness.txPool.CheckSequenceLocks(tx)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+		if active != want {
+			t.Fatalf("%s: unexpected sequence lock status - got "+
+				"%v, want %v", desc, active, want)
+		}
+	}
+
+	// Require a relative height lock which is not satisfied by the next
+	// block and ensure the transaction is rejected.
+	bestHeight := harness.chain.BestHeight()
+	harness.chain.SetSequenceLock(&blockchain.SequenceLock{
+		Seconds:     -1,
+		BlockHeight: bestHeight + 1,
+	})
+	assertLocksActive("unmet height lock", false)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: unexpected error for unmet "+
+			"height lock - got %v, want reject code %v", err,
+			wire.RejectNonstandard)
+	}
+	testPoolMembership(tc, tx, false, false)
+
+	// Connect a block so the lock is satisfied by the next block and
+	// ensure the transaction is accepted.
+	harness.chain.SetHeight(bestHeight + 1)
+	assertLocksActive("met height lock", true)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx with met "+
+			"height lock: %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+
+	// Disconnect the block and ensure the lock of the transaction in the
+	// pool is no longer satisfied, then reconnect it and ensure it is
+	// satisfied again.
+	harness.chain.SetHeight(bestHeight)
+	assertLocksActive("height lock after disconnect", false)
+	harness.chain.SetHeight(bestHeight + 1)
+	assertLocksActive("height lock after reconnect", true)
+
+	// Require a relative time lock which is not satisfied by the median
+	// time past of the best chain, then advance the median time past so
+	// it is.
+	medianTimePast := harness.chain.MedianTimePast()
+	harness.chain.SetSequenceLock(&blockchain.SequenceLock{
+		Seconds:     medianTimePast.Unix(),
+		BlockHeight: -1,
+	})
+	assertLocksActive("unmet time lock", false)
+	harness.chain.SetMedianTimePast(medianTimePast.Add(time.Second))
+	assertLocksActive("met time lock", true)
+}
+
 // TestSignalsReplacement tests that transactions properly signal they can be
 // replaced using RBF.
 func TestSignalsReplacement(t *testing.T) {
@@ -1810,3 +2166,220 @@ func TestRBF(t *testing.T) {
 		}
 	}
 }
+
+// TestTxRemovedReasons ensures the function invoked for transactions removed
+// from the mempool is provided with the reason they were removed, including
+// replaced transactions and their descendants, and that replacements are
+// among the accepted transactions to announce.
+func TestTxRemovedReasons(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	removed := make(map[chainhash.Hash]RemovalReason)
+	harness.txPool.cfg.TxRemoved = func(tx *btcutil.Tx, reason RemovalReason) {
+		if _, ok := removed[*tx.Hash()]; ok {
+			t.Errorf("transaction %v removed more than once",
+				tx.Hash())
+		}
+		removed[*tx.Hash()] = reason
+	}
+
+	// Create a transaction signaling replacement along with a descendant
+	// and replace them with a transaction paying a higher fee.
+	const defaultFee = btcutil.SatoshiPerBitcoin
+	coinbase := ctx.addCoinbaseTx(1)
+	coinbaseOut := txOutToSpendableOut(coinbase, 0)
+	original := ctx.addSignedTx([]spendableOutput{coinbaseOut}, 1,
+		defaultFee, true, false)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(original, 0)}, 1,
+		defaultFee, false, false)
+	if len(removed) != 0 {
+		t.Fatalf("unexpected removals before replacement: %v", removed)
+	}
+	replacement, err := harness.CreateSignedTx(
+		[]spendableOutput{coinbaseOut}, 1, defaultFee*3, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	acceptedTxns, err := harness.txPool.ProcessTransaction(replacement,
+		false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process replacement: %v", err)
+	}
+	if len(acceptedTxns) != 1 ||
+		!acceptedTxns[0].Tx.Hash().IsEqual(replacement.Hash()) {
+
+		t.Fatalf("replacement is not the only accepted transaction - "+
+			"got %d accepted", len(acceptedTxns))
+	}
+	for _, tx := range []*btcutil.Tx{original, child} {
+		testPoolMembership(ctx, tx, false, false)
+		reason, ok := removed[*tx.Hash()]
+		if !ok {
+			t.Fatalf("replaced transaction %v not reported as removed",
+				tx.Hash())
+		}
+		if reason != RemovalReasonConflict {
+			t.Fatalf("unexpected removal reason for replaced "+
+				"transaction %v - got %v, want %v", tx.Hash(),
+				reason, RemovalReasonConflict)
+		}
+	}
+	if len(removed) != 2 {
+		t.Fatalf("unexpected number of removals - got %d, want 2",
+			len(removed))
+	}
+
+	// Ensure transactions double spent by a transaction in a block and
+	// explicitly removed ones are reported with their reasons.
+	blockTx, err := harness.CreateSignedTx(
+		[]spendableOutput{coinbaseOut}, 2, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	harness.txPool.RemoveDoubleSpends(blockTx)
+	if reason := removed[*replacement.Hash()]; reason !=
+		RemovalReasonDoubleSpend {
+
+		t.Fatalf("unexpected removal reason for double spent "+
+			"transaction - got %v, want %v", reason,
+			RemovalReasonDoubleSpend)
+	}
+	other := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(ctx.addCoinbaseTx(1), 0)},
+		1, defaultFee, false, false)
+	harness.txPool.RemoveTransaction(other, true)
+	if reason := removed[*other.Hash()]; reason != RemovalReasonExplicit {
+		t.Fatalf("unexpected removal reason for removed transaction - "+
+			"got %v, want %v", reason, RemovalReasonExplicit)
+	}
+}
+
+// TestTxAccepted ensures the function invoked for transactions added to the
+// mempool is invoked for every accepted transaction, including orphans which
+// are accepted once their parent is, in the order they are added.
+func TestTxAccepted(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	var accepted []chainhash.Hash
+	harness.txPool.cfg.TxAccepted = func(tx *btcutil.Tx) {
+		accepted = append(accepted, *tx.Hash())
+	}
+
+	const defaultFee = btcutil.SatoshiPerBitcoin
+	coinbase := ctx.addCoinbaseTx(1)
+	parent, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1,
+		defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1,
+		defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	// The child is an orphan until the parent is accepted, so it must not
+	// be reported yet.
+	_, err = harness.txPool.ProcessTransaction(child, true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process orphan: %v", err)
+	}
+	testPoolMembership(ctx, child, true, false)
+	if len(accepted) != 0 {
+		t.Fatalf("orphan reported as accepted: %v", accepted)
+	}
+
+	_, err = harness.txPool.ProcessTransaction(parent, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process parent: %v", err)
+	}
+	want := []chainhash.Hash{*parent.Hash(), *child.Hash()}
+	if len(accepted) != len(want) || accepted[0] != want[0] ||
+		accepted[1] != want[1] {
+
+		t.Fatalf("unexpected accepted transactions - got %v, want %v",
+			accepted, want)
+	}
+}
+
+// TestPrioritiseTransaction ensures fee deltas accumulate, only change the fee
+// per kilobyte transactions are selected for mining by, and are discarded once
+// the transaction leaves the pool.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	const fee = btcutil.SatoshiPerBitcoin
+	coinbaseOut := txOutToSpendableOut(ctx.addCoinbaseTx(1), 0)
+	tx := ctx.addSignedTx([]spendableOutput{coinbaseOut}, 1, fee, false,
+		false)
+	defaultFee := int64(fee)
+	vsize := GetTxVirtualSize(tx)
+
+	miningDesc := func() *mining.TxDesc {
+		t.Helper()
+		descs := harness.txPool.MiningDescs()
+		if len(descs) != 1 {
+			t.Fatalf("unexpected number of mining descriptors - got "+
+				"%d, want 1", len(descs))
+		}
+		return descs[0]
+	}
+	if desc := miningDesc(); desc.FeePerKB != defaultFee*1000/vsize {
+		t.Fatalf("unexpected fee per kilobyte without a delta - got "+
+			"%d, want %d", desc.FeePerKB, defaultFee*1000/vsize)
+	}
+
+	// Ensure the deltas accumulate and only change the fee per kilobyte.
+	for _, feeDelta := range []int64{defaultFee, -defaultFee / 2} {
+		err := harness.txPool.PrioritiseTransaction(tx.Hash(), feeDelta)
+		if err != nil {
+			t.Fatalf("PrioritiseTransaction: unexpected error: %v", err)
+		}
+	}
+	desc := miningDesc()
+	wantFeePerKB := (defaultFee + defaultFee/2) * 1000 / vsize
+	if desc.Fee != defaultFee || desc.FeePerKB != wantFeePerKB {
+		t.Fatalf("unexpected mining descriptor fees - got %d (%d/kB), "+
+			"want %d (%d/kB)", desc.Fee, desc.FeePerKB, defaultFee,
+			wantFeePerKB)
+	}
+
+	// Transactions which are not in the pool can't be prioritised and the
+	// delta of a removed transaction is discarded along with it.
+	harness.txPool.RemoveTransaction(tx, true)
+	err = harness.txPool.PrioritiseTransaction(tx.Hash(), defaultFee)
+	if err == nil {
+		t.Fatalf("PrioritiseTransaction: did not receive expected error " +
+			"for a transaction which is not in the pool")
+	}
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	if desc := miningDesc(); desc.FeePerKB != defaultFee*1000/vsize {
+		t.Fatalf("unexpected fee per kilobyte after the transaction "+
+			"was re-added - got %d, want %d", desc.FeePerKB,
+			defaultFee*1000/vsize)
+	}
+}
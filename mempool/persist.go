@@ -0,0 +1,170 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// persistVersion is the version of the format the transactions in the
+	// memory pool are saved with.
+	persistVersion = 1
+
+	// maxPersistedTxns is the maximum number of transactions which are
+	// read from saved memory pool data.  It only guards against allocating
+	// memory for a bogus count since a pool of that many transactions is
+	// far larger than any which might be saved.
+	maxPersistedTxns = 1000000
+)
+
+// persistedTx houses a transaction read from saved memory pool data along with
+// the time it was originally added to the memory pool.
+type persistedTx struct {
+	tx    *btcutil.Tx
+	added time.Time
+}
+
+// Save writes all of the transactions in the memory pool along with the time
+// they were added to the passed writer so they can be restored with Load,
+// typically after a restart.  The orphan pool is not saved.
+//
+// The transactions are written in the order they were added to the memory pool
+// which ensures transactions are written after the transactions they spend.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(w io.Writer) error {
+	descs := mp.TxDescs()
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Added.Before(descs[j].Added)
+	})
+
+	err := binary.Write(w, binary.LittleEndian, uint32(persistVersion))
+	if err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(len(descs))); err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		added := desc.Added.Unix()
+		if err := binary.Write(w, binary.LittleEndian, added); err != nil {
+			return err
+		}
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPersistedTxns reads the transactions saved by Save from the passed
+// reader.
+func readPersistedTxns(r io.Reader) ([]persistedTx, error) {
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != persistVersion {
+		return nil, fmt.Errorf("unsupported memory pool data version "+
+			"%d (expected %d)", version, persistVersion)
+	}
+
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxPersistedTxns {
+		return nil, fmt.Errorf("too many transactions in memory pool "+
+			"data [count %d, max %d]", count, maxPersistedTxns)
+	}
+
+	txns := make([]persistedTx, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var added int64
+		if err := binary.Read(r, binary.LittleEndian, &added); err != nil {
+			return nil, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return nil, err
+		}
+		txns = append(txns, persistedTx{
+			tx:    btcutil.NewTx(&msgTx),
+			added: time.Unix(added, 0),
+		})
+	}
+
+	return txns, nil
+}
+
+// Load reads the transactions saved by Save from the passed reader and adds
+// back to the memory pool each of them which is still valid against the
+// current chain.  Transactions which have since been confirmed, conflict with
+// the chain or otherwise no longer pass validation are skipped, as are those
+// which spend any such transaction.  The restored transactions keep the time
+// they were originally added to the memory pool.
+//
+// Nothing is added to the memory pool when the data is malformed.  The number
+// of restored transactions is returned otherwise.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader) (int, error) {
+	txns, err := readPersistedTxns(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Transactions which spend transactions that are not in the memory pool
+	// yet are retried once the others have been processed since they might
+	// have been added to the memory pool in the same second as their
+	// parents.  Whatever still spends unknown outputs once no more
+	// transactions are accepted either spends a transaction which was
+	// skipped or has been confirmed itself.
+	var restored int
+	for len(txns) > 0 {
+		var retry []persistedTx
+		for _, ptx := range txns {
+			mp.mtx.Lock()
+			missing, txD, err := mp.maybeAcceptTransaction(ptx.tx,
+				false, false, true, false)
+			if err == nil && len(missing) == 0 {
+				txD.Added = ptx.added
+			}
+			mp.mtx.Unlock()
+
+			switch {
+			case err != nil:
+				log.Debugf("Not restoring transaction %v: %v",
+					ptx.tx.Hash(), err)
+			case len(missing) != 0:
+				retry = append(retry, ptx)
+			default:
+				restored++
+			}
+		}
+
+		// Stop when the last pass did not accept any transactions
+		// since retrying would not change the outcome.
+		if len(retry) == len(txns) {
+			for _, ptx := range retry {
+				log.Debugf("Not restoring transaction %v: spends "+
+					"unknown outputs", ptx.tx.Hash())
+			}
+			break
+		}
+		txns = retry
+	}
+
+	return restored, nil
+}
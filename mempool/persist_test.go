@@ -0,0 +1,143 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestPersist ensures the transactions saved from a memory pool are restored
+// into a new memory pool along with the time they were added when they are
+// still valid against the chain, while transactions which have since been
+// confirmed or conflict with the chain are skipped.
+func TestPersist(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	coinbase := tc.addCoinbaseTx(3)
+
+	// Add a chain of transactions along with transactions which spend the
+	// outputs of the second coinbase to the memory pool.
+	txChain, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range txChain {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+	}
+	independent := tc.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		false, false,
+	)
+	confirmed := tc.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 1)}, 1, 1000,
+		false, false,
+	)
+	conflicted := tc.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 2)}, 1, 1000,
+		false, false,
+	)
+
+	// Make the last transaction of the chain appear to have been added
+	// before the others so it is saved before the transaction it spends.
+	// Also, use whole seconds for the times the transactions were added
+	// since the saved times are not more precise.
+	added := make(map[*btcutil.Tx]time.Time)
+	addedTime := time.Unix(time.Now().Unix(), 0)
+	for i, tx := range append(txChain, independent, confirmed, conflicted) {
+		txD := harness.txPool.pool[*tx.Hash()]
+		txD.Added = addedTime.Add(time.Duration(i) * time.Second)
+		added[tx] = txD.Added
+	}
+	chainTip := txChain[len(txChain)-1]
+	harness.txPool.pool[*chainTip.Hash()].Added = addedTime.Add(-time.Second)
+	added[chainTip] = addedTime.Add(-time.Second)
+
+	var buf bytes.Buffer
+	if err := harness.txPool.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Mine the first transaction of the chain along with one of the
+	// independent transactions and a transaction which conflicts with
+	// another one.
+	doubleSpend, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 2)}, 2, 1000,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create signed tx: %v", err)
+	}
+	newHeight := harness.chain.BestHeight() + 1
+	for _, tx := range []*btcutil.Tx{txChain[0], confirmed, doubleSpend} {
+		for _, txIn := range tx.MsgTx().TxIn {
+			harness.chain.utxos.LookupEntry(txIn.PreviousOutPoint).Spend()
+		}
+		harness.chain.utxos.AddTxOuts(tx, newHeight)
+	}
+	harness.chain.SetHeight(newHeight)
+
+	// Ensure the transactions which are still valid are restored into a
+	// new memory pool along with the time they were added while others
+	// are skipped.
+	harness.txPool = New(&harness.txPool.cfg)
+	restored, err := harness.txPool.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if restored != 3 {
+		t.Fatalf("Load: unexpected number of restored transactions - "+
+			"got %d, want 3", restored)
+	}
+	for _, tx := range []*btcutil.Tx{txChain[1], txChain[2], independent} {
+		testPoolMembership(tc, tx, false, true)
+		txD := harness.txPool.pool[*tx.Hash()]
+		if !txD.Added.Equal(added[tx]) {
+			t.Fatalf("unexpected time restored transaction %v was "+
+				"added - got %v, want %v", tx.Hash(), txD.Added,
+				added[tx])
+		}
+	}
+	for _, tx := range []*btcutil.Tx{txChain[0], confirmed, conflicted} {
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// Ensure truncated data and data of an unsupported version are
+	// rejected without adding any transactions.
+	tests := []struct {
+		name string
+		data []byte
+	}{{
+		name: "truncated",
+		data: data[:len(data)-1],
+	}, {
+		name: "unsupported version",
+		data: append([]byte{0x02, 0x00, 0x00, 0x00}, data[4:]...),
+	}}
+	for _, test := range tests {
+		txPool := New(&harness.txPool.cfg)
+		if _, err := txPool.Load(bytes.NewReader(test.data)); err == nil {
+			t.Fatalf("%s: Load: did not receive expected error",
+				test.name)
+		}
+		if count := txPool.Count(); count != 0 {
+			t.Fatalf("%s: Load: unexpectedly added %d transactions",
+				test.name, count)
+		}
+	}
+}
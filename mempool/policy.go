@@ -49,6 +49,20 @@ const (
 	// for larger transactions.  This value is in Satoshi/1000 bytes.
 	DefaultMinRelayTxFee = btcutil.Amount(1000)
 
+	// DefaultDustRelayFee is the default fee rate in satoshi used to
+	// determine whether a transaction output is considered dust.  This
+	// value is in Satoshi/1000 bytes.
+	DefaultDustRelayFee = btcutil.Amount(1000)
+
+	// DefaultMaxDataCarrierSize is the default maximum number of bytes of
+	// data a null data output script may push for the transaction to be
+	// considered standard.
+	DefaultMaxDataCarrierSize = txscript.MaxDataCarrierSize
+
+	// DefaultMaxDataCarrierOutputs is the default maximum number of null
+	// data outputs a transaction may have to be considered standard.
+	DefaultMaxDataCarrierOutputs = 1
+
 	// maxStandardMultiSigKeys is the maximum number of public keys allowed
 	// in a multi-signature transaction output script for it to be
 	// considered standard.
@@ -173,11 +187,11 @@ func checkPkScriptStandard(pkScript []byte, scriptClass txscript.ScriptClass) er
 }
 
 // isDust returns whether or not the passed transaction output amount is
-// considered dust or not based on the passed minimum transaction relay fee.
-// Dust is defined in terms of the minimum transaction relay fee.  In
-// particular, if the cost to the network to spend coins is more than 1/3 of the
-// minimum transaction relay fee, it is considered dust.
-func isDust(txOut *wire.TxOut, minRelayTxFee btcutil.Amount) bool {
+// considered dust or not based on the passed dust relay fee.  Dust is defined
+// in terms of the dust relay fee.  In particular, if the cost to the network to
+// spend coins at the dust relay fee is more than 1/3 of their value, it is
+// considered dust.
+func isDust(txOut *wire.TxOut, dustRelayFee btcutil.Amount) bool {
 	// Unspendable outputs are considered dust.
 	if txscript.IsUnspendable(txOut.PkScript) {
 		return true
@@ -254,18 +268,17 @@ func isDust(txOut *wire.TxOut, minRelayTxFee btcutil.Amount) bool {
 	}
 
 	// The output is considered dust if the cost to the network to spend the
-	// coins is more than 1/3 of the minimum free transaction relay fee.
-	// minFreeTxRelayFee is in Satoshi/KB, so multiply by 1000 to
-	// convert to bytes.
+	// coins is more than 1/3 of their value at the dust relay fee.
+	// dustRelayFee is in Satoshi/KB, so multiply by 1000 to convert to
+	// bytes.
 	//
 	// Using the typical values for a pay-to-pubkey-hash transaction from
-	// the breakdown above and the default minimum free transaction relay
-	// fee of 1000, this equates to values less than 546 satoshi being
-	// considered dust.
+	// the breakdown above and the default dust relay fee of 1000, this
+	// equates to values less than 546 satoshi being considered dust.
 	//
 	// The following is equivalent to (value/totalSize) * (1/3) * 1000
 	// without needing to do floating point math.
-	return txOut.Value*1000/(3*int64(totalSize)) < int64(minRelayTxFee)
+	return txOut.Value*1000/(3*int64(totalSize)) < int64(dustRelayFee)
 }
 
 // checkTransactionStandard performs a series of checks on a transaction to
@@ -273,18 +286,18 @@ func isDust(txOut *wire.TxOut, minRelayTxFee btcutil.Amount) bool {
 // conforms to several additional limiting cases over what is considered a
 // "sane" transaction such as having a version in the supported range, being
 // finalized, conforming to more stringent size constraints, having scripts
-// of recognized forms, and not containing "dust" outputs (those that are
-// so small it costs more to process them than they are worth).
+// of recognized forms, not carrying more data than allowed, and not containing
+// "dust" outputs (those that are so small it costs more to process them than
+// they are worth).  The limits are those of the passed policy.
 func checkTransactionStandard(tx *btcutil.Tx, height int32,
-	medianTimePast time.Time, minRelayTxFee btcutil.Amount,
-	maxTxVersion int32) error {
+	medianTimePast time.Time, policy *Policy) error {
 
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
-	if msgTx.Version > maxTxVersion || msgTx.Version < 1 {
+	if msgTx.Version > policy.MaxTxVersion || msgTx.Version < 1 {
 		str := fmt.Sprintf("transaction version %d is not in the "+
 			"valid range of %d-%d", msgTx.Version, 1,
-			maxTxVersion)
+			policy.MaxTxVersion)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
@@ -332,6 +345,22 @@ func checkTransactionStandard(tx *btcutil.Tx, height int32,
 	// be "dust" (except when the script is a null data script).
 	numNullDataOutputs := 0
 	for i, txOut := range msgTx.TxOut {
+		// Null data scripts are only standard when they don't carry
+		// more data than the policy allows, which may differ from the
+		// limit the script class is determined with.
+		if size, ok := txscript.NullDataSize(txOut.PkScript); ok {
+			maxSize := policy.maxDataCarrierSize()
+			if size > maxSize {
+				str := fmt.Sprintf("transaction output %d: "+
+					"null data script carries %d bytes which "+
+					"is more than the max allowed %d bytes",
+					i, size, maxSize)
+				return txRuleError(wire.RejectNonstandard, str)
+			}
+			numNullDataOutputs++
+			continue
+		}
+
 		scriptClass := txscript.GetScriptClass(txOut.PkScript)
 		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
 		if err != nil {
@@ -346,22 +375,21 @@ func checkTransactionStandard(tx *btcutil.Tx, height int32,
 			return txRuleError(rejectCode, str)
 		}
 
-		// Accumulate the number of outputs which only carry data.  For
-		// all other script types, ensure the output value is not
-		// "dust".
-		if scriptClass == txscript.NullDataTy {
-			numNullDataOutputs++
-		} else if isDust(txOut, minRelayTxFee) {
+		// Ensure the output value is not "dust".
+		if isDust(txOut, policy.dustRelayFee()) {
 			str := fmt.Sprintf("transaction output %d: payment "+
 				"of %d is dust", i, txOut.Value)
 			return txRuleError(wire.RejectDust, str)
 		}
 	}
 
-	// A standard transaction must not have more than one output script that
-	// only carries data.
-	if numNullDataOutputs > 1 {
-		str := "more than one transaction output in a nulldata script"
+	// A standard transaction must not have more output scripts that only
+	// carry data than the policy allows.
+	maxOutputs := policy.maxDataCarrierOutputs()
+	if numNullDataOutputs > maxOutputs {
+		str := fmt.Sprintf("%d transaction outputs in a nulldata "+
+			"script which is more than the max allowed %d",
+			numNullDataOutputs, maxOutputs)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
@@ -215,7 +215,7 @@ func TestDust(t *testing.T) {
 	tests := []struct {
 		name     string // test description
 		txOut    wire.TxOut
-		relayFee btcutil.Amount // minimum relay transaction fee.
+		relayFee btcutil.Amount // dust relay fee.
 		isDust   bool
 	}{
 		{
@@ -467,10 +467,16 @@ func TestCheckTransactionStandard(t *testing.T) {
 	}
 
 	pastMedianTime := time.Now()
+	policy := &Policy{
+		MaxTxVersion:          1,
+		DustRelayFee:          DefaultDustRelayFee,
+		MaxDataCarrierSize:    DefaultMaxDataCarrierSize,
+		MaxDataCarrierOutputs: DefaultMaxDataCarrierOutputs,
+	}
 	for _, test := range tests {
 		// Ensure standardness is as expected.
 		err := checkTransactionStandard(btcutil.NewTx(&test.tx),
-			test.height, pastMedianTime, DefaultMinRelayTxFee, 1)
+			test.height, pastMedianTime, policy)
 		if err == nil && test.isStandard {
 			// Test passes since function returned standard for a
 			// transaction which is intended to be standard.
@@ -510,3 +516,67 @@ func TestCheckTransactionStandard(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckTransactionStandardDefaults ensures transactions are checked
+// against the default policy settings when they are zero.
+func TestCheckTransactionStandardDefaults(t *testing.T) {
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 1}
+	txIn := wire.NewTxIn(&prevOut, bytes.Repeat([]byte{0x00}, 65), nil)
+	addrHash := [20]byte{0x01}
+	addr, err := btcutil.NewAddressPubKeyHash(addrHash[:],
+		&chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+
+	// An output which is dust at the default dust relay fee is rejected.
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(500, pkScript))
+	policy := &Policy{MaxTxVersion: 1}
+	err = checkTransactionStandard(btcutil.NewTx(tx), 300000, time.Now(),
+		policy)
+	rerr, ok := err.(RuleError)
+	if !ok {
+		t.Fatalf("checkTransactionStandard: unexpected error %v", err)
+	}
+	txrerr, ok := rerr.Err.(TxRuleError)
+	if !ok || txrerr.RejectCode != wire.RejectDust {
+		t.Fatalf("checkTransactionStandard: unexpected error %v", err)
+	}
+
+	// A null data output carrying the default max amount of data is
+	// standard, while a second one is not.
+	nullData := func(size int) *wire.TxOut {
+		script, err := txscript.NullDataScript(make([]byte, size))
+		if err != nil {
+			t.Fatalf("NullDataScript: unexpected error: %v", err)
+		}
+		return wire.NewTxOut(0, script)
+	}
+	tests := []struct {
+		name       string
+		txOuts     []*wire.TxOut
+		isStandard bool
+	}{
+		{"max data", []*wire.TxOut{nullData(DefaultMaxDataCarrierSize)},
+			true},
+		{"too many outputs", []*wire.TxOut{nullData(1), nullData(1)},
+			false},
+	}
+	for _, test := range tests {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(txIn)
+		tx.TxOut = test.txOuts
+		err := checkTransactionStandard(btcutil.NewTx(tx), 300000,
+			time.Now(), policy)
+		if (err == nil) != test.isStandard {
+			t.Errorf("checkTransactionStandard (%s): unexpected "+
+				"result %v", test.name, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package cpuminer
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"runtime"
 	"sync"
@@ -28,16 +29,20 @@ const (
 	// transaction can be.
 	maxExtraNonce = ^uint64(0) // 2^64 - 1
 
-	// hpsUpdateSecs is the number of seconds to wait in between each
+	// hpsUpdateInterval is the amount of time to wait in between each
 	// update to the hashes per second monitor.
-	hpsUpdateSecs = 10
-
-	// hashUpdateSec is the number of seconds each worker waits in between
-	// notifying the speed monitor with how many hashes have been completed
-	// while they are actively searching for a solution.  This is done to
-	// reduce the amount of syncs between the workers that must be done to
-	// keep track of the hashes per second.
-	hashUpdateSecs = 15
+	hpsUpdateInterval = time.Second
+
+	// hpsWindowSize is the number of the most recent update intervals the
+	// hashes per second are averaged over.
+	hpsWindowSize = 10
+
+	// hashUpdateInterval is the amount of time each worker waits in
+	// between notifying the speed monitor with how many hashes have been
+	// completed while they are actively searching for a solution.  This is
+	// done to reduce the amount of syncs between the workers that must be
+	// done to keep track of the hashes per second.
+	hashUpdateInterval = time.Second
 )
 
 var (
@@ -81,6 +86,27 @@ type Config struct {
 	// not current since any solved blocks would be on a side chain and and
 	// up orphaned anyways.
 	IsCurrent func() bool
+
+	// MaxCPUFraction limits the number of workers which solve blocks to
+	// the given fraction of the processor cores in the system, rounded
+	// down, with a minimum of one worker.  Values which are not between
+	// zero and one do not limit the number of workers.
+	MaxCPUFraction float64
+}
+
+// maxWorkersForFraction returns the maximum number of workers which solve
+// blocks for the passed number of processor cores and fraction of them the
+// miner may use.  See Config.MaxCPUFraction for details.
+func maxWorkersForFraction(numCPU int, fraction float64) uint32 {
+	if fraction <= 0 || fraction >= 1 {
+		return math.MaxUint32
+	}
+
+	maxWorkers := uint32(float64(numCPU) * fraction)
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	return maxWorkers
 }
 
 // CPUMiner provides facilities for solving blocks (mining) using the CPU in
@@ -94,6 +120,7 @@ type CPUMiner struct {
 	g                 *mining.BlkTmplGenerator
 	cfg               Config
 	numWorkers        uint32
+	maxWorkers        uint32
 	started           bool
 	discreteMining    bool
 	submitBlockLock   sync.Mutex
@@ -107,13 +134,16 @@ type CPUMiner struct {
 }
 
 // speedMonitor handles tracking the number of hashes per second the mining
-// process is performing.  It must be run as a goroutine.
+// process is performing.  The hashes per second are averaged over a rolling
+// window of the most recent update intervals.  It must be run as a goroutine.
 func (m *CPUMiner) speedMonitor() {
 	log.Tracef("CPU miner speed monitor started")
 
 	var hashesPerSec float64
 	var totalHashes uint64
-	ticker := time.NewTicker(time.Second * hpsUpdateSecs)
+	var window [hpsWindowSize]uint64
+	var windowNext, windowLen int
+	ticker := time.NewTicker(hpsUpdateInterval)
 	defer ticker.Stop()
 
 out:
@@ -124,15 +154,24 @@ out:
 		case numHashes := <-m.updateHashes:
 			totalHashes += numHashes
 
-		// Time to update the hashes per second.
+		// Time to update the hashes per second.  The hashes of the
+		// interval that just ended replace those of the oldest one in
+		// the window.
 		case <-ticker.C:
-			curHashesPerSec := float64(totalHashes) / hpsUpdateSecs
-			if hashesPerSec == 0 {
-				hashesPerSec = curHashesPerSec
+			window[windowNext] = totalHashes
+			windowNext = (windowNext + 1) % hpsWindowSize
+			if windowLen < hpsWindowSize {
+				windowLen++
 			}
-			hashesPerSec = (hashesPerSec + curHashesPerSec) / 2
 			totalHashes = 0
-			if hashesPerSec != 0 {
+
+			var windowHashes uint64
+			for _, numHashes := range window {
+				windowHashes += numHashes
+			}
+			windowSecs := float64(windowLen) * hpsUpdateInterval.Seconds()
+			hashesPerSec = float64(windowHashes) / windowSecs
+			if windowNext == 0 && hashesPerSec != 0 {
 				log.Debugf("Hash speed: %6.0f kilohashes/s",
 					hashesPerSec/1000)
 			}
@@ -204,8 +243,11 @@ func (m *CPUMiner) submitBlock(block *btcutil.Block) bool {
 // This function will return early with false when conditions that trigger a
 // stale block such as a new block showing up or periodically when there are
 // new transactions and enough time has elapsed without finding a solution.
+//
+// When triesLeft is not nil, it is decremented for every attempted nonce and
+// the function returns false once it reaches zero.
 func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
-	ticker *time.Ticker, quit chan struct{}) bool {
+	ticker *time.Ticker, quit chan struct{}, triesLeft *uint64) bool {
 
 	// Choose a random extra nonce offset for this block template and
 	// worker.
@@ -269,6 +311,16 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
 				// Non-blocking select to fall through
 			}
 
+			// Give up once the allowed number of attempts has been
+			// exhausted.
+			if triesLeft != nil {
+				if *triesLeft == 0 {
+					m.updateHashes <- hashesCompleted
+					return false
+				}
+				*triesLeft--
+			}
+
 			// Update the nonce and hash the block header.  Each
 			// hash is actually a double sha256 (two hashes), so
 			// increment the number of hashes completed for each
@@ -301,7 +353,7 @@ func (m *CPUMiner) generateBlocks(quit chan struct{}) {
 
 	// Start a ticker which is used to signal checks for stale work and
 	// updates to the speed monitor.
-	ticker := time.NewTicker(time.Second * hashUpdateSecs)
+	ticker := time.NewTicker(hashUpdateInterval)
 	defer ticker.Stop()
 out:
 	for {
@@ -354,7 +406,7 @@ out:
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, quit) {
+		if m.solveBlock(template.Block, curHeight+1, ticker, quit, nil) {
 			block := btcutil.NewBlock(template.Block)
 			m.submitBlock(block)
 		}
@@ -484,7 +536,8 @@ func (m *CPUMiner) IsMining() bool {
 }
 
 // HashesPerSecond returns the number of hashes per second the mining process
-// is performing.  0 is returned if the miner is not currently running.
+// is performing averaged over the last several seconds.  0 is returned if the
+// miner is not currently running.
 //
 // This function is safe for concurrent access.
 func (m *CPUMiner) HashesPerSecond() float64 {
@@ -502,7 +555,8 @@ func (m *CPUMiner) HashesPerSecond() float64 {
 // SetNumWorkers sets the number of workers to create which solve blocks.  Any
 // negative values will cause a default number of workers to be used which is
 // based on the number of processor cores in the system.  A value of 0 will
-// cause all CPU mining to be stopped.
+// cause all CPU mining to be stopped.  The number of workers is capped to the
+// fraction of the processor cores the miner is configured to use.
 //
 // This function is safe for concurrent access.
 func (m *CPUMiner) SetNumWorkers(numWorkers int32) {
@@ -521,6 +575,9 @@ func (m *CPUMiner) SetNumWorkers(numWorkers int32) {
 	} else {
 		m.numWorkers = uint32(numWorkers)
 	}
+	if m.numWorkers > m.maxWorkers {
+		m.numWorkers = m.maxWorkers
+	}
 
 	// When the miner is already running, notify the controller about the
 	// the change.
@@ -545,6 +602,28 @@ func (m *CPUMiner) NumWorkers() int32 {
 // generating a new block template.  When a block is solved, it is submitted.
 // The function returns a list of the hashes of generated blocks.
 func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(n, nil, nil)
+}
+
+// GenerateNBlocksToAddress generates the requested number of blocks the same
+// way as GenerateNBlocks except the coinbase of every block pays the provided
+// address instead of one of the configured mining addresses.  At most maxTries
+// nonces are attempted in total, so fewer blocks than requested are generated
+// when they are exhausted.  The function returns a list of the hashes of the
+// generated blocks.
+func (m *CPUMiner) GenerateNBlocksToAddress(n uint32, payToAddr btcutil.Address,
+	maxTries uint64) ([]*chainhash.Hash, error) {
+
+	return m.generateNBlocks(n, payToAddr, &maxTries)
+}
+
+// generateNBlocks generates the requested number of blocks paying the provided
+// address or one of the configured mining addresses at random when it is nil.
+// When triesLeft is not nil, generation stops once the number of nonces it
+// points to have been attempted.
+func (m *CPUMiner) generateNBlocks(n uint32, payToAddr btcutil.Address,
+	triesLeft *uint64) ([]*chainhash.Hash, error) {
+
 	m.Lock()
 
 	// Respond with an error if server is already mining.
@@ -563,6 +642,15 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 	m.Unlock()
 
+	defer func() {
+		m.Lock()
+		close(m.speedMonitorQuit)
+		m.wg.Wait()
+		m.started = false
+		m.discreteMining = false
+		m.Unlock()
+	}()
+
 	log.Tracef("Generating %d blocks", n)
 
 	i := uint32(0)
@@ -570,7 +658,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 	// Start a ticker which is used to signal checks for stale work and
 	// updates to the speed monitor.
-	ticker := time.NewTicker(time.Second * hashUpdateSecs)
+	ticker := time.NewTicker(hashUpdateInterval)
 	defer ticker.Stop()
 
 	for {
@@ -588,14 +676,17 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		m.submitBlockLock.Lock()
 		curHeight := m.g.BestSnapshot().Height
 
-		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		// Choose a payment address at random when none was provided.
+		addr := payToAddr
+		if addr == nil {
+			rand.Seed(time.Now().UnixNano())
+			addr = m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		}
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
 		// include in the block.
-		template, err := m.g.NewBlockTemplate(payToAddr)
+		template, err := m.g.NewBlockTemplate(addr)
 		m.submitBlockLock.Unlock()
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block "+
@@ -608,21 +699,23 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, nil) {
+		if m.solveBlock(template.Block, curHeight+1, ticker, nil, triesLeft) {
 			block := btcutil.NewBlock(template.Block)
 			m.submitBlock(block)
 			blockHashes[i] = block.Hash()
 			i++
 			if i == n {
 				log.Tracef("Generated %d blocks", i)
-				m.Lock()
-				close(m.speedMonitorQuit)
-				m.wg.Wait()
-				m.started = false
-				m.discreteMining = false
-				m.Unlock()
 				return blockHashes, nil
 			}
+			continue
+		}
+
+		// Stop once the allowed number of attempts has been exhausted.
+		if triesLeft != nil && *triesLeft == 0 {
+			log.Tracef("Generated %d blocks before exhausting the "+
+				"allowed attempts", i)
+			return blockHashes[:i], nil
 		}
 	}
 }
@@ -631,10 +724,18 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
 func New(cfg *Config) *CPUMiner {
+	maxWorkers := maxWorkersForFraction(runtime.NumCPU(),
+		cfg.MaxCPUFraction)
+	numWorkers := defaultNumWorkers
+	if numWorkers > maxWorkers {
+		numWorkers = maxWorkers
+	}
+
 	return &CPUMiner{
 		g:                 cfg.BlockTemplateGenerator,
 		cfg:               *cfg,
-		numWorkers:        defaultNumWorkers,
+		numWorkers:        numWorkers,
+		maxWorkers:        maxWorkers,
 		updateNumWorkers:  make(chan struct{}),
 		queryHashesPerSec: make(chan float64),
 		updateHashes:      make(chan uint64),
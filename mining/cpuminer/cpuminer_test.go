@@ -0,0 +1,204 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cpuminer
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// testTxSource provides an empty source of transactions for the block
+// templates generated in the tests.
+type testTxSource struct{}
+
+func (testTxSource) LastUpdated() time.Time                    { return time.Time{} }
+func (testTxSource) MiningDescs() []*mining.TxDesc             { return nil }
+func (testTxSource) HaveTransaction(hash *chainhash.Hash) bool { return false }
+
+// newTestMiner returns a CPU miner for a new chain which only contains the
+// genesis block of the regression test network along with a function that
+// tears it down.  The proof of work limit of the network is raised to the one
+// of the main network so the blocks the miner works on are not solved quickly.
+func newTestMiner(t *testing.T, maxCPUFraction float64) (*CPUMiner, func()) {
+	t.Helper()
+
+	params := chaincfg.RegressionNetParams
+	params.PowLimitBits = chaincfg.MainNetParams.PowLimitBits
+	params.PowLimit = chaincfg.MainNetParams.PowLimit
+
+	dbPath, err := ioutil.TempDir("", "cpuminertest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	timeSource := blockchain.NewMedianTime()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	payAddr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &params)
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create address: %v", err)
+	}
+
+	policy := mining.Policy{BlockMaxWeight: blockchain.MaxBlockWeight - 4000}
+	generator := mining.NewBlkTmplGenerator(&policy, &params,
+		testTxSource{}, chain, timeSource, txscript.NewSigCache(100),
+		txscript.NewHashCache(100))
+	miner := New(&Config{
+		ChainParams:            &params,
+		BlockTemplateGenerator: generator,
+		MiningAddrs:            []btcutil.Address{payAddr},
+		ProcessBlock: func(*btcutil.Block, blockchain.BehaviorFlags) (bool, error) {
+			t.Error("unexpected block solved by the CPU miner")
+			return false, nil
+		},
+		ConnectedCount: func() int32 { return 1 },
+		IsCurrent:      func() bool { return true },
+		MaxCPUFraction: maxCPUFraction,
+	})
+	return miner, teardown
+}
+
+// numTestWorkers returns the number of goroutines which are running workers
+// that solve blocks.
+func numTestWorkers() int {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	return strings.Count(string(buf), "(*CPUMiner).generateBlocks(")
+}
+
+// waitForTestWorkers waits for the passed number of workers which solve blocks
+// to be running and fails the test when they are not within a few seconds.
+func waitForTestWorkers(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := numTestWorkers()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected number of workers - got %d, want %d",
+				got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHashesPerSecond ensures the rate the CPU miner reports is zero when it
+// is not mining and nonzero once it has been mining for a while.
+func TestHashesPerSecond(t *testing.T) {
+	miner, teardown := newTestMiner(t, 0)
+	defer teardown()
+
+	if hps := miner.HashesPerSecond(); hps != 0 {
+		t.Fatalf("unexpected hashes per second before mining - got %v",
+			hps)
+	}
+
+	miner.SetNumWorkers(1)
+	miner.Start()
+	defer miner.Stop()
+
+	deadline := time.Now().Add(hpsUpdateInterval*hpsWindowSize +
+		hashUpdateInterval)
+	for miner.HashesPerSecond() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no hashes per second reported while mining")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TestMaxCPUFraction ensures limiting the CPU miner to a fraction of the
+// processor cores limits the number of workers which solve blocks.
+func TestMaxCPUFraction(t *testing.T) {
+	tests := []struct {
+		numCPU   int
+		fraction float64
+		want     uint32
+	}{
+		{numCPU: 8, fraction: 0.5, want: 4},
+		{numCPU: 8, fraction: 0.3, want: 2},
+		{numCPU: 8, fraction: 0.1, want: 1},
+		{numCPU: 1, fraction: 0.5, want: 1},
+		{numCPU: 8, fraction: 0, want: math.MaxUint32},
+		{numCPU: 8, fraction: 1, want: math.MaxUint32},
+	}
+	for _, test := range tests {
+		got := maxWorkersForFraction(test.numCPU, test.fraction)
+		if got != test.want {
+			t.Errorf("maxWorkersForFraction(%d, %v): unexpected "+
+				"max workers - got %d, want %d", test.numCPU,
+				test.fraction, got, test.want)
+		}
+	}
+
+	// Request more workers than there are processor cores and ensure all
+	// of them are launched without a limit and that the limit reduces
+	// them otherwise.
+	numWorkers := runtime.NumCPU() + 1
+	maxWorkers := runtime.NumCPU() / 2
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	for _, fraction := range []float64{0, 0.5} {
+		want := numWorkers
+		if fraction != 0 {
+			want = maxWorkers
+		}
+
+		miner, teardown := newTestMiner(t, fraction)
+		miner.SetNumWorkers(int32(numWorkers))
+		if got := miner.NumWorkers(); got != int32(want) {
+			teardown()
+			t.Fatalf("fraction %v: unexpected number of workers - "+
+				"got %d, want %d", fraction, got, want)
+		}
+		miner.Start()
+		waitForTestWorkers(t, want)
+		miner.Stop()
+		waitForTestWorkers(t, 0)
+		teardown()
+	}
+}
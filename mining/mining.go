@@ -7,7 +7,10 @@ package mining
 import (
 	"bytes"
 	"container/heap"
+	"encoding/binary"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
@@ -27,10 +30,19 @@ const (
 	// a block header and max possible transaction count.
 	blockHeaderOverhead = wire.MaxBlockHeaderPayload + wire.MaxVarIntPayload
 
-	// CoinbaseFlags is added to the coinbase script of a generated block
-	// and is used to monitor BIP16 support as well as blocks that are
-	// generated via btcd.
+	// CoinbaseFlags is the default data added to the coinbase script of a
+	// generated block and is used to monitor BIP16 support as well as
+	// blocks that are generated via btcd.
 	CoinbaseFlags = "/P2SH/btcd/"
+
+	// MaxCoinbaseExtraNonceSize is the maximum number of bytes the extra
+	// nonce may take in the coinbase script of a generated block.
+	MaxCoinbaseExtraNonceSize = 8
+
+	// maxCoinbaseHeight and maxCoinbaseExtraNonce are the block height and
+	// extra nonce which take the most space in a coinbase script.
+	maxCoinbaseHeight     = math.MaxInt32
+	maxCoinbaseExtraNonce = math.MaxInt64
 )
 
 // TxDesc is a descriptor about a transaction in a transaction source along with
@@ -237,11 +249,48 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 // standardCoinbaseScript returns a standard script suitable for use as the
 // signature script of the coinbase transaction of a new block.  In particular,
 // it starts with the block height that is required by version 2 blocks and adds
-// the extra nonce as well as additional coinbase flags.
-func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64) ([]byte, error) {
-	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
-		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags)).
-		Script()
+// the extra nonce as well as the passed coinbase flags.  The extra nonce is
+// added as a minimally encoded number when extraNonceSize is zero and as the
+// push of its extraNonceSize low order bytes in little endian otherwise.
+func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64,
+	extraNonceSize int, flags string) ([]byte, error) {
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight))
+	if extraNonceSize == 0 {
+		builder.AddInt64(int64(extraNonce))
+	} else {
+		// The push opcode is added explicitly since a single byte would
+		// otherwise be added as a small integer opcode for some values.
+		var nonce [MaxCoinbaseExtraNonceSize]byte
+		binary.LittleEndian.PutUint64(nonce[:], extraNonce)
+		builder.AddOp(txscript.OP_DATA_1 + byte(extraNonceSize) - 1).
+			AddOps(nonce[:extraNonceSize])
+	}
+	return builder.AddData([]byte(flags)).Script()
+}
+
+// ValidateCoinbaseFlags returns an error when the coinbase script of a block
+// with the passed coinbase flags and extra nonce size could exceed the maximum
+// allowed length for any block height and extra nonce, or the extra nonce size
+// is not between zero and MaxCoinbaseExtraNonceSize.
+func ValidateCoinbaseFlags(flags string, extraNonceSize int) error {
+	if extraNonceSize < 0 || extraNonceSize > MaxCoinbaseExtraNonceSize {
+		return fmt.Errorf("extra nonce size of %d bytes is not between "+
+			"0 and %d bytes", extraNonceSize,
+			MaxCoinbaseExtraNonceSize)
+	}
+	coinbaseScript, err := standardCoinbaseScript(maxCoinbaseHeight,
+		maxCoinbaseExtraNonce, extraNonceSize, flags)
+	if err != nil {
+		return err
+	}
+	if len(coinbaseScript) > blockchain.MaxCoinbaseScriptLen {
+		return fmt.Errorf("coinbase flags of %d bytes result in a "+
+			"coinbase script of up to %d bytes which exceeds the "+
+			"maximum of %d bytes", len(flags), len(coinbaseScript),
+			blockchain.MaxCoinbaseScriptLen)
+	}
+	return nil
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate subsidy
@@ -341,6 +390,20 @@ func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.
 	return newTimestamp
 }
 
+// TemplateStats houses statistics about a generated block template.
+type TemplateStats struct {
+	// Height is the height of the block the template is for.
+	Height int32
+
+	// Size and Weight are the serialized size and the weight of the block.
+	Size   uint64
+	Weight uint64
+
+	// NumTxns is the number of transactions in the block not counting the
+	// coinbase transaction.
+	NumTxns uint64
+}
+
 // BlkTmplGenerator provides a type that can be used to generate block templates
 // based on a given mining policy and source of transactions to choose from.
 // It also houses additional state required in order to ensure the templates
@@ -353,6 +416,11 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	// lastTemplate houses the statistics about the most recently generated
+	// block template.  It is nil until the first template is generated.
+	lastTemplateMtx sync.Mutex
+	lastTemplate    *TemplateStats
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -412,11 +480,13 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
 // transaction will be skipped unless the BlockMinSize policy setting is
 // nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// transactions until the block size reaches that minimum size.  Transactions
+// with fees per kilobyte below the BlockMinTxFee policy setting are always
+// skipped.
 //
-// Any transactions which would cause the block to exceed the BlockMaxSize
-// policy setting, exceed the maximum allowed signature operations per block, or
-// otherwise cause the block to be invalid are skipped.
+// Any transactions which would cause the block to exceed the BlockMaxWeight or
+// BlockMaxSize policy settings, exceed the maximum allowed signature operations
+// per block, or otherwise cause the block to be invalid are skipped.
 //
 // Given the above, a block generated by this function is of the following form:
 //
@@ -454,7 +524,8 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	// same value to the same public key address would otherwise be an
 	// identical transaction for block version 1).
 	extraNonce := uint64(0)
-	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce,
+		g.policy.CoinbaseExtraNonceSize, g.policy.coinbaseFlags())
 	if err != nil {
 		return nil, err
 	}
@@ -599,6 +670,9 @@ mempoolLoop:
 	// transaction.
 	blockWeight := uint32((blockHeaderOverhead * blockchain.WitnessScaleFactor) +
 		blockchain.GetTransactionWeight(coinbaseTx))
+	blockSize := uint32(blockHeaderOverhead +
+		coinbaseTx.MsgTx().SerializeSizeStripped())
+	blockMaxSize := g.policy.blockMaxSize()
 	blockSigOpCost := coinbaseSigOpCost
 	totalFees := int64(0)
 
@@ -655,7 +729,11 @@ mempoolLoop:
 			weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
 				blockchain.GetTransactionWeight(coinbaseTx)
 
+			sizeDiff := coinbaseCopy.MsgTx().SerializeSizeStripped() -
+				coinbaseTx.MsgTx().SerializeSizeStripped()
+
 			blockWeight += uint32(weightDiff)
+			blockSize += uint32(sizeDiff)
 
 			witnessIncluded = true
 		}
@@ -663,7 +741,7 @@ mempoolLoop:
 		// Grab any transactions which depend on this one.
 		deps := dependers[*tx.Hash()]
 
-		// Enforce maximum block size.  Also check for overflow.
+		// Enforce maximum block weight.  Also check for overflow.
 		txWeight := uint32(blockchain.GetTransactionWeight(tx))
 		blockPlusTxWeight := blockWeight + txWeight
 		if blockPlusTxWeight < blockWeight ||
@@ -675,6 +753,18 @@ mempoolLoop:
 			continue
 		}
 
+		// Enforce maximum block size.  Also check for overflow.
+		txSize := uint32(tx.MsgTx().SerializeSizeStripped())
+		blockPlusTxSize := blockSize + txSize
+		if blockPlusTxSize < blockSize ||
+			blockPlusTxSize >= blockMaxSize {
+
+			log.Tracef("Skipping tx %s because it would exceed "+
+				"the max block size", tx.Hash())
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
 		// Enforce maximum signature operation cost per block.  Also
 		// check for overflow.
 		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
@@ -693,6 +783,16 @@ mempoolLoop:
 			continue
 		}
 
+		// Skip transactions which do not pay the minimum fee required
+		// for inclusion regardless of the block size.
+		if prioItem.feePerKB < int64(g.policy.BlockMinTxFee) {
+			log.Tracef("Skipping tx %s with feePerKB %d "+
+				"< BlockMinTxFee %d", tx.Hash(), prioItem.feePerKB,
+				g.policy.BlockMinTxFee)
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
 		// Skip free transactions once the block is larger than the
 		// minimum block size.
 		if sortedByFee &&
@@ -768,6 +868,7 @@ mempoolLoop:
 		// template.
 		blockTxns = append(blockTxns, tx)
 		blockWeight += txWeight
+		blockSize += txSize
 		blockSigOpCost += int64(sigOpCost)
 		totalFees += prioItem.fee
 		txFees = append(txFees, prioItem.fee)
@@ -885,6 +986,15 @@ mempoolLoop:
 		"%064x)", len(msgBlock.Transactions), totalFees, blockSigOpCost,
 		blockWeight, blockchain.CompactToBig(msgBlock.Header.Bits))
 
+	g.lastTemplateMtx.Lock()
+	g.lastTemplate = &TemplateStats{
+		Height:  nextBlockHeight,
+		Size:    uint64(msgBlock.SerializeSize()),
+		Weight:  uint64(blockchain.GetBlockWeight(block)),
+		NumTxns: uint64(len(msgBlock.Transactions) - 1),
+	}
+	g.lastTemplateMtx.Unlock()
+
 	return &BlockTemplate{
 		Block:             &msgBlock,
 		Fees:              txFees,
@@ -925,7 +1035,8 @@ func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock) error {
 // height.  It also recalculates and updates the new merkle root that results
 // from changing the coinbase script.
 func (g *BlkTmplGenerator) UpdateExtraNonce(msgBlock *wire.MsgBlock, blockHeight int32, extraNonce uint64) error {
-	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce,
+		g.policy.CoinbaseExtraNonceSize, g.policy.coinbaseFlags())
 	if err != nil {
 		return err
 	}
@@ -958,6 +1069,29 @@ func (g *BlkTmplGenerator) BestSnapshot() *blockchain.BestState {
 	return g.chain.BestSnapshot()
 }
 
+// LastTemplateStats returns statistics about the most recently generated block
+// template or nil when no template has been generated yet.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) LastTemplateStats() *TemplateStats {
+	g.lastTemplateMtx.Lock()
+	defer g.lastTemplateMtx.Unlock()
+
+	if g.lastTemplate == nil {
+		return nil
+	}
+	stats := *g.lastTemplate
+	return &stats
+}
+
+// CoinbaseFlags returns the data added to the coinbase script of the generated
+// blocks.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) CoinbaseFlags() string {
+	return g.policy.coinbaseFlags()
+}
+
 // TxSource returns the associated transaction source.
 //
 // This function is safe for concurrent access.
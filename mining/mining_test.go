@@ -5,10 +5,14 @@
 package mining
 
 import (
+	"bytes"
 	"container/heap"
+	"math"
 	"math/rand"
+	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -108,3 +112,104 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// TestValidateCoinbaseFlags ensures coinbase flags are only accepted when the
+// coinbase script with the largest block height and extra nonce stays within the
+// maximum coinbase script length and the extra nonce size is in range.
+func TestValidateCoinbaseFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		flags     string
+		nonceSize int
+		valid     bool
+	}{
+		{name: "empty", flags: "", valid: true},
+		{name: "default", flags: CoinbaseFlags, valid: true},
+		{name: "max length", flags: strings.Repeat("a", 84), valid: true},
+		{name: "oversized", flags: strings.Repeat("a", 85), valid: false},
+		{
+			name:      "max nonce size",
+			flags:     CoinbaseFlags,
+			nonceSize: MaxCoinbaseExtraNonceSize,
+			valid:     true,
+		},
+		{
+			name:      "max length with small nonce size",
+			flags:     strings.Repeat("a", 91),
+			nonceSize: 1,
+			valid:     true,
+		},
+		{
+			name:      "oversized with small nonce size",
+			flags:     strings.Repeat("a", 92),
+			nonceSize: 1,
+			valid:     false,
+		},
+		{
+			name:      "negative nonce size",
+			flags:     CoinbaseFlags,
+			nonceSize: -1,
+			valid:     false,
+		},
+		{
+			name:      "nonce size too large",
+			flags:     CoinbaseFlags,
+			nonceSize: MaxCoinbaseExtraNonceSize + 1,
+			valid:     false,
+		},
+	}
+	for _, test := range tests {
+		err := ValidateCoinbaseFlags(test.flags, test.nonceSize)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected result - got %v, want valid %v",
+				test.name, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+
+		// Ensure the largest coinbase script with the valid flags fits.
+		script, err := standardCoinbaseScript(maxCoinbaseHeight,
+			maxCoinbaseExtraNonce, test.nonceSize, test.flags)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(script) > blockchain.MaxCoinbaseScriptLen {
+			t.Errorf("%s: coinbase script of %d bytes exceeds the "+
+				"maximum of %d bytes", test.name, len(script),
+				blockchain.MaxCoinbaseScriptLen)
+		}
+	}
+}
+
+// TestStandardCoinbaseScriptNonceSize ensures the coinbase flags are at the same
+// offset of the coinbase script for any extra nonce when the extra nonce has a
+// fixed size and that an empty policy uses the default coinbase flags.
+func TestStandardCoinbaseScriptNonceSize(t *testing.T) {
+	var policy Policy
+	if flags := policy.coinbaseFlags(); flags != CoinbaseFlags {
+		t.Fatalf("unexpected default coinbase flags -- got %q, want %q",
+			flags, CoinbaseFlags)
+	}
+
+	// The block height 1000 takes a push of two bytes and the flags follow
+	// the push of the extra nonce and their own push opcode.
+	for size := 1; size <= MaxCoinbaseExtraNonceSize; size++ {
+		offset := 3 + 1 + size + 1
+		for _, extraNonce := range []uint64{0, 1, 0x10, math.MaxUint64} {
+			script, err := standardCoinbaseScript(1000, extraNonce,
+				size, CoinbaseFlags)
+			if err != nil {
+				t.Fatalf("size %d: unexpected error: %v", size, err)
+			}
+			flagsOffset := bytes.Index(script, []byte(CoinbaseFlags))
+			if flagsOffset != offset {
+				t.Fatalf("size %d: coinbase flags of extra nonce %d "+
+					"at offset %d, want %d", size, extraNonce,
+					flagsOffset, offset)
+			}
+		}
+	}
+}
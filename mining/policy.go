@@ -34,7 +34,8 @@ type Policy struct {
 	BlockMinSize uint32
 
 	// BlockMaxSize is the maximum block size to be used when generating a
-	// block template.
+	// block template.  A value of zero means the size is only limited by
+	// the maximum allowed size of a block.
 	BlockMaxSize uint32
 
 	// BlockPrioritySize is the size in bytes for high-priority / low-fee
@@ -45,6 +46,46 @@ type Policy struct {
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreeFee btcutil.Amount
+
+	// BlockMinTxFee is the minimum fee in Satoshi/1000 bytes that is
+	// required for a transaction to be included in a block template
+	// regardless of its priority or the minimum block size.
+	BlockMinTxFee btcutil.Amount
+
+	// CoinbaseFlags is the data added to the coinbase script of generated
+	// blocks after the block height and extra nonce.  An empty value means
+	// the default CoinbaseFlags are used.  It must pass
+	// ValidateCoinbaseFlags for the coinbase script to remain within the
+	// allowed length.
+	CoinbaseFlags string
+
+	// CoinbaseExtraNonceSize is the number of bytes the extra nonce takes
+	// in the coinbase script of generated blocks, which keeps the flags at
+	// the same offset for any extra nonce.  Only the low order bytes of
+	// the extra nonce are used.  A value of zero means the extra nonce is
+	// added as a minimally encoded number instead.  It may be at most
+	// MaxCoinbaseExtraNonceSize.
+	CoinbaseExtraNonceSize int
+}
+
+// blockMaxSize returns the maximum block size to be used when generating a
+// block template, which is the maximum allowed size of a block when the
+// BlockMaxSize policy setting is zero.
+func (p *Policy) blockMaxSize() uint32 {
+	if p.BlockMaxSize == 0 {
+		return blockchain.MaxBlockBaseSize
+	}
+	return p.BlockMaxSize
+}
+
+// coinbaseFlags returns the data to add to the coinbase script of generated
+// blocks, which is the default CoinbaseFlags when the CoinbaseFlags policy
+// setting is empty.
+func (p *Policy) coinbaseFlags() string {
+	if p.CoinbaseFlags == "" {
+		return CoinbaseFlags
+	}
+	return p.CoinbaseFlags
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
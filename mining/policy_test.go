@@ -166,3 +166,24 @@ func TestCalcPriority(t *testing.T) {
 		}
 	}
 }
+
+// TestPolicyBlockMaxSize ensures a zero BlockMaxSize policy setting limits the
+// size of generated blocks to the maximum allowed size of a block instead of
+// excluding every transaction.
+func TestPolicyBlockMaxSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		blockMaxSize uint32
+		want         uint32
+	}{
+		{name: "zero", blockMaxSize: 0, want: blockchain.MaxBlockBaseSize},
+		{name: "configured", blockMaxSize: 750000, want: 750000},
+	}
+	for _, test := range tests {
+		policy := Policy{BlockMaxSize: test.blockMaxSize}
+		if got := policy.blockMaxSize(); got != test.want {
+			t.Errorf("%s: unexpected max block size - got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+}
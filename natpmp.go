@@ -0,0 +1,235 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// natpmpPort is the port NAT-PMP gateways listen for requests on.
+	natpmpPort = 5351
+
+	// natpmpVersion is the version of the NAT-PMP protocol.
+	natpmpVersion = 0
+
+	// natpmpInitialTimeout is the amount of time to wait for a response to
+	// the first attempt of a request.  It doubles with every retry as
+	// specified by RFC 6886.
+	natpmpInitialTimeout = 250 * time.Millisecond
+
+	// natpmpMaxAttempts is the number of times a request is sent before
+	// the gateway is considered unresponsive.
+	natpmpMaxAttempts = 4
+)
+
+// NAT-PMP operation codes.  Responses use the operation code of the request
+// plus natpmpOpResponse.
+const (
+	natpmpOpExternalAddress = 0
+	natpmpOpMapUDP          = 1
+	natpmpOpMapTCP          = 2
+	natpmpOpResponse        = 128
+)
+
+// natpmpResultCodes describes the result codes of NAT-PMP responses which
+// indicate a failure.
+var natpmpResultCodes = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// natpmpNAT implements the NAT interface by mapping ports on a NAT-PMP (RFC
+// 6886) gateway.
+type natpmpNAT struct {
+	gateway *net.UDPAddr
+}
+
+// Ensure natpmpNAT implements the NAT interface.
+var _ NAT = (*natpmpNAT)(nil)
+
+// DiscoverNATPMP returns a NAT for the NAT-PMP gateway of the network when the
+// default gateway responds to NAT-PMP requests.
+func DiscoverNATPMP() (NAT, error) {
+	gateway, err := defaultGateway()
+	if err != nil {
+		return nil, err
+	}
+	nat := &natpmpNAT{gateway: &net.UDPAddr{IP: gateway, Port: natpmpPort}}
+	if _, err := nat.GetExternalAddress(); err != nil {
+		return nil, err
+	}
+	return nat, nil
+}
+
+// defaultGateway returns the IPv4 address of the default gateway.  The routing
+// table is consulted when it is available and otherwise the first address of
+// the network of the local address is assumed, which is the address most
+// home routers use.
+func defaultGateway() (net.IP, error) {
+	if gateway, err := defaultGatewayFromRoutes("/proc/net/route"); err == nil {
+		return gateway, nil
+	}
+
+	ourIP, err := getOurIP()
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(ourIP).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("local address %s is not an IPv4 address",
+			ourIP)
+	}
+	return net.IPv4(ip[0], ip[1], ip[2], 1), nil
+}
+
+// defaultGatewayFromRoutes returns the gateway of the default route in a
+// routing table in the format of /proc/net/route.
+func defaultGatewayFromRoutes(path string) (net.IP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Each route is a line of whitespace separated fields which starts
+	// with the interface, destination, and gateway, where the addresses are
+	// hex encoded in host byte order.
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gateway, err := hex.DecodeString(fields[2])
+		if err != nil || len(gateway) != net.IPv4len {
+			continue
+		}
+		return net.IPv4(gateway[3], gateway[2], gateway[1], gateway[0]), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no default route")
+}
+
+// request sends the passed request to the gateway until it responds or the
+// maximum number of attempts is reached and returns the response after
+// ensuring it is a successful response to the request of at least the passed
+// size.
+func (n *natpmpNAT) request(msg []byte, responseSize int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, n.gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	response := make([]byte, 16)
+	timeout := natpmpInitialTimeout
+	for attempt := 0; attempt < natpmpMaxAttempts; attempt++ {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		err := conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, err
+		}
+		timeout *= 2
+
+		for {
+			size, err := conn.Read(response)
+			if err != nil {
+				if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			// Ignore responses which are not for the request.
+			if size < 4 || response[0] != natpmpVersion ||
+				response[1] != msg[1]+natpmpOpResponse {
+				continue
+			}
+			result := binary.BigEndian.Uint16(response[2:4])
+			if result != 0 {
+				reason, ok := natpmpResultCodes[result]
+				if !ok {
+					reason = fmt.Sprintf("result code %d", result)
+				}
+				return nil, fmt.Errorf("NAT-PMP request refused: %s",
+					reason)
+			}
+			if size < responseSize {
+				return nil, fmt.Errorf("short NAT-PMP response of "+
+					"%d bytes", size)
+			}
+			return response[:size], nil
+		}
+	}
+	return nil, fmt.Errorf("no NAT-PMP response from %s", n.gateway)
+}
+
+// GetExternalAddress implements the NAT interface by requesting the external
+// IP address of the gateway.
+func (n *natpmpNAT) GetExternalAddress() (net.IP, error) {
+	response, err := n.request([]byte{natpmpVersion,
+		natpmpOpExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(response[8], response[9], response[10], response[11]), nil
+}
+
+// mapPort requests a mapping of the passed internal port to the passed external
+// port for the passed lifetime in seconds and returns the external port the
+// gateway mapped.  A lifetime of zero removes the mapping.
+func (n *natpmpNAT) mapPort(protocol string, externalPort, internalPort int, lifetime uint32) (int, error) {
+	var op byte
+	switch protocol {
+	case "udp":
+		op = natpmpOpMapUDP
+	case "tcp":
+		op = natpmpOpMapTCP
+	default:
+		return 0, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	msg := make([]byte, 12)
+	msg[0] = natpmpVersion
+	msg[1] = op
+	binary.BigEndian.PutUint16(msg[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(msg[8:12], lifetime)
+	response, err := n.request(msg, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(response[10:12])), nil
+}
+
+// AddPortMapping implements the NAT interface by requesting the gateway to map
+// the external port to the internal port for timeout seconds.  NAT-PMP
+// mappings have no description, so it is ignored.
+func (n *natpmpNAT) AddPortMapping(protocol string, externalPort, internalPort int, description string, timeout int) (int, error) {
+	return n.mapPort(protocol, externalPort, internalPort, uint32(timeout))
+}
+
+// DeletePortMapping implements the NAT interface by requesting the gateway to
+// remove the mapping of the internal port.
+func (n *natpmpNAT) DeletePortMapping(protocol string, externalPort, internalPort int) error {
+	_, err := n.mapPort(protocol, 0, internalPort, 0)
+	return err
+}
@@ -5,6 +5,8 @@
 package netsync
 
 import (
+	"time"
+
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -37,5 +39,11 @@ type Config struct {
 	DisableCheckpoints bool
 	MaxPeers           int
 
+	// MaxStallDuration is the time without progress after which the sync
+	// peer is considered stalled and replaced by another one.  It defaults
+	// to 3 minutes when zero and must otherwise be at least 6 nanoseconds
+	// so the stall checks have a positive interval.
+	MaxStallDuration time.Duration
+
 	FeeEstimator *mempool.FeeEstimator
 }
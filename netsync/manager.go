@@ -6,6 +6,8 @@ package netsync
 
 import (
 	"container/list"
+	"fmt"
+	"math/big"
 	"math/rand"
 	"net"
 	"sync"
@@ -40,13 +42,23 @@ const (
 	// hashes to store in memory.
 	maxRequestedTxns = wire.MaxInvPerMsg
 
-	// maxStallDuration is the time after which we will disconnect our
-	// current sync peer if we haven't made progress.
-	maxStallDuration = 3 * time.Minute
+	// defaultMaxStallDuration is the default time after which we will
+	// disconnect our current sync peer if we haven't made progress.
+	defaultMaxStallDuration = 3 * time.Minute
 
 	// stallSampleInterval the interval at which we will check to see if our
-	// sync has stalled.
+	// sync has stalled with the default max stall duration.  It is scaled
+	// along with the max stall duration otherwise.
 	stallSampleInterval = 30 * time.Second
+
+	// minMaxStallDuration is the shortest max stall duration which leaves a
+	// positive interval between the samples of the stall ticker.
+	minMaxStallDuration = defaultMaxStallDuration / stallSampleInterval
+
+	// maxHeaderRanges is the maximum number of header ranges between the
+	// checkpoints after the next one that are downloaded from peers other
+	// than the sync peer ahead of time in headers-first mode.
+	maxHeaderRanges = 8
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -105,6 +117,12 @@ type getSyncPeerMsg struct {
 	reply chan int32
 }
 
+// getHeaderTipMsg is a message type to be sent across the message channel for
+// retrieving the height of the best known header.
+type getHeaderTipMsg struct {
+	reply chan int32
+}
+
 // processBlockResponse is a response sent to the reply channel of a
 // processBlockMsg.
 type processBlockResponse struct {
@@ -130,6 +148,25 @@ type isCurrentMsg struct {
 	reply chan bool
 }
 
+// requestBlockMsg is a message type to be sent across the message channel for
+// requesting a specific block from a peer.  The reply channel receives whether
+// or not the request was sent and the done channel receives the outcome of
+// processing the block once the peer responds.
+type requestBlockMsg struct {
+	hash  *chainhash.Hash
+	peer  *peerpkg.Peer
+	reply chan error
+	done  chan error
+}
+
+// cancelBlockRequestMsg is a message type to be sent across the message channel
+// for canceling a request for a specific block from a peer made via a
+// requestBlockMsg.
+type cancelBlockRequestMsg struct {
+	hash *chainhash.Hash
+	peer *peerpkg.Peer
+}
+
 // pauseMsg is a message type to be sent across the message channel for
 // pausing the sync manager.  This effectively provides the caller with
 // exclusive access over the manager until a receive is performed on the
@@ -139,10 +176,24 @@ type pauseMsg struct {
 }
 
 // headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// between checkpoints.  The header is only set for headers which were received
+// from a peer so it can be added to the block index of the chain.
 type headerNode struct {
-	height int32
-	hash   *chainhash.Hash
+	height  int32
+	hash    *chainhash.Hash
+	workSum *big.Int
+	header  *wire.BlockHeader
+}
+
+// headerRange houses the block headers between two consecutive checkpoints
+// which are downloaded from a peer other than the sync peer while the sync peer
+// is still busy with the blocks before them.
+type headerRange struct {
+	peer     *peerpkg.Peer
+	start    *chaincfg.Checkpoint
+	end      *chaincfg.Checkpoint
+	headers  []*headerNode
+	complete bool
 }
 
 // peerSyncState stores additional information that the SyncManager tracks
@@ -152,6 +203,8 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	blockRequests   map[chainhash.Hash]chan<- error
+	headerRange     *headerRange
 }
 
 // limitAdd is a helper function for maps that require a maximum limit by
@@ -197,12 +250,14 @@ type SyncManager struct {
 	syncPeer         *peerpkg.Peer
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
+	maxStallDuration time.Duration
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
 	headerList       *list.List
 	startHeader      *list.Element
 	nextCheckpoint   *chaincfg.Checkpoint
+	headerRanges     map[int32]*headerRange
 
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
@@ -224,6 +279,27 @@ func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight
 	}
 }
 
+// headerTipHeight returns the height of the best known header, which is the
+// highest of the best chain tip and the headers downloaded in headers-first
+// mode that the blocks have not been connected for yet.
+func (sm *SyncManager) headerTipHeight() int32 {
+	height := sm.chain.BestSnapshot().Height
+	if e := sm.headerList.Back(); e != nil {
+		if node := e.Value.(*headerNode); node.height > height {
+			height = node.height
+		}
+	}
+	for _, r := range sm.headerRanges {
+		if len(r.headers) == 0 {
+			continue
+		}
+		if node := r.headers[len(r.headers)-1]; node.height > height {
+			height = node.height
+		}
+	}
+	return height
+}
+
 // findNextHeaderCheckpoint returns the next checkpoint after the passed height.
 // It returns nil when there is not one either because the height is already
 // later than the final checkpoint or some other reason such as disabled
@@ -252,6 +328,82 @@ func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoi
 	return nextCheckpoint
 }
 
+// assignHeaderRanges requests the headers between the checkpoints after the
+// next one from the candidate peers which are neither the sync peer nor already
+// downloading headers, up to maxHeaderRanges ranges ahead of the sync peer.
+// The ranges are keyed by the height of the checkpoint they build on and are
+// merged into the header list once the sync peer reaches that checkpoint.
+func (sm *SyncManager) assignHeaderRanges() {
+	if !sm.headersFirstMode || sm.nextCheckpoint == nil {
+		return
+	}
+
+	// Gather the peers available to download a header range.
+	var idlePeers []*peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if peer != sm.syncPeer && state.syncCandidate &&
+			state.headerRange == nil {
+
+			idlePeers = append(idlePeers, peer)
+		}
+	}
+
+	start := sm.nextCheckpoint
+	for i := 0; i < maxHeaderRanges && len(idlePeers) > 0; i++ {
+		end := sm.findNextHeaderCheckpoint(start.Height)
+		if end == nil {
+			return
+		}
+		if _, exists := sm.headerRanges[start.Height]; exists {
+			start = end
+			continue
+		}
+
+		// Choose the first idle peer which knows about the end of the
+		// range.
+		var rangePeer *peerpkg.Peer
+		for j, peer := range idlePeers {
+			if peer.LastBlock() >= end.Height {
+				rangePeer = peer
+				idlePeers = append(idlePeers[:j], idlePeers[j+1:]...)
+				break
+			}
+		}
+		if rangePeer == nil {
+			return
+		}
+
+		locator := blockchain.BlockLocator([]*chainhash.Hash{start.Hash})
+		err := rangePeer.PushGetHeadersMsg(locator, end.Hash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", rangePeer.Addr(), err)
+			return
+		}
+		r := &headerRange{peer: rangePeer, start: start, end: end}
+		sm.headerRanges[start.Height] = r
+		sm.peerStates[rangePeer].headerRange = r
+		log.Infof("Downloading headers for blocks %d to %d from peer %s",
+			start.Height+1, end.Height, rangePeer.Addr())
+		start = end
+	}
+}
+
+// removeHeaderRange removes the passed header range along with its assignment
+// to the peer downloading it, if any.
+func (sm *SyncManager) removeHeaderRange(r *headerRange) {
+	delete(sm.headerRanges, r.start.Height)
+	if r.peer == nil {
+		return
+	}
+	if state, exists := sm.peerStates[r.peer]; exists &&
+		state.headerRange == r {
+
+		state.headerRange = nil
+	}
+	r.peer = nil
+}
+
 // startSync will choose the best peer among the available candidate peers to
 // download/sync the blockchain from.  When syncing is already running, it
 // simply returns.  It also examines the candidates for any which are no longer
@@ -371,6 +523,10 @@ func (sm *SyncManager) startSync() {
 		}
 		sm.syncPeer = bestPeer
 
+		// Download the headers after the next checkpoint from the
+		// other peers in the mean time.
+		sm.assignHeaderRanges()
+
 		// Reset the last progress time now that we have a non-nil
 		// syncPeer to avoid instantly detecting it as stalled in the
 		// event the progress time hasn't been updated recently.
@@ -434,11 +590,15 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		blockRequests:   make(map[chainhash.Hash]chan<- error),
 	}
 
-	// Start syncing by choosing the best candidate if needed.
+	// Start syncing by choosing the best candidate if needed.  Otherwise,
+	// the peer may download headers ahead of the sync peer.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
+	} else if isSyncCandidate {
+		sm.assignHeaderRanges()
 	}
 }
 
@@ -457,7 +617,7 @@ func (sm *SyncManager) handleStallSample() {
 	}
 
 	// If the stall timeout has not elapsed, exit early.
-	if time.Since(sm.lastProgressTime) <= maxStallDuration {
+	if time.Since(sm.lastProgressTime) <= sm.maxStallDuration {
 		return
 	}
 
@@ -467,6 +627,9 @@ func (sm *SyncManager) handleStallSample() {
 		return
 	}
 
+	log.Infof("Sync peer %s made no progress for %v -- switching sync "+
+		"peers", sm.syncPeer, time.Since(sm.lastProgressTime))
+
 	sm.clearRequestedState(state)
 
 	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
@@ -512,11 +675,21 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	for blockHash, done := range state.blockRequests {
+		done <- fmt.Errorf("peer %s disconnected before sending "+
+			"block %v", peer, blockHash)
+	}
+	if state.headerRange != nil {
+		sm.removeHeaderRange(state.headerRange)
+	}
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
+	} else {
+		// Hand the header range of the peer, if any, to another peer.
+		sm.assignHeaderRanges()
 	}
 }
 
@@ -547,9 +720,14 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 	log.Debugf("Updating sync peer, no progress for: %v",
 		time.Since(sm.lastProgressTime))
 
-	// First, disconnect the current sync peer if requested.
+	// First, disconnect the current sync peer if requested.  The peer
+	// remains known until the server signals it is done, so also ensure it
+	// is not selected as the sync peer again in the mean time.
 	if dcSyncPeer {
 		sm.syncPeer.Disconnect()
+		if state, exists := sm.peerStates[sm.syncPeer]; exists {
+			state.syncCandidate = false
+		}
 	}
 
 	// Reset any header state before we choose our next active sync peer.
@@ -708,6 +886,21 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
 	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+
+	// Notify the caller which explicitly requested the block from the peer
+	// of the outcome, if any.
+	if done, exists := state.blockRequests[*blockHash]; exists {
+		delete(state.blockRequests, *blockHash)
+		switch {
+		case err != nil:
+			done <- err
+		case isOrphan:
+			done <- fmt.Errorf("block %v is an orphan", blockHash)
+		default:
+			done <- nil
+		}
+	}
+
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -829,6 +1022,41 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	prevHash := sm.nextCheckpoint.Hash
 	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
 	if sm.nextCheckpoint != nil {
+		// Use the headers up to the next checkpoint when they were
+		// already downloaded from another peer.  They are known to link
+		// to this checkpoint, so it is no longer needed in the list.
+		// Otherwise, the headers are requested from the sync peer and a
+		// download from another peer which is still in progress is
+		// abandoned.  The headers can only be added to the block index
+		// now that the checkpoint they build on is connected, so they
+		// are requested from the sync peer as well when that fails.
+		if r, exists := sm.headerRanges[prevHeight]; exists {
+			sm.removeHeaderRange(r)
+			var err error
+			if r.complete {
+				err = sm.processHeaderNodes(r.headers)
+				if err != nil {
+					log.Warnf("Unable to use downloaded "+
+						"block headers for blocks %d "+
+						"to %d: %v", prevHeight+1,
+						sm.nextCheckpoint.Height, err)
+				}
+			}
+			if r.complete && err == nil {
+				sm.headerList.Init()
+				for _, node := range r.headers {
+					sm.headerList.PushBack(node)
+				}
+				sm.startHeader = sm.headerList.Front()
+				log.Infof("Merged %d block headers for blocks "+
+					"%d to %d: Fetching blocks", len(r.headers),
+					prevHeight+1, sm.nextCheckpoint.Height)
+				sm.assignHeaderRanges()
+				sm.fetchHeaderBlocks()
+				return
+			}
+		}
+
 		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
 		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 		if err != nil {
@@ -847,6 +1075,9 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// from the block after this one up to the end of the chain (zero hash).
 	sm.headersFirstMode = false
 	sm.headerList.Init()
+	for _, r := range sm.headerRanges {
+		sm.removeHeaderRange(r)
+	}
 	log.Infof("Reached the final checkpoint -- switching to normal mode")
 	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
 	err = peer.PushGetBlocksMsg(locator, &zeroHash)
@@ -915,7 +1146,7 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
-	_, exists := sm.peerStates[peer]
+	state, exists := sm.peerStates[peer]
 	if !exists {
 		log.Warnf("Received headers message from unknown peer %s", peer)
 		return
@@ -931,45 +1162,69 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
+	// Headers which link to the header range the peer is downloading
+	// belong to that range.
+	if r := state.headerRange; r != nil && (numHeaders == 0 ||
+		r.connects(&msg.Headers[0].PrevBlock)) {
+
+		sm.handleHeaderRangeMsg(peer, r, msg.Headers)
+		return
+	}
+
 	// Nothing to do for an empty headers message.
 	if numHeaders == 0 {
 		return
 	}
 
+	// The headers of a range that was abandoned or has been requested from
+	// the sync peer in the mean time may still arrive from other peers.
+	if peer != sm.syncPeer {
+		log.Debugf("Ignoring %d headers from non-sync peer %s",
+			numHeaders, peer)
+		return
+	}
+
+	// Ensure there is a previous header to compare against.
+	prevNodeEl := sm.headerList.Back()
+	if prevNodeEl == nil {
+		log.Warnf("Header list does not contain a previous" +
+			"element as expected -- disconnecting peer")
+		peer.Disconnect()
+		return
+	}
+	prevNode := prevNodeEl.Value.(*headerNode)
+	workSum := sm.headerWork(prevNode)
+
 	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
+	// previous and that checkpoints match.  The headers are only added to
+	// the list of headers once all of them have been checked.
 	receivedCheckpoint := false
 	var finalHash *chainhash.Hash
+	nodes := make([]*headerNode, 0, numHeaders)
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
 		finalHash = &blockHash
 
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			peer.Disconnect()
-			return
-		}
-
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
+		// Ensure the header properly connects to the previous one.
+		if !prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
 			log.Warnf("Received block header that does not "+
 				"properly connect to the chain from peer %s "+
 				"-- disconnecting", peer.Addr())
 			peer.Disconnect()
 			return
 		}
+		node := &headerNode{
+			height: prevNode.height + 1,
+			hash:   &blockHash,
+			header: blockHeader,
+		}
+		if workSum != nil {
+			workSum = new(big.Int).Add(workSum,
+				blockchain.CalcWork(blockHeader.Bits))
+			node.workSum = workSum
+		}
+		nodes = append(nodes, node)
+		prevNode = node
 
 		// Verify the header at the next checkpoint height matches.
 		if node.height == sm.nextCheckpoint.Height {
@@ -992,6 +1247,41 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		}
 	}
 
+	// A peer with no more headers to send before reaching the checkpoint
+	// does not have the chain the checkpoint is part of.  Disconnect it
+	// without adding its headers when the chain it does have lacks the
+	// minimum chain work, since it is likely feeding a low difficulty
+	// chain.
+	minChainWork := sm.chain.MinimumChainWork()
+	if !receivedCheckpoint && numHeaders < wire.MaxBlockHeadersPerMsg &&
+		minChainWork != nil &&
+		(workSum == nil || workSum.Cmp(minChainWork) < 0) {
+
+		log.Warnf("Block headers from peer %s end at height %d with "+
+			"less than the minimum chain work -- disconnecting",
+			peer.Addr(), prevNode.height)
+		peer.Disconnect()
+		return
+	}
+
+	// Add the headers to the block index of the chain so decisions which
+	// depend on the header chain, such as skipping the scripts of blocks
+	// the assume valid block builds on, can be made while the blocks are
+	// connected.
+	if err := sm.processHeaderNodes(nodes); err != nil {
+		log.Warnf("Rejected block headers from peer %s: %v -- "+
+			"disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	for _, node := range nodes {
+		e := sm.headerList.PushBack(node)
+		if sm.startHeader == nil {
+			sm.startHeader = e
+		}
+	}
+
 	// When this header is a checkpoint, switch to fetching the blocks for
 	// all of the headers since the last checkpoint.
 	if receivedCheckpoint {
@@ -1019,6 +1309,125 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// processHeaderNodes adds the headers of the passed nodes to the block index of
+// the chain in order.  It returns the error of the first header the chain
+// rejects.
+func (sm *SyncManager) processHeaderNodes(nodes []*headerNode) error {
+	for _, node := range nodes {
+		err := sm.chain.ProcessBlockHeader(node.header, blockchain.BFNone)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headerWork returns the cumulative work of the chain up to and including the
+// passed header.  The work of headers the list of headers starts from is looked
+// up from the chain since they are either the best block or a checkpoint which
+// was already connected.  It returns nil when the work is not known.
+func (sm *SyncManager) headerWork(node *headerNode) *big.Int {
+	if node.workSum != nil {
+		return node.workSum
+	}
+	workSum, err := sm.chain.BlockChainWork(node.hash)
+	if err != nil {
+		log.Debugf("Unable to determine the chain work of header "+
+			"%v: %v", node.hash, err)
+		return nil
+	}
+	node.workSum = workSum
+	return workSum
+}
+
+// connects returns whether a header with the passed previous block hash links to
+// the headers received so far for the header range.
+func (r *headerRange) connects(prevHash *chainhash.Hash) bool {
+	if len(r.headers) == 0 {
+		return r.start.Hash.IsEqual(prevHash)
+	}
+	return r.headers[len(r.headers)-1].hash.IsEqual(prevHash)
+}
+
+// handleHeaderRangeMsg handles the block headers a peer sent for the header
+// range it is downloading.  The headers must link together starting from the
+// checkpoint the range builds on and end with the checkpoint which ends it.  The
+// next range is assigned to the peer once the range is complete.
+func (sm *SyncManager) handleHeaderRangeMsg(peer *peerpkg.Peer, r *headerRange,
+	headers []*wire.BlockHeader) {
+
+	// The peer does not know about the headers when it sends none, so give
+	// up on the range.  It is requested from the sync peer when it reaches
+	// the range.
+	if len(headers) == 0 {
+		log.Debugf("Peer %s sent no headers for blocks %d to %d", peer,
+			r.start.Height+1, r.end.Height)
+		sm.removeHeaderRange(r)
+		return
+	}
+
+	for _, blockHeader := range headers {
+		blockHash := blockHeader.BlockHash()
+		if !r.connects(&blockHeader.PrevBlock) {
+			log.Warnf("Received block header that does not "+
+				"properly connect to the chain from peer %s "+
+				"-- disconnecting", peer.Addr())
+			sm.removeHeaderRange(r)
+			peer.Disconnect()
+			return
+		}
+		node := &headerNode{
+			height: r.start.Height + 1,
+			hash:   &blockHash,
+			header: blockHeader,
+		}
+		if len(r.headers) > 0 {
+			node.height = r.headers[len(r.headers)-1].height + 1
+		}
+		r.headers = append(r.headers, node)
+
+		// Verify the header at the checkpoint height which ends the
+		// range matches.
+		if node.height == r.end.Height {
+			if !node.hash.IsEqual(r.end.Hash) {
+				log.Warnf("Block header at height %d/hash "+
+					"%s from peer %s does NOT match "+
+					"expected checkpoint hash of %s -- "+
+					"disconnecting", node.height,
+					node.hash, peer.Addr(), r.end.Hash)
+				sm.removeHeaderRange(r)
+				peer.Disconnect()
+				return
+			}
+			r.complete = true
+			break
+		}
+	}
+
+	// Request the next batch of headers when the range is not complete.
+	if !r.complete {
+		locator := blockchain.BlockLocator([]*chainhash.Hash{
+			r.headers[len(r.headers)-1].hash,
+		})
+		err := peer.PushGetHeadersMsg(locator, r.end.Hash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+
+	// The range is complete, so it no longer belongs to the peer which is
+	// then free to download the next one.
+	log.Infof("Verified downloaded block headers for blocks %d to %d "+
+		"from peer %s against checkpoint at height %d/hash %s",
+		r.start.Height+1, r.end.Height, peer.Addr(), r.end.Height,
+		r.end.Hash)
+	sm.peerStates[peer].headerRange = nil
+	r.peer = nil
+	sm.assignHeaderRanges()
+}
+
 // handleNotFoundMsg handles notfound messages from all peers.
 func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 	peer := nfmsg.peer
@@ -1038,6 +1447,11 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 				delete(state.requestedBlocks, inv.Hash)
 				delete(sm.requestedBlocks, inv.Hash)
 			}
+			if done, exists := state.blockRequests[inv.Hash]; exists {
+				delete(state.blockRequests, inv.Hash)
+				done <- fmt.Errorf("peer %s does not have block "+
+					"%v", peer, inv.Hash)
+			}
 
 		case wire.InvTypeWitnessTx:
 			fallthrough
@@ -1050,6 +1464,59 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 	}
 }
 
+// handleRequestBlockMsg requests the block with the passed hash from the
+// passed peer, regardless of whether or not the peer announced it, so it is
+// processed once the peer sends it.  It is invoked from the syncHandler
+// goroutine.
+func (sm *SyncManager) handleRequestBlockMsg(msg *requestBlockMsg) error {
+	state, exists := sm.peerStates[msg.peer]
+	if !exists {
+		return fmt.Errorf("peer %s is not connected", msg.peer)
+	}
+
+	have, err := sm.chain.HaveBlock(msg.hash)
+	if err != nil {
+		return err
+	}
+	if have {
+		return fmt.Errorf("block %v is already known", msg.hash)
+	}
+	if _, exists := state.blockRequests[*msg.hash]; exists {
+		return fmt.Errorf("block %v is already being requested from "+
+			"peer %s", msg.hash, msg.peer)
+	}
+
+	invType := wire.InvTypeBlock
+	if msg.peer.IsWitnessEnabled() {
+		invType = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(invType, msg.hash))
+	msg.peer.QueueMessage(gdmsg, nil)
+
+	state.requestedBlocks[*msg.hash] = struct{}{}
+	sm.requestedBlocks[*msg.hash] = struct{}{}
+	state.blockRequests[*msg.hash] = msg.done
+	return nil
+}
+
+// handleCancelBlockRequestMsg cancels the request for the block with the passed
+// hash from the passed peer made by handleRequestBlockMsg, so the block may be
+// requested again.  It is invoked from the syncHandler goroutine.
+func (sm *SyncManager) handleCancelBlockRequestMsg(msg *cancelBlockRequestMsg) {
+	state, exists := sm.peerStates[msg.peer]
+	if !exists {
+		return
+	}
+	if _, exists := state.blockRequests[*msg.hash]; !exists {
+		return
+	}
+
+	delete(state.blockRequests, *msg.hash)
+	delete(state.requestedBlocks, *msg.hash)
+	delete(sm.requestedBlocks, *msg.hash)
+}
+
 // haveInventory returns whether or not the inventory represented by the passed
 // inventory vector is known.  This includes checking all of the various places
 // inventory can be when it is in different states such as blocks that are part
@@ -1306,7 +1773,9 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 // important because the sync manager controls which blocks are needed and how
 // the fetching should proceed.
 func (sm *SyncManager) blockHandler() {
-	stallTicker := time.NewTicker(stallSampleInterval)
+	sampleInterval := sm.maxStallDuration /
+		(defaultMaxStallDuration / stallSampleInterval)
+	stallTicker := time.NewTicker(sampleInterval)
 	defer stallTicker.Stop()
 
 out:
@@ -1337,6 +1806,12 @@ out:
 			case *donePeerMsg:
 				sm.handleDonePeerMsg(msg.peer)
 
+			case *requestBlockMsg:
+				msg.reply <- sm.handleRequestBlockMsg(msg)
+
+			case *cancelBlockRequestMsg:
+				sm.handleCancelBlockRequestMsg(msg)
+
 			case getSyncPeerMsg:
 				var peerID int32
 				if sm.syncPeer != nil {
@@ -1344,6 +1819,9 @@ out:
 				}
 				msg.reply <- peerID
 
+			case getHeaderTipMsg:
+				msg.reply <- sm.headerTipHeight()
+
 			case processBlockMsg:
 				_, isOrphan, err := sm.chain.ProcessBlock(
 					msg.block, msg.flags)
@@ -1379,6 +1857,43 @@ out:
 		}
 	}
 
+	// Reply to the messages which were queued before shutting down without
+	// handling them so nothing is left waiting on them.  The block being
+	// handled when shutting down, if any, has already been fully processed.
+cleanup:
+	for {
+		select {
+		case m := <-sm.msgChan:
+			switch msg := m.(type) {
+			case *txMsg:
+				msg.reply <- struct{}{}
+
+			case *blockMsg:
+				msg.reply <- struct{}{}
+
+			case *requestBlockMsg:
+				msg.reply <- fmt.Errorf("sync manager is shutting down")
+
+			case getSyncPeerMsg:
+				msg.reply <- 0
+
+			case getHeaderTipMsg:
+				msg.reply <- sm.chain.BestSnapshot().Height
+
+			case processBlockMsg:
+				msg.reply <- processBlockResponse{
+					err: fmt.Errorf("sync manager is shutting down"),
+				}
+
+			case isCurrentMsg:
+				msg.reply <- false
+			}
+
+		default:
+			break cleanup
+		}
+	}
+
 	sm.wg.Done()
 	log.Trace("Block handler done")
 }
@@ -1553,6 +2068,42 @@ func (sm *SyncManager) DonePeer(peer *peerpkg.Peer) {
 	sm.msgChan <- &donePeerMsg{peer: peer}
 }
 
+// RequestBlock requests the block with the passed hash from the passed peer
+// even when it was not announced by the peer.  An error is returned when the
+// peer is unknown or the block is already known.  Otherwise, the returned
+// channel receives the result of processing the block once the peer sends it,
+// or an error when the peer does not have it or disconnects first.
+func (sm *SyncManager) RequestBlock(hash *chainhash.Hash, peer *peerpkg.Peer) (<-chan error, error) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return nil, fmt.Errorf("sync manager is shutting down")
+	}
+
+	reply := make(chan error, 1)
+	done := make(chan error, 1)
+	sm.msgChan <- &requestBlockMsg{
+		hash:  hash,
+		peer:  peer,
+		reply: reply,
+		done:  done,
+	}
+	if err := <-reply; err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// CancelBlockRequest cancels the request for the block with the passed hash
+// from the passed peer made via RequestBlock when the caller is no longer
+// waiting for it, so the block may be requested again.
+func (sm *SyncManager) CancelBlockRequest(hash *chainhash.Hash, peer *peerpkg.Peer) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &cancelBlockRequestMsg{hash: hash, peer: peer}
+}
+
 // Start begins the core block handler which processes block and inv messages.
 func (sm *SyncManager) Start() {
 	// Already started?
@@ -1587,6 +2138,14 @@ func (sm *SyncManager) SyncPeerID() int32 {
 	return <-reply
 }
 
+// HeaderTipHeight returns the height of the best known header, which is ahead
+// of the best chain tip while the blocks of downloaded headers are fetched.
+func (sm *SyncManager) HeaderTipHeight() int32 {
+	reply := make(chan int32)
+	sm.msgChan <- getHeaderTipMsg{reply: reply}
+	return <-reply
+}
+
 // ProcessBlock makes use of ProcessBlock on an internal instance of a block
 // chain.
 func (sm *SyncManager) ProcessBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
@@ -1618,19 +2177,28 @@ func (sm *SyncManager) Pause() chan<- struct{} {
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
 	sm := SyncManager{
-		peerNotifier:    config.PeerNotifier,
-		chain:           config.Chain,
-		txMemPool:       config.TxMemPool,
-		chainParams:     config.ChainParams,
-		rejectedTxns:    make(map[chainhash.Hash]struct{}),
-		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
-		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
-		progressLogger:  newBlockProgressLogger("Processed", log),
-		msgChan:         make(chan interface{}, config.MaxPeers*3),
-		headerList:      list.New(),
-		quit:            make(chan struct{}),
-		feeEstimator:    config.FeeEstimator,
+		peerNotifier:     config.PeerNotifier,
+		chain:            config.Chain,
+		txMemPool:        config.TxMemPool,
+		chainParams:      config.ChainParams,
+		rejectedTxns:     make(map[chainhash.Hash]struct{}),
+		requestedTxns:    make(map[chainhash.Hash]struct{}),
+		requestedBlocks:  make(map[chainhash.Hash]struct{}),
+		peerStates:       make(map[*peerpkg.Peer]*peerSyncState),
+		progressLogger:   newBlockProgressLogger("Processed", log),
+		msgChan:          make(chan interface{}, config.MaxPeers*3),
+		headerList:       list.New(),
+		headerRanges:     make(map[int32]*headerRange),
+		quit:             make(chan struct{}),
+		feeEstimator:     config.FeeEstimator,
+		maxStallDuration: config.MaxStallDuration,
+	}
+	if sm.maxStallDuration == 0 {
+		sm.maxStallDuration = defaultMaxStallDuration
+	}
+	if sm.maxStallDuration < minMaxStallDuration {
+		return nil, fmt.Errorf("max stall duration %v is less than the "+
+			"minimum of %v", sm.maxStallDuration, minMaxStallDuration)
 	}
 
 	best := sm.chain.BestSnapshot()
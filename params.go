@@ -48,6 +48,14 @@ var testNet3Params = params{
 	rpcPort: "18334",
 }
 
+// testNet4Params contains parameters specific to the test network (version 4)
+// (wire.TestNet4).  NOTE: The RPC port is intentionally different than the
+// reference implementation - see the mainNetParams comment for details.
+var testNet4Params = params{
+	Params:  &chaincfg.TestNet4Params,
+	rpcPort: "48334",
+}
+
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
@@ -247,7 +247,8 @@ type Config struct {
 
 	// UserAgentComments specify the user agent comments to advertise.  These
 	// values must not contain the illegal characters specified in BIP 14:
-	// '/', ':', '(', ')'.
+	// '/', ':', '(', ')'.  The protocol negotiation fails when they contain
+	// such characters or make the user agent exceed wire.MaxUserAgentLen.
 	UserAgentComments []string
 
 	// ChainParams identifies which chain parameters the peer is associated
@@ -1486,6 +1487,11 @@ out:
 				p.cfg.Listeners.OnCFHeaders(p, msg)
 			}
 
+		case *wire.MsgCFCheckpt:
+			if p.cfg.Listeners.OnCFCheckpt != nil {
+				p.cfg.Listeners.OnCFCheckpt(p, msg)
+			}
+
 		case *wire.MsgFeeFilter:
 			if p.cfg.Listeners.OnFeeFilter != nil {
 				p.cfg.Listeners.OnFeeFilter(p, msg)
@@ -2052,8 +2058,11 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 
 	// Version message.
 	msg := wire.NewMsgVersion(ourNA, theirNA, nonce, blockNum)
-	msg.AddUserAgent(p.cfg.UserAgentName, p.cfg.UserAgentVersion,
+	err := msg.AddUserAgent(p.cfg.UserAgentName, p.cfg.UserAgentVersion,
 		p.cfg.UserAgentComments...)
+	if err != nil {
+		return nil, err
+	}
 
 	// Advertise local services.
 	msg.Services = p.cfg.Services
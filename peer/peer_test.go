@@ -10,6 +10,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -354,6 +355,103 @@ func TestPeerConnection(t *testing.T) {
 	}
 }
 
+// TestUserAgentComments ensures the user agent advertised during the handshake
+// includes the configured comments and that the handshake fails when they are
+// invalid or too long.
+func TestUserAgentComments(t *testing.T) {
+	tests := []struct {
+		name          string
+		comments      []string
+		wantUserAgent string
+	}{
+		{
+			name:     "valid comments",
+			comments: []string{"first", "second"},
+			wantUserAgent: wire.DefaultUserAgent +
+				"peer:1.0(first; second)/",
+		},
+		{
+			name:     "invalid comment",
+			comments: []string{"not:valid"},
+		},
+		{
+			name:     "oversized comment",
+			comments: []string{strings.Repeat("c", wire.MaxUserAgentLen)},
+		},
+	}
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		inCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+			TrickleInterval:  time.Second * 10,
+		}
+		outCfg := &peer.Config{
+			Listeners:         inCfg.Listeners,
+			UserAgentName:     "peer",
+			UserAgentVersion:  "1.0",
+			UserAgentComments: test.comments,
+			ChainParams:       &chaincfg.MainNetParams,
+			TrickleInterval:   time.Second * 10,
+		}
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err: %v",
+				test.name, err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		if test.wantUserAgent == "" {
+			// The outbound peer must disconnect without sending its
+			// version.
+			disconnected := make(chan struct{})
+			go func() {
+				outPeer.WaitForDisconnect()
+				close(disconnected)
+			}()
+			select {
+			case <-disconnected:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: outbound peer not disconnected",
+					test.name)
+			}
+			if inPeer.VersionKnown() {
+				t.Fatalf("%s: unexpected version received",
+					test.name)
+			}
+			inPeer.Disconnect()
+			continue
+		}
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+		if got := inPeer.UserAgent(); got != test.wantUserAgent {
+			t.Fatalf("%s: unexpected user agent - got %q, want %q",
+				test.name, got, test.wantUserAgent)
+		}
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+	}
+}
+
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
@@ -417,6 +515,9 @@ func TestPeerListeners(t *testing.T) {
 			OnCFHeaders: func(p *peer.Peer, msg *wire.MsgCFHeaders) {
 				ok <- msg
 			},
+			OnCFCheckpt: func(p *peer.Peer, msg *wire.MsgCFCheckpt) {
+				ok <- msg
+			},
 			OnFeeFilter: func(p *peer.Peer, msg *wire.MsgFeeFilter) {
 				ok <- msg
 			},
@@ -563,6 +664,11 @@ func TestPeerListeners(t *testing.T) {
 			"OnCFHeaders",
 			wire.NewMsgCFHeaders(),
 		},
+		{
+			"OnCFCheckpt",
+			wire.NewMsgCFCheckpt(wire.GCSFilterRegular,
+				&chainhash.Hash{}, 0),
+		},
 		{
 			"OnFeeFilter",
 			wire.NewMsgFeeFilter(15000),
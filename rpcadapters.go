@@ -7,8 +7,10 @@ package main
 import (
 	"sync/atomic"
 
+	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
@@ -61,6 +63,23 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// ConnectionType returns the name of the type of the connection to the peer.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) ConnectionType() string {
+	return (*serverPeer)(p).connType.String()
+}
+
+// IsManual returns whether or not the connection to the peer was requested by
+// the user.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) IsManual() bool {
+	return (*serverPeer)(p).connType == connTypeManual
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -181,22 +200,13 @@ func (cm *rpcConnManager) ConnectedPeers() []rpcserverPeer {
 	return peers
 }
 
-// PersistentPeers returns an array consisting of all the added persistent
-// peers.
+// AddedNodes returns the connection requests of all the persistent (added)
+// peers regardless of whether or not they are currently connected.
 //
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
-func (cm *rpcConnManager) PersistentPeers() []rpcserverPeer {
-	replyChan := make(chan []*serverPeer)
-	cm.server.query <- getAddedNodesMsg{reply: replyChan}
-	serverPeers := <-replyChan
-
-	// Convert to generic peers.
-	peers := make([]rpcserverPeer, 0, len(serverPeers))
-	for _, sp := range serverPeers {
-		peers = append(peers, (*rpcPeer)(sp))
-	}
-	return peers
+func (cm *rpcConnManager) AddedNodes() []*connmgr.ConnReq {
+	return cm.server.connManager.PermanentConnReqs()
 }
 
 // BroadcastMessage sends the provided message to all currently connected peers.
@@ -232,6 +242,32 @@ func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddress {
 	return cm.server.addrManager.AddressCache()
 }
 
+// TableAddresses returns the addresses of the new and tried tables of the
+// address manager along with their buckets.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) TableAddresses() []addrmgr.TableAddress {
+	return cm.server.addrManager.TableAddresses()
+}
+
+// Services returns the service flags the server advertises to its peers.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) Services() wire.ServiceFlag {
+	return cm.server.services
+}
+
+// LocalAddresses returns the local addresses the server knows about along with
+// their scores as candidates to advertise to peers.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) LocalAddresses() []addrmgr.LocalAddressInfo {
+	return cm.server.addrManager.LocalAddresses()
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
@@ -277,6 +313,14 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 	return b.syncMgr.SyncPeerID()
 }
 
+// HeaderTipHeight returns the height of the best known header.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) HeaderTipHeight() int32 {
+	return b.syncMgr.HeaderTipHeight()
+}
+
 // LocateBlocks returns the hashes of the blocks after the first known block in
 // the provided locators until the provided stop hash or the current tip is
 // reached, up to a max of wire.MaxBlockHeadersPerMsg hashes.
@@ -286,3 +330,22 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 func (b *rpcSyncMgr) LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader {
 	return b.server.chain.LocateHeaders(locators, hashStop)
 }
+
+// RequestBlock requests the block with the provided hash from the provided
+// peer.  The returned channel receives the result of processing the block once
+// the peer sends it.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) RequestBlock(hash *chainhash.Hash, p *peer.Peer) (<-chan error, error) {
+	return b.syncMgr.RequestBlock(hash, p)
+}
+
+// CancelBlockRequest cancels the request for the block with the provided hash
+// from the provided peer made via RequestBlock.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) CancelBlockRequest(hash *chainhash.Hash, p *peer.Peer) {
+	b.syncMgr.CancelBlockRequest(hash, p)
+}
@@ -6,7 +6,9 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
@@ -16,23 +18,28 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
@@ -75,6 +82,15 @@ const (
 
 	// maxProtocolVersion is the max protocol version the server supports.
 	maxProtocolVersion = 70002
+
+	// scanBlockFiltersBatchSize is the number of committed filters the
+	// scanblockfilters RPC matches per database transaction.
+	scanBlockFiltersBatchSize = 1000
+
+	// maxGetBlockHashesCount is the maximum number of block hashes the
+	// getblockhashes RPC returns per request.  It matches the maximum
+	// number of headers peers are served per request.
+	maxGetBlockHashesCount = wire.MaxBlockHeadersPerMsg
 )
 
 var (
@@ -86,21 +102,24 @@ var (
 		"time", "transactions/add", "prevblock", "coinbase/append",
 	}
 
-	// gbtCoinbaseAux describes additional data that miners should include
-	// in the coinbase signature script.  It is declared here to avoid the
-	// overhead of creating a new object on every invocation for constant
-	// data.
-	gbtCoinbaseAux = &btcjson.GetBlockTemplateResultAux{
-		Flags: hex.EncodeToString(builderScript(txscript.
-			NewScriptBuilder().
-			AddData([]byte(mining.CoinbaseFlags)))),
-	}
-
 	// gbtCapabilities describes additional capabilities returned with a
 	// block template generated by the getblocktemplate RPC.    It is
 	// declared here to avoid the overhead of creating the slice on every
 	// invocation for constant data.
 	gbtCapabilities = []string{"proposal"}
+
+	// gbtRequiredRules houses the names of the soft-fork rules which change
+	// the structure of blocks, so clients of the getblocktemplate RPC must
+	// understand them to create valid blocks once they are active.  They
+	// are prefixed with '!' in the rules of block templates as described
+	// by BIP 0009.
+	gbtRequiredRules = map[string]struct{}{
+		"segwit": {},
+	}
+
+	// getBlockFromPeerTimeout is the maximum amount of time the
+	// getblockfrompeer RPC waits for the peer to send the requested block.
+	getBlockFromPeerTimeout = time.Minute
 )
 
 // Errors
@@ -118,6 +137,15 @@ var (
 		Code:    btcjson.ErrRPCNoWallet,
 		Message: "This implementation does not implement wallet commands",
 	}
+
+	// ErrRPCNotWhitelisted is an error returned to RPC clients when the
+	// authenticated user has a method whitelist configured and the
+	// requested method is not part of it.  HTTP clients receive it along
+	// with a 403 Forbidden status.
+	ErrRPCNotWhitelisted = &btcjson.RPCError{
+		Code:    btcjson.ErrRPCNotWhitelisted,
+		Message: "user not whitelisted for this method",
+	}
 )
 
 type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{}, error)
@@ -127,54 +155,79 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 // a dependency loop.
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
-	"addnode":                handleAddNode,
-	"createrawtransaction":   handleCreateRawTransaction,
-	"debuglevel":             handleDebugLevel,
-	"decoderawtransaction":   handleDecodeRawTransaction,
-	"decodescript":           handleDecodeScript,
-	"estimatefee":            handleEstimateFee,
-	"generate":               handleGenerate,
-	"getaddednodeinfo":       handleGetAddedNodeInfo,
-	"getbestblock":           handleGetBestBlock,
-	"getbestblockhash":       handleGetBestBlockHash,
-	"getblock":               handleGetBlock,
-	"getblockchaininfo":      handleGetBlockChainInfo,
-	"getblockcount":          handleGetBlockCount,
-	"getblockhash":           handleGetBlockHash,
-	"getblockheader":         handleGetBlockHeader,
-	"getblocktemplate":       handleGetBlockTemplate,
-	"getcfilter":             handleGetCFilter,
-	"getcfilterheader":       handleGetCFilterHeader,
-	"getconnectioncount":     handleGetConnectionCount,
-	"getcurrentnet":          handleGetCurrentNet,
-	"getdifficulty":          handleGetDifficulty,
-	"getgenerate":            handleGetGenerate,
-	"gethashespersec":        handleGetHashesPerSec,
-	"getheaders":             handleGetHeaders,
-	"getinfo":                handleGetInfo,
-	"getmempoolinfo":         handleGetMempoolInfo,
-	"getmininginfo":          handleGetMiningInfo,
-	"getnettotals":           handleGetNetTotals,
-	"getnetworkhashps":       handleGetNetworkHashPS,
-	"getnodeaddresses":       handleGetNodeAddresses,
-	"getpeerinfo":            handleGetPeerInfo,
-	"getrawmempool":          handleGetRawMempool,
-	"getrawtransaction":      handleGetRawTransaction,
-	"gettxout":               handleGetTxOut,
-	"help":                   handleHelp,
-	"node":                   handleNode,
-	"ping":                   handlePing,
-	"searchrawtransactions":  handleSearchRawTransactions,
-	"sendrawtransaction":     handleSendRawTransaction,
-	"setgenerate":            handleSetGenerate,
-	"signmessagewithprivkey": handleSignMessageWithPrivKey,
-	"stop":                   handleStop,
-	"submitblock":            handleSubmitBlock,
-	"uptime":                 handleUptime,
-	"validateaddress":        handleValidateAddress,
-	"verifychain":            handleVerifyChain,
-	"verifymessage":          handleVerifyMessage,
-	"version":                handleVersion,
+	"addnode":                   handleAddNode,
+	"combinerawtransaction":     handleCombineRawTransaction,
+	"createrawtransaction":      handleCreateRawTransaction,
+	"debuglevel":                handleDebugLevel,
+	"decoderawtransaction":      handleDecodeRawTransaction,
+	"decodescript":              handleDecodeScript,
+	"dumptxoutset":              handleDumpTxOutSet,
+	"estimatefee":               handleEstimateFee,
+	"estimatesmartfee":          handleEstimateSmartFee,
+	"generate":                  handleGenerate,
+	"generatetoaddress":         handleGenerateToAddress,
+	"getaddednodeinfo":          handleGetAddedNodeInfo,
+	"getbestblock":              handleGetBestBlock,
+	"getbestblockhash":          handleGetBestBlockHash,
+	"getblock":                  handleGetBlock,
+	"getblockchaininfo":         handleGetBlockChainInfo,
+	"getblockcount":             handleGetBlockCount,
+	"getblockfrompeer":          handleGetBlockFromPeer,
+	"getblockhash":              handleGetBlockHash,
+	"getblockhashbytime":        handleGetBlockHashByTime,
+	"getblockhashes":            handleGetBlockHashes,
+	"getblockheader":            handleGetBlockHeader,
+	"getblocktemplate":          handleGetBlockTemplate,
+	"getcfilter":                handleGetCFilter,
+	"getcfilterheader":          handleGetCFilterHeader,
+	"getcfilters":               handleGetCFilters,
+	"getchainstates":            handleGetChainStates,
+	"getconnectioncount":        handleGetConnectionCount,
+	"getcurrentnet":             handleGetCurrentNet,
+	"getdifficulty":             handleGetDifficulty,
+	"getgenerate":               handleGetGenerate,
+	"gethashespersec":           handleGetHashesPerSec,
+	"getheaders":                handleGetHeaders,
+	"getindexinfo":              handleGetIndexInfo,
+	"getinfo":                   handleGetInfo,
+	"getmemoryinfo":             handleGetMemoryInfo,
+	"getmempoolinfo":            handleGetMempoolInfo,
+	"getmininginfo":             handleGetMiningInfo,
+	"getnettotals":              handleGetNetTotals,
+	"getnetworkhashps":          handleGetNetworkHashPS,
+	"getnetworkinfo":            handleGetNetworkInfo,
+	"getnodeaddresses":          handleGetNodeAddresses,
+	"getpeerinfo":               handleGetPeerInfo,
+	"getrawaddrman":             handleGetRawAddrMan,
+	"getrawmempool":             handleGetRawMempool,
+	"getrawtransaction":         handleGetRawTransaction,
+	"getspentinfo":              handleGetSpentInfo,
+	"gettxout":                  handleGetTxOut,
+	"gettxoutsetinfo":           handleGetTxOutSetInfo,
+	"help":                      handleHelp,
+	"loadmempool":               handleLoadMempool,
+	"matchfilter":               handleMatchFilter,
+	"node":                      handleNode,
+	"ping":                      handlePing,
+	"prioritisetransaction":     handlePrioritiseTransaction,
+	"savemempool":               handleSaveMempool,
+	"scanblockfilters":          handleScanBlockFilters,
+	"searchrawtransactions":     handleSearchRawTransactions,
+	"sendrawtransaction":        handleSendRawTransaction,
+	"setgenerate":               handleSetGenerate,
+	"signmessagewithprivkey":    handleSignMessageWithPrivKey,
+	"signrawtransactionwithkey": handleSignRawTransactionWithKey,
+	"stop":                      handleStop,
+	"submitblock":               handleSubmitBlock,
+	"testmempoolaccept":         handleTestMempoolAccept,
+	"uptime":                    handleUptime,
+	"validateaddress":           handleValidateAddress,
+	"verifychain":               handleVerifyChain,
+	"verifymessage":             handleVerifyMessage,
+	"version":                   handleVersion,
+	"waitforblock":              handleWaitForBlock,
+	"waitforblockheight":        handleWaitForBlockHeight,
+	"waitfornewblock":           handleWaitForNewBlock,
 }
 
 // list of commands that we recognize, but for which btcd has no support because
@@ -197,7 +250,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":   {},
 	"getreceivedbyaddress":   {},
 	"gettransaction":         {},
-	"gettxoutsetinfo":        {},
 	"getunconfirmedbalance":  {},
 	"getwalletinfo":          {},
 	"importprivkey":          {},
@@ -230,7 +282,6 @@ var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
 	"getchaintips":     {},
 	"getmempoolentry":  {},
-	"getnetworkinfo":   {},
 	"getwork":          {},
 	"invalidateblock":  {},
 	"preciousblock":    {},
@@ -257,26 +308,35 @@ var rpcLimited = map[string]struct{}{
 	"decoderawtransaction":  {},
 	"decodescript":          {},
 	"estimatefee":           {},
+	"estimatesmartfee":      {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
 	"getblockhash":          {},
+	"getblockhashbytime":    {},
+	"getblockhashes":        {},
 	"getblockheader":        {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
+	"getcfilters":           {},
 	"getcurrentnet":         {},
 	"getdifficulty":         {},
 	"getheaders":            {},
+	"getindexinfo":          {},
 	"getinfo":               {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
+	"getspentinfo":          {},
 	"gettxout":              {},
+	"matchfilter":           {},
+	"scanblockfilters":      {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"testmempoolaccept":     {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
@@ -335,16 +395,30 @@ type gbtWorkState struct {
 	prevHash      *chainhash.Hash
 	minTimestamp  time.Time
 	template      *mining.BlockTemplate
+	rules         []string
+	vbAvailable   map[string]uint32
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+
+	// coinbaseAux describes additional data that miners should include in
+	// the coinbase signature script.  It is created along with the state
+	// to avoid the overhead of creating a new object on every invocation
+	// for constant data.
+	coinbaseAux *btcjson.GetBlockTemplateResultAux
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
-// fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+// fields initialized and ready to use.  The passed coinbase flags are the data
+// miners are asked to include in the coinbase signature script.
+func newGbtWorkState(timeSource blockchain.MedianTimeSource, coinbaseFlags string) *gbtWorkState {
 	return &gbtWorkState{
 		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
 		timeSource: timeSource,
+		coinbaseAux: &btcjson.GetBlockTemplateResultAux{
+			Flags: hex.EncodeToString(builderScript(txscript.
+				NewScriptBuilder().
+				AddData([]byte(coinbaseFlags)))),
+		},
 	}
 }
 
@@ -510,6 +584,79 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleCombineRawTransaction handles combinerawtransaction commands.
+func handleCombineRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.CombineRawTransactionCmd)
+	if len(c.Txs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Missing transactions",
+		}
+	}
+
+	// unsignedHash returns the hash of the passed transaction without any
+	// signatures, which is the same for all of the transactions that are
+	// combined.
+	unsignedHash := func(tx *wire.MsgTx) chainhash.Hash {
+		unsigned := tx.Copy()
+		for _, txIn := range unsigned.TxIn {
+			txIn.SignatureScript = nil
+			txIn.Witness = nil
+		}
+		return unsigned.TxHash()
+	}
+
+	txns := make([]*wire.MsgTx, 0, len(c.Txs))
+	for _, hexStr := range c.Txs {
+		mtx, err := decodeRawTx(hexStr)
+		if err != nil {
+			return nil, err
+		}
+		if len(txns) > 0 && unsignedHash(mtx) != unsignedHash(txns[0]) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Transactions differ in more than their signatures",
+			}
+		}
+		txns = append(txns, mtx)
+	}
+
+	// The scripts of the spent outputs determine how the signatures are
+	// combined.
+	merged := txns[0]
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	if err := fetchSpentOutputs(s, merged, prevOuts); err != nil {
+		return nil, err
+	}
+	for i, txIn := range merged.TxIn {
+		prevOut, ok := prevOuts[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCVerify,
+				Message: "Input not found or already spent",
+			}
+		}
+
+		for _, tx := range txns[1:] {
+			txIn.SignatureScript = txscript.MergeSignatureScripts(
+				s.cfg.ChainParams, merged, i, prevOut.PkScript,
+				txIn.SignatureScript, tx.TxIn[i].SignatureScript)
+
+			// Witnesses are only combined for inputs with a single
+			// signature, so the one with the most items wins.
+			if len(tx.TxIn[i].Witness) > len(txIn.Witness) {
+				txIn.Witness = tx.TxIn[i].Witness
+			}
+		}
+	}
+
+	mergedHex, err := messageToHex(merged)
+	if err != nil {
+		return nil, err
+	}
+	return mergedHex, nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
@@ -776,6 +923,41 @@ func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
 	return txReply, nil
 }
 
+// addTxRawResultPrevOuts adds the details of the outputs spent by the passed
+// non-coinbase transaction to the inputs of the passed raw transaction JSON
+// object along with the fee paid by the transaction.  The passed map must
+// contain the outputs spent by all of the inputs of the transaction.
+func addTxRawResultPrevOuts(txReply *btcjson.TxRawResult, mtx *wire.MsgTx,
+	originOutputs map[wire.OutPoint]wire.TxOut, chainParams *chaincfg.Params) {
+
+	var totalIn, totalOut int64
+	for i, txIn := range mtx.TxIn {
+		originTxOut := originOutputs[txIn.PreviousOutPoint]
+		totalIn += originTxOut.Value
+
+		// Ignore the error here since an error means the script
+		// couldn't parse and there is no additional information about
+		// it anyways.
+		_, addrs, _, _ := txscript.ExtractPkScriptAddrs(
+			originTxOut.PkScript, chainParams)
+		encodedAddrs := make([]string, len(addrs))
+		for j, addr := range addrs {
+			encodedAddrs[j] = addr.EncodeAddress()
+		}
+
+		txReply.Vin[i].PrevOut = &btcjson.PrevOut{
+			Addresses: encodedAddrs,
+			Value:     btcutil.Amount(originTxOut.Value).ToBTC(),
+		}
+	}
+	for _, txOut := range mtx.TxOut {
+		totalOut += txOut.Value
+	}
+
+	fee := btcutil.Amount(totalIn - totalOut).ToBTC()
+	txReply.Fee = &fee
+}
+
 // handleDecodeRawTransaction handles decoderawtransaction commands.
 func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeRawTransactionCmd)
@@ -799,9 +981,13 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	}
 
 	// Create and return the result.
+	tx := btcutil.NewTx(&mtx)
 	txReply := btcjson.TxRawDecodeResult{
 		Txid:     mtx.TxHash().String(),
 		Version:  mtx.Version,
+		Size:     int32(mtx.SerializeSize()),
+		Vsize:    int32(mempool.GetTxVirtualSize(tx)),
+		Weight:   int32(blockchain.GetTransactionWeight(tx)),
 		Locktime: mtx.LockTime,
 		Vin:      createVinList(&mtx),
 		Vout:     createVoutList(&mtx, s.cfg.ChainParams, nil),
@@ -854,9 +1040,80 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	if scriptClass != txscript.ScriptHashTy {
 		reply.P2sh = p2sh.EncodeAddress()
 	}
+
+	// Also convert the script to a pay-to-witness-script-hash address
+	// unless it can't be used as a witness script since it already is a
+	// script hash or witness program.
+	if scriptClass != txscript.ScriptHashTy &&
+		!txscript.IsWitnessProgram(script) {
+
+		scriptHash := sha256.Sum256(script)
+		p2wsh, err := btcutil.NewAddressWitnessScriptHash(scriptHash[:],
+			s.cfg.ChainParams)
+		if err != nil {
+			context := "Failed to convert script to " +
+				"pay-to-witness-script-hash"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		reply.P2wsh = p2wsh.EncodeAddress()
+	}
 	return reply, nil
 }
 
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DumpTxOutSetCmd)
+
+	// Relative paths are relative to the data directory.  An existing file
+	// is never overwritten.
+	path := c.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: path + " already exists",
+		}
+	}
+
+	// Write the snapshot to a temporary file first so a partial snapshot is
+	// never left at the requested path.  Dumping the utxo set can take a
+	// long time, so abort it when the client goes away.
+	tmpPath := path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		context := "Failed to create utxo snapshot file"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	w := bufio.NewWriter(f)
+	stats, err := s.cfg.Chain.DumpUtxoSnapshot(w, closeChan)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		context := "Failed to dump utxo set"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	rpcsLog.Infof("Dumped %d coins at block %v (height %d) to %s",
+		stats.Outputs, stats.Hash, stats.Height, path)
+	return &btcjson.DumpTxOutSetResult{
+		CoinsWritten: stats.Outputs,
+		BaseHash:     stats.Hash.String(),
+		BaseHeight:   stats.Height,
+		Path:         path,
+		TxOutSetHash: stats.SerializedHash.String(),
+	}, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.EstimateFeeCmd)
@@ -879,6 +1136,63 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return float64(feeRate), nil
 }
 
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	if s.cfg.FeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Parameter conf_target must be positive",
+		}
+	}
+
+	// Estimates are conservative unless an economical one is requested.
+	conservative := true
+	if c.EstimateMode != nil {
+		switch *c.EstimateMode {
+		case btcjson.EstimateModeUnset, btcjson.EstimateModeConservative:
+		case btcjson.EstimateModeEconomical:
+			conservative = false
+		default:
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid estimate_mode parameter",
+			}
+		}
+	}
+
+	// The fee estimator limits the number of blocks it estimates fees for
+	// on its own, so only ensure the target fits.
+	confTarget := uint32(math.MaxUint32)
+	if c.ConfTarget < math.MaxUint32 {
+		confTarget = uint32(c.ConfTarget)
+	}
+
+	feeRate, blocks, err := s.cfg.FeeEstimator.EstimateSmartFee(confTarget,
+		conservative)
+	if err != nil {
+		return &btcjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+		}, nil
+	}
+	if feeRate == -1 {
+		return &btcjson.EstimateSmartFeeResult{
+			Errors: []string{"Insufficient data or no feerate found"},
+		}, nil
+	}
+
+	rate := float64(feeRate)
+	return &btcjson.EstimateSmartFeeResult{
+		FeeRate: &rate,
+		Blocks:  int64(blocks),
+	}, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -892,8 +1206,8 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	}
 
 	// Respond with an error if there's virtually 0 chance of mining a block
-	// with the CPU.
-	if !s.cfg.ChainParams.GenerateSupported {
+	// with the CPU unless it was explicitly allowed.
+	if !s.cfg.ChainParams.GenerateSupported && !cfg.AllowGenerate {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCDifficulty,
 			Message: fmt.Sprintf("No support for `generate` on "+
@@ -933,20 +1247,87 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
+// handleGenerateToAddress handles generatetoaddress commands.
+func handleGenerateToAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Respond with an error if there's virtually 0 chance of mining a block
+	// with the CPU unless it was explicitly allowed.
+	params := s.cfg.ChainParams
+	if !params.GenerateSupported && !cfg.AllowGenerate {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCDifficulty,
+			Message: fmt.Sprintf("No support for `generatetoaddress` "+
+				"on the current network, %s, as it's unlikely to "+
+				"be possible to mine a block with the CPU.  Use "+
+				"--allowgenerate to override.", params.Net),
+		}
+	}
+
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+	if c.NumBlocks <= 0 || c.NumBlocks > math.MaxUint32 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Please request a nonzero number of blocks to generate.",
+		}
+	}
+	maxTries := int64(1000000)
+	if c.MaxTries != nil {
+		maxTries = *c.MaxTries
+	}
+	if maxTries <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The maximum number of tries must be positive",
+		}
+	}
+
+	// Ensure the address is valid for the network the server is on.
+	addr, err := btcutil.DecodeAddress(c.Address, params)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	if !addr.IsForNet(params) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + c.Address +
+				" is for the wrong network",
+		}
+	}
+
+	blockHashes, err := s.cfg.CPUMiner.GenerateNBlocksToAddress(
+		uint32(c.NumBlocks), addr, uint64(maxTries))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	reply := make([]string, 0, len(blockHashes))
+	for _, hash := range blockHashes {
+		reply = append(reply, hash.String())
+	}
+	return reply, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
 
-	// Retrieve a list of persistent (added) peers from the server and
-	// filter the list of peers per the specified address (if any).
-	peers := s.cfg.ConnMgr.PersistentPeers()
+	// Retrieve a list of persistent (added) nodes, including the ones that
+	// are not connected yet, from the connection manager and filter the
+	// list of nodes per the specified address (if any).
+	nodes := s.cfg.ConnMgr.AddedNodes()
 	if c.Node != nil {
 		node := *c.Node
 		found := false
-		for i, peer := range peers {
-			if peer.ToPeer().Addr() == node {
-				peers = peers[i : i+1]
+		for i, connReq := range nodes {
+			if connReq.Addr.String() == node {
+				nodes = nodes[i : i+1]
 				found = true
+				break
 			}
 		}
 		if !found {
@@ -960,30 +1341,31 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	// Without the dns flag, the result is just a slice of the addresses as
 	// strings.
 	if !c.DNS {
-		results := make([]string, 0, len(peers))
-		for _, peer := range peers {
-			results = append(results, peer.ToPeer().Addr())
+		results := make([]string, 0, len(nodes))
+		for _, connReq := range nodes {
+			results = append(results, connReq.Addr.String())
 		}
 		return results, nil
 	}
 
 	// With the dns flag, the result is an array of JSON objects which
-	// include the result of DNS lookups for each peer.
-	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(peers))
-	for _, rpcPeer := range peers {
-		// Set the "address" of the peer which could be an ip address
+	// include the result of DNS lookups for each node.
+	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(nodes))
+	for _, connReq := range nodes {
+		// Set the "address" of the node which could be an ip address
 		// or a domain name.
-		peer := rpcPeer.ToPeer()
+		nodeAddr := connReq.Addr.String()
+		connected := connReq.State() == connmgr.ConnEstablished
 		var result btcjson.GetAddedNodeInfoResult
-		result.AddedNode = peer.Addr()
-		result.Connected = btcjson.Bool(peer.Connected())
+		result.AddedNode = nodeAddr
+		result.Connected = btcjson.Bool(connected)
 
 		// Split the address into host and port portions so we can do
 		// a DNS lookup against the host.  When no port is specified in
 		// the address, just use the address as the host.
-		host, _, err := net.SplitHostPort(peer.Addr())
+		host, _, err := net.SplitHostPort(nodeAddr)
 		if err != nil {
-			host = peer.Addr()
+			host = nodeAddr
 		}
 
 		var ipList []string
@@ -1006,14 +1388,15 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 			}
 		}
 
-		// Add the addresses and connection info to the result.
+		// Add the addresses and connection info to the result.  Added
+		// nodes are always connected to as outbound peers.
 		addrs := make([]btcjson.GetAddedNodeInfoResultAddr, 0, len(ipList))
 		for _, ip := range ipList {
 			var addr btcjson.GetAddedNodeInfoResultAddr
 			addr.Address = ip
 			addr.Connected = "false"
-			if ip == host && peer.Connected() {
-				addr.Connected = directionString(peer.Inbound())
+			if ip == host && connected {
+				addr.Connected = directionString(false)
 			}
 			addrs = append(addrs, addr)
 		}
@@ -1145,22 +1528,88 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		}
 
 		blockReply.Tx = txNames
-	} else {
-		txns := blk.Transactions()
-		rawTxns := make([]btcjson.TxRawResult, len(txns))
-		for i, tx := range txns {
-			rawTxn, err := createTxRawResult(params, tx.MsgTx(),
-				tx.Hash().String(), blockHeader, hash.String(),
-				blockHeight, best.Height)
-			if err != nil {
-				return nil, err
-			}
-			rawTxns[i] = *rawTxn
+		return blockReply, nil
+	}
+
+	// The spend journal contains the outputs spent by every input of the
+	// non-coinbase transactions in the block in order, which provides the
+	// previous output details and the fees of the transactions.
+	stxos, err := s.cfg.Chain.FetchSpendJournal(blk)
+	if err != nil {
+		context := "Failed to fetch spent outputs"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	txns := blk.Transactions()
+	rawTxns := make([]btcjson.TxRawResult, len(txns))
+	for i, tx := range txns {
+		mtx := tx.MsgTx()
+		rawTxn, err := createTxRawResult(params, mtx,
+			tx.Hash().String(), blockHeader, hash.String(),
+			blockHeight, best.Height)
+		if err != nil {
+			return nil, err
 		}
-		blockReply.RawTx = rawTxns
+
+		// Coinbase transactions don't spend any outputs.
+		if i != 0 {
+			if len(stxos) < len(mtx.TxIn) {
+				context := "Failed to fetch spent outputs"
+				return nil, internalRPCError("spend journal "+
+					"is missing entries", context)
+			}
+			originOutputs := make(map[wire.OutPoint]wire.TxOut,
+				len(mtx.TxIn))
+			for j, txIn := range mtx.TxIn {
+				originOutputs[txIn.PreviousOutPoint] = wire.TxOut{
+					Value:    stxos[j].Amount,
+					PkScript: stxos[j].PkScript,
+				}
+			}
+			stxos = stxos[len(mtx.TxIn):]
+			addTxRawResultPrevOuts(rawTxn, mtx, originOutputs, params)
+		}
+		rawTxns[i] = *rawTxn
+	}
+
+	return btcjson.GetBlockVerboseTxResult{
+		Hash:          blockReply.Hash,
+		Confirmations: blockReply.Confirmations,
+		StrippedSize:  blockReply.StrippedSize,
+		Size:          blockReply.Size,
+		Weight:        blockReply.Weight,
+		Height:        blockReply.Height,
+		Version:       blockReply.Version,
+		VersionHex:    blockReply.VersionHex,
+		MerkleRoot:    blockReply.MerkleRoot,
+		Tx:            rawTxns,
+		Time:          blockReply.Time,
+		Nonce:         blockReply.Nonce,
+		Bits:          blockReply.Bits,
+		Difficulty:    blockReply.Difficulty,
+		PreviousHash:  blockReply.PreviousHash,
+		NextHash:      blockReply.NextHash,
+	}, nil
+}
+
+// deploymentName returns the human readable name of the passed BIP0009
+// deployment ID.  An error is returned for unknown deployments.
+func deploymentName(deployment int) (string, error) {
+	switch deployment {
+	case chaincfg.DeploymentTestDummy:
+		return "dummy", nil
+
+	case chaincfg.DeploymentCSV:
+		return "csv", nil
+
+	case chaincfg.DeploymentSegwit:
+		return "segwit", nil
 	}
 
-	return blockReply, nil
+	return "", &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInternal.Code,
+		Message: fmt.Sprintf("Unknown deployment %v detected", deployment),
+	}
 }
 
 // softForkStatus converts a ThresholdState state into a human readable string
@@ -1182,6 +1631,12 @@ func softForkStatus(state blockchain.ThresholdState) (string, error) {
 	}
 }
 
+// blocksSizer describes a database which is able to report the size of the
+// files its blocks are stored in, such as the ffldb driver.
+type blocksSizer interface {
+	BlocksSize() (int64, error)
+}
+
 // handleGetBlockChainInfo implements the getblockchaininfo command.
 func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Obtain a snapshot of the current best known blockchain state. We'll
@@ -1203,6 +1658,18 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		},
 	}
 
+	// Report the size of the block files when the database is able to
+	// provide it.  Blocks are never pruned, so there is no prune height to
+	// report.
+	if db, ok := s.cfg.DB.(blocksSizer); ok {
+		size, err := db.BlocksSize()
+		if err != nil {
+			context := "Failed to determine size of block files"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		chainInfo.SizeOnDisk = size
+	}
+
 	// Next, populate the response with information describing the current
 	// status of soft-forks deployed via the super-majority block
 	// signalling mechanism.
@@ -1242,23 +1709,9 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	for deployment, deploymentDetails := range params.Deployments {
 		// Map the integer deployment ID into a human readable
 		// fork-name.
-		var forkName string
-		switch deployment {
-		case chaincfg.DeploymentTestDummy:
-			forkName = "dummy"
-
-		case chaincfg.DeploymentCSV:
-			forkName = "csv"
-
-		case chaincfg.DeploymentSegwit:
-			forkName = "segwit"
-
-		default:
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInternal.Code,
-				Message: fmt.Sprintf("Unknown deployment %v "+
-					"detected", deployment),
-			}
+		forkName, err := deploymentName(deployment)
+		if err != nil {
+			return nil, err
 		}
 
 		// Query the chain for the current status of the deployment as
@@ -1300,6 +1753,62 @@ func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return int64(best.Height), nil
 }
 
+// handleGetBlockFromPeer implements the getblockfrompeer command.
+func handleGetBlockFromPeer(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockFromPeerCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	// Find the connected peer with the provided id.
+	var p *peer.Peer
+	for _, sp := range s.cfg.ConnMgr.ConnectedPeers() {
+		if sp.ToPeer().ID() == c.PeerID {
+			p = sp.ToPeer()
+			break
+		}
+	}
+	if p == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Peer %d does not exist", c.PeerID),
+		}
+	}
+
+	// Request the block from the peer and wait for it to be processed.
+	done, err := s.cfg.SyncMgr.RequestBlock(hash, p)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Block %v from peer %d "+
+					"was not stored: %v", hash, c.PeerID, err),
+			}
+		}
+	case <-time.After(getBlockFromPeerTimeout):
+		s.cfg.SyncMgr.CancelBlockRequest(hash, p)
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Timeout waiting for block %v "+
+				"from peer %d", hash, c.PeerID),
+		}
+	case <-closeChan:
+		s.cfg.SyncMgr.CancelBlockRequest(hash, p)
+		return nil, ErrClientQuit
+	}
+
+	return nil, nil
+}
+
 // handleGetBlockHash implements the getblockhash command.
 func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockHashCmd)
@@ -1314,41 +1823,104 @@ func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return hash.String(), nil
 }
 
-// handleGetBlockHeader implements the getblockheader command.
-func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.GetBlockHeaderCmd)
-
-	// Fetch the header from chain.
-	hash, err := chainhash.NewHashFromStr(c.Hash)
-	if err != nil {
-		return nil, rpcDecodeHexError(c.Hash)
-	}
-	blockHeader, err := s.cfg.Chain.HeaderByHash(hash)
+// handleGetBlockHashByTime implements the getblockhashbytime command.
+func handleGetBlockHashByTime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockHashByTimeCmd)
+	height, err := s.cfg.Chain.HeightForTime(time.Unix(c.Timestamp, 0))
 	if err != nil {
 		return nil, &btcjson.RPCError{
-			Code:    btcjson.ErrRPCBlockNotFound,
-			Message: "Block not found",
-		}
-	}
-
-	// When the verbose flag isn't set, simply return the serialized block
-	// header as a hex-encoded string.
-	if c.Verbose != nil && !*c.Verbose {
-		var headerBuf bytes.Buffer
-		err := blockHeader.Serialize(&headerBuf)
-		if err != nil {
-			context := "Failed to serialize block header"
-			return nil, internalRPCError(err.Error(), context)
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "No block with a median time at or after the timestamp",
 		}
-		return hex.EncodeToString(headerBuf.Bytes()), nil
 	}
 
-	// The verbose flag is set, so generate the JSON object and return it.
-
-	// Get the block height from chain.
-	blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
+	hash, err := s.cfg.Chain.BlockHashByHeight(height)
 	if err != nil {
-		context := "Failed to obtain block height"
+		context := "Failed to fetch block hash"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return hash.String(), nil
+}
+
+// handleGetBlockHashes implements the getblockhashes command.
+func handleGetBlockHashes(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockHashesCmd)
+	if c.Count < 1 || c.Count > maxGetBlockHashesCount {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Count must be between 1 and %d",
+				maxGetBlockHashesCount),
+		}
+	}
+	best := s.cfg.Chain.BestSnapshot()
+	if c.StartHeight < 0 || c.StartHeight > int64(best.Height) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block number out of range",
+		}
+	}
+
+	// The range is limited to the best chain, so fewer hashes than
+	// requested are returned when it extends past the best block.  The
+	// hashes are all fetched while the chain view is locked, so they are
+	// consistent even when the best chain changes during the request.
+	endHeight := c.StartHeight + c.Count
+	hashes, err := s.cfg.Chain.HeightRange(int32(c.StartHeight),
+		int32(endHeight))
+	if err != nil {
+		context := "Failed to fetch block hashes"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if len(hashes) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block number out of range",
+		}
+	}
+
+	results := make([]string, 0, len(hashes))
+	for i := range hashes {
+		results = append(results, hashes[i].String())
+	}
+	return results, nil
+}
+
+// handleGetBlockHeader implements the getblockheader command.
+func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockHeaderCmd)
+
+	// Fetch the header from chain.
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	blockHeader, err := s.cfg.Chain.HeaderByHash(hash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// When the verbose flag isn't set, simply return the serialized block
+	// header as a hex-encoded string.
+	if c.Verbose != nil && !*c.Verbose {
+		var headerBuf bytes.Buffer
+		err := blockHeader.Serialize(&headerBuf)
+		if err != nil {
+			context := "Failed to serialize block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+
+	// The verbose flag is set, so generate the JSON object and return it.
+
+	// Get the block height from chain.
+	blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
+	if err != nil {
+		context := "Failed to obtain block height"
 		return nil, internalRPCError(err.Error(), context)
 	}
 	best := s.cfg.Chain.BestSnapshot()
@@ -1364,6 +1936,12 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		nextHashString = nextHash.String()
 	}
 
+	chainWork, err := s.cfg.Chain.BlockChainWork(hash)
+	if err != nil {
+		context := "Failed to obtain chain work"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
 	params := s.cfg.ChainParams
 	blockHeaderReply := btcjson.GetBlockHeaderVerboseResult{
 		Hash:          c.Hash,
@@ -1378,6 +1956,7 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		Time:          blockHeader.Timestamp.Unix(),
 		Bits:          strconv.FormatInt(int64(blockHeader.Bits), 16),
 		Difficulty:    getDifficultyRatio(blockHeader.Bits, params),
+		ChainWork:     fmt.Sprintf("%064x", chainWork),
 	}
 	return blockHeaderReply, nil
 }
@@ -1522,6 +2101,40 @@ func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGene
 	return c
 }
 
+// gbtDeploymentRules returns the names of the BIP0009 soft-fork rules which are
+// active for the block after the end of the current best chain along with the
+// bits of the deployments that blocks may currently signal for keyed by their
+// names.  The names of rules clients are required to understand are prefixed
+// with '!'.
+func gbtDeploymentRules(chain *blockchain.BlockChain, params *chaincfg.Params) ([]string, map[string]uint32, error) {
+	var rules []string
+	vbAvailable := make(map[string]uint32)
+	for deployment, deploymentDetails := range params.Deployments {
+		name, err := deploymentName(deployment)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		state, err := chain.ThresholdState(uint32(deployment))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, nil, internalRPCError(err.Error(), context)
+		}
+		switch state {
+		case blockchain.ThresholdActive:
+			if _, ok := gbtRequiredRules[name]; ok {
+				name = "!" + name
+			}
+			rules = append(rules, name)
+
+		case blockchain.ThresholdStarted, blockchain.ThresholdLockedIn:
+			vbAvailable[name] = uint32(deploymentDetails.BitNumber)
+		}
+	}
+
+	return rules, vbAvailable, nil
+}
+
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
 // changed or the transactions in the memory pool have been updated and it has
@@ -1589,6 +2202,14 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		best := s.cfg.Chain.BestSnapshot()
 		minTimestamp := mining.MinimumMedianTime(best)
 
+		// Determine the soft-fork rules the block template is subject
+		// to.
+		rules, vbAvailable, err := gbtDeploymentRules(s.cfg.Chain,
+			s.cfg.ChainParams)
+		if err != nil {
+			return err
+		}
+
 		// Update work state to ensure another block template isn't
 		// generated until needed.
 		state.template = template
@@ -1596,6 +2217,8 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
 		state.minTimestamp = minTimestamp
+		state.rules = rules
+		state.vbAvailable = vbAvailable
 
 		rpcsLog.Debugf("Generated block template (timestamp %v, "+
 			"target %s, merkle root %s)",
@@ -1758,6 +2381,8 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		Mutable:      gbtMutableFields,
 		NonceRange:   gbtNonceRange,
 		Capabilities: gbtCapabilities,
+		Rules:        state.rules,
+		VbAvailable:  state.vbAvailable,
 	}
 	// If the generated block template includes transactions with witness
 	// data, then include the witness commitment in the GBT result.
@@ -1766,7 +2391,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	}
 
 	if useCoinbaseValue {
-		reply.CoinbaseAux = gbtCoinbaseAux
+		reply.CoinbaseAux = state.coinbaseAux
 		reply.CoinbaseValue = &msgBlock.Transactions[0].TxOut[0].Value
 	} else {
 		// Ensure the template has a valid payment address associated
@@ -1927,6 +2552,33 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 		}
 	}
 
+	// Respond with an error if the caller does not support all of the
+	// active rules which change the structure of blocks since it would
+	// otherwise create invalid blocks.
+	rules, _, err := gbtDeploymentRules(s.cfg.Chain, s.cfg.ChainParams)
+	if err != nil {
+		return nil, err
+	}
+	clientRules := make(map[string]struct{})
+	if request != nil {
+		for _, rule := range request.Rules {
+			clientRules[rule] = struct{}{}
+		}
+	}
+	for _, rule := range rules {
+		if !strings.HasPrefix(rule, "!") {
+			continue
+		}
+		if _, ok := clientRules[rule[1:]]; !ok {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("getblocktemplate must be "+
+					"called with the %[1]s rule set (call "+
+					"with {\"rules\": [\"%[1]s\"]})", rule[1:]),
+			}
+		}
+	}
+
 	// When a coinbase transaction has been requested, respond with an error
 	// if there are no addresses to pay the created block template to.
 	if !useCoinbaseValue && len(cfg.miningAddrs) == 0 {
@@ -2235,6 +2887,169 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetCFilters implements the getcfilters command.
+func handleGetCFilters(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.CfIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoCFIndex,
+			Message: "The CF index must be enabled for this command",
+		}
+	}
+
+	c := cmd.(*btcjson.GetCFiltersCmd)
+	stopHash, err := chainhash.NewHashFromStr(c.StopHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.StopHash)
+	}
+
+	// Limit the range the same way as getcfilters requests from peers.
+	hashes, err := s.cfg.Chain.HeightToHashRange(int32(c.StartHeight),
+		stopHash, wire.MaxGetCFiltersReqRange)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid filter range: " + err.Error(),
+		}
+	}
+	hashPtrs := make([]*chainhash.Hash, len(hashes))
+	for i := range hashes {
+		hashPtrs[i] = &hashes[i]
+	}
+
+	filters, err := s.cfg.CfIndex.FiltersByBlockHashes(hashPtrs,
+		c.FilterType)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	results := make([]btcjson.GetCFiltersResult, 0, len(filters))
+	for i, filterBytes := range filters {
+		// Filters are only indexed for blocks in the main chain.
+		if len(filterBytes) == 0 {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCBlockNotFound,
+				Message: fmt.Sprintf("No committed filter for "+
+					"block %v", hashes[i]),
+			}
+		}
+
+		results = append(results, btcjson.GetCFiltersResult{
+			BlockHash: hashes[i].String(),
+			Filter:    hex.EncodeToString(filterBytes),
+		})
+	}
+	return results, nil
+}
+
+// verificationProgress returns an estimate of how much of the chain with the
+// passed tip has been verified.  It is based on the time elapsed between the
+// genesis block and the tip relative to the time elapsed up to now, so it is
+// only approximate while the chain is syncing.
+func verificationProgress(tipTime time.Time, params *chaincfg.Params, now time.Time) float64 {
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	total := now.Sub(genesisTime)
+	if total <= 0 {
+		return 1
+	}
+	progress := float64(tipTime.Sub(genesisTime)) / float64(total)
+	if progress < 0 {
+		return 0
+	}
+	if progress > 1 {
+		return 1
+	}
+	return progress
+}
+
+// handleGetChainStates implements the getchainstates command.
+func handleGetChainStates(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	chain := s.cfg.Chain
+	best := chain.BestSnapshot()
+
+	progress := 1.0
+	if !chain.IsCurrent() {
+		header, err := chain.HeaderByHash(&best.Hash)
+		if err != nil {
+			context := "Failed to fetch best block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		progress = verificationProgress(header.Timestamp,
+			s.cfg.ChainParams, time.Now())
+	}
+
+	// Prefer the number of coins tracked by the coin stats index when it
+	// is synced to the best block since scanning the utxo set can take a
+	// long time.
+	var coins int64
+	var haveCoins bool
+	if s.cfg.CoinStatsIndex != nil {
+		stats, err := s.cfg.CoinStatsIndex.CoinStats()
+		if err != nil {
+			context := "Failed to fetch coin stats"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if stats.Hash == best.Hash {
+			coins, haveCoins = stats.Outputs, true
+		}
+	}
+	if !haveCoins {
+		stats, err := chain.FetchUtxoStats(false, closeChan)
+		if err != nil {
+			context := "Failed to calculate utxo set statistics"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		coins = stats.Outputs
+	}
+
+	// The headers are ahead of the best block while the blocks of
+	// downloaded headers are being fetched.
+	headers := best.Height
+	if s.cfg.SyncMgr != nil {
+		if height := s.cfg.SyncMgr.HeaderTipHeight(); height > headers {
+			headers = height
+		}
+	}
+
+	result := &btcjson.GetChainStatesResult{
+		Headers: headers,
+		ChainStates: []btcjson.ChainStateResult{{
+			Blocks:               best.Height,
+			BestBlockHash:        best.Hash.String(),
+			Difficulty:           getDifficultyRatio(best.Bits, s.cfg.ChainParams),
+			VerificationProgress: progress,
+			Coins:                coins,
+			Validated:            true,
+		}},
+	}
+
+	// Report the chainstate built from a utxo snapshot after the fully
+	// validated one.  Its tip is the block the snapshot was taken at, whose
+	// difficulty is only known once its header is.
+	if snapshot := chain.SnapshotChainState(); snapshot != nil {
+		state := btcjson.ChainStateResult{
+			Blocks:            snapshot.Height,
+			BestBlockHash:     snapshot.Hash.String(),
+			Coins:             snapshot.Coins,
+			SnapshotBlockHash: snapshot.Hash.String(),
+		}
+		header, err := chain.HeaderByHash(&snapshot.Hash)
+		if err == nil {
+			state.Difficulty = getDifficultyRatio(header.Bits,
+				s.cfg.ChainParams)
+			state.VerificationProgress = verificationProgress(
+				header.Timestamp, s.cfg.ChainParams, time.Now())
+		}
+		result.ChainStates = append(result.ChainStates, state)
+		if snapshot.Height > result.Headers {
+			result.Headers = snapshot.Height
+		}
+	}
+	return result, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
@@ -2302,6 +3117,76 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return hexBlockHeaders, nil
 }
 
+// handleGetIndexInfo implements the getindexinfo command.
+func handleGetIndexInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetIndexInfoCmd)
+
+	// Build the list of optional indexes the server knows about along with
+	// the indexer for each one that is enabled.
+	indexes := []struct {
+		name    string
+		indexer indexers.Indexer
+	}{
+		{name: "txindex"},
+		{name: "addrindex"},
+		{name: "cfindex"},
+		{name: "spentindex"},
+		{name: "coinstatsindex"},
+	}
+	if s.cfg.TxIndex != nil {
+		indexes[0].indexer = s.cfg.TxIndex
+	}
+	if s.cfg.AddrIndex != nil {
+		indexes[1].indexer = s.cfg.AddrIndex
+	}
+	if s.cfg.CfIndex != nil {
+		indexes[2].indexer = s.cfg.CfIndex
+	}
+	if s.cfg.SpentIndex != nil {
+		indexes[3].indexer = s.cfg.SpentIndex
+	}
+	if s.cfg.CoinStatsIndex != nil {
+		indexes[4].indexer = s.cfg.CoinStatsIndex
+	}
+
+	bestHeight := s.cfg.Chain.BestSnapshot().Height
+	result := make(map[string]btcjson.GetIndexInfoResult, len(indexes))
+	for _, index := range indexes {
+		if c.IndexName != nil && *c.IndexName != index.name {
+			continue
+		}
+
+		// Disabled indexes have not indexed any blocks.
+		if index.indexer == nil || s.cfg.IndexManager == nil {
+			result[index.name] = btcjson.GetIndexInfoResult{
+				BestBlockHeight: -1,
+			}
+			continue
+		}
+
+		status, err := s.cfg.IndexManager.IndexStatus(index.indexer)
+		if err != nil {
+			context := "Failed to fetch index status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result[index.name] = btcjson.GetIndexInfoResult{
+			Enabled:         true,
+			Synced:          !status.CatchingUp && status.Height >= bestHeight,
+			BestBlockHeight: status.Height,
+			CatchingUp:      status.CatchingUp,
+		}
+	}
+
+	if c.IndexName != nil && len(result) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Unknown index: " + *c.IndexName,
+		}
+	}
+
+	return result, nil
+}
+
 // handleGetInfo implements the getinfo command. We only return the fields
 // that are not related to wallet functionality.
 func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -2314,13 +3199,54 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		Connections:     s.cfg.ConnMgr.ConnectedCount(),
 		Proxy:           cfg.Proxy,
 		Difficulty:      getDifficultyRatio(best.Bits, s.cfg.ChainParams),
-		TestNet:         cfg.TestNet3,
+		TestNet:         cfg.TestNet3 || cfg.TestNet4,
 		RelayFee:        cfg.minRelayTxFee.ToBTC(),
 	}
 
 	return ret, nil
 }
 
+// handleGetMemoryInfo implements the getmemoryinfo command.
+func handleGetMemoryInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMemoryInfoCmd)
+
+	if c.Mode != nil && *c.Mode != "stats" {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Unknown mode %q", *c.Mode),
+		}
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	result := &btcjson.GetMemoryInfoResult{
+		HeapAlloc:    stats.HeapAlloc,
+		HeapInuse:    stats.HeapInuse,
+		HeapSys:      stats.HeapSys,
+		HeapObjects:  stats.HeapObjects,
+		TotalAlloc:   stats.TotalAlloc,
+		Sys:          stats.Sys,
+		NumGC:        stats.NumGC,
+		PauseTotalNs: stats.PauseTotalNs,
+		Goroutines:   runtime.NumGoroutine(),
+	}
+
+	result.UtxoCacheEntries, result.UtxoCacheSize = s.cfg.Chain.UtxoCacheSize()
+	if s.cfg.SigCache != nil {
+		result.SigCacheEntries = s.cfg.SigCache.Len()
+	}
+	if s.cfg.HashCache != nil {
+		result.HashCacheEntries = s.cfg.HashCache.Len()
+	}
+	for _, txD := range s.cfg.TxMemPool.TxDescs() {
+		result.MempoolSize++
+		result.MempoolBytes += int64(txD.Tx.MsgTx().SerializeSize())
+	}
+	result.OrphanPoolSize = s.cfg.TxMemPool.OrphanCount()
+
+	return result, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
@@ -2359,17 +3285,23 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 
 	best := s.cfg.Chain.BestSnapshot()
 	result := btcjson.GetMiningInfoResult{
-		Blocks:             int64(best.Height),
-		CurrentBlockSize:   best.BlockSize,
-		CurrentBlockWeight: best.BlockWeight,
-		CurrentBlockTx:     best.NumTxns,
-		Difficulty:         getDifficultyRatio(best.Bits, s.cfg.ChainParams),
-		Generate:           s.cfg.CPUMiner.IsMining(),
-		GenProcLimit:       s.cfg.CPUMiner.NumWorkers(),
-		HashesPerSec:       int64(s.cfg.CPUMiner.HashesPerSecond()),
-		NetworkHashPS:      networkHashesPerSec,
-		PooledTx:           uint64(s.cfg.TxMemPool.Count()),
-		TestNet:            cfg.TestNet3,
+		Blocks:        int64(best.Height),
+		Difficulty:    getDifficultyRatio(best.Bits, s.cfg.ChainParams),
+		Generate:      s.cfg.CPUMiner.IsMining(),
+		GenProcLimit:  s.cfg.CPUMiner.NumWorkers(),
+		HashesPerSec:  int64(s.cfg.CPUMiner.HashesPerSecond()),
+		NetworkHashPS: networkHashesPerSec,
+		PooledTx:      uint64(s.cfg.TxMemPool.Count()),
+		Chain:         s.cfg.ChainParams.Name,
+		TestNet:       cfg.TestNet3 || cfg.TestNet4,
+	}
+
+	// Report the size of the most recently generated block template, if
+	// any, which is the block the node would currently mine.
+	if stats := s.cfg.Generator.LastTemplateStats(); stats != nil {
+		result.CurrentBlockSize = stats.Size
+		result.CurrentBlockWeight = stats.Weight
+		result.CurrentBlockTx = stats.NumTxns
 	}
 	return &result, nil
 }
@@ -2479,6 +3411,87 @@ func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hashesPerSec.Int64(), nil
 }
 
+// handleGetNetworkInfo implements the getnetworkinfo command.
+func handleGetNetworkInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Build the user agent the same way the peers advertise it during the
+	// version handshake.
+	msg := wire.NewMsgVersion(&wire.NetAddress{}, &wire.NetAddress{}, 0, 0)
+	err := msg.AddUserAgent(userAgentName, userAgentVersion,
+		cfg.UserAgentComments...)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Could not build user agent")
+	}
+
+	var connectionsIn, connectionsOut int32
+	for _, p := range s.cfg.ConnMgr.ConnectedPeers() {
+		if p.ToPeer().Inbound() {
+			connectionsIn++
+		} else {
+			connectionsOut++
+		}
+	}
+
+	// Onion addresses are only reachable through a proxy, either the
+	// dedicated onion proxy or the main one.  Networks excluded by the
+	// --onlynet option are not reachable either.
+	onionProxy := cfg.OnionProxy
+	if onionProxy == "" {
+		onionProxy = cfg.Proxy
+	}
+	nets := []addrmgr.Network{addrmgr.NetIPv4, addrmgr.NetIPv6,
+		addrmgr.NetOnion}
+	networks := make([]btcjson.NetworksResult, 0, len(nets))
+	for _, n := range nets {
+		proxy, reachable := cfg.Proxy, true
+		if n == addrmgr.NetOnion {
+			proxy = onionProxy
+			reachable = !cfg.NoOnion && onionProxy != ""
+		}
+		if len(cfg.onlyNets) > 0 {
+			allowed := false
+			for _, onlyNet := range cfg.onlyNets {
+				allowed = allowed || onlyNet == n
+			}
+			reachable = reachable && allowed
+		}
+		networks = append(networks, btcjson.NetworksResult{
+			Name:                      n.String(),
+			Limited:                   !reachable,
+			Reachable:                 reachable,
+			Proxy:                     proxy,
+			ProxyRandomizeCredentials: cfg.TorIsolation,
+		})
+	}
+
+	localAddrs := s.cfg.ConnMgr.LocalAddresses()
+	localAddresses := make([]btcjson.LocalAddressesResult, 0, len(localAddrs))
+	for _, la := range localAddrs {
+		localAddresses = append(localAddresses, btcjson.LocalAddressesResult{
+			Address: la.NetAddress.IP.String(),
+			Port:    la.NetAddress.Port,
+			Score:   int32(la.Score),
+		})
+	}
+
+	reply := &btcjson.GetNetworkInfoResult{
+		Version:         int32(1000000*appMajor + 10000*appMinor + 100*appPatch),
+		SubVersion:      msg.UserAgent,
+		ProtocolVersion: int32(peer.MaxProtocolVersion),
+		LocalServices:   fmt.Sprintf("%016x", uint64(s.cfg.ConnMgr.Services())),
+		LocalRelay:      !cfg.BlocksOnly,
+		TimeOffset:      int64(s.cfg.TimeSource.Offset().Seconds()),
+		Connections:     s.cfg.ConnMgr.ConnectedCount(),
+		ConnectionsIn:   connectionsIn,
+		ConnectionsOut:  connectionsOut,
+		NetworkActive:   true,
+		Networks:        networks,
+		RelayFee:        cfg.minRelayTxFee.ToBTC(),
+		IncrementalFee:  cfg.minRelayTxFee.ToBTC(),
+		LocalAddresses:  localAddresses,
+	}
+	return reply, nil
+}
+
 // handleGetNodeAddresses implements the getnodeaddresses command.
 func handleGetNodeAddresses(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetNodeAddressesCmd)
@@ -2536,6 +3549,8 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			Version:        statsSnap.Version,
 			SubVer:         statsSnap.UserAgent,
 			Inbound:        statsSnap.Inbound,
+			AddNode:        p.IsManual(),
+			ConnectionType: p.ConnectionType(),
 			StartingHeight: statsSnap.StartingHeight,
 			CurrentHeight:  statsSnap.LastBlock,
 			BanScore:       int32(p.BanScore()),
@@ -2552,6 +3567,48 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// netAddressHost returns the host of the passed address the way the address
+// manager displays it, which is its onion address for tor addresses.
+func netAddressHost(na *wire.NetAddress) string {
+	host, _, _ := net.SplitHostPort(addrmgr.NetAddressKey(na))
+	return host
+}
+
+// handleGetRawAddrMan implements the getrawaddrman command.
+func handleGetRawAddrMan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	result := &btcjson.GetRawAddrManResult{
+		New:   make(map[string]btcjson.RawAddrManEntry),
+		Tried: make(map[string]btcjson.RawAddrManEntry),
+	}
+	for _, ta := range s.cfg.ConnMgr.TableAddresses() {
+		entry := btcjson.RawAddrManEntry{
+			Address:       netAddressHost(ta.NetAddress),
+			Port:          ta.NetAddress.Port,
+			Services:      uint64(ta.NetAddress.Services),
+			Time:          ta.NetAddress.Timestamp.Unix(),
+			Network:       addrmgr.GetNetwork(ta.NetAddress).String(),
+			Source:        netAddressHost(ta.Source),
+			SourceNetwork: addrmgr.GetNetwork(ta.Source).String(),
+			Attempts:      ta.Attempts,
+		}
+		if !ta.LastAttempt.IsZero() {
+			entry.LastTry = ta.LastAttempt.Unix()
+		}
+		if !ta.LastSuccess.IsZero() {
+			entry.LastSuccess = ta.LastSuccess.Unix()
+		}
+
+		key := fmt.Sprintf("%d/%d", ta.Bucket, ta.Position)
+		if ta.Tried {
+			result.Tried[key] = entry
+		} else {
+			result.New[key] = entry
+		}
+	}
+
+	return result, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
@@ -2587,6 +3644,12 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 		verbose = *c.Verbose != 0
 	}
 
+	// Search the provided block for the transaction when one is specified,
+	// which works without the transaction index.
+	if c.BlockHash != nil {
+		return getRawTransactionInBlock(s, txHash, *c.BlockHash, verbose)
+	}
+
 	// Try to fetch the transaction from the memory pool and if that fails,
 	// try the block database.
 	var mtx *wire.MsgTx
@@ -2688,22 +3751,164 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	if err != nil {
 		return nil, err
 	}
+
+	// Add the details of the spent outputs along with the fee when the
+	// transaction index is available to look them up.  Coinbase
+	// transactions don't spend any outputs.
+	if s.cfg.TxIndex != nil && !blockchain.IsCoinBaseTx(mtx) {
+		originOutputs, err := fetchInputTxos(s, mtx)
+		if err != nil {
+			return nil, err
+		}
+		addTxRawResultPrevOuts(rawTxn, mtx, originOutputs,
+			s.cfg.ChainParams)
+	}
+
 	return *rawTxn, nil
 }
 
-// handleGetTxOut handles gettxout commands.
-func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.GetTxOutCmd)
+// getRawTransactionInBlock returns the getrawtransaction result for the passed
+// transaction from the block with the passed hash.  The block does not need to
+// be part of the main chain.
+func getRawTransactionInBlock(s *rpcServer, txHash *chainhash.Hash,
+	blockHashStr string, verbose bool) (interface{}, error) {
 
-	// Convert the provided transaction hash hex to a Hash.
-	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	blockHash, err := chainhash.NewHashFromStr(blockHashStr)
 	if err != nil {
-		return nil, rpcDecodeHexError(c.Txid)
+		return nil, rpcDecodeHexError(blockHashStr)
 	}
 
-	// If requested and the tx is available in the mempool try to fetch it
-	// from there, otherwise attempt to fetch from the block database.
-	var bestBlockHash string
+	// Load the block from the database and search it for the transaction.
+	var blkBytes []byte
+	err = s.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		blkBytes, err = dbTx.FetchBlock(blockHash)
+		return err
+	})
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	blk, err := btcutil.NewBlockFromBytes(blkBytes)
+	if err != nil {
+		context := "Failed to deserialize block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var mtx *wire.MsgTx
+	for _, tx := range blk.Transactions() {
+		if tx.Hash().IsEqual(txHash) {
+			mtx = tx.MsgTx()
+			break
+		}
+	}
+	if mtx == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCNoTxInfo,
+			Message: fmt.Sprintf("No transaction %v found in the "+
+				"provided block", txHash),
+		}
+	}
+
+	// When the verbose flag isn't set, simply return the serialized
+	// transaction as a hex-encoded string.
+	if !verbose {
+		mtxHex, err := messageToHex(mtx)
+		if err != nil {
+			return nil, err
+		}
+		return mtxHex, nil
+	}
+
+	// Only include the confirmation details when the block is part of the
+	// main chain.
+	var blkHeader *wire.BlockHeader
+	var blkHeight, chainHeight int32
+	inActiveChain := s.cfg.Chain.MainChainHasBlock(blockHash)
+	if inActiveChain {
+		blkHeight, err = s.cfg.Chain.BlockHeightByHash(blockHash)
+		if err != nil {
+			context := "Failed to retrieve block height"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		blkHeader = &blk.MsgBlock().Header
+		chainHeight = s.cfg.Chain.BestSnapshot().Height
+	}
+	rawTxn, err := createTxRawResult(s.cfg.ChainParams, mtx,
+		txHash.String(), blkHeader, blockHash.String(), blkHeight,
+		chainHeight)
+	if err != nil {
+		return nil, err
+	}
+	rawTxn.BlockHash = blockHash.String()
+	rawTxn.InActiveChain = &inActiveChain
+
+	// Add the details of the spent outputs along with the fee when the
+	// transaction index is available to look them up.
+	if s.cfg.TxIndex != nil && !blockchain.IsCoinBaseTx(mtx) {
+		originOutputs, err := fetchInputTxos(s, mtx)
+		if err != nil {
+			return nil, err
+		}
+		addTxRawResultPrevOuts(rawTxn, mtx, originOutputs,
+			s.cfg.ChainParams)
+	}
+
+	return *rawTxn, nil
+}
+
+// handleGetSpentInfo implements the getspentinfo command.
+func handleGetSpentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.SpentIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Spent output index must be enabled (--spentindex)",
+		}
+	}
+
+	c := cmd.(*btcjson.GetSpentInfoCmd)
+
+	// Convert the provided transaction hash hex to a Hash.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	// Look up the input that spent the output in the spent output index.
+	outpoint := wire.NewOutPoint(txHash, c.Vout)
+	info, err := s.cfg.SpentIndex.SpentInfo(outpoint)
+	if err != nil {
+		context := "Failed to retrieve spent info"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if info == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: fmt.Sprintf("No spent info available for %v", outpoint),
+		}
+	}
+
+	return &btcjson.GetSpentInfoResult{
+		TxID:   info.TxHash.String(),
+		Index:  info.InputIndex,
+		Height: info.Height,
+	}, nil
+}
+
+// handleGetTxOut handles gettxout commands.
+func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutCmd)
+
+	// Convert the provided transaction hash hex to a Hash.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	// If requested and the tx is available in the mempool try to fetch it
+	// from there, otherwise attempt to fetch from the block database.
+	var bestBlockHash string
 	var confirmations int32
 	var value int64
 	var pkScript []byte
@@ -2797,6 +4002,80 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// handleGetTxOutSetInfo handles gettxoutsetinfo commands.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutSetInfoCmd)
+
+	var computeHash, useIndex bool
+	hashType := "hash_serialized_2"
+	if c.HashType != nil {
+		hashType = *c.HashType
+	}
+	switch hashType {
+	case "hash_serialized_2":
+		computeHash = true
+	case "ecmh":
+		if s.cfg.CoinStatsIndex == nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "Coin stats index must be enabled (--coinstatsindex)",
+			}
+		}
+		useIndex = true
+	case "none":
+		useIndex = s.cfg.CoinStatsIndex != nil
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Unknown hash type: " + hashType,
+		}
+	}
+
+	// The coin stats index provides the statistics as of the block it is
+	// synced to without scanning the utxo set, however it does not track
+	// the number of transactions or the disk size.
+	if useIndex {
+		stats, err := s.cfg.CoinStatsIndex.CoinStats()
+		if err != nil {
+			context := "Failed to fetch coin stats"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result := &btcjson.GetTxOutSetInfoResult{
+			Height:      int64(stats.Height),
+			BestBlock:   stats.Hash,
+			TxOuts:      stats.Outputs,
+			BogoSize:    stats.BogoSize,
+			TotalAmount: btcutil.Amount(stats.TotalAmount),
+		}
+		if hashType == "ecmh" {
+			result.ECMH = stats.ECMH
+		}
+		return result, nil
+	}
+
+	// Scanning the utxo set can take a long time, so abort it when the
+	// client goes away.
+	stats, err := s.cfg.Chain.FetchUtxoStats(computeHash, closeChan)
+	if err != nil {
+		context := "Failed to calculate utxo set statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetTxOutSetInfoResult{
+		Height:       int64(stats.Height),
+		BestBlock:    stats.Hash,
+		Transactions: stats.Transactions,
+		TxOuts:       stats.Outputs,
+		BogoSize:     stats.BogoSize,
+		DiskSize:     stats.DiskSize,
+		TotalAmount:  btcutil.Amount(stats.TotalAmount),
+	}
+	if stats.SerializedHash != nil {
+		result.HashSerialized = *stats.SerializedHash
+	}
+	return result, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.HelpCmd)
@@ -2836,6 +4115,77 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleLoadMempool implements the loadmempool command.
+func handleLoadMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	path := mempoolFilePath()
+	restored, err := loadMempoolFile(s.cfg.TxMemPool, path)
+	if os.IsNotExist(err) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "No saved memory pool at " + path,
+		}
+	}
+	if err != nil {
+		context := "Failed to load memory pool"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.LoadMempoolResult{
+		Filename: path,
+		Restored: restored,
+	}, nil
+}
+
+// handleMatchFilter implements the matchfilter command.
+func handleMatchFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.CfIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoCFIndex,
+			Message: "The CF index must be enabled for this command",
+		}
+	}
+
+	c := cmd.(*btcjson.MatchFilterCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	// Decode the items to match against the filter.
+	items := make([][]byte, 0, len(c.Items))
+	for _, item := range c.Items {
+		itemBytes, err := hex.DecodeString(item)
+		if err != nil {
+			return nil, rpcDecodeHexError(item)
+		}
+		items = append(items, itemBytes)
+	}
+
+	filterType := wire.GCSFilterRegular
+	if c.FilterType != nil {
+		filterType = *c.FilterType
+	}
+	matches, err := s.cfg.CfIndex.MatchFilter(hash, filterType, items)
+	if err != nil {
+		rpcsLog.Debugf("Could not match committed filter for %v: %v",
+			hash, err)
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// Return the items that matched the filter in the order they were
+	// provided.
+	matched := make([]string, 0, len(items))
+	for i, match := range matches {
+		if match {
+			matched = append(matched, c.Items[i])
+		}
+	}
+	return matched, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2849,6 +4199,31 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+
+	// Only fee deltas affect the transactions selected for block
+	// templates, so the priority delta is only accepted for compatibility.
+	if c.PriorityDelta != 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Priority deltas are not supported -- the priority delta must be 0",
+		}
+	}
+
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+	err = s.cfg.TxMemPool.PrioritiseTransaction(txHash, c.FeeDelta)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+
+	return true, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3070,6 +4445,120 @@ func fetchMempoolTxnsForAddress(s *rpcServer, addr btcutil.Address, numToSkip, n
 	return mpTxns[numToSkip:rangeEnd], numToSkip
 }
 
+// handleSaveMempool implements the savemempool command.
+func handleSaveMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	path := mempoolFilePath()
+	if err := saveMempoolFile(s.cfg.TxMemPool, path); err != nil {
+		context := "Failed to save memory pool"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.SaveMempoolResult{Filename: path}, nil
+}
+
+// handleScanBlockFilters implements the scanblockfilters command.
+func handleScanBlockFilters(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.CfIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoCFIndex,
+			Message: "The CF index must be enabled for this command",
+		}
+	}
+
+	c := cmd.(*btcjson.ScanBlockFiltersCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	// Convert the addresses to the output scripts paying to them since
+	// those are the items committed to by the filters.
+	params := s.cfg.ChainParams
+	items := make([][]byte, 0, len(c.Addresses))
+	for _, encodedAddr := range c.Addresses {
+		addr, err := btcutil.DecodeAddress(encodedAddr, params)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + err.Error(),
+			}
+		}
+		if !addr.IsForNet(params) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address: " + encodedAddr +
+					" is for the wrong network",
+			}
+		}
+
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			context := "Failed to generate pay-to-address script"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		items = append(items, pkScript)
+	}
+
+	filterType := wire.GCSFilterRegular
+	if c.FilterType != nil {
+		filterType = *c.FilterType
+	}
+
+	// The scan starts at the provided block, which must be in the main
+	// chain, and ends at the current best block.
+	startHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found in the main chain",
+		}
+	}
+	endHeight := s.cfg.Chain.BestSnapshot().Height
+
+	// Match the filters of the blocks in batches so the scan can be
+	// aborted when the client goes away.
+	result := &btcjson.ScanBlockFiltersResult{
+		FromHeight: startHeight,
+		ToHeight:   endHeight,
+		Blocks:     []string{},
+	}
+	for height := startHeight; height <= endHeight; height += scanBlockFiltersBatchSize {
+		select {
+		case <-closeChan:
+			return nil, ErrClientQuit
+		default:
+		}
+
+		batchEnd := height + scanBlockFiltersBatchSize
+		if batchEnd > endHeight+1 {
+			batchEnd = endHeight + 1
+		}
+		hashes, err := s.cfg.Chain.HeightRange(height, batchEnd)
+		if err != nil {
+			context := "Failed to fetch block hashes"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		blockHashes := make([]*chainhash.Hash, 0, len(hashes))
+		for i := range hashes {
+			blockHashes = append(blockHashes, &hashes[i])
+		}
+
+		matches, err := s.cfg.CfIndex.MatchAnyFilters(blockHashes,
+			filterType, items)
+		if err != nil {
+			context := "Failed to match committed filters"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		for i, match := range matches {
+			if match {
+				result.Blocks = append(result.Blocks,
+					hashes[i].String())
+			}
+		}
+	}
+	return result, nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
@@ -3476,11 +4965,10 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 // inadvertently signing a transaction.
 const messageSignatureHeader = "Bitcoin Signed Message:\n"
 
-// handleSignMessageWithPrivKey implements the signmessagewithprivkey command.
-func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.SignMessageWithPrivKeyCmd)
-
-	wif, err := btcutil.DecodeWIF(c.PrivKey)
+// decodeWIF decodes the passed private key in the Wallet Import Format for the
+// passed network and returns an appropriate RPC error when it is invalid.
+func decodeWIF(privKey string, params *chaincfg.Params) (*btcutil.WIF, error) {
+	wif, err := btcutil.DecodeWIF(privKey)
 	if err != nil {
 		message := "Invalid private key"
 		switch err {
@@ -3494,12 +4982,23 @@ func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-cha
 			Message: message,
 		}
 	}
-	if !wif.IsForNet(s.cfg.ChainParams) {
+	if !wif.IsForNet(params) {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCInvalidAddressOrKey,
 			Message: "Private key for wrong network",
 		}
 	}
+	return wif, nil
+}
+
+// handleSignMessageWithPrivKey implements the signmessagewithprivkey command.
+func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SignMessageWithPrivKeyCmd)
+
+	wif, err := decodeWIF(c.PrivKey, s.cfg.ChainParams)
+	if err != nil {
+		return nil, err
+	}
 
 	var buf bytes.Buffer
 	wire.WriteVarString(&buf, 0, messageSignatureHeader)
@@ -3518,6 +5017,311 @@ func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-cha
 	return base64.StdEncoding.EncodeToString(sig), nil
 }
 
+// decodeRawTx decodes the passed hex-encoded serialized transaction and returns
+// an appropriate RPC error when it is invalid.
+func decodeRawTx(hexStr string) (*wire.MsgTx, error) {
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var mtx wire.MsgTx
+	err = mtx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+	return &mtx, nil
+}
+
+// fetchSpentOutputs adds the outputs spent by the inputs of the passed
+// transaction which are not in the passed map yet to it by looking them up in
+// the memory pool and the utxo set.  Outputs which are in neither are left
+// out.
+func fetchSpentOutputs(s *rpcServer, mtx *wire.MsgTx, prevOuts map[wire.OutPoint]*wire.TxOut) error {
+	for _, txIn := range mtx.TxIn {
+		origin := txIn.PreviousOutPoint
+		if _, ok := prevOuts[origin]; ok {
+			continue
+		}
+
+		originTx, err := s.cfg.TxMemPool.FetchTransaction(&origin.Hash)
+		if err == nil {
+			txOuts := originTx.MsgTx().TxOut
+			if origin.Index < uint32(len(txOuts)) {
+				prevOuts[origin] = txOuts[origin.Index]
+			}
+			continue
+		}
+
+		entry, err := s.cfg.Chain.FetchUtxoEntry(origin)
+		if err != nil {
+			context := "Failed to fetch utxo"
+			return internalRPCError(err.Error(), context)
+		}
+		if entry != nil && !entry.IsSpent() {
+			prevOuts[origin] = wire.NewTxOut(entry.Amount(),
+				entry.PkScript())
+		}
+	}
+
+	return nil
+}
+
+// unknownAmount is the value of the outputs spent by a transaction signed by
+// the signrawtransactionwithkey command when the amount is not known.
+const unknownAmount = -1
+
+// rpcSigHashTypes maps the signature hash types accepted by the
+// signrawtransactionwithkey command to their txscript equivalents.
+var rpcSigHashTypes = map[string]txscript.SigHashType{
+	"ALL":                 txscript.SigHashAll,
+	"NONE":                txscript.SigHashNone,
+	"SINGLE":              txscript.SigHashSingle,
+	"ALL|ANYONECANPAY":    txscript.SigHashAll | txscript.SigHashAnyOneCanPay,
+	"NONE|ANYONECANPAY":   txscript.SigHashNone | txscript.SigHashAnyOneCanPay,
+	"SINGLE|ANYONECANPAY": txscript.SigHashSingle | txscript.SigHashAnyOneCanPay,
+}
+
+// signRawTxInput signs the input of the passed transaction at the provided
+// index which spends the passed output with the keys and scripts provided by
+// the passed databases.  P2WPKH outputs, whether native or wrapped in P2SH,
+// are signed with a witness and all other outputs are signed with a signature
+// script that is merged with any signatures the input already has.
+func signRawTxInput(params *chaincfg.Params, tx *wire.MsgTx, idx int,
+	prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes,
+	hashType txscript.SigHashType, kdb txscript.KeyDB,
+	sdb txscript.ScriptDB) error {
+
+	txIn := tx.TxIn[idx]
+	witnessProgram := prevOut.PkScript
+	var sigScript []byte
+	if txscript.IsPayToScriptHash(prevOut.PkScript) {
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(
+			prevOut.PkScript, params)
+		if err != nil {
+			return err
+		}
+		redeemScript, err := sdb.GetScript(addrs[0])
+		if err != nil {
+			return err
+		}
+		if txscript.IsPayToWitnessPubKeyHash(redeemScript) {
+			sigScript, err = txscript.NewScriptBuilder().
+				AddData(redeemScript).Script()
+			if err != nil {
+				return err
+			}
+			witnessProgram = redeemScript
+		}
+	}
+
+	if !txscript.IsPayToWitnessPubKeyHash(witnessProgram) {
+		sigScript, err := txscript.SignTxOutput(params, tx, idx,
+			prevOut.PkScript, hashType, kdb, sdb, txIn.SignatureScript)
+		if err != nil {
+			return err
+		}
+		txIn.SignatureScript = sigScript
+		return nil
+	}
+
+	// The amount of the spent output is committed to by witness
+	// signatures, so it must be known.
+	if prevOut.Value == unknownAmount {
+		return errors.New("missing amount")
+	}
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(witnessProgram, params)
+	if err != nil {
+		return err
+	}
+	key, _, err := kdb.GetKey(addrs[0])
+	if err != nil {
+		return err
+	}
+	witness, err := txscript.WitnessSignature(tx, sigHashes, idx,
+		prevOut.Value, witnessProgram, hashType, key, true)
+	if err != nil {
+		return err
+	}
+	txIn.SignatureScript = sigScript
+	txIn.Witness = witness
+	return nil
+}
+
+// handleSignRawTransactionWithKey implements the signrawtransactionwithkey
+// command.
+func handleSignRawTransactionWithKey(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SignRawTransactionWithKeyCmd)
+	params := s.cfg.ChainParams
+
+	mtx, err := decodeRawTx(c.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	hashType, ok := rpcSigHashTypes[*c.SigHashType]
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid sighash param",
+		}
+	}
+
+	// Index the keys by the hash of their public key, which is what the
+	// outputs paying to them commit to.  The P2SH-wrapped P2WPKH redeem
+	// script of every compressed key is known as well, so those outputs
+	// can be signed without providing it.
+	keys := make(map[string]*btcutil.WIF, len(c.PrivKeys))
+	scripts := make(map[string][]byte)
+	for _, privKey := range c.PrivKeys {
+		wif, err := decodeWIF(privKey, params)
+		if err != nil {
+			return nil, err
+		}
+		pubKeyHash := btcutil.Hash160(wif.SerializePubKey())
+		keys[string(pubKeyHash)] = wif
+		if !wif.CompressPubKey {
+			continue
+		}
+
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash,
+			params)
+		if err != nil {
+			context := "Failed to create witness address"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		redeemScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			context := "Failed to create redeem script"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		scripts[string(btcutil.Hash160(redeemScript))] = redeemScript
+	}
+
+	// Use the provided details of the spent outputs first and look up the
+	// remaining ones in the memory pool and the utxo set.
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	if c.Inputs != nil {
+		for _, input := range *c.Inputs {
+			txHash, err := chainhash.NewHashFromStr(input.Txid)
+			if err != nil {
+				return nil, rpcDecodeHexError(input.Txid)
+			}
+			pkScript, err := hex.DecodeString(input.ScriptPubKey)
+			if err != nil {
+				return nil, rpcDecodeHexError(input.ScriptPubKey)
+			}
+			if input.WitnessScript != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParameter,
+					Message: "Witness scripts are not supported",
+				}
+			}
+
+			prevOut := wire.NewTxOut(unknownAmount, pkScript)
+			if input.Amount != nil {
+				amount, err := btcutil.NewAmount(*input.Amount)
+				if err != nil || amount < 0 {
+					return nil, &btcjson.RPCError{
+						Code:    btcjson.ErrRPCInvalidParameter,
+						Message: "Invalid amount",
+					}
+				}
+				prevOut.Value = int64(amount)
+			}
+			if input.RedeemScript != nil {
+				redeemScript, err := hex.DecodeString(
+					*input.RedeemScript)
+				if err != nil {
+					return nil, rpcDecodeHexError(
+						*input.RedeemScript)
+				}
+				scriptHash := btcutil.Hash160(redeemScript)
+				scripts[string(scriptHash)] = redeemScript
+			}
+
+			outpoint := wire.OutPoint{Hash: *txHash, Index: input.Vout}
+			prevOuts[outpoint] = prevOut
+		}
+	}
+	if err := fetchSpentOutputs(s, mtx, prevOuts); err != nil {
+		return nil, err
+	}
+
+	getKey := txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		pubKeyHash := addr.ScriptAddress()
+		if pubKeyAddr, ok := addr.(*btcutil.AddressPubKey); ok {
+			pubKeyHash = pubKeyAddr.AddressPubKeyHash().ScriptAddress()
+		}
+		wif, ok := keys[string(pubKeyHash)]
+		if !ok {
+			return nil, false, errors.New("no private key for " +
+				"address " + addr.EncodeAddress())
+		}
+		return wif.PrivKey, wif.CompressPubKey, nil
+	})
+	getScript := txscript.ScriptClosure(func(addr btcutil.Address) ([]byte, error) {
+		script, ok := scripts[string(addr.ScriptAddress())]
+		if !ok {
+			return nil, errors.New("no redeem script for " +
+				"address " + addr.EncodeAddress())
+		}
+		return script, nil
+	})
+
+	// Sign every input that can be signed and verify the result, recording
+	// the reason for every input that is not fully signed.
+	var signErrors []btcjson.SignRawTransactionError
+	sigHashes := txscript.NewTxSigHashes(mtx)
+	for i, txIn := range mtx.TxIn {
+		err := errors.New("input not found or already spent")
+		prevOut, ok := prevOuts[txIn.PreviousOutPoint]
+		if ok {
+			err = signRawTxInput(params, mtx, i, prevOut, sigHashes,
+				hashType, getKey, getScript)
+		}
+		if err == nil {
+			amount := prevOut.Value
+			if amount == unknownAmount {
+				amount = 0
+			}
+			var vm *txscript.Engine
+			vm, err = txscript.NewEngine(prevOut.PkScript, mtx, i,
+				txscript.StandardVerifyFlags, nil, sigHashes,
+				amount)
+			if err == nil {
+				err = vm.Execute()
+			}
+		}
+		if err == nil {
+			continue
+		}
+
+		signErrors = append(signErrors, btcjson.SignRawTransactionError{
+			TxID:      txIn.PreviousOutPoint.Hash.String(),
+			Vout:      txIn.PreviousOutPoint.Index,
+			ScriptSig: hex.EncodeToString(txIn.SignatureScript),
+			Sequence:  txIn.Sequence,
+			Error:     err.Error(),
+		})
+	}
+
+	mtxHex, err := messageToHex(mtx)
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.SignRawTransactionWithKeyResult{
+		Hex:      mtxHex,
+		Complete: len(signErrors) == 0,
+		Errors:   signErrors,
+	}, nil
+}
+
 // handleStop implements the stop command.
 func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	select {
@@ -3560,6 +5364,64 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleTestMempoolAccept implements the testmempoolaccept command.
+func handleTestMempoolAccept(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TestMempoolAcceptCmd)
+	if len(c.RawTxns) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Array must contain at least one raw transaction",
+		}
+	}
+
+	// Decode all of the transactions before checking any of them so a
+	// malformed one fails the entire request.
+	txns := make([]*btcutil.Tx, 0, len(c.RawTxns))
+	for _, hexStr := range c.RawTxns {
+		mtx, err := decodeRawTx(hexStr)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, btcutil.NewTx(mtx))
+	}
+
+	// Every transaction is checked against the current memory pool on its
+	// own, so transactions which spend each other are not accepted.
+	results := make([]btcjson.TestMempoolAcceptResult, 0, len(txns))
+	for _, tx := range txns {
+		result := btcjson.TestMempoolAcceptResult{
+			Txid:  tx.Hash().String(),
+			Wtxid: tx.WitnessHash().String(),
+		}
+
+		missingParents, txD, err := s.cfg.TxMemPool.CheckAcceptTransaction(tx)
+		switch {
+		case err != nil:
+			// Rule errors mean the transaction was simply rejected
+			// as opposed to something actually going wrong.
+			if _, ok := err.(mempool.RuleError); !ok {
+				context := "Failed to check transaction"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			result.RejectReason = err.Error()
+
+		case len(missingParents) > 0:
+			result.RejectReason = "missing-inputs"
+
+		default:
+			result.Allowed = true
+			result.Vsize = int32(mempool.GetTxVirtualSize(tx))
+			result.Fees = &btcjson.TestMempoolAcceptFees{
+				Base: btcutil.Amount(txD.Fee).ToBTC(),
+			}
+			result.FeeRate = btcutil.Amount(txD.FeePerKB).ToBTC()
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 // handleUptime implements the uptime command.
 func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
@@ -3742,6 +5604,115 @@ func handleVersion(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return result, nil
 }
 
+// tipNotifier notifies any number of waiters when the tip of the best chain
+// changes.
+type tipNotifier struct {
+	sync.Mutex
+	changed chan struct{}
+}
+
+// newTipNotifier returns a new instance of a tipNotifier ready to use.
+func newTipNotifier() *tipNotifier {
+	return &tipNotifier{changed: make(chan struct{})}
+}
+
+// tipChanged returns a channel which is closed the next time the tip of the
+// best chain changes.
+func (n *tipNotifier) tipChanged() <-chan struct{} {
+	n.Lock()
+	defer n.Unlock()
+	return n.changed
+}
+
+// notifyTipChanged notifies everything waiting on a channel returned by
+// tipChanged that the tip of the best chain changed.
+func (n *tipNotifier) notifyTipChanged() {
+	n.Lock()
+	close(n.changed)
+	n.changed = make(chan struct{})
+	n.Unlock()
+}
+
+// waitForTip waits until the passed function reports the tip of the best chain
+// is the one being waited for, the timeout in milliseconds expires, or the
+// client disconnects.  A timeout of zero waits indefinitely.  The tip of the
+// best chain at the time the wait ends is returned either way.
+func waitForTip(s *rpcServer, timeoutParam *int, closeChan <-chan struct{}, done func(best *blockchain.BestState) bool) (interface{}, error) {
+	var timeout int
+	if timeoutParam != nil {
+		timeout = *timeoutParam
+	}
+	if timeout < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Timeout must not be negative",
+		}
+	}
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	for {
+		// Obtain the channel before checking the tip so a change in
+		// between is not missed.
+		changed := s.tipNotifier.tipChanged()
+		best := s.cfg.Chain.BestSnapshot()
+		if done(best) {
+			return &btcjson.WaitForBlockResult{
+				Hash:   best.Hash.String(),
+				Height: best.Height,
+			}, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timeoutChan:
+			best := s.cfg.Chain.BestSnapshot()
+			return &btcjson.WaitForBlockResult{
+				Hash:   best.Hash.String(),
+				Height: best.Height,
+			}, nil
+		case <-closeChan:
+			return nil, ErrClientQuit
+		}
+	}
+}
+
+// handleWaitForBlock implements the waitforblock command.
+func handleWaitForBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.WaitForBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	return waitForTip(s, c.Timeout, closeChan, func(best *blockchain.BestState) bool {
+		return best.Hash == *hash
+	})
+}
+
+// handleWaitForBlockHeight implements the waitforblockheight command.
+func handleWaitForBlockHeight(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.WaitForBlockHeightCmd)
+
+	return waitForTip(s, c.Timeout, closeChan, func(best *blockchain.BestState) bool {
+		return best.Height >= c.Height
+	})
+}
+
+// handleWaitForNewBlock implements the waitfornewblock command.
+func handleWaitForNewBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.WaitForNewBlockCmd)
+
+	startHash := s.cfg.Chain.BestSnapshot().Hash
+	return waitForTip(s, c.Timeout, closeChan, func(best *blockchain.BestState) bool {
+		return best.Hash != startHash
+	})
+}
+
 // rpcServer provides a concurrent safe RPC server to a chain server.
 type rpcServer struct {
 	started                int32
@@ -3749,6 +5720,8 @@ type rpcServer struct {
 	cfg                    rpcserverConfig
 	authsha                [sha256.Size]byte
 	limitauthsha           [sha256.Size]byte
+	authWhitelist          map[string]struct{}
+	limitWhitelist         map[string]struct{}
 	ntfnMgr                *wsNotificationManager
 	numClients             int32
 	statusLines            map[int]string
@@ -3756,6 +5729,7 @@ type rpcServer struct {
 	wg                     sync.WaitGroup
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
+	tipNotifier            *tipNotifier
 	requestProcessShutdown chan struct{}
 	quit                   chan int
 }
@@ -3935,6 +5909,23 @@ func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error)
 	return false, false, errors.New("auth failure")
 }
 
+// isMethodWhitelisted returns whether or not the user identified by isAdmin is
+// allowed to invoke the passed method according to the configured RPC method
+// whitelists.  Users without a configured whitelist are not restricted.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) isMethodWhitelisted(isAdmin bool, method string) bool {
+	whitelist := s.limitWhitelist
+	if isAdmin {
+		whitelist = s.authWhitelist
+	}
+	if whitelist == nil {
+		return true
+	}
+	_, ok := whitelist[method]
+	return ok
+}
+
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
 // a known concrete command along with any error that might have happened while
 // parsing it.
@@ -4116,6 +6107,11 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			}
 		}
 
+		// Check if the user is restricted to a whitelist of methods.
+		if jsonErr == nil && !s.isMethodWhitelisted(isAdmin, request.Method) {
+			jsonErr = ErrRPCNotWhitelisted
+		}
+
 		if jsonErr == nil {
 			// Attempt to parse the JSON-RPC request into a known concrete
 			// command.
@@ -4135,8 +6131,31 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		return
 	}
 
-	// Write the response.
-	err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusOK, buf)
+	// Terminate with newline to maintain compatibility with Bitcoin Core.
+	msg = append(msg, '\n')
+
+	// Compress the response when enabled and the client accepts it.  The
+	// response varies by the encodings the client accepts in that case.
+	if cfg.RPCGzip {
+		w.Header().Set("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			compressed, err := gzipReply(msg)
+			if err != nil {
+				rpcsLog.Errorf("Failed to compress reply: %v", err)
+				return
+			}
+			msg = compressed
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	}
+
+	// Write the response.  Calls of methods which are not whitelisted for
+	// the user are forbidden like they are by Bitcoin Core.
+	status := http.StatusOK
+	if jsonErr == ErrRPCNotWhitelisted {
+		status = http.StatusForbidden
+	}
+	err = s.writeHTTPResponseHeaders(r, w.Header(), status, buf)
 	if err != nil {
 		rpcsLog.Error(err)
 		return
@@ -4144,11 +6163,53 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	if _, err := buf.Write(msg); err != nil {
 		rpcsLog.Errorf("Failed to write marshalled reply: %v", err)
 	}
+}
 
-	// Terminate with newline to maintain compatibility with Bitcoin Core.
-	if err := buf.WriteByte('\n'); err != nil {
-		rpcsLog.Errorf("Failed to append terminating newline to reply: %v", err)
+// acceptsGzip returns whether or not the passed value of the Accept-Encoding
+// header of a request allows the response to be compressed with gzip.  An
+// explicit gzip (or x-gzip) coding takes precedence over the wildcard coding,
+// and codings with a quality value of zero are not acceptable.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQuality, wildcardQuality := -1.0, -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(coding, ";")
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.ToLower(strings.TrimSpace(param))
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil {
+				q = 0
+			}
+			quality = q
+		}
+
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case "gzip", "x-gzip":
+			gzipQuality = quality
+		case "*":
+			wildcardQuality = quality
+		}
+	}
+	if gzipQuality >= 0 {
+		return gzipQuality > 0
+	}
+	return wildcardQuality > 0
+}
+
+// gzipReply returns the passed marshalled reply compressed with gzip.
+func gzipReply(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
 
 // jsonAuthFail sends a message back to the client if the http auth is rejected.
@@ -4273,6 +6334,14 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// ConnectionType returns the name of the type of the connection to the
+	// peer, such as inbound or manual.
+	ConnectionType() string
+
+	// IsManual returns whether or not the connection to the peer was
+	// requested by the user, such as via the addnode RPC.
+	IsManual() bool
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -4318,9 +6387,10 @@ type rpcserverConnManager interface {
 	// ConnectedPeers returns an array consisting of all connected peers.
 	ConnectedPeers() []rpcserverPeer
 
-	// PersistentPeers returns an array consisting of all the persistent
-	// peers.
-	PersistentPeers() []rpcserverPeer
+	// AddedNodes returns the connection requests of all the persistent
+	// (added) peers regardless of whether or not they are currently
+	// connected.
+	AddedNodes() []*connmgr.ConnReq
 
 	// BroadcastMessage sends the provided message to all currently
 	// connected peers.
@@ -4338,6 +6408,18 @@ type rpcserverConnManager interface {
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
 	NodeAddresses() []*wire.NetAddress
+
+	// TableAddresses returns the addresses of the new and tried tables of
+	// the address manager along with their buckets.
+	TableAddresses() []addrmgr.TableAddress
+
+	// Services returns the service flags the server advertises to its
+	// peers.
+	Services() wire.ServiceFlag
+
+	// LocalAddresses returns the local addresses the server knows about
+	// along with their scores as candidates to advertise to peers.
+	LocalAddresses() []addrmgr.LocalAddressInfo
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4360,11 +6442,24 @@ type rpcserverSyncManager interface {
 	// used to sync from or 0 if there is none.
 	SyncPeerID() int32
 
+	// HeaderTipHeight returns the height of the best known header, which
+	// may be ahead of the best chain tip while blocks are being synced.
+	HeaderTipHeight() int32
+
 	// LocateHeaders returns the headers of the blocks after the first known
 	// block in the provided locators until the provided stop hash or the
 	// current tip is reached, up to a max of wire.MaxBlockHeadersPerMsg
 	// hashes.
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
+
+	// RequestBlock requests the block with the provided hash from the
+	// provided peer.  The returned channel receives the result of
+	// processing the block once the peer sends it.
+	RequestBlock(hash *chainhash.Hash, p *peer.Peer) (<-chan error, error)
+
+	// CancelBlockRequest cancels the request for the block with the
+	// provided hash from the provided peer made via RequestBlock.
+	CancelBlockRequest(hash *chainhash.Hash, p *peer.Peer)
 }
 
 // rpcserverConfig is a descriptor containing the RPC server configuration.
@@ -4398,6 +6493,12 @@ type rpcserverConfig struct {
 	// TxMemPool defines the transaction memory pool to interact with.
 	TxMemPool *mempool.TxPool
 
+	// SigCache and HashCache are the caches of verified signatures and of
+	// the partial signature hashes of transactions shared with the rest
+	// of the server.  They are only used to report their sizes.
+	SigCache  *txscript.SigCache
+	HashCache *txscript.HashCache
+
 	// These fields allow the RPC server to interface with mining.
 	//
 	// Generator produces block templates and the CPUMiner solves them using
@@ -4412,6 +6513,17 @@ type rpcserverConfig struct {
 	AddrIndex *indexers.AddrIndex
 	CfIndex   *indexers.CfIndex
 
+	// SpentIndex is the optional spent transaction output index.
+	SpentIndex *indexers.SpentIndex
+
+	// CoinStatsIndex is the optional index of statistics about the utxo
+	// set as of each block.
+	CoinStatsIndex *indexers.CoinStatsIndex
+
+	// IndexManager manages the optional indexes above and provides their
+	// sync state.  It is nil when no optional indexes are enabled.
+	IndexManager *indexers.Manager
+
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	FeeEstimator *mempool.FeeEstimator
@@ -4422,8 +6534,9 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource),
+		gbtWorkState:           newGbtWorkState(config.TimeSource, config.Generator.CoinbaseFlags()),
 		helpCacher:             newHelpCacher(),
+		tipNotifier:            newTipNotifier(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
 	}
@@ -4431,11 +6544,13 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		login := cfg.RPCUser + ":" + cfg.RPCPass
 		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.authsha = sha256.Sum256([]byte(auth))
+		rpc.authWhitelist = cfg.rpcWhitelists[cfg.RPCUser]
 	}
 	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
 		login := cfg.RPCLimitUser + ":" + cfg.RPCLimitPass
 		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.limitauthsha = sha256.Sum256([]byte(auth))
+		rpc.limitWhitelist = cfg.rpcWhitelists[cfg.RPCLimitUser]
 	}
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
 	rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)
@@ -4466,7 +6581,10 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 			break
 		}
 
-		// Notify registered websocket clients of incoming block.
+		// Notify anything waiting for the tip of the best chain to
+		// change along with registered websocket clients of incoming
+		// block.
+		s.tipNotifier.notifyTipChanged()
 		s.ntfnMgr.NotifyBlockConnected(block)
 
 	case blockchain.NTBlockDisconnected:
@@ -4476,7 +6594,9 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 			break
 		}
 
-		// Notify registered websocket clients.
+		// Notify anything waiting for the tip of the best chain to
+		// change along with registered websocket clients.
+		s.tipNotifier.notifyTipChanged()
 		s.ntfnMgr.NotifyBlockDisconnected(block)
 	}
 }
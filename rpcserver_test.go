@@ -0,0 +1,3999 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/netsync"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestRPCServer returns a minimal RPC server that authenticates the admin
+// user configured in the global config.  The global config is replaced with
+// the provided one and the returned function restores it.
+func newTestRPCServer(testCfg *config) (*rpcServer, func()) {
+	origCfg := cfg
+	cfg = testCfg
+
+	s := &rpcServer{statusLines: make(map[int]string)}
+	login := cfg.RPCUser + ":" + cfg.RPCPass
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	s.authsha = sha256.Sum256([]byte(auth))
+	s.authWhitelist = cfg.rpcWhitelists[cfg.RPCUser]
+
+	return s, func() { cfg = origCfg }
+}
+
+// testRPCHandler returns an HTTP handler which authenticates and services
+// JSON-RPC requests in the same way as the handler installed by Start.
+func testRPCHandler(s *rpcServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isAdmin, err := s.checkAuth(r, true)
+		if err != nil {
+			jsonAuthFail(w)
+			return
+		}
+		s.jsonRPCRead(w, r, isAdmin)
+	})
+}
+
+// testRPCCall issues the provided parameterless method to the RPC server at
+// the given URL using the admin credentials from the global config and returns
+// the reply along with the HTTP status code of the response.
+func testRPCCall(t *testing.T, client *http.Client, url,
+	method string) (*btcjson.Response, int) {
+
+	body := fmt.Sprintf(`{"jsonrpc":"1.0","method":%q,"params":[],"id":1}`,
+		method)
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unable to create request: %v", err)
+	}
+	req.SetBasicAuth(cfg.RPCUser, cfg.RPCPass)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unable to issue request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var reply btcjson.Response
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Fatalf("unable to decode reply: %v", err)
+	}
+	return &reply, resp.StatusCode
+}
+
+// TestRPCWhitelist ensures a user restricted to a whitelist of methods is only
+// able to invoke the whitelisted methods.
+func TestRPCWhitelist(t *testing.T) {
+	s, restore := newTestRPCServer(&config{
+		RPCUser: "admin",
+		RPCPass: "adminpass",
+		rpcWhitelists: map[string]map[string]struct{}{
+			"admin": {"uptime": {}},
+		},
+	})
+	defer restore()
+
+	server := httptest.NewServer(testRPCHandler(s))
+	defer server.Close()
+
+	// The whitelisted method must succeed.
+	reply, _ := testRPCCall(t, http.DefaultClient, server.URL, "uptime")
+	if reply.Error != nil {
+		t.Fatalf("uptime: unexpected error: %v", reply.Error)
+	}
+
+	// A method that is not whitelisted must be denied and forbidden.
+	reply, status := testRPCCall(t, http.DefaultClient, server.URL,
+		"getblockcount")
+	if reply.Error == nil {
+		t.Fatal("getblockcount: expected whitelist error")
+	}
+	if status != http.StatusForbidden {
+		t.Fatalf("getblockcount: unexpected status -- got %d, want %d",
+			status, http.StatusForbidden)
+	}
+	if reply.Error.Code != ErrRPCNotWhitelisted.Code ||
+		reply.Error.Message != ErrRPCNotWhitelisted.Message {
+
+		t.Fatalf("getblockcount: unexpected error -- got %v, want %v",
+			reply.Error, ErrRPCNotWhitelisted)
+	}
+}
+
+// TestRPCUnixSocket ensures the RPC server can service requests over a Unix
+// domain socket and that the socket is only accessible by its owner.
+func TestRPCUnixSocket(t *testing.T) {
+	s, restore := newTestRPCServer(&config{
+		RPCUser: "admin",
+		RPCPass: "adminpass",
+	})
+	defer restore()
+
+	tmpDir, err := ioutil.TempDir("", "btcdrpcunix")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	socketPath := filepath.Join(tmpDir, "rpc.sock")
+
+	// Create a stale socket file to ensure it is replaced.
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("unable to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenRPCUnixSocket(socketPath)
+	if err != nil {
+		t.Fatalf("listenRPCUnixSocket: unexpected error: %v", err)
+	}
+	fi, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("unable to stat socket: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("unexpected socket permissions -- got %o, want %o",
+			perm, 0600)
+	}
+
+	httpServer := &http.Server{Handler: testRPCHandler(s)}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+	reply, _ := testRPCCall(t, client, "http://unix", "uptime")
+	if reply.Error != nil {
+		t.Fatalf("uptime: unexpected error: %v", reply.Error)
+	}
+	var uptime int64
+	if err := json.Unmarshal(reply.Result, &uptime); err != nil {
+		t.Fatalf("unable to unmarshal uptime result: %v", err)
+	}
+
+	// A regular file at the socket path must not be removed.
+	regularPath := filepath.Join(tmpDir, "notasocket")
+	if err := ioutil.WriteFile(regularPath, nil, 0600); err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	if _, err := listenRPCUnixSocket(regularPath); err == nil {
+		t.Fatal("listenRPCUnixSocket: expected error for regular file")
+	}
+}
+
+// newTestChainRPCServer returns an RPC server backed by a new regression test
+// chain that only contains the genesis block along with a function that tears
+// it down.  Logging is disabled until the teardown function is called since
+// the log rotator is not initialized by the tests.
+func newTestChainRPCServer(t *testing.T, name string) (*rpcServer, func()) {
+	return newTestNetChainRPCServer(t, name, &chaincfg.RegressionNetParams)
+}
+
+// newTestNetChainRPCServer returns an RPC server the same way as
+// newTestChainRPCServer except the chain is for the provided network.
+func newTestNetChainRPCServer(t *testing.T, name string, params *chaincfg.Params) (*rpcServer, func()) {
+	setLogLevels("off")
+
+	dbPath, err := ioutil.TempDir("", name)
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+		setLogLevels(defaultLogLevel)
+	}
+
+	txIndex := indexers.NewTxIndex(db)
+	cfIndex := indexers.NewCfIndex(db, params, nil)
+	indexManager := indexers.NewManager(db, []indexers.Indexer{txIndex,
+		cfIndex})
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:               db,
+		ChainParams:      params,
+		TimeSource:       blockchain.NewMedianTime(),
+		IndexManager:     indexManager,
+		UtxoCacheMaxSize: 1 << 20,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	txMemPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			DisableRelayPriority:  true,
+			AcceptNonStd:          true,
+			MaxOrphanTxs:          5,
+			MaxOrphanTxSize:       1000,
+			MaxSigOpCostPerTx:     blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:         mempool.DefaultMinRelayTxFee,
+			DustRelayFee:          mempool.DefaultDustRelayFee,
+			MaxDataCarrierSize:    mempool.DefaultMaxDataCarrierSize,
+			MaxDataCarrierOutputs: mempool.DefaultMaxDataCarrierOutputs,
+			MaxTxVersion:          2,
+		},
+		ChainParams:    params,
+		FetchUtxoView:  chain.FetchUtxoView,
+		BestHeight:     func() int32 { return chain.BestSnapshot().Height },
+		MedianTimePast: func() time.Time { return chain.BestSnapshot().MedianTime },
+		CalcSequenceLock: func(tx *btcutil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+	})
+	s := &rpcServer{cfg: rpcserverConfig{
+		Chain:       chain,
+		ChainParams: params,
+		DB:          db,
+		TxMemPool:   txMemPool,
+		TxIndex:     txIndex,
+		CfIndex:     cfIndex,
+	}, tipNotifier: newTipNotifier()}
+
+	// Only notify tip changes since the remaining notification handling
+	// requires a fully initialized RPC server.
+	chain.Subscribe(func(notification *blockchain.Notification) {
+		switch notification.Type {
+		case blockchain.NTBlockConnected, blockchain.NTBlockDisconnected:
+			s.tipNotifier.notifyTipChanged()
+		}
+	})
+	return s, teardown
+}
+
+// newTestChainBlock returns a block which extends the main chain of the passed
+// RPC server and contains a coinbase paying the block subsidy to an
+// anyone-can-spend script followed by the passed transactions.  The block is
+// not solved.
+func newTestChainBlock(t *testing.T, s *rpcServer, txns ...*wire.MsgTx) *wire.MsgBlock {
+	params := s.cfg.ChainParams
+	best := s.cfg.Chain.BestSnapshot()
+	height := best.Height + 1
+
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(0).Script()
+	if err != nil {
+		t.Fatalf("unable to create coinbase script: %v", err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(blockchain.CalcBlockSubsidy(height,
+		params), []byte{txscript.OP_TRUE}))
+
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   4,
+			PrevBlock: best.Hash,
+			Timestamp: params.GenesisBlock.Header.Timestamp.Add(
+				time.Duration(height) * time.Minute),
+			Bits: params.PowLimitBits,
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txns...),
+	}
+	utilTxns := btcutil.NewBlock(block).Transactions()
+	merkles := blockchain.BuildMerkleTreeStore(utilTxns, false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return block
+}
+
+// addTestChainBlock connects a block created by newTestChainBlock to the main
+// chain of the passed RPC server.  Proof of work is not checked, so the block
+// is not solved.
+func addTestChainBlock(t *testing.T, s *rpcServer, txns ...*wire.MsgTx) *wire.MsgBlock {
+	block := newTestChainBlock(t, s, txns...)
+	height := s.cfg.Chain.BestSnapshot().Height + 1
+	_, isOrphan, err := s.cfg.Chain.ProcessBlock(btcutil.NewBlock(block),
+		blockchain.BFNoPoWCheck)
+	if err != nil {
+		t.Fatalf("unable to process block at height %d: %v", height, err)
+	}
+	if isOrphan {
+		t.Fatalf("block at height %d is an orphan", height)
+	}
+	return block
+}
+
+// TestHandleGetBlockTemplateProposal ensures block proposals submitted via the
+// getblocktemplate RPC are validated against the current chain tip and either
+// accepted with a null result or rejected with a reason.
+func TestHandleGetBlockTemplateProposal(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "gbtproposal")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Construct a block that builds on the genesis block.
+	coinbaseScript, err := txscript.NewScriptBuilder().AddInt64(1).
+		AddInt64(0).Script()
+	if err != nil {
+		t.Fatalf("unable to create coinbase script: %v", err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(blockchain.CalcBlockSubsidy(1, params),
+		[]byte{txscript.OP_TRUE}))
+	genesis := params.GenesisBlock
+	validBlock := wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  *params.GenesisHash,
+			MerkleRoot: coinbase.TxHash(),
+			Timestamp:  genesis.Header.Timestamp.Add(time.Minute),
+			Bits:       params.PowLimitBits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+
+	badMerkleBlock := validBlock
+	badMerkleBlock.Header.MerkleRoot = chainhash.Hash{0x01}
+
+	badPrevBlock := validBlock
+	badPrevBlock.Header.PrevBlock = chainhash.Hash{0x01}
+
+	tests := []struct {
+		name  string
+		block *wire.MsgBlock
+		want  interface{}
+	}{
+		{name: "valid proposal", block: &validBlock, want: nil},
+		{name: "bad merkle root", block: &badMerkleBlock, want: "bad-txnmrklroot"},
+		{name: "stale previous block", block: &badPrevBlock, want: "bad-prevblk"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.block.Serialize(&buf); err != nil {
+			t.Fatalf("%s: unable to serialize block: %v", test.name, err)
+		}
+		cmd := &btcjson.GetBlockTemplateCmd{
+			Request: &btcjson.TemplateRequest{
+				Mode: "proposal",
+				Data: hex.EncodeToString(buf.Bytes()),
+			},
+		}
+		result, err := handleGetBlockTemplate(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: unexpected result - got %v, want %v",
+				test.name, result, test.want)
+		}
+	}
+
+	// Ensure a proposal without any block data is rejected with an error.
+	cmd := &btcjson.GetBlockTemplateCmd{
+		Request: &btcjson.TemplateRequest{Mode: "proposal"},
+	}
+	if _, err := handleGetBlockTemplate(s, cmd, nil); err == nil {
+		t.Fatal("proposal without data: expected error")
+	}
+}
+
+// TestHandleGetBlockTemplateRules ensures block templates advertise the active
+// soft-fork rules and are only provided to clients which support the active
+// rules that change the structure of blocks.
+func TestHandleGetBlockTemplateRules(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{RegressionTest: true}
+	defer func() { cfg = origCfg }()
+
+	newTemplateServer := func(name string, params *chaincfg.Params) (*rpcServer, func()) {
+		s, teardown := newTestNetChainRPCServer(t, name, params)
+		policy := mining.Policy{
+			BlockMaxWeight: blockMaxWeightMax,
+			BlockMaxSize:   blockMaxSizeMax,
+			TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+		}
+		timeSource := blockchain.NewMedianTime()
+		s.cfg.Generator = mining.NewBlkTmplGenerator(&policy, params,
+			s.cfg.TxMemPool, s.cfg.Chain, timeSource,
+			txscript.NewSigCache(100), txscript.NewHashCache(100))
+		s.gbtWorkState = newGbtWorkState(timeSource,
+			s.cfg.Generator.CoinbaseFlags())
+		return s, teardown
+	}
+	getBlockTemplate := func(s *rpcServer, rules []string) (*btcjson.GetBlockTemplateResult, error) {
+		cmd := &btcjson.GetBlockTemplateCmd{
+			Request: &btcjson.TemplateRequest{Rules: rules},
+		}
+		result, err := handleGetBlockTemplate(s, cmd, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.(*btcjson.GetBlockTemplateResult), nil
+	}
+
+	// Make segwit and csv active since the genesis block of a regression
+	// test network and ensure templates are only provided to clients
+	// supporting segwit then.
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCSV].AlwaysActive = true
+	params.Deployments[chaincfg.DeploymentSegwit].AlwaysActive = true
+	s, teardown := newTemplateServer("gbtrules", &params)
+	defer teardown()
+	for _, rules := range [][]string{nil, {"csv"}} {
+		_, err := getBlockTemplate(s, rules)
+		if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+			rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+			t.Fatalf("rules %v: unexpected error - got %v, want code "+
+				"%d", rules, err, btcjson.ErrRPCInvalidParameter)
+		}
+	}
+	cmd := &btcjson.GetBlockTemplateCmd{}
+	if _, err := handleGetBlockTemplate(s, cmd, nil); err == nil {
+		t.Fatal("request without parameters: expected error")
+	}
+	result, err := getBlockTemplate(s, []string{"segwit"})
+	if err != nil {
+		t.Fatalf("unexpected error with segwit rule: %v", err)
+	}
+	wantRules := []string{"csv", "!segwit"}
+	if !reflect.DeepEqual(result.Rules, wantRules) {
+		t.Fatalf("unexpected rules - got %v, want %v", result.Rules,
+			wantRules)
+	}
+	if _, ok := result.VbAvailable["segwit"]; ok {
+		t.Fatal("active segwit deployment advertised as available")
+	}
+
+	// Segwit is not active on a new regression test network, so templates
+	// must also be provided to clients which don't support it.
+	s, teardown = newTemplateServer("gbtrulesinactive",
+		&chaincfg.RegressionNetParams)
+	defer teardown()
+	result, err = getBlockTemplate(s, nil)
+	if err != nil {
+		t.Fatalf("unexpected error without segwit rule before "+
+			"activation: %v", err)
+	}
+	if len(result.Rules) != 0 {
+		t.Fatalf("unexpected rules before activation - got %v",
+			result.Rules)
+	}
+}
+
+// TestHandleGetTxOutSetInfo ensures the gettxoutsetinfo RPC only calculates
+// the serialized hash of the utxo set when requested and rejects unknown hash
+// types.
+func TestHandleGetTxOutSetInfo(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "gettxoutsetinfo")
+	defer teardown()
+
+	genesisHash := s.cfg.ChainParams.GenesisHash
+	tests := []struct {
+		name     string
+		hashType *string
+		wantHash bool
+		wantCode btcjson.RPCErrorCode
+	}{
+		{name: "default hash type", wantHash: true},
+		{name: "serialized hash", hashType: btcjson.String("hash_serialized_2"), wantHash: true},
+		{name: "no hash", hashType: btcjson.String("none")},
+		{name: "ecmh without coin stats index", hashType: btcjson.String("ecmh"), wantCode: btcjson.ErrRPCMisc},
+		{name: "unknown hash type", hashType: btcjson.String("muhash"), wantCode: btcjson.ErrRPCInvalidParameter},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewGetTxOutSetInfoCmd()
+		if test.hashType != nil {
+			cmd = btcjson.NewGetTxOutSetInfoHashTypeCmd(*test.hashType)
+		}
+		result, err := handleGetTxOutSetInfo(s, cmd, nil)
+		if test.wantCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.wantCode {
+				t.Errorf("%s: unexpected error - got %v, want code %d",
+					test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		info := result.(*btcjson.GetTxOutSetInfoResult)
+		if info.Height != 0 || info.BestBlock != *genesisHash {
+			t.Errorf("%s: unexpected best block - got %v (%d), "+
+				"want %v (0)", test.name, info.BestBlock,
+				info.Height, genesisHash)
+		}
+		if info.TxOuts != 0 || info.TotalAmount != 0 {
+			t.Errorf("%s: unexpected utxo set - got %d outputs "+
+				"with total %v, want none", test.name,
+				info.TxOuts, info.TotalAmount)
+		}
+		gotHash := info.HashSerialized != chainhash.Hash{}
+		if gotHash != test.wantHash {
+			t.Errorf("%s: unexpected serialized hash %v", test.name,
+				info.HashSerialized)
+		}
+	}
+}
+
+// TestHandleDumpTxOutSet ensures the dumptxoutset RPC writes a utxo snapshot of
+// the utxo set as of the best block which commits to its serialized hash, loads
+// into another chain, and never overwrites an existing file.
+func TestHandleDumpTxOutSet(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "dumptxoutset")
+	defer teardown()
+	addTestChainBlock(t, s)
+	addTestChainBlock(t, s)
+
+	dataDir, err := ioutil.TempDir("", "dumptxoutsetdata")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+	origCfg := cfg
+	cfg = &config{DataDir: dataDir}
+	defer func() { cfg = origCfg }()
+
+	result, err := handleDumpTxOutSet(s, btcjson.NewDumpTxOutSetCmd("utxo.dat"),
+		nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dump := result.(*btcjson.DumpTxOutSetResult)
+	stats, err := s.cfg.Chain.FetchUtxoStats(true, nil)
+	if err != nil {
+		t.Fatalf("FetchUtxoStats: unexpected error: %v", err)
+	}
+	want := btcjson.DumpTxOutSetResult{
+		CoinsWritten: stats.Outputs,
+		BaseHash:     stats.Hash.String(),
+		BaseHeight:   2,
+		Path:         filepath.Join(dataDir, "utxo.dat"),
+		TxOutSetHash: stats.SerializedHash.String(),
+	}
+	if *dump != want {
+		t.Fatalf("unexpected result - got %+v, want %+v", dump, want)
+	}
+	if _, err := os.Stat(dump.Path + ".incomplete"); !os.IsNotExist(err) {
+		t.Fatalf("temporary snapshot file was not removed")
+	}
+
+	// An existing file is never overwritten.
+	_, err = handleDumpTxOutSet(s, btcjson.NewDumpTxOutSetCmd(dump.Path), nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("unexpected error for existing file: %v", err)
+	}
+
+	// The snapshot loads into a chain which only has the genesis block.
+	params := chaincfg.RegressionNetParams
+	params.AssumeUtxoSnapshots = []chaincfg.AssumeUtxoSnapshot{{
+		Height:         stats.Height,
+		BlockHash:      &stats.Hash,
+		SerializedHash: stats.SerializedHash,
+	}}
+	other, otherTeardown := newTestNetChainRPCServer(t,
+		"dumptxoutsetload", &params)
+	defer otherTeardown()
+	f, err := os.Open(dump.Path)
+	if err != nil {
+		t.Fatalf("unable to open snapshot: %v", err)
+	}
+	defer f.Close()
+	if err := other.cfg.Chain.LoadUtxoSnapshot(f, &stats.Hash); err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+	snapshot := other.cfg.Chain.SnapshotChainState()
+	if snapshot == nil || snapshot.Coins != stats.Outputs {
+		t.Fatalf("unexpected snapshot chainstate %+v", snapshot)
+	}
+}
+
+// TestHandleGetBlockVerbosity ensures the getblock RPC returns the same block
+// details for verbosity levels 1 and 2 and that level 2 additionally includes
+// the decoded transactions along with the outputs they spend and their fees.
+func TestHandleGetBlockVerbosity(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getblockverbosity")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbase of the first one to mature and
+	// spend it in the next block while paying a fee.
+	const fee = 10000
+	first := addTestChainBlock(t, s)
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	coinbaseHash := first.Transactions[0].TxHash()
+	coinbaseValue := first.Transactions[0].TxOut[0].Value
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(coinbaseValue/2, []byte{txscript.OP_TRUE}))
+	spend.AddTxOut(wire.NewTxOut(coinbaseValue/2-fee,
+		[]byte{txscript.OP_TRUE}))
+	block := addTestChainBlock(t, s, spend)
+	blockHash := block.BlockHash()
+
+	result, err := handleGetBlock(s, btcjson.NewGetBlockCmd(
+		blockHash.String(), btcjson.Int(1)), nil)
+	if err != nil {
+		t.Fatalf("verbosity 1: unexpected error: %v", err)
+	}
+	verbose, ok := result.(btcjson.GetBlockVerboseResult)
+	if !ok {
+		t.Fatalf("verbosity 1: unexpected result type %T", result)
+	}
+	result, err = handleGetBlock(s, btcjson.NewGetBlockCmd(
+		blockHash.String(), btcjson.Int(2)), nil)
+	if err != nil {
+		t.Fatalf("verbosity 2: unexpected error: %v", err)
+	}
+	verboseTx, ok := result.(btcjson.GetBlockVerboseTxResult)
+	if !ok {
+		t.Fatalf("verbosity 2: unexpected result type %T", result)
+	}
+
+	// The block details must be identical aside from the transactions.
+	wantHeader := verbose
+	wantHeader.Tx = nil
+	gotHeader := btcjson.GetBlockVerboseResult{
+		Hash:          verboseTx.Hash,
+		Confirmations: verboseTx.Confirmations,
+		StrippedSize:  verboseTx.StrippedSize,
+		Size:          verboseTx.Size,
+		Weight:        verboseTx.Weight,
+		Height:        verboseTx.Height,
+		Version:       verboseTx.Version,
+		VersionHex:    verboseTx.VersionHex,
+		MerkleRoot:    verboseTx.MerkleRoot,
+		Time:          verboseTx.Time,
+		Nonce:         verboseTx.Nonce,
+		Bits:          verboseTx.Bits,
+		Difficulty:    verboseTx.Difficulty,
+		PreviousHash:  verboseTx.PreviousHash,
+		NextHash:      verboseTx.NextHash,
+	}
+	if !reflect.DeepEqual(gotHeader, wantHeader) {
+		t.Fatalf("mismatched block details - got %+v, want %+v",
+			gotHeader, wantHeader)
+	}
+
+	// Level 2 must contain the transactions listed by level 1 in order.
+	if len(verboseTx.Tx) != len(verbose.Tx) {
+		t.Fatalf("unexpected number of transactions - got %d, want %d",
+			len(verboseTx.Tx), len(verbose.Tx))
+	}
+	for i, txid := range verbose.Tx {
+		if verboseTx.Tx[i].Txid != txid {
+			t.Fatalf("transaction %d: unexpected txid - got %s, "+
+				"want %s", i, verboseTx.Tx[i].Txid, txid)
+		}
+		if verboseTx.Tx[i].BlockHash != blockHash.String() {
+			t.Fatalf("transaction %d: unexpected block hash - got "+
+				"%s, want %s", i, verboseTx.Tx[i].BlockHash,
+				blockHash)
+		}
+	}
+
+	// The coinbase doesn't spend anything, so it must not have a fee.
+	coinbaseTx := verboseTx.Tx[0]
+	if coinbaseTx.Fee != nil || coinbaseTx.Vin[0].PrevOut != nil {
+		t.Fatalf("coinbase: unexpected fee or previous output")
+	}
+
+	// The spending transaction must include the spent output and its fee.
+	spendTx := verboseTx.Tx[1]
+	prevOut := spendTx.Vin[0].PrevOut
+	wantValue := btcutil.Amount(coinbaseValue).ToBTC()
+	if prevOut == nil || prevOut.Value != wantValue {
+		t.Fatalf("spend: unexpected previous output - got %+v, want "+
+			"value %v", prevOut, wantValue)
+	}
+	wantFee := btcutil.Amount(fee).ToBTC()
+	if spendTx.Fee == nil || *spendTx.Fee != wantFee {
+		t.Fatalf("spend: unexpected fee - got %v, want %v", spendTx.Fee,
+			wantFee)
+	}
+}
+
+// TestHandleGetRawTransactionPrevOuts ensures the verbose getrawtransaction
+// RPC includes the outputs spent by a transaction along with its fee when the
+// transaction index is enabled and omits them for coinbase transactions and
+// when the transaction index is disabled.
+func TestHandleGetRawTransactionPrevOuts(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getrawtxprevouts")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbases of the first two to mature,
+	// then spend the first one in a block and the second one in a
+	// transaction in the memory pool.
+	const fee = 10000
+	newSpend := func(block *wire.MsgBlock) *wire.MsgTx {
+		coinbaseHash := block.Transactions[0].TxHash()
+		value := block.Transactions[0].TxOut[0].Value
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0),
+			nil, nil))
+		spend.AddTxOut(wire.NewTxOut(value-fee, []byte{txscript.OP_TRUE}))
+		return spend
+	}
+	first := addTestChainBlock(t, s)
+	second := addTestChainBlock(t, s)
+	for i := uint16(2); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	minedSpend := newSpend(first)
+	addTestChainBlock(t, s, minedSpend)
+	poolSpend := newSpend(second)
+	_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(poolSpend),
+		false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to add transaction to the memory pool: %v", err)
+	}
+
+	subsidy := btcutil.Amount(blockchain.CalcBlockSubsidy(1, params)).ToBTC()
+	txIndex := s.cfg.TxIndex
+	tests := []struct {
+		name        string
+		tx          *wire.MsgTx
+		noTxIndex   bool
+		wantPrevOut bool
+	}{
+		{name: "mined spend", tx: minedSpend, wantPrevOut: true},
+		{name: "mempool spend", tx: poolSpend, wantPrevOut: true},
+		{name: "coinbase", tx: first.Transactions[0]},
+		{name: "txindex disabled", tx: poolSpend, noTxIndex: true},
+	}
+	for _, test := range tests {
+		s.cfg.TxIndex = txIndex
+		if test.noTxIndex {
+			s.cfg.TxIndex = nil
+		}
+
+		cmd := btcjson.NewGetRawTransactionCmd(test.tx.TxHash().String(),
+			btcjson.Int(1))
+		result, err := handleGetRawTransaction(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		rawTxn := result.(btcjson.TxRawResult)
+
+		if !test.wantPrevOut {
+			if rawTxn.Fee != nil || rawTxn.Vin[0].PrevOut != nil {
+				t.Errorf("%s: unexpected fee or previous output",
+					test.name)
+			}
+			continue
+		}
+
+		prevOut := rawTxn.Vin[0].PrevOut
+		if prevOut == nil || prevOut.Value != subsidy {
+			t.Errorf("%s: unexpected previous output - got %+v, "+
+				"want value %v", test.name, prevOut, subsidy)
+		}
+		wantFee := btcutil.Amount(fee).ToBTC()
+		if rawTxn.Fee == nil || *rawTxn.Fee != wantFee {
+			t.Errorf("%s: unexpected fee - got %v, want %v",
+				test.name, rawTxn.Fee, wantFee)
+		}
+	}
+}
+
+// TestHandleGetRawTransactionBlockHash ensures the getrawtransaction RPC finds
+// transactions in the provided block without the transaction index and returns
+// an error when the transaction is not part of the block.
+func TestHandleGetRawTransactionBlockHash(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getrawtxblockhash")
+	defer teardown()
+	s.cfg.TxIndex = nil
+
+	first := addTestChainBlock(t, s)
+	second := addTestChainBlock(t, s)
+	tx := first.Transactions[0]
+	txHash := tx.TxHash().String()
+	firstHash := first.BlockHash().String()
+
+	// The transaction can't be found without the transaction index unless
+	// the block is provided.
+	cmd := btcjson.NewGetRawTransactionCmd(txHash, nil)
+	if _, err := handleGetRawTransaction(s, cmd, nil); err == nil {
+		t.Fatal("handleGetRawTransaction: did not receive expected " +
+			"error without the transaction index")
+	}
+	cmd = btcjson.NewGetRawTransactionInBlockCmd(txHash, nil, firstHash)
+	result, err := handleGetRawTransaction(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("handleGetRawTransaction: unexpected error: %v", err)
+	}
+	wantHex, err := messageToHex(tx)
+	if err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	if result != wantHex {
+		t.Fatalf("unexpected transaction - got %v, want %v", result,
+			wantHex)
+	}
+
+	cmd = btcjson.NewGetRawTransactionInBlockCmd(txHash,
+		btcjson.Int(1), firstHash)
+	result, err = handleGetRawTransaction(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("handleGetRawTransaction: unexpected error: %v", err)
+	}
+	rawTxn := result.(btcjson.TxRawResult)
+	if rawTxn.Txid != txHash || rawTxn.BlockHash != firstHash ||
+		rawTxn.Confirmations != 2 || rawTxn.InActiveChain == nil ||
+		!*rawTxn.InActiveChain {
+
+		t.Fatalf("unexpected verbose result %+v", rawTxn)
+	}
+
+	// Transactions which are not part of the provided block and blocks
+	// which are not known are rejected.
+	secondHash := second.BlockHash().String()
+	unknownHash := chainhash.Hash{0x01}.String()
+	tests := []struct {
+		name      string
+		blockHash string
+		wantCode  btcjson.RPCErrorCode
+	}{
+		{name: "other block", blockHash: secondHash, wantCode: btcjson.ErrRPCNoTxInfo},
+		{name: "unknown block", blockHash: unknownHash, wantCode: btcjson.ErrRPCBlockNotFound},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewGetRawTransactionInBlockCmd(txHash,
+			btcjson.Int(1), test.blockHash)
+		_, err := handleGetRawTransaction(s, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.wantCode {
+			t.Errorf("%s: unexpected error - got %v, want code %v",
+				test.name, err, test.wantCode)
+		}
+	}
+}
+
+// TestDecodeWIF ensures private keys in the Wallet Import Format round trip
+// through decodeWIF with their compression flag and network preserved, and that
+// keys for other networks or with invalid encodings are rejected.
+func TestDecodeWIF(t *testing.T) {
+	keyBytes, err := hex.DecodeString("0c28fca386c7a227600b2fe50b7cae11ec" +
+		"86d3bf1fbe471be89827e19d72aa1d")
+	if err != nil {
+		t.Fatalf("unable to decode private key: %v", err)
+	}
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+
+	tests := []struct {
+		name     string
+		params   *chaincfg.Params
+		other    *chaincfg.Params
+		compress bool
+		encoded  string
+	}{{
+		name:    "mainnet uncompressed",
+		params:  &chaincfg.MainNetParams,
+		other:   &chaincfg.TestNet3Params,
+		encoded: "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ",
+	}, {
+		name:     "mainnet compressed",
+		params:   &chaincfg.MainNetParams,
+		other:    &chaincfg.TestNet3Params,
+		compress: true,
+		encoded:  "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617",
+	}, {
+		name:   "testnet uncompressed",
+		params: &chaincfg.TestNet3Params,
+		other:  &chaincfg.MainNetParams,
+	}, {
+		name:     "testnet compressed",
+		params:   &chaincfg.TestNet3Params,
+		other:    &chaincfg.MainNetParams,
+		compress: true,
+	}}
+	for _, test := range tests {
+		wif, err := btcutil.NewWIF(privKey, test.params, test.compress)
+		if err != nil {
+			t.Fatalf("%s: unable to create wif: %v", test.name, err)
+		}
+		encoded := wif.String()
+		if test.encoded != "" && encoded != test.encoded {
+			t.Fatalf("%s: unexpected encoding - got %s, want %s",
+				test.name, encoded, test.encoded)
+		}
+
+		decoded, err := decodeWIF(encoded, test.params)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if decoded.CompressPubKey != test.compress {
+			t.Errorf("%s: unexpected compression flag %v", test.name,
+				decoded.CompressPubKey)
+		}
+		if !decoded.IsForNet(test.params) {
+			t.Errorf("%s: decoded key is not for %s", test.name,
+				test.params.Name)
+		}
+		if !bytes.Equal(decoded.PrivKey.Serialize(), keyBytes) {
+			t.Errorf("%s: unexpected private key %x", test.name,
+				decoded.PrivKey.Serialize())
+		}
+		wantPubKey := pubKey.SerializeUncompressed()
+		if test.compress {
+			wantPubKey = pubKey.SerializeCompressed()
+		}
+		if !bytes.Equal(decoded.SerializePubKey(), wantPubKey) {
+			t.Errorf("%s: unexpected public key - got %x, want %x",
+				test.name, decoded.SerializePubKey(), wantPubKey)
+		}
+		if decoded.String() != encoded {
+			t.Errorf("%s: unexpected re-encoding - got %s, want %s",
+				test.name, decoded.String(), encoded)
+		}
+
+		_, err = decodeWIF(encoded, test.other)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidAddressOrKey ||
+			rpcErr.Message != "Private key for wrong network" {
+
+			t.Errorf("%s: unexpected error decoding for %s: %v",
+				test.name, test.other.Name, err)
+		}
+	}
+
+	// Ensure malformed keys and keys with a bad checksum are rejected.
+	valid := "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"
+	invalid := []struct {
+		encoded string
+		message string
+	}{
+		{valid[:10], "Malformed private key"},
+		{valid[:len(valid)-1] + "8", "Private key checksum mismatch"},
+	}
+	for _, test := range invalid {
+		_, err := decodeWIF(test.encoded, &chaincfg.MainNetParams)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidAddressOrKey ||
+			rpcErr.Message != test.message {
+
+			t.Errorf("%s: unexpected error - got %v, want %q",
+				test.encoded, err, test.message)
+		}
+	}
+}
+
+// TestHandleSignRawTransactionWithKey ensures the signrawtransactionwithkey
+// RPC signs inputs spending the supported output types with the provided keys
+// such that the signatures validate and reports the inputs it can't sign.
+func TestHandleSignRawTransactionWithKey(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	s := &rpcServer{cfg: rpcserverConfig{ChainParams: params}}
+
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create private key: %v", err)
+	}
+	wif, err := btcutil.NewWIF(privKey, params, true)
+	if err != nil {
+		t.Fatalf("unable to create wif: %v", err)
+	}
+	pubKeyHash := btcutil.Hash160(wif.SerializePubKey())
+	mustPayToAddr := func(addr btcutil.Address, err error) []byte {
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("unable to create script: %v", err)
+		}
+		return pkScript
+	}
+	p2pkh := mustPayToAddr(btcutil.NewAddressPubKeyHash(pubKeyHash, params))
+	p2wpkh := mustPayToAddr(btcutil.NewAddressWitnessPubKeyHash(pubKeyHash,
+		params))
+	p2shP2wpkh := mustPayToAddr(btcutil.NewAddressScriptHash(p2wpkh, params))
+	otherP2wpkh := mustPayToAddr(btcutil.NewAddressWitnessPubKeyHash(
+		make([]byte, 20), params))
+
+	tests := []struct {
+		name        string
+		pkScript    []byte
+		wantWitness bool
+		wantSigned  bool
+	}{
+		{name: "p2wpkh", pkScript: p2wpkh, wantWitness: true, wantSigned: true},
+		{name: "p2sh-p2wpkh", pkScript: p2shP2wpkh, wantWitness: true, wantSigned: true},
+		{name: "p2pkh", pkScript: p2pkh, wantSigned: true},
+		{name: "unknown key", pkScript: otherP2wpkh},
+	}
+	for _, test := range tests {
+		const amount = 100000000
+		prevHash := chainhash.Hash{0x01}
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(amount-1000, p2wpkh))
+		txHex, err := messageToHex(tx)
+		if err != nil {
+			t.Fatalf("%s: unable to serialize transaction: %v",
+				test.name, err)
+		}
+
+		inputs := []btcjson.RawTxWitnessInput{{
+			Txid:         prevHash.String(),
+			Vout:         0,
+			ScriptPubKey: hex.EncodeToString(test.pkScript),
+			Amount:       btcjson.Float64(btcutil.Amount(amount).ToBTC()),
+		}}
+		cmd := btcjson.NewSignRawTransactionWithKeyCmd(txHex,
+			[]string{wif.String()}, &inputs, btcjson.String("ALL"))
+		result, err := handleSignRawTransactionWithKey(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		reply := result.(*btcjson.SignRawTransactionWithKeyResult)
+		if reply.Complete != test.wantSigned {
+			t.Errorf("%s: unexpected complete flag - got %v, want %v "+
+				"(errors %v)", test.name, reply.Complete,
+				test.wantSigned, reply.Errors)
+			continue
+		}
+		if !test.wantSigned {
+			if len(reply.Errors) != 1 || reply.Errors[0].TxID !=
+				prevHash.String() {
+
+				t.Errorf("%s: unexpected errors %v", test.name,
+					reply.Errors)
+			}
+			continue
+		}
+
+		// Ensure the signed input validates independently.
+		serializedTx, err := hex.DecodeString(reply.Hex)
+		if err != nil {
+			t.Fatalf("%s: unable to decode result: %v", test.name, err)
+		}
+		var signedTx wire.MsgTx
+		err = signedTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			t.Fatalf("%s: unable to deserialize result: %v",
+				test.name, err)
+		}
+		if hasWitness := len(signedTx.TxIn[0].Witness) != 0; hasWitness !=
+			test.wantWitness {
+
+			t.Errorf("%s: unexpected witness presence - got %v, "+
+				"want %v", test.name, hasWitness, test.wantWitness)
+			continue
+		}
+		vm, err := txscript.NewEngine(test.pkScript, &signedTx, 0,
+			txscript.StandardVerifyFlags, nil,
+			txscript.NewTxSigHashes(&signedTx), amount)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Errorf("%s: signed input does not validate: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestHandleCombineRawTransaction ensures the combinerawtransaction RPC
+// combines the partial signatures of a 2-of-3 multisig input from separately
+// signed transactions into a fully valid transaction.
+func TestHandleCombineRawTransaction(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "combinerawtx")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create a 2-of-3 multisig redeem script along with the keys for it.
+	wifs := make([]string, 3)
+	pubKeys := make([]*btcutil.AddressPubKey, 3)
+	for i := range wifs {
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("unable to create private key: %v", err)
+		}
+		wif, err := btcutil.NewWIF(privKey, params, true)
+		if err != nil {
+			t.Fatalf("unable to create wif: %v", err)
+		}
+		pubKey, err := btcutil.NewAddressPubKey(wif.SerializePubKey(),
+			params)
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		wifs[i], pubKeys[i] = wif.String(), pubKey
+	}
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatalf("unable to create redeem script: %v", err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		t.Fatalf("unable to create script address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+
+	// Pay a matured coinbase to the multisig script.
+	first := addTestChainBlock(t, s)
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	coinbaseHash := first.Transactions[0].TxHash()
+	amount := first.Transactions[0].TxOut[0].Value
+	fund := wire.NewMsgTx(wire.TxVersion)
+	fund.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, nil))
+	fund.AddTxOut(wire.NewTxOut(amount, pkScript))
+	addTestChainBlock(t, s, fund)
+
+	// Sign a transaction spending the multisig output with two of the
+	// keys separately.
+	fundHash := fund.TxHash()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundHash, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(amount-1000, []byte{txscript.OP_TRUE}))
+	txHex, err := messageToHex(tx)
+	if err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	redeemScriptHex := hex.EncodeToString(redeemScript)
+	inputs := []btcjson.RawTxWitnessInput{{
+		Txid:         fundHash.String(),
+		Vout:         0,
+		ScriptPubKey: hex.EncodeToString(pkScript),
+		RedeemScript: &redeemScriptHex,
+	}}
+	partialTxns := make([]string, 0, 2)
+	for _, wif := range []string{wifs[0], wifs[2]} {
+		cmd := btcjson.NewSignRawTransactionWithKeyCmd(txHex,
+			[]string{wif}, &inputs, btcjson.String("ALL"))
+		result, err := handleSignRawTransactionWithKey(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		reply := result.(*btcjson.SignRawTransactionWithKeyResult)
+		if reply.Complete {
+			t.Fatal("transaction signed with a single key is complete")
+		}
+		partialTxns = append(partialTxns, reply.Hex)
+	}
+
+	result, err := handleCombineRawTransaction(s,
+		btcjson.NewCombineRawTransactionCmd(partialTxns), nil)
+	if err != nil {
+		t.Fatalf("unable to combine transactions: %v", err)
+	}
+	combined, err := decodeRawTx(result.(string))
+	if err != nil {
+		t.Fatalf("unable to decode combined transaction: %v", err)
+	}
+	vm, err := txscript.NewEngine(pkScript, combined, 0,
+		txscript.StandardVerifyFlags, nil, nil, amount)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if err != nil {
+		t.Fatalf("combined transaction does not validate: %v", err)
+	}
+
+	// Transactions which differ in more than their signatures can't be
+	// combined.
+	tx.TxOut[0].Value--
+	otherHex, err := messageToHex(tx)
+	if err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	cmd := btcjson.NewCombineRawTransactionCmd([]string{partialTxns[0],
+		otherHex})
+	if _, err := handleCombineRawTransaction(s, cmd, nil); err == nil {
+		t.Fatal("combined different transactions")
+	}
+}
+
+// TestTxRawResultWeight ensures the decoderawtransaction and verbose
+// getrawtransaction results report the size, virtual size, and weight of both
+// segwit and legacy transactions as defined by BIP 0141.
+func TestTxRawResultWeight(t *testing.T) {
+	s := &rpcServer{cfg: rpcserverConfig{
+		ChainParams: &chaincfg.RegressionNetParams,
+	}}
+
+	newTx := func(witness wire.TxWitness) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		txIn := wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+			nil, witness)
+		if witness == nil {
+			txIn.SignatureScript = bytes.Repeat([]byte{0x01}, 107)
+		}
+		tx.AddTxIn(txIn)
+		tx.AddTxOut(wire.NewTxOut(1000, append([]byte{txscript.OP_0,
+			txscript.OP_DATA_20}, make([]byte, 20)...)))
+		return tx
+	}
+	segwitTx := newTx(wire.TxWitness{make([]byte, 72), make([]byte, 33)})
+	legacyTx := newTx(nil)
+
+	tests := []struct {
+		name   string
+		tx     *wire.MsgTx
+		segwit bool
+	}{
+		{name: "segwit", tx: segwitTx, segwit: true},
+		{name: "legacy", tx: legacyTx, segwit: false},
+	}
+	for _, test := range tests {
+		size := int32(test.tx.SerializeSize())
+		wantWeight := int32(test.tx.SerializeSizeStripped()*
+			(blockchain.WitnessScaleFactor-1)) + size
+		wantVsize := (wantWeight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor
+		if test.segwit && wantWeight >= 4*size {
+			t.Fatalf("%s: weight %d is not less than four times the "+
+				"size %d", test.name, wantWeight, size)
+		}
+		if !test.segwit && (wantWeight != 4*size || wantVsize != size) {
+			t.Fatalf("%s: weight %d and virtual size %d do not match "+
+				"the size %d", test.name, wantWeight, wantVsize,
+				size)
+		}
+
+		var buf bytes.Buffer
+		if err := test.tx.Serialize(&buf); err != nil {
+			t.Fatalf("%s: unable to serialize transaction: %v",
+				test.name, err)
+		}
+		cmd := btcjson.NewDecodeRawTransactionCmd(
+			hex.EncodeToString(buf.Bytes()))
+		result, err := handleDecodeRawTransaction(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		decoded := result.(btcjson.TxRawDecodeResult)
+		if decoded.Size != size || decoded.Vsize != wantVsize ||
+			decoded.Weight != wantWeight {
+
+			t.Errorf("%s: unexpected decoded size, vsize, and weight "+
+				"- got %d, %d, %d, want %d, %d, %d", test.name,
+				decoded.Size, decoded.Vsize, decoded.Weight, size,
+				wantVsize, wantWeight)
+		}
+
+		rawResult, err := createTxRawResult(s.cfg.ChainParams, test.tx,
+			test.tx.TxHash().String(), nil, "", 0, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if rawResult.Size != size || rawResult.Vsize != wantVsize ||
+			rawResult.Weight != wantWeight {
+
+			t.Errorf("%s: unexpected raw size, vsize, and weight - "+
+				"got %d, %d, %d, want %d, %d, %d", test.name,
+				rawResult.Size, rawResult.Vsize, rawResult.Weight,
+				size, wantVsize, wantWeight)
+		}
+	}
+}
+
+// TestHandleDecodeScript ensures the decodescript RPC classifies scripts and
+// derives their addresses along with the pay-to-script-hash and
+// pay-to-witness-script-hash addresses of scripts that can be redeemed.
+func TestHandleDecodeScript(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	s := &rpcServer{cfg: rpcserverConfig{ChainParams: params}}
+
+	pubKeys := make([]*btcutil.AddressPubKey, 3)
+	for i := range pubKeys {
+		_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), []byte{byte(i + 1)})
+		addr, err := btcutil.NewAddressPubKey(pubKey.SerializeCompressed(),
+			params)
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		pubKeys[i] = addr
+	}
+	multiSig, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatalf("unable to create multisig script: %v", err)
+	}
+	p2sh, err := btcutil.NewAddressScriptHash(multiSig, params)
+	if err != nil {
+		t.Fatalf("unable to create p2sh address: %v", err)
+	}
+	scriptHash := sha256.Sum256(multiSig)
+	p2wsh, err := btcutil.NewAddressWitnessScriptHash(scriptHash[:], params)
+	if err != nil {
+		t.Fatalf("unable to create p2wsh address: %v", err)
+	}
+
+	p2wpkhAddr, err := btcutil.NewAddressWitnessPubKeyHash(
+		pubKeys[0].AddressPubKeyHash().ScriptAddress(), params)
+	if err != nil {
+		t.Fatalf("unable to create p2wpkh address: %v", err)
+	}
+	p2wpkh, err := txscript.PayToAddrScript(p2wpkhAddr)
+	if err != nil {
+		t.Fatalf("unable to create p2wpkh script: %v", err)
+	}
+	p2wpkhP2sh, err := btcutil.NewAddressScriptHash(p2wpkh, params)
+	if err != nil {
+		t.Fatalf("unable to create p2sh address: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   btcjson.DecodeScriptResult
+	}{
+		{
+			name:   "2-of-3 multisig redeem script",
+			script: multiSig,
+			want: btcjson.DecodeScriptResult{
+				ReqSigs: 2,
+				Type:    "multisig",
+				Addresses: []string{
+					pubKeys[0].EncodeAddress(),
+					pubKeys[1].EncodeAddress(),
+					pubKeys[2].EncodeAddress(),
+				},
+				P2sh:  p2sh.EncodeAddress(),
+				P2wsh: p2wsh.EncodeAddress(),
+			},
+		},
+		{
+			name:   "p2wpkh",
+			script: p2wpkh,
+			want: btcjson.DecodeScriptResult{
+				ReqSigs:   1,
+				Type:      "witness_v0_keyhash",
+				Addresses: []string{p2wpkhAddr.EncodeAddress()},
+				P2sh:      p2wpkhP2sh.EncodeAddress(),
+			},
+		},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewDecodeScriptCmd(hex.EncodeToString(test.script))
+		result, err := handleDecodeScript(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		reply := result.(btcjson.DecodeScriptResult)
+
+		disasm, err := txscript.DisasmString(test.script)
+		if err != nil {
+			t.Fatalf("%s: unable to disassemble script: %v",
+				test.name, err)
+		}
+		test.want.Asm = disasm
+		if !reflect.DeepEqual(reply, test.want) {
+			t.Errorf("%s: unexpected result - got %+v, want %+v",
+				test.name, reply, test.want)
+		}
+	}
+}
+
+// TestHandleEstimateSmartFee ensures the estimatesmartfee RPC rejects invalid
+// parameters and reports errors when no estimate is available.
+func TestHandleEstimateSmartFee(t *testing.T) {
+	economical := btcjson.EstimateModeEconomical
+	invalidMode := btcjson.EstimateSmartFeeMode("FAST")
+	tests := []struct {
+		name                string
+		confTarget          int64
+		mode                *btcjson.EstimateSmartFeeMode
+		minRegisteredBlocks uint32
+		wantCode            btcjson.RPCErrorCode
+		wantErrors          []string
+	}{{
+		name:       "zero target",
+		confTarget: 0,
+		wantCode:   btcjson.ErrRPCInvalidParameter,
+	}, {
+		name:       "invalid mode",
+		confTarget: 2,
+		mode:       &invalidMode,
+		wantCode:   btcjson.ErrRPCInvalidParameter,
+	}, {
+		name:       "no data",
+		confTarget: 2,
+		mode:       &economical,
+		wantErrors: []string{"Insufficient data or no feerate found"},
+	}, {
+		name:                "too few blocks",
+		confTarget:          1000,
+		minRegisteredBlocks: 1,
+		wantErrors:          []string{"not enough blocks have been observed"},
+	}}
+	for _, test := range tests {
+		s := &rpcServer{cfg: rpcserverConfig{
+			FeeEstimator: mempool.NewFeeEstimator(
+				mempool.DefaultEstimateFeeMaxRollback,
+				test.minRegisteredBlocks),
+		}}
+		cmd := btcjson.NewEstimateSmartFeeCmd(test.confTarget, test.mode)
+		result, err := handleEstimateSmartFee(s, cmd, nil)
+		if test.wantCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.wantCode {
+				t.Errorf("%s: unexpected error - got %v, want code %d",
+					test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		want := &btcjson.EstimateSmartFeeResult{Errors: test.wantErrors}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("%s: unexpected result - got %+v, want %+v",
+				test.name, result, want)
+		}
+	}
+}
+
+// TestHandleTestMempoolAccept ensures the testmempoolaccept RPC reports
+// whether transactions would be accepted into the memory pool along with the
+// fees of the acceptable ones without adding any of them.
+func TestHandleTestMempoolAccept(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "testmempoolaccept")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbases of the first three to mature.
+	var coinbases []*wire.MsgTx
+	for i := uint16(0); i < params.CoinbaseMaturity+2; i++ {
+		block := addTestChainBlock(t, s)
+		if i < 3 {
+			coinbases = append(coinbases, block.Transactions[0])
+		}
+	}
+	newSpend := func(coinbase *wire.MsgTx, fee int64, numOutputs int) *wire.MsgTx {
+		coinbaseHash := coinbase.TxHash()
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0),
+			nil, nil))
+		value := (coinbase.TxOut[0].Value - fee) / int64(numOutputs)
+		for i := 0; i < numOutputs; i++ {
+			spend.AddTxOut(wire.NewTxOut(value,
+				[]byte{txscript.OP_TRUE}))
+		}
+		return spend
+	}
+
+	// The transaction which pays no fee is large enough to require one.
+	const fee = 10000
+	acceptable := newSpend(coinbases[0], fee, 1)
+	insufficientFee := newSpend(coinbases[1], 0, 5000)
+	poolSpend := newSpend(coinbases[2], fee, 1)
+	_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(poolSpend),
+		false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to add transaction to the memory pool: %v", err)
+	}
+	doubleSpend := newSpend(coinbases[2], fee, 2)
+
+	txns := []*wire.MsgTx{acceptable, insufficientFee, doubleSpend}
+	rawTxns := make([]string, 0, len(txns))
+	for _, tx := range txns {
+		rawTxn, err := messageToHex(tx)
+		if err != nil {
+			t.Fatalf("unable to serialize transaction: %v", err)
+		}
+		rawTxns = append(rawTxns, rawTxn)
+	}
+	cmd := btcjson.NewTestMempoolAcceptCmd(rawTxns)
+	result, err := handleTestMempoolAccept(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := result.([]btcjson.TestMempoolAcceptResult)
+	if len(results) != len(txns) {
+		t.Fatalf("unexpected number of results - got %d, want %d",
+			len(results), len(txns))
+	}
+	for i, tx := range txns {
+		if results[i].Txid != tx.TxHash().String() {
+			t.Errorf("result %d: unexpected txid - got %s, want %v",
+				i, results[i].Txid, tx.TxHash())
+		}
+		if s.cfg.TxMemPool.HaveTransaction(btcutil.NewTx(tx).Hash()) !=
+			(tx == poolSpend) {
+
+			t.Errorf("result %d: unexpected memory pool membership", i)
+		}
+	}
+
+	vsize := mempool.GetTxVirtualSize(btcutil.NewTx(acceptable))
+	want := btcjson.TestMempoolAcceptResult{
+		Txid:    acceptable.TxHash().String(),
+		Wtxid:   acceptable.WitnessHash().String(),
+		Allowed: true,
+		Vsize:   int32(vsize),
+		Fees: &btcjson.TestMempoolAcceptFees{
+			Base: btcutil.Amount(fee).ToBTC(),
+		},
+		FeeRate: btcutil.Amount(fee * 1000 / vsize).ToBTC(),
+	}
+	if !reflect.DeepEqual(results[0], want) {
+		t.Errorf("acceptable: unexpected result - got %+v, want %+v",
+			results[0], want)
+	}
+	if results[1].Allowed || !strings.Contains(results[1].RejectReason,
+		"under the required amount") {
+
+		t.Errorf("insufficient fee: unexpected result %+v", results[1])
+	}
+	if results[2].Allowed || !strings.Contains(results[2].RejectReason,
+		"already spent") {
+
+		t.Errorf("double spend: unexpected result %+v", results[2])
+	}
+}
+
+// TestHandleSaveLoadMempool ensures savemempool saves the transactions in the
+// memory pool to the data directory and loadmempool restores those which are
+// still valid after the memory pool was cleared.
+func TestHandleSaveLoadMempool(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "saveloadmempool")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	dataDir, err := ioutil.TempDir("", "saveloadmempool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+	origCfg := cfg
+	cfg = &config{DataDir: dataDir}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	// Ensure loading fails when the memory pool was never saved.
+	_, err = handleLoadMempool(s, btcjson.NewLoadMempoolCmd(), nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCMisc {
+
+		t.Fatalf("unexpected error loading unsaved memory pool: %v", err)
+	}
+
+	// Create enough blocks for the coinbases of the first two to mature
+	// and add a transaction spending each of them along with a child of
+	// the first one to the memory pool.
+	var coinbases []*wire.MsgTx
+	for i := uint16(0); i < params.CoinbaseMaturity+1; i++ {
+		block := addTestChainBlock(t, s)
+		if i < 2 {
+			coinbases = append(coinbases, block.Transactions[0])
+		}
+	}
+	const fee = 10000
+	newSpend := func(prevTx *wire.MsgTx) *wire.MsgTx {
+		prevHash := prevTx.TxHash()
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0),
+			nil, nil))
+		spend.AddTxOut(wire.NewTxOut(prevTx.TxOut[0].Value-fee,
+			[]byte{txscript.OP_TRUE}))
+		return spend
+	}
+	parent := newSpend(coinbases[0])
+	child := newSpend(parent)
+	mined := newSpend(coinbases[1])
+	txns := []*btcutil.Tx{btcutil.NewTx(parent), btcutil.NewTx(child),
+		btcutil.NewTx(mined)}
+	for _, tx := range txns {
+		_, err := s.cfg.TxMemPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to add transaction to the memory pool: %v",
+				err)
+		}
+	}
+
+	result, err := handleSaveMempool(s, btcjson.NewSaveMempoolCmd(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error saving memory pool: %v", err)
+	}
+	wantPath := filepath.Join(dataDir, mempoolFileName)
+	saveResult := result.(*btcjson.SaveMempoolResult)
+	if saveResult.Filename != wantPath {
+		t.Fatalf("unexpected saved memory pool path - got %s, want %s",
+			saveResult.Filename, wantPath)
+	}
+	if _, err := os.Stat(wantPath); err != nil {
+		t.Fatalf("saved memory pool file: %v", err)
+	}
+
+	// Clear the memory pool and mine one of the transactions.
+	for _, tx := range txns {
+		s.cfg.TxMemPool.RemoveTransaction(tx, true)
+	}
+	if count := s.cfg.TxMemPool.Count(); count != 0 {
+		t.Fatalf("memory pool still contains %d transactions", count)
+	}
+	addTestChainBlock(t, s, mined)
+
+	// Ensure only the transactions which are still valid are restored.
+	result, err = handleLoadMempool(s, btcjson.NewLoadMempoolCmd(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading memory pool: %v", err)
+	}
+	want := &btcjson.LoadMempoolResult{Filename: wantPath, Restored: 2}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("unexpected result - got %+v, want %+v", result, want)
+	}
+	for i, tx := range txns {
+		if s.cfg.TxMemPool.HaveTransaction(tx.Hash()) != (i < 2) {
+			t.Errorf("transaction %d: unexpected memory pool "+
+				"membership", i)
+		}
+	}
+}
+
+// testAddedNodesConnManager provides an RPC server connection manager which
+// reports the permanent connection requests of the wrapped connection manager
+// as the added nodes.  Calling any other method panics.
+type testAddedNodesConnManager struct {
+	rpcserverConnManager
+	connManager *connmgr.ConnManager
+}
+
+// AddedNodes returns the permanent connection requests of the wrapped
+// connection manager.
+func (cm *testAddedNodesConnManager) AddedNodes() []*connmgr.ConnReq {
+	return cm.connManager.PermanentConnReqs()
+}
+
+// TestHandleGetAddedNodeInfo ensures getaddednodeinfo reports added nodes both
+// before and after the connection to them is established along with their
+// connection status.
+func TestHandleGetAddedNodeInfo(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	connected := make(chan struct{})
+	connManager, err := connmgr.New(&connmgr.Config{
+		TargetOutbound: 1,
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			dialing <- struct{}{}
+			<-release
+			conn, _ := net.Pipe()
+			return conn, nil
+		},
+		OnConnection: func(c *connmgr.ConnReq, conn net.Conn) {
+			connected <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to create connection manager: %v", err)
+	}
+	connManager.Start()
+	defer func() {
+		connManager.Stop()
+		connManager.Wait()
+	}()
+	s := &rpcServer{cfg: rpcserverConfig{
+		ConnMgr: &testAddedNodesConnManager{connManager: connManager},
+	}}
+
+	// Ensure the error for nodes that have not been added is returned.
+	const node = "127.0.0.1:18555"
+	cmd := btcjson.NewGetAddedNodeInfoCmd(true, btcjson.String(node))
+	_, err = handleGetAddedNodeInfo(s, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCClientNodeNotAdded {
+
+		t.Fatalf("unexpected error for node not added - got %v, want "+
+			"code %v", err, btcjson.ErrRPCClientNodeNotAdded)
+	}
+
+	checkAddedNodeInfo := func(desc string, wantConnected string) {
+		t.Helper()
+		result, err := handleGetAddedNodeInfo(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+		want := []*btcjson.GetAddedNodeInfoResult{{
+			AddedNode: node,
+			Connected: btcjson.Bool(wantConnected != "false"),
+			Addresses: &[]btcjson.GetAddedNodeInfoResultAddr{{
+				Address:   "127.0.0.1",
+				Connected: wantConnected,
+			}},
+		}}
+		gotJSON, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("%s: unable to marshal result: %v", desc, err)
+		}
+		wantJSON, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: unable to marshal result: %v", desc, err)
+		}
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Fatalf("%s: unexpected result - got %s, want %s", desc,
+				gotJSON, wantJSON)
+		}
+
+		noDNSCmd := btcjson.NewGetAddedNodeInfoCmd(false, nil)
+		result, err = handleGetAddedNodeInfo(s, noDNSCmd, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error without dns: %v", desc, err)
+		}
+		if !reflect.DeepEqual(result, []string{node}) {
+			t.Fatalf("%s: unexpected result without dns - got %v, "+
+				"want %v", desc, result, []string{node})
+		}
+	}
+
+	// Ensure the node is reported as not connected while the connection
+	// attempt is still pending.
+	addr, err := net.ResolveTCPAddr("tcp", node)
+	if err != nil {
+		t.Fatalf("unable to resolve address: %v", err)
+	}
+	go connManager.Connect(&connmgr.ConnReq{Addr: addr, Permanent: true})
+	<-dialing
+	checkAddedNodeInfo("pending", "false")
+
+	// Ensure the node is reported as connected outbound once the
+	// connection is established.
+	close(release)
+	<-connected
+	checkAddedNodeInfo("connected", "outbound")
+}
+
+// TestHandleScanBlockFilters ensures scanblockfilters reports exactly the
+// blocks from the provided one to the best block which pay to or spend from
+// the watched addresses.
+func TestHandleScanBlockFilters(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "scanblockfilters")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbases of the first two to mature.
+	var coinbases []*wire.MsgTx
+	for i := uint16(0); i < params.CoinbaseMaturity+1; i++ {
+		block := addTestChainBlock(t, s)
+		if i < 2 {
+			coinbases = append(coinbases, block.Transactions[0])
+		}
+	}
+	startHash := s.cfg.Chain.BestSnapshot().Hash
+	startHeight := s.cfg.Chain.BestSnapshot().Height
+
+	// The watched address is a pay-to-script-hash address for a script
+	// anyone can redeem, so its outputs can be spent without signatures.
+	redeemScript := []byte{txscript.OP_TRUE}
+	watchedAddr, err := btcutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	watchedScript, err := txscript.PayToAddrScript(watchedAddr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).
+		Script()
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	newSpend := func(prevTx *wire.MsgTx, sigScript, pkScript []byte) *wire.MsgTx {
+		prevHash := prevTx.TxHash()
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0),
+			sigScript, nil))
+		spend.AddTxOut(wire.NewTxOut(prevTx.TxOut[0].Value, pkScript))
+		return spend
+	}
+
+	// Create a block paying to the watched address, a block unrelated to
+	// it, a block spending from it, and another unrelated block.
+	payment := newSpend(coinbases[0], nil, watchedScript)
+	payBlock := addTestChainBlock(t, s, payment)
+	addTestChainBlock(t, s, newSpend(coinbases[1], nil,
+		[]byte{txscript.OP_TRUE}))
+	spendBlock := addTestChainBlock(t, s, newSpend(payment, sigScript,
+		[]byte{txscript.OP_TRUE}))
+	addTestChainBlock(t, s)
+	endHeight := s.cfg.Chain.BestSnapshot().Height
+
+	otherAddr, err := btcutil.NewAddressScriptHash([]byte{txscript.OP_2},
+		params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	tests := []struct {
+		name       string
+		startHash  string
+		addresses  []string
+		wantHeight int32
+		wantBlocks []string
+	}{
+		{
+			name:       "watched address",
+			startHash:  startHash.String(),
+			addresses:  []string{watchedAddr.String()},
+			wantHeight: startHeight,
+			wantBlocks: []string{payBlock.BlockHash().String(),
+				spendBlock.BlockHash().String()},
+		},
+		{
+			name:      "watched address among others",
+			startHash: startHash.String(),
+			addresses: []string{otherAddr.String(),
+				watchedAddr.String()},
+			wantHeight: startHeight,
+			wantBlocks: []string{payBlock.BlockHash().String(),
+				spendBlock.BlockHash().String()},
+		},
+		{
+			name:       "start after payment",
+			startHash:  spendBlock.Header.PrevBlock.String(),
+			addresses:  []string{watchedAddr.String()},
+			wantHeight: startHeight + 2,
+			wantBlocks: []string{spendBlock.BlockHash().String()},
+		},
+		{
+			name:       "unrelated address",
+			startHash:  startHash.String(),
+			addresses:  []string{otherAddr.String()},
+			wantHeight: startHeight,
+			wantBlocks: []string{},
+		},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewScanBlockFiltersCmd(test.startHash,
+			test.addresses, nil)
+		result, err := handleScanBlockFilters(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		want := &btcjson.ScanBlockFiltersResult{
+			FromHeight: test.wantHeight,
+			ToHeight:   endHeight,
+			Blocks:     test.wantBlocks,
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("%s: unexpected result - got %+v, want %+v",
+				test.name, result, want)
+		}
+	}
+
+	// Ensure blocks which are not in the main chain are rejected.
+	cmd := btcjson.NewScanBlockFiltersCmd(chainhash.Hash{0x01}.String(),
+		[]string{watchedAddr.String()}, nil)
+	_, err = handleScanBlockFilters(s, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCBlockNotFound {
+
+		t.Fatalf("unexpected error for unknown block - got %v, want "+
+			"code %v", err, btcjson.ErrRPCBlockNotFound)
+	}
+}
+
+// TestHandleGetCFilters ensures getcfilters returns the committed filters of
+// the requested range of blocks in order and rejects ranges that exceed the
+// maximum allowed number of filters.
+func TestHandleGetCFilters(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getcfilters")
+	defer teardown()
+
+	var blocks []*wire.MsgBlock
+	for i := 0; i < wire.MaxGetCFiltersReqRange; i++ {
+		blocks = append(blocks, addTestChainBlock(t, s))
+	}
+
+	// Ensure the filters of a range are returned in order.
+	stopHash := blocks[9].BlockHash()
+	cmd := btcjson.NewGetCFiltersCmd(5, stopHash.String(),
+		wire.GCSFilterRegular)
+	result, err := handleGetCFilters(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var want []btcjson.GetCFiltersResult
+	for _, block := range blocks[4:10] {
+		blockHash := block.BlockHash()
+		filterBytes, err := s.cfg.CfIndex.FilterByBlockHash(&blockHash,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("unable to fetch filter: %v", err)
+		}
+		want = append(want, btcjson.GetCFiltersResult{
+			BlockHash: blockHash.String(),
+			Filter:    hex.EncodeToString(filterBytes),
+		})
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("unexpected result - got %+v, want %+v", result, want)
+	}
+
+	// Ensure the maximum number of filters is returned, including the
+	// filter of the genesis block, and that ranges exceeding it are
+	// rejected.
+	stopHash = blocks[len(blocks)-2].BlockHash()
+	cmd = btcjson.NewGetCFiltersCmd(0, stopHash.String(),
+		wire.GCSFilterRegular)
+	result, err = handleGetCFilters(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("unexpected error for max range: %v", err)
+	}
+	results := result.([]btcjson.GetCFiltersResult)
+	if len(results) != wire.MaxGetCFiltersReqRange {
+		t.Fatalf("unexpected number of filters - got %d, want %d",
+			len(results), wire.MaxGetCFiltersReqRange)
+	}
+	stopHash = blocks[len(blocks)-1].BlockHash()
+	cmd = btcjson.NewGetCFiltersCmd(0, stopHash.String(),
+		wire.GCSFilterRegular)
+	_, err = handleGetCFilters(s, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("unexpected error for range exceeding the max - got "+
+			"%v, want code %v", err, btcjson.ErrRPCInvalidParameter)
+	}
+}
+
+// TestHandleGetBlockChainInfoSizeOnDisk ensures the getblockchaininfo RPC
+// reports the size of the block files, which grows along with the chain, and
+// reports the node as not pruned without a prune height.
+func TestHandleGetBlockChainInfoSizeOnDisk(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getblockchaininfosize")
+	defer teardown()
+
+	// Each block is stored along with the network, its length and a
+	// checksum.
+	const blockOverhead = 12
+	genesis := s.cfg.ChainParams.GenesisBlock
+	wantSize := int64(genesis.SerializeSize() + blockOverhead)
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			block := addTestChainBlock(t, s)
+			wantSize += int64(block.SerializeSize() + blockOverhead)
+		}
+
+		result, err := handleGetBlockChainInfo(s, nil, nil)
+		if err != nil {
+			t.Fatalf("handleGetBlockChainInfo: unexpected error: %v",
+				err)
+		}
+		chainInfo := result.(*btcjson.GetBlockChainInfoResult)
+		if chainInfo.SizeOnDisk != wantSize {
+			t.Fatalf("unexpected size on disk at height %d - got %d, "+
+				"want %d", chainInfo.Blocks, chainInfo.SizeOnDisk,
+				wantSize)
+		}
+
+		marshalled, err := json.Marshal(chainInfo)
+		if err != nil {
+			t.Fatalf("unable to marshal result: %v", err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(marshalled, &fields); err != nil {
+			t.Fatalf("unable to unmarshal result: %v", err)
+		}
+		if pruned, ok := fields["pruned"]; !ok || pruned != false {
+			t.Fatalf("unexpected pruned field - got %v", pruned)
+		}
+		if pruneHeight, ok := fields["pruneheight"]; ok {
+			t.Fatalf("unexpected pruneheight field %v for node "+
+				"which is not pruned", pruneHeight)
+		}
+	}
+}
+
+// TestHandleGetBlockHeader ensures the verbose block header result includes the
+// hash of the next block in the main chain along with the cumulative chain
+// work up to the header, and that the next block hash is omitted for the tip.
+func TestHandleGetBlockHeader(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getblockheader")
+	defer teardown()
+
+	blocks := []*wire.MsgBlock{s.cfg.ChainParams.GenesisBlock}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, addTestChainBlock(t, s))
+	}
+
+	chainWork := new(big.Int)
+	for i, block := range blocks {
+		chainWork.Add(chainWork, blockchain.CalcWork(block.Header.Bits))
+		blockHash := block.BlockHash()
+		cmd := btcjson.NewGetBlockHeaderCmd(blockHash.String(), nil)
+		result, err := handleGetBlockHeader(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", i, err)
+		}
+		header := result.(btcjson.GetBlockHeaderVerboseResult)
+
+		if header.Height != int32(i) {
+			t.Errorf("block %d: unexpected height - got %d", i,
+				header.Height)
+		}
+		if want := int64(len(blocks) - i); header.Confirmations != want {
+			t.Errorf("block %d: unexpected confirmations - got %d, "+
+				"want %d", i, header.Confirmations, want)
+		}
+		wantWork := fmt.Sprintf("%064x", chainWork)
+		if header.ChainWork != wantWork {
+			t.Errorf("block %d: unexpected chain work - got %s, "+
+				"want %s", i, header.ChainWork, wantWork)
+		}
+
+		var wantNext string
+		if i < len(blocks)-1 {
+			wantNext = blocks[i+1].BlockHash().String()
+		}
+		if header.NextHash != wantNext {
+			t.Errorf("block %d: unexpected next block hash - got "+
+				"%q, want %q", i, header.NextHash, wantNext)
+		}
+	}
+
+	// Ensure the next block hash is omitted from the marshalled result of
+	// the tip while the chain work is not.
+	tipHash := blocks[len(blocks)-1].BlockHash()
+	cmd := btcjson.NewGetBlockHeaderCmd(tipHash.String(), nil)
+	result, err := handleGetBlockHeader(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	marshalled, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unable to marshal result: %v", err)
+	}
+	if strings.Contains(string(marshalled), `"nextblockhash"`) {
+		t.Errorf("next block hash included for the tip: %s", marshalled)
+	}
+	if !strings.Contains(string(marshalled), `"chainwork"`) {
+		t.Errorf("chain work not included for the tip: %s", marshalled)
+	}
+}
+
+// TestHandleGetMiningInfo ensures the getmininginfo RPC reports the state of
+// the best chain and the memory pool along with the statistics of the most
+// recently generated block template once there is one.
+func TestHandleGetMiningInfo(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getmininginfo")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	origCfg := cfg
+	cfg = &config{}
+	defer func() { cfg = origCfg }()
+
+	policy := mining.Policy{
+		BlockMaxWeight: blockMaxWeightMax,
+		BlockMaxSize:   blockMaxSizeMax,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+	}
+	s.cfg.Generator = mining.NewBlkTmplGenerator(&policy, params,
+		s.cfg.TxMemPool, s.cfg.Chain, blockchain.NewMedianTime(),
+		txscript.NewSigCache(100), txscript.NewHashCache(100))
+	s.cfg.CPUMiner = cpuminer.New(&cpuminer.Config{
+		ChainParams:            params,
+		BlockTemplateGenerator: s.cfg.Generator,
+	})
+
+	// Create enough blocks for the coinbases of the first two to mature
+	// and spend them in transactions in the memory pool.
+	first := addTestChainBlock(t, s)
+	second := addTestChainBlock(t, s)
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	for _, block := range []*wire.MsgBlock{first, second} {
+		coinbaseHash := block.Transactions[0].TxHash()
+		value := block.Transactions[0].TxOut[0].Value
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0),
+			nil, nil))
+		spend.AddTxOut(wire.NewTxOut(value-10000,
+			[]byte{txscript.OP_TRUE}))
+		_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(spend),
+			false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to add transaction to the memory pool: %v",
+				err)
+		}
+	}
+
+	getMiningInfo := func() *btcjson.GetMiningInfoResult {
+		t.Helper()
+		result, err := handleGetMiningInfo(s, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result.(*btcjson.GetMiningInfoResult)
+	}
+
+	// Ensure the chain and memory pool state is reported and that there
+	// are no template statistics before a template is generated.
+	info := getMiningInfo()
+	best := s.cfg.Chain.BestSnapshot()
+	if info.Blocks != int64(best.Height) {
+		t.Errorf("unexpected blocks - got %d, want %d", info.Blocks,
+			best.Height)
+	}
+	// The difficulty is relative to the proof of work limit of the network
+	// which all of the blocks are at.
+	const wantDifficulty = 1
+	if info.Difficulty != wantDifficulty {
+		t.Errorf("unexpected difficulty - got %v, want %v",
+			info.Difficulty, wantDifficulty)
+	}
+	if info.PooledTx != 2 {
+		t.Errorf("unexpected pooled transactions - got %d, want 2",
+			info.PooledTx)
+	}
+	if info.Chain != params.Name {
+		t.Errorf("unexpected chain - got %q, want %q", info.Chain,
+			params.Name)
+	}
+	if info.CurrentBlockTx != 0 || info.CurrentBlockSize != 0 ||
+		info.CurrentBlockWeight != 0 {
+
+		t.Errorf("unexpected template statistics without a template - "+
+			"got %+v", info)
+	}
+
+	// Ensure the statistics of a generated template are reported.
+	template, err := s.cfg.Generator.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatalf("unable to generate block template: %v", err)
+	}
+	block := btcutil.NewBlock(template.Block)
+	info = getMiningInfo()
+	if info.CurrentBlockTx != 2 {
+		t.Errorf("unexpected template transactions - got %d, want 2",
+			info.CurrentBlockTx)
+	}
+	wantSize := uint64(template.Block.SerializeSize())
+	if info.CurrentBlockSize != wantSize {
+		t.Errorf("unexpected template size - got %d, want %d",
+			info.CurrentBlockSize, wantSize)
+	}
+	wantWeight := uint64(blockchain.GetBlockWeight(block))
+	if info.CurrentBlockWeight != wantWeight {
+		t.Errorf("unexpected template weight - got %d, want %d",
+			info.CurrentBlockWeight, wantWeight)
+	}
+}
+
+// TestNewBlockTemplatePolicy ensures block templates stay under the maximum
+// block weight and size of the mining policy, skip transactions paying less
+// than its minimum transaction fee, and prefer higher fee transactions when
+// not all of them fit.
+func TestNewBlockTemplatePolicy(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "newblocktemplatepolicy")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbases of the first four to mature
+	// and spend them in transactions of the same size with increasing fees
+	// in the memory pool.
+	var coinbases []*wire.MsgTx
+	for i := 0; i < 4; i++ {
+		coinbases = append(coinbases, addTestChainBlock(t, s).Transactions[0])
+	}
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	fees := []int64{2000, 4000, 8000, 16000}
+	var spends []*wire.MsgTx
+	for i, coinbase := range coinbases {
+		coinbaseHash := coinbase.TxHash()
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0),
+			nil, nil))
+		spend.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value-fees[i],
+			[]byte{txscript.OP_TRUE}))
+		_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(spend),
+			false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to add transaction to the memory pool: %v",
+				err)
+		}
+		spends = append(spends, spend)
+	}
+
+	newBlockTemplate := func(policy mining.Policy) *wire.MsgBlock {
+		t.Helper()
+		generator := mining.NewBlkTmplGenerator(&policy, params,
+			s.cfg.TxMemPool, s.cfg.Chain, blockchain.NewMedianTime(),
+			txscript.NewSigCache(100), txscript.NewHashCache(100))
+		template, err := generator.NewBlockTemplate(nil)
+		if err != nil {
+			t.Fatalf("unable to generate block template: %v", err)
+		}
+		return template.Block
+	}
+
+	// Calculate the limits which only leave room for the coinbase and the
+	// passed number of spends the same way the template generator does.
+	unlimited := mining.Policy{
+		BlockMaxWeight: blockMaxWeightMax,
+		BlockMaxSize:   blockMaxSizeMax,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+	}
+	coinbase := btcutil.NewTx(newBlockTemplate(unlimited).Transactions[0])
+	const headerOverhead = wire.MaxBlockHeaderPayload + wire.MaxVarIntPayload
+	txWeight := blockchain.GetTransactionWeight(btcutil.NewTx(spends[0]))
+	txSize := spends[0].SerializeSizeStripped()
+	maxWeight := func(numSpends int64) uint32 {
+		return uint32(headerOverhead*blockchain.WitnessScaleFactor +
+			blockchain.GetTransactionWeight(coinbase) +
+			numSpends*txWeight + 1)
+	}
+	maxSize := func(numSpends int) uint32 {
+		return uint32(headerOverhead +
+			coinbase.MsgTx().SerializeSizeStripped() +
+			numSpends*txSize + 1)
+	}
+
+	tests := []struct {
+		name   string
+		policy mining.Policy
+		want   []*wire.MsgTx
+	}{{
+		name:   "unlimited",
+		policy: unlimited,
+		want:   []*wire.MsgTx{spends[3], spends[2], spends[1], spends[0]},
+	}, {
+		name: "max weight",
+		policy: mining.Policy{
+			BlockMaxWeight: maxWeight(2),
+			BlockMaxSize:   blockMaxSizeMax,
+			TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+		},
+		want: []*wire.MsgTx{spends[3], spends[2]},
+	}, {
+		name: "max size",
+		policy: mining.Policy{
+			BlockMaxWeight: blockMaxWeightMax,
+			BlockMaxSize:   maxSize(1),
+			TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+		},
+		want: []*wire.MsgTx{spends[3]},
+	}, {
+		name: "min tx fee",
+		policy: mining.Policy{
+			BlockMaxWeight: blockMaxWeightMax,
+			BlockMaxSize:   blockMaxSizeMax,
+			TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+			BlockMinTxFee:  btcutil.Amount(fees[1] * 1000 / int64(txSize)),
+		},
+		want: []*wire.MsgTx{spends[3], spends[2], spends[1]},
+	}}
+	for _, test := range tests {
+		block := newBlockTemplate(test.policy)
+		var got []chainhash.Hash
+		for _, tx := range block.Transactions[1:] {
+			got = append(got, tx.TxHash())
+		}
+		var want []chainhash.Hash
+		for _, tx := range test.want {
+			want = append(want, tx.TxHash())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: unexpected transactions - got %v, want %v",
+				test.name, got, want)
+			continue
+		}
+		weight := blockchain.GetBlockWeight(btcutil.NewBlock(block))
+		if weight >= int64(test.policy.BlockMaxWeight) {
+			t.Errorf("%s: template weight %d exceeds the max weight %d",
+				test.name, weight, test.policy.BlockMaxWeight)
+		}
+		size := block.SerializeSizeStripped()
+		if size >= int(test.policy.BlockMaxSize) {
+			t.Errorf("%s: template size %d exceeds the max size %d",
+				test.name, size, test.policy.BlockMaxSize)
+		}
+	}
+}
+
+// TestNewBlockTemplateCoinbaseFlags ensures the coinbase flags of the mining
+// policy are included in the coinbase script of block templates regardless of
+// the extra nonce and are the flags miners are asked to include by the
+// getblocktemplate RPC.
+func TestNewBlockTemplateCoinbaseFlags(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "newblocktemplatecoinbaseflags")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	const flags = "/btcd/mined by a test/"
+	policy := mining.Policy{
+		BlockMaxWeight: blockMaxWeightMax,
+		BlockMaxSize:   blockMaxSizeMax,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+		CoinbaseFlags:  flags,
+	}
+	timeSource := blockchain.NewMedianTime()
+	generator := mining.NewBlkTmplGenerator(&policy, params,
+		s.cfg.TxMemPool, s.cfg.Chain, timeSource,
+		txscript.NewSigCache(100), txscript.NewHashCache(100))
+	template, err := generator.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatalf("unable to generate block template: %v", err)
+	}
+	block := template.Block
+	checkFlags := func() {
+		t.Helper()
+		script := block.Transactions[0].TxIn[0].SignatureScript
+		pushes, err := txscript.PushedData(script)
+		if err != nil {
+			t.Fatalf("unable to parse coinbase script: %v", err)
+		}
+		if len(pushes) == 0 || string(pushes[len(pushes)-1]) != flags {
+			t.Fatalf("coinbase script %x does not end with the "+
+				"coinbase flags", script)
+		}
+	}
+	checkFlags()
+
+	// Ensure the flags remain with the largest extra nonce and the block
+	// is still valid.
+	height := s.cfg.Chain.BestSnapshot().Height + 1
+	err = generator.UpdateExtraNonce(block, height, math.MaxInt64)
+	if err != nil {
+		t.Fatalf("UpdateExtraNonce: unexpected error: %v", err)
+	}
+	checkFlags()
+	err = s.cfg.Chain.CheckConnectBlockTemplate(btcutil.NewBlock(block))
+	if err != nil {
+		t.Fatalf("CheckConnectBlockTemplate: unexpected error: %v", err)
+	}
+
+	wantAux, err := txscript.NewScriptBuilder().AddData([]byte(flags)).Script()
+	if err != nil {
+		t.Fatalf("unable to create coinbase flags script: %v", err)
+	}
+	state := newGbtWorkState(timeSource, generator.CoinbaseFlags())
+	if state.coinbaseAux.Flags != hex.EncodeToString(wantAux) {
+		t.Fatalf("unexpected coinbase aux flags - got %s, want %x",
+			state.coinbaseAux.Flags, wantAux)
+	}
+}
+
+// TestHandlePrioritiseTransaction ensures a low fee transaction prioritised by
+// the prioritisetransaction RPC is selected for block templates ahead of higher
+// fee transactions while the coinbase only collects the fees actually paid.
+func TestHandlePrioritiseTransaction(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "prioritisetransaction")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Create enough blocks for the coinbases of the first two to mature
+	// and spend them in transactions of the same size paying a low and a
+	// high fee in the memory pool.
+	var coinbases []*wire.MsgTx
+	for i := 0; i < 2; i++ {
+		coinbases = append(coinbases, addTestChainBlock(t, s).Transactions[0])
+	}
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	fees := []int64{2000, 16000}
+	var spends []*wire.MsgTx
+	for i, coinbase := range coinbases {
+		coinbaseHash := coinbase.TxHash()
+		spend := wire.NewMsgTx(wire.TxVersion)
+		spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0),
+			nil, nil))
+		spend.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value-fees[i],
+			[]byte{txscript.OP_TRUE}))
+		_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(spend),
+			false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to add transaction to the memory pool: %v",
+				err)
+		}
+		spends = append(spends, spend)
+	}
+	low, high := spends[0].TxHash(), spends[1].TxHash()
+
+	policy := mining.Policy{
+		BlockMaxWeight: blockMaxWeightMax,
+		BlockMaxSize:   blockMaxSizeMax,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+	}
+	generator := mining.NewBlkTmplGenerator(&policy, params,
+		s.cfg.TxMemPool, s.cfg.Chain, blockchain.NewMedianTime(),
+		txscript.NewSigCache(100), txscript.NewHashCache(100))
+	newBlockTemplate := func() *wire.MsgBlock {
+		t.Helper()
+		template, err := generator.NewBlockTemplate(nil)
+		if err != nil {
+			t.Fatalf("unable to generate block template: %v", err)
+		}
+		return template.Block
+	}
+
+	// Only leave room for the coinbase and a single spend in the templates.
+	const headerOverhead = wire.MaxBlockHeaderPayload + wire.MaxVarIntPayload
+	coinbase := btcutil.NewTx(newBlockTemplate().Transactions[0])
+	policy.BlockMaxWeight = uint32(headerOverhead*blockchain.WitnessScaleFactor +
+		blockchain.GetTransactionWeight(coinbase) +
+		blockchain.GetTransactionWeight(btcutil.NewTx(spends[0])) + 1)
+	checkTemplate := func(wantHash chainhash.Hash, wantFee int64) {
+		t.Helper()
+		txns := newBlockTemplate().Transactions
+		if len(txns) != 2 || txns[1].TxHash() != wantHash {
+			t.Fatalf("unexpected template transactions - got %d, "+
+				"want coinbase and %v", len(txns), wantHash)
+		}
+		height := s.cfg.Chain.BestSnapshot().Height + 1
+		wantValue := blockchain.CalcBlockSubsidy(height, params) + wantFee
+		if value := txns[0].TxOut[0].Value; value != wantValue {
+			t.Fatalf("unexpected coinbase value - got %d, want %d",
+				value, wantValue)
+		}
+	}
+	checkTemplate(high, fees[1])
+
+	// Prioritise the low fee transaction so it is selected instead.
+	cmd := btcjson.NewPrioritiseTransactionCmd(low.String(), 0, 100000)
+	result, err := handlePrioritiseTransaction(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("handlePrioritiseTransaction: unexpected error: %v", err)
+	}
+	if result != true {
+		t.Fatalf("unexpected result - got %v, want true", result)
+	}
+	checkTemplate(low, fees[0])
+
+	// Ensure unknown transactions and priority deltas are rejected.
+	unknown := chainhash.Hash{0x01}
+	tests := []struct {
+		name string
+		cmd  *btcjson.PrioritiseTransactionCmd
+		code btcjson.RPCErrorCode
+	}{{
+		name: "unknown transaction",
+		cmd:  btcjson.NewPrioritiseTransactionCmd(unknown.String(), 0, 1000),
+		code: btcjson.ErrRPCNoTxInfo,
+	}, {
+		name: "priority delta",
+		cmd:  btcjson.NewPrioritiseTransactionCmd(high.String(), 1, 0),
+		code: btcjson.ErrRPCInvalidParameter,
+	}}
+	for _, test := range tests {
+		_, err := handlePrioritiseTransaction(s, test.cmd, nil)
+		if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+			rpcErr.Code != test.code {
+
+			t.Errorf("%s: unexpected error - got %v, want code %d",
+				test.name, err, test.code)
+		}
+	}
+}
+
+// TestGetDifficultyRatio ensures the difficulty is calculated relative to the
+// minimum difficulty of the network the bits are for.
+func TestGetDifficultyRatio(t *testing.T) {
+	tests := []struct {
+		name   string
+		bits   uint32
+		params *chaincfg.Params
+		want   float64
+	}{
+		{"mainnet minimum", 0x1d00ffff, &chaincfg.MainNetParams, 1},
+		{"mainnet block 100000", 0x1b04864c, &chaincfg.MainNetParams, 14484.16236123},
+		{"mainnet block 105000", 0x1b0404cb, &chaincfg.MainNetParams, 16307.42093852},
+		{"mainnet high difficulty", 0x17034219, &chaincfg.MainNetParams, 86388558925171.015625},
+		{"testnet minimum", 0x1d00ffff, &chaincfg.TestNet3Params, 1},
+		{"regtest minimum", 0x207fffff, &chaincfg.RegressionNetParams, 1},
+		{"regtest higher", 0x1f00ffff, &chaincfg.RegressionNetParams, 32768.49610132},
+		{"simnet minimum", 0x207fffff, &chaincfg.SimNetParams, 1},
+	}
+	for _, test := range tests {
+		got := getDifficultyRatio(test.bits, test.params)
+		if got != test.want {
+			t.Errorf("%s: unexpected difficulty - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestHandleGetDifficulty ensures the getdifficulty RPC reports a difficulty
+// of 1 for a chain at the minimum difficulty of each network.
+func TestHandleGetDifficulty(t *testing.T) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams,
+		&chaincfg.RegressionNetParams, &chaincfg.SimNetParams} {
+
+		s, teardown := newTestNetChainRPCServer(t, "getdifficulty", params)
+		result, err := handleGetDifficulty(s, &btcjson.GetDifficultyCmd{}, nil)
+		teardown()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", params.Name, err)
+		}
+		if result.(float64) != 1 {
+			t.Errorf("%s: unexpected difficulty - got %v, want 1",
+				params.Name, result)
+		}
+	}
+}
+
+// TestVerificationProgress ensures the verification progress is estimated from
+// the time elapsed since the genesis block and is kept within [0, 1].
+func TestVerificationProgress(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	now := genesisTime.Add(100 * time.Hour)
+	tests := []struct {
+		name    string
+		tipTime time.Time
+		want    float64
+	}{
+		{"genesis", genesisTime, 0},
+		{"halfway", genesisTime.Add(50 * time.Hour), 0.5},
+		{"tip at now", now, 1},
+		{"tip in the future", now.Add(time.Hour), 1},
+		{"tip before genesis", genesisTime.Add(-time.Hour), 0},
+	}
+	for _, test := range tests {
+		got := verificationProgress(test.tipTime, params, now)
+		if got != test.want {
+			t.Errorf("%s: unexpected progress - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// testHeaderTipSyncManager provides an RPC server sync manager which reports a
+// fixed header tip.  Calling any other method panics.
+type testHeaderTipSyncManager struct {
+	rpcserverSyncManager
+	headerTip int32
+}
+
+// HeaderTipHeight returns the fixed header tip.
+func (sm *testHeaderTipSyncManager) HeaderTipHeight() int32 {
+	return sm.headerTip
+}
+
+// TestHandleGetChainStates ensures a node without a utxo snapshot reports its
+// fully validated chainstate as the single chainstate.
+func TestHandleGetChainStates(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getchainstates")
+	defer teardown()
+
+	result, err := handleGetChainStates(s, &btcjson.GetChainStatesCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states := result.(*btcjson.GetChainStatesResult)
+	if states.Headers != 0 {
+		t.Errorf("unexpected headers - got %d, want 0", states.Headers)
+	}
+	if len(states.ChainStates) != 1 {
+		t.Fatalf("unexpected number of chainstates - got %d, want 1",
+			len(states.ChainStates))
+	}
+	state := states.ChainStates[0]
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash.String()
+	if state.Blocks != 0 || state.BestBlockHash != genesisHash {
+		t.Errorf("unexpected tip - got %d (%s), want 0 (%s)",
+			state.Blocks, state.BestBlockHash, genesisHash)
+	}
+	if state.Difficulty != 1 {
+		t.Errorf("unexpected difficulty - got %v, want 1",
+			state.Difficulty)
+	}
+	if state.VerificationProgress < 0 || state.VerificationProgress > 1 {
+		t.Errorf("verification progress %v is not within [0, 1]",
+			state.VerificationProgress)
+	}
+	// The genesis coinbase is not spendable, so the utxo set is empty.
+	if state.Coins != 0 {
+		t.Errorf("unexpected coins - got %d, want 0", state.Coins)
+	}
+	if !state.Validated || state.SnapshotBlockHash != "" {
+		t.Errorf("chainstate is not the fully validated one - "+
+			"validated %v, snapshot block %q", state.Validated,
+			state.SnapshotBlockHash)
+	}
+
+	// The headers are reported at the header tip of the sync manager when
+	// it is ahead of the best block.
+	s.cfg.SyncMgr = &testHeaderTipSyncManager{headerTip: 7}
+	result, err = handleGetChainStates(s, &btcjson.GetChainStatesCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states = result.(*btcjson.GetChainStatesResult)
+	if states.Headers != 7 || states.ChainStates[0].Blocks != 0 {
+		t.Errorf("unexpected headers and blocks - got %d and %d, want "+
+			"7 and 0", states.Headers, states.ChainStates[0].Blocks)
+	}
+}
+
+// TestHandleGetChainStatesSnapshot ensures the chainstate built from a loaded
+// utxo snapshot is reported after the fully validated one.
+func TestHandleGetChainStatesSnapshot(t *testing.T) {
+	// Create an empty snapshot at height 5 of an unknown block.
+	snapshotHash := chainhash.Hash{0x01}
+	serializedHash := chainhash.DoubleHashH(nil)
+	params := chaincfg.RegressionNetParams
+	params.AssumeUtxoSnapshots = []chaincfg.AssumeUtxoSnapshot{{
+		Height:         5,
+		BlockHash:      &snapshotHash,
+		SerializedHash: &serializedHash,
+	}}
+	s, teardown := newTestNetChainRPCServer(t, "getchainstatessnapshot",
+		&params)
+	defer teardown()
+
+	snapshot := append(snapshotHash[:], make([]byte, 8)...)
+	err := s.cfg.Chain.LoadUtxoSnapshot(bytes.NewReader(snapshot),
+		&snapshotHash)
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+
+	result, err := handleGetChainStates(s, &btcjson.GetChainStatesCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states := result.(*btcjson.GetChainStatesResult)
+	if states.Headers != 5 {
+		t.Errorf("unexpected headers - got %d, want 5", states.Headers)
+	}
+	if len(states.ChainStates) != 2 || !states.ChainStates[0].Validated {
+		t.Fatalf("unexpected chainstates %+v", states.ChainStates)
+	}
+	want := btcjson.ChainStateResult{
+		Blocks:            5,
+		BestBlockHash:     snapshotHash.String(),
+		SnapshotBlockHash: snapshotHash.String(),
+	}
+	if got := states.ChainStates[1]; got != want {
+		t.Errorf("unexpected snapshot chainstate - got %+v, want %+v",
+			got, want)
+	}
+}
+
+// TestHandleGenerateToAddress ensures the generatetoaddress RPC mines the
+// requested number of blocks with coinbases paying the passed address and that
+// it rejects invalid requests as well as networks where CPU mining is not
+// expected to be possible.
+func TestHandleGenerateToAddress(t *testing.T) {
+	s, teardown := newTestNetChainRPCServer(t, "generatetoaddress",
+		&chaincfg.SimNetParams)
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	origCfg := cfg
+	cfg = &config{}
+	defer func() { cfg = origCfg }()
+
+	policy := mining.Policy{
+		BlockMaxWeight: blockMaxWeightMax,
+		BlockMaxSize:   blockMaxSizeMax,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+	}
+	s.cfg.Generator = mining.NewBlkTmplGenerator(&policy, params,
+		s.cfg.TxMemPool, s.cfg.Chain, blockchain.NewMedianTime(),
+		txscript.NewSigCache(100), txscript.NewHashCache(100))
+	s.cfg.CPUMiner = cpuminer.New(&cpuminer.Config{
+		ChainParams:            params,
+		BlockTemplateGenerator: s.cfg.Generator,
+		ProcessBlock: func(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
+			_, isOrphan, err := s.cfg.Chain.ProcessBlock(block, flags)
+			return isOrphan, err
+		},
+	})
+
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	wrongNetAddr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+
+	// Ensure the requested number of blocks are generated and that their
+	// coinbases pay the address.
+	const numBlocks = 3
+	cmd := btcjson.NewGenerateToAddressCmd(numBlocks, addr.EncodeAddress(),
+		nil)
+	result, err := handleGenerateToAddress(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hashes := result.([]string)
+	if len(hashes) != numBlocks {
+		t.Fatalf("unexpected number of block hashes - got %d, want %d",
+			len(hashes), numBlocks)
+	}
+	wantPkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	for i, hashStr := range hashes {
+		hash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			t.Fatalf("invalid block hash %q: %v", hashStr, err)
+		}
+		height, err := s.cfg.Chain.BlockHeightByHash(hash)
+		if err != nil {
+			t.Fatalf("generated block %v is not in the main chain: %v",
+				hash, err)
+		}
+		if height != int32(i+1) {
+			t.Errorf("unexpected height of block %v - got %d, want %d",
+				hash, height, i+1)
+		}
+		block, err := s.cfg.Chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("unable to fetch block %v: %v", hash, err)
+		}
+		coinbase := block.MsgBlock().Transactions[0]
+		if !bytes.Equal(coinbase.TxOut[0].PkScript, wantPkScript) {
+			t.Errorf("coinbase of block %v pays %x, want %x", hash,
+				coinbase.TxOut[0].PkScript, wantPkScript)
+		}
+	}
+
+	// Ensure invalid requests are rejected.
+	tests := []struct {
+		name     string
+		cmd      *btcjson.GenerateToAddressCmd
+		wantCode btcjson.RPCErrorCode
+	}{
+		{
+			name: "no blocks",
+			cmd: btcjson.NewGenerateToAddressCmd(0,
+				addr.EncodeAddress(), nil),
+			wantCode: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name: "no tries",
+			cmd: btcjson.NewGenerateToAddressCmd(1,
+				addr.EncodeAddress(), btcjson.Int64(0)),
+			wantCode: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name:     "invalid address",
+			cmd:      btcjson.NewGenerateToAddressCmd(1, "invalid", nil),
+			wantCode: btcjson.ErrRPCInvalidAddressOrKey,
+		},
+		{
+			name: "wrong network address",
+			cmd: btcjson.NewGenerateToAddressCmd(1,
+				wrongNetAddr.EncodeAddress(), nil),
+			wantCode: btcjson.ErrRPCInvalidAddressOrKey,
+		},
+	}
+	for _, test := range tests {
+		_, err := handleGenerateToAddress(s, test.cmd, nil)
+		if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+			rpcErr.Code != test.wantCode {
+
+			t.Errorf("%s: unexpected error - got %v, want code %d",
+				test.name, err, test.wantCode)
+		}
+	}
+
+	// Ensure the RPC is rejected on networks where CPU mining is not
+	// expected to be possible unless it was explicitly allowed.
+	s.cfg.ChainParams = &chaincfg.MainNetParams
+	cmd = btcjson.NewGenerateToAddressCmd(1, wrongNetAddr.EncodeAddress(),
+		nil)
+	_, err = handleGenerateToAddress(s, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCDifficulty {
+
+		t.Errorf("unexpected error on mainnet - got %v, want code %d",
+			err, btcjson.ErrRPCDifficulty)
+	}
+}
+
+// testNetworkInfoConnManager provides an RPC server connection manager which
+// reports fixed peers, service flags, and local addresses.  Calling any other
+// method panics.
+type testNetworkInfoConnManager struct {
+	rpcserverConnManager
+	peers      []rpcserverPeer
+	services   wire.ServiceFlag
+	localAddrs []addrmgr.LocalAddressInfo
+}
+
+// ConnectedCount returns the number of fixed peers.
+func (cm *testNetworkInfoConnManager) ConnectedCount() int32 {
+	return int32(len(cm.peers))
+}
+
+// ConnectedPeers returns the fixed peers.
+func (cm *testNetworkInfoConnManager) ConnectedPeers() []rpcserverPeer {
+	return cm.peers
+}
+
+// Services returns the fixed service flags.
+func (cm *testNetworkInfoConnManager) Services() wire.ServiceFlag {
+	return cm.services
+}
+
+// LocalAddresses returns the fixed local addresses.
+func (cm *testNetworkInfoConnManager) LocalAddresses() []addrmgr.LocalAddressInfo {
+	return cm.localAddrs
+}
+
+// testSyncPeerSyncManager provides an RPC server sync manager which reports a
+// fixed sync peer.  Calling any other method panics.
+type testSyncPeerSyncManager struct {
+	rpcserverSyncManager
+	syncPeerID int32
+}
+
+// SyncPeerID returns the fixed sync peer.
+func (sm *testSyncPeerSyncManager) SyncPeerID() int32 {
+	return sm.syncPeerID
+}
+
+// TestHandleGetPeerInfoConnectionType ensures getpeerinfo reports the type of
+// the connection to each peer and whether or not it was added manually.
+func TestHandleGetPeerInfoConnectionType(t *testing.T) {
+	tests := []struct {
+		connType connectionType
+		inbound  bool
+		want     string
+		addNode  bool
+	}{
+		{connType: connTypeInbound, inbound: true, want: "inbound"},
+		{connType: connTypeManual, want: "manual", addNode: true},
+		{connType: connTypeOutboundFullRelay, want: "outbound-full-relay"},
+		{connType: connTypeBlockRelayOnly, want: "block-relay-only"},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	var peers []rpcserverPeer
+	for _, test := range tests {
+		sp := newServerPeer(&server{}, test.connType == connTypeManual,
+			test.connType)
+		peerCfg := &peer.Config{ChainParams: &chaincfg.RegressionNetParams}
+		if test.inbound {
+			sp.Peer = peer.NewInboundPeer(peerCfg)
+		} else {
+			p, err := peer.NewOutboundPeer(peerCfg, "127.0.0.1:18444")
+			if err != nil {
+				t.Fatalf("unable to create peer: %v", err)
+			}
+			sp.Peer = p
+		}
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to connect: %v", err)
+		}
+		remote, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unable to accept: %v", err)
+		}
+		defer remote.Close()
+		sp.AssociateConnection(conn)
+		defer sp.Disconnect()
+		peers = append(peers, (*rpcPeer)(sp))
+	}
+	s := &rpcServer{cfg: rpcserverConfig{
+		ConnMgr: &testNetworkInfoConnManager{peers: peers},
+		SyncMgr: &testSyncPeerSyncManager{syncPeerID: -1},
+	}}
+
+	result, err := handleGetPeerInfo(s, &btcjson.GetPeerInfoCmd{}, nil)
+	if err != nil {
+		t.Fatalf("handleGetPeerInfo: unexpected error: %v", err)
+	}
+	infos := result.([]*btcjson.GetPeerInfoResult)
+	if len(infos) != len(tests) {
+		t.Fatalf("unexpected number of peers - got %d, want %d",
+			len(infos), len(tests))
+	}
+	for i, test := range tests {
+		info := infos[i]
+		if info.ConnectionType != test.want || info.AddNode != test.addNode ||
+			info.Inbound != test.inbound {
+
+			t.Errorf("%s: unexpected peer info - got connection type "+
+				"%q, addnode %v, inbound %v", test.want,
+				info.ConnectionType, info.AddNode, info.Inbound)
+		}
+	}
+}
+
+// TestHandleGetNetworkInfo ensures getnetworkinfo reports the service flags,
+// connection counts, and local addresses of the server along with the
+// reachability of each network.
+func TestHandleGetNetworkInfo(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{
+		BlocksOnly:        true,
+		OnionProxy:        "127.0.0.1:9050",
+		UserAgentComments: []string{"test"},
+		minRelayTxFee:     mempool.DefaultMinRelayTxFee,
+	}
+	defer func() { cfg = origCfg }()
+
+	var peers []rpcserverPeer
+	for i := 0; i < 2; i++ {
+		p := peer.NewInboundPeer(&peer.Config{})
+		peers = append(peers, (*rpcPeer)(&serverPeer{Peer: p}))
+	}
+	p, err := peer.NewOutboundPeer(&peer.Config{}, "10.0.0.1:8333")
+	if err != nil {
+		t.Fatalf("unable to create outbound peer: %v", err)
+	}
+	peers = append(peers, (*rpcPeer)(&serverPeer{Peer: p}))
+
+	services := wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeCF
+	localAddr := wire.NewNetAddressIPPort(net.ParseIP("204.124.1.1"),
+		8333, services)
+	s := &rpcServer{cfg: rpcserverConfig{
+		ConnMgr: &testNetworkInfoConnManager{
+			peers:    peers,
+			services: services,
+			localAddrs: []addrmgr.LocalAddressInfo{{
+				NetAddress: localAddr,
+				Score:      addrmgr.BoundPrio,
+			}},
+		},
+		TimeSource: blockchain.NewMedianTime(),
+	}}
+
+	result, err := handleGetNetworkInfo(s, &btcjson.GetNetworkInfoCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := result.(*btcjson.GetNetworkInfoResult)
+
+	wantServices := fmt.Sprintf("%016x", uint64(services))
+	if info.LocalServices != wantServices {
+		t.Errorf("unexpected local services - got %s, want %s",
+			info.LocalServices, wantServices)
+	}
+	if info.LocalRelay {
+		t.Error("local relay reported with blocks only mode enabled")
+	}
+	if info.Connections != 3 || info.ConnectionsIn != 2 ||
+		info.ConnectionsOut != 1 {
+
+		t.Errorf("unexpected connections - got %d (%d in, %d out), "+
+			"want 3 (2 in, 1 out)", info.Connections,
+			info.ConnectionsIn, info.ConnectionsOut)
+	}
+	if info.ProtocolVersion != int32(peer.MaxProtocolVersion) {
+		t.Errorf("unexpected protocol version - got %d, want %d",
+			info.ProtocolVersion, peer.MaxProtocolVersion)
+	}
+	wantSubVersion := fmt.Sprintf("%s%s:%s(test)/", wire.DefaultUserAgent,
+		userAgentName, userAgentVersion)
+	if info.SubVersion != wantSubVersion {
+		t.Errorf("unexpected subversion - got %s, want %s",
+			info.SubVersion, wantSubVersion)
+	}
+	if info.RelayFee != mempool.DefaultMinRelayTxFee.ToBTC() {
+		t.Errorf("unexpected relay fee - got %v, want %v", info.RelayFee,
+			mempool.DefaultMinRelayTxFee.ToBTC())
+	}
+
+	wantLocalAddrs := []btcjson.LocalAddressesResult{{
+		Address: "204.124.1.1",
+		Port:    8333,
+		Score:   int32(addrmgr.BoundPrio),
+	}}
+	if !reflect.DeepEqual(info.LocalAddresses, wantLocalAddrs) {
+		t.Errorf("unexpected local addresses - got %+v, want %+v",
+			info.LocalAddresses, wantLocalAddrs)
+	}
+
+	wantNetworks := []btcjson.NetworksResult{
+		{Name: "ipv4", Reachable: true},
+		{Name: "ipv6", Reachable: true},
+		{Name: "onion", Reachable: true, Proxy: "127.0.0.1:9050"},
+	}
+	if !reflect.DeepEqual(info.Networks, wantNetworks) {
+		t.Errorf("unexpected networks - got %+v, want %+v",
+			info.Networks, wantNetworks)
+	}
+
+	// Onion addresses are unreachable without a proxy.
+	cfg.OnionProxy = ""
+	result, err = handleGetNetworkInfo(s, &btcjson.GetNetworkInfoCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	onion := result.(*btcjson.GetNetworkInfoResult).Networks[2]
+	if onion.Reachable || !onion.Limited {
+		t.Errorf("unexpected onion network without a proxy: %+v", onion)
+	}
+
+	// Clearnet networks are limited when onlynet restricts outbound
+	// connections to the onion network.
+	cfg.OnionProxy = "127.0.0.1:9050"
+	cfg.onlyNets = []addrmgr.Network{addrmgr.NetOnion}
+	result, err = handleGetNetworkInfo(s, &btcjson.GetNetworkInfoCmd{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, network := range result.(*btcjson.GetNetworkInfoResult).Networks {
+		wantReachable := network.Name == "onion"
+		if network.Reachable != wantReachable ||
+			network.Limited == wantReachable {
+
+			t.Errorf("unexpected %s network with onlynet=onion: %+v",
+				network.Name, network)
+		}
+	}
+}
+
+// testPeerNotifier provides a sync manager peer notifier which ignores all
+// notifications.
+type testPeerNotifier struct{}
+
+// AnnounceNewTransactions ignores the passed transactions.
+func (testPeerNotifier) AnnounceNewTransactions([]*mempool.TxDesc) {}
+
+// UpdatePeerHeights ignores the passed block.
+func (testPeerNotifier) UpdatePeerHeights(*chainhash.Hash, int32, *peer.Peer) {}
+
+// RelayInventory ignores the passed inventory.
+func (testPeerNotifier) RelayInventory(*wire.InvVect, interface{}) {}
+
+// TransactionConfirmed ignores the passed transaction.
+func (testPeerNotifier) TransactionConfirmed(*btcutil.Tx) {}
+
+// TestHandleGetBlockFromPeer ensures the getblockfrompeer RPC requests a block
+// from the given peer and stores it once the peer serves it, and that unknown
+// peers, known blocks, and blocks the peer does not have are rejected.
+func TestHandleGetBlockFromPeer(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getblockfrompeer")
+	defer teardown()
+
+	origCfg := cfg
+	cfg = &config{}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	sm, err := netsync.New(&netsync.Config{
+		PeerNotifier:       testPeerNotifier{},
+		Chain:              s.cfg.Chain,
+		TxMemPool:          s.cfg.TxMemPool,
+		ChainParams:        s.cfg.ChainParams,
+		DisableCheckpoints: true,
+		MaxPeers:           8,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	sm.Start()
+	defer sm.Stop()
+	s.cfg.SyncMgr = &rpcSyncMgr{syncMgr: sm}
+
+	// Create a solved block which extends the chain without connecting it.
+	block := newTestChainBlock(t, s)
+	for blockchain.CheckProofOfWork(btcutil.NewBlock(block),
+		s.cfg.ChainParams.PowLimit) != nil {
+
+		block.Header.Nonce++
+	}
+	blockHash := block.BlockHash()
+
+	// Connect a peer to a remote node which performs the handshake and
+	// then serves the block when it is requested, except for the first
+	// request which is ignored, while replying with a notfound message for
+	// any other block.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var ignoredRequest bool
+		btcnet := s.cfg.ChainParams.Net
+		pver := wire.ProtocolVersion
+		if _, _, err := wire.ReadMessage(conn, pver, btcnet); err != nil {
+			return
+		}
+		addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0,
+			wire.SFNodeNetwork)
+		versionMsg := wire.NewMsgVersion(addr, addr, 0, 0)
+		versionMsg.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+		if err := wire.WriteMessage(conn, versionMsg, pver, btcnet); err != nil {
+			return
+		}
+		err = wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, btcnet)
+		if err != nil {
+			return
+		}
+		for {
+			msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+			if err != nil {
+				return
+			}
+			getData, ok := msg.(*wire.MsgGetData)
+			if !ok {
+				continue
+			}
+			for _, iv := range getData.InvList {
+				var reply wire.Message = block
+				if iv.Hash == blockHash && !ignoredRequest {
+					ignoredRequest = true
+					continue
+				}
+				if iv.Hash != blockHash {
+					notFound := wire.NewMsgNotFound()
+					notFound.AddInvVect(iv)
+					reply = notFound
+				}
+				err := wire.WriteMessage(conn, reply, pver, btcnet)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	sp := newServerPeer(&server{syncManager: sm}, false,
+		connTypeOutboundFullRelay)
+	peerCfg := newPeerConfig(sp)
+	verAcks := make(chan struct{}, 1)
+	peerCfg.Listeners = peer.MessageListeners{
+		OnVerAck: func(*peer.Peer, *wire.MsgVerAck) {
+			verAcks <- struct{}{}
+		},
+		OnBlock: sp.OnBlock,
+		OnNotFound: func(p *peer.Peer, msg *wire.MsgNotFound) {
+			sm.QueueNotFound(msg, p)
+		},
+	}
+	peerCfg.NewestBlock = nil
+	peerCfg.HostToNetAddress = nil
+	peerCfg.ChainParams = s.cfg.ChainParams
+	sp.Peer, err = peer.NewOutboundPeer(peerCfg, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	sp.AssociateConnection(conn)
+	defer sp.Disconnect()
+	select {
+	case <-verAcks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the handshake")
+	}
+	sm.NewPeer(sp.Peer)
+	s.cfg.ConnMgr = &testNetworkInfoConnManager{
+		peers: []rpcserverPeer{(*rpcPeer)(sp)},
+	}
+
+	tests := []struct {
+		name      string
+		blockHash string
+		peerID    int32
+		code      btcjson.RPCErrorCode
+	}{{
+		name:      "unknown peer",
+		blockHash: blockHash.String(),
+		peerID:    sp.ID() + 1,
+		code:      btcjson.ErrRPCInvalidParameter,
+	}, {
+		name:      "invalid block hash",
+		blockHash: "zz",
+		peerID:    sp.ID(),
+		code:      btcjson.ErrRPCDecodeHexString,
+	}, {
+		name:      "known block",
+		blockHash: s.cfg.ChainParams.GenesisHash.String(),
+		peerID:    sp.ID(),
+		code:      btcjson.ErrRPCMisc,
+	}, {
+		name:      "block not found",
+		blockHash: chainhash.Hash{0x01}.String(),
+		peerID:    sp.ID(),
+		code:      btcjson.ErrRPCMisc,
+	}}
+	for _, test := range tests {
+		cmd := btcjson.NewGetBlockFromPeerCmd(test.blockHash, test.peerID)
+		_, err := handleGetBlockFromPeer(s, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.code {
+			t.Errorf("%s: unexpected error - got %v, want code %d",
+				test.name, err, test.code)
+		}
+	}
+
+	// Ensure a request which times out is canceled so the block can be
+	// requested again.
+	origTimeout := getBlockFromPeerTimeout
+	getBlockFromPeerTimeout = 100 * time.Millisecond
+	cmd := btcjson.NewGetBlockFromPeerCmd(blockHash.String(), sp.ID())
+	_, err = handleGetBlockFromPeer(s, cmd, nil)
+	getBlockFromPeerTimeout = origTimeout
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		!strings.Contains(rpcErr.Message, "Timeout") {
+
+		t.Fatalf("handleGetBlockFromPeer: unexpected error - got %v, "+
+			"want timeout", err)
+	}
+
+	// Ensure the block is stored once the peer serves it.
+	result, err := handleGetBlockFromPeer(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("handleGetBlockFromPeer: unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if best := s.cfg.Chain.BestSnapshot(); best.Hash != blockHash {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			blockHash)
+	}
+}
+
+// TestHandleWaitForBlock ensures the waitfornewblock and waitforblock RPCs
+// return the new tip promptly once the block being waited for is connected and
+// return the current tip once their timeout expires.
+func TestHandleWaitForBlock(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "waitforblock")
+	defer teardown()
+
+	// waitResult runs the passed handler in the background and returns a
+	// channel which receives its result.
+	type waitResult struct {
+		result interface{}
+		err    error
+	}
+	wait := func(handler commandHandler, cmd interface{}) chan waitResult {
+		c := make(chan waitResult, 1)
+		go func() {
+			result, err := handler(s, cmd, nil)
+			c <- waitResult{result, err}
+		}()
+		return c
+	}
+	checkResult := func(name string, c chan waitResult, block *wire.MsgBlock, height int32) {
+		t.Helper()
+
+		var res waitResult
+		select {
+		case res = <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timeout waiting for result", name)
+		}
+		if res.err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, res.err)
+		}
+		want := &btcjson.WaitForBlockResult{
+			Hash:   block.BlockHash().String(),
+			Height: height,
+		}
+		if !reflect.DeepEqual(res.result, want) {
+			t.Fatalf("%s: unexpected result - got %+v, want %+v", name,
+				res.result, want)
+		}
+	}
+
+	// Ensure waiting for a new block returns once one is connected.
+	newBlock := wait(handleWaitForNewBlock, btcjson.NewWaitForNewBlockCmd(nil))
+	time.Sleep(50 * time.Millisecond)
+	b1 := addTestChainBlock(t, s)
+	checkResult("waitfornewblock", newBlock, b1, 1)
+
+	// Ensure waiting for a specific block only returns once that block is
+	// connected.
+	b2 := newTestChainBlock(t, s)
+	forBlock := wait(handleWaitForBlock, btcjson.NewWaitForBlockCmd(
+		b2.BlockHash().String(), nil))
+	select {
+	case res := <-forBlock:
+		t.Fatalf("waitforblock: unexpected result %+v before the block "+
+			"is connected", res)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, _, err := s.cfg.Chain.ProcessBlock(btcutil.NewBlock(b2),
+		blockchain.BFNoPoWCheck)
+	if err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+	checkResult("waitforblock", forBlock, b2, 2)
+
+	// A block which is already the tip returns immediately.
+	checkResult("waitforblock tip", wait(handleWaitForBlock,
+		btcjson.NewWaitForBlockCmd(b2.BlockHash().String(), nil)), b2, 2)
+
+	// The current tip is returned once the timeout expires.
+	checkResult("waitfornewblock timeout", wait(handleWaitForNewBlock,
+		btcjson.NewWaitForNewBlockCmd(btcjson.Int(10))), b2, 2)
+	checkResult("waitforblock timeout", wait(handleWaitForBlock,
+		btcjson.NewWaitForBlockCmd(chainhash.Hash{0x01}.String(),
+			btcjson.Int(10))), b2, 2)
+
+	// A negative timeout is rejected.
+	_, err = handleWaitForNewBlock(s, btcjson.NewWaitForNewBlockCmd(
+		btcjson.Int(-1)), nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("unexpected error for a negative timeout - got %v, "+
+			"want code %d", err, btcjson.ErrRPCInvalidParameter)
+	}
+}
+
+// TestHandleWaitForBlockHeight ensures the waitforblockheight RPC only returns
+// once the best chain reaches the height being waited for and returns the
+// current tip once its timeout expires.
+func TestHandleWaitForBlockHeight(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "waitforblockheight")
+	defer teardown()
+
+	// Wait for a height above the current tip and mine up to it.
+	type waitResult struct {
+		result interface{}
+		err    error
+	}
+	c := make(chan waitResult, 1)
+	go func() {
+		cmd := btcjson.NewWaitForBlockHeightCmd(3, nil)
+		result, err := handleWaitForBlockHeight(s, cmd, nil)
+		c <- waitResult{result, err}
+	}()
+	var block *wire.MsgBlock
+	for height := int32(1); height <= 3; height++ {
+		select {
+		case res := <-c:
+			t.Fatalf("unexpected result %+v at height %d", res,
+				height-1)
+		case <-time.After(50 * time.Millisecond):
+		}
+		block = addTestChainBlock(t, s)
+	}
+	var res waitResult
+	select {
+	case res = <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for result")
+	}
+	if res.err != nil {
+		t.Fatalf("handleWaitForBlockHeight: unexpected error: %v", res.err)
+	}
+	want := &btcjson.WaitForBlockResult{
+		Hash:   block.BlockHash().String(),
+		Height: 3,
+	}
+	if !reflect.DeepEqual(res.result, want) {
+		t.Fatalf("unexpected result - got %+v, want %+v", res.result, want)
+	}
+
+	// A height which has already been reached returns immediately and the
+	// current tip is returned once the timeout expires otherwise.
+	tests := []struct {
+		name    string
+		height  int32
+		timeout *int
+	}{
+		{name: "reached height", height: 2},
+		{name: "timeout", height: 4, timeout: btcjson.Int(10)},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewWaitForBlockHeightCmd(test.height, test.timeout)
+		result, err := handleWaitForBlockHeight(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("%s: unexpected result - got %+v, want %+v",
+				test.name, result, want)
+		}
+	}
+}
+
+// TestHandleGetRawAddrMan ensures getrawaddrman returns the addresses of the
+// new and tried tables keyed by their buckets along with their sources and
+// timestamps, that tor addresses are returned as onion addresses, and that it
+// is not available to limited users.
+func TestHandleGetRawAddrMan(t *testing.T) {
+	if _, ok := rpcLimited["getrawaddrman"]; ok {
+		t.Fatal("getrawaddrman is available to limited users")
+	}
+
+	amgr := addrmgr.New(t.Name(), nil)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.67"), 8333,
+		wire.SFNodeNetwork)
+	newAddr := wire.NewNetAddressIPPort(
+		net.ParseIP("fd87:d87e:eb43:a1b2:c3d4:e5f6:0708:090a"), 8333,
+		wire.SFNodeNetwork|wire.SFNodeWitness)
+	newAddr.Timestamp = time.Unix(1600000000, 0)
+	triedAddr := wire.NewNetAddressIPPort(net.ParseIP("2001:470::1"), 18333,
+		wire.SFNodeWitness)
+	triedAddr.Timestamp = time.Unix(1600000100, 0)
+	amgr.AddAddresses([]*wire.NetAddress{newAddr, triedAddr}, srcAddr)
+	amgr.Attempt(triedAddr)
+	amgr.Good(triedAddr)
+
+	s := &rpcServer{cfg: rpcserverConfig{
+		ConnMgr: &rpcConnManager{server: &server{addrManager: amgr}},
+	}}
+	res, err := handleGetRawAddrMan(s, &btcjson.GetRawAddrManCmd{}, nil)
+	if err != nil {
+		t.Fatalf("handleGetRawAddrMan: unexpected error: %v", err)
+	}
+	result := res.(*btcjson.GetRawAddrManResult)
+
+	// The buckets are derived from the secret key of the address manager,
+	// so the expected keys are taken from its tables.
+	var newKey, triedKey string
+	var lastSuccess int64
+	for _, ta := range amgr.TableAddresses() {
+		key := fmt.Sprintf("%d/%d", ta.Bucket, ta.Position)
+		if ta.Tried {
+			triedKey = key
+			lastSuccess = ta.LastSuccess.Unix()
+		} else {
+			newKey = key
+		}
+	}
+	want := &btcjson.GetRawAddrManResult{
+		New: map[string]btcjson.RawAddrManEntry{
+			newKey: {
+				Address:       "ugzmhvhf6ydqqcik.onion",
+				Port:          8333,
+				Services:      uint64(newAddr.Services),
+				Time:          1600000000,
+				Network:       "onion",
+				Source:        "173.194.115.67",
+				SourceNetwork: "ipv4",
+			},
+		},
+		Tried: map[string]btcjson.RawAddrManEntry{
+			triedKey: {
+				Address:       "2001:470::1",
+				Port:          18333,
+				Services:      uint64(triedAddr.Services),
+				Time:          1600000100,
+				Network:       "ipv6",
+				Source:        "173.194.115.67",
+				SourceNetwork: "ipv4",
+				LastTry:       lastSuccess,
+				LastSuccess:   lastSuccess,
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("unexpected result - got %+v, want %+v", result, want)
+	}
+}
+
+// TestHandleDebugLevel ensures debuglevel changes the log levels of subsystems
+// at runtime so their messages are logged or suppressed accordingly, and that
+// invalid level specifications are rejected without changing any level.
+func TestHandleDebugLevel(t *testing.T) {
+	defer setLogLevels(defaultLogLevel)
+
+	// Capture the log output written to standard output.
+	stdout, err := ioutil.TempFile("", "debuglevel")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %v", err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	origStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = origStdout
+	}()
+	logged := func(message string) bool {
+		t.Helper()
+
+		output, err := ioutil.ReadFile(stdout.Name())
+		if err != nil {
+			t.Fatalf("unable to read log output: %v", err)
+		}
+		return strings.Contains(string(output), message)
+	}
+
+	debugLevel := func(levelSpec string) error {
+		t.Helper()
+
+		_, err := handleDebugLevel(nil, &btcjson.DebugLevelCmd{
+			LevelSpec: levelSpec,
+		}, nil)
+		return err
+	}
+
+	// Setting a subsystem to trace logs its trace messages only.
+	if err := debugLevel("RPCS=trace"); err != nil {
+		t.Fatalf("handleDebugLevel: unexpected error: %v", err)
+	}
+	rpcsLog.Tracef("rpcs trace message")
+	srvrLog.Tracef("srvr trace message")
+	if !logged("rpcs trace message") {
+		t.Fatal("trace message was not logged at the trace level")
+	}
+	if logged("srvr trace message") {
+		t.Fatal("trace message of another subsystem was logged")
+	}
+
+	// Invalid specifications don't change any level.
+	tests := []string{
+		"RPCS=info,XXXX=info",
+		"RPCS=info,SRVR=verbose",
+		"RPCS=info,SRVR",
+		"RPCS=info=debug",
+		"verbose",
+	}
+	for _, levelSpec := range tests {
+		err := debugLevel(levelSpec)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParams.Code {
+			t.Fatalf("%s: unexpected error - got %v, want code %d",
+				levelSpec, err, btcjson.ErrRPCInvalidParams.Code)
+		}
+		if level := rpcsLog.Level(); level != btclog.LevelTrace {
+			t.Fatalf("%s: level was changed to %v", levelSpec, level)
+		}
+	}
+
+	// Setting the subsystem back to info suppresses its trace messages.
+	if err := debugLevel("RPCS=info"); err != nil {
+		t.Fatalf("handleDebugLevel: unexpected error: %v", err)
+	}
+	rpcsLog.Tracef("suppressed trace message")
+	rpcsLog.Infof("rpcs info message")
+	if logged("suppressed trace message") {
+		t.Fatal("trace message was logged at the info level")
+	}
+	if !logged("rpcs info message") {
+		t.Fatal("info message was not logged at the info level")
+	}
+}
+
+// TestHandleGetMemoryInfo ensures getmemoryinfo reports the runtime memory
+// statistics along with the sizes of the caches and pools of a node with
+// transactions in its memory and orphan pools.
+func TestHandleGetMemoryInfo(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getmemoryinfo")
+	defer teardown()
+	params := s.cfg.ChainParams
+
+	// Mature a coinbase and spend it in a transaction in the memory pool,
+	// then add a transaction which spends an unknown output to the orphan
+	// pool.
+	first := addTestChainBlock(t, s)
+	for i := uint16(1); i < params.CoinbaseMaturity; i++ {
+		addTestChainBlock(t, s)
+	}
+	coinbaseHash := first.Transactions[0].TxHash()
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(first.Transactions[0].TxOut[0].Value-10000,
+		[]byte{txscript.OP_TRUE}))
+	_, err := s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(spend),
+		false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to add transaction to the memory pool: %v", err)
+	}
+	orphan := wire.NewMsgTx(wire.TxVersion)
+	orphan.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 0),
+		nil, nil))
+	orphan.AddTxOut(wire.NewTxOut(10000, []byte{txscript.OP_TRUE}))
+	_, err = s.cfg.TxMemPool.ProcessTransaction(btcutil.NewTx(orphan),
+		true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to add transaction to the orphan pool: %v", err)
+	}
+
+	// Populate the signature caches and run a garbage collection so every
+	// statistic has a nonzero value.
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	sigHash := chainhash.HashH([]byte("getmemoryinfo"))
+	sig, err := privKey.Sign(sigHash[:])
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	s.cfg.SigCache = txscript.NewSigCache(10)
+	s.cfg.SigCache.Add(sigHash, sig, privKey.PubKey())
+	s.cfg.HashCache = txscript.NewHashCache(10)
+	s.cfg.HashCache.AddSigHashes(spend)
+	runtime.GC()
+
+	result, err := handleGetMemoryInfo(s, btcjson.NewGetMemoryInfoCmd(nil), nil)
+	if err != nil {
+		t.Fatalf("handleGetMemoryInfo: unexpected error: %v", err)
+	}
+	info := result.(*btcjson.GetMemoryInfoResult)
+	if info.HeapAlloc == 0 || info.HeapInuse == 0 || info.HeapSys == 0 ||
+		info.HeapObjects == 0 || info.TotalAlloc == 0 || info.Sys == 0 ||
+		info.NumGC == 0 || info.Goroutines == 0 {
+
+		t.Fatalf("unexpected runtime statistics %+v", info)
+	}
+	if info.UtxoCacheEntries == 0 || info.UtxoCacheSize == 0 {
+		t.Fatalf("unexpected utxo cache size - got %d entries of %d "+
+			"bytes", info.UtxoCacheEntries, info.UtxoCacheSize)
+	}
+	if info.SigCacheEntries != 1 || info.HashCacheEntries != 1 {
+		t.Fatalf("unexpected signature cache sizes - got %d and %d, "+
+			"want 1", info.SigCacheEntries, info.HashCacheEntries)
+	}
+	if info.MempoolSize != 1 ||
+		info.MempoolBytes != int64(spend.SerializeSize()) {
+
+		t.Fatalf("unexpected mempool size - got %d transactions of %d "+
+			"bytes, want 1 of %d", info.MempoolSize, info.MempoolBytes,
+			spend.SerializeSize())
+	}
+	if info.OrphanPoolSize != 1 {
+		t.Fatalf("unexpected orphan pool size - got %d, want 1",
+			info.OrphanPoolSize)
+	}
+
+	// Modes other than stats are rejected.
+	cmd := btcjson.NewGetMemoryInfoCmd(btcjson.String("mallocinfo"))
+	_, err = handleGetMemoryInfo(s, cmd, nil)
+	if rerr, ok := err.(*btcjson.RPCError); !ok ||
+		rerr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("unexpected error for an unknown mode - got %v, want %v",
+			err, btcjson.ErrRPCInvalidParameter)
+	}
+}
+
+// TestHandleGetBlockHashes ensures getblockhashes returns the hashes of the
+// requested range of the best chain in order, limits the range to the best
+// chain, and rejects invalid start heights and counts.
+func TestHandleGetBlockHashes(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getblockhashes")
+	defer teardown()
+
+	blockHashes := []string{s.cfg.ChainParams.GenesisHash.String()}
+	for i := 0; i < 20; i++ {
+		blockHash := addTestChainBlock(t, s).BlockHash()
+		blockHashes = append(blockHashes, blockHash.String())
+	}
+
+	tests := []struct {
+		name        string
+		startHeight int64
+		count       int64
+		want        []string
+		wantCode    btcjson.RPCErrorCode
+	}{{
+		name:        "contiguous range",
+		startHeight: 5,
+		count:       10,
+		want:        blockHashes[5:15],
+	}, {
+		name:        "genesis block",
+		startHeight: 0,
+		count:       1,
+		want:        blockHashes[:1],
+	}, {
+		name:        "best block",
+		startHeight: 20,
+		count:       1,
+		want:        blockHashes[20:],
+	}, {
+		name:        "range past best block",
+		startHeight: 15,
+		count:       100,
+		want:        blockHashes[15:],
+	}, {
+		name:        "max count",
+		startHeight: 0,
+		count:       maxGetBlockHashesCount,
+		want:        blockHashes,
+	}, {
+		name:        "over limit count",
+		startHeight: 0,
+		count:       maxGetBlockHashesCount + 1,
+		wantCode:    btcjson.ErrRPCInvalidParameter,
+	}, {
+		name:        "zero count",
+		startHeight: 0,
+		count:       0,
+		wantCode:    btcjson.ErrRPCInvalidParameter,
+	}, {
+		name:        "negative start height",
+		startHeight: -1,
+		count:       1,
+		wantCode:    btcjson.ErrRPCOutOfRange,
+	}, {
+		name:        "start height past best block",
+		startHeight: 21,
+		count:       1,
+		wantCode:    btcjson.ErrRPCOutOfRange,
+	}}
+	for _, test := range tests {
+		cmd := btcjson.NewGetBlockHashesCmd(test.startHeight, test.count)
+		result, err := handleGetBlockHashes(s, cmd, nil)
+		if test.want == nil {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.wantCode {
+				t.Errorf("%s: unexpected error - got %v, want code %v",
+					test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.want) {
+			t.Errorf("%s: unexpected result - got %v, want %v",
+				test.name, result, test.want)
+		}
+	}
+}
+
+// TestRPCGzip ensures responses to HTTP POST requests are compressed with gzip
+// when enabled and accepted by the client, and that compressed responses decode
+// to the same JSON as uncompressed ones.
+func TestRPCGzip(t *testing.T) {
+	s, restore := newTestRPCServer(&config{
+		RPCUser: "admin",
+		RPCPass: "adminpass",
+		RPCGzip: true,
+	})
+	defer restore()
+
+	httpServer := httptest.NewServer(testRPCHandler(s))
+	defer httpServer.Close()
+
+	// Disable the transparent decompression of the client so the encoding
+	// of the responses can be checked.
+	client := &http.Client{
+		Transport: &http.Transport{DisableCompression: true},
+		Timeout:   10 * time.Second,
+	}
+	request := func(acceptEncoding string) (*http.Response, []byte) {
+		t.Helper()
+
+		body := `{"jsonrpc":"1.0","method":"version","params":[],"id":1}`
+		req, err := http.NewRequest("POST", httpServer.URL,
+			strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unable to create request: %v", err)
+		}
+		req.SetBasicAuth(cfg.RPCUser, cfg.RPCPass)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unable to issue request: %v", err)
+		}
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unable to read response: %v", err)
+		}
+		return resp, respBody
+	}
+
+	// The uncompressed response is the expected JSON.
+	resp, want := request("")
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		t.Fatalf("unexpected content encoding %q", encoding)
+	}
+	var reply btcjson.Response
+	if err := json.Unmarshal(want, &reply); err != nil {
+		t.Fatalf("unable to decode reply: %v", err)
+	}
+	var versions map[string]btcjson.VersionResult
+	if err := json.Unmarshal(reply.Result, &versions); err != nil {
+		t.Fatalf("unable to decode version result: %v", err)
+	}
+	got := versions["btcdjsonrpcapi"].VersionString
+	if got != jsonrpcSemverString {
+		t.Fatalf("unexpected version - got %q, want %q", got,
+			jsonrpcSemverString)
+	}
+
+	tests := []struct {
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"gzip", true},
+		{"deflate, GZIP;q=0.5", true},
+		{"x-gzip", true},
+		{"*", true},
+		{"identity", false},
+		{"gzip;q=0", false},
+		{"gzip;q=0, *", false},
+		{"*;q=0", false},
+	}
+	for _, test := range tests {
+		resp, body := request(test.acceptEncoding)
+		if vary := resp.Header.Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%q: unexpected vary header %q",
+				test.acceptEncoding, vary)
+		}
+		encoding := resp.Header.Get("Content-Encoding")
+		if !test.compressed {
+			if encoding != "" || !bytes.Equal(body, want) {
+				t.Errorf("%q: unexpected response %q (content "+
+					"encoding %q)", test.acceptEncoding, body,
+					encoding)
+			}
+			continue
+		}
+
+		if encoding != "gzip" {
+			t.Errorf("%q: unexpected content encoding %q",
+				test.acceptEncoding, encoding)
+			continue
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("%q: unable to read gzip response: %v",
+				test.acceptEncoding, err)
+			continue
+		}
+		decompressed, err := ioutil.ReadAll(gz)
+		if err != nil {
+			t.Errorf("%q: unable to decompress response: %v",
+				test.acceptEncoding, err)
+			continue
+		}
+		if !bytes.Equal(decompressed, want) {
+			t.Errorf("%q: unexpected decompressed response - got "+
+				"%q, want %q", test.acceptEncoding, decompressed,
+				want)
+		}
+	}
+
+	// Responses are not compressed when compression is disabled.
+	cfg.RPCGzip = false
+	resp, body := request("gzip")
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" ||
+		!bytes.Equal(body, want) {
+
+		t.Fatalf("unexpected response %q with compression disabled "+
+			"(content encoding %q)", body, encoding)
+	}
+	if vary := resp.Header.Get("Vary"); vary != "" {
+		t.Fatalf("unexpected vary header %q with compression disabled",
+			vary)
+	}
+}
+
+// TestHandleGetIndexInfoCatchingUp ensures an index which is being caught up to
+// the best chain is reported as catching up and not synced, and as synced once
+// the catch up is done.
+func TestHandleGetIndexInfoCatchingUp(t *testing.T) {
+	s, teardown := newTestChainRPCServer(t, "getindexinfocatchup")
+	defer teardown()
+
+	// Create enough blocks for the index to be caught up in more than one
+	// batch so it is still behind when the first progress is reported.
+	for i := 0; i < 500; i++ {
+		addTestChainBlock(t, s)
+	}
+	if err := s.cfg.Chain.FlushUtxoCache(); err != nil {
+		t.Fatalf("unable to flush utxo cache: %v", err)
+	}
+
+	// Enable the spent index after the fact so it is caught up when the
+	// chain is loaded again and query its info with each progress report.
+	s.cfg.SpentIndex = indexers.NewSpentIndex(s.cfg.DB)
+	s.cfg.IndexManager = indexers.NewManager(s.cfg.DB,
+		[]indexers.Indexer{s.cfg.SpentIndex})
+	var infos []btcjson.GetIndexInfoResult
+	s.cfg.IndexManager.SubscribeCatchUp(func(*indexers.CatchUpProgress) {
+		result, err := handleGetIndexInfo(s,
+			btcjson.NewGetIndexInfoCmd(btcjson.String("spentindex")),
+			nil)
+		if err != nil {
+			t.Errorf("handleGetIndexInfo: unexpected error: %v", err)
+			return
+		}
+		info := result.(map[string]btcjson.GetIndexInfoResult)
+		infos = append(infos, info["spentindex"])
+	})
+	_, err := blockchain.New(&blockchain.Config{
+		DB:           s.cfg.DB,
+		ChainParams:  s.cfg.ChainParams,
+		TimeSource:   blockchain.NewMedianTime(),
+		IndexManager: s.cfg.IndexManager,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	// The progress is reported for the genesis block once the first batch
+	// of blocks is indexed and for the tip once the second one is.
+	want := []btcjson.GetIndexInfoResult{
+		{Enabled: true, BestBlockHeight: 499, CatchingUp: true},
+		{Enabled: true, Synced: true, BestBlockHeight: 500},
+	}
+	if !reflect.DeepEqual(infos, want) {
+		t.Fatalf("unexpected index info -- got %+v, want %+v", infos,
+			want)
+	}
+}
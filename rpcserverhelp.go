@@ -21,7 +21,8 @@ var helpDescsEnUS = map[string]string{
 		"The levelspec can either a debug level or of the form:\n" +
 		"<subsystem>=<level>,<subsystem2>=<level2>,...\n" +
 		"The valid debug levels are trace, debug, info, warn, error, and critical.\n" +
-		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, BTCD, CHAN, DISC, PEER, RPCS, SCRP, SRVR, and TXMP.\n" +
+		"The valid subsystems are ADXR, AMGR, BCDB, BTCD, CHAN, CMGR, DISC, INDX, MINR, PEER, RPCS, SCRP, SRVR, SYNC, TXMP, and ZMQP.\n" +
+		"The levels take effect immediately and none of them are changed when any part of the levelspec is invalid.\n" +
 		"Finally the keyword 'show' will return a list of the available subsystems.",
 	"debuglevel-levelspec":   "The debug level(s) to use or the keyword 'show'",
 	"debuglevel--condition0": "levelspec!=show",
@@ -44,6 +45,12 @@ var helpDescsEnUS = map[string]string{
 	"transactioninput-txid": "The hash of the input transaction",
 	"transactioninput-vout": "The specific output of the input transaction to redeem",
 
+	// CombineRawTransactionCmd help.
+	"combinerawtransaction--synopsis": "Combines the signatures of multiple partially signed versions of the same transaction into one transaction.\n" +
+		"The outputs spent by the transaction must be in the memory pool or the utxo set.",
+	"combinerawtransaction-txs":      "The hex-encoded serialized transactions to combine",
+	"combinerawtransaction--result0": "The hex-encoded serialized transaction with the combined signatures",
+
 	// CreateRawTransactionCmd help.
 	"createrawtransaction--synopsis": "Returns a new transaction spending the provided inputs and sending to the provided addresses.\n" +
 		"The transaction inputs are not signed in the created transaction.\n" +
@@ -80,6 +87,7 @@ var helpDescsEnUS = map[string]string{
 	"vin-scriptSig":   "The signature script used to redeem the origin transaction as a JSON object (non-coinbase txns only)",
 	"vin-txinwitness": "The witness used to redeem the input encoded as a string array of its items",
 	"vin-sequence":    "The script sequence number",
+	"vin-prevout":     "Data from the origin transaction output with index vout (only when known)",
 
 	// ScriptPubKeyResult help.
 	"scriptpubkeyresult-asm":       "Disassembly of the script",
@@ -96,6 +104,9 @@ var helpDescsEnUS = map[string]string{
 	// TxRawDecodeResult help.
 	"txrawdecoderesult-txid":     "The hash of the transaction",
 	"txrawdecoderesult-version":  "The transaction version",
+	"txrawdecoderesult-size":     "The size of the transaction in bytes",
+	"txrawdecoderesult-vsize":    "The virtual size of the transaction in bytes",
+	"txrawdecoderesult-weight":   "The transaction's weight (between vsize*4-3 and vsize*4)",
 	"txrawdecoderesult-locktime": "The transaction lock time",
 	"txrawdecoderesult-vin":      "The transaction inputs as JSON objects",
 	"txrawdecoderesult-vout":     "The transaction outputs as JSON objects",
@@ -110,11 +121,23 @@ var helpDescsEnUS = map[string]string{
 	"decodescriptresult-type":      "The type of the script (e.g. 'pubkeyhash')",
 	"decodescriptresult-addresses": "The bitcoin addresses associated with this script",
 	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions (only present if the provided redeem script is not already a pay-to-script-hash script)",
+	"decodescriptresult-p2wsh":     "The pay-to-witness-script-hash address of the script (only present if the provided script is neither a pay-to-script-hash script nor a witness program)",
 
 	// DecodeScriptCmd help.
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes a snapshot of the unspent transaction output set as of the best block to a file.",
+	"dumptxoutset-path":      "The path of the snapshot file, relative to the data directory unless absolute, which must not exist yet",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "The number of unspent transaction outputs written to the snapshot",
+	"dumptxoutsetresult-base_hash":     "The hash of the block the snapshot was taken at",
+	"dumptxoutsetresult-base_height":   "The height of the block the snapshot was taken at",
+	"dumptxoutsetresult-path":          "The path of the snapshot file",
+	"dumptxoutsetresult-txoutset_hash": "The serialized hash of the unspent transaction output set the snapshot commits to",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -124,12 +147,36 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee per kilobyte in bitcoins " +
+		"required for a transaction to be confirmed within a certain number of " +
+		"blocks, falling back to the lowest greater number of blocks an estimate " +
+		"is available for.",
+	"estimatesmartfee-conftarget": "The number of blocks within which the " +
+		"transaction should be confirmed",
+	"estimatesmartfee-estimatemode": "The estimate mode: ECONOMICAL bases the " +
+		"estimate on recent blocks only, while CONSERVATIVE (also used for UNSET) " +
+		"takes a longer history into account and favors higher fees",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "Estimated fee per kilobyte in bitcoins (only when an estimate is available)",
+	"estimatesmartfeeresult-errors":  "Errors encountered while estimating the fee (only when no estimate is available)",
+	"estimatesmartfeeresult-blocks":  "The number of blocks the estimate is for",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
 	"generate-numblocks": "Number of blocks to generate",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GenerateToAddressCmd help
+	"generatetoaddress--synopsis": "Generates a set number of blocks paying the passed address (simnet or regtest only unless --allowgenerate is set)\n" +
+		"and returns a JSON array of their hashes.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address the coinbase of the generated blocks pays to",
+	"generatetoaddress-maxtries":  "The maximum number of nonces to try before giving up",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -165,6 +212,7 @@ var helpDescsEnUS = map[string]string{
 	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), or as parsed data with parsed transaction data (2) ",
 	"getblock--condition0": "verbosity=0",
 	"getblock--condition1": "verbosity=1",
+	"getblock--condition2": "verbosity=2",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
 
 	// GetBlockChainInfoCmd help.
@@ -178,8 +226,9 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-difficulty":           "The current chain difficulty",
 	"getblockchaininforesult-mediantime":           "The median time from the PoV of the best block in the chain",
 	"getblockchaininforesult-verificationprogress": "An estimate for how much of the best chain we've verified",
+	"getblockchaininforesult-size_on_disk":         "The estimated size of the block files on disk in bytes",
 	"getblockchaininforesult-pruned":               "A bool that indicates if the node is pruned or not",
-	"getblockchaininforesult-pruneheight":          "The lowest block retained in the current pruned chain",
+	"getblockchaininforesult-pruneheight":          "The lowest block retained in the current pruned chain (only when pruned)",
 	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
@@ -204,20 +253,22 @@ var helpDescsEnUS = map[string]string{
 	"unifiedsoftforks-softforks--desc":  "JSON object describing an active softfork deployment used by bitcoind on or after v0.19.0",
 
 	// TxRawResult help.
-	"txrawresult-hex":           "Hex-encoded transaction",
-	"txrawresult-txid":          "The hash of the transaction",
-	"txrawresult-version":       "The transaction version",
-	"txrawresult-locktime":      "The transaction lock time",
-	"txrawresult-vin":           "The transaction inputs as JSON objects",
-	"txrawresult-vout":          "The transaction outputs as JSON objects",
-	"txrawresult-blockhash":     "Hash of the block the transaction is part of",
-	"txrawresult-confirmations": "Number of confirmations of the block",
-	"txrawresult-time":          "Transaction time in seconds since 1 Jan 1970 GMT",
-	"txrawresult-blocktime":     "Block time in seconds since the 1 Jan 1970 GMT",
-	"txrawresult-size":          "The size of the transaction in bytes",
-	"txrawresult-vsize":         "The virtual size of the transaction in bytes",
-	"txrawresult-weight":        "The transaction's weight (between vsize*4-3 and vsize*4)",
-	"txrawresult-hash":          "The wtxid of the transaction",
+	"txrawresult-hex":             "Hex-encoded transaction",
+	"txrawresult-txid":            "The hash of the transaction",
+	"txrawresult-version":         "The transaction version",
+	"txrawresult-locktime":        "The transaction lock time",
+	"txrawresult-vin":             "The transaction inputs as JSON objects",
+	"txrawresult-vout":            "The transaction outputs as JSON objects",
+	"txrawresult-fee":             "The fee paid by the transaction in BTC (only when the spent outputs are known)",
+	"txrawresult-blockhash":       "Hash of the block the transaction is part of",
+	"txrawresult-confirmations":   "Number of confirmations of the block",
+	"txrawresult-time":            "Transaction time in seconds since 1 Jan 1970 GMT",
+	"txrawresult-blocktime":       "Block time in seconds since the 1 Jan 1970 GMT",
+	"txrawresult-size":            "The size of the transaction in bytes",
+	"txrawresult-vsize":           "The virtual size of the transaction in bytes",
+	"txrawresult-weight":          "The transaction's weight (between vsize*4-3 and vsize*4)",
+	"txrawresult-hash":            "The wtxid of the transaction",
+	"txrawresult-in_active_chain": "Whether or not the block the transaction was searched for in is part of the main chain (only when a block hash is provided)",
 
 	// SearchRawTransactionsResult help.
 	"searchrawtransactionsresult-hex":           "Hex-encoded transaction",
@@ -244,7 +295,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-versionHex":        "The block version in hexadecimal",
 	"getblockverboseresult-merkleroot":        "Root hash of the merkle tree",
 	"getblockverboseresult-tx":                "The transaction hashes (only when verbosity=1)",
-	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2)",
+	"getblockverboseresult-rawtx":             "Deprecated: the transactions are returned in the tx field of the verbosity=2 result instead",
 	"getblockverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
 	"getblockverboseresult-nonce":             "The block nonce",
 	"getblockverboseresult-bits":              "The bits which represent the block difficulty",
@@ -254,15 +305,51 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-strippedsize":      "The size of the block without witness data",
 	"getblockverboseresult-weight":            "The weight of the block",
 
+	// GetBlockVerboseTxResult help.
+	"getblockverbosetxresult-hash":              "The hash of the block (same as provided)",
+	"getblockverbosetxresult-confirmations":     "The number of confirmations",
+	"getblockverbosetxresult-size":              "The size of the block",
+	"getblockverbosetxresult-height":            "The height of the block in the block chain",
+	"getblockverbosetxresult-version":           "The block version",
+	"getblockverbosetxresult-versionHex":        "The block version in hexadecimal",
+	"getblockverbosetxresult-merkleroot":        "Root hash of the merkle tree",
+	"getblockverbosetxresult-tx":                "The transactions as JSON objects including the details of the spent outputs and the fees",
+	"getblockverbosetxresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockverbosetxresult-nonce":             "The block nonce",
+	"getblockverbosetxresult-bits":              "The bits which represent the block difficulty",
+	"getblockverbosetxresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockverbosetxresult-previousblockhash": "The hash of the previous block",
+	"getblockverbosetxresult-nextblockhash":     "The hash of the next block (only if there is one)",
+	"getblockverbosetxresult-strippedsize":      "The size of the block without witness data",
+	"getblockverbosetxresult-weight":            "The weight of the block",
+
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
 
+	// GetBlockFromPeerCmd help.
+	"getblockfrompeer--synopsis": "Requests a block from a connected peer and waits until it is processed.  The block is stored if it is valid, even when it is not part of the main chain.",
+	"getblockfrompeer-blockhash": "The hash of the block to request",
+	"getblockfrompeer-peerid":    "The id of the peer to request the block from, as reported by getpeerinfo",
+
 	// GetBlockHashCmd help.
 	"getblockhash--synopsis": "Returns hash of the block in best block chain at the given height.",
 	"getblockhash-index":     "The block height",
 	"getblockhash--result0":  "The block hash",
 
+	// GetBlockHashByTimeCmd help.
+	"getblockhashbytime--synopsis": "Returns hash of the first block in the best block chain with a median time at or after the given time.\n" +
+		"The median time of the previous blocks is used since block timestamps are not required to be in order.",
+	"getblockhashbytime-timestamp": "The time in seconds since 1 Jan 1970 GMT",
+	"getblockhashbytime--result0":  "The block hash",
+
+	// GetBlockHashesCmd help.
+	"getblockhashes--synopsis": "Returns the hashes of the blocks in the best block chain starting at the given height, in order of height.\n" +
+		"Fewer than count hashes are returned when the range extends past the best block.",
+	"getblockhashes-startheight": "The height of the first block",
+	"getblockhashes-count":       "The number of block hashes to return (1 to 2000)",
+	"getblockhashes--result0":    "The block hashes",
+
 	// GetBlockHeaderCmd help.
 	"getblockheader--synopsis":   "Returns information about a block header given its hash.",
 	"getblockheader-hash":        "The hash of the block",
@@ -282,6 +369,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-nonce":             "The block nonce",
 	"getblockheaderverboseresult-bits":              "The bits which represent the block difficulty",
 	"getblockheaderverboseresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockheaderverboseresult-chainwork":         "The total cumulative work in the chain up to and including this block in hex",
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
@@ -295,7 +383,7 @@ var helpDescsEnUS = map[string]string{
 	"templaterequest-target":       "The desired target for the block template (this parameter is ignored)",
 	"templaterequest-data":         "Hex-encoded block data (only for mode=proposal)",
 	"templaterequest-workid":       "The server provided workid if provided in block template (not applicable)",
-	"templaterequest-rules":        "Specific block rules that are to be enforced e.g. '[\"segwit\"]",
+	"templaterequest-rules":        "The soft-fork rules supported by the client, which must include the active rules that change the structure of blocks e.g. '[\"segwit\"]'",
 
 	// GetBlockTemplateResultTx help.
 	"getblocktemplateresulttx-data":    "Hex-encoded transaction data (byte-for-byte)",
@@ -335,6 +423,11 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplateresult-reject-reason":              "Reason the proposal was invalid as-is (only applies to proposal responses)",
 	"getblocktemplateresult-default_witness_commitment": "The witness commitment itself. Will be populated if the block has witness data",
 	"getblocktemplateresult-weightlimit":                "The current limit on the max allowed weight of a block",
+	"getblocktemplateresult-rules":                      "The active soft-fork rules; those prefixed with '!' must be understood by the client and listed in the 'rules' of the request",
+	"getblocktemplateresult-vbavailable":                "The soft-fork deployments blocks may currently signal support for",
+	"getblocktemplateresult-vbavailable--key":           "rulename",
+	"getblocktemplateresult-vbavailable--value":         "n",
+	"getblocktemplateresult-vbavailable--desc":          "The bits of the soft-fork deployments blocks may currently signal support for keyed by their names",
 
 	// GetBlockTemplateCmd help.
 	"getblocktemplate--synopsis": "Returns a JSON object with information necessary to construct a block to mine or accepts a proposal to validate.\n" +
@@ -357,6 +450,32 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetCFiltersCmd help.
+	"getcfilters--synopsis":   "Returns the committed filters of a range of at most 1000 blocks in the same way peers are served getcfilters requests.",
+	"getcfilters-startheight": "The height of the first block in the range",
+	"getcfilters-stophash":    "The hash of the last block in the range",
+	"getcfilters-filtertype":  "The type of filters to return (0=regular)",
+
+	// GetCFiltersResult help.
+	"getcfiltersresult-blockhash": "The hash of the block",
+	"getcfiltersresult-filter":    "The block's committed filter",
+
+	// GetChainStatesCmd help.
+	"getchainstates--synopsis": "Returns information about the chainstates of the node, the fully validated one followed by the one built from a utxo snapshot, if any.",
+
+	// GetChainStatesResult help.
+	"getchainstatesresult-headers":     "The number of headers in the best known chain",
+	"getchainstatesresult-chainstates": "The chainstates ordered by work, with the fully validated chainstate first",
+
+	// ChainStateResult help.
+	"chainstateresult-blocks":               "The number of blocks in the chainstate",
+	"chainstateresult-bestblockhash":        "The hash of the tip of the chainstate",
+	"chainstateresult-difficulty":           "The difficulty of the tip of the chainstate",
+	"chainstateresult-verificationprogress": "An estimate of how much of the chainstate has been verified",
+	"chainstateresult-coins":                "The number of unspent transaction outputs in the chainstate",
+	"chainstateresult-snapshot_blockhash":   "The hash of the block the utxo snapshot of the chainstate was taken at (only for snapshot chainstates)",
+	"chainstateresult-validated":            "Whether the chainstate has been fully validated",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -413,9 +532,44 @@ var helpDescsEnUS = map[string]string{
 	"getheaders-hashstop":      "Block hash to stop including block headers for; if not found, all headers to the latest known block are returned.",
 	"getheaders--result0":      "Serialized block headers of all located blocks, limited to some arbitrary maximum number of hashes (currently 2000, which matches the wire protocol headers message, but this is not guaranteed)",
 
+	// GetIndexInfoCmd help.
+	"getindexinfo--synopsis":       "Returns the status of the optional indexes.",
+	"getindexinfo-indexname":       "Only return the status of the index with this name (txindex, addrindex, cfindex, spentindex, or coinstatsindex)",
+	"getindexinfo--result0--desc":  "Index status objects keyed by the index name",
+	"getindexinfo--result0--key":   "The index name",
+	"getindexinfo--result0--value": "Object containing the status of the index",
+
+	// GetIndexInfoResult help.
+	"getindexinforesult-enabled":           "Whether or not the index is enabled",
+	"getindexinforesult-synced":            "Whether or not the index is synced with the best chain",
+	"getindexinforesult-best_block_height": "The height of the most recent block that has been indexed or -1 if none",
+	"getindexinforesult-catching_up":       "Whether or not the index is currently being caught up to the best chain",
+
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMemoryInfoCmd help.
+	"getmemoryinfo--synopsis": "Returns statistics about the memory used by the Go runtime along with the sizes of the major caches and pools.",
+	"getmemoryinfo-mode":      "Only 'stats' is supported",
+
+	// GetMemoryInfoResult help.
+	"getmemoryinforesult-heapalloc":        "Bytes of allocated heap objects",
+	"getmemoryinforesult-heapinuse":        "Bytes in in-use heap spans",
+	"getmemoryinforesult-heapsys":          "Bytes of heap memory obtained from the OS",
+	"getmemoryinforesult-heapobjects":      "Number of allocated heap objects",
+	"getmemoryinforesult-totalalloc":       "Cumulative bytes allocated for heap objects",
+	"getmemoryinforesult-sys":              "Total bytes of memory obtained from the OS",
+	"getmemoryinforesult-numgc":            "Number of completed garbage collection cycles",
+	"getmemoryinforesult-pausetotalns":     "Cumulative nanoseconds spent in garbage collection pauses",
+	"getmemoryinforesult-goroutines":       "Number of goroutines",
+	"getmemoryinforesult-utxocacheentries": "Number of entries in the utxo cache",
+	"getmemoryinforesult-utxocachesize":    "Approximate bytes of memory used by the utxo cache",
+	"getmemoryinforesult-sigcacheentries":  "Number of entries in the signature cache",
+	"getmemoryinforesult-hashcacheentries": "Number of transactions in the signature hash cache",
+	"getmemoryinforesult-mempoolsize":      "Number of transactions in the mempool",
+	"getmemoryinforesult-mempoolbytes":     "Serialized size in bytes of the transactions in the mempool",
+	"getmemoryinforesult-orphanpoolsize":   "Number of transactions in the orphan pool",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
@@ -425,9 +579,9 @@ var helpDescsEnUS = map[string]string{
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
-	"getmininginforesult-currentblocksize":   "Size of the latest best block",
-	"getmininginforesult-currentblockweight": "Weight of the latest best block",
-	"getmininginforesult-currentblocktx":     "Number of transactions in the latest best block",
+	"getmininginforesult-currentblocksize":   "Size of the most recently generated block template (only if one was generated)",
+	"getmininginforesult-currentblockweight": "Weight of the most recently generated block template (only if one was generated)",
+	"getmininginforesult-currentblocktx":     "Number of transactions excluding the coinbase in the most recently generated block template (only if one was generated)",
 	"getmininginforesult-difficulty":         "Current target difficulty",
 	"getmininginforesult-errors":             "Any current errors",
 	"getmininginforesult-generate":           "Whether or not server is set to generate coins",
@@ -435,6 +589,7 @@ var helpDescsEnUS = map[string]string{
 	"getmininginforesult-hashespersec":       "Recent hashes per second performance measurement while generating coins",
 	"getmininginforesult-networkhashps":      "Estimated network hashes per second for the most recent blocks",
 	"getmininginforesult-pooledtx":           "Number of transactions in the memory pool",
+	"getmininginforesult-chain":              "The name of the active network",
 	"getmininginforesult-testnet":            "Whether or not server is using testnet",
 
 	// GetMiningInfoCmd help.
@@ -446,6 +601,38 @@ var helpDescsEnUS = map[string]string{
 	"getnetworkhashps-height":    "Perform estimate ending with this height or -1 for current best chain block height",
 	"getnetworkhashps--result0":  "Estimated hashes per second",
 
+	// GetNetworkInfoCmd help.
+	"getnetworkinfo--synopsis": "Returns a JSON object containing information about the peer-to-peer network state of the server.",
+
+	// NetworksResult help.
+	"networksresult-name":                        "The network name (ipv4, ipv6, or onion)",
+	"networksresult-limited":                     "Whether or not connections to the network are disabled",
+	"networksresult-reachable":                   "Whether or not the network is reachable",
+	"networksresult-proxy":                       "The proxy used for the network, if any",
+	"networksresult-proxy_randomize_credentials": "Whether or not proxy credentials are randomized for each connection",
+
+	// LocalAddressesResult help.
+	"localaddressesresult-address": "The local address",
+	"localaddressesresult-port":    "The local port",
+	"localaddressesresult-score":   "The relative score of the address as a candidate to advertise to peers",
+
+	// GetNetworkInfoResult help.
+	"getnetworkinforesult-version":         "The version of the server",
+	"getnetworkinforesult-subversion":      "The user agent the server advertises to its peers",
+	"getnetworkinforesult-protocolversion": "The latest supported protocol version",
+	"getnetworkinforesult-localservices":   "The hex-encoded service flags the server advertises to its peers",
+	"getnetworkinforesult-localrelay":      "Whether or not the server asks its peers to relay transactions",
+	"getnetworkinforesult-timeoffset":      "The time offset in seconds",
+	"getnetworkinforesult-connections":     "The total number of connected peers",
+	"getnetworkinforesult-connections_in":  "The number of inbound connected peers",
+	"getnetworkinforesult-connections_out": "The number of outbound connected peers",
+	"getnetworkinforesult-networkactive":   "Whether or not networking is enabled",
+	"getnetworkinforesult-networks":        "Information about each network the server can connect to",
+	"getnetworkinforesult-relayfee":        "The minimum relay fee for transactions in BTC/kB",
+	"getnetworkinforesult-incrementalfee":  "The minimum fee rate increment for replacing transactions in BTC/kB",
+	"getnetworkinforesult-localaddresses":  "The local addresses the server may advertise to its peers",
+	"getnetworkinforesult-warnings":        "Any network warnings",
+
 	// GetNetTotalsCmd help.
 	"getnettotals--synopsis": "Returns a JSON object containing network traffic statistics.",
 
@@ -466,31 +653,58 @@ var helpDescsEnUS = map[string]string{
 	"getnodeaddresses--result0":  "List of node addresses",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":              "A unique node ID",
+	"getpeerinforesult-addr":            "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":       "Local address",
+	"getpeerinforesult-services":        "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":       "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":        "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":        "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":       "Total bytes sent",
+	"getpeerinforesult-bytesrecv":       "Total bytes received",
+	"getpeerinforesult-conntime":        "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":      "The time offset of the peer",
+	"getpeerinforesult-pingtime":        "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":        "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":         "The protocol version of the peer",
+	"getpeerinforesult-subver":          "The user agent of the peer",
+	"getpeerinforesult-inbound":         "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-addnode":         "Whether or not the connection to the peer was requested by the user via --connect, --addpeer, or the RPC server",
+	"getpeerinforesult-connection_type": "The type of the connection to the peer (inbound, outbound-full-relay, block-relay-only, or manual)",
+	"getpeerinforesult-startingheight":  "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":   "The current height of the peer",
+	"getpeerinforesult-banscore":        "The ban score",
+	"getpeerinforesult-feefilter":       "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":        "Whether or not the peer is the sync peer",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
+	// RawAddrManEntry help.
+	"rawaddrmanentry-address":        "The IP address of the peer",
+	"rawaddrmanentry-port":           "The port of the peer",
+	"rawaddrmanentry-services":       "The services offered by the peer",
+	"rawaddrmanentry-time":           "Time the peer was last seen in seconds since 1 Jan 1970 GMT",
+	"rawaddrmanentry-network":        "The network of the address (ipv4, ipv6, or onion)",
+	"rawaddrmanentry-source":         "The IP address of the peer the address was received from",
+	"rawaddrmanentry-source_network": "The network of the source address (ipv4, ipv6, or onion)",
+	"rawaddrmanentry-attempts":       "The number of connection attempts since the last successful connection",
+	"rawaddrmanentry-lasttry":        "Time of the last connection attempt in seconds since 1 Jan 1970 GMT or 0 if never attempted",
+	"rawaddrmanentry-lastsuccess":    "Time of the last successful connection in seconds since 1 Jan 1970 GMT or 0 if never connected",
+
+	// GetRawAddrManResult help.
+	"getrawaddrmanresult-new":          "The addresses of the new table",
+	"getrawaddrmanresult-new--key":     "bucket/position",
+	"getrawaddrmanresult-new--value":   "An object describing the address",
+	"getrawaddrmanresult-new--desc":    "The addresses of the new table keyed by their bucket and position within it",
+	"getrawaddrmanresult-tried":        "The addresses of the tried table",
+	"getrawaddrmanresult-tried--key":   "bucket/position",
+	"getrawaddrmanresult-tried--value": "An object describing the address",
+	"getrawaddrmanresult-tried--desc":  "The addresses of the tried table keyed by their bucket and position within it",
+
+	// GetRawAddrManCmd help.
+	"getrawaddrman--synopsis": "Returns the addresses of the new and tried tables of the address manager along with their buckets for debugging.",
+
 	// GetRawMempoolVerboseResult help.
 	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
 	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
@@ -510,13 +724,25 @@ var helpDescsEnUS = map[string]string{
 	"getrawmempool--result0":    "Array of transaction hashes",
 
 	// GetRawTransactionCmd help.
-	"getrawtransaction--synopsis":   "Returns information about a transaction given its hash.",
+	"getrawtransaction--synopsis":   "Returns information about a transaction given its hash.  The verbose result only includes the outputs spent by the transaction and its fee when the transaction index is enabled (--txindex).",
 	"getrawtransaction-txid":        "The hash of the transaction",
 	"getrawtransaction-verbose":     "Specifies the transaction is returned as a JSON object instead of a hex-encoded string",
+	"getrawtransaction-blockhash":   "The hash of the block to search for the transaction, which does not require the transaction index (--txindex)",
 	"getrawtransaction--condition0": "verbose=false",
 	"getrawtransaction--condition1": "verbose=true",
 	"getrawtransaction--result0":    "Hex-encoded bytes of the serialized transaction",
 
+	// GetSpentInfoCmd help.
+	"getspentinfo--synopsis": "Returns the transaction input in the main chain that spent a transaction output.\n" +
+		"This requires the spent output index to be enabled (--spentindex).",
+	"getspentinfo-txid": "The hash of the transaction",
+	"getspentinfo-vout": "The index of the output",
+
+	// GetSpentInfoResult help.
+	"getspentinforesult-txid":   "The hash of the spending transaction",
+	"getspentinforesult-index":  "The index of the spending input",
+	"getspentinforesult-height": "The height of the block that contains the spending transaction",
+
 	// GetTxOutResult help.
 	"gettxoutresult-bestblock":     "The block hash that contains the transaction output",
 	"gettxoutresult-confirmations": "The number of confirmations",
@@ -531,6 +757,42 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics about the unspent transaction output set.\n" +
+		"This scans the entire set, so it may take a long time, unless the coin stats index is enabled (--coinstatsindex) and the hash type is ecmh or none.",
+	"gettxoutsetinfo-hashtype": "The type of hash to calculate for the serialized set (hash_serialized_2, ecmh, or none) -- ecmh requires the coin stats index",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":            "The height of the best block",
+	"gettxoutsetinforesult-bestblock":         "The hash of the best block",
+	"gettxoutsetinforesult-transactions":      "The number of transactions with unspent outputs (omitted when using the coin stats index)",
+	"gettxoutsetinforesult-txouts":            "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-bogosize":          "A database-independent metric for the size of the set",
+	"gettxoutsetinforesult-hash_serialized_2": "The hash of the serialized set (omitted when the hash type is none)",
+	"gettxoutsetinforesult-ecmh":              "The elliptic curve multiset hash of the set (only present when the hash type is ecmh)",
+	"gettxoutsetinforesult-disk_size":         "The size of the serialized set in the database (omitted when using the coin stats index)",
+	"gettxoutsetinforesult-total_amount":      "The total amount of all unspent outputs in BTC",
+
+	// MatchFilterCmd help.
+	"matchfilter--synopsis": "Returns the items which match the committed filter of a block.\n" +
+		"Filters are probabilistic, so a matched item is not guaranteed to be included in the block, while an item that does not match is guaranteed not to be.",
+	"matchfilter-blockhash":  "The hash of the block",
+	"matchfilter-items":      "Hex-encoded items, such as output scripts, to match against the filter",
+	"matchfilter-filtertype": "The type of filter to match against (0 = regular)",
+	"matchfilter--result0":   "The items which match the filter",
+
+	// ScanBlockFiltersCmd help.
+	"scanblockfilters--synopsis": "Returns the blocks from the provided block to the best block whose committed filter matches any of the provided addresses.\n" +
+		"Filters are probabilistic, so the returned blocks may not actually pay to or spend from the addresses, while the blocks that are not returned are guaranteed not to.",
+	"scanblockfilters-blockhash":  "The hash of the block to start the scan at",
+	"scanblockfilters-addresses":  "The addresses to match against the filters",
+	"scanblockfilters-filtertype": "The type of filter to match against (0 = regular)",
+
+	// ScanBlockFiltersResult help.
+	"scanblockfiltersresult-fromheight": "The height of the first block scanned",
+	"scanblockfiltersresult-toheight":   "The height of the last block scanned",
+	"scanblockfiltersresult-blocks":     "The hashes of the blocks whose filter matches any of the addresses in ascending order of height",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -539,10 +801,32 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// LoadMempoolCmd help.
+	"loadmempool--synopsis": "Adds the transactions saved to the mempool.dat file in the data directory by savemempool or on shutdown back to the memory pool.\n" +
+		"Transactions which are no longer valid against the current best chain, such as those which have since been confirmed, are skipped.",
+
+	// LoadMempoolResult help.
+	"loadmempoolresult-filename": "The path of the file the transactions were loaded from",
+	"loadmempoolresult-restored": "The number of transactions which were added to the memory pool",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adds a fee delta to a transaction in the memory pool which changes the fee it is considered to pay when selecting transactions for block templates without changing the fee it actually pays.\n" +
+		"Repeated calls accumulate the deltas, which are discarded once the transaction leaves the memory pool.",
+	"prioritisetransaction-txid":          "The hash of the transaction",
+	"prioritisetransaction-prioritydelta": "Unused and only accepted for compatibility, must be 0",
+	"prioritisetransaction-feedelta":      "The fee delta in satoshi to add to the transaction, which may be negative",
+	"prioritisetransaction--result0":      "Whether or not the transaction was prioritised",
+
+	// SaveMempoolCmd help.
+	"savemempool--synopsis": "Saves the transactions in the memory pool to the mempool.dat file in the data directory so they can be restored on startup or with loadmempool.",
+
+	// SaveMempoolResult help.
+	"savemempoolresult-filename": "The path of the file the transactions were saved to",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -578,6 +862,35 @@ var helpDescsEnUS = map[string]string{
 	"signmessagewithprivkey-message":   "The message to create a signature of",
 	"signmessagewithprivkey--result0":  "The signature of the message encoded in base 64",
 
+	// RawTxWitnessInput help.
+	"rawtxwitnessinput-txid":          "The hash of the transaction containing the spent output",
+	"rawtxwitnessinput-vout":          "The index of the spent output",
+	"rawtxwitnessinput-scriptPubKey":  "The hex-encoded public key script of the spent output",
+	"rawtxwitnessinput-redeemScript":  "The hex-encoded redeem script (P2SH outputs only)",
+	"rawtxwitnessinput-witnessScript": "The hex-encoded witness script (currently not supported)",
+	"rawtxwitnessinput-amount":        "The amount of the spent output in BTC (required for segwit outputs)",
+
+	// SignRawTransactionWithKeyCmd help.
+	"signrawtransactionwithkey--synopsis": "Signs the inputs of a raw transaction with the provided private keys.\n" +
+		"The outputs spent by the transaction are looked up in the memory pool and the utxo set unless they are provided.\n" +
+		"P2PKH, P2WPKH, and P2SH outputs, including P2SH-wrapped P2WPKH outputs, can be signed.",
+	"signrawtransactionwithkey-rawtx":       "The hex-encoded serialized transaction",
+	"signrawtransactionwithkey-privkeys":    "The private keys to sign the transaction with in the Wallet Import Format",
+	"signrawtransactionwithkey-inputs":      "The details of the outputs spent by the transaction which are not in the memory pool or the utxo set",
+	"signrawtransactionwithkey-sighashtype": "The signature hash type (ALL, NONE, or SINGLE, optionally combined with ANYONECANPAY using |)",
+
+	// SignRawTransactionWithKeyResult help.
+	"signrawtransactionwithkeyresult-hex":      "The hex-encoded serialized transaction with the signatures",
+	"signrawtransactionwithkeyresult-complete": "Whether or not all of the inputs are fully signed",
+	"signrawtransactionwithkeyresult-errors":   "The inputs which are not fully signed (only if there are any)",
+
+	// SignRawTransactionError help.
+	"signrawtransactionerror-txid":      "The hash of the transaction containing the spent output",
+	"signrawtransactionerror-vout":      "The index of the spent output",
+	"signrawtransactionerror-scriptSig": "The hex-encoded signature script of the input",
+	"signrawtransactionerror-sequence":  "The script sequence number of the input",
+	"signrawtransactionerror-error":     "The reason the input is not fully signed",
+
 	// StopCmd help.
 	"stop--synopsis": "Shutdown btcd.",
 	"stop--result0":  "The string 'btcd stopping.'",
@@ -687,6 +1000,22 @@ var helpDescsEnUS = map[string]string{
 	"rescannedblock-hash":         "Hash of the matching block.",
 	"rescannedblock-transactions": "List of matching transactions, serialized and hex-encoded.",
 
+	// TestMempoolAcceptCmd help.
+	"testmempoolaccept--synopsis": "Returns whether each of the passed raw transactions would be accepted into the memory pool without adding them. Every transaction is checked against the current memory pool on its own.",
+	"testmempoolaccept-rawtxns":   "Serialized, hex-encoded transactions to check",
+
+	// TestMempoolAcceptResult help.
+	"testmempoolacceptresult-txid":          "The hash of the transaction",
+	"testmempoolacceptresult-wtxid":         "The witness hash of the transaction",
+	"testmempoolacceptresult-allowed":       "Whether or not the transaction would be accepted into the memory pool",
+	"testmempoolacceptresult-vsize":         "The virtual size of the transaction (only when allowed)",
+	"testmempoolacceptresult-fees":          "The fees paid by the transaction (only when allowed)",
+	"testmempoolacceptresult-feerate":       "The fee rate of the transaction in BTC/kvB (only when allowed)",
+	"testmempoolacceptresult-reject-reason": "The reason the transaction would be rejected (only when not allowed)",
+
+	// TestMempoolAcceptFees help.
+	"testmempoolacceptfees-base": "The fee paid by the transaction in BTC",
+
 	// Uptime help.
 	"uptime--synopsis": "Returns the total uptime of the server.",
 	"uptime--result0":  "The number of seconds that the server has been running",
@@ -704,60 +1033,103 @@ var helpDescsEnUS = map[string]string{
 	"versionresult-patch":         "The patch component of the JSON-RPC API version",
 	"versionresult-prerelease":    "Prerelease info about the current build",
 	"versionresult-buildmetadata": "Metadata about the current build",
+
+	// WaitForBlockCmd help.
+	"waitforblock--synopsis": "Waits until the block with the provided hash becomes the tip of the best chain or the timeout expires and returns the tip at that time.",
+	"waitforblock-blockhash": "The hash of the block to wait for",
+	"waitforblock-timeout":   "The time to wait in milliseconds, or 0 to wait indefinitely",
+
+	// WaitForBlockHeightCmd help.
+	"waitforblockheight--synopsis": "Waits until the best chain reaches at least the provided height or the timeout expires and returns the tip at that time.",
+	"waitforblockheight-height":    "The height to wait for",
+	"waitforblockheight-timeout":   "The time to wait in milliseconds, or 0 to wait indefinitely",
+
+	// WaitForNewBlockCmd help.
+	"waitfornewblock--synopsis": "Waits until the tip of the best chain changes or the timeout expires and returns the tip at that time.",
+	"waitfornewblock-timeout":   "The time to wait in milliseconds, or 0 to wait indefinitely",
+
+	// WaitForBlockResult help.
+	"waitforblockresult-hash":   "The hash of the tip of the best chain",
+	"waitforblockresult-height": "The height of the tip of the best chain",
 }
 
 // rpcResultTypes specifies the result types that each RPC command can return.
 // This information is used to generate the help.  Each result type must be a
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
-	"addnode":                nil,
-	"createrawtransaction":   {(*string)(nil)},
-	"debuglevel":             {(*string)(nil), (*string)(nil)},
-	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
-	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
-	"estimatefee":            {(*float64)(nil)},
-	"generate":               {(*[]string)(nil)},
-	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
-	"getbestblock":           {(*btcjson.GetBestBlockResult)(nil)},
-	"getbestblockhash":       {(*string)(nil)},
-	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
-	"getblockcount":          {(*int64)(nil)},
-	"getblockhash":           {(*string)(nil)},
-	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
-	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
-	"getblockchaininfo":      {(*btcjson.GetBlockChainInfoResult)(nil)},
-	"getcfilter":             {(*string)(nil)},
-	"getcfilterheader":       {(*string)(nil)},
-	"getconnectioncount":     {(*int32)(nil)},
-	"getcurrentnet":          {(*uint32)(nil)},
-	"getdifficulty":          {(*float64)(nil)},
-	"getgenerate":            {(*bool)(nil)},
-	"gethashespersec":        {(*float64)(nil)},
-	"getheaders":             {(*[]string)(nil)},
-	"getinfo":                {(*btcjson.InfoChainResult)(nil)},
-	"getmempoolinfo":         {(*btcjson.GetMempoolInfoResult)(nil)},
-	"getmininginfo":          {(*btcjson.GetMiningInfoResult)(nil)},
-	"getnettotals":           {(*btcjson.GetNetTotalsResult)(nil)},
-	"getnetworkhashps":       {(*int64)(nil)},
-	"getnodeaddresses":       {(*[]btcjson.GetNodeAddressesResult)(nil)},
-	"getpeerinfo":            {(*[]btcjson.GetPeerInfoResult)(nil)},
-	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
-	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
-	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
-	"node":                   nil,
-	"help":                   {(*string)(nil), (*string)(nil)},
-	"ping":                   nil,
-	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
-	"sendrawtransaction":     {(*string)(nil)},
-	"setgenerate":            nil,
-	"signmessagewithprivkey": {(*string)(nil)},
-	"stop":                   {(*string)(nil)},
-	"submitblock":            {nil, (*string)(nil)},
-	"uptime":                 {(*int64)(nil)},
-	"validateaddress":        {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":            {(*bool)(nil)},
-	"verifymessage":          {(*bool)(nil)},
-	"version":                {(*map[string]btcjson.VersionResult)(nil)},
+	"addnode":                   nil,
+	"combinerawtransaction":     {(*string)(nil)},
+	"createrawtransaction":      {(*string)(nil)},
+	"debuglevel":                {(*string)(nil), (*string)(nil)},
+	"decoderawtransaction":      {(*btcjson.TxRawDecodeResult)(nil)},
+	"decodescript":              {(*btcjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":              {(*btcjson.DumpTxOutSetResult)(nil)},
+	"estimatefee":               {(*float64)(nil)},
+	"estimatesmartfee":          {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"generate":                  {(*[]string)(nil)},
+	"generatetoaddress":         {(*[]string)(nil)},
+	"getaddednodeinfo":          {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getbestblock":              {(*btcjson.GetBestBlockResult)(nil)},
+	"getbestblockhash":          {(*string)(nil)},
+	"getblock":                  {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil), (*btcjson.GetBlockVerboseTxResult)(nil)},
+	"getblockcount":             {(*int64)(nil)},
+	"getblockfrompeer":          nil,
+	"getblockhash":              {(*string)(nil)},
+	"getblockhashbytime":        {(*string)(nil)},
+	"getblockhashes":            {(*[]string)(nil)},
+	"getblockheader":            {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblocktemplate":          {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getblockchaininfo":         {(*btcjson.GetBlockChainInfoResult)(nil)},
+	"getcfilter":                {(*string)(nil)},
+	"getcfilterheader":          {(*string)(nil)},
+	"getcfilters":               {(*[]btcjson.GetCFiltersResult)(nil)},
+	"getchainstates":            {(*btcjson.GetChainStatesResult)(nil)},
+	"getconnectioncount":        {(*int32)(nil)},
+	"getcurrentnet":             {(*uint32)(nil)},
+	"getdifficulty":             {(*float64)(nil)},
+	"getgenerate":               {(*bool)(nil)},
+	"gethashespersec":           {(*float64)(nil)},
+	"getheaders":                {(*[]string)(nil)},
+	"getindexinfo":              {(*map[string]btcjson.GetIndexInfoResult)(nil)},
+	"getinfo":                   {(*btcjson.InfoChainResult)(nil)},
+	"getmemoryinfo":             {(*btcjson.GetMemoryInfoResult)(nil)},
+	"getmempoolinfo":            {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmininginfo":             {(*btcjson.GetMiningInfoResult)(nil)},
+	"getnettotals":              {(*btcjson.GetNetTotalsResult)(nil)},
+	"getnetworkhashps":          {(*int64)(nil)},
+	"getnetworkinfo":            {(*btcjson.GetNetworkInfoResult)(nil)},
+	"getnodeaddresses":          {(*[]btcjson.GetNodeAddressesResult)(nil)},
+	"getpeerinfo":               {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"getrawaddrman":             {(*btcjson.GetRawAddrManResult)(nil)},
+	"getrawmempool":             {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getrawtransaction":         {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getspentinfo":              {(*btcjson.GetSpentInfoResult)(nil)},
+	"gettxout":                  {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":           {(*btcjson.GetTxOutSetInfoResult)(nil)},
+	"node":                      nil,
+	"help":                      {(*string)(nil), (*string)(nil)},
+	"loadmempool":               {(*btcjson.LoadMempoolResult)(nil)},
+	"matchfilter":               {(*[]string)(nil)},
+	"scanblockfilters":          {(*btcjson.ScanBlockFiltersResult)(nil)},
+	"ping":                      nil,
+	"prioritisetransaction":     {(*bool)(nil)},
+	"savemempool":               {(*btcjson.SaveMempoolResult)(nil)},
+	"searchrawtransactions":     {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
+	"sendrawtransaction":        {(*string)(nil)},
+	"setgenerate":               nil,
+	"signmessagewithprivkey":    {(*string)(nil)},
+	"signrawtransactionwithkey": {(*btcjson.SignRawTransactionWithKeyResult)(nil)},
+	"stop":                      {(*string)(nil)},
+	"submitblock":               {nil, (*string)(nil)},
+	"testmempoolaccept":         {(*[]btcjson.TestMempoolAcceptResult)(nil)},
+	"uptime":                    {(*int64)(nil)},
+	"validateaddress":           {(*btcjson.ValidateAddressChainResult)(nil)},
+	"verifychain":               {(*bool)(nil)},
+	"verifymessage":             {(*bool)(nil)},
+	"version":                   {(*map[string]btcjson.VersionResult)(nil)},
+	"waitforblock":              {(*btcjson.WaitForBlockResult)(nil)},
+	"waitforblockheight":        {(*btcjson.WaitForBlockResult)(nil)},
+	"waitfornewblock":           {(*btcjson.WaitForBlockResult)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -21,10 +21,12 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -226,6 +228,20 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *btcutil.Block) {
 	}
 }
 
+// NotifyIndexCatchUp passes the progress of an index that is being caught up
+// to the best chain to the notification manager for block notification
+// processing.
+func (m *wsNotificationManager) NotifyIndexCatchUp(progress *indexers.CatchUpProgress) {
+	// As NotifyIndexCatchUp will be called by the index manager and the
+	// RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationIndexCatchUp)(progress):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -246,6 +262,25 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyMempoolTxRemoved passes a transaction removed from the mempool along
+// with the reason it was removed to the notification manager for transaction
+// notification processing.
+func (m *wsNotificationManager) NotifyMempoolTxRemoved(tx *btcutil.Tx, reason mempool.RemovalReason) {
+	n := &notificationTxRemovedFromMempool{
+		tx:     tx,
+		reason: reason,
+	}
+
+	// As NotifyMempoolTxRemoved will be called by mempool and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -451,6 +486,11 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationTxRemovedFromMempool struct {
+	tx     *btcutil.Tx
+	reason mempool.RemovalReason
+}
+type notificationIndexCatchUp indexers.CatchUpProgress
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -539,6 +579,18 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationTxRemovedFromMempool:
+				if len(txNotifications) != 0 {
+					m.notifyTxRemoved(txNotifications, n.tx,
+						n.reason)
+				}
+
+			case *notificationIndexCatchUp:
+				if len(blockNotifications) != 0 {
+					m.notifyIndexCatchUp(blockNotifications,
+						(*indexers.CatchUpProgress)(n))
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -706,6 +758,25 @@ func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*ws
 	}
 }
 
+// notifyIndexCatchUp notifies websocket clients that have registered for block
+// updates of the progress of an index that is being caught up to the best
+// chain.
+func (*wsNotificationManager) notifyIndexCatchUp(clients map[chan struct{}]*wsClient,
+	progress *indexers.CatchUpProgress) {
+
+	ntfn := btcjson.NewIndexCatchUpNtfn(progress.Index, progress.Height,
+		progress.TargetHeight, progress.Percent)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal index catch up notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyBlockDisconnected notifies websocket clients that have registered for
 // block updates when a block is disconnected from the main chain (due to a
 // reorganize).
@@ -868,6 +939,32 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// txRemovalReasons maps the reasons transactions which will never be mined are
+// removed from the mempool for to the names reported in txremoved
+// notifications, which match the ones used by Bitcoin Core.
+var txRemovalReasons = map[mempool.RemovalReason]string{
+	mempool.RemovalReasonDoubleSpend: "conflict",
+	mempool.RemovalReasonConflict:    "replaced",
+}
+
+// notifyTxRemoved notifies websocket clients that have registered for new
+// mempool transactions that a transaction was removed from the mempool.
+func (*wsNotificationManager) notifyTxRemoved(clients map[chan struct{}]*wsClient,
+	tx *btcutil.Tx, reason mempool.RemovalReason) {
+
+	ntfn := btcjson.NewTxRemovedNtfn(tx.Hash().String(),
+		txRemovalReasons[reason])
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx removed notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -1445,6 +1542,20 @@ out:
 			}
 		}
 
+		// Check if the client is restricted to a whitelist of methods
+		// and error when this RPC is not part of it.
+		if !c.server.isMethodWhitelisted(c.isAdmin, request.Method) {
+			reply, err := createMarshalledReply(request.ID, nil,
+				ErrRPCNotWhitelisted)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal parse failure "+
+					"reply: %v", err)
+				continue
+			}
+			c.SendMessage(reply, nil)
+			continue
+		}
+
 		// Asynchronously handle the request.  A semaphore is used to
 		// limit the number of concurrent requests currently being
 		// serviced.  If the semaphore can not be acquired, simply wait
@@ -6,6 +6,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
@@ -14,6 +15,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -25,6 +28,7 @@ import (
 	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/cfclient"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/connmgr"
@@ -36,6 +40,7 @@ import (
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcd/zmqpub"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcutil/bloom"
 )
@@ -57,6 +62,62 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// feelerInterval is the amount of time to wait in between feeler
+	// connections, which test whether an address from the new table of
+	// the address manager is reachable and then immediately disconnect.
+	feelerInterval = time.Minute * 2
+
+	// natLeaseDuration is the lifetime of the port mappings requested from
+	// the gateway of the NAT the server is behind.
+	natLeaseDuration = time.Minute * 20
+
+	// natRenewInterval is the amount of time to wait in between renewals
+	// of the port mapping on the gateway of the NAT the server is behind.
+	// It is shorter than the lease so the mapping never lapses.
+	natRenewInterval = time.Minute * 15
+
+	// maxAddrRatePerSecond is the number of addresses per second a peer
+	// is allowed to send to be processed on average.  Addresses beyond
+	// the rate are dropped.
+	maxAddrRatePerSecond = 0.1
+
+	// maxAddrTokens is the maximum number of addresses a peer can save up
+	// to send at once by not sending any.  Asking a peer for addresses
+	// allows it to send an additional full addr message.
+	maxAddrTokens = wire.MaxAddrPerMsg
+
+	// maxRelayAddrsPerMsg is the maximum number of addresses an addr
+	// message can contain for them to be relayed to other peers.  Larger
+	// messages are usually answers to getaddr requests.
+	maxRelayAddrsPerMsg = 10
+
+	// maxRelayAddrAge is the maximum age of the timestamp of an address
+	// to be relayed to other peers.
+	maxRelayAddrAge = time.Minute * 10
+
+	// addrRelayRotation is the amount of time the peers an address is
+	// relayed to stay the same.  Relaying the same address to the same
+	// peers prevents it from being spread further by sending it again.
+	addrRelayRotation = time.Hour * 24
+
+	// cfClientFetchInterval is the amount of time to wait in between
+	// fetching the committed filters of the blocks which were connected to
+	// the main chain from peers when they are not built from the blocks.
+	cfClientFetchInterval = time.Second * 30
+
+	// mempoolFileName is the name of the file in the data directory the
+	// transactions in the memory pool are saved to.
+	mempoolFileName = "mempool.dat"
+
+	// mempoolSaveInterval is the amount of time to wait in between saving
+	// the transactions in the memory pool to disk.
+	mempoolSaveInterval = time.Minute * 15
+
+	// shutdownDrainTimeout is the maximum amount of time to wait on
+	// shutdown for the messages queued to peers to be sent before they are
+	// disconnected.
+	shutdownDrainTimeout = time.Second * 5
 )
 
 var (
@@ -138,6 +199,13 @@ type relayMsg struct {
 	data    interface{}
 }
 
+// relayAddrsMsg packages addresses received from a peer to be relayed to a
+// few other peers.
+type relayAddrsMsg struct {
+	from      *serverPeer
+	addresses []*wire.NetAddress
+}
+
 // updatePeerHeightsMsg is a message sent from the blockmanager to the server
 // after a new block has been accepted. The purpose of the message is to update
 // the heights of peers that were known to announce the block before we
@@ -205,6 +273,10 @@ type server struct {
 	shutdownSched int32
 	startupTime   int64
 
+	// numBlockRelayOnly is the number of automatic outbound peers that
+	// only relay blocks.
+	numBlockRelayOnly int32
+
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
 	connManager          *connmgr.ConnManager
@@ -221,6 +293,7 @@ type server struct {
 	banPeers             chan *serverPeer
 	query                chan interface{}
 	relayInv             chan relayMsg
+	relayAddrs           chan relayAddrsMsg
 	broadcast            chan broadcastMsg
 	peerHeightsUpdate    chan updatePeerHeightsMsg
 	wg                   sync.WaitGroup
@@ -230,18 +303,38 @@ type server struct {
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
 
+	// addrRelayKey is the secret used to select the peers addresses are
+	// relayed to, so they can't be predicted by other peers.
+	addrRelayKey [32]byte
+
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex        *indexers.TxIndex
+	addrIndex      *indexers.AddrIndex
+	cfIndex        *indexers.CfIndex
+	cfClient       *cfclient.Client
+	spentIndex     *indexers.SpentIndex
+	coinStatsIndex *indexers.CoinStatsIndex
+	indexManager   *indexers.Manager
+
+	// pendingCatchUp holds the most recent catch up progress of each index
+	// reported before the RPC server was started.  The indexes are caught
+	// up while the server is being created, so the progress is delivered
+	// to the RPC server once it starts.  catchUpDelivered is set after.
+	catchUpMtx       sync.Mutex
+	pendingCatchUp   []*indexers.CatchUpProgress
+	catchUpDelivered bool
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
 
+	// zmqPublisher publishes notifications about blocks and transactions
+	// over ZeroMQ.  It is nil when no ZeroMQ endpoints are configured.
+	zmqPublisher *zmqpub.Publisher
+
 	// cfCheckptCaches stores a cached slice of filter headers for cfcheckpt
 	// messages for each filter type.
 	cfCheckptCaches    map[wire.FilterType][]cfHeaderKV
@@ -256,6 +349,49 @@ type server struct {
 	agentWhitelist []string
 }
 
+// connectionType identifies the role of the connection to a peer.
+type connectionType int
+
+const (
+	// connTypeInbound indicates the connection was initiated by the
+	// remote peer.
+	connTypeInbound connectionType = iota
+
+	// connTypeOutboundFullRelay indicates an automatic outbound connection
+	// which relays blocks, transactions, and addresses.
+	connTypeOutboundFullRelay
+
+	// connTypeBlockRelayOnly indicates an automatic outbound connection
+	// which only relays blocks.
+	connTypeBlockRelayOnly
+
+	// connTypeManual indicates an outbound connection requested by the
+	// user via the --connect or --addpeer options or the RPC server.
+	connTypeManual
+
+	// connTypeFeeler indicates a short-lived outbound connection made to
+	// test whether an address is reachable.
+	connTypeFeeler
+)
+
+// connectionTypeStrings is a map of connection types back to the names
+// reported by the getpeerinfo RPC.
+var connectionTypeStrings = map[connectionType]string{
+	connTypeInbound:           "inbound",
+	connTypeOutboundFullRelay: "outbound-full-relay",
+	connTypeBlockRelayOnly:    "block-relay-only",
+	connTypeManual:            "manual",
+	connTypeFeeler:            "feeler",
+}
+
+// String returns the connectionType as a human-readable name.
+func (t connectionType) String() string {
+	if s := connectionTypeStrings[t]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("unknown connection type (%d)", int(t))
+}
+
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
@@ -267,6 +403,8 @@ type serverPeer struct {
 	connReq        *connmgr.ConnReq
 	server         *server
 	persistent     bool
+	connType       connectionType
+	blockRelayOnly bool
 	continueHash   *chainhash.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
@@ -277,22 +415,39 @@ type serverPeer struct {
 	knownAddresses map[string]struct{}
 	banScore       connmgr.DynamicBanScore
 	quit           chan struct{}
+
+	// filterAdds is the number of filteradd messages received from the
+	// peer since filterAddsStart.  They are only accessed by the handler
+	// of filteradd messages, so they are not protected by a mutex.
+	filterAdds      int
+	filterAddsStart time.Time
+
+	// addrTokens is the number of addresses the peer may send to be
+	// processed at the time addrTokensUpdated.  It increases over time
+	// by maxAddrRatePerSecond up to maxAddrTokens.
+	addrTokensMtx     sync.Mutex
+	addrTokens        float64
+	addrTokensUpdated time.Time
+
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
 }
 
-// newServerPeer returns a new serverPeer instance. The peer needs to be set by
-// the caller.
-func newServerPeer(s *server, isPersistent bool) *serverPeer {
+// newServerPeer returns a new serverPeer instance for a connection of the
+// passed type. The peer needs to be set by the caller.
+func newServerPeer(s *server, isPersistent bool, connType connectionType) *serverPeer {
 	return &serverPeer{
 		server:         s,
 		persistent:     isPersistent,
+		connType:       connType,
+		blockRelayOnly: connType == connTypeBlockRelayOnly,
 		filter:         bloom.LoadFilter(nil),
 		knownAddresses: make(map[string]struct{}),
 		quit:           make(chan struct{}),
 		txProcessed:    make(chan struct{}, 1),
 		blockProcessed: make(chan struct{}, 1),
+		addrTokens:     1,
 	}
 }
 
@@ -321,6 +476,41 @@ func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
 	return exists
 }
 
+// addAddrTokens allows the peer to send the passed number of additional
+// addresses to be processed, such as when asking it for addresses.
+// It is safe for concurrent access.
+func (sp *serverPeer) addAddrTokens(n int) {
+	sp.addrTokensMtx.Lock()
+	sp.addrTokens += float64(n)
+	sp.addrTokensMtx.Unlock()
+}
+
+// allowAddrs returns how many of the passed number of addresses received from
+// the peer at the passed time are within its rate limit and may be processed.
+// Whitelisted peers are not limited.
+// It is safe for concurrent access.
+func (sp *serverPeer) allowAddrs(n int, now time.Time) int {
+	if sp.isWhitelisted {
+		return n
+	}
+
+	sp.addrTokensMtx.Lock()
+	defer sp.addrTokensMtx.Unlock()
+
+	if sp.addrTokens < maxAddrTokens && !sp.addrTokensUpdated.IsZero() {
+		elapsed := now.Sub(sp.addrTokensUpdated).Seconds()
+		if elapsed > 0 {
+			sp.addrTokens = math.Min(sp.addrTokens+
+				elapsed*maxAddrRatePerSecond, maxAddrTokens)
+		}
+	}
+	sp.addrTokensUpdated = now
+
+	allowed := int(math.Min(float64(n), sp.addrTokens))
+	sp.addrTokens -= float64(allowed)
+	return allowed
+}
+
 // setDisableRelayTx toggles relaying of transactions for the given peer.
 // It is safe for concurrent access.
 func (sp *serverPeer) setDisableRelayTx(disable bool) {
@@ -343,6 +533,11 @@ func (sp *serverPeer) relayTxDisabled() bool {
 // pushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
+	// Addresses are never relayed to block-relay-only peers.
+	if sp.blockRelayOnly {
+		return
+	}
+
 	// Filter addresses already known to the peer.
 	addrs := make([]*wire.NetAddress, 0, len(addresses))
 	for _, addr := range addresses {
@@ -465,6 +660,13 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 		}
 	}
 
+	// Inbound peers report the address they connected to, which is an
+	// address the local node is reachable at.  Account for it as a
+	// candidate local address to advertise to peers.
+	if !cfg.SimNet && !cfg.DisableListen && isInbound {
+		sp.server.seenLocalAddress(&msg.AddrYou, sp.NA())
+	}
+
 	// Add the remote peer time as a sample for creating an offset against
 	// the local clock to keep the network time in sync.
 	sp.server.timeSource.AddTimeSample(sp.Addr(), msg.Timestamp)
@@ -476,6 +678,20 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 	return nil
 }
 
+// seenLocalAddress records the passed address the inbound peer with the address
+// srcAddr reported it connected to.  See SeenLocalAddress of the address
+// manager for how the reports of peers affect the local addresses.
+func (s *server) seenLocalAddress(addr, srcAddr *wire.NetAddress) {
+	if srcAddr == nil {
+		return
+	}
+	na := wire.NewNetAddressIPPort(addr.IP, addr.Port, s.services)
+	if s.addrManager.SeenLocalAddress(na, srcAddr) {
+		srvrLog.Infof("Discovered local address %s",
+			addrmgr.NetAddressKey(na))
+	}
+}
+
 // OnVerAck is invoked when a peer receives a verack bitcoin message and is used
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
@@ -542,6 +758,11 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 			msg.TxHash(), sp)
 		return
 	}
+	if sp.blockRelayOnly {
+		peerLog.Tracef("Ignoring tx %v from block-relay-only peer %v",
+			msg.TxHash(), sp)
+		return
+	}
 
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a btcutil.Tx which provides some convenience
@@ -590,7 +811,7 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.blockRelayOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -601,7 +822,7 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	for _, invVect := range msg.InvList {
 		if invVect.Type == wire.InvTypeTx {
 			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
-				"blocksonly enabled", invVect.Hash, sp)
+				"only relaying blocks", invVect.Hash, sp)
 			if sp.ProtocolVersion() >= wire.BIP0037Version {
 				peerLog.Infof("Peer %v is announcing "+
 					"transactions -- disconnecting", sp)
@@ -1102,6 +1323,33 @@ func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *wire.MsgGetCFCheckpt) {
 	sp.QueueMessage(checkptMsg, nil)
 }
 
+// OnCFilter is invoked when a peer receives a cfilter bitcoin message.  It
+// is delivered to the committed filter client when filters are fetched from
+// peers.
+func (sp *serverPeer) OnCFilter(p *peer.Peer, msg *wire.MsgCFilter) {
+	if sp.server.cfClient != nil {
+		sp.server.cfClient.OnCFilter(p, msg)
+	}
+}
+
+// OnCFHeaders is invoked when a peer receives a cfheaders bitcoin message.  It
+// is delivered to the committed filter client when filters are fetched from
+// peers.
+func (sp *serverPeer) OnCFHeaders(p *peer.Peer, msg *wire.MsgCFHeaders) {
+	if sp.server.cfClient != nil {
+		sp.server.cfClient.OnCFHeaders(p, msg)
+	}
+}
+
+// OnCFCheckpt is invoked when a peer receives a cfcheckpt bitcoin message.  It
+// is delivered to the committed filter client when filters are fetched from
+// peers.
+func (sp *serverPeer) OnCFCheckpt(p *peer.Peer, msg *wire.MsgCFCheckpt) {
+	if sp.server.cfClient != nil {
+		sp.server.cfClient.OnCFCheckpt(p, msg)
+	}
+}
+
 // enforceNodeBloomFlag disconnects the peer if the server is not configured to
 // allow bloom filters.  Additionally, if the peer has negotiated to a protocol
 // version  that is high enough to observe the bloom filter service support bit,
@@ -1171,13 +1419,31 @@ func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *wire.MsgFilterAdd) {
 		return
 	}
 
+	// Limit the rate of filteradd messages since every one of them causes
+	// the transactions relayed to the peer to change, which makes it
+	// possible to scan the entire chain at little cost to the peer.
+	now := time.Now()
+	if now.Sub(sp.filterAddsStart) >= time.Minute {
+		sp.filterAdds = 0
+		sp.filterAddsStart = now
+	}
+	sp.filterAdds++
+	if sp.filterAdds > cfg.MaxFilterAddRate {
+		peerLog.Debugf("%s sent more than %d filteradd requests per "+
+			"minute -- disconnecting", sp, cfg.MaxFilterAddRate)
+		sp.addBanScore(20, 0, msg.Command())
+		sp.Disconnect()
+		return
+	}
+
 	sp.filter.Add(msg.Data)
 }
 
 // OnFilterClear is invoked when a peer receives a filterclear bitcoin
-// message and is used by remote peers to clear an already loaded bloom filter.
-// The peer will be disconnected if a filter is not loaded when this message is
-// received  or the server is not configured to allow bloom filters.
+// message and is used by remote peers to clear a loaded bloom filter.  Per
+// BIP0037, all transactions are relayed to the peer again afterwards, even
+// when it asked not to relay them before loading a filter.  The peer will be
+// disconnected if the server is not configured to allow bloom filters.
 func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *wire.MsgFilterClear) {
 	// Disconnect and/or ban depending on the node bloom services flag and
 	// negotiated protocol version.
@@ -1185,21 +1451,15 @@ func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *wire.MsgFilterClear) {
 		return
 	}
 
-	if !sp.filter.IsLoaded() {
-		peerLog.Debugf("%s sent a filterclear request with no "+
-			"filter loaded -- disconnecting", sp)
-		sp.Disconnect()
-		return
-	}
-
 	sp.filter.Unload()
+	sp.setDisableRelayTx(false)
 }
 
 // OnFilterLoad is invoked when a peer receives a filterload bitcoin
 // message and it used to load a bloom filter that should be used for
 // delivering merkle blocks and associated transactions that match the filter.
 // The peer will be disconnected if the server is not configured to allow bloom
-// filters.
+// filters or the filter is larger than allowed.
 func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *wire.MsgFilterLoad) {
 	// Disconnect and/or ban depending on the node bloom services flag and
 	// negotiated protocol version.
@@ -1207,6 +1467,19 @@ func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *wire.MsgFilterLoad) {
 		return
 	}
 
+	// Matching large filters against every relayed transaction and
+	// requested block is expensive, so ensure the filter is not larger
+	// than allowed.
+	if len(msg.Filter) > cfg.MaxFilterLoadSize {
+		peerLog.Debugf("%s sent a filterload request with a filter of "+
+			"%d bytes which is larger than the max allowed %d "+
+			"bytes -- disconnecting", sp, len(msg.Filter),
+			cfg.MaxFilterLoadSize)
+		sp.addBanScore(20, 0, msg.Command())
+		sp.Disconnect()
+		return
+	}
+
 	sp.setDisableRelayTx(false)
 
 	sp.filter.Reload(msg)
@@ -1259,6 +1532,13 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Block-relay-only peers are not used for address relay.
+	if sp.blockRelayOnly {
+		peerLog.Tracef("Ignoring addresses from block-relay-only peer %v",
+			sp)
+		return
+	}
+
 	// Ignore old style addresses which don't include a timestamp.
 	if sp.ProtocolVersion() < wire.NetAddressTimeVersion {
 		return
@@ -1272,7 +1552,25 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
-	for _, na := range msg.AddrList {
+	// Drop the addresses beyond the rate limit of the peer so it can't
+	// flood the address manager.  The ban score of the peer is increased
+	// by the share of a full addr message which was dropped.
+	now := time.Now()
+	addrList := msg.AddrList[:sp.allowAddrs(len(msg.AddrList), now)]
+	if numDropped := len(msg.AddrList) - len(addrList); numDropped > 0 {
+		peerLog.Debugf("Dropping %d addresses from %v beyond the rate "+
+			"limit", numDropped, sp)
+		score := uint32(numDropped) * 50 / wire.MaxAddrPerMsg
+		if score > 0 && sp.addBanScore(0, score, msg.Command()) {
+			return
+		}
+	}
+
+	// Only a few recent addresses of small unsolicited messages are relayed
+	// to other peers, unless the peer is already known to have them.
+	mayRelay := len(msg.AddrList) <= maxRelayAddrsPerMsg
+	var relayAddrs []*wire.NetAddress
+	for _, na := range addrList {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -1281,21 +1579,41 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		// Set the timestamp to 5 days ago if it's more than 24 hours
 		// in the future so this address is one of the first to be
 		// removed when space is needed.
-		now := time.Now()
 		if na.Timestamp.After(now.Add(time.Minute * 10)) {
 			na.Timestamp = now.Add(-1 * time.Hour * 24 * 5)
 		}
 
+		if mayRelay && !sp.addressKnown(na) && addrmgr.IsRoutable(na) &&
+			na.Timestamp.After(now.Add(-maxRelayAddrAge)) {
+
+			relayAddrs = append(relayAddrs, na)
+		}
+
 		// Add address to known addresses for this peer.
 		sp.addKnownAddresses([]*wire.NetAddress{na})
 	}
+	if len(addrList) == 0 {
+		return
+	}
 
 	// Add addresses to server address manager.  The address manager handles
 	// the details of things such as preventing duplicate addresses, max
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrList, sp.NA())
+
+	// Don't block on relaying the addresses once the server is shutting
+	// down since the peer handler is no longer receiving them.
+	if len(relayAddrs) > 0 {
+		select {
+		case sp.server.relayAddrs <- relayAddrsMsg{
+			from:      sp,
+			addresses: relayAddrs,
+		}:
+		case <-sp.server.quit:
+		}
+	}
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1429,6 +1747,34 @@ func (s *server) TransactionConfirmed(tx *btcutil.Tx) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
+// txRemoved is invoked by the memory pool when a transaction is removed from
+// it.  Transactions that were replaced or double spent by a transaction in a
+// block will never be mined, so they are no longer rebroadcast and websocket
+// clients are notified about them.  The callers of explicit removals take care
+// of that themselves.  All removals are published over ZeroMQ when enabled.
+func (s *server) txRemoved(tx *btcutil.Tx, reason mempool.RemovalReason) {
+	if s.zmqPublisher != nil {
+		s.zmqPublisher.TxRemoved(tx, reason)
+	}
+
+	// Rebroadcasting is only necessary when the RPC server is active.
+	if s.rpcServer == nil || reason == mempool.RemovalReasonExplicit {
+		return
+	}
+
+	// The rebroadcast handler is running whenever the RPC server is, so
+	// only wait for it until the server is shutting down.
+	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+	select {
+	case s.modifyRebroadcastInv <- broadcastInventoryDel(iv):
+	case <-s.quit:
+	}
+
+	if atomic.LoadInt32(&s.rpcServer.started) != 0 {
+		s.rpcServer.ntfnMgr.NotifyMempoolTxRemoved(tx, reason)
+	}
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1524,6 +1870,25 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// filterBlock returns a merkleblock message for the passed block which proves
+// the inclusion of the transactions that match the passed bloom filter along
+// with those transactions in the order they appear in the block.  The filter
+// is updated with the outputs of the matched transactions according to its
+// update flags, so transactions spending them match as well.
+func filterBlock(blk *btcutil.Block, filter *bloom.Filter) (*wire.MsgMerkleBlock, []*wire.MsgTx) {
+	merkle, matchedTxIndices := bloom.NewMerkleBlock(blk, filter)
+
+	blkTransactions := blk.MsgBlock().Transactions
+	matchedTxns := make([]*wire.MsgTx, 0, len(matchedTxIndices))
+	for _, txIndex := range matchedTxIndices {
+		if txIndex < uint32(len(blkTransactions)) {
+			matchedTxns = append(matchedTxns,
+				blkTransactions[txIndex])
+		}
+	}
+	return merkle, matchedTxns
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1553,7 +1918,7 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 
 	// Generate a merkle block by filtering the requested block according
 	// to the filter for the peer.
-	merkle, matchedTxIndices := bloom.NewMerkleBlock(blk, sp.filter)
+	merkle, matchedTxns := filterBlock(blk, sp.filter)
 
 	// Once we have fetched data wait for any previous operation to finish.
 	if waitChan != nil {
@@ -1563,28 +1928,62 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 	// Send the merkleblock.  Only send the done channel with this message
 	// if no transactions will be sent afterwards.
 	var dc chan<- struct{}
-	if len(matchedTxIndices) == 0 {
+	if len(matchedTxns) == 0 {
 		dc = doneChan
 	}
 	sp.QueueMessage(merkle, dc)
 
 	// Finally, send any matched transactions.
-	blkTransactions := blk.MsgBlock().Transactions
-	for i, txIndex := range matchedTxIndices {
+	for i, tx := range matchedTxns {
 		// Only send the done channel on the final transaction.
 		var dc chan<- struct{}
-		if i == len(matchedTxIndices)-1 {
+		if i == len(matchedTxns)-1 {
 			dc = doneChan
 		}
-		if txIndex < uint32(len(blkTransactions)) {
-			sp.QueueMessageWithEncoding(blkTransactions[txIndex], dc,
-				encoding)
-		}
+		sp.QueueMessageWithEncoding(tx, dc, encoding)
 	}
 
 	return nil
 }
 
+// handleIndexCatchUp is invoked by the index manager with the progress of an
+// index that is being caught up to the best chain.  The progress is relayed to
+// the websocket clients of the RPC server when it is running.
+func (s *server) handleIndexCatchUp(progress *indexers.CatchUpProgress) {
+	s.catchUpMtx.Lock()
+	defer s.catchUpMtx.Unlock()
+
+	// The indexes are typically caught up while the chain is being loaded,
+	// which happens before the RPC server is created, so keep the latest
+	// progress of each index until it is delivered by the RPC server.
+	if !s.catchUpDelivered {
+		for i, pending := range s.pendingCatchUp {
+			if pending.Index == progress.Index {
+				s.pendingCatchUp[i] = progress
+				return
+			}
+		}
+		s.pendingCatchUp = append(s.pendingCatchUp, progress)
+		return
+	}
+	s.rpcServer.ntfnMgr.NotifyIndexCatchUp(progress)
+}
+
+// deliverIndexCatchUp relays the catch up progress of the indexes which was
+// reported before the RPC server was started to it and ensures any progress
+// that is reported afterwards is relayed directly.  It must only be called
+// once the RPC server has been started.
+func (s *server) deliverIndexCatchUp() {
+	s.catchUpMtx.Lock()
+	defer s.catchUpMtx.Unlock()
+
+	for _, progress := range s.pendingCatchUp {
+		s.rpcServer.ntfnMgr.NotifyIndexCatchUp(progress)
+	}
+	s.pendingCatchUp = nil
+	s.catchUpDelivered = true
+}
+
 // handleUpdatePeerHeight updates the heights of all peers who were known to
 // announce a block we recently accepted.
 func (s *server) handleUpdatePeerHeights(state *peerState, umsg updatePeerHeightsMsg) {
@@ -1707,9 +2106,12 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 		// Request known addresses if the server address manager needs
 		// more and the peer has a protocol version new enough to
-		// include a timestamp with addresses.
+		// include a timestamp with addresses.  Block-relay-only peers
+		// are never asked for addresses.
 		hasTimestamp := sp.ProtocolVersion() >= wire.NetAddressTimeVersion
-		if s.addrManager.NeedMoreAddresses() && hasTimestamp {
+		if s.addrManager.NeedMoreAddresses() && hasTimestamp &&
+			!sp.blockRelayOnly {
+			sp.addAddrTokens(wire.MaxAddrPerMsg)
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
@@ -1768,6 +2170,59 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	state.banned[host] = time.Now().Add(cfg.BanDuration)
 }
 
+// handleRelayAddrsMsg deals with relaying addresses received from a peer to a
+// few other peers.  Each address is relayed to two peers when it is reachable
+// and to one otherwise.  The peers are selected by a keyed hash of the address
+// which only changes every addrRelayRotation, so an address sent repeatedly is
+// relayed to the same peers which filter it as already known.  It is invoked
+// from the peerHandler goroutine.
+func (s *server) handleRelayAddrsMsg(state *peerState, msg relayAddrsMsg) {
+	epoch := time.Now().Unix() / int64(addrRelayRotation/time.Second)
+	targets := make(map[*serverPeer][]*wire.NetAddress)
+	for _, na := range msg.addresses {
+		numTargets := 1
+		if s.addrManager.IsReachable(na) {
+			numTargets = 2
+		}
+
+		type target struct {
+			sp   *serverPeer
+			hash uint64
+		}
+		best := make([]target, 0, numTargets+1)
+		key := addrmgr.NetAddressKey(na)
+		state.forAllPeers(func(sp *serverPeer) {
+			if sp == msg.from || sp.blockRelayOnly || !sp.Connected() {
+				return
+			}
+
+			var buf bytes.Buffer
+			buf.Write(s.addrRelayKey[:])
+			buf.WriteString(key)
+			binary.Write(&buf, binary.LittleEndian, epoch)
+			buf.WriteString(sp.Addr())
+			hash := binary.LittleEndian.Uint64(chainhash.HashB(buf.Bytes()))
+
+			i := sort.Search(len(best), func(i int) bool {
+				return best[i].hash < hash
+			})
+			best = append(best, target{})
+			copy(best[i+1:], best[i:])
+			best[i] = target{sp: sp, hash: hash}
+			if len(best) > numTargets {
+				best = best[:numTargets]
+			}
+		})
+		for _, t := range best {
+			targets[t.sp] = append(targets[t.sp], na)
+		}
+	}
+
+	for sp, addresses := range targets {
+		sp.pushAddrMsg(addresses)
+	}
+}
+
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
@@ -1798,8 +2253,9 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 
 		if msg.invVect.Type == wire.InvTypeTx {
 			// Don't relay the transaction to the peer when it has
-			// transaction relaying disabled.
-			if sp.relayTxDisabled() {
+			// transaction relaying disabled or the connection is
+			// only used to relay blocks.
+			if sp.relayTxDisabled() || sp.blockRelayOnly {
 				return
 			}
 
@@ -1865,10 +2321,6 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
-type getAddedNodesMsg struct {
-	reply chan []*serverPeer
-}
-
 type disconnectNodeMsg struct {
 	cmp   func(*serverPeer) bool
 	reply chan error
@@ -1936,6 +2388,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		go s.connManager.Connect(&connmgr.ConnReq{
 			Addr:      netAddr,
 			Permanent: msg.permanent,
+			Manual:    true,
 		})
 		msg.reply <- nil
 	case removeNodeMsg:
@@ -1957,14 +2410,6 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
-	// Request a list of the persistent (added) peers.
-	case getAddedNodesMsg:
-		// Respond with a slice of the relevant peers.
-		peers := make([]*serverPeer, 0, len(state.persistentPeers))
-		for _, sp := range state.persistentPeers {
-			peers = append(peers, sp)
-		}
-		msg.reply <- peers
 	case disconnectNodeMsg:
 		// Check inbound peers. We pass a nil callback since we don't
 		// require any additional actions on disconnect for inbound peers.
@@ -2038,6 +2483,9 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnGetCFilters:  sp.OnGetCFilters,
 			OnGetCFHeaders: sp.OnGetCFHeaders,
 			OnGetCFCheckpt: sp.OnGetCFCheckpt,
+			OnCFilter:      sp.OnCFilter,
+			OnCFHeaders:    sp.OnCFHeaders,
+			OnCFCheckpt:    sp.OnCFCheckpt,
 			OnFeeFilter:    sp.OnFeeFilter,
 			OnFilterAdd:    sp.OnFilterAdd,
 			OnFilterClear:  sp.OnFilterClear,
@@ -2062,7 +2510,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		UserAgentComments: cfg.UserAgentComments,
 		ChainParams:       sp.server.chainParams,
 		Services:          sp.server.services,
-		DisableRelayTx:    cfg.BlocksOnly,
+		DisableRelayTx:    cfg.BlocksOnly || sp.blockRelayOnly,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 		TrickleInterval:   cfg.TrickleInterval,
 	}
@@ -2073,7 +2521,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
-	sp := newServerPeer(s, false)
+	sp := newServerPeer(s, false, connTypeInbound)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
@@ -2086,10 +2534,13 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // request instance and the connection itself, and finally notifies the address
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
-	sp := newServerPeer(s, c.Permanent)
+	sp := newServerPeer(s, c.Permanent, s.outboundConnType(c))
 	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
+		if sp.blockRelayOnly {
+			s.releaseBlockRelayOnly()
+		}
 		if c.Permanent {
 			s.connManager.Disconnect(c.ID())
 		} else {
@@ -2101,14 +2552,126 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp.Peer = p
 	sp.connReq = c
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	if sp.blockRelayOnly {
+		srvrLog.Debugf("Using %s as a block-relay-only peer", c.Addr)
+	}
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
 
+// feelerAddress returns an address from the new table of the address manager
+// to make a feeler connection to and marks the attempt to connect to it.  It is
+// moved to the tried table by feelerConnected once the connection succeeds.
+func (s *server) feelerAddress() (net.Addr, error) {
+	ka := s.addrManager.GetFeelerAddress()
+	if ka == nil {
+		return nil, errors.New("no feeler address")
+	}
+	s.addrManager.Attempt(ka.NetAddress())
+
+	addrString := addrmgr.NetAddressKey(ka.NetAddress())
+	return addrStringToNetAddr(addrString)
+}
+
+// feelerConnected is invoked by the connection manager when a feeler connection
+// is established.  It performs the version handshake with the remote peer,
+// marks the address as good in the address manager when it succeeds, and then
+// disconnects.  The peer is never added to the server.
+func (s *server) feelerConnected(addr net.Addr, conn net.Conn) {
+	sp := newServerPeer(s, false, connTypeFeeler)
+	verAck := make(chan struct{})
+	peerCfg := newPeerConfig(sp)
+	peerCfg.Listeners = peer.MessageListeners{
+		OnVerAck: func(*peer.Peer, *wire.MsgVerAck) {
+			close(verAck)
+		},
+	}
+	p, err := peer.NewOutboundPeer(peerCfg, addr.String())
+	if err != nil {
+		srvrLog.Debugf("Cannot create feeler peer %s: %v", addr, err)
+		conn.Close()
+		return
+	}
+	sp.Peer = p
+	sp.AssociateConnection(conn)
+
+	// The peer disconnects by itself when the handshake fails or times
+	// out.
+	disconnected := make(chan struct{})
+	go func() {
+		sp.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-verAck:
+		srvrLog.Debugf("Feeler connection to %s succeeded", sp)
+		s.addrManager.Good(sp.NA())
+	case <-disconnected:
+		srvrLog.Debugf("Feeler connection to %s failed", sp)
+	}
+	sp.Disconnect()
+	<-disconnected
+}
+
+// targetOutbound returns the number of automatic outbound connections for the
+// connection manager to maintain.  The block-relay-only connections are made in
+// addition to the targeted outbound connections and all of them are limited by
+// the maximum number of peers.
+func targetOutbound() uint32 {
+	target := cfg.TargetOutbound + cfg.BlockRelayOnlyPeers
+	if cfg.MaxPeers < target {
+		target = cfg.MaxPeers
+	}
+	return uint32(target)
+}
+
+// outboundConnType returns the type of the outbound connection for the passed
+// connection request.  Automatic connections reserve one of the configured
+// block-relay-only slots when one is available, so the returned type must be
+// used for a peer which releases the slot once it disconnects.
+func (s *server) outboundConnType(c *connmgr.ConnReq) connectionType {
+	switch {
+	case c.Manual:
+		return connTypeManual
+	case s.reserveBlockRelayOnly():
+		return connTypeBlockRelayOnly
+	default:
+		return connTypeOutboundFullRelay
+	}
+}
+
+// reserveBlockRelayOnly attempts to reserve one of the automatic outbound
+// connection slots configured to only relay blocks.  It returns whether or not
+// a slot was reserved.
+//
+// This function is safe for concurrent access.
+func (s *server) reserveBlockRelayOnly() bool {
+	for {
+		n := atomic.LoadInt32(&s.numBlockRelayOnly)
+		if n >= int32(cfg.BlockRelayOnlyPeers) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.numBlockRelayOnly, n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseBlockRelayOnly releases a block-relay-only connection slot previously
+// reserved with reserveBlockRelayOnly.
+//
+// This function is safe for concurrent access.
+func (s *server) releaseBlockRelayOnly() {
+	atomic.AddInt32(&s.numBlockRelayOnly, -1)
+}
+
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
+	if sp.blockRelayOnly {
+		s.releaseBlockRelayOnly()
+	}
 	s.donePeers <- sp
 
 	// Only tell sync manager we are gone if we ever told it we existed.
@@ -2185,6 +2748,10 @@ out:
 		case invMsg := <-s.relayInv:
 			s.handleRelayInvMsg(state, invMsg)
 
+		// Addresses to be relayed to a few other peers.
+		case addrsMsg := <-s.relayAddrs:
+			s.handleRelayAddrsMsg(state, addrsMsg)
+
 		// Message to broadcast to all connected peers except those
 		// which are excluded by the message.
 		case bmsg := <-s.broadcast:
@@ -2194,19 +2761,39 @@ out:
 			s.handleQuery(state, qmsg)
 
 		case <-s.quit:
-			// Disconnect all peers on server shutdown.
-			state.forAllPeers(func(sp *serverPeer) {
-				srvrLog.Tracef("Shutdown peer %s", sp)
-				sp.Disconnect()
-			})
 			break out
 		}
 	}
 
+	// Stop making and accepting connections, then wait for the sync
+	// manager to finish validating the block in flight, if any.  The peer
+	// messages are still handled meanwhile since connecting a block
+	// updates the heights of the peers and relays it.
 	s.connManager.Stop()
-	s.syncManager.Stop()
+	syncDone := make(chan struct{})
+	go func() {
+		s.syncManager.Stop()
+		close(syncDone)
+	}()
+	s.drainPeerMsgs(state, syncDone)
 	s.addrManager.Stop()
 
+	// Write the utxo cache to the database now that no more blocks will be
+	// processed so the utxo set doesn't have to be reconstructed on the
+	// next start.  The database itself is flushed when it is closed after
+	// the server has shut down.
+	if err := s.chain.FlushUtxoCache(); err != nil {
+		srvrLog.Errorf("Unable to flush the utxo cache: %v", err)
+	}
+
+	// Give the peers a chance to receive the messages queued to them
+	// before disconnecting them.
+	s.drainPeerMsgs(state, flushPeers(state, shutdownDrainTimeout))
+	state.forAllPeers(func(sp *serverPeer) {
+		srvrLog.Tracef("Shutdown peer %s", sp)
+		sp.Disconnect()
+	})
+
 	// Drain channels before exiting so nothing is left waiting around
 	// to send.
 cleanup:
@@ -2216,6 +2803,7 @@ cleanup:
 		case <-s.donePeers:
 		case <-s.peerHeightsUpdate:
 		case <-s.relayInv:
+		case <-s.relayAddrs:
 		case <-s.broadcast:
 		case <-s.query:
 		default:
@@ -2299,6 +2887,237 @@ func (s *server) UpdatePeerHeights(latestBlkHash *chainhash.Hash, latestHeight i
 	}
 }
 
+// drainPeerMsgs handles the messages sent to the peer handler by the peers and
+// the sync manager while the server is shutting down until the passed channel
+// is closed.  New peers are disconnected and addresses are no longer relayed.
+func (s *server) drainPeerMsgs(state *peerState, done <-chan struct{}) {
+	for {
+		select {
+		case p := <-s.newPeers:
+			srvrLog.Infof("New peer %s ignored - server is shutting "+
+				"down", p)
+			p.Disconnect()
+
+		case p := <-s.donePeers:
+			s.handleDonePeerMsg(state, p)
+
+		case umsg := <-s.peerHeightsUpdate:
+			s.handleUpdatePeerHeights(state, umsg)
+
+		case p := <-s.banPeers:
+			s.handleBanPeerMsg(state, p)
+
+		case invMsg := <-s.relayInv:
+			s.handleRelayInvMsg(state, invMsg)
+
+		case <-s.relayAddrs:
+
+		case bmsg := <-s.broadcast:
+			s.handleBroadcastMsg(state, &bmsg)
+
+		case qmsg := <-s.query:
+			s.handleQuery(state, qmsg)
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// flushPeers queues a ping to all connected peers and returns a channel which
+// is closed once the pings have been sent, and with them all of the messages
+// queued to the peers before, or the peers have disconnected.  The channel is
+// closed after the passed timeout otherwise.
+func flushPeers(state *peerState, timeout time.Duration) <-chan struct{} {
+	var peers []*serverPeer
+	state.forAllPeers(func(sp *serverPeer) {
+		peers = append(peers, sp)
+	})
+
+	sent := make(chan struct{}, len(peers))
+	for _, sp := range peers {
+		nonce, err := wire.RandomUint64()
+		if err != nil {
+			sent <- struct{}{}
+			continue
+		}
+		sp.QueueMessage(wire.NewMsgPing(nonce), sent)
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+
+		expired := time.After(timeout)
+		for range peers {
+			select {
+			case <-sent:
+			case <-expired:
+				return
+			}
+		}
+	}()
+	return flushed
+}
+
+// cfClientHandler periodically fetches the committed filters of the main chain
+// blocks which are missing from the committed filter index from the peers
+// which serve them once the chain is current.  Peers which serve invalid
+// filters are disconnected.  It must be run as a goroutine.
+func (s *server) cfClientHandler() {
+	ticker := time.NewTicker(cfClientFetchInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			if !s.syncManager.IsCurrent() {
+				continue
+			}
+
+			replyChan := make(chan []*serverPeer)
+			select {
+			case s.query <- getPeersMsg{reply: replyChan}:
+			case <-s.quit:
+				break out
+			}
+			for _, sp := range <-replyChan {
+				if sp.Services()&wire.SFNodeCF != wire.SFNodeCF {
+					continue
+				}
+
+				err := s.cfClient.FetchMissingFilters(sp.Peer)
+				if err == nil {
+					break
+				}
+				if err == cfclient.ErrStopped {
+					break out
+				}
+				if _, ok := err.(cfclient.VerifyError); ok {
+					peerLog.Warnf("Disconnecting %v: %v", sp, err)
+					sp.addBanScore(100, 0, "cfilter")
+					sp.Disconnect()
+					continue
+				}
+				peerLog.Debugf("Unable to fetch committed filters "+
+					"from %v: %v", sp, err)
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+}
+
+// mempoolFileMtx serializes access to the memory pool file in the data
+// directory since it is saved both periodically and on demand.
+var mempoolFileMtx sync.Mutex
+
+// mempoolFilePath returns the path of the memory pool file in the data
+// directory.
+func mempoolFilePath() string {
+	return filepath.Join(cfg.DataDir, mempoolFileName)
+}
+
+// loadMempoolFile restores the transactions saved to the memory pool file at
+// the passed path which are still valid into the provided memory pool and
+// returns the number of restored transactions.
+func loadMempoolFile(txMemPool *mempool.TxPool, path string) (int, error) {
+	mempoolFileMtx.Lock()
+	defer mempoolFileMtx.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return txMemPool.Load(bufio.NewReader(f))
+}
+
+// saveMempoolFile saves the transactions in the provided memory pool to the
+// memory pool file at the passed path.  The transactions are written to a
+// temporary file first so an interrupted save does not clobber the previous
+// one.
+func saveMempoolFile(txMemPool *mempool.TxPool, path string) error {
+	mempoolFileMtx.Lock()
+	defer mempoolFileMtx.Unlock()
+
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = txMemPool.Save(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// loadMempool restores the transactions saved to the memory pool file in the
+// data directory, if any, which are still valid into the memory pool.
+func (s *server) loadMempool() {
+	path := mempoolFilePath()
+	restored, err := loadMempoolFile(s.txMemPool, path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		txmpLog.Errorf("Unable to load memory pool from %s: %v", path,
+			err)
+		return
+	}
+	txmpLog.Infof("Restored %d %s from %s", restored,
+		pickNoun(uint64(restored), "transaction", "transactions"), path)
+}
+
+// saveMempool saves the transactions in the memory pool to the memory pool
+// file in the data directory.
+func (s *server) saveMempool() {
+	path := mempoolFilePath()
+	if err := saveMempoolFile(s.txMemPool, path); err != nil {
+		txmpLog.Errorf("Unable to save memory pool to %s: %v", path, err)
+		return
+	}
+	txmpLog.Debugf("Saved memory pool to %s", path)
+}
+
+// mempoolPersistHandler saves the memory pool to disk periodically and one
+// last time when the server is shutting down.  It must be run as a goroutine.
+func (s *server) mempoolPersistHandler() {
+	ticker := time.NewTicker(mempoolSaveInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.saveMempool()
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.saveMempool()
+	s.wg.Done()
+}
+
 // rebroadcastHandler keeps track of user submitted inventories that we have
 // sent out but have not yet made it into a block. We periodically rebroadcast
 // them in case our peers restarted or otherwise lost track of them.
@@ -2367,6 +3186,20 @@ func (s *server) Start() {
 	// Server startup time. Used for the uptime command for uptime calculation.
 	s.startupTime = time.Now().Unix()
 
+	// Start the rebroadcastHandler, which ensures user tx received by the
+	// RPC server are rebroadcast until being included in a block, before
+	// the memory pool is restored since it may remove transactions.
+	if !cfg.DisableRPC {
+		s.wg.Add(1)
+		go s.rebroadcastHandler()
+	}
+
+	// Restore the memory pool saved on shutdown before peers and RPC
+	// clients are served so it is not saved again before it is restored.
+	if !cfg.NoPersistMempool {
+		s.loadMempool()
+	}
+
 	// Start the peer handler which in turn starts the address and block
 	// managers.
 	s.wg.Add(1)
@@ -2374,17 +3207,30 @@ func (s *server) Start() {
 
 	if s.nat != nil {
 		s.wg.Add(1)
-		go s.upnpUpdateThread()
+		go s.natUpdateThread()
 	}
 
 	if !cfg.DisableRPC {
+		s.rpcServer.Start()
+		s.deliverIndexCatchUp()
+	}
+
+	// Keep saving the memory pool to disk.
+	if !cfg.NoPersistMempool {
 		s.wg.Add(1)
+		go s.mempoolPersistHandler()
+	}
 
-		// Start the rebroadcastHandler, which ensures user tx received by
-		// the RPC server are rebroadcast until being included in a block.
-		go s.rebroadcastHandler()
+	// Start fetching the committed filters from peers when they are not
+	// built from the blocks.
+	if s.cfClient != nil {
+		s.wg.Add(1)
+		go s.cfClientHandler()
+	}
 
-		s.rpcServer.Start()
+	// Start publishing notifications over ZeroMQ if enabled.
+	if s.zmqPublisher != nil {
+		s.zmqPublisher.Start()
 	}
 
 	// Start the CPU miner if generation is enabled.
@@ -2407,11 +3253,21 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Abandon fetching committed filters from peers if needed.
+	if s.cfClient != nil {
+		s.cfClient.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
 	}
 
+	// Disconnect the ZeroMQ subscribers if needed.
+	if s.zmqPublisher != nil {
+		s.zmqPublisher.Stop()
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -2514,44 +3370,67 @@ func parseListeners(addrs []string) ([]net.Addr, error) {
 	return netAddrs, nil
 }
 
-func (s *server) upnpUpdateThread() {
+// natName returns the name of the NAT traversal protocol of the passed NAT for
+// use in log messages.
+func natName(nat NAT) string {
+	if _, ok := nat.(*natpmpNAT); ok {
+		return "NAT-PMP"
+	}
+	return "UPnP"
+}
+
+// natUpdateThread maps the listen port on the gateway of the NAT the server is
+// behind and renews the lease of the mapping until the server shuts down.  The
+// external address of the gateway is registered as a local address so it is
+// advertised to peers.
+//
+// It must be run as a goroutine.
+func (s *server) natUpdateThread() {
 	// Go off immediately to prevent code duplication, thereafter we renew
-	// lease every 15 minutes.
+	// lease every natRenewInterval.
 	timer := time.NewTimer(0 * time.Second)
 	lport, _ := strconv.ParseInt(activeNetParams.DefaultPort, 10, 16)
-	first := true
+	name := natName(s.nat)
+	var bound *wire.NetAddress
 out:
 	for {
 		select {
 		case <-timer.C:
+			timer.Reset(natRenewInterval)
+
 			// TODO: pick external port  more cleverly
 			// TODO: know which ports we are listening to on an external net.
 			// TODO: if specific listen port doesn't work then ask for wildcard
 			// listen port?
 			// XXX this assumes timeout is in seconds.
 			listenPort, err := s.nat.AddPortMapping("tcp", int(lport), int(lport),
-				"btcd listen port", 20*60)
+				"btcd listen port", int(natLeaseDuration/time.Second))
 			if err != nil {
-				srvrLog.Warnf("can't add UPnP port mapping: %v", err)
+				srvrLog.Warnf("can't add %s port mapping: %v", name, err)
+				continue out
 			}
-			if first && err == nil {
-				// TODO: look this up periodically to see if upnp domain changed
-				// and so did ip.
-				externalip, err := s.nat.GetExternalAddress()
-				if err != nil {
-					srvrLog.Warnf("UPnP can't get external address: %v", err)
-					continue out
-				}
-				na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
-					s.services)
-				err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
-				if err != nil {
-					// XXX DeletePortMapping?
-				}
-				srvrLog.Warnf("Successfully bound via UPnP to %s", addrmgr.NetAddressKey(na))
-				first = false
+
+			// Look the external address up with every renewal since the
+			// gateway may have been assigned another one.
+			externalip, err := s.nat.GetExternalAddress()
+			if err != nil {
+				srvrLog.Warnf("%s can't get external address: %v", name, err)
+				continue out
+			}
+			na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
+				s.services)
+			if bound != nil && bound.IP.Equal(na.IP) && bound.Port == na.Port {
+				continue out
+			}
+			err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
+			if err != nil {
+				srvrLog.Warnf("Not advertising %s address %s: %v", name,
+					addrmgr.NetAddressKey(na), err)
+				continue out
 			}
-			timer.Reset(time.Minute * 15)
+			srvrLog.Infof("Successfully bound via %s to %s", name,
+				addrmgr.NetAddressKey(na))
+			bound = na
 		case <-s.quit:
 			break out
 		}
@@ -2560,9 +3439,9 @@ out:
 	timer.Stop()
 
 	if err := s.nat.DeletePortMapping("tcp", int(lport), int(lport)); err != nil {
-		srvrLog.Warnf("unable to remove UPnP port mapping: %v", err)
+		srvrLog.Warnf("unable to remove %s port mapping: %v", name, err)
 	} else {
-		srvrLog.Debugf("successfully disestablished UPnP port mapping")
+		srvrLog.Debugf("successfully disestablished %s port mapping", name)
 	}
 
 	s.wg.Done()
@@ -2614,25 +3493,80 @@ func setupRPCListeners() ([]net.Listener, error) {
 		listeners = append(listeners, listener)
 	}
 
+	// Also listen on a Unix domain socket if one was configured.
+	if cfg.RPCUnixSocket != "" {
+		listener, err := listenRPCUnixSocket(cfg.RPCUnixSocket)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", cfg.RPCUnixSocket,
+				err)
+		} else {
+			listeners = append(listeners, listener)
+		}
+	}
+
 	return listeners, nil
 }
 
-// newServer returns a new btcd server configured to listen on addr for the
-// bitcoin network type specified by chainParams.  Use start to begin accepting
-// connections from peers.
-func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
-	db database.DB, chainParams *chaincfg.Params,
-	interrupt <-chan struct{}) (*server, error) {
+// setUmask sets the file mode creation mask of the process and returns the
+// previous mask.  It does nothing by default and is replaced on platforms which
+// support a file mode creation mask.
+var setUmask = func(mask int) int { return 0 }
+
+// listenRPCUnixSocket returns a listener on a Unix domain socket at the
+// provided path.  Any stale socket file left behind by a previous run is
+// removed first, and the permissions of the socket are restricted to the
+// owner since TLS is not used for connections over the socket.
+func listenRPCUnixSocket(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket",
+				path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
 
+	// Create the socket with a mask that only leaves access for the owner
+	// so it is never exposed to others before the permissions are set
+	// below.
+	oldMask := setUmask(0077)
+	listener, err := net.Listen("unix", path)
+	setUmask(oldMask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// configuredServices returns the services the server advertises to its peers
+// according to the configuration.
+func configuredServices() wire.ServiceFlag {
 	services := defaultServices
 	if cfg.NoPeerBloomFilters {
 		services &^= wire.SFNodeBloom
 	}
-	if cfg.NoCFilters {
+	if cfg.NoCFilters || cfg.CFClient {
 		services &^= wire.SFNodeCF
 	}
+	return services
+}
+
+// newServer returns a new btcd server configured to listen on addr for the
+// bitcoin network type specified by chainParams.  Use start to begin accepting
+// connections from peers.
+func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
+	db database.DB, chainParams *chaincfg.Params,
+	interrupt <-chan struct{}) (*server, error) {
+
+	services := configuredServices()
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	amgr.SetReachableNetworks(cfg.onlyNets...)
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2662,6 +3596,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
 		query:                make(chan interface{}),
 		relayInv:             make(chan relayMsg, cfg.MaxPeers),
+		relayAddrs:           make(chan relayAddrsMsg, cfg.MaxPeers),
 		broadcast:            make(chan broadcastMsg, cfg.MaxPeers),
 		quit:                 make(chan struct{}),
 		modifyRebroadcastInv: make(chan interface{}),
@@ -2676,6 +3611,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		agentBlacklist:       agentBlacklist,
 		agentWhitelist:       agentWhitelist,
 	}
+	if _, err := rand.Read(s.addrRelayKey[:]); err != nil {
+		return nil, err
+	}
 
 	// Create the transaction and address indexes if needed.
 	//
@@ -2703,40 +3641,116 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
-	if !cfg.NoCFilters {
+	if cfg.SpentIndex {
+		indxLog.Info("Spent output index is enabled")
+		s.spentIndex = indexers.NewSpentIndex(db)
+		indexes = append(indexes, s.spentIndex)
+	}
+	if cfg.CoinStatsIndex {
+		indxLog.Info("Coin stats index is enabled")
+		s.coinStatsIndex = indexers.NewCoinStatsIndex(db)
+		indexes = append(indexes, s.coinStatsIndex)
+	}
+	if !cfg.NoCFilters && cfg.CFClient {
+		indxLog.Info("Committed filters are fetched from peers")
+		s.cfIndex = indexers.NewCfIndex(db, chainParams, nil)
+		if err := s.cfIndex.CreateStore(); err != nil {
+			return nil, err
+		}
+	} else if !cfg.NoCFilters {
 		indxLog.Info("Committed filter index is enabled")
-		s.cfIndex = indexers.NewCfIndex(db, chainParams)
+		s.cfIndex = indexers.NewCfIndex(db, chainParams, nil)
 		indexes = append(indexes, s.cfIndex)
 	}
 
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
-		indexManager = indexers.NewManager(db, indexes)
+		s.indexManager = indexers.NewManager(db, indexes)
+		s.indexManager.SubscribeCatchUp(s.handleIndexCatchUp)
+		indexManager = s.indexManager
+
+		// Drop the enabled indexes when they are to be rebuilt.  They
+		// are caught up to the best chain again when the chain is
+		// created below.
+		if cfg.Reindex {
+			indxLog.Info("Rebuilding all enabled indexes")
+			err := s.indexManager.DropIndexes(interrupt)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
+	// Only the given checkpoints are used when just the default ones are
+	// disabled.
 	var checkpoints []chaincfg.Checkpoint
 	if !cfg.DisableCheckpoints {
-		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
+		defaultCheckpoints := s.chainParams.Checkpoints
+		if cfg.NoDefaultCheckpoints {
+			defaultCheckpoints = nil
+		}
+		checkpoints = mergeCheckpoints(defaultCheckpoints,
+			cfg.addCheckpoints)
 	}
 
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:                    s.db,
+		Interrupt:             interrupt,
+		ChainParams:           s.chainParams,
+		Checkpoints:           checkpoints,
+		AssumeValid:           cfg.assumeValid,
+		MinimumChainWork:      cfg.minChainWork,
+		ScriptFlagActivations: cfg.scriptFlags,
+		UtxoCacheMaxSize:      uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		MaxOrphanBlocks:       cfg.MaxOrphanBlocks,
+		MaxOrphanBlocksSize:   uint64(cfg.MaxOrphanBlocksMiB) * 1024 * 1024,
+		OrphanBlockExpiry:     cfg.OrphanBlockExpiry,
+		TimeSource:            s.timeSource,
+		SigCache:              s.sigCache,
+		IndexManager:          indexManager,
+		HashCache:             s.hashCache,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	// Publish notifications about blocks and transactions over ZeroMQ when
+	// any endpoints are configured.
+	zmqEndpoints := make(map[zmqpub.Topic]string)
+	for topic, endpoint := range map[zmqpub.Topic]string{
+		zmqpub.TopicHashBlock: cfg.ZMQPubHashBlock,
+		zmqpub.TopicHashTx:    cfg.ZMQPubHashTx,
+		zmqpub.TopicRawBlock:  cfg.ZMQPubRawBlock,
+		zmqpub.TopicRawTx:     cfg.ZMQPubRawTx,
+		zmqpub.TopicSequence:  cfg.ZMQPubSequence,
+	} {
+		if endpoint != "" {
+			zmqEndpoints[topic] = endpoint
+		}
+	}
+	if len(zmqEndpoints) > 0 {
+		s.zmqPublisher, err = zmqpub.New(&zmqpub.Config{
+			Endpoints: zmqEndpoints,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.chain.Subscribe(s.zmqPublisher.HandleChainNotification)
+	}
+
+	// Fetch the committed filters from peers rather than building them
+	// from the blocks when requested.
+	if s.cfIndex != nil && cfg.CFClient {
+		s.cfClient = cfclient.New(&cfclient.Config{
+			Chain:   s.chain,
+			CfIndex: s.cfIndex,
+		})
+	}
+
 	// Search for a FeeEstimator state in the database. If none can be found
 	// or if it cannot be loaded, create a new one.
 	db.Update(func(tx database.Tx) error {
@@ -2760,8 +3774,11 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	})
 
 	// If no feeEstimator has been found, or if the one that has been found
-	// is behind somehow, create a new one and start over.
-	if s.feeEstimator == nil || s.feeEstimator.LastKnownHeight() != s.chain.BestSnapshot().Height {
+	// is ahead of the chain somehow, create a new one and start over.  One
+	// which is behind, typically since blocks were still processed after it
+	// was saved on shutdown, is kept as it ages its data by the blocks it
+	// missed once it is informed of the next block.
+	if s.feeEstimator == nil || s.feeEstimator.LastKnownHeight() > s.chain.BestSnapshot().Height {
 		s.feeEstimator = mempool.NewFeeEstimator(
 			mempool.DefaultEstimateFeeMaxRollback,
 			mempool.DefaultEstimateFeeMinRegisteredBlocks)
@@ -2769,15 +3786,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 	txC := mempool.Config{
 		Policy: mempool.Policy{
-			DisableRelayPriority: cfg.NoRelayPriority,
-			AcceptNonStd:         cfg.RelayNonStd,
-			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
-			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
-			MinRelayTxFee:        cfg.minRelayTxFee,
-			MaxTxVersion:         2,
-			RejectReplacement:    cfg.RejectReplacement,
+			DisableRelayPriority:  cfg.NoRelayPriority,
+			AcceptNonStd:          cfg.RelayNonStd,
+			FreeTxRelayLimit:      cfg.FreeTxRelayLimit,
+			MaxOrphanTxs:          cfg.MaxOrphanTxs,
+			MaxOrphanTxSize:       defaultMaxOrphanTxSize,
+			MaxSigOpCostPerTx:     blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:         cfg.minRelayTxFee,
+			DustRelayFee:          cfg.dustRelayFee,
+			MaxDataCarrierSize:    cfg.DataCarrierSize,
+			MaxDataCarrierOutputs: cfg.DataCarrierOutputs,
+			MaxTxVersion:          2,
+			RejectReplacement:     cfg.RejectReplacement,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2791,6 +3811,10 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		TxRemoved:          s.txRemoved,
+	}
+	if s.zmqPublisher != nil {
+		txC.TxAccepted = s.zmqPublisher.TxAccepted
 	}
 	s.txMemPool = mempool.New(&txC)
 
@@ -2802,6 +3826,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		DisableCheckpoints: cfg.DisableCheckpoints,
 		MaxPeers:           cfg.MaxPeers,
 		FeeEstimator:       s.feeEstimator,
+		MaxStallDuration:   cfg.SyncStallTimeout,
 	})
 	if err != nil {
 		return nil, err
@@ -2813,12 +3838,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinWeight:    cfg.BlockMinWeight,
-		BlockMaxWeight:    cfg.BlockMaxWeight,
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreeFee:      cfg.minRelayTxFee,
+		BlockMinWeight:         cfg.BlockMinWeight,
+		BlockMaxWeight:         cfg.BlockMaxWeight,
+		BlockMinSize:           cfg.BlockMinSize,
+		BlockMaxSize:           cfg.BlockMaxSize,
+		BlockPrioritySize:      cfg.BlockPrioritySize,
+		TxMinFreeFee:           cfg.minRelayTxFee,
+		BlockMinTxFee:          cfg.blockMinTxFee,
+		CoinbaseFlags:          cfg.CoinbaseFlags,
+		CoinbaseExtraNonceSize: cfg.CoinbaseNonceSize,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
@@ -2830,16 +3858,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		ProcessBlock:           s.syncManager.ProcessBlock,
 		ConnectedCount:         s.ConnectedCount,
 		IsCurrent:              s.syncManager.IsCurrent,
+		MaxCPUFraction:         cfg.MinerCPUFraction,
 	})
 
-	// Only setup a function to return new addresses to connect to when
-	// not running in connect-only mode.  The simulation network is always
-	// in connect-only mode since it is only intended to connect to
-	// specified peers and actively avoid advertising and connecting to
-	// discovered peers in order to prevent it from becoming a public test
-	// network.
-	var newAddressFunc func() (net.Addr, error)
+	// Only setup functions to return new addresses to connect to and to
+	// make feeler connections to when not running in connect-only mode.
+	// The simulation network is always in connect-only mode since it is
+	// only intended to connect to specified peers and actively avoid
+	// advertising and connecting to discovered peers in order to prevent
+	// it from becoming a public test network.
+	var newAddressFunc, feelerAddressFunc func() (net.Addr, error)
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
+		feelerAddressFunc = s.feelerAddress
 		newAddressFunc = func() (net.Addr, error) {
 			for tries := 0; tries < 100; tries++ {
 				addr := s.addrManager.GetAddress()
@@ -2882,18 +3912,20 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 
 	// Create a connection manager.
-	targetOutbound := defaultTargetOutbound
-	if cfg.MaxPeers < targetOutbound {
-		targetOutbound = cfg.MaxPeers
-	}
 	cmgr, err := connmgr.New(&connmgr.Config{
 		Listeners:      listeners,
 		OnAccept:       s.inboundPeerConnected,
 		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
+		TargetOutbound: targetOutbound(),
 		Dial:           btcdDial,
 		OnConnection:   s.outboundPeerConnected,
 		GetNewAddress:  newAddressFunc,
+		IsReachable: func(addr net.Addr) bool {
+			return isReachableAddr(amgr, addr)
+		},
+		FeelerInterval:     feelerInterval,
+		GetFeelerAddress:   feelerAddressFunc,
+		OnFeelerConnection: s.feelerConnected,
 	})
 	if err != nil {
 		return nil, err
@@ -2914,6 +3946,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		go s.connManager.Connect(&connmgr.ConnReq{
 			Addr:      netAddr,
 			Permanent: true,
+			Manual:    true,
 		})
 	}
 
@@ -2929,21 +3962,26 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
-			StartupTime:  s.startupTime,
-			ConnMgr:      &rpcConnManager{&s},
-			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
-			TimeSource:   s.timeSource,
-			Chain:        s.chain,
-			ChainParams:  chainParams,
-			DB:           db,
-			TxMemPool:    s.txMemPool,
-			Generator:    blockTemplateGenerator,
-			CPUMiner:     s.cpuMiner,
-			TxIndex:      s.txIndex,
-			AddrIndex:    s.addrIndex,
-			CfIndex:      s.cfIndex,
-			FeeEstimator: s.feeEstimator,
+			Listeners:      rpcListeners,
+			StartupTime:    s.startupTime,
+			ConnMgr:        &rpcConnManager{&s},
+			SyncMgr:        &rpcSyncMgr{&s, s.syncManager},
+			TimeSource:     s.timeSource,
+			Chain:          s.chain,
+			ChainParams:    chainParams,
+			DB:             db,
+			TxMemPool:      s.txMemPool,
+			SigCache:       s.sigCache,
+			HashCache:      s.hashCache,
+			Generator:      blockTemplateGenerator,
+			CPUMiner:       s.cpuMiner,
+			TxIndex:        s.txIndex,
+			AddrIndex:      s.addrIndex,
+			CfIndex:        s.cfIndex,
+			SpentIndex:     s.spentIndex,
+			CoinStatsIndex: s.coinStatsIndex,
+			IndexManager:   s.indexManager,
+			FeeEstimator:   s.feeEstimator,
 		})
 		if err != nil {
 			return nil, err
@@ -3023,6 +4061,13 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services wir
 			}
 			// nil nat here is fine, just means no upnp on network.
 		}
+		if nat == nil && cfg.NATPMP {
+			var err error
+			nat, err = DiscoverNATPMP()
+			if err != nil {
+				srvrLog.Warnf("Can't discover NAT-PMP gateway: %v", err)
+			}
+		}
 
 		// Add bound addresses to address manager to be advertised to peers.
 		for _, listener := range listeners {
@@ -3034,9 +4079,31 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services wir
 		}
 	}
 
+	// Advertise the onion address of the hidden service forwarding to the
+	// node so peers using tor are able to connect to it.
+	if cfg.ExternalOnion != "" {
+		err := addLocalOnionAddress(amgr, cfg.ExternalOnion, services)
+		if err != nil {
+			amgrLog.Warnf("Skipping specified external onion: %v", err)
+		}
+	}
+
 	return listeners, nat, nil
 }
 
+// isReachableAddr returns whether or not the passed address is on one of the
+// networks outbound connections are restricted to via the --onlynet option.
+func isReachableAddr(amgr *addrmgr.AddrManager, addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *onionAddr:
+		return amgr.IsNetworkReachable(addrmgr.NetOnion)
+	case *net.TCPAddr:
+		return amgr.IsReachable(wire.NewNetAddress(addr, 0))
+	}
+
+	return len(cfg.onlyNets) == 0
+}
+
 // addrStringToNetAddr takes an address in the form of 'host:port' and returns
 // a net.Addr which maps to the original address with any host names resolved
 // to IP addresses.  It also handles tor addresses properly by returning a
@@ -3085,6 +4152,28 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 	}, nil
 }
 
+// addLocalOnionAddress adds the onion address of a tor hidden service which
+// forwards to this node to the address manager so that it may be relayed to
+// peers.
+func addLocalOnionAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.ServiceFlag) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+	netAddr, err := addrMgr.HostToNetAddress(host, uint16(port), services)
+	if err != nil {
+		return err
+	}
+	if !addrmgr.IsOnionCatTor(netAddr) {
+		return fmt.Errorf("%s is not an onion address", host)
+	}
+	return addrMgr.AddLocalAddress(netAddr, addrmgr.ManualPrio)
+}
+
 // addLocalAddress adds an address that this node is listening on to the
 // address manager so that it may be relayed to peers.
 func addLocalAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.ServiceFlag) error {
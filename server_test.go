@@ -0,0 +1,2155 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/netsync"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bloom"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// extractMerkleBlockMatches traverses the partial merkle tree of the passed
+// merkleblock message as described by BIP0037 and returns the merkle root it
+// commits to along with the hashes of the transactions it proves.  The test
+// fails when the partial merkle tree is malformed.
+func extractMerkleBlockMatches(t *testing.T, msg *wire.MsgMerkleBlock) (chainhash.Hash, []chainhash.Hash) {
+	// treeWidth returns the number of nodes at the provided height of the
+	// merkle tree, where the transactions are at height zero.
+	treeWidth := func(height uint) uint32 {
+		return (msg.Transactions + (1 << height) - 1) >> height
+	}
+	var height uint
+	for treeWidth(height) > 1 {
+		height++
+	}
+
+	var bitsUsed, hashesUsed int
+	var matches []chainhash.Hash
+	var traverse func(height uint, pos uint32) chainhash.Hash
+	traverse = func(height uint, pos uint32) chainhash.Hash {
+		if bitsUsed >= len(msg.Flags)*8 {
+			t.Fatal("merkleblock has too few flag bits")
+		}
+		isParent := msg.Flags[bitsUsed/8]&(1<<uint(bitsUsed%8)) != 0
+		bitsUsed++
+
+		// The hash of nodes which aren't the parent of a match and of
+		// transactions is included in the message.
+		if height == 0 || !isParent {
+			if hashesUsed >= len(msg.Hashes) {
+				t.Fatal("merkleblock has too few hashes")
+			}
+			hash := *msg.Hashes[hashesUsed]
+			hashesUsed++
+			if height == 0 && isParent {
+				matches = append(matches, hash)
+			}
+			return hash
+		}
+
+		left := traverse(height-1, pos*2)
+		right := left
+		if pos*2+1 < treeWidth(height-1) {
+			right = traverse(height-1, pos*2+1)
+		}
+		return *blockchain.HashMerkleBranches(&left, &right)
+	}
+	root := traverse(height, 0)
+
+	if hashesUsed != len(msg.Hashes) {
+		t.Fatalf("merkleblock has %d unused hashes",
+			len(msg.Hashes)-hashesUsed)
+	}
+	if (bitsUsed+7)/8 != len(msg.Flags) {
+		t.Fatalf("merkleblock has %d unused flag bytes",
+			len(msg.Flags)-(bitsUsed+7)/8)
+	}
+	return root, matches
+}
+
+// TestFilterBlock ensures the merkleblock messages generated for a block and
+// a loaded bloom filter prove exactly the transactions that match the filter,
+// including those spending outputs the filter was updated with.
+func TestFilterBlock(t *testing.T) {
+	// Create a block with a transaction paying to a script, a transaction
+	// spending that payment, and unrelated transactions around them.
+	pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).AddData(make([]byte, 20)).
+		AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	newTx := func(prevOut wire.OutPoint, pkScript []byte) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		return tx
+	}
+	coinbase := newTx(wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		[]byte{txscript.OP_TRUE})
+	payment := newTx(wire.OutPoint{Hash: chainhash.Hash{0x01}}, pkScript)
+	spend := newTx(wire.OutPoint{Hash: payment.TxHash()},
+		[]byte{txscript.OP_TRUE})
+	msgBlock := &wire.MsgBlock{Transactions: []*wire.MsgTx{coinbase}}
+	for i := byte(2); i < 6; i++ {
+		prevOut := wire.OutPoint{Hash: chainhash.Hash{i}}
+		msgBlock.AddTransaction(newTx(prevOut, []byte{txscript.OP_TRUE}))
+		if i == 2 {
+			msgBlock.AddTransaction(payment)
+		}
+		if i == 4 {
+			msgBlock.AddTransaction(spend)
+		}
+	}
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	tests := []struct {
+		name   string
+		flags  wire.BloomUpdateType
+		wantTx []*wire.MsgTx
+	}{
+		{
+			name:   "update none",
+			flags:  wire.BloomUpdateNone,
+			wantTx: []*wire.MsgTx{payment},
+		},
+		{
+			name:   "update all",
+			flags:  wire.BloomUpdateAll,
+			wantTx: []*wire.MsgTx{payment, spend},
+		},
+	}
+	for _, test := range tests {
+		// Load a filter matching the public key hash the payment
+		// pays to.
+		filter := bloom.NewFilter(10, 0, 0.0001, test.flags)
+		filter.Add(make([]byte, 20))
+		merkle, matchedTxns := filterBlock(block, filter)
+
+		if merkle.Header != msgBlock.Header {
+			t.Errorf("%s: unexpected header", test.name)
+		}
+		if merkle.Transactions != uint32(len(msgBlock.Transactions)) {
+			t.Errorf("%s: unexpected number of transactions - got "+
+				"%d, want %d", test.name, merkle.Transactions,
+				len(msgBlock.Transactions))
+		}
+		root, matches := extractMerkleBlockMatches(t, merkle)
+		if root != msgBlock.Header.MerkleRoot {
+			t.Errorf("%s: partial merkle tree commits to %v, want "+
+				"%v", test.name, root, msgBlock.Header.MerkleRoot)
+		}
+
+		wantMatches := make([]chainhash.Hash, 0, len(test.wantTx))
+		for _, tx := range test.wantTx {
+			wantMatches = append(wantMatches, tx.TxHash())
+		}
+		if !reflect.DeepEqual(matches, wantMatches) {
+			t.Errorf("%s: unexpected proven transactions - got %v, "+
+				"want %v", test.name, matches, wantMatches)
+		}
+		if !reflect.DeepEqual(matchedTxns, test.wantTx) {
+			t.Errorf("%s: unexpected matched transactions",
+				test.name)
+		}
+	}
+}
+
+// newTestServerPeer returns a server peer which is not connected to anybody
+// for a server advertising the passed services.  The global config is replaced
+// with the provided one and the returned function restores it.
+func newTestServerPeer(testCfg *config, services wire.ServiceFlag) (*serverPeer, func()) {
+	origCfg := cfg
+	cfg = testCfg
+
+	sp := newServerPeer(&server{services: services}, false, connTypeInbound)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{})
+	return sp, func() {
+		sp.Disconnect()
+		cfg = origCfg
+	}
+}
+
+// isTestPeerDisconnected returns whether or not the passed peer was asked to
+// disconnect.
+func isTestPeerDisconnected(sp *serverPeer) bool {
+	disconnected := make(chan struct{})
+	go func() {
+		sp.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+// TestBloomFilterLimits ensures peers loading bloom filters larger than
+// allowed or sending filteradd messages faster than allowed are disconnected
+// and their ban score is increased, and that bloom filters are not served when
+// they are disabled.
+func TestBloomFilterLimits(t *testing.T) {
+	testCfg := &config{
+		BanThreshold:      defaultBanThreshold,
+		MaxFilterAddRate:  2,
+		MaxFilterLoadSize: 100,
+	}
+	newFilterLoad := func(size int) *wire.MsgFilterLoad {
+		return wire.NewMsgFilterLoad(make([]byte, size), 10, 0,
+			wire.BloomUpdateNone)
+	}
+
+	// Ensure a filter of the max allowed size is loaded.
+	sp, teardown := newTestServerPeer(testCfg, defaultServices)
+	defer teardown()
+	sp.OnFilterLoad(nil, newFilterLoad(100))
+	if !sp.filter.IsLoaded() || isTestPeerDisconnected(sp) {
+		t.Fatal("filter of the max allowed size was rejected")
+	}
+
+	// Ensure filteradd messages are accepted up to the allowed rate and
+	// the peer is disconnected once it is exceeded.
+	msg := wire.NewMsgFilterAdd([]byte{0x01})
+	for i := 0; i < testCfg.MaxFilterAddRate; i++ {
+		sp.OnFilterAdd(nil, msg)
+	}
+	if isTestPeerDisconnected(sp) {
+		t.Fatal("filteradd messages within the allowed rate were " +
+			"rejected")
+	}
+	sp.OnFilterAdd(nil, msg)
+	if !isTestPeerDisconnected(sp) {
+		t.Fatal("peer exceeding the filteradd rate was not disconnected")
+	}
+	if score := sp.banScore.Int(); score == 0 {
+		t.Fatal("ban score of peer exceeding the filteradd rate was " +
+			"not increased")
+	}
+
+	// Ensure an oversized filter is rejected.
+	sp, teardown = newTestServerPeer(testCfg, defaultServices)
+	defer teardown()
+	sp.OnFilterLoad(nil, newFilterLoad(101))
+	if sp.filter.IsLoaded() {
+		t.Fatal("oversized filter was loaded")
+	}
+	if !isTestPeerDisconnected(sp) {
+		t.Fatal("peer loading an oversized filter was not disconnected")
+	}
+	if score := sp.banScore.Int(); score == 0 {
+		t.Fatal("ban score of peer loading an oversized filter was " +
+			"not increased")
+	}
+
+	// Ensure the bloom service bit is only advertised when bloom filters
+	// are not disabled and filters are not loaded otherwise.
+	testCfg.NoPeerBloomFilters = true
+	testCfg.DisableBanning = true
+	services := configuredServices()
+	if services&wire.SFNodeBloom != 0 {
+		t.Fatalf("bloom service advertised with bloom filters disabled "+
+			"- got %v", services)
+	}
+	sp, teardown = newTestServerPeer(testCfg, services)
+	defer teardown()
+	sp.OnFilterLoad(nil, newFilterLoad(10))
+	if sp.filter.IsLoaded() || !isTestPeerDisconnected(sp) {
+		t.Fatal("filter was loaded with bloom filters disabled")
+	}
+	testCfg.NoPeerBloomFilters = false
+	if services := configuredServices(); services&wire.SFNodeBloom == 0 {
+		t.Fatalf("bloom service not advertised with bloom filters "+
+			"enabled - got %v", services)
+	}
+}
+
+// TestTxRemovedRebroadcast ensures replacement transactions are announced to
+// peers while the transactions they replaced are no longer rebroadcast and
+// websocket clients are notified about their removal, and that explicitly
+// removed transactions are left to their callers.
+func TestTxRemovedRebroadcast(t *testing.T) {
+	s := &server{
+		rpcServer:            &rpcServer{started: 1},
+		relayInv:             make(chan relayMsg, 1),
+		modifyRebroadcastInv: make(chan interface{}, 1),
+	}
+	s.rpcServer.ntfnMgr = newWsNotificationManager(s.rpcServer)
+
+	original := btcutil.NewTx(&wire.MsgTx{Version: 1, LockTime: 1})
+	replacement := btcutil.NewTx(&wire.MsgTx{Version: 1, LockTime: 2})
+
+	s.relayTransactions([]*mempool.TxDesc{{
+		TxDesc: mining.TxDesc{Tx: replacement},
+	}})
+	select {
+	case msg := <-s.relayInv:
+		want := wire.NewInvVect(wire.InvTypeTx, replacement.Hash())
+		if !reflect.DeepEqual(msg.invVect, want) {
+			t.Fatalf("unexpected relayed inventory - got %v, want %v",
+				msg.invVect, want)
+		}
+	default:
+		t.Fatal("replacement transaction was not relayed")
+	}
+
+	go s.txRemoved(original, mempool.RemovalReasonConflict)
+	select {
+	case msg := <-s.modifyRebroadcastInv:
+		del, ok := msg.(broadcastInventoryDel)
+		if !ok {
+			t.Fatalf("unexpected rebroadcast message type %T", msg)
+		}
+		if del.Hash != *original.Hash() {
+			t.Fatalf("unexpected rebroadcast removal - got %v, want %v",
+				del.Hash, original.Hash())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced transaction was not removed from rebroadcast")
+	}
+
+	// Websocket clients which registered for new transactions are notified
+	// that the replaced transaction was removed.
+	var removed *notificationTxRemovedFromMempool
+	select {
+	case n := <-s.rpcServer.ntfnMgr.queueNotification:
+		var ok bool
+		removed, ok = n.(*notificationTxRemovedFromMempool)
+		if !ok || removed.tx != original ||
+			removed.reason != mempool.RemovalReasonConflict {
+
+			t.Fatalf("unexpected notification %v", spew.Sdump(n))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced transaction removal was not notified")
+	}
+	wsc := &wsClient{
+		quit:     make(chan struct{}),
+		ntfnChan: make(chan []byte, 1),
+	}
+	s.rpcServer.ntfnMgr.notifyTxRemoved(map[chan struct{}]*wsClient{
+		wsc.quit: wsc,
+	}, removed.tx, removed.reason)
+	want := fmt.Sprintf(`{"jsonrpc":"1.0","method":"txremoved","params":`+
+		`["%v","replaced"],"id":null}`, original.Hash())
+	if got := string(<-wsc.ntfnChan); got != want {
+		t.Fatalf("unexpected notification - got %s, want %s", got, want)
+	}
+
+	s.txRemoved(original, mempool.RemovalReasonExplicit)
+	select {
+	case msg := <-s.modifyRebroadcastInv:
+		t.Fatalf("unexpected rebroadcast message for explicit removal: %v",
+			msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestIsReachableAddr ensures an onion-only configuration allows connections
+// to the onion addresses selected from the address manager while refusing
+// connections to any clearnet address.
+func TestIsReachableAddr(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{onlyNets: []addrmgr.Network{addrmgr.NetOnion}}
+	defer func() { cfg = origCfg }()
+
+	amgr := addrmgr.New(t.Name(), nil)
+	amgr.SetReachableNetworks(cfg.onlyNets...)
+
+	clearnet := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("12.1.2.3"), Port: 8333},
+		&net.TCPAddr{IP: net.ParseIP("2602:100::1"), Port: 8333},
+	}
+	for _, addr := range clearnet {
+		if isReachableAddr(amgr, addr) {
+			t.Errorf("clearnet address %v is reachable", addr)
+		}
+	}
+
+	// Add clearnet and onion addresses to the address manager and ensure
+	// only the onion address is selected and then allowed to be dialed.
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"),
+		8333, 0)
+	amgr.AddAddresses([]*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("2602:100::1"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("fd87:d87e:eb43:25::1"),
+			8333, 0),
+	}, srcAddr)
+	for i := 0; i < 20; i++ {
+		ka := amgr.GetAddress()
+		if ka == nil {
+			t.Fatalf("#%d: no address selected", i)
+		}
+		addr, err := addrStringToNetAddr(
+			addrmgr.NetAddressKey(ka.NetAddress()))
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		if _, ok := addr.(*onionAddr); !ok {
+			t.Fatalf("#%d: selected clearnet address %v", i, addr)
+		}
+		if !isReachableAddr(amgr, addr) {
+			t.Fatalf("#%d: onion address %v is unreachable", i, addr)
+		}
+	}
+}
+
+// TestLocalAddressDiscovery ensures the addresses inbound peers report to have
+// connected to are learned as local addresses which gain score each time they
+// are reported, and that the highest-scoring reachable local address, including
+// a configured onion address, is the one advertised to peers.
+func TestLocalAddressDiscovery(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{}
+	defer func() { cfg = origCfg }()
+
+	services := wire.SFNodeNetwork | wire.SFNodeWitness
+	s := &server{
+		addrManager: addrmgr.New(t.Name(), nil),
+		services:    services,
+		timeSource:  blockchain.NewMedianTime(),
+	}
+	err := addLocalAddress(s.addrManager, "173.194.115.66:8333", services)
+	if err != nil {
+		t.Fatalf("addLocalAddress: unexpected error: %v", err)
+	}
+	err = addLocalOnionAddress(s.addrManager, "aaaaaaaaaaaaaaaa.onion:8333",
+		services)
+	if err != nil {
+		t.Fatalf("addLocalOnionAddress: unexpected error: %v", err)
+	}
+	if addLocalOnionAddress(s.addrManager, "173.194.115.67:8333", services) == nil {
+		t.Fatal("addLocalOnionAddress: did not receive expected error " +
+			"for a clearnet address")
+	}
+
+	// reportAddr records an inbound peer with the passed source address
+	// reporting it connected to the passed address.
+	reportAddr := func(addr, src string) {
+		s.seenLocalAddress(
+			wire.NewNetAddressIPPort(net.ParseIP(addr), 8333, 0),
+			wire.NewNetAddressIPPort(net.ParseIP(src), 8333, 0))
+	}
+
+	// Addresses which are not routable are ignored while a routable one
+	// is learned once peers from several network groups reported it and
+	// gains score when peers from another one report it.
+	reportAddr("10.0.0.1", "12.1.2.3")
+	for _, src := range []string{"12.1.2.3", "12.1.2.4", "13.1.2.3",
+		"14.1.2.3", "15.1.2.3"} {
+
+		reportAddr("204.124.8.100", src)
+	}
+	want := []addrmgr.LocalAddressInfo{{
+		NetAddress: wire.NewNetAddressIPPort(
+			net.ParseIP("fd87:d87e:eb43::"), 8333, services),
+		Score: addrmgr.ManualPrio,
+	}, {
+		NetAddress: wire.NewNetAddressIPPort(
+			net.ParseIP("204.124.8.100"), 8333, services),
+		Score: addrmgr.InboundPrio + 1,
+	}, {
+		NetAddress: wire.NewNetAddressIPPort(
+			net.ParseIP("173.194.115.66"), 8333, services),
+		Score: addrmgr.BoundPrio,
+	}}
+	got := s.addrManager.LocalAddresses()
+	if len(got) != len(want) {
+		t.Fatalf("unexpected number of local addresses - got %d, want %d",
+			len(got), len(want))
+	}
+	for i := range want {
+		gotKey := addrmgr.NetAddressKey(got[i].NetAddress)
+		wantKey := addrmgr.NetAddressKey(want[i].NetAddress)
+		if gotKey != wantKey || got[i].Score != want[i].Score {
+			t.Fatalf("#%d: unexpected local address - got %s (%d), "+
+				"want %s (%d)", i, gotKey, got[i].Score, wantKey,
+				want[i].Score)
+		}
+	}
+
+	// The learned address outscores the bound one for clearnet peers while
+	// the onion address is advertised to peers using tor.
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{remote: "12.1.2.3", want: "204.124.8.100:8333"},
+		{remote: "fd87:d87e:eb43:25::1",
+			want: "aaaaaaaaaaaaaaaa.onion:8333"},
+	}
+	for _, test := range tests {
+		remote := wire.NewNetAddressIPPort(net.ParseIP(test.remote),
+			8333, 0)
+		lna := s.addrManager.GetBestLocalAddress(remote)
+		if got := addrmgr.NetAddressKey(lna); got != test.want {
+			t.Errorf("%s: unexpected best local address - got %s, "+
+				"want %s", test.remote, got, test.want)
+		}
+	}
+
+	// Inbound peers without a known address are ignored.
+	sp := newServerPeer(s, false, connTypeInbound)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{})
+	defer sp.Disconnect()
+	msg := wire.NewMsgVersion(
+		wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("204.124.9.1"), 8333, 0),
+		0, 0)
+	msg.ProtocolVersion = int32(wire.ProtocolVersion)
+	if reject := sp.OnVersion(sp.Peer, msg); reject != nil {
+		t.Fatalf("OnVersion: unexpected reject %v", reject)
+	}
+	if got := s.addrManager.LocalAddresses(); len(got) != len(want) {
+		t.Fatalf("unexpected number of local addresses - got %d, want %d",
+			len(got), len(want))
+	}
+}
+
+// testNATPMPGateway is a NAT-PMP gateway which maps every requested port to the
+// port after it and records the requests it receives.  The first attempt of
+// each request is ignored to exercise retransmissions.
+type testNATPMPGateway struct {
+	conn     *net.UDPConn
+	external net.IP
+	result   uint32 // Must be used atomically.
+	requests chan []byte
+}
+
+// newTestNATPMPGateway returns a mock NAT-PMP gateway listening on a local port
+// which reports the passed external address.
+func newTestNATPMPGateway(t *testing.T, external net.IP) *testNATPMPGateway {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	g := &testNATPMPGateway{
+		conn:     conn,
+		external: external.To4(),
+		requests: make(chan []byte, 10),
+	}
+	go g.serve()
+	return g
+}
+
+// nat returns a NAT which uses the mock gateway.
+func (g *testNATPMPGateway) nat() *natpmpNAT {
+	return &natpmpNAT{gateway: g.conn.LocalAddr().(*net.UDPAddr)}
+}
+
+// serve responds to the requests sent to the mock gateway until it is closed.
+func (g *testNATPMPGateway) serve() {
+	buf := make([]byte, 16)
+	var retransmission bool
+	for {
+		n, addr, err := g.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if retransmission = !retransmission; retransmission {
+			continue
+		}
+		request := append([]byte(nil), buf[:n]...)
+		g.requests <- request
+
+		response := make([]byte, 16)
+		response[1] = request[1] + natpmpOpResponse
+		result := uint16(atomic.LoadUint32(&g.result))
+		binary.BigEndian.PutUint16(response[2:4], result)
+		switch request[1] {
+		case natpmpOpExternalAddress:
+			copy(response[8:12], g.external)
+			response = response[:12]
+		default:
+			copy(response[8:10], request[4:6])
+			port := binary.BigEndian.Uint16(request[6:8])
+			if port != 0 {
+				port++
+			}
+			binary.BigEndian.PutUint16(response[10:12], port)
+			copy(response[12:16], request[8:12])
+		}
+		g.conn.WriteToUDP(response, addr)
+	}
+}
+
+// TestNATPMP ensures port mappings and the external address are requested from
+// a NAT-PMP gateway and that refused requests result in an error.
+func TestNATPMP(t *testing.T) {
+	gateway := newTestNATPMPGateway(t, net.IPv4(12, 1, 2, 3))
+	defer gateway.conn.Close()
+	nat := gateway.nat()
+
+	external, err := nat.GetExternalAddress()
+	if err != nil {
+		t.Fatalf("GetExternalAddress: unexpected error: %v", err)
+	}
+	if !external.Equal(net.IPv4(12, 1, 2, 3)) {
+		t.Fatalf("unexpected external address %v", external)
+	}
+	if request := <-gateway.requests; !bytes.Equal(request, []byte{0, 0}) {
+		t.Fatalf("unexpected external address request %x", request)
+	}
+
+	port, err := nat.AddPortMapping("tcp", 8333, 8334, "btcd", 1200)
+	if err != nil {
+		t.Fatalf("AddPortMapping: unexpected error: %v", err)
+	}
+	if port != 8334 {
+		t.Fatalf("unexpected mapped external port - got %d, want 8334",
+			port)
+	}
+	want := []byte{0, natpmpOpMapTCP, 0, 0, 0x20, 0x8e, 0x20, 0x8d, 0, 0,
+		0x04, 0xb0}
+	if request := <-gateway.requests; !bytes.Equal(request, want) {
+		t.Fatalf("unexpected mapping request - got %x, want %x",
+			request, want)
+	}
+
+	if err := nat.DeletePortMapping("tcp", 8333, 8334); err != nil {
+		t.Fatalf("DeletePortMapping: unexpected error: %v", err)
+	}
+	want = []byte{0, natpmpOpMapTCP, 0, 0, 0x20, 0x8e, 0, 0, 0, 0, 0, 0}
+	if request := <-gateway.requests; !bytes.Equal(request, want) {
+		t.Fatalf("unexpected mapping removal request - got %x, want %x",
+			request, want)
+	}
+
+	if _, err := nat.AddPortMapping("sctp", 8333, 8333, "btcd", 1200); err == nil {
+		t.Fatal("AddPortMapping: did not receive expected error for " +
+			"an unsupported protocol")
+	}
+	atomic.StoreUint32(&gateway.result, 2)
+	if _, err := nat.AddPortMapping("tcp", 8333, 8333, "btcd", 1200); err == nil {
+		t.Fatal("AddPortMapping: did not receive expected error for " +
+			"a refused request")
+	}
+}
+
+// TestNATUpdateThread ensures the server maps the listen port on the gateway of
+// the NAT it is behind, registers the external address of the gateway as a
+// local address to advertise, and removes the mapping when it shuts down.
+func TestNATUpdateThread(t *testing.T) {
+	gateway := newTestNATPMPGateway(t, net.IPv4(12, 1, 2, 3))
+	defer gateway.conn.Close()
+
+	services := wire.SFNodeNetwork | wire.SFNodeWitness
+	s := &server{
+		addrManager: addrmgr.New(t.Name(), nil),
+		services:    services,
+		nat:         gateway.nat(),
+		quit:        make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.natUpdateThread()
+
+	// The lease is requested for the default port followed by the external
+	// address.
+	lport, _ := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	request := <-gateway.requests
+	if request[1] != natpmpOpMapTCP ||
+		binary.BigEndian.Uint16(request[4:6]) != uint16(lport) ||
+		binary.BigEndian.Uint32(request[8:12]) != uint32(natLeaseDuration/time.Second) {
+
+		t.Fatalf("unexpected mapping request %x", request)
+	}
+	if request := <-gateway.requests; request[1] != natpmpOpExternalAddress {
+		t.Fatalf("unexpected external address request %x", request)
+	}
+
+	// The external address is registered with the mapped port.
+	wantKey := net.JoinHostPort("12.1.2.3", strconv.Itoa(int(lport)+1))
+	waitForTestCondition(t, "external address", func() bool {
+		for _, la := range s.addrManager.LocalAddresses() {
+			if addrmgr.NetAddressKey(la.NetAddress) == wantKey &&
+				la.Score == addrmgr.UpnpPrio {
+
+				return true
+			}
+		}
+		return false
+	})
+
+	close(s.quit)
+	s.wg.Wait()
+	request = <-gateway.requests
+	if request[1] != natpmpOpMapTCP ||
+		binary.BigEndian.Uint32(request[8:12]) != 0 {
+
+		t.Fatalf("unexpected mapping removal request %x", request)
+	}
+}
+
+// TestOutboundConnType ensures outbound connections requested by the user are
+// tagged as manual and automatic ones as block-relay-only while a slot for
+// them is available and as full relay otherwise.
+func TestOutboundConnType(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{BlockRelayOnlyPeers: 1}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	s := &server{}
+	tests := []struct {
+		name   string
+		manual bool
+		want   connectionType
+	}{
+		{name: "manual", manual: true, want: connTypeManual},
+		{name: "first automatic", want: connTypeBlockRelayOnly},
+		{name: "second automatic", want: connTypeOutboundFullRelay},
+		{name: "manual after slots", manual: true, want: connTypeManual},
+	}
+	for _, test := range tests {
+		got := s.outboundConnType(&connmgr.ConnReq{Manual: test.manual})
+		if got != test.want {
+			t.Errorf("%s: unexpected connection type - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestTargetOutbound ensures the number of automatic outbound connections
+// includes the block-relay-only ones in addition to the configured target, that
+// it is limited by the maximum number of peers, and that the connection manager
+// attempts the resulting number of connections.
+func TestTargetOutbound(t *testing.T) {
+	origCfg := cfg
+	defer func() {
+		cfg = origCfg
+	}()
+
+	tests := []struct {
+		name           string
+		targetOutbound int
+		blockRelayOnly int
+		maxPeers       int
+		want           uint32
+	}{{
+		name:           "default",
+		targetOutbound: defaultTargetOutbound,
+		maxPeers:       defaultMaxPeers,
+		want:           8,
+	}, {
+		name:           "higher target with block-relay-only peers",
+		targetOutbound: 12,
+		blockRelayOnly: 2,
+		maxPeers:       defaultMaxPeers,
+		want:           14,
+	}, {
+		name:           "limited by max peers",
+		targetOutbound: 12,
+		blockRelayOnly: 2,
+		maxPeers:       10,
+		want:           10,
+	}}
+	for _, test := range tests {
+		cfg = &config{
+			TargetOutbound:      test.targetOutbound,
+			BlockRelayOnlyPeers: test.blockRelayOnly,
+			MaxPeers:            test.maxPeers,
+		}
+		if got := targetOutbound(); got != test.want {
+			t.Errorf("%s: unexpected target - got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+
+	// The connection manager makes exactly the targeted number of
+	// connections to new addresses.
+	cfg = &config{
+		TargetOutbound:      12,
+		BlockRelayOnlyPeers: 2,
+		MaxPeers:            defaultMaxPeers,
+	}
+	dialed := make(chan net.Addr, 100)
+	var nextPort int32
+	cmgr, err := connmgr.New(&connmgr.Config{
+		TargetOutbound: targetOutbound(),
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			dialed <- addr
+			conn, _ := net.Pipe()
+			return conn, nil
+		},
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("12.1.2.3"),
+				Port: int(atomic.AddInt32(&nextPort, 1)),
+			}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to create connection manager: %v", err)
+	}
+	cmgr.Start()
+	defer cmgr.Stop()
+	for i := 0; i < 14; i++ {
+		select {
+		case <-dialed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for outbound connection %d", i)
+		}
+	}
+	select {
+	case addr := <-dialed:
+		t.Fatalf("unexpected connection beyond the target to %v", addr)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestFeelerConnection ensures feeler addresses are marked as attempted when
+// they are selected and as good only once the feeler connection to them
+// completes the handshake, after which the connection is closed.
+func TestFeelerConnection(t *testing.T) {
+	chainServer, teardown := newTestChainRPCServer(t, "feelerconnection")
+	defer teardown()
+
+	origCfg := cfg
+	cfg = &config{}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	params := &chaincfg.RegressionNetParams
+	amgr := addrmgr.New(t.Name(), nil)
+	s := &server{
+		addrManager: amgr,
+		chain:       chainServer.cfg.Chain,
+		chainParams: params,
+	}
+
+	// Run a remote node which performs the handshake when handshake is set
+	// and closes the connection otherwise.  It reports when the feeler
+	// disconnects.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	remoteDone := make(chan struct{})
+	runRemote := func(handshake bool) {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			conn.Close()
+			remoteDone <- struct{}{}
+		}()
+		if !handshake {
+			return
+		}
+
+		pver := wire.ProtocolVersion
+		if _, _, err := wire.ReadMessage(conn, pver, params.Net); err != nil {
+			return
+		}
+		addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0,
+			wire.SFNodeNetwork)
+		versionMsg := wire.NewMsgVersion(addr, addr, 0, 0)
+		versionMsg.Services = wire.SFNodeNetwork
+		if err := wire.WriteMessage(conn, versionMsg, pver, params.Net); err != nil {
+			return
+		}
+		err = wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, params.Net)
+		if err != nil {
+			return
+		}
+		for {
+			if _, _, err := wire.ReadMessage(conn, pver, params.Net); err != nil {
+				return
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		handshake bool
+	}{
+		{name: "reachable", ip: "12.1.2.3", handshake: true},
+		{name: "unreachable", ip: "12.2.2.3", handshake: false},
+	}
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"),
+		8333, 0)
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		amgr.AddAddress(na, srcAddr)
+		ka := amgr.GetFeelerAddress()
+		if ka == nil || !ka.NetAddress().IP.Equal(na.IP) {
+			t.Fatalf("%s: unexpected feeler address %v", test.name, ka)
+		}
+
+		addr, err := s.feelerAddress()
+		if err != nil {
+			t.Fatalf("%s: feelerAddress: unexpected error: %v",
+				test.name, err)
+		}
+		if addr.String() != addrmgr.NetAddressKey(na) {
+			t.Fatalf("%s: unexpected feeler address - got %v, want "+
+				"%v", test.name, addr, addrmgr.NetAddressKey(na))
+		}
+		if ka.Attempts() != 1 {
+			t.Fatalf("%s: unexpected attempts before the feeler "+
+				"connection - got %d, want 1", test.name,
+				ka.Attempts())
+		}
+
+		go runRemote(test.handshake)
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: unable to connect: %v", test.name, err)
+		}
+		s.feelerConnected(addr, conn)
+		select {
+		case <-remoteDone:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: feeler connection was not closed", test.name)
+		}
+
+		wantAttempts := 1
+		if test.handshake {
+			wantAttempts = 0
+		}
+		if ka.Attempts() != wantAttempts ||
+			ka.LastSuccess().IsZero() == test.handshake {
+
+			t.Fatalf("%s: unexpected address state - got %d "+
+				"attempts, last success %v", test.name,
+				ka.Attempts(), ka.LastSuccess())
+		}
+	}
+
+	// Only the unreachable address is left to make feeler connections to.
+	ka := amgr.GetFeelerAddress()
+	if ka == nil || !ka.NetAddress().IP.Equal(net.ParseIP("12.2.2.3")) {
+		t.Fatalf("unexpected feeler address %v", ka)
+	}
+}
+
+// TestBlockRelayOnlyPeer ensures block-relay-only connection slots are limited
+// to the configured number and that a block-relay-only peer negotiates no
+// transaction relay and is relayed block inventory but neither transaction
+// inventory nor addresses.
+func TestBlockRelayOnlyPeer(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{BlockRelayOnlyPeers: 1}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	// Ensure no more slots than configured are reserved and that released
+	// slots may be reserved again.
+	s := &server{addrManager: addrmgr.New(t.Name(), nil)}
+	if !s.reserveBlockRelayOnly() {
+		t.Fatal("unable to reserve block-relay-only slot")
+	}
+	if s.reserveBlockRelayOnly() {
+		t.Fatal("reserved more block-relay-only slots than configured")
+	}
+	s.releaseBlockRelayOnly()
+	if !s.reserveBlockRelayOnly() {
+		t.Fatal("unable to reserve released block-relay-only slot")
+	}
+
+	// Ensure the version message of a block-relay-only peer asks the
+	// remote peer not to relay transactions.
+	sp := newServerPeer(s, false, connTypeBlockRelayOnly)
+	peerCfg := newPeerConfig(sp)
+	if !peerCfg.DisableRelayTx {
+		t.Fatal("block-relay-only peer does not disable transaction " +
+			"relay")
+	}
+
+	// Connect the block-relay-only peer to a remote node which performs
+	// the handshake and then records the messages it receives.  The remote
+	// node is not a peer of the peer package since it refuses connections
+	// to peers of the same process.  The server specific handlers are not
+	// needed to exercise relaying, so they are removed.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	remoteVersion := make(chan *wire.MsgVersion, 1)
+	received := make(chan wire.Message, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		params := &chaincfg.MainNetParams
+		pver := wire.ProtocolVersion
+		msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+		if err != nil {
+			return
+		}
+		if msg, ok := msg.(*wire.MsgVersion); ok {
+			remoteVersion <- msg
+		}
+		addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0,
+			wire.SFNodeNetwork)
+		versionMsg := wire.NewMsgVersion(addr, addr, 0, 0)
+		versionMsg.Services = wire.SFNodeNetwork
+		if err := wire.WriteMessage(conn, versionMsg, pver, params.Net); err != nil {
+			return
+		}
+		err = wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, params.Net)
+		if err != nil {
+			return
+		}
+		for {
+			msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+			if err != nil {
+				return
+			}
+			switch msg.(type) {
+			case *wire.MsgInv, *wire.MsgAddr:
+				received <- msg
+			}
+		}
+	}()
+
+	verAcks := make(chan struct{}, 1)
+	peerCfg.Listeners = peer.MessageListeners{
+		OnVerAck: func(*peer.Peer, *wire.MsgVerAck) {
+			verAcks <- struct{}{}
+		},
+	}
+	peerCfg.NewestBlock = nil
+	peerCfg.HostToNetAddress = nil
+	peerCfg.ChainParams = &chaincfg.MainNetParams
+	peerCfg.TrickleInterval = 10 * time.Millisecond
+	sp.Peer, err = peer.NewOutboundPeer(peerCfg, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	sp.AssociateConnection(conn)
+	defer sp.Disconnect()
+	select {
+	case <-verAcks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the handshake")
+	}
+	if msg := <-remoteVersion; !msg.DisableRelayTx {
+		t.Fatal("version message of block-relay-only peer does not " +
+			"disable transaction relay")
+	}
+
+	// Relay addresses, a transaction and then a block to the peer while
+	// it is the only one connected.
+	na := wire.NewNetAddressIPPort(net.ParseIP("8.8.8.8"), 8333,
+		wire.SFNodeNetwork)
+	sp.pushAddrMsg([]*wire.NetAddress{na})
+
+	state := &peerState{
+		outboundPeers: map[int32]*serverPeer{sp.ID(): sp},
+	}
+	tx := btcutil.NewTx(&wire.MsgTx{Version: 1})
+	s.handleRelayInvMsg(state, relayMsg{
+		invVect: wire.NewInvVect(wire.InvTypeTx, tx.Hash()),
+		data:    &mempool.TxDesc{TxDesc: mining.TxDesc{Tx: tx}},
+	})
+	blockHash := chainhash.Hash{0x01}
+	s.handleRelayInvMsg(state, relayMsg{
+		invVect: wire.NewInvVect(wire.InvTypeBlock, &blockHash),
+		data:    wire.BlockHeader{},
+	})
+
+	// Ensure only the block inventory is received.  Messages are sent in
+	// order, so any addresses would have been received before it.
+	select {
+	case msg := <-received:
+		inv, ok := msg.(*wire.MsgInv)
+		if !ok || len(inv.InvList) != 1 ||
+			inv.InvList[0].Type != wire.InvTypeBlock ||
+			inv.InvList[0].Hash != blockHash {
+
+			t.Fatalf("unexpected relayed message: %v", spew.Sdump(msg))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("block inventory was not relayed")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected relayed message: %v", spew.Sdump(msg))
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Ensure addresses sent by the peer are ignored.
+	msgAddr := wire.NewMsgAddr()
+	msgAddr.AddAddress(na)
+	sp.OnAddr(nil, msgAddr)
+	if n := s.addrManager.NumAddresses(); n != 0 {
+		t.Fatalf("%d addresses from block-relay-only peer were added", n)
+	}
+}
+
+// newTestPipeServerPeer returns a server peer of the passed server and type
+// for the passed address whose connection is one end of a pipe nobody reads from, so it stays
+// connected without completing the handshake until it is disconnected.
+func newTestPipeServerPeer(t *testing.T, s *server, connType connectionType, addr string) *serverPeer {
+	t.Helper()
+
+	sp := newServerPeer(s, false, connType)
+	peerCfg := &peer.Config{ChainParams: &chaincfg.MainNetParams}
+	var err error
+	sp.Peer, err = peer.NewOutboundPeer(peerCfg, addr)
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	conn, _ := net.Pipe()
+	sp.AssociateConnection(conn)
+	return sp
+}
+
+// TestAddrRateLimit ensures addresses a peer sends beyond its rate limit are
+// dropped and increase its ban score up to banning it, that asking the peer for
+// addresses allows it to send a full addr message, and that only the recent
+// addresses of small messages not sent before are relayed.
+func TestAddrRateLimit(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{BanThreshold: defaultBanThreshold}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	// Keep the warnings logged when the ban score increases out of the
+	// test output.
+	peerLog.SetLevel(btclog.LevelOff)
+	defer peerLog.SetLevel(btclog.LevelInfo)
+
+	s := &server{
+		addrManager: addrmgr.New(t.Name(), nil),
+		banPeers:    make(chan *serverPeer, 1),
+		relayAddrs:  make(chan relayAddrsMsg, 1),
+	}
+	sp := newTestPipeServerPeer(t, s, connTypeInbound, "12.1.2.3:8333")
+	defer sp.Disconnect()
+
+	var nextAddr uint32
+	newMsgAddr := func(n int, timestamp time.Time) *wire.MsgAddr {
+		msg := wire.NewMsgAddr()
+		for i := 0; i < n; i++ {
+			nextAddr++
+			ip := net.IPv4(byte(20+nextAddr/200),
+				byte(nextAddr%200), 1, 1)
+			na := wire.NewNetAddressIPPort(ip, 8333, wire.SFNodeNetwork)
+			na.Timestamp = timestamp
+			msg.AddAddress(na)
+		}
+		return msg
+	}
+	checkRelayed := func(want []*wire.NetAddress) {
+		t.Helper()
+
+		var got []*wire.NetAddress
+		select {
+		case msg := <-s.relayAddrs:
+			if msg.from != sp {
+				t.Fatalf("unexpected relaying peer %v", msg.from)
+			}
+			got = msg.addresses
+		default:
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected relayed addresses - got %v, want %v",
+				spew.Sdump(got), spew.Sdump(want))
+		}
+	}
+
+	// A new peer may only send a single address, which is relayed since
+	// it is recent.  Sending it again doesn't relay it again.
+	now := time.Now()
+	msg := newMsgAddr(1, now)
+	sp.OnAddr(nil, msg)
+	checkRelayed(msg.AddrList)
+	sp.addrTokens = 1
+	sp.OnAddr(nil, msg)
+	checkRelayed(nil)
+	if score := sp.banScore.Int(); score != 0 {
+		t.Fatalf("unexpected ban score within the rate limit - got %d",
+			score)
+	}
+
+	// Addresses which are old or part of large messages aren't relayed.
+	sp.addrTokens = 2
+	msg = newMsgAddr(2, now.Add(-time.Hour))
+	sp.OnAddr(nil, msg)
+	checkRelayed(nil)
+	sp.addrTokens = maxRelayAddrsPerMsg + 1
+	sp.OnAddr(nil, newMsgAddr(maxRelayAddrsPerMsg+1, now))
+	checkRelayed(nil)
+	numAddrs := 1 + 2 + maxRelayAddrsPerMsg + 1
+	if n := s.addrManager.NumAddresses(); n != numAddrs {
+		t.Fatalf("unexpected number of addresses - got %d, want %d", n,
+			numAddrs)
+	}
+
+	// Asking the peer for addresses allows a full addr message.
+	sp.addAddrTokens(wire.MaxAddrPerMsg)
+	sp.OnAddr(nil, newMsgAddr(wire.MaxAddrPerMsg, now.Add(-time.Hour)))
+	numAddrs += wire.MaxAddrPerMsg
+	if n := s.addrManager.NumAddresses(); n != numAddrs {
+		t.Fatalf("unexpected number of addresses - got %d, want %d", n,
+			numAddrs)
+	}
+	if score := sp.banScore.Int(); score != 0 {
+		t.Fatalf("unexpected ban score for an answer to getaddr - got %d",
+			score)
+	}
+
+	// Floods beyond the rate limit are dropped and increase the ban score
+	// until the peer is banned.
+	for i := 0; ; i++ {
+		sp.OnAddr(nil, newMsgAddr(wire.MaxAddrPerMsg, now))
+		if n := s.addrManager.NumAddresses(); n > numAddrs+1 {
+			t.Fatalf("addresses beyond the rate limit were added - "+
+				"got %d, want at most %d", n, numAddrs+1)
+		}
+		numAddrs = s.addrManager.NumAddresses()
+		checkRelayed(nil)
+
+		select {
+		case banned := <-s.banPeers:
+			if banned != sp {
+				t.Fatalf("unexpected banned peer %v", banned)
+			}
+			if i == 0 {
+				t.Fatal("peer banned for the first flood")
+			}
+			if !isTestPeerDisconnected(sp) {
+				t.Fatal("banned peer was not disconnected")
+			}
+			return
+		default:
+		}
+		if score := sp.banScore.Int(); score == 0 {
+			t.Fatal("ban score of flooding peer was not increased")
+		}
+		if i == 3 {
+			t.Fatal("flooding peer was not banned")
+		}
+	}
+}
+
+// TestOnAddrShutdown ensures a peer sending addresses to be relayed does not
+// block once the server is shutting down and no longer relays them.
+func TestOnAddrShutdown(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{BanThreshold: defaultBanThreshold}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	s := &server{
+		addrManager: addrmgr.New(t.Name(), nil),
+		relayAddrs:  make(chan relayAddrsMsg),
+		quit:        make(chan struct{}),
+	}
+	sp := newTestPipeServerPeer(t, s, connTypeInbound, "12.1.2.3:8333")
+	defer sp.Disconnect()
+	close(s.quit)
+
+	msg := wire.NewMsgAddr()
+	na := wire.NewNetAddressIPPort(net.ParseIP("12.1.2.4"), 8333,
+		wire.SFNodeNetwork)
+	na.Timestamp = time.Now()
+	msg.AddAddress(na)
+	done := make(chan struct{})
+	go func() {
+		sp.OnAddr(nil, msg)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnAddr blocked relaying addresses during shutdown")
+	}
+}
+
+// TestRelayAddrs ensures addresses are relayed to two peers when they are
+// reachable and to one otherwise, excluding the peer which sent them and
+// block-relay-only peers, and that relaying the same address again selects
+// the same peers.
+func TestRelayAddrs(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	s := &server{addrManager: addrmgr.New(t.Name(), nil)}
+	state := &peerState{
+		inboundPeers:  make(map[int32]*serverPeer),
+		outboundPeers: make(map[int32]*serverPeer),
+	}
+	from := newTestPipeServerPeer(t, s, connTypeInbound, "12.1.2.3:8333")
+	defer from.Disconnect()
+	state.inboundPeers[0] = from
+	blockRelayOnly := newTestPipeServerPeer(t, s, connTypeBlockRelayOnly,
+		"12.1.2.4:8333")
+	defer blockRelayOnly.Disconnect()
+	state.outboundPeers[0] = blockRelayOnly
+
+	// The peers are keyed by their index since they have no ids without a
+	// handshake.
+	var peers []*serverPeer
+	for i := 1; i <= 5; i++ {
+		addr := fmt.Sprintf("12.1.3.%d:8333", i)
+		sp := newTestPipeServerPeer(t, s, connTypeOutboundFullRelay, addr)
+		defer sp.Disconnect()
+		state.outboundPeers[int32(i)] = sp
+		peers = append(peers, sp)
+	}
+
+	relayedTo := func(na *wire.NetAddress) []*serverPeer {
+		var knownBy []*serverPeer
+		for _, sp := range peers {
+			if sp.addressKnown(na) {
+				knownBy = append(knownBy, sp)
+			}
+		}
+		if from.addressKnown(na) || blockRelayOnly.addressKnown(na) {
+			t.Fatalf("address %v relayed to excluded peer", na)
+		}
+		return knownBy
+	}
+
+	reachable := wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333,
+		wire.SFNodeNetwork)
+	unreachable := wire.NewNetAddressIPPort(
+		net.ParseIP("fd87:d87e:eb43::1"), 8333, wire.SFNodeNetwork)
+	s.addrManager.SetReachableNetworks(addrmgr.NetIPv4)
+	s.handleRelayAddrsMsg(state, relayAddrsMsg{
+		from:      from,
+		addresses: []*wire.NetAddress{reachable, unreachable},
+	})
+	reachableTo := relayedTo(reachable)
+	if len(reachableTo) != 2 {
+		t.Fatalf("reachable address relayed to %d peers, want 2",
+			len(reachableTo))
+	}
+	if n := len(relayedTo(unreachable)); n != 1 {
+		t.Fatalf("unreachable address relayed to %d peers, want 1", n)
+	}
+
+	// Forget the address was relayed and relay it again.
+	for _, sp := range peers {
+		sp.knownAddresses = make(map[string]struct{})
+	}
+	s.handleRelayAddrsMsg(state, relayAddrsMsg{
+		from:      from,
+		addresses: []*wire.NetAddress{reachable},
+	})
+	if got := relayedTo(reachable); !reflect.DeepEqual(got, reachableTo) {
+		t.Fatalf("address relayed to different peers - got %v, want %v",
+			got, reachableTo)
+	}
+}
+
+// TestPeerHandlerShutdown ensures shutting down the server while blocks are
+// being synced from a peer finishes processing the block in flight without
+// leaving the senders of the remaining blocks waiting, flushes the utxo set to
+// the database consistently with the best block, and sends the messages queued
+// to the peers before disconnecting them.
+func TestPeerHandlerShutdown(t *testing.T) {
+	chainServer, teardown := newTestChainRPCServer(t, "peerhandlershutdown")
+	defer teardown()
+	srcServer, srcTeardown := newTestChainRPCServer(t,
+		"peerhandlershutdownsrc")
+	defer srcTeardown()
+
+	origCfg := cfg
+	cfg = &config{DisableDNSSeed: true, MaxPeers: 8}
+	defer func() {
+		cfg = origCfg
+	}()
+
+	// Create the blocks to sync on another chain.
+	params := chainServer.cfg.ChainParams
+	blocks := newTestSyncBlocks(t, srcServer, 20)
+
+	dataDir, err := ioutil.TempDir("", "peerhandlershutdown")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := &server{
+		chain:             chainServer.cfg.Chain,
+		chainParams:       params,
+		db:                chainServer.cfg.DB,
+		addrManager:       addrmgr.New(dataDir, nil),
+		newPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		donePeers:         make(chan *serverPeer, cfg.MaxPeers),
+		banPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		query:             make(chan interface{}),
+		relayInv:          make(chan relayMsg, cfg.MaxPeers),
+		relayAddrs:        make(chan relayAddrsMsg, cfg.MaxPeers),
+		broadcast:         make(chan broadcastMsg, cfg.MaxPeers),
+		quit:              make(chan struct{}),
+		peerHeightsUpdate: make(chan updatePeerHeightsMsg),
+	}
+	s.connManager, err = connmgr.New(&connmgr.Config{
+		Dial: func(net.Addr) (net.Conn, error) {
+			return nil, errors.New("dialing is disabled")
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to create connection manager: %v", err)
+	}
+	s.syncManager, err = netsync.New(&netsync.Config{
+		PeerNotifier: s,
+		Chain:        s.chain,
+		TxMemPool:    chainServer.cfg.TxMemPool,
+		ChainParams:  params,
+		MaxPeers:     cfg.MaxPeers,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+
+	// Connect a peer to a remote node which reports the commands of the
+	// messages it receives after the handshake until it is disconnected.
+	conn, remoteConn := net.Pipe()
+	received := make(chan string, 100)
+	go func() {
+		defer close(received)
+
+		pver := wire.ProtocolVersion
+		if _, _, err := wire.ReadMessage(remoteConn, pver, params.Net); err != nil {
+			return
+		}
+		addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0,
+			wire.SFNodeNetwork)
+		versionMsg := wire.NewMsgVersion(addr, addr, 0, 0)
+		versionMsg.Services = wire.SFNodeNetwork
+		err := wire.WriteMessage(remoteConn, versionMsg, pver, params.Net)
+		if err != nil {
+			return
+		}
+		err = wire.WriteMessage(remoteConn, wire.NewMsgVerAck(), pver,
+			params.Net)
+		if err != nil {
+			return
+		}
+		for {
+			msg, _, err := wire.ReadMessage(remoteConn, pver, params.Net)
+			if err != nil {
+				return
+			}
+			received <- msg.Command()
+		}
+	}()
+	sp := newServerPeer(s, false, connTypeOutboundFullRelay)
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{ChainParams: params},
+		"10.0.0.1:18444")
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	sp.AssociateConnection(conn)
+	for start := time.Now(); !sp.VerAckReceived(); {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timeout waiting for the handshake")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.wg.Add(1)
+	go s.peerHandler()
+	s.AddPeer(sp)
+	for start := time.Now(); s.ConnectedCount() != 1; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timeout waiting for the peer to be added")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Sync the blocks from the peer and shut down the server once a few
+	// of them have been processed.
+	processed := make(chan struct{}, len(blocks))
+	go func() {
+		for _, block := range blocks {
+			done := make(chan struct{}, 1)
+			s.syncManager.QueueBlock(block, sp.Peer, done)
+			<-done
+			processed <- struct{}{}
+		}
+		close(processed)
+	}()
+	for i := 0; i < 5; i++ {
+		<-processed
+	}
+	atomic.StoreInt32(&s.shutdown, 1)
+	close(s.quit)
+	shutdown := make(chan struct{})
+	go func() {
+		s.WaitForShutdown()
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for the server to shut down")
+	}
+	for start := time.Now(); ; {
+		if _, ok := <-processed; !ok {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timeout waiting for the queued blocks to be " +
+				"released")
+		}
+	}
+
+	// The utxo set in the database is consistent with the best block.
+	best := s.chain.BestSnapshot()
+	if best.Height < 5 {
+		t.Fatalf("unexpected best height %d", best.Height)
+	}
+	if n, _ := s.chain.UtxoCacheSize(); n != 0 {
+		t.Fatalf("%d utxo cache entries were not flushed", n)
+	}
+	var consistent []byte
+	err = s.db.View(func(dbTx database.Tx) error {
+		consistent = dbTx.Metadata().Get([]byte("utxostateconsistency"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch the utxo set state: %v", err)
+	}
+	if !bytes.Equal(consistent, best.Hash[:]) {
+		t.Fatalf("utxo set is consistent with block %x, want %v",
+			consistent, best.Hash)
+	}
+
+	// The peer is disconnected after the ping queued to it on shutdown.
+	if !isTestPeerDisconnected(sp) {
+		t.Fatalf("peer was not disconnected")
+	}
+	var commands []string
+	for command := range received {
+		commands = append(commands, command)
+	}
+	if len(commands) == 0 || commands[len(commands)-1] != wire.CmdPing {
+		t.Fatalf("unexpected messages sent to the peer %v", commands)
+	}
+}
+
+// testSyncNode describes a remote node serving the blocks of its best chain to
+// a syncing peer.
+type testSyncNode struct {
+	// blocks are the blocks of the best chain after the genesis block.
+	blocks []*btcutil.Block
+
+	// limit is the number of blocks delivered after which the node goes
+	// silent.
+	limit int
+
+	// gate, when not nil, delays delivering blocks until it is closed.
+	gate <-chan struct{}
+
+	// requests receives the getblocks and getheaders messages received.
+	requests chan wire.Message
+}
+
+// newTestSyncNode returns a remote node serving the passed blocks.
+func newTestSyncNode(blocks []*btcutil.Block) *testSyncNode {
+	return &testSyncNode{
+		blocks:   blocks,
+		limit:    len(blocks),
+		requests: make(chan wire.Message, 100),
+	}
+}
+
+// serve performs the handshake with a peer over the passed connection and then
+// answers its getblocks, getheaders, and getdata messages until the connection
+// is closed.
+func (n *testSyncNode) serve(conn net.Conn, params *chaincfg.Params) {
+	defer conn.Close()
+
+	heights := make(map[chainhash.Hash]int)
+	heights[*params.GenesisHash] = -1
+	for i, block := range n.blocks {
+		heights[*block.Hash()] = i
+	}
+	locatorHeight := func(locator []*chainhash.Hash) (int, bool) {
+		for _, hash := range locator {
+			if height, ok := heights[*hash]; ok {
+				return height, true
+			}
+		}
+		return 0, false
+	}
+
+	pver := wire.ProtocolVersion
+	if _, _, err := wire.ReadMessage(conn, pver, params.Net); err != nil {
+		return
+	}
+	addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0,
+		wire.SFNodeNetwork)
+	versionMsg := wire.NewMsgVersion(addr, addr, 0, int32(len(n.blocks)))
+	versionMsg.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+	if err := wire.WriteMessage(conn, versionMsg, pver, params.Net); err != nil {
+		return
+	}
+	if err := wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, params.Net); err != nil {
+		return
+	}
+	var delivered int
+	for {
+		msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+		if err != nil {
+			return
+		}
+		var reply []wire.Message
+		switch msg := msg.(type) {
+		case *wire.MsgGetBlocks:
+			n.requests <- msg
+			height, ok := locatorHeight(msg.BlockLocatorHashes)
+			if !ok {
+				continue
+			}
+			inv := wire.NewMsgInv()
+			for _, block := range n.blocks[height+1:] {
+				inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock,
+					block.Hash()))
+			}
+			reply = append(reply, inv)
+
+		case *wire.MsgGetHeaders:
+			n.requests <- msg
+			height, ok := locatorHeight(msg.BlockLocatorHashes)
+			if !ok {
+				continue
+			}
+			headers := wire.NewMsgHeaders()
+			for _, block := range n.blocks[height+1:] {
+				if len(headers.Headers) == wire.MaxBlockHeadersPerMsg {
+					break
+				}
+				headers.AddBlockHeader(&block.MsgBlock().Header)
+				if block.Hash().IsEqual(&msg.HashStop) {
+					break
+				}
+			}
+			reply = append(reply, headers)
+
+		case *wire.MsgGetData:
+			if n.gate != nil {
+				<-n.gate
+			}
+			for _, iv := range msg.InvList {
+				height, ok := heights[iv.Hash]
+				if !ok || height < 0 || delivered >= n.limit {
+					continue
+				}
+				reply = append(reply, n.blocks[height].MsgBlock())
+				delivered++
+			}
+		}
+		for _, msg := range reply {
+			if err := wire.WriteMessage(conn, msg, pver, params.Net); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// newTestSyncBlocks returns the passed number of solved blocks created on the
+// chain of the passed server.  Unlike the blocks added directly to a chain, the
+// blocks synced from peers must be solved.
+func newTestSyncBlocks(t *testing.T, srcServer *rpcServer, n int) []*btcutil.Block {
+	t.Helper()
+
+	params := srcServer.cfg.ChainParams
+	var blocks []*btcutil.Block
+	for i := 0; i < n; i++ {
+		msgBlock := newTestChainBlock(t, srcServer)
+		for blockchain.CheckProofOfWork(btcutil.NewBlock(msgBlock),
+			params.PowLimit) != nil {
+
+			msgBlock.Header.Nonce++
+		}
+		block := btcutil.NewBlock(msgBlock)
+		_, _, err := srcServer.cfg.Chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// connectTestSyncPeer connects a peer to the passed remote node and adds it to
+// the sync manager of the passed server.  The peer is removed from the sync
+// manager once it is disconnected.  The peer queues the inventory it receives
+// directly since the inventory handler of server peers depends on the
+// configuration.
+func connectTestSyncPeer(t *testing.T, s *server, node *testSyncNode) *serverPeer {
+	t.Helper()
+
+	conn, remoteConn := net.Pipe()
+	go node.serve(remoteConn, s.chainParams)
+
+	sp := newServerPeer(s, false, connTypeOutboundFullRelay)
+	var err error
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{
+		Listeners: peer.MessageListeners{
+			OnBlock: sp.OnBlock,
+			OnInv: func(p *peer.Peer, msg *wire.MsgInv) {
+				s.syncManager.QueueInv(msg, p)
+			},
+			OnHeaders: sp.OnHeaders,
+		},
+		ChainParams: s.chainParams,
+	}, "127.0.0.1:18444")
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	sp.AssociateConnection(conn)
+	waitForTestCondition(t, "the handshake", sp.VerAckReceived)
+	s.syncManager.NewPeer(sp.Peer)
+	go func() {
+		sp.WaitForDisconnect()
+		s.syncManager.DonePeer(sp.Peer)
+	}()
+	return sp
+}
+
+// waitForTestCondition waits for the passed condition to hold and fails the
+// test when it does not within a few seconds.
+func waitForTestCondition(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for start := time.Now(); !cond(); {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestSyncPeerStall ensures a sync peer which stops delivering blocks mid-sync
+// is disconnected once the stall timeout elapses, and that the sync resumes
+// from another peer beginning after the last block received.
+func TestSyncPeerStall(t *testing.T) {
+	chainServer, teardown := newTestChainRPCServer(t, "syncpeerstall")
+	defer teardown()
+	srcServer, srcTeardown := newTestChainRPCServer(t, "syncpeerstallsrc")
+	defer srcTeardown()
+
+	blocks := newTestSyncBlocks(t, srcServer, 20)
+	s := &server{
+		chain:       chainServer.cfg.Chain,
+		chainParams: chainServer.cfg.ChainParams,
+	}
+	var err error
+	s.syncManager, err = netsync.New(&netsync.Config{
+		PeerNotifier:     testPeerNotifier{},
+		Chain:            s.chain,
+		TxMemPool:        chainServer.cfg.TxMemPool,
+		ChainParams:      s.chainParams,
+		MaxPeers:         8,
+		MaxStallDuration: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	s.syncManager.Start()
+	defer s.syncManager.Stop()
+
+	// Sync from a peer which goes silent after delivering a few blocks and
+	// connect another peer which serves all of them in the mean time.
+	stalledNode := newTestSyncNode(blocks)
+	stalledNode.limit = 5
+	stalled := connectTestSyncPeer(t, s, stalledNode)
+	waitForTestCondition(t, "the stalled peer to become the sync peer",
+		func() bool {
+			return s.syncManager.SyncPeerID() == stalled.ID()
+		})
+	waitForTestCondition(t, "the blocks of the stalled peer", func() bool {
+		return s.chain.BestSnapshot().Height == 5
+	})
+	node := newTestSyncNode(blocks)
+	sp := connectTestSyncPeer(t, s, node)
+
+	// The stalled peer is replaced by the other peer, which is asked for
+	// the blocks after the last one received, and the sync completes.
+	waitForTestCondition(t, "the stalled peer to be disconnected",
+		func() bool {
+			return isTestPeerDisconnected(stalled)
+		})
+	waitForTestCondition(t, "the other peer to become the sync peer",
+		func() bool {
+			return s.syncManager.SyncPeerID() == sp.ID()
+		})
+	select {
+	case msg := <-node.requests:
+		locator := msg.(*wire.MsgGetBlocks).BlockLocatorHashes
+		if len(locator) == 0 || *locator[0] != *blocks[4].Hash() {
+			t.Fatalf("unexpected locator - got %v, want %v", locator,
+				blocks[4].Hash())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for the blocks to be requested")
+	}
+	waitForTestCondition(t, "the sync to complete", func() bool {
+		return s.chain.BestSnapshot().Height == int32(len(blocks))
+	})
+	if isTestPeerDisconnected(sp) {
+		t.Fatalf("the sync peer was disconnected")
+	}
+}
+
+// TestSyncInvalidMaxStallDuration ensures creating a sync manager with a max
+// stall duration which is negative or too short to sample fails.
+func TestSyncInvalidMaxStallDuration(t *testing.T) {
+	chainServer, teardown := newTestChainRPCServer(t, "syncmaxstall")
+	defer teardown()
+
+	for _, duration := range []time.Duration{-time.Second, 5} {
+		_, err := netsync.New(&netsync.Config{
+			PeerNotifier:     testPeerNotifier{},
+			Chain:            chainServer.cfg.Chain,
+			TxMemPool:        chainServer.cfg.TxMemPool,
+			ChainParams:      chainServer.cfg.ChainParams,
+			MaxPeers:         8,
+			MaxStallDuration: duration,
+		})
+		if err == nil {
+			t.Fatalf("sync manager created with a max stall "+
+				"duration of %v", duration)
+		}
+	}
+}
+
+// TestParallelHeaderSync ensures the headers between the checkpoints after the
+// next one are downloaded from peers other than the sync peer in headers-first
+// mode, and that they are merged into a contiguous header chain the blocks are
+// synced along once the sync peer reaches them.
+func TestParallelHeaderSync(t *testing.T) {
+	chainServer, teardown := newTestChainRPCServer(t, "parallelheadersync")
+	defer teardown()
+	srcServer, srcTeardown := newTestChainRPCServer(t,
+		"parallelheadersyncsrc")
+	defer srcTeardown()
+
+	// Create a chain with checkpoints every ten blocks.  Headers-first mode
+	// is not used on the regression test network, so the sync manager uses
+	// a copy of its parameters.
+	blocks := newTestSyncBlocks(t, srcServer, 30)
+	var checkpoints []chaincfg.Checkpoint
+	for i := 9; i < len(blocks); i += 10 {
+		checkpoints = append(checkpoints, chaincfg.Checkpoint{
+			Height: int32(i + 1),
+			Hash:   blocks[i].Hash(),
+		})
+	}
+	if err := chainServer.cfg.Chain.FlushUtxoCache(); err != nil {
+		t.Fatalf("unable to flush utxo cache: %v", err)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          chainServer.cfg.DB,
+		ChainParams: chainServer.cfg.ChainParams,
+		Checkpoints: checkpoints,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	params := *chainServer.cfg.ChainParams
+	s := &server{
+		chain:       chain,
+		chainParams: &params,
+	}
+	s.syncManager, err = netsync.New(&netsync.Config{
+		PeerNotifier: testPeerNotifier{},
+		Chain:        s.chain,
+		TxMemPool:    chainServer.cfg.TxMemPool,
+		ChainParams:  s.chainParams,
+		MaxPeers:     8,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	s.syncManager.Start()
+	defer s.syncManager.Stop()
+
+	// Hold off the blocks of the sync peer until the other peer has served
+	// the headers between the first two checkpoints, which is the case once
+	// it is asked for the headers of the next range.
+	gate := make(chan struct{})
+	syncNode := newTestSyncNode(blocks)
+	syncNode.gate = gate
+	syncPeer := connectTestSyncPeer(t, s, syncNode)
+	waitForTestCondition(t, "the sync peer", func() bool {
+		return s.syncManager.SyncPeerID() == syncPeer.ID()
+	})
+	node := newTestSyncNode(blocks)
+	sp := connectTestSyncPeer(t, s, node)
+	for i := 0; i < 2; i++ {
+		start, end := checkpoints[i], checkpoints[i+1]
+		select {
+		case msg := <-node.requests:
+			getHeaders, ok := msg.(*wire.MsgGetHeaders)
+			if !ok || len(getHeaders.BlockLocatorHashes) != 1 ||
+				*getHeaders.BlockLocatorHashes[0] != *start.Hash ||
+				getHeaders.HashStop != *end.Hash {
+
+				t.Fatalf("unexpected request for range %d - "+
+					"got %v, want headers after %v up to %v",
+					i, msg, start.Hash, end.Hash)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for headers to be requested "+
+				"for range %d", i)
+		}
+	}
+
+	// The headers of the first range are known before its blocks are.
+	waitForTestCondition(t, "the header tip", func() bool {
+		return s.syncManager.HeaderTipHeight() >= checkpoints[1].Height
+	})
+	if height := chain.BestSnapshot().Height; height >= checkpoints[1].Height {
+		t.Fatalf("unexpected best height %d before the blocks are "+
+			"served", height)
+	}
+	close(gate)
+
+	// The blocks are synced along the merged header chain.  The sync peer
+	// is only asked for the headers up to the first checkpoint and never
+	// for those of the range which was complete by the time it got there.
+	waitForTestCondition(t, "the sync to complete", func() bool {
+		return chain.BestSnapshot().Height == int32(len(blocks))
+	})
+	if best := chain.BestSnapshot(); best.Hash != *blocks[len(blocks)-1].Hash() {
+		t.Fatalf("unexpected best block - got %v, want %v", best.Hash,
+			blocks[len(blocks)-1].Hash())
+	}
+	for height := int32(1); height <= int32(len(blocks)); height++ {
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockHashByHeight: unexpected error: %v", err)
+		}
+		if *hash != *blocks[height-1].Hash() {
+			t.Fatalf("unexpected block at height %d - got %v, "+
+				"want %v", height, hash, blocks[height-1].Hash())
+		}
+	}
+	for len(syncNode.requests) > 0 {
+		getHeaders, ok := (<-syncNode.requests).(*wire.MsgGetHeaders)
+		if ok && *getHeaders.BlockLocatorHashes[0] == *checkpoints[0].Hash {
+			t.Fatalf("the sync peer was asked for the headers which " +
+				"were already downloaded")
+		}
+	}
+	if isTestPeerDisconnected(syncPeer) || isTestPeerDisconnected(sp) {
+		t.Fatalf("a peer was disconnected")
+	}
+}
+
+// TestSyncMinimumChainWork ensures a sync peer whose headers end before the
+// next checkpoint is disconnected without its headers being added when they
+// lack the minimum chain work, while the headers are accepted and more are
+// requested when they have enough work.
+func TestSyncMinimumChainWork(t *testing.T) {
+	srcServer, srcTeardown := newTestChainRPCServer(t, "minchainworksrc")
+	defer srcTeardown()
+	blocks := newTestSyncBlocks(t, srcServer, 20)
+	blockWork := blockchain.CalcWork(blocks[0].MsgBlock().Header.Bits)
+
+	tests := []struct {
+		name       string
+		minWork    *big.Int
+		disconnect bool
+	}{{
+		name:       "insufficient work",
+		minWork:    new(big.Int).Mul(blockWork, big.NewInt(100)),
+		disconnect: true,
+	}, {
+		name:       "sufficient work",
+		minWork:    new(big.Int).Mul(blockWork, big.NewInt(10)),
+		disconnect: false,
+	}}
+	for _, test := range tests {
+		chainServer, teardown := newTestChainRPCServer(t, "minchainwork")
+		defer teardown()
+
+		// Use a checkpoint after the blocks of the peer so it is synced
+		// in headers-first mode and runs out of headers before reaching
+		// the checkpoint.  Headers-first mode is not used on the
+		// regression test network, so the sync manager uses a copy of
+		// its parameters.
+		if err := chainServer.cfg.Chain.FlushUtxoCache(); err != nil {
+			t.Fatalf("unable to flush utxo cache: %v", err)
+		}
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:          chainServer.cfg.DB,
+			ChainParams: chainServer.cfg.ChainParams,
+			Checkpoints: []chaincfg.Checkpoint{{
+				Height: int32(len(blocks) + 10),
+				Hash:   &chainhash.Hash{0x01},
+			}},
+			MinimumChainWork: test.minWork,
+			TimeSource:       blockchain.NewMedianTime(),
+		})
+		if err != nil {
+			t.Fatalf("%s: unable to create chain: %v", test.name, err)
+		}
+		params := *chainServer.cfg.ChainParams
+		s := &server{
+			chain:       chain,
+			chainParams: &params,
+		}
+		s.syncManager, err = netsync.New(&netsync.Config{
+			PeerNotifier: testPeerNotifier{},
+			Chain:        s.chain,
+			TxMemPool:    chainServer.cfg.TxMemPool,
+			ChainParams:  s.chainParams,
+			MaxPeers:     8,
+		})
+		if err != nil {
+			t.Fatalf("%s: unable to create sync manager: %v",
+				test.name, err)
+		}
+		s.syncManager.Start()
+
+		node := newTestSyncNode(blocks)
+		sp := connectTestSyncPeer(t, s, node)
+		if test.disconnect {
+			waitForTestCondition(t, "the peer to be disconnected",
+				func() bool {
+					return isTestPeerDisconnected(sp)
+				})
+			s.syncManager.Stop()
+			continue
+		}
+
+		// The headers are accepted, so the next headers are requested
+		// starting after the last one.
+		lastHash := blocks[len(blocks)-1].Hash()
+		for i := 0; i < 2; i++ {
+			select {
+			case msg := <-node.requests:
+				getHeaders, ok := msg.(*wire.MsgGetHeaders)
+				if !ok {
+					t.Fatalf("%s: unexpected request %v",
+						test.name, msg)
+				}
+				locator := getHeaders.BlockLocatorHashes
+				if i == 1 && (len(locator) == 0 ||
+					*locator[0] != *lastHash) {
+
+					t.Fatalf("%s: unexpected locator - got "+
+						"%v, want %v", test.name,
+						locator, lastHash)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: timeout waiting for headers to be "+
+					"requested", test.name)
+			}
+		}
+		if isTestPeerDisconnected(sp) {
+			t.Fatalf("%s: the peer was disconnected", test.name)
+		}
+		sp.Disconnect()
+		s.syncManager.Stop()
+	}
+}
+
+// TestIndexCatchUpDelivery ensures the catch up progress of the indexes which
+// is reported before the RPC server is started is delivered to it once it is
+// and that progress reported afterwards is delivered directly.
+func TestIndexCatchUpDelivery(t *testing.T) {
+	// Report progress before there is an RPC server like the index manager
+	// does while the chain is loaded.
+	s := &server{}
+	reports := []indexers.CatchUpProgress{
+		{Index: "txindex", Height: 0, TargetHeight: 10000},
+		{Index: "cfindex", Height: 0, TargetHeight: 10000},
+		{Index: "txindex", Height: 5000, TargetHeight: 10000, Percent: 50},
+	}
+	for i := range reports {
+		s.handleIndexCatchUp(&reports[i])
+	}
+
+	// Only the latest progress of each index is expected to be delivered
+	// once the RPC server is started.
+	s.rpcServer = &rpcServer{}
+	s.rpcServer.ntfnMgr = newWsNotificationManager(s.rpcServer)
+	go s.deliverIndexCatchUp()
+	receive := func() indexers.CatchUpProgress {
+		t.Helper()
+		select {
+		case n := <-s.rpcServer.ntfnMgr.queueNotification:
+			ntfn, ok := n.(*notificationIndexCatchUp)
+			if !ok {
+				t.Fatalf("unexpected notification %T", n)
+			}
+			return indexers.CatchUpProgress(*ntfn)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for catch up notification")
+		}
+		return indexers.CatchUpProgress{}
+	}
+	for _, want := range []indexers.CatchUpProgress{reports[2], reports[1]} {
+		if got := receive(); got != want {
+			t.Fatalf("unexpected progress -- got %+v, want %+v", got,
+				want)
+		}
+	}
+
+	// Progress reported after the RPC server started is relayed directly.
+	done := &indexers.CatchUpProgress{Index: "txindex", Height: 10000,
+		TargetHeight: 10000, Percent: 100}
+	go s.handleIndexCatchUp(done)
+	if got := receive(); got != *done {
+		t.Fatalf("unexpected progress -- got %+v, want %+v", got, *done)
+	}
+}
@@ -68,6 +68,15 @@ func (h *HashCache) ContainsHashes(txid *chainhash.Hash) bool {
 	return found
 }
 
+// Len returns the number of transactions with partial sighashes in the
+// HashCache.
+func (h *HashCache) Len() int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return len(h.sigHashes)
+}
+
 // GetSigHashes possibly returns the previously cached partial sighashes for
 // the passed transaction. This function also returns an additional boolean
 // value indicating if the sighashes for the passed transaction were found to
@@ -0,0 +1,26 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package policy implements compiling spending policies, which are expressions
+combining key checks and timelocks, into witness scripts and deriving the P2WSH
+addresses that pay to them.
+
+It supports a small subset of the policy language of miniscript:
+
+	pk(KEY)            a signature of the hex encoded compressed public key KEY
+	after(N)           a transaction lock time of at least N, which is a block
+	                   height below 500000000 and a timestamp otherwise
+	and(X,Y)           both X and Y are satisfied
+	or(X,Y)            either X or Y is satisfied
+	thresh(K,pk(..))   signatures of K of the listed keys
+
+The arguments of thresh are limited to keys since it is compiled to
+OP_CHECKMULTISIG.  Policies are compiled directly rather than to miniscript, so
+the resulting scripts are not guaranteed to be the smallest possible ones.
+
+Once compiled, a policy can also produce the witness which spends outputs paying
+to it from the signatures and the lock time of the spending transaction.
+*/
+package policy
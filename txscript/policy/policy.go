@@ -0,0 +1,430 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// maxLockTime is the maximum lock time after may require since lock
+	// times are interpreted as signed 32-bit script numbers by
+	// OP_CHECKLOCKTIMEVERIFY.
+	maxLockTime = 1<<31 - 1
+
+	// maxThreshKeys is the maximum number of keys of a threshold, which is
+	// compiled to OP_CHECKMULTISIG.
+	maxThreshKeys = txscript.MaxPubKeysPerMultiSig
+)
+
+// nodeType identifies the kind of expression of a node of a policy.
+type nodeType int
+
+// These constants define the kinds of expressions a policy is built from.
+const (
+	nodePk nodeType = iota
+	nodeAfter
+	nodeAnd
+	nodeOr
+	nodeThresh
+)
+
+// node is an expression of a policy.
+type node struct {
+	typ      nodeType
+	key      *btcec.PublicKey // nodePk
+	lockTime uint32           // nodeAfter
+	k        int              // nodeThresh
+	subs     []*node          // nodeAnd, nodeOr, and nodeThresh
+}
+
+// Policy is a parsed spending policy which is compiled to a witness script.
+type Policy struct {
+	root   *node
+	script []byte
+}
+
+// Parse parses a policy expression and compiles it to a witness script.  See
+// the package documentation for the supported expressions.
+func Parse(policy string) (*Policy, error) {
+	p := &parser{s: policy}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected trailing characters")
+	}
+
+	script, err := compile(root, false).Script()
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{root: root, script: script}, nil
+}
+
+// String returns the policy expression in its canonical form.
+func (p *Policy) String() string {
+	return p.root.String()
+}
+
+// WitnessScript returns the witness script the policy compiles to.
+func (p *Policy) WitnessScript() []byte {
+	return append([]byte(nil), p.script...)
+}
+
+// Address returns the P2WSH address of the witness script the policy compiles
+// to for the passed network.
+func (p *Policy) Address(params *chaincfg.Params) (*btcutil.AddressWitnessScriptHash, error) {
+	scriptHash := sha256.Sum256(p.script)
+	return btcutil.NewAddressWitnessScriptHash(scriptHash[:], params)
+}
+
+// String returns the expression of the node in its canonical form.
+func (n *node) String() string {
+	var args []string
+	switch n.typ {
+	case nodePk:
+		return "pk(" + hex.EncodeToString(n.key.SerializeCompressed()) + ")"
+	case nodeAfter:
+		return "after(" + strconv.FormatUint(uint64(n.lockTime), 10) + ")"
+	case nodeThresh:
+		args = append(args, strconv.Itoa(n.k))
+	}
+	for _, sub := range n.subs {
+		args = append(args, sub.String())
+	}
+	names := map[nodeType]string{nodeAnd: "and", nodeOr: "or",
+		nodeThresh: "thresh"}
+	return names[n.typ] + "(" + strings.Join(args, ",") + ")"
+}
+
+// parser parses policy expressions.
+type parser struct {
+	s   string
+	pos int
+}
+
+// errorf returns an error describing a problem at the current position.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("policy: "+format+" at position %d",
+		append(args, p.pos)...)
+}
+
+// skipSpace advances past any whitespace.
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// token returns the next identifier or number and advances past it.
+func (p *parser) token() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("(), \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// expect advances past the passed character or returns an error when it is not
+// next.
+func (p *parser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != c {
+		return p.errorf("expected '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+// parseExpr parses an expression along with all of its arguments.
+func (p *parser) parseExpr() (*node, error) {
+	name := p.token()
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var n *node
+	switch name {
+	case "pk":
+		arg := p.token()
+		pubKey, err := hex.DecodeString(arg)
+		if err != nil || len(pubKey) != btcec.PubKeyBytesLenCompressed {
+			return nil, p.errorf("invalid compressed public key %q",
+				arg)
+		}
+		key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+		if err != nil {
+			return nil, p.errorf("invalid public key %q: %v", arg,
+				err)
+		}
+		n = &node{typ: nodePk, key: key}
+
+	case "after":
+		arg := p.token()
+		lockTime, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil || lockTime == 0 || lockTime > maxLockTime {
+			return nil, p.errorf("invalid lock time %q", arg)
+		}
+		n = &node{typ: nodeAfter, lockTime: uint32(lockTime)}
+
+	case "and", "or":
+		typ := nodeAnd
+		if name == "or" {
+			typ = nodeOr
+		}
+		subs, err := p.parseSubExprs()
+		if err != nil {
+			return nil, err
+		}
+		if len(subs) != 2 {
+			return nil, p.errorf("%s requires 2 arguments, got %d",
+				name, len(subs))
+		}
+		n = &node{typ: typ, subs: subs}
+
+	case "thresh":
+		arg := p.token()
+		k, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, p.errorf("invalid threshold %q", arg)
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		subs, err := p.parseSubExprs()
+		if err != nil {
+			return nil, err
+		}
+		if k < 1 || k > len(subs) || len(subs) > maxThreshKeys {
+			return nil, p.errorf("invalid threshold %d of %d", k,
+				len(subs))
+		}
+		for _, sub := range subs {
+			if sub.typ != nodePk {
+				return nil, p.errorf("thresh only supports pk " +
+					"arguments")
+			}
+		}
+		n = &node{typ: nodeThresh, k: k, subs: subs}
+
+	default:
+		return nil, p.errorf("unknown expression %q", name)
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// parseSubExprs parses a comma separated list of expressions up to, but not
+// including, the closing parenthesis of the expression they are arguments of.
+func (p *parser) parseSubExprs() ([]*node, error) {
+	var subs []*node
+	for {
+		sub, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != ',' {
+			return subs, nil
+		}
+		p.pos++
+	}
+}
+
+// compile adds the script of the passed node to a new script builder.  The
+// script leaves a single true value on the stack when it is satisfied unless
+// verify is set, in which case it leaves nothing.  Scripts which aren't
+// satisfied fail.
+func compile(n *node, verify bool) *txscript.ScriptBuilder {
+	builder := txscript.NewScriptBuilder()
+	compileTo(builder, n, verify)
+	return builder
+}
+
+// compileTo adds the script of the passed node to the passed builder.  See
+// compile for the meaning of verify.
+func compileTo(builder *txscript.ScriptBuilder, n *node, verify bool) {
+	switch n.typ {
+	case nodePk:
+		builder.AddData(n.key.SerializeCompressed())
+		if verify {
+			builder.AddOp(txscript.OP_CHECKSIGVERIFY)
+		} else {
+			builder.AddOp(txscript.OP_CHECKSIG)
+		}
+
+	case nodeAfter:
+		// OP_CHECKLOCKTIMEVERIFY leaves the lock time on the stack,
+		// which is true since it is never zero.
+		builder.AddInt64(int64(n.lockTime))
+		builder.AddOp(txscript.OP_CHECKLOCKTIMEVERIFY)
+		if verify {
+			builder.AddOp(txscript.OP_VERIFY)
+		}
+
+	case nodeAnd:
+		compileTo(builder, n.subs[0], true)
+		compileTo(builder, n.subs[1], verify)
+
+	case nodeOr:
+		builder.AddOp(txscript.OP_IF)
+		compileTo(builder, n.subs[0], verify)
+		builder.AddOp(txscript.OP_ELSE)
+		compileTo(builder, n.subs[1], verify)
+		builder.AddOp(txscript.OP_ENDIF)
+
+	case nodeThresh:
+		builder.AddInt64(int64(n.k))
+		for _, sub := range n.subs {
+			builder.AddData(sub.key.SerializeCompressed())
+		}
+		builder.AddInt64(int64(len(n.subs)))
+		if verify {
+			builder.AddOp(txscript.OP_CHECKMULTISIGVERIFY)
+		} else {
+			builder.AddOp(txscript.OP_CHECKMULTISIG)
+		}
+	}
+}
+
+// Satisfier provides the data available to satisfy a policy.
+type Satisfier struct {
+	// Signature returns the signature, with the signature hash type
+	// appended, of the passed key for the input being spent or nil when
+	// there is none.
+	Signature func(pubKey *btcec.PublicKey) []byte
+
+	// LockTime is the lock time of the spending transaction.  The sequence
+	// of the input being spent must not be final for the lock times the
+	// policy requires to be satisfied.
+	LockTime uint32
+}
+
+// ErrUnsatisfiable is returned by Witness when the data of the satisfier can't
+// satisfy the policy.
+var ErrUnsatisfiable = errors.New("policy: unable to satisfy policy")
+
+// Witness returns the witness which spends an output of the P2WSH address of
+// the policy using the data of the passed satisfier.  Of the possible ways to
+// satisfy the policy, the one with the smallest witness is chosen.
+func (p *Policy) Witness(s *Satisfier) (wire.TxWitness, error) {
+	stack, ok := satisfy(p.root, s)
+	if !ok {
+		return nil, ErrUnsatisfiable
+	}
+	return append(stack, p.WitnessScript()), nil
+}
+
+// lockTimeSatisfied returns whether or not the passed lock time of a
+// transaction satisfies the passed required lock time, which requires them to
+// both be block heights or both be timestamps.
+func lockTimeSatisfied(txLockTime, required uint32) bool {
+	if (txLockTime < txscript.LockTimeThreshold) !=
+		(required < txscript.LockTimeThreshold) {
+
+		return false
+	}
+	return txLockTime >= required
+}
+
+// witnessSize returns the serialized size of the passed witness items.
+func witnessSize(stack [][]byte) int {
+	var size int
+	for _, item := range stack {
+		size += wire.VarIntSerializeSize(uint64(len(item))) + len(item)
+	}
+	return size
+}
+
+// satisfy returns the witness items, ordered from the bottom of the stack to
+// its top, which satisfy the passed node, and whether or not it could be
+// satisfied.
+func satisfy(n *node, s *Satisfier) ([][]byte, bool) {
+	switch n.typ {
+	case nodePk:
+		sig := s.Signature(n.key)
+		if sig == nil {
+			return nil, false
+		}
+		return [][]byte{sig}, true
+
+	case nodeAfter:
+		return [][]byte{}, lockTimeSatisfied(s.LockTime, n.lockTime)
+
+	case nodeAnd:
+		// The first argument is executed first, so its items are on
+		// top of those of the second one.
+		first, ok := satisfy(n.subs[0], s)
+		if !ok {
+			return nil, false
+		}
+		second, ok := satisfy(n.subs[1], s)
+		if !ok {
+			return nil, false
+		}
+		return append(second, first...), true
+
+	case nodeOr:
+		// The first argument is executed when the top item is true and
+		// the second one when it is empty, which is the only false
+		// value allowed by the minimal if rule.
+		first, firstOk := satisfy(n.subs[0], s)
+		second, secondOk := satisfy(n.subs[1], s)
+		if firstOk {
+			first = append(first, []byte{1})
+		}
+		if secondOk {
+			second = append(second, nil)
+		}
+		switch {
+		case firstOk && secondOk:
+			if witnessSize(second) < witnessSize(first) {
+				return second, true
+			}
+			return first, true
+		case firstOk:
+			return first, true
+		case secondOk:
+			return second, true
+		}
+		return nil, false
+
+	case nodeThresh:
+		// OP_CHECKMULTISIG consumes an extra empty item and requires
+		// the signatures in the order of the keys.
+		stack := [][]byte{nil}
+		for _, sub := range n.subs {
+			if len(stack) == n.k+1 {
+				break
+			}
+			if sig := s.Signature(sub.key); sig != nil {
+				stack = append(stack, sig)
+			}
+		}
+		return stack, len(stack) == n.k+1
+	}
+
+	return nil, false
+}
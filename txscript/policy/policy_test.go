@@ -0,0 +1,311 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testKeys returns deterministic private keys for tests along with the hex
+// encoding of their compressed public keys.
+func testKeys(n int) ([]*btcec.PrivateKey, []string) {
+	keys := make([]*btcec.PrivateKey, n)
+	pubKeys := make([]string, n)
+	for i := range keys {
+		keys[i], _ = btcec.PrivKeyFromBytes(btcec.S256(), []byte{byte(i + 1)})
+		pubKeys[i] = hex.EncodeToString(keys[i].PubKey().SerializeCompressed())
+	}
+	return keys, pubKeys
+}
+
+// TestCompile ensures a known policy compiles to the expected witness script
+// and P2WSH address, and that its canonical form parses to the same policy.
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	keys, pubKeys := testKeys(2)
+	p, err := Parse(" or( pk(" + pubKeys[0] + "), and(pk(" + pubKeys[1] +
+		"),after(100)) )")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+
+	want, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddData(keys[0].PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIG).
+		AddOp(txscript.OP_ELSE).
+		AddData(keys[1].PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIGVERIFY).
+		AddInt64(100).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_ENDIF).
+		Script()
+	if err != nil {
+		t.Fatalf("failed to build expected script: %v", err)
+	}
+	if script := p.WitnessScript(); !bytes.Equal(script, want) {
+		t.Fatalf("unexpected witness script: got %x, want %x", script,
+			want)
+	}
+
+	addr, err := p.Address(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Address: unexpected error: %v", err)
+	}
+	wantHash := chainhash.HashB(want)
+	if !bytes.Equal(addr.ScriptAddress(), wantHash) {
+		t.Fatalf("unexpected address %v", addr)
+	}
+
+	canonical := "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] +
+		"),after(100)))"
+	if p.String() != canonical {
+		t.Fatalf("unexpected canonical form: got %s, want %s",
+			p.String(), canonical)
+	}
+	reparsed, err := Parse(canonical)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error for canonical form: %v", err)
+	}
+	if !bytes.Equal(reparsed.WitnessScript(), want) {
+		t.Fatal("canonical form compiled to a different script")
+	}
+}
+
+// TestSpend ensures the witnesses produced for compiled policies spend outputs
+// paying to them exactly when the intended conditions are met.
+func TestSpend(t *testing.T) {
+	t.Parallel()
+
+	keys, pubKeys := testKeys(3)
+	const amt = 100000
+
+	tests := []struct {
+		name     string
+		policy   string
+		signers  []int
+		lockTime uint32
+		valid    bool
+	}{{
+		name:    "or: first key",
+		policy:  "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] + "),after(100)))",
+		signers: []int{0},
+		valid:   true,
+	}, {
+		name:     "or: second key before lock time",
+		policy:   "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] + "),after(100)))",
+		signers:  []int{1},
+		lockTime: 99,
+	}, {
+		name:     "or: second key after lock time",
+		policy:   "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] + "),after(100)))",
+		signers:  []int{1},
+		lockTime: 100,
+		valid:    true,
+	}, {
+		name:     "or: timestamp lock time for height",
+		policy:   "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] + "),after(100)))",
+		signers:  []int{1},
+		lockTime: txscript.LockTimeThreshold,
+	}, {
+		name:     "or: unknown key",
+		policy:   "or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] + "),after(100)))",
+		signers:  []int{2},
+		lockTime: 100,
+	}, {
+		name:    "and: both keys",
+		policy:  "and(pk(" + pubKeys[0] + "),pk(" + pubKeys[1] + "))",
+		signers: []int{0, 1},
+		valid:   true,
+	}, {
+		name:    "and: one key",
+		policy:  "and(pk(" + pubKeys[0] + "),pk(" + pubKeys[1] + "))",
+		signers: []int{1},
+	}, {
+		name: "thresh: 2-of-3",
+		policy: "thresh(2,pk(" + pubKeys[0] + "),pk(" + pubKeys[1] +
+			"),pk(" + pubKeys[2] + "))",
+		signers: []int{0, 2},
+		valid:   true,
+	}, {
+		name: "thresh: 1-of-3",
+		policy: "thresh(2,pk(" + pubKeys[0] + "),pk(" + pubKeys[1] +
+			"),pk(" + pubKeys[2] + "))",
+		signers: []int{1},
+	}, {
+		name: "nested thresh and timelock",
+		policy: "or(thresh(2,pk(" + pubKeys[0] + "),pk(" + pubKeys[1] +
+			"),pk(" + pubKeys[2] + ")),and(after(500000100),pk(" +
+			pubKeys[2] + ")))",
+		signers:  []int{2},
+		lockTime: 500000100,
+		valid:    true,
+	}}
+
+	for _, test := range tests {
+		p, err := Parse(test.policy)
+		if err != nil {
+			t.Fatalf("%s: Parse: unexpected error: %v", test.name, err)
+		}
+		addr, err := p.Address(&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: Address: unexpected error: %v", test.name, err)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("%s: PayToAddrScript: unexpected error: %v",
+				test.name, err)
+		}
+
+		// The sequence of the input is not final so the lock time of the
+		// transaction is enforced.
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}},
+			Sequence:         wire.MaxTxInSequenceNum - 1,
+		})
+		tx.AddTxOut(wire.NewTxOut(amt/2, pkScript))
+		tx.LockTime = test.lockTime
+		sigHashes := txscript.NewTxSigHashes(tx)
+
+		signers := make(map[string]*btcec.PrivateKey)
+		for _, i := range test.signers {
+			signers[pubKeys[i]] = keys[i]
+		}
+		s := &Satisfier{
+			Signature: func(pubKey *btcec.PublicKey) []byte {
+				key := signers[hex.EncodeToString(
+					pubKey.SerializeCompressed())]
+				if key == nil {
+					return nil
+				}
+				sig, err := txscript.RawTxInWitnessSignature(tx,
+					sigHashes, 0, amt, p.WitnessScript(),
+					txscript.SigHashAll, key)
+				if err != nil {
+					t.Fatalf("%s: failed to sign: %v", test.name,
+						err)
+				}
+				return sig
+			},
+			LockTime: test.lockTime,
+		}
+		witness, err := p.Witness(s)
+		if !test.valid {
+			if err != ErrUnsatisfiable {
+				t.Errorf("%s: Witness: unexpected error: got %v, "+
+					"want %v", test.name, err, ErrUnsatisfiable)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Witness: unexpected error: %v", test.name, err)
+		}
+
+		tx.TxIn[0].Witness = witness
+		vm, err := txscript.NewEngine(pkScript, tx, 0,
+			txscript.StandardVerifyFlags, nil, sigHashes, amt)
+		if err != nil {
+			t.Fatalf("%s: NewEngine: unexpected error: %v", test.name,
+				err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("%s: witness failed to spend output: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestInvalidSpend ensures the witness scripts compiled for policies enforce
+// their conditions even when fed witnesses which bypass the satisfier.
+func TestInvalidSpend(t *testing.T) {
+	t.Parallel()
+
+	keys, pubKeys := testKeys(2)
+	const amt = 100000
+	p, err := Parse("or(pk(" + pubKeys[0] + "),and(pk(" + pubKeys[1] +
+		"),after(100)))")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	addr, err := p.Address(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Address: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+
+	// Take the timelocked branch with a valid signature before the lock
+	// time and the first branch with the signature of the wrong key.
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}},
+		Sequence:         wire.MaxTxInSequenceNum - 1,
+	})
+	tx.AddTxOut(wire.NewTxOut(amt/2, pkScript))
+	tx.LockTime = 99
+	sigHashes := txscript.NewTxSigHashes(tx)
+	sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, 0, amt,
+		p.WitnessScript(), txscript.SigHashAll, keys[1])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	witnesses := []wire.TxWitness{
+		{sig, nil, p.WitnessScript()},
+		{sig, []byte{1}, p.WitnessScript()},
+	}
+	for i, witness := range witnesses {
+		tx.TxIn[0].Witness = witness
+		vm, err := txscript.NewEngine(pkScript, tx, 0,
+			txscript.StandardVerifyFlags, nil, sigHashes, amt)
+		if err != nil {
+			t.Fatalf("#%d: NewEngine: unexpected error: %v", i, err)
+		}
+		if err := vm.Execute(); err == nil {
+			t.Errorf("#%d: invalid witness spent output", i)
+		}
+	}
+}
+
+// TestParseErrors ensures invalid policies are rejected.
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	_, pubKeys := testKeys(2)
+	pk := "pk(" + pubKeys[0] + ")"
+	tests := []string{
+		"",
+		"pk()",
+		"pk(00)",
+		"pk(04" + pubKeys[0][2:] + ")",
+		"after(0)",
+		"after(2147483648)",
+		"after(-1)",
+		"and(" + pk + ")",
+		"or(" + pk + "," + pk + "," + pk + ")",
+		"thresh(0," + pk + ")",
+		"thresh(2," + pk + ")",
+		"thresh(1,after(100))",
+		"sha256(00)",
+		pk + "x",
+		"or(" + pk + "," + pk,
+	}
+	for _, test := range tests {
+		if _, err := Parse(test); err == nil {
+			t.Errorf("Parse(%q): did not receive expected error", test)
+		}
+	}
+}
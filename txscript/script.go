@@ -35,6 +35,35 @@ const (
 	sigHashMask = 0x1f
 )
 
+// BaseType returns the signature hash mode of the hash type, which identifies
+// the outputs that are signed, without the SigHashAnyOneCanPay flag.  Consensus
+// treats undefined modes like SigHashAll, so SigHashAll is returned for them.
+func (t SigHashType) BaseType() SigHashType {
+	switch t & sigHashMask {
+	case SigHashNone:
+		return SigHashNone
+	case SigHashSingle:
+		return SigHashSingle
+	default:
+		return SigHashAll
+	}
+}
+
+// AnyoneCanPay returns whether or not the hash type has the SigHashAnyOneCanPay
+// flag set, which means only the input being signed is committed to rather than
+// all of the inputs of the transaction.
+func (t SigHashType) AnyoneCanPay() bool {
+	return t&SigHashAnyOneCanPay != 0
+}
+
+// IsStrictEncoding returns whether or not the hash type is one of SigHashAll,
+// SigHashNone, and SigHashSingle, optionally combined with SigHashAnyOneCanPay,
+// which are the only hash types allowed by the strict encoding rules.
+func (t SigHashType) IsStrictEncoding() bool {
+	baseType := t & ^SigHashAnyOneCanPay
+	return baseType >= SigHashAll && baseType <= SigHashSingle
+}
+
 // These are the constants specified for maximums in individual scripts.
 const (
 	MaxOpsPerScript       = 201 // Max number of non-push operations.
@@ -460,7 +489,8 @@ func calcWitnessSignatureHash(subScript []parsedOpcode, sigHashes *TxSigHashes,
 
 	// If anyone can pay isn't active, then we can use the cached
 	// hashPrevOuts, otherwise we just write zeroes for the prev outs.
-	if hashType&SigHashAnyOneCanPay == 0 {
+	baseType := hashType.BaseType()
+	if !hashType.AnyoneCanPay() {
 		sigHash.Write(sigHashes.HashPrevOuts[:])
 	} else {
 		sigHash.Write(zeroHash[:])
@@ -469,9 +499,7 @@ func calcWitnessSignatureHash(subScript []parsedOpcode, sigHashes *TxSigHashes,
 	// If the sighash isn't anyone can pay, single, or none, the use the
 	// cached hash sequences, otherwise write all zeroes for the
 	// hashSequence.
-	if hashType&SigHashAnyOneCanPay == 0 &&
-		hashType&sigHashMask != SigHashSingle &&
-		hashType&sigHashMask != SigHashNone {
+	if !hashType.AnyoneCanPay() && baseType == SigHashAll {
 		sigHash.Write(sigHashes.HashSequence[:])
 	} else {
 		sigHash.Write(zeroHash[:])
@@ -517,10 +545,13 @@ func calcWitnessSignatureHash(subScript []parsedOpcode, sigHashes *TxSigHashes,
 	// re-use the pre-generated hashoutputs sighash fragment. Otherwise,
 	// we'll serialize and add only the target output index to the signature
 	// pre-image.
-	if hashType&SigHashSingle != SigHashSingle &&
-		hashType&SigHashNone != SigHashNone {
+	//
+	// Unlike the original signature hash algorithm, a SigHashSingle input
+	// without a corresponding output doesn't sign a hash of 1, but commits
+	// to no outputs at all like SigHashNone.
+	if baseType == SigHashAll {
 		sigHash.Write(sigHashes.HashOutputs[:])
-	} else if hashType&sigHashMask == SigHashSingle && idx < len(tx.TxOut) {
+	} else if baseType == SigHashSingle && idx < len(tx.TxOut) {
 		var b bytes.Buffer
 		wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx])
 		sigHash.Write(chainhash.DoubleHashB(b.Bytes()))
@@ -617,7 +648,8 @@ func calcSignatureHash(script []parsedOpcode, hashType SigHashType, tx *wire.Msg
 	// hash of 1.  This in turn presents an opportunity for attackers to
 	// cleverly construct transactions which can steal those coins provided
 	// they can reuse signatures.
-	if hashType&sigHashMask == SigHashSingle && idx >= len(tx.TxOut) {
+	baseType := hashType.BaseType()
+	if baseType == SigHashSingle && idx >= len(tx.TxOut) {
 		var hash chainhash.Hash
 		hash[0] = 0x01
 		return hash[:]
@@ -640,7 +672,7 @@ func calcSignatureHash(script []parsedOpcode, hashType SigHashType, tx *wire.Msg
 		}
 	}
 
-	switch hashType & sigHashMask {
+	switch baseType {
 	case SigHashNone:
 		txCopy.TxOut = txCopy.TxOut[0:0] // Empty slice.
 		for i := range txCopy.TxIn {
@@ -666,16 +698,12 @@ func calcSignatureHash(script []parsedOpcode, hashType SigHashType, tx *wire.Msg
 			}
 		}
 
-	default:
-		// Consensus treats undefined hashtypes like normal SigHashAll
-		// for purposes of hash generation.
-		fallthrough
-	case SigHashOld:
-		fallthrough
 	case SigHashAll:
-		// Nothing special here.
+		// Nothing special here.  Consensus treats SigHashOld and the
+		// undefined hashtypes like normal SigHashAll for purposes of
+		// hash generation.
 	}
-	if hashType&SigHashAnyOneCanPay != 0 {
+	if hashType.AnyoneCanPay() {
 		txCopy.TxIn = txCopy.TxIn[idx : idx+1]
 	}
 
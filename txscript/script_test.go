@@ -4312,3 +4312,175 @@ func TestIsUnspendable(t *testing.T) {
 		}
 	}
 }
+
+// TestSigHashType ensures the base signature hash mode, the anyone can pay
+// flag, and the strict encoding of hash types are reported correctly.
+func TestSigHashType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		hashType     SigHashType
+		baseType     SigHashType
+		anyoneCanPay bool
+		strict       bool
+	}{
+		{SigHashOld, SigHashAll, false, false},
+		{SigHashAll, SigHashAll, false, true},
+		{SigHashNone, SigHashNone, false, true},
+		{SigHashSingle, SigHashSingle, false, true},
+		{SigHashAll | SigHashAnyOneCanPay, SigHashAll, true, true},
+		{SigHashNone | SigHashAnyOneCanPay, SigHashNone, true, true},
+		{SigHashSingle | SigHashAnyOneCanPay, SigHashSingle, true, true},
+		{SigHashAnyOneCanPay, SigHashAll, true, false},
+		{0x04, SigHashAll, false, false},
+		{0x06, SigHashAll, false, false},
+		{0x07, SigHashAll, false, false},
+		{0x22, SigHashNone, false, false},
+		{0x43, SigHashSingle, false, false},
+		{0x86, SigHashAll, true, false},
+	}
+	for _, test := range tests {
+		if got := test.hashType.BaseType(); got != test.baseType {
+			t.Errorf("0x%x: unexpected base type - got 0x%x, want "+
+				"0x%x", uint32(test.hashType), uint32(got),
+				uint32(test.baseType))
+		}
+		if got := test.hashType.AnyoneCanPay(); got != test.anyoneCanPay {
+			t.Errorf("0x%x: unexpected anyone can pay - got %v, "+
+				"want %v", uint32(test.hashType), got,
+				test.anyoneCanPay)
+		}
+		if got := test.hashType.IsStrictEncoding(); got != test.strict {
+			t.Errorf("0x%x: unexpected strict encoding - got %v, "+
+				"want %v", uint32(test.hashType), got, test.strict)
+		}
+	}
+}
+
+// TestSignatureHashCommitments ensures the original and the BIP0143 signature
+// hash algorithms commit to the same parts of a transaction for every
+// combination of signature hash mode and the anyone can pay flag, including
+// undefined modes which are treated like SigHashAll, and that they handle a
+// SigHashSingle input without a corresponding output as specified.
+func TestSignatureHashCommitments(t *testing.T) {
+	t.Parallel()
+
+	script := []byte{OP_TRUE}
+	const amt = 5000
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{
+			{PreviousOutPoint: wire.OutPoint{Index: 0}, Sequence: 1},
+			{PreviousOutPoint: wire.OutPoint{Index: 1}, Sequence: 2},
+			{PreviousOutPoint: wire.OutPoint{Index: 2}, Sequence: 3},
+		},
+		TxOut: []*wire.TxOut{
+			{Value: 1000, PkScript: []byte{OP_TRUE}},
+			{Value: 2000, PkScript: []byte{OP_TRUE}},
+		},
+	}
+
+	// sigHashes returns the original and the BIP0143 signature hashes of
+	// the passed input.
+	sigHashes := func(tx *wire.MsgTx, hashType SigHashType, idx int) ([]byte, []byte) {
+		t.Helper()
+
+		legacy, err := CalcSignatureHash(script, hashType, tx, idx)
+		if err != nil {
+			t.Fatalf("CalcSignatureHash: unexpected error: %v", err)
+		}
+		witness, err := CalcWitnessSigHash(script, NewTxSigHashes(tx),
+			hashType, tx, idx, amt)
+		if err != nil {
+			t.Fatalf("CalcWitnessSigHash: unexpected error: %v", err)
+		}
+		return legacy, witness
+	}
+
+	// Each mutation changes a part of the transaction other than the input
+	// being signed.  The signature hash must only change when the hash
+	// type commits to that part.
+	mutations := []struct {
+		name    string
+		mutate  func(tx *wire.MsgTx)
+		commits func(hashType SigHashType) bool
+	}{{
+		name:   "other input outpoint",
+		mutate: func(tx *wire.MsgTx) { tx.TxIn[1].PreviousOutPoint.Index++ },
+		commits: func(hashType SigHashType) bool {
+			return !hashType.AnyoneCanPay()
+		},
+	}, {
+		name:   "other input sequence",
+		mutate: func(tx *wire.MsgTx) { tx.TxIn[1].Sequence++ },
+		commits: func(hashType SigHashType) bool {
+			return !hashType.AnyoneCanPay() &&
+				hashType.BaseType() == SigHashAll
+		},
+	}, {
+		name:   "corresponding output",
+		mutate: func(tx *wire.MsgTx) { tx.TxOut[0].Value++ },
+		commits: func(hashType SigHashType) bool {
+			return hashType.BaseType() != SigHashNone
+		},
+	}, {
+		name:   "other output",
+		mutate: func(tx *wire.MsgTx) { tx.TxOut[1].Value++ },
+		commits: func(hashType SigHashType) bool {
+			return hashType.BaseType() == SigHashAll
+		},
+	}}
+	hashTypes := []SigHashType{SigHashAll, SigHashNone, SigHashSingle,
+		0x06, 0x07}
+	for _, baseType := range hashTypes {
+		for _, flag := range []SigHashType{0, SigHashAnyOneCanPay} {
+			hashType := baseType | flag
+			legacy, witness := sigHashes(tx, hashType, 0)
+			for _, m := range mutations {
+				mutated := tx.Copy()
+				m.mutate(mutated)
+				gotLegacy, gotWitness := sigHashes(mutated,
+					hashType, 0)
+				want := m.commits(hashType)
+				if !bytes.Equal(gotLegacy, legacy) != want {
+					t.Errorf("0x%x: %s: legacy signature "+
+						"hash commitment is not %v",
+						uint32(hashType), m.name, want)
+				}
+				if !bytes.Equal(gotWitness, witness) != want {
+					t.Errorf("0x%x: %s: witness signature "+
+						"hash commitment is not %v",
+						uint32(hashType), m.name, want)
+				}
+			}
+		}
+	}
+
+	// A SigHashSingle input without a corresponding output signs a hash of
+	// 1 with the original algorithm regardless of the anyone can pay flag,
+	// while the BIP0143 algorithm commits to no outputs.
+	one := make([]byte, 32)
+	one[0] = 0x01
+	for _, hashType := range []SigHashType{SigHashSingle,
+		SigHashSingle | SigHashAnyOneCanPay} {
+
+		legacy, witness := sigHashes(tx, hashType, 2)
+		if !bytes.Equal(legacy, one) {
+			t.Errorf("0x%x: unexpected legacy signature hash for an "+
+				"input without an output - got %x, want %x",
+				uint32(hashType), legacy, one)
+		}
+		if bytes.Equal(witness, one) {
+			t.Errorf("0x%x: witness signature hash for an input "+
+				"without an output is 1", uint32(hashType))
+		}
+		mutated := tx.Copy()
+		mutated.TxOut[0].Value++
+		mutated.TxOut[1].Value++
+		if _, got := sigHashes(mutated, hashType, 2); !bytes.Equal(got, witness) {
+			t.Errorf("0x%x: witness signature hash for an input "+
+				"without an output commits to the outputs",
+				uint32(hashType))
+		}
+	}
+}
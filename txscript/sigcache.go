@@ -63,6 +63,16 @@ func (s *SigCache) Exists(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *
 	return ok && entry.pubKey.IsEqual(pubKey) && entry.sig.IsEqual(sig)
 }
 
+// Len returns the number of entries in the SigCache.
+//
+// NOTE: This function is safe for concurrent access.
+func (s *SigCache) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.validSigs)
+}
+
 // Add adds an entry for a signature over 'sigHash' under public key 'pubKey'
 // to the signature cache. In the event that the SigCache is 'full', an
 // existing entry is randomly chosen to be evicted in order to make space for
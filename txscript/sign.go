@@ -5,6 +5,7 @@
 package txscript
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -394,6 +395,103 @@ sigLoop:
 	return script
 }
 
+// MergeSignatureScripts merges sigScript and prevScript assuming they are both
+// partial solutions for pkScript spending output idx of tx.  The signatures of
+// multisig scripts, including those redeemed via pay-to-script-hash, are
+// combined while for all other scripts the longer one is returned since they
+// either have a complete signature or none at all.
+func MergeSignatureScripts(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	idx int, pkScript, sigScript, prevScript []byte) []byte {
+
+	class, addresses, nrequired, err := ExtractPkScriptAddrs(pkScript,
+		chainParams)
+	if err != nil {
+		class = NonStandardTy
+	}
+	return mergeScripts(chainParams, tx, idx, pkScript, class, addresses,
+		nrequired, sigScript, prevScript)
+}
+
+// RawTxInSignatureForMultisig signs input idx of the given transaction, which
+// spends a pay-to-script-hash output of the multisig redeemScript, with privKey
+// and returns sigScript updated to include the new signature.  sigScript is the
+// current signature script of the input, which may be empty or contain the
+// signatures of other signers, so that independent signers are able to each
+// provide one signature.  The signatures are ordered to match the order of the
+// public keys in redeemScript as required by OP_CHECKMULTISIG.
+func RawTxInSignatureForMultisig(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	idx int, redeemScript []byte, hashType SigHashType,
+	privKey *btcec.PrivateKey, sigScript []byte) ([]byte, error) {
+
+	class, addresses, nRequired, err := ExtractPkScriptAddrs(redeemScript,
+		chainParams)
+	if err != nil {
+		return nil, err
+	}
+	if class != MultiSigTy {
+		return nil, fmt.Errorf("redeem script is a %v script, not a "+
+			"multisig script", class)
+	}
+
+	// Only keys which are part of the redeem script can provide one of the
+	// signatures.
+	pubKey := (*btcec.PublicKey)(&privKey.PublicKey)
+	var found bool
+	for _, addr := range addresses {
+		pk := addr.(*btcutil.AddressPubKey).PubKey()
+		if pk.IsEqual(pubKey) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("private key is not for any of the " +
+			"public keys of the redeem script")
+	}
+
+	// The redeem script is the last push of the signature script and the
+	// signatures precede it.
+	var prevSigScript []byte
+	if len(sigScript) != 0 {
+		pops, err := parseScript(sigScript)
+		if err != nil {
+			return nil, err
+		}
+		if len(pops) == 0 ||
+			!bytes.Equal(pops[len(pops)-1].data, redeemScript) {
+
+			return nil, errors.New("signature script does not " +
+				"redeem the passed redeem script")
+		}
+		prevSigScript, err = unparseScript(pops[:len(pops)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sig, err := RawTxInSignature(tx, idx, redeemScript, hashType, privKey)
+	if err != nil {
+		return nil, err
+	}
+	newSigScript, err := NewScriptBuilder().AddOp(OP_FALSE).AddData(sig).
+		Script()
+	if err != nil {
+		return nil, err
+	}
+
+	// Merging the new signature with itself when there are no others yet
+	// ensures the script is padded for the missing signatures the same way
+	// as when there are.
+	if len(prevSigScript) == 0 {
+		prevSigScript = newSigScript
+	}
+	mergedScript := mergeMultiSig(tx, idx, addresses, nRequired,
+		redeemScript, newSigScript, prevSigScript)
+
+	return NewScriptBuilder().AddOps(mergedScript).AddData(redeemScript).
+		Script()
+}
+
 // KeyDB is an interface type provided to SignTxOutput, it encapsulates
 // any user state required to get the private keys for an address.
 type KeyDB interface {
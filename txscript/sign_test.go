@@ -5,6 +5,7 @@
 package txscript
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"testing"
@@ -1382,6 +1383,199 @@ func TestSignTxOutput(t *testing.T) {
 	}
 }
 
+// TestMergeSignatureScripts ensures signature scripts that each contain only
+// some of the signatures required by a pay-to-script-hash multisig script are
+// merged into one that validates regardless of their order.
+func TestMergeSignatureScripts(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.TestNet3Params
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{
+				Hash:  chainhash.Hash{0x01},
+				Index: 0,
+			},
+			Sequence: 4294967295,
+		}},
+		TxOut: []*wire.TxOut{{Value: 1}},
+	}
+
+	// Create a 2-of-3 multisig redeem script along with the keys for it.
+	keys := make([]*btcec.PrivateKey, 3)
+	addrs := make([]*btcutil.AddressPubKey, 3)
+	for i := range keys {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("failed to make privKey %d: %v", i, err)
+		}
+		pk := (*btcec.PublicKey)(&key.PublicKey).SerializeCompressed()
+		addr, err := btcutil.NewAddressPubKey(pk, params)
+		if err != nil {
+			t.Fatalf("failed to make address %d: %v", i, err)
+		}
+		keys[i], addrs[i] = key, addr
+	}
+	redeemScript, err := MultiSigScript(addrs, 2)
+	if err != nil {
+		t.Fatalf("failed to make redeem script: %v", err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		t.Fatalf("failed to make p2sh addr: %v", err)
+	}
+	pkScript, err := PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatalf("failed to make pkscript: %v", err)
+	}
+	getScript := mkGetScript(map[string][]byte{
+		scriptAddr.EncodeAddress(): redeemScript,
+	})
+
+	// Sign with the first and the last key independently.
+	signWith := func(i int) []byte {
+		sigScript, err := SignTxOutput(params, tx, 0, pkScript,
+			SigHashAll, mkGetKey(map[string]addressToKey{
+				addrs[i].EncodeAddress(): {keys[i], true},
+			}), getScript, nil)
+		if err != nil {
+			t.Fatalf("failed to sign with key %d: %v", i, err)
+		}
+		if checkScripts("partial", tx, 0, 1, sigScript, pkScript) == nil {
+			t.Fatalf("script signed with key %d only is valid", i)
+		}
+		return sigScript
+	}
+	sigScript1 := signWith(0)
+	sigScript3 := signWith(2)
+
+	merged := MergeSignatureScripts(params, tx, 0, pkScript, sigScript1,
+		sigScript3)
+	if err := checkScripts("merged", tx, 0, 1, merged, pkScript); err != nil {
+		t.Fatalf("merged script invalid: %v", err)
+	}
+	merged = MergeSignatureScripts(params, tx, 0, pkScript, sigScript3,
+		sigScript1)
+	if err := checkScripts("reversed", tx, 0, 1, merged, pkScript); err != nil {
+		t.Fatalf("merged script in reverse order invalid: %v", err)
+	}
+
+	// Merging with an empty script must keep the existing signatures.
+	merged = MergeSignatureScripts(params, tx, 0, pkScript, nil, sigScript1)
+	if !bytes.Equal(merged, sigScript1) {
+		t.Fatalf("unexpected script merged with empty script - got "+
+			"%x, want %x", merged, sigScript1)
+	}
+}
+
+// TestRawTxInSignatureForMultisig ensures the signatures of a 2-of-3 multisig
+// redeemed via pay-to-script-hash can be provided by independent signers in any
+// order and that the final signature script validates.
+func TestRawTxInSignatureForMultisig(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.TestNet3Params
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{
+				Hash:  chainhash.Hash{0x01},
+				Index: 0,
+			},
+			Sequence: 4294967295,
+		}},
+		TxOut: []*wire.TxOut{{Value: 1}},
+	}
+
+	// Create a 2-of-3 multisig redeem script along with the keys for it.
+	keys := make([]*btcec.PrivateKey, 4)
+	addrs := make([]*btcutil.AddressPubKey, 3)
+	for i := range keys {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("failed to make privKey %d: %v", i, err)
+		}
+		keys[i] = key
+		if i == len(addrs) {
+			break
+		}
+		pk := (*btcec.PublicKey)(&key.PublicKey).SerializeCompressed()
+		addrs[i], err = btcutil.NewAddressPubKey(pk, params)
+		if err != nil {
+			t.Fatalf("failed to make address %d: %v", i, err)
+		}
+	}
+	redeemScript, err := MultiSigScript(addrs, 2)
+	if err != nil {
+		t.Fatalf("failed to make redeem script: %v", err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		t.Fatalf("failed to make p2sh addr: %v", err)
+	}
+	pkScript, err := PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatalf("failed to make pkscript: %v", err)
+	}
+
+	// Sign with the last key first and then with the first key on top of
+	// the partially signed script.
+	partial, err := RawTxInSignatureForMultisig(params, tx, 0, redeemScript,
+		SigHashAll, keys[2], nil)
+	if err != nil {
+		t.Fatalf("failed to sign with key 2: %v", err)
+	}
+	if checkScripts("partial", tx, 0, 1, partial, pkScript) == nil {
+		t.Fatal("script signed with key 2 only is valid")
+	}
+	final, err := RawTxInSignatureForMultisig(params, tx, 0, redeemScript,
+		SigHashAll, keys[0], partial)
+	if err != nil {
+		t.Fatalf("failed to sign with key 0: %v", err)
+	}
+	if err := checkScripts("final", tx, 0, 1, final, pkScript); err != nil {
+		t.Fatalf("final script invalid: %v", err)
+	}
+
+	// Signing the same script with the same key again does not change it.
+	again, err := RawTxInSignatureForMultisig(params, tx, 0, redeemScript,
+		SigHashAll, keys[0], final)
+	if err != nil {
+		t.Fatalf("failed to sign with key 0 again: %v", err)
+	}
+	if !bytes.Equal(again, final) {
+		t.Fatalf("unexpected script after signing twice - got %x, "+
+			"want %x", again, final)
+	}
+
+	// Keys which aren't part of the redeem script, signature scripts for
+	// another redeem script, and redeem scripts which aren't multisig are
+	// rejected.
+	_, err = RawTxInSignatureForMultisig(params, tx, 0, redeemScript,
+		SigHashAll, keys[3], partial)
+	if err == nil {
+		t.Fatal("did not receive expected error for a key which is " +
+			"not part of the redeem script")
+	}
+	otherScript, err := MultiSigScript(addrs[:2], 1)
+	if err != nil {
+		t.Fatalf("failed to make redeem script: %v", err)
+	}
+	_, err = RawTxInSignatureForMultisig(params, tx, 0, otherScript,
+		SigHashAll, keys[0], partial)
+	if err == nil {
+		t.Fatal("did not receive expected error for a signature script " +
+			"of another redeem script")
+	}
+	_, err = RawTxInSignatureForMultisig(params, tx, 0, pkScript,
+		SigHashAll, keys[0], nil)
+	if err == nil {
+		t.Fatal("did not receive expected error for a redeem script " +
+			"which is not multisig")
+	}
+}
+
 type tstInput struct {
 	txout              *wire.TxOut
 	sigscriptGenerates bool
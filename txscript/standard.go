@@ -140,22 +140,33 @@ func isMultiSig(pops []parsedOpcode) bool {
 	return true
 }
 
-// isNullData returns true if the passed script is a null data transaction,
-// false otherwise.
-func isNullData(pops []parsedOpcode) bool {
+// nullDataSize returns the number of bytes of data pushed by the passed null
+// data script along with whether or not it is a null data script carrying any
+// amount of data.
+func nullDataSize(pops []parsedOpcode) (int, bool) {
 	// A nulldata transaction is either a single OP_RETURN or an
-	// OP_RETURN SMALLDATA (where SMALLDATA is a data push up to
-	// MaxDataCarrierSize bytes).
+	// OP_RETURN SMALLDATA (where SMALLDATA is a data push).
 	l := len(pops)
 	if l == 1 && pops[0].opcode.value == OP_RETURN {
-		return true
+		return 0, true
 	}
 
-	return l == 2 &&
-		pops[0].opcode.value == OP_RETURN &&
+	if l == 2 && pops[0].opcode.value == OP_RETURN &&
 		(isSmallInt(pops[1].opcode) || pops[1].opcode.value <=
-			OP_PUSHDATA4) &&
-		len(pops[1].data) <= MaxDataCarrierSize
+			OP_PUSHDATA4) {
+
+		return len(pops[1].data), true
+	}
+	return 0, false
+}
+
+// isNullData returns true if the passed script is a null data transaction,
+// false otherwise.
+func isNullData(pops []parsedOpcode) bool {
+	// The pushed data of a nulldata transaction must not exceed
+	// MaxDataCarrierSize bytes.
+	size, ok := nullDataSize(pops)
+	return ok && size <= MaxDataCarrierSize
 }
 
 // scriptType returns the type of the script being inspected from the known
@@ -190,6 +201,19 @@ func GetScriptClass(script []byte) ScriptClass {
 	return typeOfScript(pops)
 }
 
+// NullDataSize returns the number of bytes of data pushed by the passed script
+// along with whether or not it is a null data script.  Unlike GetScriptClass,
+// which only classifies null data scripts carrying up to MaxDataCarrierSize
+// bytes as NullDataTy, it does not limit the amount of data so callers are
+// able to apply their own limit.
+func NullDataSize(script []byte) (int, bool) {
+	pops, err := parseScript(script)
+	if err != nil {
+		return 0, false
+	}
+	return nullDataSize(pops)
+}
+
 // NewScriptClass returns the ScriptClass corresponding to the string name
 // provided as argument. ErrUnsupportedScriptType error is returned if the
 // name doesn't correspond to any known ScriptClass.
@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/btcsuite/btcd/chaincfg"
@@ -1215,6 +1216,59 @@ func TestNullDataScript(t *testing.T) {
 	}
 }
 
+// TestNullDataSize ensures NullDataSize identifies null data scripts carrying
+// any amount of data and reports the size of the data.
+func TestNullDataSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     []byte
+		isNullData bool
+		size       int
+	}{
+		{
+			name:       "no data",
+			script:     mustParseShortForm("RETURN"),
+			isNullData: true,
+		},
+		{
+			name:       "small int",
+			script:     mustParseShortForm("RETURN 1"),
+			isNullData: true,
+		},
+		{
+			name:       "max carrier size",
+			script:     mustParseShortForm("RETURN PUSHDATA1 0x50 0x" + strings.Repeat("00", 80)),
+			isNullData: true,
+			size:       80,
+		},
+		{
+			name:       "larger than max carrier size",
+			script:     mustParseShortForm("RETURN PUSHDATA2 0x1001 0x" + strings.Repeat("00", 272)),
+			isNullData: true,
+			size:       272,
+		},
+		{
+			name:       "multiple pushes",
+			script:     mustParseShortForm("RETURN 1 2"),
+			isNullData: false,
+		},
+		{
+			name:       "no OP_RETURN",
+			script:     mustParseShortForm("0x01 0x00"),
+			isNullData: false,
+		},
+	}
+
+	for _, test := range tests {
+		size, isNullData := NullDataSize(test.script)
+		if isNullData != test.isNullData || size != test.size {
+			t.Errorf("%s: unexpected result - got (%d, %v), want "+
+				"(%d, %v)", test.name, size, isNullData,
+				test.size, test.isNullData)
+		}
+	}
+}
+
 // TestNewScriptClass tests whether NewScriptClass returns a valid ScriptClass.
 func TestNewScriptClass(t *testing.T) {
 	tests := []struct {
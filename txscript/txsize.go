@@ -0,0 +1,168 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// maxSigLen is the maximum length of a DER encoded signature along
+	// with the signature hash type appended to it.
+	maxSigLen = 72 + 1
+
+	// schnorrSigLen is the maximum length of a schnorr signature along with
+	// a signature hash type appended to it.  The signature hash type is
+	// omitted when the default one is used.
+	schnorrSigLen = 64 + 1
+
+	// witnessScaleFactor is the factor the size of the data of a
+	// transaction other than its witness data counts for in its weight.
+	witnessScaleFactor = 4
+
+	// baseInputSize is the size of an input without its signature script
+	// and the length of it.  The size is composed of the following:
+	//   Previous outpoint hash (32 bytes)
+	//   Previous outpoint index (4 bytes)
+	//   Sequence (4 bytes)
+	baseInputSize = 32 + 4 + 4
+
+	// witnessV0PubKeyHashWitnessSize is the maximum size of the witness
+	// which spends a P2WPKH output.  The size is composed of the following:
+	//   Number of witness items (1 byte)
+	//   Signature length (1 byte)
+	//   Signature (max 73 bytes)
+	//   Public key length (1 byte)
+	//   Public key (33 bytes)
+	witnessV0PubKeyHashWitnessSize = 1 + 1 + maxSigLen + 1 + compressedPubKeyLen
+
+	// nestedWitnessV0PubKeyHashSigScriptLen is the length of the signature
+	// script which spends a P2SH output nesting a P2WPKH output.  It is
+	// composed of a data push of the witness program:
+	//   Witness program length (1 byte)
+	//   Witness program (22 bytes)
+	nestedWitnessV0PubKeyHashSigScriptLen = 1 + witnessV0PubKeyHashLen
+
+	// taprootKeyPathWitnessSize is the maximum size of the witness which
+	// spends a P2TR output via its key path.  The size is composed of the
+	// following:
+	//   Number of witness items (1 byte)
+	//   Signature length (1 byte)
+	//   Signature (max 65 bytes)
+	taprootKeyPathWitnessSize = 1 + 1 + schnorrSigLen
+)
+
+// InputType identifies the kind of output an input spends, which determines
+// the size of the data it needs to provide to spend it.
+type InputType uint8
+
+// These constants define the types of inputs supported when estimating the
+// size of transactions.
+const (
+	// PubKeyHashInput spends a P2PKH output of a compressed public key.
+	PubKeyHashInput InputType = iota
+
+	// WitnessV0PubKeyHashInput spends a P2WPKH output.
+	WitnessV0PubKeyHashInput
+
+	// NestedWitnessV0PubKeyHashInput spends a P2SH output which nests a
+	// P2WPKH output.
+	NestedWitnessV0PubKeyHashInput
+
+	// WitnessV0MultiSigInput spends a P2WSH output of a multisig script of
+	// compressed public keys.
+	WitnessV0MultiSigInput
+
+	// TaprootKeyPathInput spends a P2TR output via its key path.
+	TaprootKeyPathInput
+)
+
+// InputDescriptor describes an input for the purpose of estimating the size of
+// the transaction which contains it.
+type InputDescriptor struct {
+	// Type is the kind of output the input spends.
+	Type InputType
+
+	// NumRequired and NumPubKeys are the number of required signatures and
+	// the number of public keys of the multisig script spent by a
+	// WitnessV0MultiSigInput.  They are ignored for all other types.
+	NumRequired int
+	NumPubKeys  int
+}
+
+// sizes returns the length of the signature script of the input and the size of
+// its witness, which is zero when the input doesn't provide a witness.
+func (d *InputDescriptor) sizes() (int, int) {
+	switch d.Type {
+	case PubKeyHashInput:
+		return maxPubKeyHashSigScriptLen, 0
+
+	case WitnessV0PubKeyHashInput:
+		return 0, witnessV0PubKeyHashWitnessSize
+
+	case NestedWitnessV0PubKeyHashInput:
+		return nestedWitnessV0PubKeyHashSigScriptLen,
+			witnessV0PubKeyHashWitnessSize
+
+	case WitnessV0MultiSigInput:
+		// The witness consists of an empty item for the extra argument
+		// OP_CHECKMULTISIG consumes, the signatures, and the witness
+		// script which pushes the public keys between the number of
+		// required signatures and public keys and ends with
+		// OP_CHECKMULTISIG.
+		scriptLen := 1 + d.NumPubKeys*(1+compressedPubKeyLen) + 1 + 1
+		size := wire.VarIntSerializeSize(uint64(d.NumRequired+2)) + 1 +
+			d.NumRequired*(1+maxSigLen) +
+			wire.VarIntSerializeSize(uint64(scriptLen)) + scriptLen
+		return 0, size
+
+	case TaprootKeyPathInput:
+		return 0, taprootKeyPathWitnessSize
+	}
+
+	return 0, 0
+}
+
+// EstimateVirtualSize returns an estimate of the virtual size of a transaction
+// which spends the described inputs to the passed outputs once all of its inputs
+// are signed.  Signatures are assumed to have their maximum length, so the
+// estimate is an upper bound of the virtual size of the signed transaction that
+// is suitable to calculate the fee to pay for it.  Only the outpoint and the
+// sequence of inputs of an unknown type are accounted for.
+func EstimateVirtualSize(inputs []InputDescriptor, outputs []wire.TxOut) int {
+	// The size without witness data is composed of the version, the
+	// inputs and outputs along with their counts, and the lock time.
+	baseSize := 4 + wire.VarIntSerializeSize(uint64(len(inputs))) +
+		wire.VarIntSerializeSize(uint64(len(outputs))) + 4
+	for _, output := range outputs {
+		baseSize += output.SerializeSize()
+	}
+
+	var witnessSize int
+	var hasWitness bool
+	for i := range inputs {
+		sigScriptLen, inputWitnessSize := inputs[i].sizes()
+		baseSize += baseInputSize +
+			wire.VarIntSerializeSize(uint64(sigScriptLen)) + sigScriptLen
+		if inputWitnessSize != 0 {
+			hasWitness = true
+			witnessSize += inputWitnessSize
+		} else {
+			// Inputs without a witness have an empty witness stack
+			// which is encoded as a zero item count.
+			witnessSize++
+		}
+	}
+
+	// The weight counts the size without witness data at full weight, and
+	// the witness data along with the segwit marker and flag at a
+	// discount.  Transactions without witness data are serialized without
+	// any of it.
+	weight := baseSize * witnessScaleFactor
+	if hasWitness {
+		weight += 2 + witnessSize
+	}
+	return (weight + witnessScaleFactor - 1) / witnessScaleFactor
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEstimateVirtualSize ensures the estimated virtual size of transactions
+// spending each supported type of input, both alone and mixed, is an upper
+// bound of the virtual size of the signed transactions which exceeds it by no
+// more than the bytes a signature may be shorter than its maximum length.
+func TestEstimateVirtualSize(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	const amt = 100000
+
+	// Create the keys along with a 2-of-3 multisig witness script.
+	keys := make([]*btcec.PrivateKey, 3)
+	pubKeys := make([]*btcutil.AddressPubKey, 3)
+	for i := range keys {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("failed to make privKey %d: %v", i, err)
+		}
+		pk := (*btcec.PublicKey)(&key.PublicKey).SerializeCompressed()
+		pubKeys[i], err = btcutil.NewAddressPubKey(pk, params)
+		if err != nil {
+			t.Fatalf("failed to make address %d: %v", i, err)
+		}
+		keys[i] = key
+	}
+	pubKeyHash := btcutil.Hash160(pubKeys[0].ScriptAddress())
+	witnessScript, err := MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatalf("failed to make witness script: %v", err)
+	}
+
+	// pkScript returns the output script paying to the given address.
+	pkScript := func(addr btcutil.Address, err error) []byte {
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("failed to make address: %v", err)
+		}
+		script, err := PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("failed to make pkscript: %v", err)
+		}
+		return script
+	}
+	p2pkh := pkScript(btcutil.NewAddressPubKeyHash(pubKeyHash, params))
+	p2wpkh := pkScript(btcutil.NewAddressWitnessPubKeyHash(pubKeyHash,
+		params))
+	p2sh := pkScript(btcutil.NewAddressScriptHash(p2wpkh, params))
+	witnessScriptHash := chainhash.HashB(witnessScript)
+	p2wsh := pkScript(btcutil.NewAddressWitnessScriptHash(
+		witnessScriptHash, params))
+	p2tr := append([]byte{OP_1, OP_DATA_32}, witnessScriptHash...)
+
+	// signTx signs the inputs of the passed transaction which spend outputs
+	// of the passed types.  There is no support for schnorr signatures, so
+	// P2TR inputs are provided with a witness of a signature sized item.
+	signTx := func(tx *wire.MsgTx, types []InputType) {
+		t.Helper()
+
+		sigHashes := NewTxSigHashes(tx)
+		for idx, typ := range types {
+			txIn := tx.TxIn[idx]
+			var err error
+			var prevScript []byte
+			switch typ {
+			case PubKeyHashInput:
+				prevScript = p2pkh
+				txIn.SignatureScript, err = SignatureScript(tx,
+					idx, p2pkh, SigHashAll, keys[0], true)
+
+			case WitnessV0PubKeyHashInput:
+				prevScript = p2wpkh
+				txIn.Witness, err = WitnessSignature(tx,
+					sigHashes, idx, amt, p2wpkh, SigHashAll,
+					keys[0], true)
+
+			case NestedWitnessV0PubKeyHashInput:
+				prevScript = p2sh
+				txIn.SignatureScript, err = NewScriptBuilder().
+					AddData(p2wpkh).Script()
+				if err != nil {
+					break
+				}
+				txIn.Witness, err = WitnessSignature(tx,
+					sigHashes, idx, amt, p2wpkh, SigHashAll,
+					keys[0], true)
+
+			case WitnessV0MultiSigInput:
+				prevScript = p2wsh
+				txIn.Witness = wire.TxWitness{nil}
+				for _, key := range keys[:2] {
+					var sig []byte
+					sig, err = RawTxInWitnessSignature(tx,
+						sigHashes, idx, amt, witnessScript,
+						SigHashAll, key)
+					if err != nil {
+						break
+					}
+					txIn.Witness = append(txIn.Witness, sig)
+				}
+				txIn.Witness = append(txIn.Witness, witnessScript)
+
+			case TaprootKeyPathInput:
+				txIn.Witness = wire.TxWitness{make([]byte, 64)}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("failed to sign input %d: %v", idx, err)
+			}
+
+			vm, err := NewEngine(prevScript, tx, idx,
+				StandardVerifyFlags, nil, sigHashes, amt)
+			if err != nil {
+				t.Fatalf("failed to make script engine for input "+
+					"%d: %v", idx, err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("invalid signature for input %d: %v",
+					idx, err)
+			}
+		}
+	}
+
+	allTypes := []InputType{PubKeyHashInput, WitnessV0PubKeyHashInput,
+		NestedWitnessV0PubKeyHashInput, WitnessV0MultiSigInput,
+		TaprootKeyPathInput}
+	tests := []struct {
+		name    string
+		types   []InputType
+		outputs int
+	}{
+		{"p2pkh", []InputType{PubKeyHashInput}, 2},
+		{"p2pkh x3", []InputType{PubKeyHashInput, PubKeyHashInput,
+			PubKeyHashInput}, 1},
+		{"p2wpkh", []InputType{WitnessV0PubKeyHashInput}, 2},
+		{"p2sh-p2wpkh", []InputType{NestedWitnessV0PubKeyHashInput}, 2},
+		{"p2wsh 2-of-3", []InputType{WitnessV0MultiSigInput}, 2},
+		{"p2tr key path", []InputType{TaprootKeyPathInput}, 2},
+		{"mixed", allTypes, 3},
+	}
+	for _, test := range tests {
+		tx := wire.NewMsgTx(2)
+		inputs := make([]InputDescriptor, 0, len(test.types))
+		var numSigs int
+		for i, typ := range test.types {
+			prevOut := wire.NewOutPoint(&chainhash.Hash{byte(i)}, 0)
+			tx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+			input := InputDescriptor{Type: typ}
+			switch typ {
+			case WitnessV0MultiSigInput:
+				input.NumRequired, input.NumPubKeys = 2, 3
+				numSigs += 2
+			case TaprootKeyPathInput:
+				// Schnorr signatures have a fixed length.
+			default:
+				numSigs++
+			}
+			inputs = append(inputs, input)
+		}
+		for i := 0; i < test.outputs; i++ {
+			tx.AddTxOut(wire.NewTxOut(amt/int64(test.outputs+1),
+				[][]byte{p2pkh, p2wpkh, p2tr}[i%3]))
+		}
+		outputs := make([]wire.TxOut, 0, len(tx.TxOut))
+		for _, txOut := range tx.TxOut {
+			outputs = append(outputs, *txOut)
+		}
+		estimate := EstimateVirtualSize(inputs, outputs)
+
+		signTx(tx, test.types)
+		weight := tx.SerializeSizeStripped()*3 + tx.SerializeSize()
+		vsize := (weight + 3) / 4
+
+		// Each signature may be up to 2 bytes shorter than the maximum
+		// length, the P2TR witness omits the signature hash type, and the
+		// virtual size is rounded up.
+		tolerance := numSigs*2 + 1
+		if estimate < vsize || estimate > vsize+tolerance {
+			t.Errorf("%s: unexpected estimated virtual size %d for "+
+				"virtual size %d", test.name, estimate, vsize)
+		}
+	}
+}
@@ -248,12 +248,34 @@ func validateUserAgent(userAgent string) error {
 	return nil
 }
 
+// ValidateUserAgentComment returns an error when the passed user agent comment
+// contains any of the characters BIP0014 reserves to delimit the parts of a
+// user agent, which are '/', ':', '(', and ')', or any character which is not
+// printable ASCII.
+func ValidateUserAgentComment(comment string) error {
+	for _, r := range comment {
+		if r < ' ' || r > '~' || strings.ContainsRune("/:()", r) {
+			str := fmt.Sprintf("user agent comment %q contains the "+
+				"invalid character %q", comment, r)
+			return messageError("ValidateUserAgentComment", str)
+		}
+	}
+	return nil
+}
+
 // AddUserAgent adds a user agent to the user agent string for the version
 // message.  The version string is not defined to any strict format, although
-// it is recommended to use the form "major.minor.revision" e.g. "2.6.41".
+// it is recommended to use the form "major.minor.revision" e.g. "2.6.41".  The
+// comments must be valid according to ValidateUserAgentComment.
 func (msg *MsgVersion) AddUserAgent(name string, version string,
 	comments ...string) error {
 
+	for _, comment := range comments {
+		if err := ValidateUserAgentComment(comment); err != nil {
+			return err
+		}
+	}
+
 	newUserAgent := fmt.Sprintf("%s:%s", name, version)
 	if len(comments) != 0 {
 		newUserAgent = fmt.Sprintf("%s(%s)", newUserAgent,
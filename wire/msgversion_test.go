@@ -85,6 +85,24 @@ func TestVersion(t *testing.T) {
 
 	}
 
+	// Comments with characters reserved by BIP0014 or which are not
+	// printable must be rejected without changing the user agent.
+	for _, comment := range []string{"a/b", "a:b", "(ab", "ab)", "a\nb",
+		"caf\u00e9"} {
+
+		err = msg.AddUserAgent("myclient", "1.2.3", "valid", comment)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("AddUserAgent: expected error not received "+
+				"for comment %q - got %v, want %T", comment, err,
+				MessageError{})
+		}
+		if msg.UserAgent != customUserAgent {
+			t.Errorf("AddUserAgent: wrong user agent after invalid "+
+				"comment %q - got %s, want %s", comment,
+				msg.UserAgent, customUserAgent)
+		}
+	}
+
 	// Version message should not have any services set by default.
 	if msg.Services != 0 {
 		t.Errorf("NewMsgVersion: wrong default services - got %v, want %v",
@@ -0,0 +1,27 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package zmqpub implements publishing notifications about blocks and
+transactions to ZeroMQ subscribers the same way the ZeroMQ notification
+interface of Bitcoin Core does.
+
+The Publisher serves PUB sockets speaking version 3.0 of the ZeroMQ Message
+Transport Protocol with the NULL security mechanism on the configured TCP
+endpoints, so it does not depend on the ZeroMQ library while remaining
+compatible with its SUB sockets.  The hashblock, hashtx, rawblock, rawtx, and
+sequence topics are supported and topics may share an endpoint.
+
+Each notification is a message of three parts: the topic, the body, and a
+4-byte little-endian sequence number which is incremented for each message of
+the topic so subscribers can detect dropped messages.  Hashes are published in
+the byte order they are displayed in.  Messages are dropped for subscribers
+which do not keep up rather than blocking the publisher.
+
+The sequence topic is an ordered log of blocks connected to and disconnected
+from the main chain and of transactions added to and removed from the memory
+pool.  Its messages have the same format as those of Bitcoin Core, although
+transactions removed because a block included them are published as well.
+*/
+package zmqpub
@@ -0,0 +1,627 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// sendQueueSize is the maximum number of messages which are queued for
+	// a subscriber.  Further messages are dropped until the subscriber
+	// catches up, which matches the default high water mark of ZeroMQ.
+	sendQueueSize = 1000
+
+	// handshakeTimeout is the maximum time a subscriber is given to
+	// complete the handshake after connecting.
+	handshakeTimeout = 30 * time.Second
+
+	// acceptRetryDelay is the time to wait before accepting subscribers
+	// again after a temporary error such as running out of file
+	// descriptors.
+	acceptRetryDelay = time.Second
+)
+
+// Topic identifies a kind of notification which is published.
+type Topic string
+
+// The topics which are published.  They match the ones published by Bitcoin
+// Core, so existing subscribers work unmodified.
+const (
+	// TopicHashBlock is the topic of the hashes of blocks connected to the
+	// main chain.
+	TopicHashBlock Topic = "hashblock"
+
+	// TopicHashTx is the topic of the hashes of transactions accepted to
+	// the memory pool or included in blocks connected to or disconnected
+	// from the main chain.
+	TopicHashTx Topic = "hashtx"
+
+	// TopicRawBlock is the topic of the serialized blocks connected to the
+	// main chain.
+	TopicRawBlock Topic = "rawblock"
+
+	// TopicRawTx is the topic of the serialized transactions which are
+	// published with TopicHashTx.
+	TopicRawTx Topic = "rawtx"
+
+	// TopicSequence is the topic of the ordered log of blocks connected to
+	// and disconnected from the main chain along with transactions added
+	// to and removed from the memory pool.  See publishSequence for the
+	// format of the messages.
+	TopicSequence Topic = "sequence"
+)
+
+// Labels of the events published to TopicSequence.
+const (
+	sequenceBlockConnected    = 'C'
+	sequenceBlockDisconnected = 'D'
+	sequenceTxAdded           = 'A'
+	sequenceTxRemoved         = 'R'
+)
+
+// knownTopics is the set of topics which may be published.
+var knownTopics = map[Topic]struct{}{
+	TopicHashBlock: {},
+	TopicHashTx:    {},
+	TopicRawBlock:  {},
+	TopicRawTx:     {},
+	TopicSequence:  {},
+}
+
+// Config is a descriptor containing the publisher configuration.
+type Config struct {
+	// Endpoints maps the topics to publish to the endpoints subscribers
+	// connect to for them in the form tcp://host:port.  Topics which share
+	// an endpoint are published on the same socket.
+	Endpoints map[Topic]string
+}
+
+// subscriber houses the state of a connected subscriber.
+type subscriber struct {
+	conn      net.Conn
+	sendQueue chan [][]byte
+
+	mtx           sync.Mutex
+	subscriptions map[string]int
+}
+
+// subscribe adds or removes one subscription to the topics with the passed
+// prefix.
+func (sub *subscriber) subscribe(prefix []byte, add bool) {
+	sub.mtx.Lock()
+	if add {
+		sub.subscriptions[string(prefix)]++
+	} else if sub.subscriptions[string(prefix)] > 1 {
+		sub.subscriptions[string(prefix)]--
+	} else {
+		delete(sub.subscriptions, string(prefix))
+	}
+	sub.mtx.Unlock()
+}
+
+// isSubscribed returns whether or not the subscriber is subscribed to the
+// passed topic.
+func (sub *subscriber) isSubscribed(topic []byte) bool {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	for prefix := range sub.subscriptions {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// socket houses the state of a listening PUB socket and its subscribers.
+type socket struct {
+	endpoint string
+	listener net.Listener
+
+	mtx         sync.Mutex
+	conns       map[net.Conn]struct{}
+	subscribers map[*subscriber]struct{}
+}
+
+// broadcast queues the passed message for all subscribers which are subscribed
+// to its topic.  It never blocks, so the message is dropped for subscribers
+// with a full send queue.
+func (s *socket) broadcast(msg [][]byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for sub := range s.subscribers {
+		if !sub.isSubscribed(msg[0]) {
+			continue
+		}
+		select {
+		case sub.sendQueue <- msg:
+		default:
+			log.Debugf("Dropping %s notification for slow subscriber "+
+				"%s", msg[0], sub.conn.RemoteAddr())
+		}
+	}
+}
+
+// Publisher publishes notifications about blocks and transactions to the
+// subscribers of the configured topics.
+type Publisher struct {
+	started  int32
+	shutdown int32
+
+	sockets []*socket
+	topics  map[Topic]*socket
+
+	// mtx protects the sequence numbers and ensures messages are queued in
+	// the order of their sequence numbers.  The mempool sequence number is
+	// incremented for each transaction added to or removed from the memory
+	// pool.
+	mtx             sync.Mutex
+	sequences       map[Topic]uint32
+	mempoolSequence uint64
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// parseEndpoint returns the network address to listen on for the passed
+// endpoint.  Only TCP endpoints are supported.  A host of * listens on all
+// interfaces the same way ZeroMQ does.
+func parseEndpoint(endpoint string) (string, error) {
+	const scheme = "tcp://"
+	if !strings.HasPrefix(endpoint, scheme) {
+		return "", fmt.Errorf("endpoint %q does not use the tcp "+
+			"transport", endpoint)
+	}
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(endpoint, scheme))
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// New returns a new publisher which listens on the configured endpoints.  The
+// publisher must be started with Start before subscribers are served.
+func New(cfg *Config) (*Publisher, error) {
+	p := &Publisher{
+		topics:    make(map[Topic]*socket),
+		sequences: make(map[Topic]uint32),
+		quit:      make(chan struct{}),
+	}
+
+	sockets := make(map[string]*socket)
+	for topic, endpoint := range cfg.Endpoints {
+		if _, ok := knownTopics[topic]; !ok {
+			p.closeListeners()
+			return nil, fmt.Errorf("unknown topic %q", topic)
+		}
+
+		s, ok := sockets[endpoint]
+		if !ok {
+			addr, err := parseEndpoint(endpoint)
+			if err != nil {
+				p.closeListeners()
+				return nil, err
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				p.closeListeners()
+				return nil, err
+			}
+			s = &socket{
+				endpoint:    endpoint,
+				listener:    listener,
+				conns:       make(map[net.Conn]struct{}),
+				subscribers: make(map[*subscriber]struct{}),
+			}
+			sockets[endpoint] = s
+			p.sockets = append(p.sockets, s)
+		}
+		p.topics[topic] = s
+	}
+
+	return p, nil
+}
+
+// closeListeners closes the listeners of all sockets.
+func (p *Publisher) closeListeners() {
+	for _, s := range p.sockets {
+		if err := s.listener.Close(); err != nil {
+			log.Errorf("Unable to close listener for %s: %v",
+				s.endpoint, err)
+		}
+	}
+}
+
+// Addr returns the address the socket the passed topic is published on is
+// listening on, or nil when the topic is not published.
+func (p *Publisher) Addr(topic Topic) net.Addr {
+	s, ok := p.topics[topic]
+	if !ok {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Start begins serving subscribers.
+func (p *Publisher) Start() {
+	if atomic.AddInt32(&p.started, 1) != 1 {
+		return
+	}
+
+	for _, s := range p.sockets {
+		p.wg.Add(1)
+		go p.listenHandler(s)
+	}
+}
+
+// Stop closes all sockets and disconnects all subscribers.
+func (p *Publisher) Stop() {
+	if atomic.AddInt32(&p.shutdown, 1) != 1 {
+		return
+	}
+
+	close(p.quit)
+	p.closeListeners()
+	for _, s := range p.sockets {
+		s.mtx.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mtx.Unlock()
+	}
+	p.wg.Wait()
+}
+
+// listenHandler accepts subscribers connecting to the passed socket.  It must
+// be run as a goroutine.
+func (p *Publisher) listenHandler(s *socket) {
+	defer p.wg.Done()
+
+	log.Infof("Publishing notifications on %s", s.endpoint)
+	for atomic.LoadInt32(&p.shutdown) == 0 {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// Don't log the error when forcibly shutting down.
+			if atomic.LoadInt32(&p.shutdown) != 0 {
+				return
+			}
+			log.Errorf("Can't accept connection: %v", err)
+
+			// Stop on errors which won't go away, such as the
+			// listener being closed, and back off before retrying
+			// temporary ones.
+			if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+				return
+			}
+			select {
+			case <-time.After(acceptRetryDelay):
+			case <-p.quit:
+				return
+			}
+			continue
+		}
+
+		p.wg.Add(1)
+		go p.subscriberHandler(s, conn)
+	}
+}
+
+// handshake performs the handshake with a subscriber which just connected.
+func handshake(conn net.Conn) error {
+	if err := writeGreeting(conn); err != nil {
+		return err
+	}
+	if err := readGreeting(conn); err != nil {
+		return err
+	}
+	if err := writeReadyCommand(conn, "PUB"); err != nil {
+		return err
+	}
+
+	f, err := readFrame(conn, maxFrameSize)
+	if err != nil {
+		return err
+	}
+	if f.flags&flagCommand == 0 {
+		return fmt.Errorf("expected ready command")
+	}
+	cmd, err := parseCommand(f.body)
+	if err != nil {
+		return err
+	}
+	if cmd.name != "READY" {
+		return fmt.Errorf("expected ready command instead of %q",
+			cmd.name)
+	}
+	properties, err := parseReadyProperties(cmd.data)
+	if err != nil {
+		return err
+	}
+	socketType := properties["socket-type"]
+	if socketType != "SUB" && socketType != "XSUB" {
+		return fmt.Errorf("unsupported socket type %q", socketType)
+	}
+	return nil
+}
+
+// subscriberHandler serves a subscriber connected to the passed socket until
+// it disconnects or the publisher is stopped.  It must be run as a goroutine.
+func (p *Publisher) subscriberHandler(s *socket, conn net.Conn) {
+	defer p.wg.Done()
+
+	// Track the connection so it is closed when the publisher is stopped,
+	// including while the handshake is in progress.
+	s.mtx.Lock()
+	if atomic.LoadInt32(&p.shutdown) != 0 {
+		s.mtx.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mtx.Unlock()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		conn.Close()
+	}()
+
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return
+	}
+	if err := handshake(conn); err != nil {
+		log.Debugf("Handshake with subscriber %s failed: %v",
+			conn.RemoteAddr(), err)
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	sub := &subscriber{
+		conn:          conn,
+		sendQueue:     make(chan [][]byte, sendQueueSize),
+		subscriptions: make(map[string]int),
+	}
+	s.mtx.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mtx.Unlock()
+	log.Debugf("New subscriber %s on %s", conn.RemoteAddr(), s.endpoint)
+
+	done := make(chan struct{})
+	p.wg.Add(1)
+	go p.writeHandler(sub, done)
+
+	p.readHandler(sub)
+
+	s.mtx.Lock()
+	delete(s.subscribers, sub)
+	s.mtx.Unlock()
+	close(done)
+	log.Debugf("Subscriber %s on %s disconnected", conn.RemoteAddr(),
+		s.endpoint)
+}
+
+// readHandler reads the subscriptions of a subscriber until it disconnects.
+// Both the subscription messages of version 3.0 of the protocol and the
+// subscription commands of later versions are supported.
+func (p *Publisher) readHandler(sub *subscriber) {
+	for {
+		f, err := readFrame(sub.conn, maxFrameSize)
+		if err != nil {
+			return
+		}
+
+		if f.flags&flagCommand != 0 {
+			cmd, err := parseCommand(f.body)
+			if err != nil {
+				return
+			}
+			switch cmd.name {
+			case "SUBSCRIBE":
+				sub.subscribe(cmd.data, true)
+			case "CANCEL":
+				sub.subscribe(cmd.data, false)
+			}
+			continue
+		}
+
+		if len(f.body) == 0 {
+			continue
+		}
+		switch f.body[0] {
+		case 1:
+			sub.subscribe(f.body[1:], true)
+		case 0:
+			sub.subscribe(f.body[1:], false)
+		}
+	}
+}
+
+// writeHandler writes the messages queued for a subscriber until done is
+// closed.  It must be run as a goroutine.
+func (p *Publisher) writeHandler(sub *subscriber, done <-chan struct{}) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case msg := <-sub.sendQueue:
+			if err := writeMessage(sub.conn, msg); err != nil {
+				// Closing the connection makes the read handler
+				// return and clean up the subscriber.
+				sub.conn.Close()
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// publish queues a message with the passed topic and body for the subscribers
+// of the topic.  Each message includes a sequence number which is incremented
+// for each message of the topic so subscribers can detect dropped messages.
+func (p *Publisher) publish(topic Topic, body []byte) {
+	s, ok := p.topics[topic]
+	if !ok {
+		return
+	}
+
+	p.mtx.Lock()
+	p.broadcast(s, topic, body)
+	p.mtx.Unlock()
+}
+
+// broadcast queues a message with the passed topic and body on the passed
+// socket along with the next sequence number of the topic.
+//
+// This function MUST be called with the publisher lock held.
+func (p *Publisher) broadcast(s *socket, topic Topic, body []byte) {
+	var sequence [4]byte
+	binary.LittleEndian.PutUint32(sequence[:], p.sequences[topic])
+	p.sequences[topic]++
+	s.broadcast([][]byte{[]byte(topic), body, sequence[:]})
+}
+
+// publishSequence publishes an event with the passed label and hash to
+// TopicSequence.  The body of the message is the hash followed by the label,
+// which matches Bitcoin Core.  Events for transactions added to or removed
+// from the memory pool are followed by the 8-byte little-endian mempool
+// sequence number.
+func (p *Publisher) publishSequence(label byte, hash *chainhash.Hash) {
+	s, ok := p.topics[TopicSequence]
+	if !ok {
+		return
+	}
+
+	body := append(reversedHash(hash[:]), label)
+	p.mtx.Lock()
+	if label == sequenceTxAdded || label == sequenceTxRemoved {
+		var mempoolSequence [8]byte
+		binary.LittleEndian.PutUint64(mempoolSequence[:],
+			p.mempoolSequence)
+		p.mempoolSequence++
+		body = append(body, mempoolSequence[:]...)
+	}
+	p.broadcast(s, TopicSequence, body)
+	p.mtx.Unlock()
+}
+
+// reversedHash returns the passed hash in the byte order it is displayed in,
+// which is the order hashes are published in.
+func reversedHash(hash []byte) []byte {
+	reversed := make([]byte, len(hash))
+	for i, b := range hash {
+		reversed[len(hash)-1-i] = b
+	}
+	return reversed
+}
+
+// PublishBlock publishes the passed block to the block topics.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) PublishBlock(block *btcutil.Block) {
+	p.publish(TopicHashBlock, reversedHash(block.Hash()[:]))
+	if _, ok := p.topics[TopicRawBlock]; ok {
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			log.Errorf("Unable to serialize block %v: %v",
+				block.Hash(), err)
+			return
+		}
+		p.publish(TopicRawBlock, blockBytes)
+	}
+}
+
+// PublishTx publishes the passed transaction to the transaction topics.  It
+// never blocks, so it may be invoked by the memory pool with its lock held.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) PublishTx(tx *btcutil.Tx) {
+	p.publish(TopicHashTx, reversedHash(tx.Hash()[:]))
+	if _, ok := p.topics[TopicRawTx]; ok {
+		var txBuf bytes.Buffer
+		txBuf.Grow(tx.MsgTx().SerializeSize())
+		if err := tx.MsgTx().Serialize(&txBuf); err != nil {
+			log.Errorf("Unable to serialize transaction %v: %v",
+				tx.Hash(), err)
+			return
+		}
+		p.publish(TopicRawTx, txBuf.Bytes())
+	}
+}
+
+// TxAccepted publishes a transaction added to the memory pool to the transaction
+// topics and TopicSequence.  It never blocks, so it is intended to be invoked
+// by the memory pool with its lock held.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) TxAccepted(tx *btcutil.Tx) {
+	p.PublishTx(tx)
+	p.publishSequence(sequenceTxAdded, tx.Hash())
+}
+
+// TxRemoved publishes a transaction removed from the memory pool to
+// TopicSequence.  The reason it was removed is not published, which matches
+// Bitcoin Core.  Unlike Bitcoin Core, transactions removed because they were
+// included in a block are published as well, so subscribers can follow the
+// exact contents of the memory pool.  It never blocks, so it is intended to be
+// invoked by the memory pool with its lock held.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) TxRemoved(tx *btcutil.Tx, reason mempool.RemovalReason) {
+	p.publishSequence(sequenceTxRemoved, tx.Hash())
+}
+
+// HandleChainNotification publishes the blocks connected to the main chain
+// along with their transactions, and the transactions of blocks disconnected
+// from it, the same way Bitcoin Core does.  Both are also published to
+// TopicSequence.  It is intended to be registered
+// with the Subscribe method of the chain.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) HandleChainNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			log.Warnf("Chain connected notification is not a block.")
+			return
+		}
+		for _, tx := range block.Transactions() {
+			p.PublishTx(tx)
+		}
+		p.PublishBlock(block)
+		p.publishSequence(sequenceBlockConnected, block.Hash())
+
+	case blockchain.NTBlockDisconnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			log.Warnf("Chain disconnected notification is not a " +
+				"block.")
+			return
+		}
+		for _, tx := range block.Transactions() {
+			p.PublishTx(tx)
+		}
+		p.publishSequence(sequenceBlockDisconnected, block.Hash())
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testSubscriber is a minimal SUB socket used to receive the notifications of
+// a publisher.
+type testSubscriber struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// newTestSubscriber connects to the passed address, performs the handshake,
+// and subscribes to the passed topic prefixes.
+func newTestSubscriber(t *testing.T, addr net.Addr, prefixes ...string) *testSubscriber {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := writeGreeting(conn); err != nil {
+		t.Fatalf("writeGreeting: unexpected error: %v", err)
+	}
+	if err := readGreeting(conn); err != nil {
+		t.Fatalf("readGreeting: unexpected error: %v", err)
+	}
+	if err := writeReadyCommand(conn, "SUB"); err != nil {
+		t.Fatalf("writeReadyCommand: unexpected error: %v", err)
+	}
+	f, err := readFrame(conn, maxFrameSize)
+	if err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	cmd, err := parseCommand(f.body)
+	if err != nil || cmd.name != "READY" {
+		t.Fatalf("unexpected ready command %v (%v)", cmd, err)
+	}
+	properties, err := parseReadyProperties(cmd.data)
+	if err != nil || properties["socket-type"] != "PUB" {
+		t.Fatalf("unexpected ready properties %v (%v)", properties, err)
+	}
+	for _, prefix := range prefixes {
+		err := writeFrame(conn, 0, append([]byte{1}, prefix...))
+		if err != nil {
+			t.Fatalf("writeFrame: unexpected error: %v", err)
+		}
+	}
+	return &testSubscriber{t: t, conn: conn}
+}
+
+// checkMessage reads the next message and ensures it has the passed topic, body,
+// and sequence number.
+func (s *testSubscriber) checkMessage(topic Topic, body []byte, sequence uint32) {
+	s.t.Helper()
+
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var parts [][]byte
+	for {
+		f, err := readFrame(s.conn, 1<<20)
+		if err != nil {
+			s.t.Fatalf("readFrame: unexpected error: %v", err)
+		}
+		parts = append(parts, f.body)
+		if f.flags&flagMore == 0 {
+			break
+		}
+	}
+	if len(parts) != 3 {
+		s.t.Fatalf("unexpected number of message parts - got %d, "+
+			"want 3", len(parts))
+	}
+	if string(parts[0]) != string(topic) {
+		s.t.Fatalf("unexpected topic - got %s, want %s", parts[0], topic)
+	}
+	if !bytes.Equal(parts[1], body) {
+		s.t.Fatalf("%s: unexpected body - got %x, want %x", topic,
+			parts[1], body)
+	}
+	if len(parts[2]) != 4 || binary.LittleEndian.Uint32(parts[2]) != sequence {
+		s.t.Fatalf("%s: unexpected sequence number - got %x, want %d",
+			topic, parts[2], sequence)
+	}
+}
+
+// waitForSubscribers waits until the passed number of subscribers is subscribed
+// to the passed topic.
+func waitForSubscribers(t *testing.T, p *Publisher, topic Topic, n int) {
+	t.Helper()
+
+	s := p.topics[topic]
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		var count int
+		s.mtx.Lock()
+		for sub := range s.subscribers {
+			if sub.isSubscribed([]byte(topic)) {
+				count++
+			}
+		}
+		s.mtx.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d subscribers to %s", n, topic)
+}
+
+// TestPublisher ensures chain notifications and accepted transactions are
+// published to the subscribers of their topics with increasing sequence
+// numbers per topic.
+func TestPublisher(t *testing.T) {
+	p, err := New(&Config{
+		Endpoints: map[Topic]string{
+			TopicHashBlock: "tcp://127.0.0.1:0",
+			TopicRawBlock:  "tcp://127.0.0.1:0",
+			TopicHashTx:    "tcp://*:0",
+			TopicRawTx:     "tcp://*:0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	if p.Addr(TopicHashBlock) != p.Addr(TopicRawBlock) ||
+		p.Addr(TopicHashTx) != p.Addr(TopicRawTx) {
+		t.Fatalf("topics with the same endpoint are not published on " +
+			"the same socket")
+	}
+	txAddr := &net.TCPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: p.Addr(TopicHashTx).(*net.TCPAddr).Port,
+	}
+
+	// Subscribe to the raw blocks only and to all transaction topics.
+	blockSub := newTestSubscriber(t, p.Addr(TopicRawBlock), "rawblock")
+	txSub := newTestSubscriber(t, txAddr, "")
+	waitForSubscribers(t, p, TopicRawBlock, 1)
+	waitForSubscribers(t, p, TopicHashTx, 1)
+
+	// Connecting a block publishes its transactions and the block.
+	block := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	coinbase := block.Transactions()[0]
+	p.HandleChainNotification(&blockchain.Notification{
+		Type: blockchain.NTBlockConnected,
+		Data: block,
+	})
+	blockBytes, _ := block.Bytes()
+	blockSub.checkMessage(TopicRawBlock, blockBytes, 0)
+	var coinbaseBytes bytes.Buffer
+	coinbase.MsgTx().Serialize(&coinbaseBytes)
+	txSub.checkMessage(TopicHashTx, reversedHash(coinbase.Hash()[:]), 0)
+	txSub.checkMessage(TopicRawTx, coinbaseBytes.Bytes(), 0)
+
+	// Accepting a transaction to the memory pool publishes it.
+	tx := btcutil.NewTx(chaincfg.RegressionNetParams.GenesisBlock.Transactions[0])
+	var txBytes bytes.Buffer
+	tx.MsgTx().Serialize(&txBytes)
+	p.PublishTx(tx)
+	txSub.checkMessage(TopicHashTx, reversedHash(tx.Hash()[:]), 1)
+	txSub.checkMessage(TopicRawTx, txBytes.Bytes(), 1)
+
+	// Disconnecting a block publishes its transactions again.  The hash of
+	// the block was never sent to the block subscriber, so the next block
+	// it receives has the next raw block sequence number.
+	p.HandleChainNotification(&blockchain.Notification{
+		Type: blockchain.NTBlockDisconnected,
+		Data: block,
+	})
+	txSub.checkMessage(TopicHashTx, reversedHash(coinbase.Hash()[:]), 2)
+	txSub.checkMessage(TopicRawTx, coinbaseBytes.Bytes(), 2)
+	block2 := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	p.PublishBlock(block2)
+	block2Bytes, _ := block2.Bytes()
+	blockSub.checkMessage(TopicRawBlock, block2Bytes, 1)
+
+	// Ensure the hash of the block was published with its own sequence
+	// numbers to a new subscriber.
+	hashSub := newTestSubscriber(t, p.Addr(TopicHashBlock), "hashblock")
+	waitForSubscribers(t, p, TopicHashBlock, 1)
+	p.PublishBlock(block)
+	hashSub.checkMessage(TopicHashBlock, reversedHash(block.Hash()[:]), 2)
+}
+
+// TestNewInvalidConfig ensures invalid topics and endpoints are rejected.
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints map[Topic]string
+	}{{
+		name:      "unknown topic",
+		endpoints: map[Topic]string{"rawmempool": "tcp://127.0.0.1:0"},
+	}, {
+		name:      "unsupported transport",
+		endpoints: map[Topic]string{TopicHashTx: "ipc:///tmp/btcd"},
+	}, {
+		name:      "missing port",
+		endpoints: map[Topic]string{TopicHashTx: "tcp://127.0.0.1"},
+	}}
+	for _, test := range tests {
+		if _, err := New(&Config{Endpoints: test.endpoints}); err == nil {
+			t.Errorf("%s: did not receive expected error", test.name)
+		}
+	}
+}
+
+// TestSequence ensures the events published to the sequence topic have strictly
+// increasing sequence numbers and appear in the order they happen across a
+// transaction being accepted, a block connecting, and a reorganize.
+func TestSequence(t *testing.T) {
+	p, err := New(&Config{
+		Endpoints: map[Topic]string{
+			TopicSequence: "tcp://127.0.0.1:0",
+			TopicHashTx:   "tcp://127.0.0.1:0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	sub := newTestSubscriber(t, p.Addr(TopicSequence), "sequence")
+	waitForSubscribers(t, p, TopicSequence, 1)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, nil))
+	mempoolTx := btcutil.NewTx(tx)
+	block := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	otherBlock := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	chainNotification := func(typ blockchain.NotificationType, block *btcutil.Block) {
+		p.HandleChainNotification(&blockchain.Notification{
+			Type: typ,
+			Data: block,
+		})
+	}
+
+	// Accept a transaction, connect a block which includes it, then
+	// reorganize to another block which double spends it.
+	p.TxAccepted(mempoolTx)
+	chainNotification(blockchain.NTBlockConnected, block)
+	p.TxRemoved(mempoolTx, mempool.RemovalReasonExplicit)
+	chainNotification(blockchain.NTBlockDisconnected, block)
+	p.TxAccepted(mempoolTx)
+	chainNotification(blockchain.NTBlockConnected, otherBlock)
+	p.TxRemoved(mempoolTx, mempool.RemovalReasonDoubleSpend)
+
+	event := func(hash *chainhash.Hash, label byte, extra ...byte) []byte {
+		return append(append(reversedHash(hash[:]), label), extra...)
+	}
+	mempoolEvent := func(label byte, mempoolSequence uint64) []byte {
+		var seq [8]byte
+		binary.LittleEndian.PutUint64(seq[:], mempoolSequence)
+		return event(mempoolTx.Hash(), label, seq[:]...)
+	}
+	want := [][]byte{
+		mempoolEvent(sequenceTxAdded, 0),
+		event(block.Hash(), sequenceBlockConnected),
+		mempoolEvent(sequenceTxRemoved, 1),
+		event(block.Hash(), sequenceBlockDisconnected),
+		mempoolEvent(sequenceTxAdded, 2),
+		event(otherBlock.Hash(), sequenceBlockConnected),
+		mempoolEvent(sequenceTxRemoved, 3),
+	}
+	for i, body := range want {
+		sub.checkMessage(TopicSequence, body, uint32(i))
+	}
+}
+
+// testTemporaryError is a temporary network error.
+type testTemporaryError struct{}
+
+func (testTemporaryError) Error() string   { return "temporary error" }
+func (testTemporaryError) Timeout() bool   { return false }
+func (testTemporaryError) Temporary() bool { return true }
+
+// testErrListener is a listener which fails to accept connections with the
+// errors it receives.
+type testErrListener struct {
+	net.Listener
+	errs chan error
+}
+
+func (l *testErrListener) Accept() (net.Conn, error) {
+	return nil, <-l.errs
+}
+
+// TestListenHandlerErrors ensures the listen handler keeps accepting
+// subscribers after temporary errors, and that it stops on other errors, such
+// as the listener being closed, and once the publisher is stopped while it is
+// backing off.
+func TestListenHandlerErrors(t *testing.T) {
+	p, err := New(&Config{
+		Endpoints: map[Topic]string{TopicHashTx: "tcp://127.0.0.1:0"},
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	defer p.Stop()
+
+	runHandler := func(listener *testErrListener) chan struct{} {
+		done := make(chan struct{})
+		s := &socket{listener: listener}
+		p.wg.Add(1)
+		go func() {
+			p.listenHandler(s)
+			close(done)
+		}()
+		return done
+	}
+	waitDone := func(done chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("listen handler did not stop %s", what)
+		}
+	}
+
+	listener := &testErrListener{
+		Listener: p.topics[TopicHashTx].listener,
+		errs:     make(chan error, 1),
+	}
+	done := runHandler(listener)
+	listener.errs <- testTemporaryError{}
+	listener.errs <- &net.OpError{Op: "accept", Err: errors.New("closed")}
+	waitDone(done, "after a permanent error")
+
+	listener.errs <- testTemporaryError{}
+	done = runHandler(listener)
+	time.Sleep(100 * time.Millisecond)
+	p.Stop()
+	waitDone(done, "when stopped while backing off")
+}
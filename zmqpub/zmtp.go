@@ -0,0 +1,200 @@
+// Copyright (c) 2020 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// This file implements the parts of version 3.0 of the ZeroMQ Message Transport
+// Protocol (ZMTP) defined by https://rfc.zeromq.org/spec/23/ which are needed
+// to serve PUB sockets using the NULL security mechanism.
+
+const (
+	// greetingSize is the size of the greeting which starts a connection.
+	greetingSize = 64
+
+	// zmtpMajorVersion and zmtpMinorVersion are the version of the protocol
+	// advertised in the greeting.  Advertising 3.0 causes peers which
+	// support later versions to send subscriptions as messages.
+	zmtpMajorVersion = 3
+	zmtpMinorVersion = 0
+
+	// maxFrameSize is the maximum size of a command or message frame
+	// which is read from a subscriber.  Subscribers only send the ready
+	// command and subscriptions, which are far smaller.
+	maxFrameSize = 64 * 1024
+)
+
+// Flags of a frame.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// nullMechanism is the name of the NULL security mechanism padded to the size
+// of the mechanism field of the greeting.
+var nullMechanism = [20]byte{'N', 'U', 'L', 'L'}
+
+// errFrameTooLarge is returned when a peer sends a frame which exceeds
+// maxFrameSize.
+var errFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// writeGreeting writes the greeting of a connection using the NULL mechanism.
+func writeGreeting(w io.Writer) error {
+	var greeting [greetingSize]byte
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = zmtpMajorVersion
+	greeting[11] = zmtpMinorVersion
+	copy(greeting[12:32], nullMechanism[:])
+	_, err := w.Write(greeting[:])
+	return err
+}
+
+// readGreeting reads the greeting of the peer and ensures it uses a compatible
+// version of the protocol along with the NULL mechanism.
+func readGreeting(r io.Reader) error {
+	var greeting [greetingSize]byte
+	if _, err := io.ReadFull(r, greeting[:]); err != nil {
+		return err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f {
+		return errors.New("invalid greeting signature")
+	}
+	if greeting[10] < zmtpMajorVersion {
+		return fmt.Errorf("unsupported protocol version %d.%d",
+			greeting[10], greeting[11])
+	}
+	if !bytes.Equal(greeting[12:32], nullMechanism[:]) {
+		return fmt.Errorf("unsupported security mechanism %q",
+			bytes.TrimRight(greeting[12:32], "\x00"))
+	}
+	return nil
+}
+
+// frame is a single frame of a message or a command.
+type frame struct {
+	flags byte
+	body  []byte
+}
+
+// writeFrame writes a frame with the passed flags and body.  The long flag is
+// set as needed.
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var header [9]byte
+	headerLen := 2
+	if len(body) > 255 {
+		header[0] = flags | flagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+		headerLen = 9
+	} else {
+		header[0] = flags
+		header[1] = byte(len(body))
+	}
+	if _, err := w.Write(header[:headerLen]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// writeMessage writes a message consisting of the passed frames.
+func writeMessage(w io.Writer, parts [][]byte) error {
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = flagMore
+		}
+		if err := writeFrame(w, flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads a single frame which may not exceed maxSize.
+func readFrame(r io.Reader, maxSize uint64) (*frame, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return nil, err
+	}
+	flags := header[0]
+	size := uint64(header[1])
+	if flags&flagLong != 0 {
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(header[1:])
+	}
+	if size > maxSize {
+		return nil, errFrameTooLarge
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &frame{flags: flags &^ flagLong, body: body}, nil
+}
+
+// command is a parsed command frame.
+type command struct {
+	name string
+	data []byte
+}
+
+// parseCommand parses the body of a command frame.
+func parseCommand(body []byte) (*command, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return nil, errors.New("malformed command")
+	}
+	nameLen := int(body[0])
+	return &command{
+		name: string(body[1 : 1+nameLen]),
+		data: body[1+nameLen:],
+	}, nil
+}
+
+// writeReadyCommand writes a READY command with the passed socket type.
+func writeReadyCommand(w io.Writer, socketType string) error {
+	const name, property = "READY", "Socket-Type"
+	var body bytes.Buffer
+	body.WriteByte(byte(len(name)))
+	body.WriteString(name)
+	body.WriteByte(byte(len(property)))
+	body.WriteString(property)
+	var valueLen [4]byte
+	binary.BigEndian.PutUint32(valueLen[:], uint32(len(socketType)))
+	body.Write(valueLen[:])
+	body.WriteString(socketType)
+	return writeFrame(w, flagCommand, body.Bytes())
+}
+
+// parseReadyProperties parses the metadata properties of a READY command.
+// The property names are case-insensitive, so they are returned in lower case.
+func parseReadyProperties(data []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+4 {
+			return nil, errors.New("malformed ready property")
+		}
+		name := string(bytes.ToLower(data[1 : 1+nameLen]))
+		data = data[1+nameLen:]
+		valueLen := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueLen) {
+			return nil, errors.New("malformed ready property")
+		}
+		properties[name] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+	return properties, nil
+}